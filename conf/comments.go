@@ -0,0 +1,153 @@
+package conf
+
+import (
+	"text/scanner"
+	"unicode/utf8"
+)
+
+// tokenComments are the comments attached to a token by a commentScanner.
+type tokenComments struct {
+	doc  []string
+	line string
+}
+
+type commentScanner struct {
+	s    Scanner
+	cur  Token
+	next *Token
+	doc  []string
+	end  bool
+	done bool
+}
+
+func (cs *commentScanner) Next() bool {
+	if cs.next == nil {
+		cs.read()
+	}
+	if cs.next == nil {
+		cs.done = true
+		return false
+	}
+	cs.cur, cs.next = *cs.next, nil
+
+	// read ahead to find a comment after the token on the same line
+	if cs.end {
+		return true
+	}
+	for cs.s.Next() {
+		if cs.s.Tok() != scanner.Comment {
+			cs.take()
+			return true
+		}
+		if cs.s.StartPos().Line == cs.cur.Pos.Line && cs.cur.com.line == "" && len(cs.doc) == 0 {
+			cs.cur.com.line = cs.s.Text()
+			continue
+		}
+		cs.doc = append(cs.doc, cs.s.Text())
+	}
+	cs.end = true
+	return true
+}
+
+// read reads the next token from the parent, along with the comments before it.
+func (cs *commentScanner) read() {
+	if cs.end {
+		return
+	}
+	for cs.s.Next() {
+		if cs.s.Tok() == scanner.Comment {
+			cs.doc = append(cs.doc, cs.s.Text())
+			continue
+		}
+		cs.take()
+		return
+	}
+	cs.end = true
+}
+
+// take buffers the current token of the parent as the next token, with the pending comments.
+func (cs *commentScanner) take() {
+	t := currentToken(cs.s)
+	t.com = tokenComments{doc: cs.doc}
+	cs.next, cs.doc = &t, nil
+}
+
+func (cs *commentScanner) Tok() rune {
+	return cs.cur.Tok
+}
+
+func (cs *commentScanner) Text() string {
+	return cs.cur.Text
+}
+
+func (cs *commentScanner) Pos() scanner.Position {
+	if cs.done {
+		return cs.s.Pos()
+	}
+	return cs.cur.Pos
+}
+
+func (cs *commentScanner) StartPos() scanner.Position {
+	if cs.done {
+		return cs.s.StartPos()
+	}
+	return cs.cur.Start
+}
+
+func (cs *commentScanner) Err() error {
+	if !cs.done {
+		return nil
+	}
+	return cs.s.Err()
+}
+
+func (cs *commentScanner) peekRune() rune {
+	switch {
+	case cs.next == nil && !cs.end:
+		return peekRune(cs.s)
+	case cs.next == nil:
+		return scanner.EOF
+	case cs.cur.com.line == "" && cs.next.com.doc == nil && cs.next.Start == cs.cur.Pos:
+		// the next token directly follows the current token
+		r, _ := utf8.DecodeRuneInString(cs.next.Text)
+		return r
+	default:
+		return ' '
+	}
+}
+
+func (cs *commentScanner) comments() tokenComments {
+	if cs.done {
+		return tokenComments{doc: cs.doc}
+	}
+	return cs.cur.com
+}
+
+// commentsOf returns the comments attached to the current token of a Scanner.
+// If the Scanner does not keep comments, there are none.
+func commentsOf(scan Scanner) tokenComments {
+	if c, ok := scan.(interface{ comments() tokenComments }); ok {
+		return c.comments()
+	}
+	return tokenComments{}
+}
+
+// KeepComments returns a Scanner which removes comments from the token stream of the parent, and attaches them to the surrounding tokens.
+// The parent should be created from a scanner.Scanner with the scanner.ScanComments mode, and without scanner.SkipComments.
+// Note that scanner.Scanner.Init resets the mode, so the mode must be set after Init.
+// A comment after a token on the same line is attached to that token as a line comment, and other comments are attached to the following token.
+// The attached comments are retrieved with Comments, and are kept by the other Scanners in this package when wrapping this one, such as AutoSemicolon.
+// Comments at the end of the input are attached to the end, and may be retrieved once Next returns false.
+func KeepComments(parent Scanner) Scanner {
+	return &commentScanner{s: parent}
+}
+
+// Comments returns the comments attached to the current token of a Scanner which keeps comments.
+// The doc comments are the comments before the token, in order.
+// The line comment is a comment after the token on the same line, if there is one.
+// Comments are returned with their delimiters, as written in the source.
+// If the Scanner does not keep comments, there are none.
+func Comments(scan Scanner) (doc []string, line string) {
+	c := commentsOf(scan)
+	return c.doc, c.line
+}
@@ -0,0 +1,102 @@
+package conf
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"text/scanner"
+)
+
+func TestComments(t *testing.T) {
+	t.Parallel()
+
+	const src = "// top\n\n// doc\nport 80 // line\n/* a */ /* b */ host {\n    name x // inner\n}\n// end\n"
+
+	t.Run("Tokens", func(t *testing.T) {
+		t.Parallel()
+
+		var got []string
+		scan := scanString(src, "test.conf")
+		for scan.Next() {
+			doc, line := Comments(scan)
+			if doc != nil || line != "" {
+				got = append(got, scan.Text()+" "+strings.Join(doc, "|")+" "+line)
+			}
+		}
+		if err := scan.Err(); err != nil {
+			t.Fatal(err)
+		}
+		expect := []string{
+			"port // top|// doc ",
+			"80  // line",
+			"host /* a */|/* b */ ",
+			"x  // inner",
+		}
+		if !reflect.DeepEqual(got, expect) {
+			t.Errorf("expected comments:\n%s\nbut got:\n%s", strings.Join(expect, "\n"), strings.Join(got, "\n"))
+		}
+	})
+
+	t.Run("End", func(t *testing.T) {
+		t.Parallel()
+
+		// Comments at the end are attached to the end of the input.
+		scan := KeepComments(scanReader(strings.NewReader(src), "test.conf"))
+		for scan.Next() {
+		}
+		if doc, _ := Comments(scan); !reflect.DeepEqual(doc, []string{"// end"}) {
+			t.Errorf("unexpected comments %q at the end", doc)
+		}
+	})
+
+	t.Run("Directives", func(t *testing.T) {
+		t.Parallel()
+
+		dirs := parseString(t, src)
+		if len(dirs) != 2 {
+			t.Fatalf("expected 2 directives but got %d", len(dirs))
+		}
+		if !reflect.DeepEqual(dirs[0].Comments, []string{"// top", "// doc"}) || dirs[0].LineComment != "// line" {
+			t.Errorf("unexpected comments %q and %q on port", dirs[0].Comments, dirs[0].LineComment)
+		}
+		if !reflect.DeepEqual(dirs[1].Comments, []string{"/* a */", "/* b */"}) || dirs[1].LineComment != "" {
+			t.Errorf("unexpected comments %q and %q on host", dirs[1].Comments, dirs[1].LineComment)
+		}
+		block, _ := dirs[1].Block()
+		if len(block) != 1 || block[0].LineComment != "// inner" {
+			t.Errorf("unexpected block %#v", block)
+		}
+	})
+
+	t.Run("NotKept", func(t *testing.T) {
+		t.Parallel()
+
+		// Without KeepComments, the comments are skipped by the scanner.Scanner.
+		var s scanner.Scanner
+		s.Init(strings.NewReader(src))
+		scan := AutoSemicolon(Scan(&s))
+		n := 0
+		for scan.Next() {
+			if doc, line := Comments(scan); doc != nil || line != "" {
+				t.Errorf("unexpected comments %q and %q on %q", doc, line, scan.Text())
+			}
+			n++
+		}
+		if n != 10 {
+			t.Errorf("expected 10 tokens but got %d", n)
+		}
+	})
+
+	t.Run("Heredoc", func(t *testing.T) {
+		t.Parallel()
+
+		// A heredoc must end its line, so the line comment is dropped.
+		dat, err := Marshal(Directive{Name: "desc", Args: []Arg{StringArg("a\nb")}, Comments: []string{"// doc"}, LineComment: "// line"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expect := "// doc\ndesc <<EOF\n    a\n    b\n    EOF\n"; string(dat) != expect {
+			t.Errorf("expected %q but got %q", expect, dat)
+		}
+	})
+}
@@ -0,0 +1,243 @@
+package conf
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"text/scanner"
+)
+
+// scanString scans configuration text with comments kept, in the way a program reading a configuration file would set up the Scanners.
+func scanString(src, filename string) Scanner {
+	return AutoSemicolon(KeepComments(scanReader(strings.NewReader(src), filename)))
+}
+
+// scanReader wraps a scanner.Scanner reading a file, with comments scanned but not skipped.
+func scanReader(r io.Reader, filename string) Scanner {
+	var s scanner.Scanner
+	s.Init(r)
+	s.Mode = scanner.GoTokens &^ scanner.SkipComments
+	s.Position.Filename = filename
+	return Scan(&s)
+}
+
+// parseString parses configuration text into directives.
+func parseString(t *testing.T, src string) []Directive {
+	t.Helper()
+
+	dirs, err := ParseDirectives(scanString(src, "test.conf"))
+	if err != nil {
+		t.Fatalf("failed to parse %q: %v", src, err)
+	}
+	return dirs
+}
+
+// clearPos removes the positions from a tree of directives, so that trees parsed from different text can be compared.
+func clearPos(dirs []Directive) []Directive {
+	out := make([]Directive, len(dirs))
+	for i, d := range dirs {
+		d.Pos = scanner.Position{}
+		args := make([]Arg, len(d.Args))
+		for j, a := range d.Args {
+			a.Pos = scanner.Position{}
+			if a.Block != nil {
+				a.Block = clearPos(a.Block)
+			}
+			args[j] = a
+		}
+		d.Args = args
+		out[i] = d
+	}
+	return out
+}
+
+// names lists the names of a tree of directives, with the names in blocks in braces.
+func names(dirs []Directive) string {
+	var parts []string
+	for _, d := range dirs {
+		name := d.Name
+		if block, ok := d.Block(); ok {
+			name += "{" + names(block) + "}"
+		}
+		parts = append(parts, name)
+	}
+	return strings.Join(parts, " ")
+}
+
+func TestMarshalRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name string
+
+		// src is the text to parse.
+		src string
+
+		// canonical is the text written by Marshal, if it is not the same as src.
+		canonical string
+	}{
+		{
+			name: "Words",
+			src:  "listen localhost 8080\n",
+		},
+		{
+			name:      "Block",
+			src:       `server { listen 80; root "/var/www" }`,
+			canonical: "server {\n    listen 80\n    root \"/var/www\"\n}\n",
+		},
+		{
+			name: "EmptyBlock",
+			src:  "empty {}\n",
+		},
+		{
+			name: "Nested",
+			src:  "a {\n    b {\n        c 1\n    }\n    d\n}\n",
+		},
+		{
+			name:      "SingleQuotes",
+			src:       `greeting 'h' "hello world"` + "\n",
+			canonical: `greeting 'h' "hello world"` + "\n",
+		},
+		{
+			name: "RawString",
+			src:  "path `C:\\dir`\n",
+		},
+		{
+			name: "Negative",
+			src:  "offset -5 -1.5\n",
+		},
+		{
+			name:      "Subtraction",
+			src:       "range 1 - 2\n",
+			canonical: "range 1 - 2\n",
+		},
+		{
+			name: "Brackets",
+			src:  "type []string\n",
+		},
+		{
+			name: "Comments",
+			src:  "// doc\n// more doc\nport 80 // line\nhost {\n    // inner\n    name x\n}\n",
+		},
+		{
+			name:      "BlockComments",
+			src:       "/* doc */ a { // open\n} /* close */\n",
+			canonical: "/* doc */\na {} /* close */\n",
+		},
+		{
+			name: "Heredoc",
+			src:  "desc <<EOF\n    first line\n\n    second line\n    EOF\nnext 1\n",
+		},
+		{
+			name:      "IndentedHeredoc",
+			src:       "outer {\n  desc <<END\n    a\n      b\n    END\n}\n",
+			canonical: "outer {\n    desc <<EOF\n        a\n          b\n        EOF\n}\n",
+		},
+		{
+			name:      "QuotedMultiline",
+			src:       `desc "a\nb"` + "\n",
+			canonical: "desc <<EOF\n    a\n    b\n    EOF\n",
+		},
+		{
+			name:      "MultilineWithDelimiter",
+			src:       `desc "a\nEOF\nb"` + "\n",
+			canonical: `desc "a\nEOF\nb"` + "\n",
+		},
+		{
+			name:      "MultilineNotLast",
+			src:       `desc "a\nb" 1` + "\n",
+			canonical: `desc "a\nb" 1` + "\n",
+		},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			canonical := c.canonical
+			if canonical == "" {
+				canonical = c.src
+			}
+
+			dirs := parseString(t, c.src)
+			dat, err := Marshal(dirs)
+			if err != nil {
+				t.Fatalf("failed to marshal: %v", err)
+			}
+			if string(dat) != canonical {
+				t.Errorf("expected %q but got %q", canonical, dat)
+			}
+
+			reparsed := parseString(t, string(dat))
+			if !reflect.DeepEqual(clearPos(dirs), clearPos(reparsed)) {
+				t.Errorf("round trip changed the directives from %#v to %#v", clearPos(dirs), clearPos(reparsed))
+			}
+		})
+	}
+}
+
+func TestParseDirectivesErrors(t *testing.T) {
+	t.Parallel()
+
+	for _, src := range []string{
+		"1 x\n",
+		"a }\n",
+		"a {\n",
+		"a \"unterminated\n",
+	} {
+		if dirs, err := ParseDirectives(scanString(src, "test.conf")); err == nil {
+			t.Errorf("expected an error from %q but got %v", src, dirs)
+		}
+	}
+}
+
+func TestDirectiveString(t *testing.T) {
+	t.Parallel()
+
+	d := Directive{Name: "server", Args: []Arg{StringArg("a b"), BlockArg(Directive{Name: "port", Args: []Arg{StringArg("x")}})}}
+	if expect := "server \"a b\" {\n    port x\n}"; d.String() != expect {
+		t.Errorf("expected %q but got %q", expect, d.String())
+	}
+}
+
+func TestMarshalStruct(t *testing.T) {
+	t.Parallel()
+
+	type listener struct {
+		Addr string
+		TLS  bool `conf:"tls,omitempty"`
+	}
+	type config struct {
+		Name      string
+		Desc      string `conf:"description"`
+		Ports     []int
+		Listeners []listener `conf:"listen"`
+		Skipped   string     `conf:"-"`
+		Empty     string     `conf:",omitempty"`
+	}
+	dat, err := Marshal(&config{
+		Name:  "web server",
+		Desc:  "serves\nfiles",
+		Ports: []int{80, 443},
+		Listeners: []listener{
+			{Addr: "localhost"},
+			{Addr: "0.0.0.0", TLS: true},
+		},
+		Skipped: "x",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := "name \"web server\"\n" +
+		"description <<EOF\n    serves\n    files\n    EOF\n" +
+		"ports 80 443\n" +
+		"listen {\n    addr localhost\n}\n" +
+		"listen {\n    addr \"0.0.0.0\"\n    tls true\n}\n"
+	if string(dat) != expect {
+		t.Errorf("expected %q but got %q", expect, dat)
+	}
+	if got := names(parseString(t, string(dat))); got != "name description ports listen{addr} listen{addr tls}" {
+		t.Errorf("unexpected directives %q", got)
+	}
+}
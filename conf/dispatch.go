@@ -0,0 +1,126 @@
+package conf
+
+import (
+	"fmt"
+	"strings"
+	"text/scanner"
+)
+
+// ErrUnknownDirective is an error which occurs when a Dispatcher encounters a directive with no handler.
+type ErrUnknownDirective struct {
+	Name string
+}
+
+func (err ErrUnknownDirective) Error() string {
+	return fmt.Sprintf("unknown directive %q", err.Name)
+}
+
+// ErrDuplicateDirective is an error which occurs when a directive registered with HandleOnce is used more than once.
+type ErrDuplicateDirective struct {
+	Name string
+}
+
+func (err ErrDuplicateDirective) Error() string {
+	return fmt.Sprintf("duplicate %s directive", err.Name)
+}
+
+// DirectiveFunc is a handler for a directive, used with a Dispatcher.
+// The pos is the position of the directive name.
+// The args Scanner reads the arguments of the directive, and is positioned before the first argument.
+type DirectiveFunc func(pos scanner.Position, args Scanner) error
+
+// dispatchHandler is a directive handler registered in a Dispatcher.
+type dispatchHandler struct {
+	fn DirectiveFunc
+
+	// name is the name used in errors and to detect duplicates, which is the same for all aliases.
+	name string
+
+	// once is whether the directive may only be used once.
+	once bool
+}
+
+// Dispatcher reads a sequence of directives, calling a handler registered for each directive name.
+// Directive names are case-insensitive.
+// Each directive runs until a semicolon at the same bracket nesting level, and a handler which does not read all of the arguments results in an error.
+// The zero value is an empty Dispatcher.
+type Dispatcher struct {
+	handlers map[string]*dispatchHandler
+}
+
+// add registers a handler, panicking if the name is already in use.
+func (d *Dispatcher) add(name string, h *dispatchHandler) {
+	name = strings.ToLower(name)
+	if _, ok := d.handlers[name]; ok {
+		panic(fmt.Sprintf("conf: duplicate handler for directive %q", name))
+	}
+	if d.handlers == nil {
+		d.handlers = map[string]*dispatchHandler{}
+	}
+	d.handlers[name] = h
+}
+
+// Handle registers a handler for a directive name.
+// It panics if a handler is already registered for the name.
+func (d *Dispatcher) Handle(name string, fn DirectiveFunc) {
+	d.add(name, &dispatchHandler{fn: fn, name: strings.ToLower(name)})
+}
+
+// HandleOnce registers a handler for a directive which may only be used once in the directives read by a call to Dispatch.
+// Later uses of the directive result in an ErrDuplicateDirective.
+// It panics if a handler is already registered for the name.
+func (d *Dispatcher) HandleOnce(name string, fn DirectiveFunc) {
+	d.add(name, &dispatchHandler{fn: fn, name: strings.ToLower(name), once: true})
+}
+
+// Alias registers an alternative name for an already registered directive.
+// Uses of the alias count as uses of the original directive when detecting duplicates.
+// It panics if the directive is not registered or the alias is already in use.
+func (d *Dispatcher) Alias(alias, name string) {
+	h, ok := d.handlers[strings.ToLower(name)]
+	if !ok {
+		panic(fmt.Sprintf("conf: alias %q for unknown directive %q", alias, name))
+	}
+	d.add(alias, h)
+}
+
+// Dispatch reads directives from the Scanner until it ends, calling the registered handlers.
+// Errors from handlers are annotated with the position of the directive if they do not already have a position.
+// It stops at the first error.
+func (d *Dispatcher) Dispatch(scan Scanner) error {
+	seen := map[*dispatchHandler]struct{}{}
+	for scan.Next() {
+		name, err := ScanString(scan)
+		if err != nil {
+			return err
+		}
+		pos := scan.Pos()
+		h, ok := d.handlers[strings.ToLower(name)]
+		if !ok {
+			return wrapToken(ErrUnknownDirective{name}, scan)
+		}
+		if h.once {
+			if _, ok := seen[h]; ok {
+				return wrapToken(ErrDuplicateDirective{h.name}, scan)
+			}
+			seen[h] = struct{}{}
+		}
+
+		args := ScanSemicolon(scan, openers, closers)
+		if err := h.fn(pos, args); err != nil {
+			return WrapPos(err, pos)
+		}
+
+		// check for semicolon
+		if args.Next() {
+			return Unexpected(args)
+		} else if err := args.Err(); err != nil {
+			return WrapPos(err, pos)
+		}
+	}
+	return scan.Err()
+}
+
+// openers and closers are the brackets which may be nested within a directive.
+var openers = []rune("({[")
+var closers = []rune(")}]")
@@ -0,0 +1,155 @@
+package conf
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"text/scanner"
+)
+
+func TestDispatcher(t *testing.T) {
+	t.Parallel()
+
+	// newDispatcher creates a Dispatcher which records the directives into got.
+	var newDispatcher func(got *[]string) *Dispatcher
+	newDispatcher = func(got *[]string) *Dispatcher {
+		var d Dispatcher
+		d.Handle("listen", func(pos scanner.Position, args Scanner) error {
+			var ports []string
+			for args.Next() {
+				port, err := ScanInt(args, 16)
+				if err != nil {
+					return err
+				}
+				ports = append(ports, strconv.FormatInt(port, 10))
+			}
+			*got = append(*got, "listen "+strings.Join(ports, ","))
+			return nil
+		})
+		d.HandleOnce("root", func(pos scanner.Position, args Scanner) error {
+			if !args.Next() {
+				return errors.New("missing root")
+			}
+			root, err := ScanString(args)
+			if err != nil {
+				return err
+			}
+			*got = append(*got, "root "+root)
+			return nil
+		})
+		d.Alias("docroot", "root")
+		d.Handle("block", func(pos scanner.Position, args Scanner) error {
+			// Only read the name, leaving the block for the Dispatcher to reject if it is not read.
+			if !args.Next() {
+				return args.Err()
+			}
+			*got = append(*got, "block "+args.Text())
+			if args.Next() && args.Tok() == '{' {
+				return newDispatcher(got).Dispatch(ScanBracket(args, '{', '}'))
+			}
+			return nil
+		})
+		return &d
+	}
+
+	cases := []struct {
+		name   string
+		src    string
+		expect string
+		err    string
+	}{
+		{
+			name:   "Directives",
+			src:    "LISTEN 80 443\nroot \"/srv\"\nlisten 8080\n",
+			expect: "listen 80,443|root /srv|listen 8080",
+		},
+		{
+			name:   "Nested",
+			src:    "block a {\n    listen 1\n    root x\n}\nroot y\n",
+			expect: "block a|listen 1|root x|root y",
+		},
+		{
+			name:   "Unknown",
+			src:    "listen 80\nport 1\n",
+			expect: "listen 80",
+			err:    `unknown directive "port" (test.conf:2:5)`,
+		},
+		{
+			name:   "Duplicate",
+			src:    "root a\nroot b\n",
+			expect: "root a",
+			err:    "duplicate root directive (test.conf:2:5)",
+		},
+		{
+			name:   "DuplicateAlias",
+			src:    "docroot a\nRoot b\n",
+			expect: "root a",
+			err:    "duplicate root directive (test.conf:2:5)",
+		},
+		{
+			name: "HandlerError",
+			src:  "root\n",
+			err:  "missing root (test.conf:1:5)",
+		},
+		{
+			name: "ValueError",
+			src:  "listen x\n",
+			err:  `unexpected token "x" (test.conf:1:9)`,
+		},
+		{
+			name:   "Unread",
+			src:    "root a b\n",
+			expect: "root a",
+			err:    `unexpected token "b" (test.conf:1:9)`,
+		},
+		{
+			name: "NotName",
+			src:  "1 2\n",
+			err:  "unexpected integer 1",
+		},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			var got []string
+			err := newDispatcher(&got).Dispatch(scanString(c.src, "test.conf"))
+			if s := strings.Join(got, "|"); s != c.expect {
+				t.Errorf("expected directives %q but got %q", c.expect, s)
+			}
+			switch {
+			case c.err == "" && err != nil:
+				t.Errorf("unexpected error: %v", err)
+			case c.err != "" && (err == nil || !strings.Contains(err.Error(), c.err)):
+				t.Errorf("expected an error containing %q but got %v", c.err, err)
+			}
+		})
+	}
+
+	t.Run("Panics", func(t *testing.T) {
+		t.Parallel()
+
+		expectPanic := func(what string, fn func(d *Dispatcher)) {
+			t.Helper()
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s without a panic", what)
+				}
+			}()
+			var d Dispatcher
+			d.Handle("a", func(scanner.Position, Scanner) error { return nil })
+			fn(&d)
+		}
+		expectPanic("registered a name twice", func(d *Dispatcher) {
+			d.HandleOnce("A", func(scanner.Position, Scanner) error { return nil })
+		})
+		expectPanic("aliased an unknown directive", func(d *Dispatcher) {
+			d.Alias("b", "c")
+		})
+		expectPanic("aliased over a directive", func(d *Dispatcher) {
+			d.Alias("a", "a")
+		})
+	})
+}
@@ -0,0 +1,157 @@
+package conf
+
+import (
+	"text/scanner"
+	"unicode/utf8"
+)
+
+// Token is a single token read from a Scanner.
+type Token struct {
+	// Tok is the token character, as returned by Scanner.Tok.
+	Tok rune
+
+	// Text is the text of the token, as returned by Scanner.Text.
+	Text string
+
+	// Start is the position of the first character of the token, as returned by Scanner.StartPos.
+	Start scanner.Position
+
+	// Pos is the position directly after the token, as returned by Scanner.Pos.
+	Pos scanner.Position
+
+	// com are the comments attached to the token.
+	com tokenComments
+}
+
+// currentToken returns the current token of a Scanner.
+func currentToken(scan Scanner) Token {
+	return Token{scan.Tok(), scan.Text(), scan.StartPos(), scan.Pos(), commentsOf(scan)}
+}
+
+// TokenFilter is a preprocessing pass over a stream of tokens, used with Filter.
+// It is called with each token in turn, and returns the tokens to replace it with.
+// A filter may drop a token by returning no tokens, or insert tokens by returning more than one.
+// Filters may keep state between tokens, for example to expand macros defined earlier in the stream.
+// If an error is returned, the error is reported by the Scanner, and scanning stops.
+type TokenFilter func(t Token) ([]Token, error)
+
+// MapTokens creates a TokenFilter which replaces each token with the result of fn.
+func MapTokens(fn func(Token) (Token, error)) TokenFilter {
+	return func(t Token) ([]Token, error) {
+		t, err := fn(t)
+		if err != nil {
+			return nil, err
+		}
+		return []Token{t}, nil
+	}
+}
+
+// DropTokens creates a TokenFilter which drops the tokens for which fn returns true.
+func DropTokens(fn func(Token) bool) TokenFilter {
+	return func(t Token) ([]Token, error) {
+		if fn(t) {
+			return nil, nil
+		}
+		return []Token{t}, nil
+	}
+}
+
+type filterScanner struct {
+	s       Scanner
+	filters []TokenFilter
+	cur     Token
+	queue   []Token
+	err     error
+	done    bool
+}
+
+func (fs *filterScanner) Next() bool {
+	for len(fs.queue) == 0 {
+		if fs.err != nil || !fs.s.Next() {
+			fs.done = true
+			return false
+		}
+		toks := []Token{currentToken(fs.s)}
+		for _, f := range fs.filters {
+			var out []Token
+			for _, t := range toks {
+				ft, err := f(t)
+				if err != nil {
+					fs.err = WrapRange(err, t.Start, t.Pos)
+					fs.done = true
+					return false
+				}
+				out = append(out, ft...)
+			}
+			toks = out
+		}
+		fs.queue = toks
+	}
+	fs.cur, fs.queue = fs.queue[0], fs.queue[1:]
+	return true
+}
+
+func (fs *filterScanner) Tok() rune {
+	return fs.cur.Tok
+}
+
+func (fs *filterScanner) Text() string {
+	return fs.cur.Text
+}
+
+func (fs *filterScanner) Pos() scanner.Position {
+	switch {
+	case fs.err != nil:
+		return fs.err.(PosErr).Pos
+	case fs.done:
+		return fs.s.Pos()
+	default:
+		return fs.cur.Pos
+	}
+}
+
+func (fs *filterScanner) StartPos() scanner.Position {
+	switch {
+	case fs.err != nil:
+		return fs.err.(PosErr).Start
+	case fs.done:
+		return fs.s.StartPos()
+	default:
+		return fs.cur.Start
+	}
+}
+
+func (fs *filterScanner) Err() error {
+	if fs.err != nil {
+		return fs.err
+	}
+	return fs.s.Err()
+}
+
+func (fs *filterScanner) comments() tokenComments {
+	return fs.cur.com
+}
+
+func (fs *filterScanner) peekRune() rune {
+	switch {
+	case len(fs.queue) == 0:
+		// the current token is the last token made from the current token of the parent
+		return peekRune(fs.s)
+	case fs.queue[0].Start == fs.cur.Pos:
+		r, _ := utf8.DecodeRuneInString(fs.queue[0].Text)
+		return r
+	default:
+		return ' '
+	}
+}
+
+// Filter returns a Scanner which passes the tokens from the parent through a pipeline of filters.
+// Each token from the parent is passed to the first filter, and each token produced by a filter is passed to the next filter.
+// The tokens produced by the last filter are the tokens of the Scanner.
+// Errors from filters are annotated with the range of the token being filtered.
+func Filter(parent Scanner, filters ...TokenFilter) Scanner {
+	return &filterScanner{
+		s:       parent,
+		filters: filters,
+	}
+}
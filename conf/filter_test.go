@@ -0,0 +1,122 @@
+package conf
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"text/scanner"
+)
+
+func TestFilter(t *testing.T) {
+	t.Parallel()
+
+	// macro expands a word into several tokens, which are then passed through the later filters.
+	macro := func(t Token) ([]Token, error) {
+		if t.Text != "ports" {
+			return []Token{t}, nil
+		}
+		a, b := t, t
+		a.Tok, a.Text = scanner.Int, "80"
+		b.Tok, b.Text = scanner.Int, "443"
+		return []Token{a, b}, nil
+	}
+	upper := MapTokens(func(t Token) (Token, error) {
+		if t.Tok == scanner.RawString {
+			t.Text = strings.ToUpper(t.Text)
+		}
+		return t, nil
+	})
+	noComma := DropTokens(func(t Token) bool {
+		return t.Tok == ','
+	})
+	reject := MapTokens(func(t Token) (Token, error) {
+		if t.Text == "bad" {
+			return Token{}, errors.New("rejected")
+		}
+		return t, nil
+	})
+
+	cases := []struct {
+		name    string
+		src     string
+		filters []TokenFilter
+		expect  string
+		err     string
+	}{
+		{
+			name:   "None",
+			src:    "listen a, b\n",
+			expect: "listen a , b ;",
+		},
+		{
+			name:    "Pipeline",
+			src:     "listen ports, x // c\n",
+			filters: []TokenFilter{macro, upper, noComma},
+			expect:  "LISTEN 80 443 X ;",
+		},
+		{
+			name:    "Order",
+			src:     "ports\n",
+			filters: []TokenFilter{upper, macro},
+			expect:  "PORTS ;",
+		},
+		{
+			name:    "Error",
+			src:     "a 1\nb bad c\n",
+			filters: []TokenFilter{reject},
+			expect:  "a 1 ; b ;",
+			err:     "rejected (test.conf:2:6)",
+		},
+		{
+			name:    "Interpolate",
+			src:     "root \"${DIR}/x\" `${DIR}`\n",
+			filters: []TokenFilter{InterpolateFilter(func(string) (string, bool) { return "/srv", true })},
+			expect:  "root \"/srv/x\" `${DIR}` ;",
+		},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			var got []string
+			scan := AutoSemicolon(Filter(KeepComments(scanReader(strings.NewReader(c.src), "test.conf")), c.filters...))
+			for scan.Next() {
+				got = append(got, scan.Text())
+			}
+			if s := strings.Join(got, " "); s != c.expect {
+				t.Errorf("expected tokens %q but got %q", c.expect, s)
+			}
+			err := scan.Err()
+			switch {
+			case c.err == "" && err != nil:
+				t.Errorf("unexpected error: %v", err)
+			case c.err != "" && (err == nil || err.Error() != c.err):
+				t.Errorf("expected error %q but got %v", c.err, err)
+			}
+		})
+	}
+
+	t.Run("Range", func(t *testing.T) {
+		t.Parallel()
+
+		// Errors cover the token being filtered, and the tokens keep their comments.
+		scan := Filter(KeepComments(scanReader(strings.NewReader("// doc\nx bad"), "test.conf")), reject)
+		if !scan.Next() {
+			t.Fatal(scan.Err())
+		}
+		if doc, _ := Comments(scan); len(doc) != 1 || doc[0] != "// doc" {
+			t.Errorf("expected the comment to be kept but got %q", doc)
+		}
+		if scan.Next() {
+			t.Fatalf("unexpected token %q", scan.Text())
+		}
+		var perr PosErr
+		if !errors.As(scan.Err(), &perr) {
+			t.Fatalf("expected a positioned error but got %v", scan.Err())
+		}
+		if perr.Start.Column != 3 || perr.Pos.Column != 6 || scan.StartPos() != perr.Start || scan.Pos() != perr.Pos {
+			t.Errorf("expected the error at 2:3-6 but got %v-%v", perr.Start, perr.Pos)
+		}
+	})
+}
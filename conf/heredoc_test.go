@@ -0,0 +1,177 @@
+package conf
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestScanHeredoc(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name string
+		src  string
+
+		// str is the expected string if err is empty.
+		str string
+
+		// line is the line of the token or error.
+		line int
+
+		err string
+	}{
+		{
+			name: "Simple",
+			src:  "<<EOF\nhello\nEOF\n",
+			str:  "hello",
+			line: 1,
+		},
+		{
+			name: "Indented",
+			src:  "<<END_2\n\t  a\n\n\t    b\n\t  END_2",
+			str:  "a\n\n  b",
+			line: 1,
+		},
+		{
+			name: "Empty",
+			src:  "<<EOF\nEOF\n",
+			str:  "",
+			line: 1,
+		},
+		{
+			name: "CRLF",
+			src:  "<<EOF  \r\nx\r\ny\r\nEOF\r\n",
+			str:  "x\ny",
+			line: 1,
+		},
+		{
+			name: "DelimiterInText",
+			src:  "<<EOF\nnot EOF\nEOF x\nEOF\n",
+			str:  "not EOF\nEOF x",
+			line: 1,
+		},
+		{
+			name: "MissingDelimiter",
+			src:  "<< EOF\nx\nEOF\n",
+			line: 1,
+			err:  "missing heredoc delimiter",
+		},
+		{
+			name: "DigitDelimiter",
+			src:  "<<1\nx\n1\n",
+			line: 1,
+			err:  "missing heredoc delimiter",
+		},
+		{
+			name: "TextAfterDelimiter",
+			src:  "<<EOF x\nEOF\n",
+			line: 1,
+			err:  `unexpected 'x' after heredoc delimiter`,
+		},
+		{
+			name: "NoLines",
+			src:  "<<EOF",
+			line: 1,
+			err:  "heredoc not terminated",
+		},
+		{
+			name: "NotTerminated",
+			src:  "<<EOF\nx\ny\n",
+			line: 4,
+			err:  "heredoc not terminated",
+		},
+		{
+			name: "Dedented",
+			src:  "<<EOF\n  a\n b\n  EOF\n",
+			line: 4,
+			err:  `heredoc line " b" is indented less than the delimiter`,
+		},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			scan := scanReader(strings.NewReader(c.src), "test.conf")
+			if !scan.Next() {
+				err := scan.Err()
+				var perr PosErr
+				switch {
+				case c.err == "":
+					t.Fatalf("unexpected error: %v", err)
+				case err == nil || !strings.Contains(err.Error(), c.err):
+					t.Errorf("expected an error containing %q but got %v", c.err, err)
+				case !errors.As(err, &perr):
+					t.Errorf("expected a positioned error but got %v", err)
+				case perr.Pos.Line != c.line:
+					t.Errorf("expected the error on line %d but got %v", c.line, err)
+				}
+				return
+			}
+			if c.err != "" {
+				t.Fatalf("expected an error containing %q but got %q", c.err, scan.Text())
+			}
+			str, err := ScanString(scan)
+			if err != nil {
+				t.Fatalf("failed to read string: %v", err)
+			}
+			if str != c.str {
+				t.Errorf("expected %q but got %q", c.str, str)
+			}
+			if line := scan.Pos().Line; line != c.line {
+				t.Errorf("expected the token on line %d but got %d", c.line, line)
+			}
+			if scan.Next() {
+				t.Errorf("unexpected token %q after the heredoc", scan.Text())
+			}
+		})
+	}
+
+	t.Run("Shift", func(t *testing.T) {
+		t.Parallel()
+
+		// A single "<" is not a heredoc.
+		scan := scanReader(strings.NewReader("a < b"), "test.conf")
+		var toks []string
+		for scan.Next() {
+			toks = append(toks, scan.Text())
+		}
+		if got := strings.Join(toks, " "); got != "a < b" {
+			t.Errorf("expected \"a < b\" but got %q", got)
+		}
+	})
+}
+
+func TestMarshalHeredocValue(t *testing.T) {
+	t.Parallel()
+
+	// A string with line breaks is written as a heredoc, and reads back as the same string.
+	for _, str := range []string{
+		"a\nb",
+		"trailing\n",
+		"\nleading",
+		"indented\n    line\n\tand tab",
+		"blank\n\n\nlines",
+	} {
+		dat, err := Marshal(Directive{Name: "text", Args: []Arg{StringArg(str)}})
+		if err != nil {
+			t.Fatalf("failed to marshal %q: %v", str, err)
+		}
+		if !strings.Contains(string(dat), "<<EOF") {
+			t.Errorf("expected %q to be written as a heredoc but got %q", str, dat)
+		}
+
+		scan := scanString(string(dat), "test.conf")
+		if !scan.Next() || !scan.Next() {
+			t.Fatalf("failed to scan %q: %v", dat, scan.Err())
+		}
+		got, err := ScanString(scan)
+		if err != nil {
+			t.Fatalf("failed to scan %q: %v", dat, err)
+		}
+		if got != str {
+			t.Errorf("expected %q but got %q from %q", str, got, dat)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package conf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"strings"
+	"text/scanner"
+)
+
+// includeFrame is a file being scanned by an includeScanner.
+type includeFrame struct {
+	scan Scanner
+	path string
+}
+
+type includeScanner struct {
+	fsys  fs.FS
+	open  func(r io.Reader, path string) Scanner
+	stack []includeFrame
+	cur   Token
+	start bool
+	err   error
+}
+
+func (is *includeScanner) Next() bool {
+	if is.err != nil {
+		return false
+	}
+	for {
+		top := &is.stack[len(is.stack)-1]
+		if !top.scan.Next() {
+			if err := top.scan.Err(); err != nil {
+				is.err = err
+				return false
+			}
+			if len(is.stack) == 1 {
+				return false
+			}
+			// the included file has ended, so continue with the file which included it
+			is.stack = is.stack[:len(is.stack)-1]
+			continue
+		}
+		t := currentToken(top.scan)
+		if top.path == "" && len(is.stack) == 1 {
+			top.path = slashPath(t.Pos.Filename)
+		}
+		if !is.start || t.Tok != scanner.RawString || t.Text != "include" {
+			is.emit(t)
+			return true
+		}
+		if err := is.include(top.scan, t.Pos); err != nil {
+			is.err = err
+			return false
+		}
+	}
+}
+
+// emit makes a token the current token.
+func (is *includeScanner) emit(t Token) {
+	is.cur = t
+	switch t.Tok {
+	case ';', '{':
+		is.start = true
+	default:
+		is.start = false
+	}
+}
+
+// include reads the path of an include directive from the current file, and starts scanning the included file.
+func (is *includeScanner) include(scan Scanner, pos scanner.Position) error {
+	if !scan.Next() {
+		if err := scan.Err(); err != nil {
+			return err
+		}
+		return WrapPos(errors.New("missing include path"), pos)
+	}
+	ref, err := ScanString(scan)
+	if err != nil {
+		return err
+	}
+	refPos := scan.Pos()
+	if scan.Next() && scan.Tok() != ';' {
+		return Unexpected(scan)
+	}
+	if err := scan.Err(); err != nil {
+		return err
+	}
+
+	// resolve the path relative to the directory of the including file
+	name := path.Clean(ref)
+	if !path.IsAbs(ref) {
+		name = path.Join(path.Dir(slashPath(pos.Filename)), ref)
+	}
+	name = strings.TrimPrefix(name, "/")
+	if !fs.ValidPath(name) {
+		return WrapPos(fmt.Errorf("invalid include path %q", ref), refPos)
+	}
+	for i, f := range is.stack {
+		if f.path == name {
+			cycle := make([]string, 0, len(is.stack)-i+1)
+			for _, f := range is.stack[i:] {
+				cycle = append(cycle, f.path)
+			}
+			cycle = append(cycle, name)
+			return WrapPos(fmt.Errorf("include cycle: %s", strings.Join(cycle, " -> ")), refPos)
+		}
+	}
+
+	f, err := is.fsys.Open(name)
+	if err != nil {
+		return WrapPos(err, refPos)
+	}
+	dat, err := ioutil.ReadAll(f)
+	f.Close()
+	if err != nil {
+		return WrapPos(err, refPos)
+	}
+	is.stack = append(is.stack, includeFrame{
+		scan: is.open(bytes.NewReader(dat), name),
+		path: name,
+	})
+	return nil
+}
+
+func (is *includeScanner) Tok() rune {
+	return is.cur.Tok
+}
+
+func (is *includeScanner) Text() string {
+	return is.cur.Text
+}
+
+func (is *includeScanner) Pos() scanner.Position {
+	if is.err != nil {
+		if perr, ok := is.err.(PosErr); ok {
+			return perr.Pos
+		}
+	}
+	return is.cur.Pos
+}
+
+func (is *includeScanner) StartPos() scanner.Position {
+	if is.err != nil {
+		if perr, ok := is.err.(PosErr); ok {
+			return perr.Start
+		}
+	}
+	return is.cur.Start
+}
+
+func (is *includeScanner) Err() error {
+	return is.err
+}
+
+func (is *includeScanner) comments() tokenComments {
+	return is.cur.com
+}
+
+func (is *includeScanner) peekRune() rune {
+	return peekRune(is.stack[len(is.stack)-1].scan)
+}
+
+// slashPath converts the filename of a position to a slash-separated path.
+func slashPath(filename string) string {
+	return path.Clean(filepath.ToSlash(filename))
+}
+
+// ScanIncludes returns a Scanner which splices the tokens of included files into the token stream from the parent.
+// An include directive is written as `include "path"` at the start of a directive, and is replaced by the tokens of the file.
+// The path is resolved in fsys relative to the directory of the including file, which is taken from the filenames of the positions of its tokens.
+// Each included file is scanned with the Scanner returned by open, which should be set up like the parent and report positions with the given path as the filename.
+// Errors in included files keep the positions in the included files, and an error is returned if a file includes itself, directly or indirectly.
+func ScanIncludes(parent Scanner, fsys fs.FS, open func(r io.Reader, path string) Scanner) Scanner {
+	return &includeScanner{
+		fsys:  fsys,
+		open:  open,
+		stack: []includeFrame{{scan: parent}},
+		start: true,
+	}
+}
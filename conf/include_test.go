@@ -0,0 +1,158 @@
+package conf
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestScanIncludes(t *testing.T) {
+	t.Parallel()
+
+	open := func(r io.Reader, path string) Scanner {
+		return AutoSemicolon(scanReader(r, path))
+	}
+	parse := func(fsys fs.FS, name string) ([]Directive, error) {
+		f, err := fsys.Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		return ParseDirectives(ScanIncludes(open(f, name), fsys, open))
+	}
+
+	cases := []struct {
+		name  string
+		files fstest.MapFS
+		names string
+		err   string
+	}{
+		{
+			name: "Nested",
+			files: fstest.MapFS{
+				"main.conf":  {Data: []byte("a 1\ninclude \"sub/b.conf\"\nd 4\n")},
+				"sub/b.conf": {Data: []byte("b 2\ninclude \"c.conf\"\n")},
+				"sub/c.conf": {Data: []byte("c 3\n")},
+			},
+			names: "a b c d",
+		},
+		{
+			name: "InBlock",
+			files: fstest.MapFS{
+				"main.conf":   {Data: []byte("server {\n    include \"common.conf\"\n    port 80\n}\n")},
+				"common.conf": {Data: []byte("root x\n")},
+			},
+			names: "server{root port}",
+		},
+		{
+			name: "Absolute",
+			files: fstest.MapFS{
+				"main.conf":  {Data: []byte("include \"sub/b.conf\"\n")},
+				"sub/b.conf": {Data: []byte("include \"/top.conf\"\n")},
+				"top.conf":   {Data: []byte("top 1\n")},
+			},
+			names: "top",
+		},
+		{
+			name: "Repeated",
+			files: fstest.MapFS{
+				"main.conf": {Data: []byte("include \"b.conf\"\ninclude \"b.conf\"\n")},
+				"b.conf":    {Data: []byte("b 1\n")},
+			},
+			names: "b b",
+		},
+		{
+			name: "NotDirective",
+			files: fstest.MapFS{
+				"main.conf": {Data: []byte("name include\n")},
+			},
+			names: "name",
+		},
+		{
+			name: "Self",
+			files: fstest.MapFS{
+				"main.conf": {Data: []byte("include \"main.conf\"\n")},
+			},
+			err: "include cycle: main.conf -> main.conf",
+		},
+		{
+			name: "Cycle",
+			files: fstest.MapFS{
+				"main.conf":  {Data: []byte("include \"sub/a.conf\"\n")},
+				"sub/a.conf": {Data: []byte("a 1\ninclude \"b.conf\"\n")},
+				"sub/b.conf": {Data: []byte("include \"a.conf\"\n")},
+			},
+			err: "include cycle: sub/a.conf -> sub/b.conf -> sub/a.conf (sub/b.conf:1:17)",
+		},
+		{
+			name: "Missing",
+			files: fstest.MapFS{
+				"main.conf":  {Data: []byte("include \"sub/a.conf\"\n")},
+				"sub/a.conf": {Data: []byte("a 1\ninclude \"missing.conf\"\n")},
+			},
+			err: "open sub/missing.conf: file does not exist (sub/a.conf:2:23)",
+		},
+		{
+			name: "Escape",
+			files: fstest.MapFS{
+				"main.conf": {Data: []byte("include \"../secret.conf\"\n")},
+			},
+			err: "invalid include path \"../secret.conf\"",
+		},
+		{
+			name: "MissingPath",
+			files: fstest.MapFS{
+				"main.conf": {Data: []byte("include\n")},
+			},
+			err: `unexpected token ";"`,
+		},
+		{
+			name: "ExtraArgs",
+			files: fstest.MapFS{
+				"main.conf": {Data: []byte("include \"b.conf\" x\n")},
+				"b.conf":    {Data: []byte("b 1\n")},
+			},
+			err: "unexpected",
+		},
+		{
+			name: "ErrorInIncluded",
+			files: fstest.MapFS{
+				"main.conf": {Data: []byte("include \"b.conf\"\n")},
+				"b.conf":    {Data: []byte("b 1\nc }\n")},
+			},
+			err: "(b.conf:2:",
+		},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			dirs, err := parse(c.files, "main.conf")
+			switch {
+			case c.err == "" && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case c.err == "":
+				if got := names(dirs); got != c.names {
+					t.Errorf("expected directives %q but got %q", c.names, got)
+				}
+			case err == nil:
+				t.Errorf("expected an error containing %q", c.err)
+			case !strings.Contains(err.Error(), c.err):
+				t.Errorf("expected an error containing %q but got %q", c.err, err)
+			}
+		})
+	}
+
+	t.Run("MissingIsNotExist", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := parse(fstest.MapFS{"main.conf": {Data: []byte("include \"missing.conf\"\n")}}, "main.conf")
+		if !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("expected a not-exist error but got %v", err)
+		}
+	})
+}
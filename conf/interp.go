@@ -0,0 +1,85 @@
+package conf
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/scanner"
+)
+
+// Expand replaces references to variables in a string with their values.
+// A reference is written as ${NAME}, and "$$" is replaced by a single "$".
+// Any other use of "$" is left as is.
+// Values are retrieved with the lookup function, which returns false if the variable is not defined.
+// If a referenced variable is not defined or a reference is not terminated, it will return an error.
+func Expand(s string, lookup func(name string) (string, bool)) (string, error) {
+	if !strings.Contains(s, "$") {
+		return s, nil
+	}
+	var b strings.Builder
+	for {
+		i := strings.IndexByte(s, '$')
+		if i == -1 || i == len(s)-1 {
+			b.WriteString(s)
+			return b.String(), nil
+		}
+		b.WriteString(s[:i])
+		s = s[i:]
+		switch s[1] {
+		case '$':
+			// escaped
+			b.WriteByte('$')
+			s = s[2:]
+		case '{':
+			end := strings.IndexByte(s, '}')
+			if end == -1 {
+				return "", fmt.Errorf("unterminated variable reference %q", s)
+			}
+			name := s[2:end]
+			if name == "" {
+				return "", fmt.Errorf("empty variable reference %q", s[:end+1])
+			}
+			v, ok := lookup(name)
+			if !ok {
+				return "", fmt.Errorf("variable %q is not defined", name)
+			}
+			b.WriteString(v)
+			s = s[end+1:]
+		default:
+			b.WriteByte('$')
+			s = s[1:]
+		}
+	}
+}
+
+// InterpolateFilter creates a TokenFilter which expands references to variables in quoted strings, as described in Interpolate.
+func InterpolateFilter(lookup func(name string) (string, bool)) TokenFilter {
+	if lookup == nil {
+		lookup = os.LookupEnv
+	}
+	return MapTokens(func(t Token) (Token, error) {
+		if t.Tok != scanner.String || !strings.Contains(t.Text, "$") {
+			return t, nil
+		}
+		str, err := strconv.Unquote(t.Text)
+		if err != nil {
+			return Token{}, err
+		}
+		str, err = Expand(str, lookup)
+		if err != nil {
+			return Token{}, err
+		}
+		t.Text = strconv.Quote(str)
+		return t, nil
+	})
+}
+
+// Interpolate returns a Scanner which expands references to variables in the quoted strings from the parent.
+// References are expanded as in Expand, with values from the lookup function.
+// If lookup is nil, the values are taken from the environment variables of the process.
+// Only double-quoted strings are expanded, so raw strings and bare words may be used for text containing a literal "${".
+// The expanded strings are re-quoted, so they may be read with ScanString as usual.
+func Interpolate(parent Scanner, lookup func(name string) (string, bool)) Scanner {
+	return Filter(parent, InterpolateFilter(lookup))
+}
@@ -0,0 +1,83 @@
+package conf
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestExpand(t *testing.T) {
+	t.Parallel()
+
+	vars := map[string]string{"HOME": "/home/user", "EMPTY": "", "NESTED": "${HOME}"}
+	lookup := func(name string) (string, bool) {
+		v, ok := vars[name]
+		return v, ok
+	}
+	cases := []struct {
+		in, out string
+		err     string
+	}{
+		{in: "plain", out: "plain"},
+		{in: "${HOME}/.config", out: "/home/user/.config"},
+		{in: "${HOME}${HOME}", out: "/home/user/home/user"},
+		{in: "[${EMPTY}]", out: "[]"},
+		{in: "${NESTED}", out: "${HOME}"},
+		{in: "cost $$5", out: "cost $5"},
+		{in: "$${HOME}", out: "${HOME}"},
+		{in: "a $b", out: "a $b"},
+		{in: "trailing $", out: "trailing $"},
+		{in: "${UNDEFINED}", err: `variable "UNDEFINED" is not defined`},
+		{in: "x ${HOME", err: `unterminated variable reference "${HOME"`},
+		{in: "${}", err: `empty variable reference "${}"`},
+	}
+	for _, c := range cases {
+		out, err := Expand(c.in, lookup)
+		switch {
+		case c.err != "" && (err == nil || err.Error() != c.err):
+			t.Errorf("expected error %q from %q but got %q, %v", c.err, c.in, out, err)
+		case c.err == "" && err != nil:
+			t.Errorf("unexpected error from %q: %v", c.in, err)
+		case out != c.out:
+			t.Errorf("expected %q from %q but got %q", c.out, c.in, out)
+		}
+	}
+}
+
+func TestInterpolate(t *testing.T) {
+	t.Parallel()
+
+	lookup := func(name string) (string, bool) {
+		if name == "DIR" {
+			return "/srv/\"data\"", true
+		}
+		return "", false
+	}
+	parse := func(src string) ([]Directive, error) {
+		return ParseDirectives(Interpolate(scanString(src, "test.conf"), lookup))
+	}
+
+	dirs, err := parse("root \"${DIR}/www\" `${DIR}`\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dat, err := Marshal(dirs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Only double-quoted strings are expanded, and the result is quoted again.
+	if expect := "root \"/srv/\\\"data\\\"/www\" `${DIR}`\n"; string(dat) != expect {
+		t.Errorf("expected %q but got %q", expect, dat)
+	}
+
+	_, err = parse("a 1\nb \"${MISSING}\"\n")
+	var perr PosErr
+	switch {
+	case !errors.As(err, &perr):
+		t.Errorf("expected a positioned error but got %v", err)
+	case perr.Pos.Line != 2:
+		t.Errorf("expected the error on line 2 but got %v", err)
+	case !strings.Contains(err.Error(), `variable "MISSING" is not defined`):
+		t.Errorf("unexpected error %v", err)
+	}
+}
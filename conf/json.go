@@ -0,0 +1,183 @@
+package conf
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/scanner"
+)
+
+// jsonDirective is the JSON form of a Directive.
+type jsonDirective struct {
+	Name        string   `json:"name"`
+	Args        []Arg    `json:"args,omitempty"`
+	Comments    []string `json:"comments,omitempty"`
+	LineComment string   `json:"lineComment,omitempty"`
+}
+
+// MarshalJSON encodes the directive as a JSON object with the name, arguments, and any comments of the directive.
+// Positions are not included.
+// For example, the directive `listen localhost 8080 { tls on }` is encoded as:
+//
+//	{"name":"listen","args":["localhost",8080,{"block":[{"name":"tls","args":["on"]}]}]}
+//
+// See Arg.MarshalJSON for the encoding of the arguments.
+func (d Directive) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonDirective{
+		Name:        d.Name,
+		Args:        d.Args,
+		Comments:    d.Comments,
+		LineComment: d.LineComment,
+	})
+}
+
+// UnmarshalJSON decodes a directive encoded by MarshalJSON.
+func (d *Directive) UnmarshalJSON(data []byte) error {
+	var jd jsonDirective
+	if err := json.Unmarshal(data, &jd); err != nil {
+		return err
+	}
+	if jd.Name == "" {
+		return errors.New("directive missing name")
+	}
+	if jd.Args == nil {
+		jd.Args = []Arg{}
+	}
+	*d = Directive{
+		Name:        jd.Name,
+		Args:        jd.Args,
+		Comments:    jd.Comments,
+		LineComment: jd.LineComment,
+	}
+	return nil
+}
+
+// jsonBlock is the JSON form of a block argument.
+type jsonBlock struct {
+	Block []Directive `json:"block"`
+}
+
+// jsonToken is the JSON form of an argument which is not a value, such as a bracket.
+type jsonToken struct {
+	Token string `json:"token"`
+}
+
+// MarshalJSON encodes the argument as a JSON value.
+// Numbers are encoded as JSON numbers, and strings, bare words, durations, and byte sizes are encoded as JSON strings.
+// Blocks are encoded as an object with a "block" field containing the directives, and other tokens (such as brackets) are encoded as an object with a "token" field containing the text of the token.
+func (a Arg) MarshalJSON() ([]byte, error) {
+	switch a.Tok {
+	case '{':
+		block := a.Block
+		if block == nil {
+			block = []Directive{}
+		}
+		return json.Marshal(jsonBlock{block})
+	case scanner.Int:
+		if v, err := strconv.ParseInt(a.Text, 0, 64); err == nil {
+			return []byte(strconv.FormatInt(v, 10)), nil
+		}
+		if v, err := strconv.ParseUint(a.Text, 0, 64); err == nil {
+			return []byte(strconv.FormatUint(v, 10)), nil
+		}
+		if !json.Valid([]byte(a.Text)) {
+			return nil, WrapPos(fmt.Errorf("cannot encode integer %s as JSON", a.Text), a.Pos)
+		}
+		return []byte(a.Text), nil
+	case scanner.Float:
+		if json.Valid([]byte(a.Text)) {
+			return []byte(a.Text), nil
+		}
+		v, err := strconv.ParseFloat(a.Text, 64)
+		if err != nil {
+			return nil, WrapPos(numError(err), a.Pos)
+		}
+		txt := strconv.FormatFloat(v, 'g', -1, 64)
+		if !strings.ContainsAny(txt, ".e") {
+			// keep the number a float when decoded
+			txt += ".0"
+		}
+		return []byte(txt), nil
+	case Duration, ByteSize:
+		return json.Marshal(a.Text)
+	case scanner.String, scanner.RawString:
+		str := a.Text
+		if strings.HasPrefix(str, "\"") || strings.HasPrefix(str, "`") {
+			var err error
+			str, err = strconv.Unquote(str)
+			if err != nil {
+				return nil, WrapPos(err, a.Pos)
+			}
+		}
+		return json.Marshal(str)
+	default:
+		return json.Marshal(jsonToken{a.Text})
+	}
+}
+
+// UnmarshalJSON decodes an argument encoded by MarshalJSON.
+// JSON booleans are also accepted, and are decoded as the bare words true and false.
+func (a *Arg) UnmarshalJSON(data []byte) error {
+	var v interface{}
+	dec := json.NewDecoder(strings.NewReader(string(data)))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		return err
+	}
+	switch v := v.(type) {
+	case string:
+		*a = StringArg(v)
+	case bool:
+		*a = Arg{Tok: scanner.RawString, Text: strconv.FormatBool(v)}
+	case json.Number:
+		var tok rune = scanner.Int
+		if strings.ContainsAny(v.String(), ".eE") {
+			tok = scanner.Float
+		}
+		*a = Arg{Tok: tok, Text: v.String()}
+	case map[string]interface{}:
+		if _, ok := v["block"]; ok {
+			var b jsonBlock
+			if err := json.Unmarshal(data, &b); err != nil {
+				return err
+			}
+			*a = BlockArg(b.Block...)
+			return nil
+		}
+		var t jsonToken
+		if err := json.Unmarshal(data, &t); err != nil {
+			return err
+		}
+		tok, err := tokenOf(t.Token)
+		if err != nil {
+			return err
+		}
+		*a = Arg{Tok: tok, Text: t.Token}
+	default:
+		return fmt.Errorf("cannot decode %s into an argument", data)
+	}
+	return nil
+}
+
+// tokenOf finds the token character of the text of a single token.
+func tokenOf(txt string) (rune, error) {
+	var s scanner.Scanner
+	s.Init(strings.NewReader(txt))
+	var serr error
+	s.Error = func(_ *scanner.Scanner, msg string) {
+		serr = errors.New(msg)
+	}
+	tok := s.Scan()
+	if tok == scanner.Ident {
+		tok = scanner.RawString
+	}
+	switch {
+	case serr != nil:
+		return 0, fmt.Errorf("invalid token %q: %w", txt, serr)
+	case tok == scanner.EOF || s.TokenText() != txt:
+		return 0, fmt.Errorf("invalid token %q", txt)
+	}
+	return tok, nil
+}
@@ -0,0 +1,111 @@
+package conf
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestJSON(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name string
+
+		// src is the text to parse.
+		src string
+
+		// json is the encoding of the directives.
+		json string
+
+		// canonical is the text written by Marshal after decoding, if it is not the same as src.
+		canonical string
+	}{
+		{
+			name:      "Values",
+			src:       "listen localhost 8080 -1 2.5 \"hello world\" `raw`\n",
+			json:      `[{"name":"listen","args":["localhost",8080,-1,2.5,"hello world","raw"]}]`,
+			canonical: "listen localhost 8080 -1 2.5 \"hello world\" raw\n",
+		},
+		{
+			name:      "Numbers",
+			src:       "n 0x10 1e3 1_000.5\n",
+			json:      `[{"name":"n","args":[16,1e3,1000.5]}]`,
+			canonical: "n 16 1e3 1000.5\n",
+		},
+		{
+			name: "Block",
+			src:  "server {\n    tls on\n}\n",
+			json: `[{"name":"server","args":[{"block":[{"name":"tls","args":["on"]}]}]}]`,
+		},
+		{
+			name: "Tokens",
+			src:  "type []string\n",
+			json: `[{"name":"type","args":[{"token":"["},{"token":"]"},"string"]}]`,
+		},
+		{
+			name: "Comments",
+			src:  "// doc\nport 80 // line\n",
+			json: `[{"name":"port","args":[80],"comments":["// doc"],"lineComment":"// line"}]`,
+		},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			dirs := parseString(t, c.src)
+			dat, err := json.Marshal(dirs)
+			if err != nil {
+				t.Fatalf("failed to encode: %v", err)
+			}
+			if string(dat) != c.json {
+				t.Errorf("expected %s but got %s", c.json, dat)
+			}
+
+			var decoded []Directive
+			if err := json.Unmarshal(dat, &decoded); err != nil {
+				t.Fatalf("failed to decode %s: %v", dat, err)
+			}
+			canonical := c.canonical
+			if canonical == "" {
+				canonical = c.src
+			}
+			got, err := Marshal(decoded)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != canonical {
+				t.Errorf("expected %q but got %q", canonical, got)
+			}
+		})
+	}
+
+	t.Run("Bool", func(t *testing.T) {
+		t.Parallel()
+
+		var d Directive
+		if err := json.Unmarshal([]byte(`{"name":"tls","args":[true]}`), &d); err != nil {
+			t.Fatal(err)
+		}
+		if s := d.String(); s != "tls true" {
+			t.Errorf("expected \"tls true\" but got %q", s)
+		}
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		t.Parallel()
+
+		for _, src := range []string{
+			`{"args":[1]}`,
+			`{"name":"a","args":[null]}`,
+			`{"name":"a","args":[[1]]}`,
+			`{"name":"a","args":[{"token":"a b"}]}`,
+			`{"name":"a","args":[{"token":"\"x"}]}`,
+		} {
+			var d Directive
+			if err := json.Unmarshal([]byte(src), &d); err == nil {
+				t.Errorf("expected an error from %s but got %v", src, d)
+			}
+		}
+	})
+}
@@ -0,0 +1,83 @@
+package conf
+
+import "fmt"
+
+// Limits are limits on the size of the input read through a Scanner, used with Limit.
+// A zero value for any limit means that it is not enforced.
+type Limits struct {
+	// MaxDepth is the maximum nesting depth of brackets, counting all of (), [], and {}.
+	MaxDepth int
+
+	// MaxTokens is the maximum total number of tokens.
+	MaxTokens int
+}
+
+// ErrLimitExceeded is an error which occurs when the input exceeds a limit set with Limit.
+type ErrLimitExceeded struct {
+	// Limit is the name of the limit, such as "nesting depth".
+	Limit string
+
+	// Max is the configured maximum.
+	Max int
+}
+
+func (err ErrLimitExceeded) Error() string {
+	return fmt.Sprintf("%s exceeds limit of %d", err.Limit, err.Max)
+}
+
+type limitScanner struct {
+	Scanner
+	limits Limits
+	depth  int
+	count  int
+	err    error
+}
+
+func (ls *limitScanner) Next() bool {
+	if ls.err != nil || !ls.Scanner.Next() {
+		return false
+	}
+	ls.count++
+	if ls.limits.MaxTokens > 0 && ls.count > ls.limits.MaxTokens {
+		ls.err = wrapToken(ErrLimitExceeded{"token count", ls.limits.MaxTokens}, ls.Scanner)
+		return false
+	}
+	switch ls.Tok() {
+	case '(', '[', '{':
+		ls.depth++
+		if ls.limits.MaxDepth > 0 && ls.depth > ls.limits.MaxDepth {
+			ls.err = wrapToken(ErrLimitExceeded{"nesting depth", ls.limits.MaxDepth}, ls.Scanner)
+			return false
+		}
+	case ')', ']', '}':
+		if ls.depth > 0 {
+			ls.depth--
+		}
+	}
+	return true
+}
+
+func (ls *limitScanner) Err() error {
+	if ls.err != nil {
+		return ls.err
+	}
+	return ls.Scanner.Err()
+}
+
+func (ls *limitScanner) comments() tokenComments {
+	return commentsOf(ls.Scanner)
+}
+
+func (ls *limitScanner) peekRune() rune {
+	return peekRune(ls.Scanner)
+}
+
+// Limit returns a Scanner which stops with an ErrLimitExceeded once the tokens from the parent exceed the limits.
+// This should be applied directly to the result of Scan when reading untrusted input, so that the scanners and parsers built on top of it (such as ScanBracket and ParseDirectives) cannot be made to recurse or allocate without bound.
+// Brackets are counted regardless of whether they are balanced.
+func Limit(parent Scanner, limits Limits) Scanner {
+	return &limitScanner{
+		Scanner: parent,
+		limits:  limits,
+	}
+}
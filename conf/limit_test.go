@@ -0,0 +1,84 @@
+package conf
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestLimit(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name   string
+		src    string
+		limits Limits
+		err    string
+	}{
+		{
+			name: "Unlimited",
+			src:  "a {{{{ b }}}} c d e",
+		},
+		{
+			name:   "Depth",
+			src:    "a { b { c } }\nd [(x)]",
+			limits: Limits{MaxDepth: 2},
+		},
+		{
+			name:   "TooDeep",
+			src:    "a { b [ c ( d ) ] }",
+			limits: Limits{MaxDepth: 2},
+			err:    "nesting depth exceeds limit of 2 (test.conf:1:12)",
+		},
+		{
+			name:   "Unbalanced",
+			src:    "} } { {",
+			limits: Limits{MaxDepth: 2},
+		},
+		{
+			name:   "Tokens",
+			src:    "a b c",
+			limits: Limits{MaxTokens: 3},
+		},
+		{
+			name:   "TooManyTokens",
+			src:    "a b c d",
+			limits: Limits{MaxTokens: 3},
+			err:    "token count exceeds limit of 3 (test.conf:1:8)",
+		},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			scan := Limit(scanReader(strings.NewReader(c.src), "test.conf"), c.limits)
+			for scan.Next() {
+			}
+			err := scan.Err()
+			switch {
+			case c.err == "" && err != nil:
+				t.Errorf("unexpected error: %v", err)
+			case c.err == "":
+			case err == nil || err.Error() != c.err:
+				t.Errorf("expected error %q but got %v", c.err, err)
+			default:
+				var lerr ErrLimitExceeded
+				if !errors.As(err, &lerr) {
+					t.Errorf("expected an ErrLimitExceeded but got %#v", err)
+				}
+			}
+		})
+	}
+
+	t.Run("Parse", func(t *testing.T) {
+		t.Parallel()
+
+		// The parser stops at the limit instead of recursing into the brackets.
+		src := strings.Repeat("a {", 1000)
+		_, err := ParseDirectives(AutoSemicolon(Limit(scanReader(strings.NewReader(src), "test.conf"), Limits{MaxDepth: 10})))
+		if err == nil || !strings.Contains(err.Error(), "nesting depth exceeds limit of 10") {
+			t.Errorf("expected a nesting depth error but got %v", err)
+		}
+	})
+}
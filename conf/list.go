@@ -0,0 +1,128 @@
+package conf
+
+import (
+	"errors"
+	"io"
+	"text/scanner"
+	"unicode/utf8"
+)
+
+// listScanner replays the buffered tokens of a list value.
+type listScanner struct {
+	toks []Token
+	i    int
+}
+
+func (ls *listScanner) Next() bool {
+	if ls.i < len(ls.toks) {
+		ls.i++
+	}
+	return ls.i < len(ls.toks)
+}
+
+func (ls *listScanner) Tok() rune {
+	if ls.i >= len(ls.toks) {
+		return scanner.EOF
+	}
+	return ls.toks[ls.i].Tok
+}
+
+func (ls *listScanner) Text() string {
+	if ls.i >= len(ls.toks) {
+		return ""
+	}
+	return ls.toks[ls.i].Text
+}
+
+func (ls *listScanner) Pos() scanner.Position {
+	if ls.i >= len(ls.toks) {
+		return ls.toks[len(ls.toks)-1].Pos
+	}
+	return ls.toks[ls.i].Pos
+}
+
+func (ls *listScanner) StartPos() scanner.Position {
+	if ls.i >= len(ls.toks) {
+		return ls.toks[len(ls.toks)-1].Pos
+	}
+	return ls.toks[ls.i].Start
+}
+
+func (ls *listScanner) Err() error {
+	return nil
+}
+
+// ScanList scans a list of values, up to a semicolon or the end of the Scanner, and calls fn with each value in turn.
+// Values are separated by commas or whitespace, such as in "errors A, B, C" or "errors A B C".
+// A value may span multiple tokens if they are written without whitespace between them, or are enclosed in brackets, so values like "[]string" or "f(a, b)" are kept together.
+// The Scanner passed to fn is positioned on the first token of the value, so single-token values can be read directly with helpers like ScanString.
+// If fn does not read all of the tokens of the value, an error is returned for the first unread token.
+// Empty values, such as a trailing comma, are not allowed.
+func ScanList(scan Scanner, fn func(value Scanner) error) error {
+	var val []Token
+	flush := func() error {
+		ls := &listScanner{toks: val}
+		val = nil
+		if err := fn(ls); err != nil {
+			return err
+		}
+		if ls.Next() {
+			return Unexpected(ls)
+		}
+		return nil
+	}
+	level := 0
+	comma := false
+	for scan.Next() {
+		t := currentToken(scan)
+		if level == 0 {
+			switch {
+			case t.Tok == ';':
+				if comma {
+					return WrapPos(errors.New("missing value after comma"), t.Pos)
+				}
+				if len(val) == 0 {
+					return nil
+				}
+				return flush()
+			case t.Tok == ',':
+				if len(val) == 0 {
+					return WrapPos(errors.New("missing value before comma"), t.Pos)
+				}
+				if err := flush(); err != nil {
+					return err
+				}
+				comma = true
+				continue
+			case len(val) != 0 && !adjacent(val[len(val)-1].Pos, t.Pos, utf8.RuneCountInString(t.Text)):
+				// separated by whitespace
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+		}
+		switch t.Tok {
+		case '(', '[', '{':
+			level++
+		case ')', ']', '}':
+			if level == 0 {
+				return Unexpected(scan)
+			}
+			level--
+		}
+		val = append(val, t)
+		comma = false
+	}
+	switch {
+	case scan.Err() != nil:
+		return scan.Err()
+	case level != 0:
+		return WrapPos(io.ErrUnexpectedEOF, scan.Pos())
+	case comma:
+		return WrapPos(errors.New("missing value after comma"), scan.Pos())
+	case len(val) != 0:
+		return flush()
+	default:
+		return nil
+	}
+}
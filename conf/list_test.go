@@ -0,0 +1,124 @@
+package conf
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestScanList(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name string
+		src  string
+
+		// words reads each value with ScanString instead of joining all of its tokens.
+		words bool
+
+		values string
+		err    string
+	}{
+		{
+			name:   "Commas",
+			src:    "A, B, C",
+			values: "A|B|C",
+		},
+		{
+			name:   "Spaces",
+			src:    "A B\tC",
+			values: "A|B|C",
+		},
+		{
+			name:   "Mixed",
+			src:    "A,B C",
+			values: "A|B|C",
+		},
+		{
+			name:   "Tokens",
+			src:    "[]string, map[string]int f(a, b)",
+			values: "[]string|map[string]int|f(a,b)",
+		},
+		{
+			name:   "Semicolon",
+			src:    "A B; C",
+			values: "A|B",
+		},
+		{
+			name: "Empty",
+			src:  "",
+		},
+		{
+			name: "EmptyBeforeSemicolon",
+			src:  "; A",
+		},
+		{
+			name: "TrailingComma",
+			src:  "A, B,",
+			err:  "missing value after comma",
+		},
+		{
+			name: "CommaBeforeSemicolon",
+			src:  "A, ;",
+			err:  "missing value after comma",
+		},
+		{
+			name: "LeadingComma",
+			src:  ", A",
+			err:  "missing value before comma",
+		},
+		{
+			name: "DoubleComma",
+			src:  "A,, B",
+			err:  "missing value before comma",
+		},
+		{
+			name: "Unclosed",
+			src:  "f(a, b",
+			err:  "unexpected EOF",
+		},
+		{
+			name: "StrayClose",
+			src:  "A )",
+			err:  "unexpected token",
+		},
+		{
+			name:  "Unread",
+			src:   "A B-C",
+			words: true,
+			err:   "unexpected token \"-\"",
+		},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			var values []string
+			err := ScanList(scanReader(strings.NewReader(c.src), "test.conf"), func(value Scanner) error {
+				if c.words {
+					str, err := ScanString(value)
+					values = append(values, str)
+					return err
+				}
+				txt := value.Text()
+				for value.Next() {
+					txt += value.Text()
+				}
+				values = append(values, txt)
+				return nil
+			})
+			switch {
+			case c.err == "" && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case c.err == "":
+				if got := strings.Join(values, "|"); got != c.values {
+					t.Errorf("expected values %q but got %q", c.values, got)
+				}
+			case err == nil:
+				t.Errorf("expected an error containing %q but got values %q", c.err, values)
+			case !strings.Contains(err.Error(), c.err):
+				t.Errorf("expected an error containing %q but got %q", c.err, err)
+			}
+		})
+	}
+}
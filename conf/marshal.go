@@ -0,0 +1,376 @@
+package conf
+
+import (
+	"bytes"
+	"encoding"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"text/scanner"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Marshal renders a tree of directives in canonical syntax.
+// The value may be a Directive, a []Directive, or a struct (or pointer to a struct) with "conf" field tags.
+//
+// Each directive is written on its own line, and terminated by the line break.
+// Blocks are indented by four spaces per level.
+// Strings are written as bare words if they are identifiers, and are otherwise quoted.
+// Multi-line strings at the end of a directive are written as heredocs.
+// The comments of directives are written before them, and line comments after them, except after heredocs.
+//
+// Each exported field of a struct is rendered as a directive, named by the "conf" tag of the field or by the lowercased field name.
+// The tag may include the "omitempty" option, which omits the directive if the field has a zero value, and a tag of "-" skips the field.
+// Strings, booleans, numbers, durations, and encoding.TextMarshaler values are rendered as a single argument.
+// Slices of these are rendered as a directive with an argument per element, and are omitted if empty.
+// Structs are rendered as a directive with a block, slices of structs are rendered as a directive per element, and nil pointers are omitted.
+// The fields of embedded structs are rendered as if they were fields of the outer struct.
+func Marshal(v interface{}) ([]byte, error) {
+	var dirs []Directive
+	switch v := v.(type) {
+	case Directive:
+		dirs = []Directive{v}
+	case []Directive:
+		dirs = v
+	default:
+		rv := reflect.ValueOf(v)
+		for rv.Kind() == reflect.Ptr && !rv.IsNil() {
+			rv = rv.Elem()
+		}
+		if rv.Kind() != reflect.Struct {
+			return nil, fmt.Errorf("cannot marshal %T into directives", v)
+		}
+		var err error
+		dirs, err = structDirectives(rv)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := writeDirectives(&buf, dirs, 0); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// String renders the directive in canonical syntax, without a trailing line break.
+// Invalid directives are rendered as an error message in brackets.
+func (d Directive) String() string {
+	dat, err := Marshal(d)
+	if err != nil {
+		return "<" + err.Error() + ">"
+	}
+	return strings.TrimSuffix(string(dat), "\n")
+}
+
+// StringArg creates an argument with the canonical token for a string.
+// The string is a bare word if it is an identifier, and is quoted otherwise.
+func StringArg(s string) Arg {
+	if isIdent(s) {
+		return Arg{Tok: scanner.RawString, Text: s}
+	}
+	return Arg{Tok: scanner.String, Text: strconv.Quote(s)}
+}
+
+// BlockArg creates a block argument containing the given directives.
+func BlockArg(dirs ...Directive) Arg {
+	if dirs == nil {
+		dirs = []Directive{}
+	}
+	return Arg{Tok: '{', Block: dirs}
+}
+
+// isIdent checks whether a string is scanned as a single bare word.
+func isIdent(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, c := range s {
+		if !(c == '_' || unicode.IsLetter(c) || (i > 0 && unicode.IsDigit(c))) {
+			return false
+		}
+	}
+	return true
+}
+
+// writeDirectives writes directives at an indentation level.
+func writeDirectives(buf *bytes.Buffer, dirs []Directive, depth int) error {
+	indent := strings.Repeat("    ", depth)
+	for _, d := range dirs {
+		if d.Name == "" {
+			return errors.New("directive missing name")
+		}
+		for _, c := range d.Comments {
+			buf.WriteString(indent)
+			buf.WriteString(c)
+			buf.WriteByte('\n')
+		}
+		buf.WriteString(indent)
+		if isIdent(d.Name) {
+			buf.WriteString(d.Name)
+		} else {
+			buf.WriteString(strconv.Quote(d.Name))
+		}
+		prev := rune(0)
+		heredoc := false
+		for i, a := range d.Args {
+			if spaced(prev, a.Tok) {
+				buf.WriteByte(' ')
+			}
+			switch a.Tok {
+			case '{':
+				if len(a.Block) == 0 {
+					buf.WriteString("{}")
+					break
+				}
+				buf.WriteString("{\n")
+				if err := writeDirectives(buf, a.Block, depth+1); err != nil {
+					return WrapPos(err, a.Pos)
+				}
+				buf.WriteString(indent)
+				buf.WriteByte('}')
+				a.Tok = '}'
+			case scanner.String:
+				// quoted strings are normalized to double quotes
+				str, err := strconv.Unquote(a.Text)
+				if err != nil {
+					return WrapPos(err, a.Pos)
+				}
+				if i == len(d.Args)-1 && writeHeredoc(buf, str, indent+"    ") {
+					heredoc = true
+					break
+				}
+				buf.WriteString(strconv.Quote(str))
+			case ';', '}':
+				return WrapPos(fmt.Errorf("invalid argument token %q in directive %q", a.Tok, d.Name), a.Pos)
+			default:
+				if a.Text == "" {
+					return WrapPos(fmt.Errorf("empty argument token in directive %q", d.Name), a.Pos)
+				}
+				buf.WriteString(a.Text)
+			}
+			prev = a.Tok
+		}
+		if d.LineComment != "" && !heredoc {
+			// a heredoc must end its line, so the comment is dropped
+			buf.WriteByte(' ')
+			buf.WriteString(d.LineComment)
+		}
+		buf.WriteByte('\n')
+	}
+	return nil
+}
+
+// heredocDelim is the delimiter of heredocs written by Marshal.
+const heredocDelim = "EOF"
+
+// writeHeredoc writes a multi-line string as a heredoc, with the lines at the given indentation.
+// Strings which cannot be written as a heredoc are not written, and false is returned.
+func writeHeredoc(buf *bytes.Buffer, str string, indent string) bool {
+	if !strings.Contains(str, "\n") || strings.ContainsRune(str, '\r') || !utf8.ValidString(str) {
+		return false
+	}
+	lines := strings.Split(str, "\n")
+	for _, l := range lines {
+		if strings.TrimSpace(l) == heredocDelim {
+			return false
+		}
+	}
+	buf.WriteString("<<" + heredocDelim + "\n")
+	for _, l := range lines {
+		if l != "" {
+			buf.WriteString(indent)
+			buf.WriteString(l)
+		}
+		buf.WriteByte('\n')
+	}
+	buf.WriteString(indent + heredocDelim)
+	return true
+}
+
+// spaced checks whether a space is written between two argument tokens.
+// Brackets are written tightly, so that type expressions such as "[]string" keep their usual form.
+func spaced(prev, next rune) bool {
+	switch {
+	case prev == '[' || prev == '(' || prev == ']':
+		return false
+	case next == ']' || next == ')':
+		return false
+	default:
+		return true
+	}
+}
+
+// textMarshalerType is the reflection type of encoding.TextMarshaler.
+var textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+
+// durationType is the reflection type of time.Duration.
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// structDirectives creates a directive for each field of a struct.
+func structDirectives(v reflect.Value) ([]Directive, error) {
+	dirs := []Directive{}
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("conf")
+		if tag == "-" {
+			continue
+		}
+		fv := v.Field(i)
+		if f.Anonymous && tag == "" {
+			for fv.Kind() == reflect.Ptr {
+				if fv.IsNil() {
+					break
+				}
+				fv = fv.Elem()
+			}
+			if fv.Kind() == reflect.Struct {
+				embedded, err := structDirectives(fv)
+				if err != nil {
+					return nil, err
+				}
+				dirs = append(dirs, embedded...)
+				continue
+			}
+		}
+		if f.PkgPath != "" {
+			// unexported
+			continue
+		}
+
+		name, opts := tag, ""
+		if i := strings.IndexByte(tag, ','); i != -1 {
+			name, opts = tag[:i], tag[i+1:]
+		}
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+		omitEmpty := false
+		for _, opt := range strings.Split(opts, ",") {
+			switch opt {
+			case "":
+			case "omitempty":
+				omitEmpty = true
+			default:
+				return nil, fmt.Errorf("unknown option %q in conf tag of field %s", opt, f.Name)
+			}
+		}
+		if omitEmpty && fv.IsZero() {
+			continue
+		}
+
+		fdirs, err := fieldDirectives(name, fv)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", f.Name, err)
+		}
+		dirs = append(dirs, fdirs...)
+	}
+	return dirs, nil
+}
+
+// fieldDirectives creates the directives for the value of a struct field.
+func fieldDirectives(name string, v reflect.Value) ([]Directive, error) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil, nil
+		}
+		if v.Type().Implements(textMarshalerType) {
+			break
+		}
+		v = v.Elem()
+	}
+	if a, ok, err := scalarArg(v); ok || err != nil {
+		if err != nil {
+			return nil, err
+		}
+		return []Directive{{Name: name, Args: []Arg{a}}}, nil
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		block, err := structDirectives(v)
+		if err != nil {
+			return nil, err
+		}
+		return []Directive{{Name: name, Args: []Arg{BlockArg(block...)}}}, nil
+	case reflect.Slice, reflect.Array:
+		if v.Len() == 0 {
+			return nil, nil
+		}
+		var dirs []Directive
+		args := []Arg{}
+		for i := 0; i < v.Len(); i++ {
+			ev := v.Index(i)
+			if a, ok, err := scalarArg(ev); ok || err != nil {
+				if err != nil {
+					return nil, fmt.Errorf("element %d: %w", i, err)
+				}
+				args = append(args, a)
+				continue
+			}
+			edirs, err := fieldDirectives(name, ev)
+			if err != nil {
+				return nil, fmt.Errorf("element %d: %w", i, err)
+			}
+			dirs = append(dirs, edirs...)
+		}
+		switch {
+		case len(args) == 0:
+			return dirs, nil
+		case len(dirs) == 0:
+			return []Directive{{Name: name, Args: args}}, nil
+		default:
+			return nil, errors.New("cannot mix values and blocks in a slice")
+		}
+	default:
+		return nil, fmt.Errorf("cannot marshal %s into a directive", v.Type())
+	}
+}
+
+// scalarArg creates the argument for a value which is rendered as a single token.
+// If the value is not rendered as a single token, the second return is false.
+func scalarArg(v reflect.Value) (Arg, bool, error) {
+	if v.Type().Implements(textMarshalerType) {
+		if v.Kind() == reflect.Ptr && v.IsNil() {
+			return Arg{}, false, nil
+		}
+		txt, err := v.Interface().(encoding.TextMarshaler).MarshalText()
+		if err != nil {
+			return Arg{}, true, err
+		}
+		return StringArg(string(txt)), true, nil
+	}
+	if v.Type() == durationType {
+		return Arg{Tok: scanner.String, Text: strconv.Quote(time.Duration(v.Int()).String())}, true, nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return StringArg(v.String()), true, nil
+	case reflect.Bool:
+		return Arg{Tok: scanner.RawString, Text: strconv.FormatBool(v.Bool())}, true, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return Arg{Tok: scanner.Int, Text: strconv.FormatInt(v.Int(), 10)}, true, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return Arg{Tok: scanner.Int, Text: strconv.FormatUint(v.Uint(), 10)}, true, nil
+	case reflect.Float32, reflect.Float64:
+		f := v.Float()
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return Arg{}, true, fmt.Errorf("cannot marshal %v into a number", f)
+		}
+		txt := strconv.FormatFloat(f, 'g', -1, v.Type().Bits())
+		if !strings.ContainsAny(txt, ".e") {
+			// keep the number a float when scanned
+			txt += ".0"
+		}
+		return Arg{Tok: scanner.Float, Text: txt}, true, nil
+	default:
+		return Arg{}, false, nil
+	}
+}
@@ -0,0 +1,123 @@
+package conf
+
+import (
+	"text/scanner"
+)
+
+// PeekScanner is a Scanner which can look ahead by one token.
+type PeekScanner interface {
+	Scanner
+
+	// Peek returns the token character of the next token, without advancing the Scanner.
+	// If there is no next token, it returns scanner.EOF, and any error is available from Err.
+	Peek() rune
+
+	// Unread steps back by one token, so that the current token is returned again by the next call to Next.
+	// Only one token may be unread after each call to Next, and Unread panics otherwise.
+	Unread()
+}
+
+type peekScanner struct {
+	s       Scanner
+	cur     Token
+	prev    Token
+	hasPrev bool
+	buf     []Token
+	end     bool
+	done    bool
+}
+
+// read reads the next token from the parent into the buffer.
+func (ps *peekScanner) read() bool {
+	if ps.end {
+		return false
+	}
+	if !ps.s.Next() {
+		ps.end = true
+		return false
+	}
+	ps.buf = append(ps.buf, currentToken(ps.s))
+	return true
+}
+
+func (ps *peekScanner) Next() bool {
+	if len(ps.buf) == 0 && !ps.read() {
+		ps.done = true
+		ps.hasPrev = false
+		return false
+	}
+	ps.prev, ps.hasPrev = ps.cur, true
+	ps.cur = ps.buf[0]
+	ps.buf = ps.buf[1:]
+	return true
+}
+
+func (ps *peekScanner) Peek() rune {
+	if len(ps.buf) == 0 && !ps.read() {
+		return scanner.EOF
+	}
+	return ps.buf[0].Tok
+}
+
+func (ps *peekScanner) Unread() {
+	if !ps.hasPrev {
+		panic("conf: invalid use of Unread")
+	}
+	ps.buf = append([]Token{ps.cur}, ps.buf...)
+	ps.cur, ps.hasPrev = ps.prev, false
+	ps.done = false
+}
+
+func (ps *peekScanner) Tok() rune {
+	return ps.cur.Tok
+}
+
+func (ps *peekScanner) Text() string {
+	return ps.cur.Text
+}
+
+func (ps *peekScanner) Pos() scanner.Position {
+	if ps.done {
+		// the position of the end or error from the parent
+		return ps.s.Pos()
+	}
+	return ps.cur.Pos
+}
+
+func (ps *peekScanner) StartPos() scanner.Position {
+	if ps.done {
+		return ps.s.StartPos()
+	}
+	return ps.cur.Start
+}
+
+func (ps *peekScanner) Err() error {
+	if len(ps.buf) != 0 {
+		return nil
+	}
+	return ps.s.Err()
+}
+
+func (ps *peekScanner) comments() tokenComments {
+	if ps.done {
+		return commentsOf(ps.s)
+	}
+	return ps.cur.com
+}
+
+func (ps *peekScanner) peekRune() rune {
+	if len(ps.buf) != 0 {
+		// the parent has already moved past the current token
+		return scanner.EOF
+	}
+	return peekRune(ps.s)
+}
+
+// Lookahead returns a PeekScanner which reads tokens from the parent.
+// If the parent is already a PeekScanner, it is returned as is.
+func Lookahead(parent Scanner) PeekScanner {
+	if ps, ok := parent.(PeekScanner); ok {
+		return ps
+	}
+	return &peekScanner{s: parent}
+}
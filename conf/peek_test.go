@@ -0,0 +1,96 @@
+package conf
+
+import (
+	"strings"
+	"testing"
+	"text/scanner"
+)
+
+func TestLookahead(t *testing.T) {
+	t.Parallel()
+
+	ps := Lookahead(scanReader(strings.NewReader("a 1 {"), "test.conf"))
+	if Lookahead(ps) != ps {
+		t.Error("wrapped a PeekScanner again")
+	}
+
+	var got []string
+	expect := func(tok rune, txt string) {
+		t.Helper()
+		if !ps.Next() {
+			t.Fatalf("expected %q but got the end: %v", txt, ps.Err())
+		}
+		if ps.Tok() != tok || ps.Text() != txt {
+			t.Fatalf("expected %s %q but got %s %q", scanner.TokenString(tok), txt, scanner.TokenString(ps.Tok()), ps.Text())
+		}
+		got = append(got, ps.Text())
+	}
+
+	// Peeking does not move the Scanner.
+	if tok := ps.Peek(); tok != scanner.RawString {
+		t.Errorf("expected to peek a word but got %s", scanner.TokenString(tok))
+	}
+	expect(scanner.RawString, "a")
+	if tok := ps.Peek(); tok != scanner.Int {
+		t.Errorf("expected to peek an integer but got %s", scanner.TokenString(tok))
+	}
+	if ps.Text() != "a" || ps.Pos().Column != 2 {
+		t.Errorf("peeking moved the Scanner to %q at %v", ps.Text(), ps.Pos())
+	}
+	expect(scanner.Int, "1")
+
+	// Unreading returns the same token again.
+	ps.Unread()
+	if ps.Text() != "a" {
+		t.Errorf("expected to step back to \"a\" but got %q", ps.Text())
+	}
+	expect(scanner.Int, "1")
+	expect('{', "{")
+	if tok := ps.Peek(); tok != scanner.EOF {
+		t.Errorf("expected to peek the end but got %s", scanner.TokenString(tok))
+	}
+	if ps.Next() {
+		t.Errorf("unexpected token %q after the end", ps.Text())
+	}
+	if err := ps.Err(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if s := strings.Join(got, " "); s != "a 1 1 {" {
+		t.Errorf("unexpected tokens %q", s)
+	}
+
+	t.Run("UnreadTwice", func(t *testing.T) {
+		t.Parallel()
+
+		ps := Lookahead(scanReader(strings.NewReader("a b"), "test.conf"))
+		ps.Next()
+		ps.Next()
+		ps.Unread()
+		defer func() {
+			if recover() == nil {
+				t.Error("unread two tokens")
+			}
+		}()
+		ps.Unread()
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		t.Parallel()
+
+		// The error is only reported once the tokens before it have been read.
+		ps := Lookahead(scanReader(strings.NewReader("a \"unterminated"), "test.conf"))
+		ps.Next()
+		if tok := ps.Peek(); tok != scanner.EOF {
+			t.Errorf("expected to peek the end but got %s", scanner.TokenString(tok))
+		}
+		if ps.Text() != "a" {
+			t.Errorf("expected \"a\" to still be current but got %q", ps.Text())
+		}
+		if ps.Next() {
+			t.Errorf("unexpected token %q", ps.Text())
+		}
+		if ps.Err() == nil {
+			t.Error("expected an error")
+		}
+	})
+}
@@ -0,0 +1,154 @@
+package conf
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"text/scanner"
+)
+
+func TestStartPos(t *testing.T) {
+	t.Parallel()
+
+	const src = "listen \"a b\" 80\nlist { x, yz }\n"
+
+	// The range of each token, as "line:start-end" in columns.
+	expect := []string{
+		"listen 1:1-7",
+		"\"a b\" 1:8-13",
+		"80 1:14-16",
+		"; 1:16-16",
+		"list 2:1-5",
+		"{ 2:6-7",
+		"x 2:8-9",
+		", 2:9-10",
+		"yz 2:11-13",
+		"; 2:13-13",
+		"} 2:14-15",
+		"; 2:15-15",
+	}
+	rng := func(scan Scanner) string {
+		start, end := scan.StartPos(), scan.Pos()
+		if start.Line != end.Line {
+			return fmt.Sprintf("%s %d:%d-%d:%d", scan.Text(), start.Line, start.Column, end.Line, end.Column)
+		}
+		return fmt.Sprintf("%s %d:%d-%d", scan.Text(), start.Line, start.Column, end.Column)
+	}
+
+	t.Run("AutoSemicolon", func(t *testing.T) {
+		t.Parallel()
+
+		var got []string
+		scan := scanString(src, "test.conf")
+		for scan.Next() {
+			got = append(got, rng(scan))
+		}
+		if strings.Join(got, "\n") != strings.Join(expect, "\n") {
+			t.Errorf("expected ranges:\n%s\nbut got:\n%s", strings.Join(expect, "\n"), strings.Join(got, "\n"))
+		}
+	})
+
+	t.Run("Lookahead", func(t *testing.T) {
+		t.Parallel()
+
+		var got []string
+		scan := Lookahead(scanString(src, "test.conf"))
+		for scan.Next() {
+			scan.Peek()
+			got = append(got, rng(scan))
+		}
+		if strings.Join(got, "\n") != strings.Join(expect, "\n") {
+			t.Errorf("expected ranges:\n%s\nbut got:\n%s", strings.Join(expect, "\n"), strings.Join(got, "\n"))
+		}
+	})
+
+	t.Run("ScanList", func(t *testing.T) {
+		t.Parallel()
+
+		scan := scanString(src, "test.conf")
+		for scan.Next() && scan.Tok() != '{' {
+		}
+		var got []string
+		err := ScanList(ScanBracket(scan, '{', '}'), func(value Scanner) error {
+			got = append(got, rng(value))
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s := strings.Join(got, ", "); s != "x 2:8-9, yz 2:11-13" {
+			t.Errorf("unexpected ranges %q", s)
+		}
+	})
+
+	t.Run("Heredoc", func(t *testing.T) {
+		t.Parallel()
+
+		// A heredoc covers the opening delimiter.
+		scan := scanReader(strings.NewReader("desc <<EOF\n  x\n  EOF\n"), "test.conf")
+		scan.Next()
+		scan.Next()
+		start, end := scan.StartPos(), scan.Pos()
+		if start.Line != 1 || start.Column != 6 || end.Line != 1 || end.Column != 11 {
+			t.Errorf("expected the heredoc at 1:6-11 but got %v-%v", start, end)
+		}
+	})
+}
+
+func TestWrapRange(t *testing.T) {
+	t.Parallel()
+
+	start := scanner.Position{Filename: "test.conf", Line: 1, Column: 3}
+	end := scanner.Position{Filename: "test.conf", Line: 1, Column: 7}
+	if err := WrapRange(nil, start, end); err != nil {
+		t.Errorf("expected nil but got %v", err)
+	}
+
+	base := errors.New("bad value")
+	err := WrapRange(base, start, end)
+	var perr PosErr
+	switch {
+	case !errors.As(err, &perr):
+		t.Fatalf("expected a PosErr but got %v", err)
+	case perr.Start != start || perr.Pos != end || perr.Err != base:
+		t.Errorf("unexpected error %#v", perr)
+	case err.Error() != "bad value (test.conf:1:7)":
+		t.Errorf("unexpected message %q", err.Error())
+	}
+
+	// An error which already has a position keeps it.
+	if again := WrapRange(err, scanner.Position{}, scanner.Position{Line: 9}); again != err {
+		t.Errorf("expected the position to be kept but got %#v", again)
+	}
+	if again := WrapPos(err, scanner.Position{Line: 9}); again != err {
+		t.Errorf("expected the position to be kept but got %#v", again)
+	}
+}
+
+func TestFormatErrorRange(t *testing.T) {
+	t.Parallel()
+
+	src := "listen 80\nport abc\n"
+	at := func(line, col int) scanner.Position {
+		return scanner.Position{Filename: "test.conf", Line: line, Column: col}
+	}
+
+	// An error from a token underlines the token.
+	scan := scanString(src, "test.conf")
+	for scan.Next() && scan.Text() != "port" {
+	}
+	scan.Next()
+	_, err := ScanInt(scan, 64)
+	expect := "test.conf:2:6: unexpected token \"abc\"\nport abc\n     ^~~\n"
+	if got := FormatError(err, []byte(src)); got != expect {
+		t.Errorf("expected %q but got %q", expect, got)
+	}
+
+	// A range over multiple lines only points at the start.
+	err = WrapRange(errors.New("bad"), at(1, 8), at(2, 4))
+	expect = "test.conf:1:8: bad\nlisten 80\n       ^\n"
+	if got := FormatError(err, []byte(src)); got != expect {
+		t.Errorf("expected %q but got %q", expect, got)
+	}
+}
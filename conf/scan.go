@@ -7,6 +7,7 @@ import (
 	"strconv"
 	"strings"
 	"text/scanner"
+	"unicode"
 )
 
 // Scanner is an interface for parsing things.
@@ -23,8 +24,13 @@ type Scanner interface {
 	Text() string
 
 	// Pos returns the position of the current token or error.
+	// For tokens, this is the position directly after the end of the token.
 	Pos() scanner.Position
 
+	// StartPos returns the position of the first character of the current token.
+	// Together with Pos, this is the range of the source covered by the token.
+	StartPos() scanner.Position
+
 	// Err returns the current error, if present.
 	// If no error has occured, then it will return false.
 	Err() error
@@ -35,10 +41,47 @@ type PosErr struct {
 	// Pos is the position at which the error was encountered.
 	Pos scanner.Position
 
+	// Start is the start of the range of the source which the error applies to, ending at Pos.
+	// If the range is not known, it is the zero Position.
+	Start scanner.Position
+
 	// Err is the error encountered.
 	Err error
 }
 
+// MultiError is a list of errors, such as the errors collected by ParseDirectivesAll.
+type MultiError []error
+
+// Add appends an error to the list.
+// Nil errors are ignored.
+func (errs *MultiError) Add(err error) {
+	if err != nil {
+		*errs = append(*errs, err)
+	}
+}
+
+// Err returns the list as an error, or nil if the list is empty.
+func (errs MultiError) Err() error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+func (errs MultiError) Error() string {
+	switch len(errs) {
+	case 0:
+		return "no errors"
+	case 1:
+		return errs[0].Error()
+	}
+	msgs := make([]string, len(errs))
+	for i, err := range errs {
+		msgs[i] = err.Error()
+	}
+	return fmt.Sprintf("%d errors:\n%s", len(errs), strings.Join(msgs, "\n"))
+}
+
 // ErrUnexpectedToken is error which occurs when an unexpected token is encountered.
 type ErrUnexpectedToken struct {
 	Tok  rune
@@ -57,6 +100,10 @@ func (err ErrUnexpectedToken) Error() string {
 		return fmt.Sprintf("unexpected string %s", err.Text)
 	case scanner.RawString:
 		return fmt.Sprintf("unexpected token %q", err.Text)
+	case Duration:
+		return fmt.Sprintf("unexpected duration %s", err.Text)
+	case ByteSize:
+		return fmt.Sprintf("unexpected byte size %s", err.Text)
 	default:
 		return fmt.Sprintf("unexpected token %s (%q)", scanner.TokenString(err.Tok), err.Text)
 	}
@@ -76,22 +123,50 @@ func WrapPos(err error, pos scanner.Position) error {
 	}
 }
 
+// WrapRange wraps an error applying to the range of the source from start to end.
+func WrapRange(err error, start, end scanner.Position) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(PosErr); ok {
+		return err
+	}
+	return PosErr{
+		Pos:   end,
+		Start: start,
+		Err:   err,
+	}
+}
+
+// wrapToken wraps an error applying to the current token in the Scanner.
+func wrapToken(err error, s Scanner) error {
+	return WrapRange(err, s.StartPos(), s.Pos())
+}
+
 // Unexpected returns a ErrUnexpectedToken wrapped with an error position for the current token in the Scanner.
 func Unexpected(s Scanner) error {
-	return WrapPos(ErrUnexpectedToken{
+	return wrapToken(ErrUnexpectedToken{
 		Tok:  s.Tok(),
 		Text: s.Text(),
-	}, s.Pos())
+	}, s)
 }
 
 func (err PosErr) Error() string {
 	return fmt.Sprintf("%s (%s)", err.Err.Error(), err.Pos.String())
 }
 
+// Unwrap returns the error which was annotated with the position.
+func (err PosErr) Unwrap() error {
+	return err.Err
+}
+
 type rawScanner struct {
-	s   *scanner.Scanner
-	tok rune
-	err error
+	s     *scanner.Scanner
+	tok   rune
+	txt   string
+	start scanner.Position
+	pos   *scanner.Position
+	err   error
 }
 
 func (rs *rawScanner) scanConf() *rawScanner {
@@ -106,14 +181,25 @@ func (rs *rawScanner) Next() bool {
 		return false
 	}
 	rs.tok = rs.s.Scan()
+	rs.txt, rs.start, rs.pos = "", rs.s.Position, nil
 	if rs.err != nil {
 		return false
 	}
-	if rs.tok == scanner.EOF {
+	switch rs.tok {
+	case scanner.EOF:
 		return false
-	}
-	if rs.tok == scanner.Ident {
+	case scanner.Ident:
 		rs.tok = scanner.RawString
+	case '<':
+		if rs.s.Peek() != '<' {
+			break
+		}
+		pos, str, err := rs.scanHeredoc()
+		if err != nil {
+			rs.err = WrapPos(err, rs.s.Pos())
+			return false
+		}
+		rs.tok, rs.txt, rs.pos = scanner.String, strconv.Quote(str), &pos
 	}
 	return true
 }
@@ -123,26 +209,110 @@ func (rs *rawScanner) Tok() rune {
 }
 
 func (rs *rawScanner) Text() string {
+	if rs.txt != "" {
+		return rs.txt
+	}
 	return rs.s.TokenText()
 }
 
 func (rs *rawScanner) Pos() scanner.Position {
+	if rs.pos != nil && rs.err == nil {
+		return *rs.pos
+	}
 	return rs.s.Pos()
 }
 
+func (rs *rawScanner) StartPos() scanner.Position {
+	return rs.start
+}
+
 func (rs *rawScanner) Err() error {
 	return rs.err
 }
 
+func (rs *rawScanner) peekRune() rune {
+	return rs.s.Peek()
+}
+
 // Scan wraps a scanner.Scanner into a Scanner.
+//
+// In addition to the tokens of the scanner.Scanner, multi-line strings may be written as heredocs:
+//
+//	desc <<EOF
+//	    The first line.
+//	    The second line.
+//	    EOF
+//
+// A heredoc starts with "<<" followed by a delimiter word, at the end of a line.
+// The lines up to a line containing only the delimiter form the string, without the final line break.
+// The indentation of the delimiter line is removed from each line of the string, so heredocs can be indented along with the surrounding directives.
+// Heredocs are returned as quoted string tokens, so they may be read with ScanString.
+//
+// The input is not limited in size or nesting, so untrusted input should be read through Limit.
 func Scan(s *scanner.Scanner) Scanner {
 	return (&rawScanner{s: s}).scanConf()
 }
 
+// scanHeredoc reads the remainder of a heredoc after the first "<<" character, and returns the string.
+// The line break after the delimiter line is left for the next token.
+// The returned position is the end of the opening delimiter, so that the heredoc is on the line of the directive which it belongs to.
+func (rs *rawScanner) scanHeredoc() (scanner.Position, string, error) {
+	rs.s.Next()
+	var delim []rune
+	for c := rs.s.Peek(); c == '_' || unicode.IsLetter(c) || (len(delim) > 0 && unicode.IsDigit(c)); c = rs.s.Peek() {
+		delim = append(delim, rs.s.Next())
+	}
+	if len(delim) == 0 {
+		return scanner.Position{}, "", errors.New("missing heredoc delimiter")
+	}
+	pos := rs.s.Pos()
+	for c := rs.s.Next(); c != '\n'; c = rs.s.Next() {
+		switch c {
+		case ' ', '\t', '\r':
+		case scanner.EOF:
+			return pos, "", errors.New("heredoc not terminated")
+		default:
+			return pos, "", fmt.Errorf("unexpected %q after heredoc delimiter", c)
+		}
+	}
+
+	var lines []string
+	var line []rune
+	for {
+		c := rs.s.Peek()
+		if c != '\n' && c != scanner.EOF {
+			line = append(line, rs.s.Next())
+			continue
+		}
+		l := strings.TrimSuffix(string(line), "\r")
+		if strings.TrimSpace(l) == string(delim) {
+			indent := l[:len(l)-len(strings.TrimLeft(l, " \t"))]
+			for i, l := range lines {
+				switch {
+				case strings.HasPrefix(l, indent):
+					lines[i] = l[len(indent):]
+				case strings.TrimSpace(l) == "":
+					lines[i] = ""
+				default:
+					return pos, "", fmt.Errorf("heredoc line %q is indented less than the delimiter", l)
+				}
+			}
+			return pos, strings.Join(lines, "\n"), nil
+		}
+		if c == scanner.EOF {
+			return pos, "", errors.New("heredoc not terminated")
+		}
+		rs.s.Next()
+		lines = append(lines, l)
+		line = line[:0]
+	}
+}
+
 type asiScanner struct {
 	s        Scanner
 	tok      rune
 	txt      string
+	start    scanner.Position
 	pos      scanner.Position
 	inserted bool
 	end      bool
@@ -150,10 +320,12 @@ type asiScanner struct {
 
 func (as *asiScanner) Next() bool {
 	if as.end {
+		// the parent has ended, so its error is no longer hidden by an inserted semicolon
+		as.inserted = false
 		return false
 	}
 	if as.inserted {
-		as.tok, as.txt, as.pos = as.s.Tok(), as.s.Text(), as.s.Pos()
+		as.tok, as.txt, as.start, as.pos = as.s.Tok(), as.s.Text(), as.s.StartPos(), as.s.Pos()
 		as.inserted = false
 		return true
 	}
@@ -162,7 +334,7 @@ func (as *asiScanner) Next() bool {
 		switch as.tok {
 		case ';', 0:
 		default:
-			as.tok, as.txt, as.inserted = ';', ";", true
+			as.tok, as.txt, as.start, as.inserted = ';', ";", as.pos, true
 			return true
 		}
 		return false
@@ -170,7 +342,7 @@ func (as *asiScanner) Next() bool {
 	switch as.s.Tok() {
 	case '}', ']', ')':
 		if as.tok != ';' && strings.Index("{[(", as.txt) != strings.Index(")]}", as.s.Text()) {
-			as.tok, as.txt, as.inserted = ';', ";", true
+			as.tok, as.txt, as.start, as.inserted = ';', ";", as.pos, true
 			return true
 		}
 		fallthrough
@@ -182,13 +354,13 @@ func (as *asiScanner) Next() bool {
 			// opening of a bracket - continues onto next line possibly
 		default:
 			if as.s.Pos().Line > as.pos.Line {
-				as.tok, as.txt, as.inserted = ';', ";", true
+				as.tok, as.txt, as.start, as.inserted = ';', ";", as.pos, true
 				return true
 			}
 		}
 		fallthrough
 	case ';':
-		as.tok, as.txt, as.pos = as.s.Tok(), as.s.Text(), as.s.Pos()
+		as.tok, as.txt, as.start, as.pos = as.s.Tok(), as.s.Text(), as.s.StartPos(), as.s.Pos()
 		return true
 	}
 }
@@ -205,6 +377,10 @@ func (as *asiScanner) Pos() scanner.Position {
 	return as.pos
 }
 
+func (as *asiScanner) StartPos() scanner.Position {
+	return as.start
+}
+
 func (as *asiScanner) Err() error {
 	if as.inserted {
 		return nil
@@ -212,6 +388,22 @@ func (as *asiScanner) Err() error {
 	return as.s.Err()
 }
 
+func (as *asiScanner) comments() tokenComments {
+	if as.inserted || as.end {
+		// inserted semicolons have no comments
+		return tokenComments{}
+	}
+	return commentsOf(as.s)
+}
+
+func (as *asiScanner) peekRune() rune {
+	if as.inserted || as.end {
+		// the parent has already moved past the current token
+		return scanner.EOF
+	}
+	return peekRune(as.s)
+}
+
 // AutoSemicolon returns a scanner which automatically inserts semicolons into the token stream from the parent.
 func AutoSemicolon(parent Scanner) Scanner {
 	return &asiScanner{s: parent}
@@ -253,6 +445,14 @@ func (bs *bracketScanner) Err() error {
 	return bs.Scanner.Err()
 }
 
+func (bs *bracketScanner) comments() tokenComments {
+	return commentsOf(bs.Scanner)
+}
+
+func (bs *bracketScanner) peekRune() rune {
+	return peekRune(bs.Scanner)
+}
+
 // ScanBracket returns a Scanner that reads tokens between two brackets.
 // Must be called while parent scanner is on the open bracket.
 func ScanBracket(parent Scanner, open rune, close rune) Scanner {
@@ -268,19 +468,25 @@ type semicolonScanner struct {
 	Scanner
 	level   int
 	err     error
+	done    bool
 	openers map[rune]struct{}
 	closers map[rune]struct{}
 }
 
 func (ss *semicolonScanner) Next() bool {
+	if ss.done {
+		return false
+	}
 	if !ss.Scanner.Next() {
 		if ss.Scanner.Err() == nil {
 			ss.err = WrapPos(io.ErrUnexpectedEOF, ss.Pos())
 		}
+		ss.done = true
 		return false
 	}
 	tok := ss.Scanner.Tok()
 	if tok == ';' && ss.level == 0 {
+		ss.done = true
 		return false
 	}
 	if _, ok := ss.openers[tok]; ok {
@@ -299,6 +505,14 @@ func (ss *semicolonScanner) Err() error {
 	return ss.Scanner.Err()
 }
 
+func (ss *semicolonScanner) comments() tokenComments {
+	return commentsOf(ss.Scanner)
+}
+
+func (ss *semicolonScanner) peekRune() rune {
+	return peekRune(ss.Scanner)
+}
+
 func mapRunes(runes []rune) map[rune]struct{} {
 	if len(runes) == 0 {
 		return map[rune]struct{}{}
@@ -313,6 +527,7 @@ func mapRunes(runes []rune) map[rune]struct{} {
 
 // ScanSemicolon returns a Scanner that scans until a semicolon.
 // It can handle subcontexts, delimited by the given openers and closers.
+// Once the semicolon has been reached, Next will keep returning false, so the parent is not advanced past the semicolon.
 func ScanSemicolon(parent Scanner, openers []rune, closers []rune) Scanner {
 	return &semicolonScanner{
 		Scanner: parent,
@@ -321,6 +536,15 @@ func ScanSemicolon(parent Scanner, openers []rune, closers []rune) Scanner {
 	}
 }
 
+// peekRune returns the character directly following the current token, without advancing the Scanner.
+// If the Scanner does not support this, scanner.EOF is returned.
+func peekRune(scan Scanner) rune {
+	if p, ok := scan.(interface{ peekRune() rune }); ok {
+		return p.peekRune()
+	}
+	return scanner.EOF
+}
+
 // ScanString reads a string-ish token and returns the fully parsed string.
 // If the token is a raw string, it will return the raw string.
 // If the token is a quoted string, it will be unquoted.
@@ -332,7 +556,7 @@ func ScanString(scan Scanner) (string, error) {
 	case scanner.String:
 		str, err := strconv.Unquote(scan.Text())
 		if err != nil {
-			return "", WrapPos(err, scan.Pos())
+			return "", wrapToken(err, scan)
 		}
 		return str, nil
 	default:
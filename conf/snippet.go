@@ -0,0 +1,92 @@
+package conf
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+)
+
+// FormatError renders an error in the style of a compiler diagnostic, with the offending line of the source and a caret under the column of the error.
+// If the error has a range within a line, the whole range is underlined.
+// For example:
+//
+//	spec.rpc:3:14: unexpected token "int" ("int")
+//	    op Add(a int }
+//	             ^~~
+//
+// The error may be a PosErr, or a MultiError, in which case each of the errors is rendered in turn.
+// Errors without a position, and positions which do not fall within the source, are rendered without a snippet.
+// The result ends with a line break.
+func FormatError(err error, src []byte) string {
+	var b strings.Builder
+	formatError(&b, err, src)
+	return b.String()
+}
+
+func formatError(b *strings.Builder, err error, src []byte) {
+	if multi, ok := err.(MultiError); ok {
+		for _, err := range multi {
+			formatError(b, err, src)
+		}
+		return
+	}
+	var perr PosErr
+	if !errors.As(err, &perr) || !perr.Pos.IsValid() {
+		b.WriteString(err.Error())
+		b.WriteByte('\n')
+		return
+	}
+	// underline the range of the error if it is known, and otherwise point at the position
+	start, width := perr.Pos, 1
+	if perr.Start.IsValid() {
+		start = perr.Start
+		if start.Line == perr.Pos.Line && start.Column < perr.Pos.Column {
+			width = perr.Pos.Column - start.Column
+		}
+	}
+	b.WriteString(start.String())
+	b.WriteString(": ")
+	b.WriteString(perr.Err.Error())
+	b.WriteByte('\n')
+
+	line, ok := sourceLine(src, start.Line)
+	if !ok {
+		return
+	}
+	b.WriteString(line)
+	b.WriteByte('\n')
+	col := 1
+	for _, c := range line {
+		if col >= start.Column {
+			break
+		}
+		col++
+		if c == '\t' {
+			// keep tabs so that the caret lines up
+			b.WriteByte('\t')
+		} else {
+			b.WriteByte(' ')
+		}
+	}
+	b.WriteString("^")
+	b.WriteString(strings.Repeat("~", width-1))
+	b.WriteByte('\n')
+}
+
+// sourceLine returns a line of the source, by line number starting at 1.
+func sourceLine(src []byte, n int) (string, bool) {
+	if n < 1 {
+		return "", false
+	}
+	for ; n > 1; n-- {
+		i := bytes.IndexByte(src, '\n')
+		if i == -1 {
+			return "", false
+		}
+		src = src[i+1:]
+	}
+	if i := bytes.IndexByte(src, '\n'); i != -1 {
+		src = src[:i]
+	}
+	return strings.TrimSuffix(string(src), "\r"), true
+}
@@ -0,0 +1,72 @@
+package conf
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"text/scanner"
+)
+
+func TestFormatError(t *testing.T) {
+	t.Parallel()
+
+	src := []byte("listen 80\n\tport x y\r\nend\n")
+	at := func(line, col int) scanner.Position {
+		return scanner.Position{Filename: "test.conf", Line: line, Column: col}
+	}
+
+	cases := []struct {
+		name   string
+		err    error
+		expect string
+	}{
+		{
+			name:   "Caret",
+			err:    WrapPos(errors.New("bad port"), at(1, 8)),
+			expect: "test.conf:1:8: bad port\nlisten 80\n       ^\n",
+		},
+		{
+			name:   "Tab",
+			err:    WrapPos(errors.New("bad y"), at(2, 9)),
+			expect: "test.conf:2:9: bad y\n\tport x y\n\t       ^\n",
+		},
+		{
+			name:   "Wrapped",
+			err:    fmt.Errorf("loading: %w", WrapPos(errors.New("bad end"), at(3, 1))),
+			expect: "test.conf:3:1: bad end\nend\n^\n",
+		},
+		{
+			name:   "NoPosition",
+			err:    errors.New("plain"),
+			expect: "plain\n",
+		},
+		{
+			name:   "InvalidPosition",
+			err:    WrapPos(errors.New("nowhere"), scanner.Position{}),
+			expect: "nowhere (<input>)\n",
+		},
+		{
+			name:   "OutOfSource",
+			err:    WrapPos(errors.New("past the end"), at(7, 1)),
+			expect: "test.conf:7:1: past the end\n",
+		},
+		{
+			name: "Multi",
+			err: MultiError{
+				WrapPos(errors.New("first"), at(1, 1)),
+				errors.New("second"),
+			},
+			expect: "test.conf:1:1: first\nlisten 80\n^\nsecond\n",
+		},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := FormatError(c.err, src); got != c.expect {
+				t.Errorf("expected %q but got %q", c.expect, got)
+			}
+		})
+	}
+}
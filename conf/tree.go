@@ -0,0 +1,187 @@
+package conf
+
+import (
+	"text/scanner"
+)
+
+// Directive is a node in a tree of directives.
+// A directive is a name followed by arguments, and is terminated by a semicolon.
+type Directive struct {
+	// Name is the name of the directive.
+	Name string
+
+	// Args are the arguments of the directive, in order.
+	Args []Arg
+
+	// Pos is the position of the name of the directive.
+	Pos scanner.Position
+
+	// Comments are the comments on the lines before the directive, with their delimiters.
+	// Comments are only kept if the Scanner was wrapped with KeepComments.
+	Comments []string
+
+	// LineComment is a comment following the directive on the same line, with its delimiters.
+	// For a directive ending with a block, this may also be a comment after the opening or closing brace.
+	LineComment string
+}
+
+// Block returns the first block argument of the directive.
+// If the directive has no block argument, the second return is false.
+func (d Directive) Block() ([]Directive, bool) {
+	for _, a := range d.Args {
+		if a.Tok == '{' {
+			return a.Block, true
+		}
+	}
+	return nil, false
+}
+
+// Arg is an argument of a directive, which is either a single token or a block of directives in braces.
+type Arg struct {
+	// Tok is the token character of the argument, as returned by Scanner.Tok.
+	// Blocks use the '{' character.
+	Tok rune
+
+	// Text is the text of the token.
+	// Negative numbers are stored in a single token, with the sign included in the text.
+	Text string
+
+	// Block is the set of directives in a block argument.
+	Block []Directive
+
+	// Pos is the position of the argument.
+	Pos scanner.Position
+}
+
+// ParseDirectives parses a tree of directives from a Scanner.
+// Blocks are delimited by braces, and all other tokens are kept as arguments.
+// The Scanner is typically wrapped with AutoSemicolon, so that directives may be terminated by newlines.
+func ParseDirectives(scan Scanner) ([]Directive, error) {
+	dirs, err := parseDirectives(scan, nil)
+	if err != nil {
+		return nil, err
+	}
+	return dirs, nil
+}
+
+// ParseDirectivesAll parses a tree of directives from a Scanner like ParseDirectives, but does not stop at the first invalid directive.
+// Instead, the error is collected and parsing continues after the next semicolon or closing brace.
+// Invalid directives are left out of the tree, and the collected errors are returned as a MultiError alongside the directives which were parsed.
+// Errors from the Scanner itself cannot be recovered from, and end parsing.
+func ParseDirectivesAll(scan Scanner) ([]Directive, error) {
+	var errs MultiError
+	dirs, err := parseDirectives(scan, &errs)
+	errs.Add(err)
+	return dirs, errs.Err()
+}
+
+// parseDirectives parses directives until the end of the Scanner.
+// If errs is not nil, errors in directives are collected into it and the directives are skipped.
+func parseDirectives(scan Scanner, errs *MultiError) ([]Directive, error) {
+	dirs := []Directive{}
+	for scan.Next() {
+		if scan.Tok() == ';' {
+			// empty directive
+			continue
+		}
+		d, err := parseDirective(scan, errs)
+		if err != nil {
+			if errs == nil || scan.Err() != nil {
+				return dirs, err
+			}
+			errs.Add(err)
+			skipDirective(scan)
+			continue
+		}
+		dirs = append(dirs, d)
+	}
+	return dirs, scan.Err()
+}
+
+// parseDirective parses a directive starting at the current token.
+func parseDirective(scan Scanner, errs *MultiError) (Directive, error) {
+	name, err := ScanString(scan)
+	if err != nil {
+		return Directive{}, err
+	}
+	d := Directive{
+		Name: name,
+		Args: []Arg{},
+		Pos:  scan.Pos(),
+	}
+	d.Comments, d.LineComment = Comments(scan)
+	if err := d.parseArgs(scan, errs); err != nil {
+		return Directive{}, err
+	}
+	return d, nil
+}
+
+// parseArgs parses the arguments of a directive, up to the terminating semicolon or the end of the input.
+func (d *Directive) parseArgs(scan Scanner, errs *MultiError) error {
+	for scan.Next() {
+		switch scan.Tok() {
+		case ';':
+			return nil
+		case '{':
+			pos := scan.Pos()
+			d.lineComment(scan)
+			block, err := parseDirectives(ScanBracket(scan, '{', '}'), errs)
+			if err != nil {
+				return err
+			}
+			d.Args = append(d.Args, Arg{Tok: '{', Block: block, Pos: pos})
+			d.lineComment(scan)
+		case '}':
+			return Unexpected(scan)
+		case scanner.Int, scanner.Float, Duration:
+			// merge a sign directly before a number into the number
+			n := len(d.Args)
+			if n != 0 && d.Args[n-1].Tok == '-' && adjacent(d.Args[n-1].Pos, scan.Pos(), len(scan.Text())) {
+				d.Args[n-1] = Arg{Tok: scan.Tok(), Text: "-" + scan.Text(), Pos: d.Args[n-1].Pos}
+				d.lineComment(scan)
+				continue
+			}
+			fallthrough
+		default:
+			d.Args = append(d.Args, Arg{Tok: scan.Tok(), Text: scan.Text(), Pos: scan.Pos()})
+			d.lineComment(scan)
+		}
+	}
+	return scan.Err()
+}
+
+// lineComment keeps the line comment of the current token of the directive, if there is one.
+func (d *Directive) lineComment(scan Scanner) {
+	if _, line := Comments(scan); line != "" {
+		d.LineComment = line
+	}
+}
+
+// skipDirective skips the remaining tokens of an invalid directive, up to the terminating semicolon or a closing brace.
+// Blocks within the directive are skipped entirely.
+func skipDirective(scan Scanner) {
+	level := 0
+	for {
+		switch scan.Tok() {
+		case '{':
+			level++
+		case '}':
+			if level == 0 {
+				return
+			}
+			level--
+		case ';':
+			if level == 0 {
+				return
+			}
+		}
+		if !scan.Next() {
+			return
+		}
+	}
+}
+
+// adjacent checks whether a token directly follows the previous token, given the positions reported by the Scanner after each token.
+func adjacent(prev, next scanner.Position, n int) bool {
+	return prev.Filename == next.Filename && prev.Line == next.Line && prev.Column+n == next.Column
+}
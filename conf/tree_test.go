@@ -0,0 +1,123 @@
+package conf
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"text/scanner"
+)
+
+func TestParseDirectivesAll(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name  string
+		src   string
+		names string
+		errs  int
+	}{
+		{
+			name:  "Valid",
+			src:   "a 1\nb { c 2 }\n",
+			names: "a b{c}",
+		},
+		{
+			name:  "InvalidName",
+			src:   "a 1\n2 x\nb 3\n",
+			names: "a b",
+			errs:  1,
+		},
+		{
+			// Only the stray brace is skipped, as the directive before it ends at the brace.
+			name:  "StrayBrace",
+			src:   "a 1\nb x } y\nc 3\n",
+			names: "a b y c",
+			errs:  1,
+		},
+		{
+			name:  "InBlock",
+			src:   "a {\n    b 1\n    2 x\n    c 3\n}\nd 4\n",
+			names: "a{b c} d",
+			errs:  1,
+		},
+		{
+			name:  "InvalidWithBlock",
+			src:   "1 { a; b }\nc\n",
+			names: "c",
+			errs:  1,
+		},
+		{
+			name:  "Several",
+			src:   "1\na\n2\nb { 3; c }\n",
+			names: "a b{c}",
+			errs:  3,
+		},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			dirs, err := ParseDirectivesAll(scanString(c.src, "test.conf"))
+			if got := names(dirs); got != c.names {
+				t.Errorf("expected directives %q but got %q", c.names, got)
+			}
+			var errs MultiError
+			switch {
+			case c.errs == 0 && err != nil:
+				t.Errorf("unexpected error: %v", err)
+			case c.errs == 0:
+			case !errors.As(err, &errs):
+				t.Errorf("expected %d errors but got %v", c.errs, err)
+			case len(errs) != c.errs:
+				t.Errorf("expected %d errors but got %d: %v", c.errs, len(errs), err)
+			}
+
+			// ParseDirectives stops at the first error instead.
+			if _, err := ParseDirectives(scanString(c.src, "test.conf")); (err != nil) != (c.errs != 0) {
+				t.Errorf("unexpected error from ParseDirectives: %v", err)
+			}
+		})
+	}
+
+	t.Run("ScannerError", func(t *testing.T) {
+		t.Parallel()
+
+		// Errors from the Scanner end parsing.
+		dirs, err := ParseDirectivesAll(scanReader(strings.NewReader("a 1; b \"unterminated\nc 2;"), "test.conf"))
+		if err == nil {
+			t.Error("expected an error")
+		}
+		if got := names(dirs); strings.Contains(got, "c") {
+			t.Errorf("expected parsing to end at the error but got %q", got)
+		}
+	})
+}
+
+func TestMultiError(t *testing.T) {
+	t.Parallel()
+
+	var errs MultiError
+	errs.Add(nil)
+	if err := errs.Err(); err != nil {
+		t.Errorf("expected no error from an empty list but got %v", err)
+	}
+	if msg := errs.Error(); msg != "no errors" {
+		t.Errorf("unexpected message %q for an empty list", msg)
+	}
+
+	first := errors.New("first")
+	errs.Add(first)
+	if msg := errs.Err().Error(); msg != "first" {
+		t.Errorf("expected a single error to be reported alone but got %q", msg)
+	}
+
+	errs.Add(WrapPos(errors.New("second"), scanner.Position{Filename: "test.conf", Line: 2, Column: 3}))
+	if expect := "2 errors:\nfirst\nsecond (test.conf:2:3)"; errs.Error() != expect {
+		t.Errorf("expected %q but got %q", expect, errs.Error())
+	}
+	var list MultiError
+	if !errors.As(errs.Err(), &list) || len(list) != 2 || list[0] != first {
+		t.Errorf("expected the list back from Err but got %#v", errs.Err())
+	}
+}
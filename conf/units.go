@@ -0,0 +1,129 @@
+package conf
+
+import (
+	"strings"
+	"text/scanner"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Token characters of the literals recognized by ScanUnits.
+// These do not overlap with the token characters of the scanner package.
+const (
+	// Duration is the token character of a duration literal, such as 250ms or 1h30m.
+	Duration rune = -(iota + 16)
+
+	// ByteSize is the token character of a byte size literal, such as 64KiB or 1.5GB.
+	ByteSize
+)
+
+// unitKind finds the token character of a number followed by a unit.
+// If the text is neither a duration nor a byte size, it returns 0.
+func unitKind(txt string) rune {
+	if _, err := time.ParseDuration(txt); err == nil {
+		return Duration
+	}
+	unit := txt[len(strings.TrimRightFunc(txt, unicode.IsLetter)):]
+	if _, ok := byteUnits[strings.ToLower(unit)]; ok && unit != "" {
+		return ByteSize
+	}
+	return 0
+}
+
+type unitScanner struct {
+	s    Scanner
+	cur  Token
+	next *Token
+	end  bool
+	done bool
+}
+
+func (us *unitScanner) Next() bool {
+	var t Token
+	switch {
+	case us.next != nil:
+		t, us.next = *us.next, nil
+	case us.end || !us.s.Next():
+		us.end, us.done = true, true
+		return false
+	default:
+		t = currentToken(us.s)
+	}
+
+	// a unit directly following a number is split into an identifier by the scanner
+	if (t.Tok == scanner.Int || t.Tok == scanner.Float) && us.next == nil && !us.end {
+		if r := peekRune(us.s); r != scanner.EOF && (unicode.IsLetter(r) || r == 'µ') {
+			if !us.s.Next() {
+				us.end = true
+			} else {
+				u := currentToken(us.s)
+				if tok := unitKind(t.Text + u.Text); tok != 0 {
+					t = Token{tok, t.Text + u.Text, t.Start, u.Pos, t.com}
+				} else {
+					us.next = &u
+				}
+			}
+		}
+	}
+	us.cur = t
+	return true
+}
+
+func (us *unitScanner) Tok() rune {
+	return us.cur.Tok
+}
+
+func (us *unitScanner) Text() string {
+	return us.cur.Text
+}
+
+func (us *unitScanner) Pos() scanner.Position {
+	if us.done {
+		return us.s.Pos()
+	}
+	return us.cur.Pos
+}
+
+func (us *unitScanner) StartPos() scanner.Position {
+	if us.done {
+		return us.s.StartPos()
+	}
+	return us.cur.Start
+}
+
+func (us *unitScanner) Err() error {
+	if !us.done {
+		return nil
+	}
+	return us.s.Err()
+}
+
+func (us *unitScanner) comments() tokenComments {
+	if us.done {
+		return commentsOf(us.s)
+	}
+	return us.cur.com
+}
+
+func (us *unitScanner) peekRune() rune {
+	switch {
+	case us.next != nil && us.next.Start == us.cur.Pos:
+		r, _ := utf8.DecodeRuneInString(us.next.Text)
+		return r
+	case us.next != nil:
+		return ' '
+	case us.end:
+		return scanner.EOF
+	default:
+		return peekRune(us.s)
+	}
+}
+
+// ScanUnits returns a Scanner which joins numbers directly followed by a unit into single tokens.
+// Durations in the format accepted by time.ParseDuration (such as 10s, 250ms, or 1h30m) become Duration tokens, and byte sizes (such as 512B, 64KiB, or 1.5GB) become ByteSize tokens.
+// Other numbers are left as is, and a sign before a literal remains a separate token, as with other numbers.
+// The literals may be read with ScanDuration and ScanByteSize.
+func ScanUnits(parent Scanner) Scanner {
+	return &unitScanner{s: parent}
+}
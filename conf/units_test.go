@@ -0,0 +1,149 @@
+package conf
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"text/scanner"
+	"time"
+)
+
+func TestScanUnits(t *testing.T) {
+	t.Parallel()
+
+	// tokenName describes a token character, including the unit literals.
+	tokenName := func(tok rune) string {
+		switch tok {
+		case Duration:
+			return "Duration"
+		case ByteSize:
+			return "ByteSize"
+		default:
+			return scanner.TokenString(tok)
+		}
+	}
+
+	cases := []struct {
+		name   string
+		src    string
+		expect string
+	}{
+		{
+			name:   "Duration",
+			src:    "timeout 1h30m 250ms 5µs",
+			expect: "Ident:timeout Duration:1h30m Duration:250ms Duration:5µs",
+		},
+		{
+			name:   "ByteSize",
+			src:    "size 64KiB 1.5GB 512b",
+			expect: "Ident:size ByteSize:64KiB ByteSize:1.5GB ByteSize:512b",
+		},
+		{
+			name:   "Spaced",
+			src:    "size 64 KiB",
+			expect: "Ident:size Int:64 Ident:KiB",
+		},
+		{
+			name:   "UnknownUnit",
+			src:    "5apples 2",
+			expect: "Int:5 Ident:apples Int:2",
+		},
+		{
+			name:   "Negative",
+			src:    "offset -5s",
+			expect: `Ident:offset "-":- Duration:5s`,
+		},
+		{
+			name:   "Plain",
+			src:    "n 1 2.5 0x1F",
+			expect: "Ident:n Int:1 Float:2.5 Int:0x1F",
+		},
+		{
+			name:   "Adjacent",
+			src:    "10s,20s",
+			expect: `Duration:10s ",":, Duration:20s`,
+		},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			var got []string
+			scan := ScanUnits(scanReader(strings.NewReader(c.src), "test.conf"))
+			for scan.Next() {
+				tok := scan.Tok()
+				if tok == scanner.RawString && !strings.HasPrefix(scan.Text(), "`") {
+					// words are scanned as raw strings
+					tok = scanner.Ident
+				}
+				got = append(got, tokenName(tok)+":"+scan.Text())
+			}
+			if err := scan.Err(); err != nil {
+				t.Fatal(err)
+			}
+			if s := strings.Join(got, " "); s != c.expect {
+				t.Errorf("expected %q but got %q", c.expect, s)
+			}
+		})
+	}
+
+	t.Run("Range", func(t *testing.T) {
+		t.Parallel()
+
+		scan := ScanUnits(scanReader(strings.NewReader("a 10MiB"), "test.conf"))
+		scan.Next()
+		scan.Next()
+		if start, end := scan.StartPos(), scan.Pos(); start.Column != 3 || end.Column != 8 {
+			t.Errorf("expected the literal at 3-8 but got %v-%v", start, end)
+		}
+	})
+
+	t.Run("Values", func(t *testing.T) {
+		t.Parallel()
+
+		// The joined literals are read by the typed scan helpers, and are rejected by the others.
+		scan := ScanUnits(scanReader(strings.NewReader("-2m 3kB 4s"), "test.conf"))
+		scan.Next()
+		d, err := ScanDuration(scan)
+		if err != nil || d != -2*time.Minute {
+			t.Errorf("expected -2m but got %v, %v", d, err)
+		}
+		scan.Next()
+		n, err := ScanByteSize(scan)
+		if err != nil || n != 3000 {
+			t.Errorf("expected 3000 but got %d, %v", n, err)
+		}
+		scan.Next()
+		if _, err := ScanInt(scan, 64); err == nil || !strings.Contains(err.Error(), "unexpected duration 4s") {
+			t.Errorf("expected an unexpected duration error but got %v", err)
+		}
+		if _, err := ScanByteSize(scan); err == nil {
+			t.Error("read a duration as a byte size")
+		}
+	})
+
+	t.Run("Directives", func(t *testing.T) {
+		t.Parallel()
+
+		dirs, err := ParseDirectives(AutoSemicolon(ScanUnits(scanReader(strings.NewReader("wait -10s 1KB\n"), "test.conf"))))
+		if err != nil {
+			t.Fatal(err)
+		}
+		args := dirs[0].Args
+		if len(args) != 2 || args[0].Tok != Duration || args[0].Text != "-10s" || args[1].Tok != ByteSize {
+			t.Errorf("unexpected arguments %#v", args)
+		}
+		dat, err := json.Marshal(dirs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expect := `[{"name":"wait","args":["-10s","1KB"]}]`; string(dat) != expect {
+			t.Errorf("expected %s but got %s", expect, dat)
+		}
+		if s := fmt.Sprint(dirs[0]); s != "wait -10s 1KB" {
+			t.Errorf("expected \"wait -10s 1KB\" but got %q", s)
+		}
+	})
+}
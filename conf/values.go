@@ -0,0 +1,226 @@
+package conf
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"text/scanner"
+	"time"
+	"unicode"
+)
+
+// scanNumber reads a number token, which may be preceded by a sign, and returns its text.
+// If units is true, Duration and ByteSize tokens are also accepted.
+// If the token is not a number, it will return an error.
+func scanNumber(scan Scanner, signed, units bool) (string, error) {
+	sign := ""
+	if signed && (scan.Tok() == '-' || scan.Tok() == '+') {
+		sign = scan.Text()
+		if !scan.Next() {
+			if err := scan.Err(); err != nil {
+				return "", err
+			}
+			return "", WrapPos(errors.New("missing number after sign"), scan.Pos())
+		}
+	}
+	switch scan.Tok() {
+	case scanner.Int, scanner.Float:
+		return sign + scan.Text(), nil
+	case Duration, ByteSize:
+		if units {
+			return sign + scan.Text(), nil
+		}
+		return "", Unexpected(scan)
+	default:
+		return "", Unexpected(scan)
+	}
+}
+
+// numError unwraps the error returned by strconv, which repeats the text of the number.
+func numError(err error) error {
+	var nerr *strconv.NumError
+	if errors.As(err, &nerr) {
+		return fmt.Errorf("invalid number %q: %w", nerr.Num, nerr.Err)
+	}
+	return err
+}
+
+// ScanInt reads an integer token, which may be preceded by a sign.
+// Numbers may be written in any of the forms accepted by Go, such as 0x1F or 1_000.
+// The bitSize is the size of integer which the result must fit into, as in strconv.ParseInt.
+// If the token is not an integer, it will return an error.
+func ScanInt(scan Scanner, bitSize int) (int64, error) {
+	txt, err := scanNumber(scan, true, false)
+	if err != nil {
+		return 0, err
+	}
+	if scan.Tok() != scanner.Int {
+		return 0, Unexpected(scan)
+	}
+	v, err := strconv.ParseInt(txt, 0, bitSize)
+	if err != nil {
+		return 0, wrapToken(numError(err), scan)
+	}
+	return v, nil
+}
+
+// ScanUint reads an unsigned integer token.
+// Numbers may be written in any of the forms accepted by Go, such as 0x1F or 1_000.
+// The bitSize is the size of integer which the result must fit into, as in strconv.ParseUint.
+// If the token is not an unsigned integer, it will return an error.
+func ScanUint(scan Scanner, bitSize int) (uint64, error) {
+	txt, err := scanNumber(scan, false, false)
+	if err != nil {
+		return 0, err
+	}
+	if scan.Tok() != scanner.Int {
+		return 0, Unexpected(scan)
+	}
+	v, err := strconv.ParseUint(txt, 0, bitSize)
+	if err != nil {
+		return 0, wrapToken(numError(err), scan)
+	}
+	return v, nil
+}
+
+// ScanFloat reads a number token, which may be preceded by a sign.
+// Both integers and floating point numbers are accepted.
+// The bitSize is the precision of the result, as in strconv.ParseFloat.
+// If the token is not a number, it will return an error.
+func ScanFloat(scan Scanner, bitSize int) (float64, error) {
+	txt, err := scanNumber(scan, true, false)
+	if err != nil {
+		return 0, err
+	}
+	v, err := strconv.ParseFloat(txt, bitSize)
+	if err != nil {
+		return 0, wrapToken(numError(err), scan)
+	}
+	return v, nil
+}
+
+// ScanBool reads a boolean token, such as true or false.
+// The token may be a string-ish token or an integer, and is parsed by strconv.ParseBool.
+// If the token is not a boolean, it will return an error.
+func ScanBool(scan Scanner) (bool, error) {
+	var txt string
+	switch scan.Tok() {
+	case scanner.Int:
+		txt = scan.Text()
+	default:
+		str, err := ScanString(scan)
+		if err != nil {
+			return false, err
+		}
+		txt = str
+	}
+	v, err := strconv.ParseBool(txt)
+	if err != nil {
+		return false, wrapToken(fmt.Errorf("invalid boolean %q", txt), scan)
+	}
+	return v, nil
+}
+
+// scanUnit reads a number followed by its unit, such as 5s or 10MB, and returns the joined text.
+// A bare number is split from its unit by the scanner, so the unit is read from the next token if it directly follows the number.
+// Values may instead be written as strings, in which case the string is returned.
+// Literals joined by ScanUnits are returned as is.
+func scanUnit(scan Scanner) (string, error) {
+	switch scan.Tok() {
+	case scanner.String, scanner.RawString:
+		return ScanString(scan)
+	}
+	txt, err := scanNumber(scan, true, true)
+	if err != nil {
+		return "", err
+	}
+	if tok := scan.Tok(); tok == Duration || tok == ByteSize {
+		// already joined by ScanUnits
+		return txt, nil
+	}
+	// the scanner splits a unit directly following a number into an identifier, which includes any later numbers (as in 1h30m)
+	if next := peekRune(scan); next == scanner.EOF || !(unicode.IsLetter(next) || next == 'µ') {
+		return txt, nil
+	}
+	if !scan.Next() {
+		if err := scan.Err(); err != nil {
+			return "", err
+		}
+		return txt, nil
+	}
+	return txt + scan.Text(), nil
+}
+
+// ScanDuration reads a duration, such as 5s or 1h30m, in the format accepted by time.ParseDuration.
+// The duration may be written bare or as a string.
+// A bare duration is split into multiple tokens by the scanner, so the Scanner is advanced to the last token of the duration.
+// Duration tokens from ScanUnits are also accepted.
+// If the tokens are not a duration, it will return an error.
+func ScanDuration(scan Scanner) (time.Duration, error) {
+	txt, err := scanUnit(scan)
+	if err != nil {
+		return 0, err
+	}
+	d, err := time.ParseDuration(txt)
+	if err != nil {
+		return 0, WrapPos(err, scan.Pos())
+	}
+	return d, nil
+}
+
+// byteUnits are the multipliers of the units of a byte size, by lowercase name.
+var byteUnits = map[string]float64{
+	"":    1,
+	"b":   1,
+	"kb":  1e3,
+	"mb":  1e6,
+	"gb":  1e9,
+	"tb":  1e12,
+	"pb":  1e15,
+	"eb":  1e18,
+	"kib": 1 << 10,
+	"mib": 1 << 20,
+	"gib": 1 << 30,
+	"tib": 1 << 40,
+	"pib": 1 << 50,
+	"eib": 1 << 60,
+}
+
+// ScanByteSize reads a number of bytes, such as 512, 5MB, or 1.5GiB.
+// The units are case-insensitive, with decimal multiples (kB, MB, GB, TB, PB, EB) and binary multiples (KiB, MiB, GiB, TiB, PiB, EiB).
+// The size may be written bare or as a string, although sizes in exabytes must be quoted as the scanner reads a number followed by E as an exponent.
+// A bare size with a unit is split into multiple tokens by the scanner, so the Scanner is advanced to the unit.
+// ByteSize tokens from ScanUnits are also accepted.
+// If the tokens are not a byte size, it will return an error.
+func ScanByteSize(scan Scanner) (uint64, error) {
+	txt, err := scanUnit(scan)
+	if err != nil {
+		return 0, err
+	}
+	num := strings.TrimRightFunc(txt, unicode.IsLetter)
+	unit := txt[len(num):]
+	mul, ok := byteUnits[strings.ToLower(unit)]
+	if !ok {
+		return 0, WrapPos(fmt.Errorf("unknown byte size unit %q", unit), scan.Pos())
+	}
+	num = strings.TrimSpace(num)
+	if n, err := strconv.ParseUint(num, 0, 64); err == nil {
+		// integers are multiplied exactly
+		if n > math.MaxUint64/uint64(mul) {
+			return 0, WrapPos(fmt.Errorf("byte size %q out of range", txt), scan.Pos())
+		}
+		return n * uint64(mul), nil
+	}
+	f, err := strconv.ParseFloat(num, 64)
+	switch {
+	case err != nil:
+		return 0, WrapPos(fmt.Errorf("invalid byte size %q", txt), scan.Pos())
+	case f < 0:
+		return 0, WrapPos(fmt.Errorf("negative byte size %q", txt), scan.Pos())
+	case f*mul >= math.MaxUint64:
+		return 0, WrapPos(fmt.Errorf("byte size %q out of range", txt), scan.Pos())
+	}
+	return uint64(math.Round(f * mul)), nil
+}
@@ -0,0 +1,143 @@
+package conf
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestScanValues(t *testing.T) {
+	t.Parallel()
+
+	scanInt := func(scan Scanner) (interface{}, error) { return ScanInt(scan, 16) }
+	scanUint := func(scan Scanner) (interface{}, error) { return ScanUint(scan, 8) }
+	scanFloat := func(scan Scanner) (interface{}, error) { return ScanFloat(scan, 64) }
+	scanBool := func(scan Scanner) (interface{}, error) { return ScanBool(scan) }
+	scanDuration := func(scan Scanner) (interface{}, error) { return ScanDuration(scan) }
+	scanByteSize := func(scan Scanner) (interface{}, error) { return ScanByteSize(scan) }
+
+	cases := []struct {
+		name string
+		scan func(Scanner) (interface{}, error)
+
+		// src is the text of the value, which must be the only thing in the input.
+		src string
+
+		// val is the expected value if err is empty.
+		val interface{}
+
+		// err is a substring of the expected error.
+		err string
+	}{
+		{name: "Int", scan: scanInt, src: "42", val: int64(42)},
+		{name: "IntNegative", scan: scanInt, src: "-0x10", val: int64(-16)},
+		{name: "IntPlus", scan: scanInt, src: "+1_000", val: int64(1000)},
+		{name: "IntRange", scan: scanInt, src: "40000", err: `invalid number "40000": value out of range`},
+		{name: "IntFloat", scan: scanInt, src: "1.5", err: "unexpected number 1.5"},
+		{name: "IntWord", scan: scanInt, src: "x", err: `unexpected token "x"`},
+		{name: "IntSignOnly", scan: scanInt, src: "-", err: "missing number after sign"},
+		{name: "Uint", scan: scanUint, src: "255", val: uint64(255)},
+		{name: "UintRange", scan: scanUint, src: "256", err: "value out of range"},
+		{name: "UintNegative", scan: scanUint, src: "-1", err: "unexpected token"},
+		{name: "Float", scan: scanFloat, src: "-2.5e3", val: float64(-2500)},
+		{name: "FloatInt", scan: scanFloat, src: "7", val: float64(7)},
+		{name: "FloatString", scan: scanFloat, src: `"7"`, err: "unexpected string"},
+		{name: "Bool", scan: scanBool, src: "true", val: true},
+		{name: "BoolQuoted", scan: scanBool, src: `"False"`, val: false},
+		{name: "BoolInt", scan: scanBool, src: "1", val: true},
+		{name: "BoolInvalid", scan: scanBool, src: "yes", err: `invalid boolean "yes"`},
+		{name: "Duration", scan: scanDuration, src: "1h30m", val: 90 * time.Minute},
+		{name: "DurationFraction", scan: scanDuration, src: "1.5s", val: 1500 * time.Millisecond},
+		{name: "DurationMicro", scan: scanDuration, src: "5µs", val: 5 * time.Microsecond},
+		{name: "DurationNegative", scan: scanDuration, src: "-2m", val: -2 * time.Minute},
+		{name: "DurationQuoted", scan: scanDuration, src: `"1m 0s"`, err: `unknown unit "m "`},
+		{name: "DurationString", scan: scanDuration, src: `"250ms"`, val: 250 * time.Millisecond},
+		{name: "DurationMissingUnit", scan: scanDuration, src: "5", err: "missing unit"},
+		{name: "DurationUnknownUnit", scan: scanDuration, src: "5y", err: "unknown unit"},
+		{name: "ByteSize", scan: scanByteSize, src: "512", val: uint64(512)},
+		{name: "ByteSizeDecimal", scan: scanByteSize, src: "5MB", val: uint64(5e6)},
+		{name: "ByteSizeBinary", scan: scanByteSize, src: "1.5GiB", val: uint64(3 << 29)},
+		{name: "ByteSizeLowercase", scan: scanByteSize, src: "2kib", val: uint64(2048)},
+		{name: "ByteSizeExa", scan: scanByteSize, src: `"2EiB"`, val: uint64(2 << 60)},
+		{name: "ByteSizeSpaced", scan: scanByteSize, src: `"10 kB"`, val: uint64(10000)},
+		{name: "ByteSizeUnknownUnit", scan: scanByteSize, src: "5QB", err: `unknown byte size unit "QB"`},
+		{name: "ByteSizeRange", scan: scanByteSize, src: "20000000TB", err: "out of range"},
+		{name: "ByteSizeFloatRange", scan: scanByteSize, src: "2e20", err: "out of range"},
+		{name: "ByteSizeNegative", scan: scanByteSize, src: "-1kB", err: `negative byte size "-1kB"`},
+		{name: "ByteSizeInvalid", scan: scanByteSize, src: `"kB"`, err: `invalid byte size "kB"`},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			scan := scanReader(strings.NewReader(c.src), "test.conf")
+			if !scan.Next() {
+				t.Fatalf("failed to scan %q: %v", c.src, scan.Err())
+			}
+			val, err := c.scan(scan)
+			switch {
+			case c.err == "" && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case c.err == "":
+				if val != c.val {
+					t.Errorf("expected %v but got %v", c.val, val)
+				}
+				// The whole value must have been read.
+				if scan.Next() {
+					t.Errorf("unexpected token %q after the value", scan.Text())
+				}
+			case err == nil:
+				t.Errorf("expected an error containing %q but got %v", c.err, val)
+			case !strings.Contains(err.Error(), c.err):
+				t.Errorf("expected an error containing %q but got %q", c.err, err)
+			default:
+				var perr PosErr
+				if !errors.As(err, &perr) {
+					t.Errorf("expected a positioned error but got %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestScanValueInDirective(t *testing.T) {
+	t.Parallel()
+
+	// A duration directly followed by a line break must not join the next line.
+	scan := scanString("timeout 5s\nsize 2 MB\n", "test.conf")
+	var got []string
+	for scan.Next() {
+		switch scan.Text() {
+		case "timeout":
+			if !scan.Next() {
+				t.Fatal(scan.Err())
+			}
+			d, err := ScanDuration(scan)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, d.String())
+		case "size":
+			if !scan.Next() {
+				t.Fatal(scan.Err())
+			}
+			// The unit is separated by a space, so it is not part of the size.
+			n, err := ScanByteSize(scan)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, strconv.FormatUint(n, 10))
+		default:
+			got = append(got, scan.Text())
+		}
+	}
+	if err := scan.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if expect := "5s ; 2 MB ;"; strings.Join(got, " ") != expect {
+		t.Errorf("expected %q but got %q", expect, strings.Join(got, " "))
+	}
+}
@@ -0,0 +1,569 @@
+package conf
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// MarshalYAML converts directives to YAML, using the structure of their JSON encoding (see Directive.MarshalJSON).
+// The YAML is written in block style, with two spaces of indentation.
+func MarshalYAML(dirs []Directive) ([]byte, error) {
+	if dirs == nil {
+		dirs = []Directive{}
+	}
+	dat, err := json.Marshal(dirs)
+	if err != nil {
+		return nil, err
+	}
+	n, err := decodeYAMLNode(json.NewDecoder(bytes.NewReader(dat)))
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	n.writeYAML(&buf, 0)
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
+
+// UnmarshalYAML converts YAML produced by MarshalYAML back into directives.
+// Only a subset of YAML is supported: block mappings and sequences, plain and quoted scalars, literal block scalars (|), comments, and flow collections written in JSON syntax.
+// Anchors, aliases, tags, folded scalars, and multiple documents are not supported.
+func UnmarshalYAML(data []byte) ([]Directive, error) {
+	p := yamlParser{}
+	if err := p.split(string(data)); err != nil {
+		return nil, err
+	}
+	if p.i == len(p.lines) {
+		return []Directive{}, nil
+	}
+	n, err := p.parseBlock(p.lines[p.i].indent)
+	if err != nil {
+		return nil, err
+	}
+	p.skipBlank()
+	if p.i < len(p.lines) {
+		return nil, p.errorf("unexpected indentation")
+	}
+	var buf bytes.Buffer
+	if err := n.writeJSON(&buf); err != nil {
+		return nil, err
+	}
+	var dirs []Directive
+	if err := json.Unmarshal(buf.Bytes(), &dirs); err != nil {
+		return nil, err
+	}
+	if dirs == nil {
+		dirs = []Directive{}
+	}
+	return dirs, nil
+}
+
+// yamlKind is the kind of a yamlNode.
+type yamlKind uint8
+
+const (
+	yamlScalar yamlKind = iota
+	yamlSeq
+	yamlMap
+)
+
+// yamlNode is a value in a YAML document, keeping the order of mapping keys.
+type yamlNode struct {
+	kind yamlKind
+
+	// scalar is the JSON encoding of a scalar.
+	scalar string
+
+	keys  []string
+	elems []yamlNode
+}
+
+// decodeYAMLNode reads a JSON value from a decoder.
+func decodeYAMLNode(dec *json.Decoder) (yamlNode, error) {
+	dec.UseNumber()
+	tok, err := dec.Token()
+	if err != nil {
+		return yamlNode{}, err
+	}
+	switch tok := tok.(type) {
+	case json.Delim:
+		n := yamlNode{kind: yamlSeq}
+		if tok == '{' {
+			n.kind = yamlMap
+		}
+		for dec.More() {
+			if n.kind == yamlMap {
+				key, err := dec.Token()
+				if err != nil {
+					return yamlNode{}, err
+				}
+				n.keys = append(n.keys, key.(string))
+			}
+			elem, err := decodeYAMLNode(dec)
+			if err != nil {
+				return yamlNode{}, err
+			}
+			n.elems = append(n.elems, elem)
+		}
+		if _, err := dec.Token(); err != nil {
+			return yamlNode{}, err
+		}
+		return n, nil
+	default:
+		dat, err := json.Marshal(tok)
+		if err != nil {
+			return yamlNode{}, err
+		}
+		return yamlNode{kind: yamlScalar, scalar: string(dat)}, nil
+	}
+}
+
+// yamlPlainRegexp matches strings which can be written as plain YAML scalars.
+var yamlPlainRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_./-]*$`)
+
+// yamlReserved are plain scalars which YAML parsers may read as something other than a string.
+var yamlReserved = map[string]bool{
+	"true": true, "false": true, "null": true,
+	"yes": true, "no": true, "on": true, "off": true, "y": true, "n": true,
+}
+
+// yamlScalarText converts the JSON encoding of a scalar to YAML.
+func yamlScalarText(scalar string) string {
+	if !strings.HasPrefix(scalar, `"`) {
+		return scalar
+	}
+	var str string
+	if err := json.Unmarshal([]byte(scalar), &str); err != nil {
+		return scalar
+	}
+	if yamlPlainRegexp.MatchString(str) && !yamlReserved[strings.ToLower(str)] {
+		return str
+	}
+	// double-quoted YAML strings use the same escapes as JSON
+	return scalar
+}
+
+// writeYAML writes a node, assuming that the current line is already indented to the given level.
+func (n yamlNode) writeYAML(buf *bytes.Buffer, indent int) {
+	pad := strings.Repeat(" ", indent)
+	switch {
+	case n.kind == yamlScalar:
+		buf.WriteString(yamlScalarText(n.scalar))
+	case len(n.elems) == 0 && n.kind == yamlSeq:
+		buf.WriteString("[]")
+	case len(n.elems) == 0:
+		buf.WriteString("{}")
+	case n.kind == yamlSeq:
+		for i, e := range n.elems {
+			if i > 0 {
+				buf.WriteByte('\n')
+				buf.WriteString(pad)
+			}
+			buf.WriteString("- ")
+			e.writeYAML(buf, indent+2)
+		}
+	default:
+		for i, e := range n.elems {
+			if i > 0 {
+				buf.WriteByte('\n')
+				buf.WriteString(pad)
+			}
+			buf.WriteString(yamlScalarText(strconv.Quote(n.keys[i])))
+			buf.WriteByte(':')
+			if e.kind == yamlScalar || len(e.elems) == 0 {
+				buf.WriteByte(' ')
+				e.writeYAML(buf, indent+2)
+				continue
+			}
+			buf.WriteByte('\n')
+			buf.WriteString(pad + "  ")
+			e.writeYAML(buf, indent+2)
+		}
+	}
+}
+
+// writeJSON writes the node as JSON.
+func (n yamlNode) writeJSON(buf *bytes.Buffer) error {
+	switch n.kind {
+	case yamlScalar:
+		buf.WriteString(n.scalar)
+	case yamlSeq:
+		buf.WriteByte('[')
+		for i, e := range n.elems {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := e.writeJSON(buf); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	case yamlMap:
+		buf.WriteByte('{')
+		for i, e := range n.elems {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			key, err := json.Marshal(n.keys[i])
+			if err != nil {
+				return err
+			}
+			buf.Write(key)
+			buf.WriteByte(':')
+			if err := e.writeJSON(buf); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	}
+	return nil
+}
+
+// yamlLine is a line of a YAML document.
+type yamlLine struct {
+	num int
+
+	// indent is the indentation of the line, or -1 for blank and comment-only lines.
+	indent int
+
+	// text is the content of the line after the indentation, with comments removed.
+	text string
+
+	// raw is the original line.
+	raw string
+}
+
+// yamlParser parses the supported subset of YAML.
+type yamlParser struct {
+	lines []yamlLine
+	i     int
+}
+
+func (p *yamlParser) errorf(format string, args ...interface{}) error {
+	line := 0
+	if p.i < len(p.lines) {
+		line = p.lines[p.i].num
+	} else if len(p.lines) > 0 {
+		line = p.lines[len(p.lines)-1].num
+	}
+	return fmt.Errorf("yaml line %d: %s", line, fmt.Sprintf(format, args...))
+}
+
+// split splits a document into lines.
+func (p *yamlParser) split(doc string) error {
+	for i, raw := range strings.Split(doc, "\n") {
+		raw = strings.TrimSuffix(raw, "\r")
+		text := strings.TrimLeft(raw, " ")
+		if strings.HasPrefix(text, "\t") {
+			return fmt.Errorf("yaml line %d: tabs may not be used for indentation", i+1)
+		}
+		indent := len(raw) - len(text)
+		text = strings.TrimRight(stripYAMLComment(text), " \t")
+		if text == "" || (indent == 0 && text == "---") {
+			// keep blank lines in literal blocks
+			p.lines = append(p.lines, yamlLine{num: i + 1, indent: -1, raw: raw})
+			continue
+		}
+		p.lines = append(p.lines, yamlLine{num: i + 1, indent: indent, text: text, raw: raw})
+	}
+	p.skipBlank()
+	return nil
+}
+
+// skipBlank skips blank lines.
+func (p *yamlParser) skipBlank() {
+	for p.i < len(p.lines) && p.lines[p.i].indent == -1 {
+		p.i++
+	}
+}
+
+// stripYAMLComment removes a comment from the end of a line, outside of quotes.
+func stripYAMLComment(s string) string {
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote == '"' && c == '\\':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || s[i-1] == ' ' || s[i-1] == '\t'):
+			return s[:i]
+		}
+	}
+	return s
+}
+
+// parseBlock parses a block node starting at the current line, which has the given indentation.
+func (p *yamlParser) parseBlock(indent int) (yamlNode, error) {
+	p.skipBlank()
+	if p.i >= len(p.lines) {
+		return yamlNode{}, p.errorf("missing value")
+	}
+	l := p.lines[p.i]
+	switch {
+	case l.text == "-" || strings.HasPrefix(l.text, "- "):
+		return p.parseSeq(indent)
+	case yamlKeyEnd(l.text) != -1:
+		return p.parseMap(indent)
+	default:
+		p.i++
+		return p.parseScalar(l.text, indent)
+	}
+}
+
+// parseSeq parses a block sequence.
+func (p *yamlParser) parseSeq(indent int) (yamlNode, error) {
+	n := yamlNode{kind: yamlSeq, elems: []yamlNode{}}
+	for p.skipBlank(); p.i < len(p.lines); p.skipBlank() {
+		l := p.lines[p.i]
+		if l.indent != indent || !(l.text == "-" || strings.HasPrefix(l.text, "- ")) {
+			break
+		}
+		if l.text == "-" {
+			// the value is on the following lines
+			p.i++
+			elem, err := p.parseNested(indent)
+			if err != nil {
+				return yamlNode{}, err
+			}
+			n.elems = append(n.elems, elem)
+			continue
+		}
+		rest := strings.TrimLeft(l.text[1:], " ")
+		if yamlKeyEnd(rest) == -1 && rest != "-" && !strings.HasPrefix(rest, "- ") {
+			// scalars continue onto lines indented more than the sequence
+			p.i++
+			var elem yamlNode
+			var err error
+			switch rest {
+			case "|", "|-", "|+":
+				elem, err = p.parseLiteral(indent, rest[1:])
+			default:
+				elem, err = p.parseScalar(rest, indent)
+			}
+			if err != nil {
+				return yamlNode{}, err
+			}
+			n.elems = append(n.elems, elem)
+			continue
+		}
+		// treat the rest of the line as though it started on its own line
+		p.lines[p.i].indent += len(l.text) - len(rest)
+		p.lines[p.i].text = rest
+		elem, err := p.parseBlock(p.lines[p.i].indent)
+		if err != nil {
+			return yamlNode{}, err
+		}
+		n.elems = append(n.elems, elem)
+	}
+	return n, nil
+}
+
+// parseMap parses a block mapping.
+func (p *yamlParser) parseMap(indent int) (yamlNode, error) {
+	n := yamlNode{kind: yamlMap}
+	for p.skipBlank(); p.i < len(p.lines); p.skipBlank() {
+		l := p.lines[p.i]
+		if l.indent != indent {
+			break
+		}
+		end := yamlKeyEnd(l.text)
+		if end == -1 {
+			return yamlNode{}, p.errorf("expected a mapping key")
+		}
+		key, err := p.parseKey(l.text[:end])
+		if err != nil {
+			return yamlNode{}, err
+		}
+		for _, k := range n.keys {
+			if k == key {
+				return yamlNode{}, p.errorf("duplicate key %q", key)
+			}
+		}
+		rest := strings.TrimLeft(l.text[end+1:], " ")
+		p.i++
+		var elem yamlNode
+		switch rest {
+		case "":
+			elem, err = p.parseNested(indent)
+		case "|", "|-", "|+":
+			elem, err = p.parseLiteral(indent, rest[1:])
+		default:
+			elem, err = p.parseScalar(rest, indent)
+		}
+		if err != nil {
+			return yamlNode{}, err
+		}
+		n.keys = append(n.keys, key)
+		n.elems = append(n.elems, elem)
+	}
+	return n, nil
+}
+
+// parseNested parses a value on the lines after its key or sequence entry, which have the given indentation.
+func (p *yamlParser) parseNested(indent int) (yamlNode, error) {
+	p.skipBlank()
+	if p.i >= len(p.lines) || p.lines[p.i].indent < indent {
+		return yamlNode{kind: yamlScalar, scalar: "null"}, nil
+	}
+	l := p.lines[p.i]
+	if l.indent == indent {
+		// sequences may be at the same indentation as their key
+		if l.text == "-" || strings.HasPrefix(l.text, "- ") {
+			return p.parseSeq(indent)
+		}
+		return yamlNode{kind: yamlScalar, scalar: "null"}, nil
+	}
+	return p.parseBlock(l.indent)
+}
+
+// parseLiteral parses a literal block scalar following a key with the given indentation.
+func (p *yamlParser) parseLiteral(indent int, chomp string) (yamlNode, error) {
+	var lines []string
+	blockIndent := -1
+	for ; p.i < len(p.lines); p.i++ {
+		raw := p.lines[p.i].raw
+		if strings.TrimSpace(raw) == "" {
+			lines = append(lines, "")
+			continue
+		}
+		// comments are part of the text of the block, so the indentation is taken from the raw line
+		rawIndent := len(raw) - len(strings.TrimLeft(raw, " "))
+		if rawIndent <= indent {
+			break
+		}
+		if blockIndent == -1 {
+			blockIndent = rawIndent
+		}
+		if rawIndent < blockIndent {
+			return yamlNode{}, p.errorf("literal block line is indented less than the first line")
+		}
+		lines = append(lines, raw[blockIndent:])
+	}
+	str := strings.Join(lines, "\n")
+	switch chomp {
+	case "-":
+		str = strings.TrimRight(str, "\n")
+	case "+":
+		str += "\n"
+	default:
+		str = strings.TrimRight(str, "\n") + "\n"
+	}
+	dat, err := json.Marshal(str)
+	if err != nil {
+		return yamlNode{}, err
+	}
+	return yamlNode{kind: yamlScalar, scalar: string(dat)}, nil
+}
+
+// yamlKeyEnd finds the colon ending the key of a mapping entry on a line, or returns -1 if the line is not a mapping entry.
+func yamlKeyEnd(s string) int {
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote == '"' && c == '\\':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case i == 0 && (c == '"' || c == '\''):
+			quote = c
+		case i == 0 && (c == '[' || c == '{'):
+			// flow collection
+			return -1
+		case c == ':' && (i == len(s)-1 || s[i+1] == ' '):
+			return i
+		}
+	}
+	return -1
+}
+
+// parseKey parses the key of a mapping entry.
+func (p *yamlParser) parseKey(s string) (string, error) {
+	n, err := p.scalar(strings.TrimRight(s, " "))
+	if err != nil {
+		return "", err
+	}
+	var key interface{}
+	if err := json.Unmarshal([]byte(n.scalar), &key); err != nil || n.kind != yamlScalar {
+		return "", p.errorf("invalid key %q", s)
+	}
+	if str, ok := key.(string); ok {
+		return str, nil
+	}
+	return strings.TrimRight(s, " "), nil
+}
+
+// yamlNumberRegexp matches plain scalars which are numbers.
+var yamlNumberRegexp = regexp.MustCompile(`^-?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][-+]?[0-9]+)?$`)
+
+// parseScalar parses a scalar or flow collection starting on the previous line, which is a value at the given indentation.
+// Plain scalars may continue onto more indented lines.
+func (p *yamlParser) parseScalar(s string, indent int) (yamlNode, error) {
+	if !strings.ContainsAny(s[:1], `"'[{&*!>`) {
+		for p.skipBlank(); p.i < len(p.lines) && p.lines[p.i].indent > indent; p.skipBlank() {
+			next := p.lines[p.i].text
+			if yamlKeyEnd(next) != -1 || next == "-" || strings.HasPrefix(next, "- ") {
+				// not a continuation
+				break
+			}
+			s += " " + next
+			p.i++
+		}
+	}
+	return p.scalar(s)
+}
+
+// scalar parses a scalar or flow collection.
+func (p *yamlParser) scalar(s string) (yamlNode, error) {
+	switch {
+	case strings.HasPrefix(s, `"`):
+		var str string
+		if err := json.Unmarshal([]byte(s), &str); err != nil {
+			return yamlNode{}, p.errorf("invalid double-quoted string %s", s)
+		}
+		return yamlNode{kind: yamlScalar, scalar: s}, nil
+	case strings.HasPrefix(s, "'"):
+		if len(s) < 2 || !strings.HasSuffix(s, "'") {
+			return yamlNode{}, p.errorf("invalid single-quoted string %s", s)
+		}
+		str := strings.Replace(s[1:len(s)-1], "''", "'", -1)
+		dat, err := json.Marshal(str)
+		if err != nil {
+			return yamlNode{}, err
+		}
+		return yamlNode{kind: yamlScalar, scalar: string(dat)}, nil
+	case strings.HasPrefix(s, "[") || strings.HasPrefix(s, "{"):
+		n, err := decodeYAMLNode(json.NewDecoder(strings.NewReader(s)))
+		if err != nil || !json.Valid([]byte(s)) {
+			return yamlNode{}, p.errorf("flow collections must be written in JSON syntax")
+		}
+		return n, nil
+	case strings.HasPrefix(s, "&") || strings.HasPrefix(s, "*") || strings.HasPrefix(s, "!") || strings.HasPrefix(s, ">"):
+		return yamlNode{}, p.errorf("unsupported YAML syntax %q", s)
+	}
+	switch {
+	case s == "null" || s == "~":
+		return yamlNode{kind: yamlScalar, scalar: "null"}, nil
+	case s == "true" || s == "false":
+		return yamlNode{kind: yamlScalar, scalar: s}, nil
+	case yamlNumberRegexp.MatchString(s):
+		return yamlNode{kind: yamlScalar, scalar: s}, nil
+	}
+	dat, err := json.Marshal(s)
+	if err != nil {
+		return yamlNode{}, err
+	}
+	return yamlNode{kind: yamlScalar, scalar: string(dat)}, nil
+}
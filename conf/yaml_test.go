@@ -0,0 +1,88 @@
+package conf
+
+import (
+	"testing"
+)
+
+func TestYAMLRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name string
+		src  string
+	}{
+		{
+			name: "Empty",
+			src:  "",
+		},
+		{
+			name: "Values",
+			src:  "listen localhost 8080 -1 2.5 \"hello world\" \"\" \"123\" \"- x\" \"a: b\" \"#\"\n",
+		},
+		{
+			name: "Blocks",
+			src:  "server {\n    listen 80\n    location \"/\" {\n        root x\n    }\n    empty {}\n}\n",
+		},
+		{
+			name: "Heredoc",
+			src:  "desc <<EOF\n    first\n\n      indented\n    last\n    EOF\n",
+		},
+		{
+			name: "Brackets",
+			src:  "type []string\n",
+		},
+		{
+			name: "Comments",
+			src:  "// doc\nport 80 // line\nhost {\n    // inner\n    name x\n}\n",
+		},
+		{
+			name: "NoArgs",
+			src:  "enable\n",
+		},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			dirs := parseString(t, c.src)
+			yaml, err := MarshalYAML(dirs)
+			if err != nil {
+				t.Fatalf("failed to marshal YAML: %v", err)
+			}
+			decoded, err := UnmarshalYAML(yaml)
+			if err != nil {
+				t.Fatalf("failed to unmarshal YAML %q: %v", yaml, err)
+			}
+
+			expect, err := Marshal(dirs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := Marshal(decoded)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != string(expect) {
+				t.Errorf("round trip through %q changed %q to %q", yaml, expect, got)
+			}
+		})
+	}
+}
+
+func TestUnmarshalYAMLErrors(t *testing.T) {
+	t.Parallel()
+
+	for _, src := range []string{
+		"- name: a\n  args: &anchor [1]\n",
+		"- name: a\n   args: [1]\n",
+		"- name: [\n",
+		"- args: [1]\n",
+		"name: a\n",
+		"- name: a\n  args: >\n    folded\n",
+	} {
+		if dirs, err := UnmarshalYAML([]byte(src)); err == nil {
+			t.Errorf("expected an error from %q but got %v", src, dirs)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package cpu
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// CacheType is the type of data held by a cache.
+type CacheType string
+
+const (
+	// DataCache holds only data.
+	DataCache CacheType = "Data"
+
+	// InstructionCache holds only instructions.
+	InstructionCache CacheType = "Instruction"
+
+	// UnifiedCache holds both data and instructions.
+	UnifiedCache CacheType = "Unified"
+)
+
+// Cache describes a CPU cache used by a core.
+type Cache struct {
+	// Level is the level of the cache, starting at 1 for the caches closest to the core.
+	Level int `json:"level"`
+
+	// Type is the type of data held by the cache.
+	Type CacheType `json:"type"`
+
+	// Size is the size of the cache in bytes.
+	Size int `json:"size"`
+
+	// LineSize is the size of a cache line in bytes.
+	LineSize int `json:"lineSize"`
+
+	// Ways is the associativity of the cache.
+	// This is 0 if it is not known.
+	Ways int `json:"ways"`
+
+	// Shared is the list of cores which share the cache, including the core itself.
+	Shared []Core `json:"shared"`
+}
+
+// Caches lists the caches used by the core, ordered by level.
+// The caches are read from sysfs, and if the OS does not describe them, the list is empty.
+func (c Core) Caches() ([]Cache, error) {
+	t, err := loadTopology()
+	if err != nil {
+		return nil, err
+	}
+
+	return t.loadCaches(c)
+}
+
+// readCaches reads the caches used by the core from sysfs.
+func (c Core) readCaches() ([]Cache, error) {
+	dirs, err := filepath.Glob(filepath.Join(sysCPU, c.String(), "cache", "index*"))
+	if err != nil {
+		return nil, err
+	}
+
+	caches := make([]Cache, 0, len(dirs))
+	for _, dir := range dirs {
+		cache, err := readCache(dir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read cache %s of %v: %w", filepath.Base(dir), c, err)
+		}
+
+		caches = append(caches, cache)
+	}
+	sort.SliceStable(caches, func(i, j int) bool {
+		return caches[i].Level < caches[j].Level
+	})
+
+	return caches, nil
+}
+
+// Cache finds the data or unified cache used by the core at the specified level.
+// If there is no such cache, the last return is false.
+func (c Core) Cache(level int) (Cache, bool, error) {
+	caches, err := c.Caches()
+	if err != nil {
+		return Cache{}, false, err
+	}
+
+	for _, cache := range caches {
+		if cache.Level == level && cache.Type != InstructionCache {
+			return cache, true, nil
+		}
+	}
+
+	return Cache{}, false, nil
+}
+
+// readCache reads the description of a cache from a sysfs directory.
+func readCache(dir string) (Cache, error) {
+	read := func(name string) (string, error) {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return "", err
+		}
+
+		return strings.TrimSpace(string(data)), nil
+	}
+
+	var cache Cache
+	level, err := read("level")
+	if err != nil {
+		return Cache{}, err
+	}
+	cache.Level, err = strconv.Atoi(level)
+	if err != nil {
+		return Cache{}, fmt.Errorf("invalid level: %w", err)
+	}
+
+	typ, err := read("type")
+	if err != nil {
+		return Cache{}, err
+	}
+	cache.Type = CacheType(typ)
+
+	size, err := read("size")
+	if err != nil {
+		return Cache{}, err
+	}
+	cache.Size, err = parseSize(size)
+	if err != nil {
+		return Cache{}, err
+	}
+
+	line, err := read("coherency_line_size")
+	if err != nil {
+		return Cache{}, err
+	}
+	cache.LineSize, err = strconv.Atoi(line)
+	if err != nil {
+		return Cache{}, fmt.Errorf("invalid line size: %w", err)
+	}
+
+	// The associativity is not reported on some platforms.
+	if ways, err := read("ways_of_associativity"); err == nil {
+		cache.Ways, _ = strconv.Atoi(ways)
+	}
+
+	shared, err := read("shared_cpu_list")
+	if err != nil {
+		return Cache{}, err
+	}
+	cache.Shared, err = parseCPUList(shared)
+	if err != nil {
+		return Cache{}, err
+	}
+
+	return cache, nil
+}
+
+// parseSize parses a size in the format used by sysfs, such as "48K".
+func parseSize(str string) (int, error) {
+	mul := 1
+	switch {
+	case strings.HasSuffix(str, "K"):
+		mul = 1 << 10
+	case strings.HasSuffix(str, "M"):
+		mul = 1 << 20
+	case strings.HasSuffix(str, "G"):
+		mul = 1 << 30
+	}
+	if mul != 1 {
+		str = str[:len(str)-1]
+	}
+
+	n, err := strconv.Atoi(str)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q", str)
+	}
+
+	return n * mul, nil
+}
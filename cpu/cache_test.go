@@ -0,0 +1,53 @@
+package cpu
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCaches(t *testing.T) {
+	fakeSysfs(t, map[string]string{
+		"cpu0/cache/index0/level":                 "1",
+		"cpu0/cache/index0/type":                  "Data",
+		"cpu0/cache/index0/size":                  "48K",
+		"cpu0/cache/index0/coherency_line_size":   "64",
+		"cpu0/cache/index0/ways_of_associativity": "12",
+		"cpu0/cache/index0/shared_cpu_list":       "0,2",
+		"cpu0/cache/index1/level":                 "1",
+		"cpu0/cache/index1/type":                  "Instruction",
+		"cpu0/cache/index1/size":                  "32K",
+		"cpu0/cache/index1/coherency_line_size":   "64",
+		"cpu0/cache/index1/shared_cpu_list":       "0,2",
+		"cpu0/cache/index2/level":                 "3",
+		"cpu0/cache/index2/type":                  "Unified",
+		"cpu0/cache/index2/size":                  "30M",
+		"cpu0/cache/index2/coherency_line_size":   "64",
+		"cpu0/cache/index2/shared_cpu_list":       "0-3",
+	})
+
+	caches, err := Core{index: 0}.Caches()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []Cache{
+		{Level: 1, Type: DataCache, Size: 48 << 10, LineSize: 64, Ways: 12, Shared: []Core{{0}, {2}}},
+		{Level: 1, Type: InstructionCache, Size: 32 << 10, LineSize: 64, Shared: []Core{{0}, {2}}},
+		{Level: 3, Type: UnifiedCache, Size: 30 << 20, LineSize: 64, Shared: []Core{{0}, {1}, {2}, {3}}},
+	}
+	if !reflect.DeepEqual(caches, expect) {
+		t.Errorf("expected caches %v but got %v", expect, caches)
+	}
+
+	if cache, ok, err := (Core{index: 0}).Cache(3); err != nil || !ok || cache.Size != 30<<20 {
+		t.Errorf("failed to find L3 cache: %v (%v)", cache, err)
+	}
+	if _, ok, err := (Core{index: 0}).Cache(2); err != nil || ok {
+		t.Errorf("found missing L2 cache (%v)", err)
+	}
+
+	// Without cache information, the list is empty.
+	caches, err = Core{index: 1}.Caches()
+	if err != nil || len(caches) != 0 {
+		t.Errorf("expected no caches but got %v (%v)", caches, err)
+	}
+}
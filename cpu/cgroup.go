@@ -0,0 +1,218 @@
+package cpu
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// procSelfCgroup lists the cgroups of the process, and sysCgroup is where the cgroup hierarchies are mounted.
+// These are variables so that tests can substitute fake files.
+var (
+	procSelfCgroup = "/proc/self/cgroup"
+	sysCgroup      = "/sys/fs/cgroup"
+)
+
+// ListAllowedCores lists the cores on the current machine which the process is allowed to use.
+// Unlike ListCores, this excludes cores outside of the affinity mask of the process (as set by taskset), or outside of the cpuset of its cgroup (as set by container runtimes).
+// If the cgroup has a CPU quota, the list is truncated to the number of cores which the quota can keep busy, rounded up.
+// Both cgroup v1 and v2 are supported, and if the process is not in a cgroup, only the affinity mask applies.
+func ListAllowedCores() ([]Core, error) {
+	cores, err := ListCores()
+	if err != nil {
+		return nil, err
+	}
+
+	// Get the affinity mask of the main thread, which is inherited from the parent process.
+	// This ignores Run calls on other threads.
+	var mask unix.CPUSet
+	if err := unix.SchedGetaffinity(os.Getpid(), &mask); err != nil {
+		return nil, fmt.Errorf("failed to load CPU mask: %w", err)
+	}
+
+	cpuset, err := cgroupCPUSet()
+	if err != nil {
+		return nil, err
+	}
+	inSet := make(map[Core]bool, len(cpuset))
+	for _, c := range cpuset {
+		inSet[c] = true
+	}
+
+	allowed := cores[:0]
+	for _, c := range cores {
+		if mask.IsSet(int(c.index)) && (cpuset == nil || inSet[c]) {
+			allowed = append(allowed, c)
+		}
+	}
+
+	quota, ok, err := CPUQuota()
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		if n := int(math.Ceil(quota)); n < len(allowed) {
+			allowed = allowed[:n]
+		}
+	}
+
+	return allowed, nil
+}
+
+// CPUQuota returns the number of cores worth of CPU time which the cgroup of the process may use.
+// If there is no quota, the second return is false.
+func CPUQuota() (float64, bool, error) {
+	groups, err := readCgroups()
+	if err != nil {
+		return 0, false, err
+	}
+
+	if path, ok := groups[""]; ok {
+		// cgroup v2 stores the quota and period together.
+		max, err := readCgroupFile("", path, "cpu.max")
+		switch {
+		case os.IsNotExist(err):
+		case err != nil:
+			return 0, false, err
+		default:
+			fields := strings.Fields(max)
+			if len(fields) != 2 {
+				return 0, false, fmt.Errorf("invalid cpu.max %q", max)
+			}
+			if fields[0] == "max" {
+				return 0, false, nil
+			}
+			return parseQuota(fields[0], fields[1])
+		}
+	}
+
+	if path, ok := groups["cpu"]; ok {
+		quota, err := readCgroupFile("cpu", path, "cpu.cfs_quota_us")
+		if os.IsNotExist(err) {
+			return 0, false, nil
+		} else if err != nil {
+			return 0, false, err
+		}
+		if quota == "-1" {
+			return 0, false, nil
+		}
+		period, err := readCgroupFile("cpu", path, "cpu.cfs_period_us")
+		if err != nil {
+			return 0, false, err
+		}
+		return parseQuota(quota, period)
+	}
+
+	return 0, false, nil
+}
+
+// parseQuota parses a CPU quota and period, in microseconds.
+func parseQuota(quota, period string) (float64, bool, error) {
+	q, err := strconv.ParseUint(quota, 10, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("invalid CPU quota %q", quota)
+	}
+	p, err := strconv.ParseUint(period, 10, 64)
+	if err != nil || p == 0 {
+		return 0, false, fmt.Errorf("invalid CPU period %q", period)
+	}
+
+	return float64(q) / float64(p), true, nil
+}
+
+// cgroupCPUSet reads the cores in the cpuset of the cgroup of the process.
+// If the process is not restricted by a cpuset, this returns nil.
+func cgroupCPUSet() ([]Core, error) {
+	groups, err := readCgroups()
+	if err != nil {
+		return nil, err
+	}
+
+	// On a hybrid hierarchy, the process is in both a cgroup v2 group and cgroup v1 groups, and the cpuset controller is usually only in v1.
+	var list string
+	err = os.ErrNotExist
+	if path, ok := groups[""]; ok {
+		list, err = readCgroupFile("", path, "cpuset.cpus.effective")
+	}
+	if path, ok := groups["cpuset"]; ok && os.IsNotExist(err) {
+		list, err = readCgroupFile("cpuset", path, "cpuset.effective_cpus")
+		if os.IsNotExist(err) {
+			list, err = readCgroupFile("cpuset", path, "cpuset.cpus")
+		}
+	}
+	switch {
+	case os.IsNotExist(err):
+		return nil, nil
+	case err != nil:
+		return nil, err
+	}
+
+	cores, err := parseCPUList(list)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse cpuset: %w", err)
+	}
+	if cores == nil {
+		// An empty effective cpuset means that the cpuset is inherited.
+		return nil, nil
+	}
+
+	return cores, nil
+}
+
+// readCgroups reads the cgroup paths of the process, indexed by controller.
+// The path of the cgroup v2 hierarchy is indexed by an empty string.
+// If the process is not in any cgroups, this returns an empty map.
+func readCgroups() (map[string]string, error) {
+	f, err := os.Open(procSelfCgroup)
+	if os.IsNotExist(err) {
+		return map[string]string{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	// Each line is formatted as "id:controllers:path".
+	groups := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.SplitN(scanner.Text(), ":", 3)
+		if len(fields) != 3 {
+			continue
+		}
+
+		if fields[0] == "0" && fields[1] == "" {
+			groups[""] = fields[2]
+			continue
+		}
+		for _, controller := range strings.Split(fields[1], ",") {
+			groups[controller] = fields[2]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return groups, nil
+}
+
+// readCgroupFile reads a file of a cgroup, with surrounding whitespace removed.
+// The controller is empty for cgroup v2.
+// Inside of a cgroup namespace (as in most containers), the cgroup of the process is mounted as the root, so that is tried if the full path does not exist.
+func readCgroupFile(controller, path, name string) (string, error) {
+	root := filepath.Join(sysCgroup, controller)
+	data, err := os.ReadFile(filepath.Join(root, path, name))
+	if os.IsNotExist(err) && path != "/" {
+		data, err = os.ReadFile(filepath.Join(root, name))
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(data)), nil
+}
@@ -0,0 +1,136 @@
+package cpu
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// fakeCgroups replaces the cgroup files with a temporary directory, populated with the specified files.
+// The /proc/self/cgroup file is named "self".
+func fakeCgroups(t *testing.T, files map[string]string) {
+	dir := t.TempDir()
+	for path, data := range files {
+		path = filepath.Join(dir, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	oldSelf, oldSys := procSelfCgroup, sysCgroup
+	procSelfCgroup, sysCgroup = filepath.Join(dir, "self"), dir
+	t.Cleanup(func() { procSelfCgroup, sysCgroup = oldSelf, oldSys })
+}
+
+func TestCgroups(t *testing.T) {
+	t.Run("V2", func(t *testing.T) {
+		fakeCgroups(t, map[string]string{
+			"self": "0::/system.slice/app.service",
+			"system.slice/app.service/cpuset.cpus.effective": "0-1,4",
+			"system.slice/app.service/cpu.max":               "150000 100000",
+		})
+
+		cpuset, err := cgroupCPUSet()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expect := []Core{{0}, {1}, {4}}; !reflect.DeepEqual(cpuset, expect) {
+			t.Errorf("expected cpuset %v but got %v", expect, cpuset)
+		}
+		if quota, ok, err := CPUQuota(); err != nil || !ok || quota != 1.5 {
+			t.Errorf("expected quota 1.5 but got %v (%v, %v)", quota, ok, err)
+		}
+	})
+
+	t.Run("V2Namespace", func(t *testing.T) {
+		// Inside of a cgroup namespace, the cgroup is mounted at the root.
+		fakeCgroups(t, map[string]string{
+			"self":                  "0::/",
+			"cpuset.cpus.effective": "2",
+			"cpu.max":               "max 100000",
+		})
+
+		cpuset, err := cgroupCPUSet()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expect := []Core{{2}}; !reflect.DeepEqual(cpuset, expect) {
+			t.Errorf("expected cpuset %v but got %v", expect, cpuset)
+		}
+		if quota, ok, err := CPUQuota(); err != nil || ok {
+			t.Errorf("expected no quota but got %v (%v)", quota, err)
+		}
+	})
+
+	t.Run("V1", func(t *testing.T) {
+		fakeCgroups(t, map[string]string{
+			"self": "12:cpuset:/docker/abc\n4:cpu,cpuacct:/docker/abc\n1:name=systemd:/docker/abc",
+			"cpuset/docker/abc/cpuset.effective_cpus": "3",
+			"cpu/docker/abc/cpu.cfs_quota_us":         "200000",
+			"cpu/docker/abc/cpu.cfs_period_us":        "100000",
+		})
+
+		cpuset, err := cgroupCPUSet()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expect := []Core{{3}}; !reflect.DeepEqual(cpuset, expect) {
+			t.Errorf("expected cpuset %v but got %v", expect, cpuset)
+		}
+		if quota, ok, err := CPUQuota(); err != nil || !ok || quota != 2 {
+			t.Errorf("expected quota 2 but got %v (%v, %v)", quota, ok, err)
+		}
+	})
+
+	t.Run("Hybrid", func(t *testing.T) {
+		// systemd's hybrid hierarchy mounts cgroup v2 without any controllers at unified/, alongside the v1 controllers.
+		fakeCgroups(t, map[string]string{
+			"self":                             "12:cpuset:/docker/abc\n4:cpu,cpuacct:/docker/abc\n1:name=systemd:/docker/abc\n0::/docker/abc",
+			"unified/docker/abc/cgroup.procs":  "1",
+			"cpuset/docker/abc/cpuset.cpus":    "1-2",
+			"cpu/docker/abc/cpu.cfs_quota_us":  "50000",
+			"cpu/docker/abc/cpu.cfs_period_us": "100000",
+		})
+
+		cpuset, err := cgroupCPUSet()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expect := []Core{{1}, {2}}; !reflect.DeepEqual(cpuset, expect) {
+			t.Errorf("expected cpuset %v but got %v", expect, cpuset)
+		}
+		if quota, ok, err := CPUQuota(); err != nil || !ok || quota != 0.5 {
+			t.Errorf("expected quota 0.5 but got %v (%v, %v)", quota, ok, err)
+		}
+	})
+
+	t.Run("None", func(t *testing.T) {
+		fakeCgroups(t, nil)
+
+		if cpuset, err := cgroupCPUSet(); err != nil || cpuset != nil {
+			t.Errorf("expected no cpuset but got %v (%v)", cpuset, err)
+		}
+		if quota, ok, err := CPUQuota(); err != nil || ok {
+			t.Errorf("expected no quota but got %v (%v)", quota, err)
+		}
+	})
+}
+
+func TestListAllowedCores(t *testing.T) {
+	// The process is always allowed to use at least one core.
+	cores, err := ListAllowedCores()
+	if err != nil {
+		t.Fatal(err)
+	}
+	all, err := ListCores()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cores) == 0 || len(cores) > len(all) {
+		t.Errorf("listed %d allowed cores out of %d", len(cores), len(all))
+	}
+}
@@ -1,6 +1,7 @@
 package cpu
 
 import (
+	"errors"
 	"fmt"
 	"runtime"
 
@@ -8,13 +9,72 @@ import (
 )
 
 // Core is a unique identifier for a CPU core.
-// BUGS: this may become invalid if the process is migrated to another machine.
+// A core may be taken offline (CPU hotplug), after which it can not be used until it is brought back online.
+// Watch can be used to detect this.
 type Core struct {
 	index uint16 // currerntly limited to 1024 by the OS
 }
 
 // Run a series of functions on this CPU core.
-func (c Core) Run(ch <-chan func(Core)) (err error) {
+func (c Core) Run(ch <-chan func(Core)) error {
+	var mask unix.CPUSet
+	mask.Set(int(c.index))
+	err := runPinned(&mask, func() {
+		for f := range ch {
+			f(c)
+		}
+	})
+
+	return checkOffline([]Core{c}, err)
+}
+
+// Do calls a function on this CPU core, and returns its error.
+// Unlike Run, this does not require a channel for a single call.
+func Do(c Core, fn func() error) error {
+	return DoOnAny([]Core{c}, fn)
+}
+
+// DoOnAny calls a function on any of the specified cores, and returns its error.
+// The OS may move the function between the cores while it runs.
+func DoOnAny(cores []Core, fn func() error) error {
+	if len(cores) == 0 {
+		return errors.New("cannot run on an empty set of cores")
+	}
+
+	set := MakeCoreSet(cores...)
+	var ferr error
+	err := runPinned(&set.mask, func() {
+		ferr = fn()
+	})
+	if err != nil {
+		return checkOffline(cores, err)
+	}
+
+	return ferr
+}
+
+// checkOffline replaces an error from pinning to cores with ErrOffline if none of the cores are online.
+func checkOffline(cores []Core, err error) error {
+	if !errors.Is(err, unix.EINVAL) {
+		return err
+	}
+
+	// The kernel rejects a mask without any online cores.
+	for _, c := range cores {
+		online, oerr := c.Online()
+		if oerr != nil || online {
+			return err
+		}
+	}
+	if len(cores) == 1 {
+		return fmt.Errorf("failed to run on %v: %w", cores[0], ErrOffline)
+	}
+
+	return fmt.Errorf("failed to run on %v: %w", MakeCoreSet(cores...), ErrOffline)
+}
+
+// runPinned runs a function on the current thread, pinned to the cores in a mask.
+func runPinned(mask *unix.CPUSet, fn func()) (err error) {
 	runtime.LockOSThread()
 	defer runtime.UnlockOSThread()
 
@@ -25,10 +85,8 @@ func (c Core) Run(ch <-chan func(Core)) (err error) {
 		return fmt.Errorf("failed to load old CPU mask: %w", err)
 	}
 
-	// Pin to the core.
-	var newmask unix.CPUSet
-	newmask.Set(int(c.index))
-	err = unix.SchedSetaffinity(0, &newmask)
+	// Pin to the cores.
+	err = unix.SchedSetaffinity(0, mask)
 	if err != nil {
 		return fmt.Errorf("failed to load new CPU mask: %w", err)
 	}
@@ -37,27 +95,22 @@ func (c Core) Run(ch <-chan func(Core)) (err error) {
 	defer func() {
 		rerr := unix.SchedSetaffinity(0, &oldmask)
 		if rerr != nil {
-			err = fmt.Errorf("failed to load new CPU mask: %w", rerr)
+			err = fmt.Errorf("failed to restore old CPU mask: %w", rerr)
 		}
 	}()
 
-	for f := range ch {
-		f(c)
-	}
+	fn()
 
 	return nil
 }
 
-// ListCores lists the available CPU cores on the current machine.
+// ListCores lists the online CPU cores on the current machine.
+// The list is cached until the set of online cores changes.
 func ListCores() ([]Core, error) {
-	// TODO: make this more robust
-	// TODO: NUMA?
-	// TODO: big.LITTLE?
-	cores := make([]Core, runtime.NumCPU())
-	for i := range cores {
-		cores[i] = Core{
-			index: uint16(i),
-		}
+	t, err := loadTopology()
+	if err != nil {
+		return nil, err
 	}
-	return cores, nil
+
+	return append([]Core(nil), t.cores...), nil
 }
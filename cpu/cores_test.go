@@ -29,3 +29,29 @@ func TestCores(t *testing.T) {
 		t.Fatalf("listed %d cores but found %d cores", len(cores), len(coresFound))
 	}
 }
+
+func TestCurrentCore(t *testing.T) {
+	cores, err := ListCores()
+	if err != nil {
+		t.Fatalf("failed to enumerate cores: %v", err)
+	}
+	for _, c := range cores {
+		var current, syscall Core
+		ch := make(chan func(Core), 1)
+		ch <- func(_ Core) {
+			current = CurrentCore()
+			syscall = getcpu()
+		}
+		close(ch)
+		err = c.Run(ch)
+		if err != nil {
+			t.Fatalf("failed to run on %v: %v", c, err)
+		}
+		if current != c {
+			t.Errorf("expected to run on %v but CurrentCore returned %v", c, current)
+		}
+		if syscall != c {
+			t.Errorf("expected to run on %v but getcpu returned %v", c, syscall)
+		}
+	}
+}
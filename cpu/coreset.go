@@ -0,0 +1,156 @@
+package cpu
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// CoreSet is a set of CPU cores.
+// The zero value is an empty set.
+type CoreSet struct {
+	mask unix.CPUSet
+}
+
+// MakeCoreSet makes a CoreSet containing the specified cores.
+func MakeCoreSet(cores ...Core) CoreSet {
+	var s CoreSet
+	for _, c := range cores {
+		s.Add(c)
+	}
+
+	return s
+}
+
+// Add a core to the set.
+func (s *CoreSet) Add(c Core) {
+	s.mask.Set(int(c.index))
+}
+
+// Remove a core from the set.
+func (s *CoreSet) Remove(c Core) {
+	s.mask.Clear(int(c.index))
+}
+
+// Has checks whether the set contains a core.
+func (s CoreSet) Has(c Core) bool {
+	return s.mask.IsSet(int(c.index))
+}
+
+// Len returns the number of cores in the set.
+func (s CoreSet) Len() int {
+	return s.mask.Count()
+}
+
+// Cores lists the cores in the set, in order.
+func (s CoreSet) Cores() []Core {
+	cores := make([]Core, 0, s.Len())
+	for i := 0; i < 8*int(unsafe.Sizeof(s.mask)); i++ {
+		if s.mask.IsSet(i) {
+			cores = append(cores, Core{index: uint16(i)})
+		}
+	}
+
+	return cores
+}
+
+// Union returns the set of cores which are in either set.
+func (s CoreSet) Union(other CoreSet) CoreSet {
+	for i := range s.mask {
+		s.mask[i] |= other.mask[i]
+	}
+
+	return s
+}
+
+// Intersect returns the set of cores which are in both sets.
+func (s CoreSet) Intersect(other CoreSet) CoreSet {
+	for i := range s.mask {
+		s.mask[i] &= other.mask[i]
+	}
+
+	return s
+}
+
+func (s CoreSet) String() string {
+	cores := s.Cores()
+	strs := make([]string, len(cores))
+	for i, c := range cores {
+		strs[i] = strconv.Itoa(int(c.index))
+	}
+
+	return "{" + strings.Join(strs, ",") + "}"
+}
+
+// Run a series of functions on the cores in this set.
+// The functions run on a single thread, which the OS may move between the cores.
+func (s CoreSet) Run(ch <-chan func(CoreSet)) error {
+	if s.Len() == 0 {
+		return fmt.Errorf("cannot run on an empty set of cores")
+	}
+
+	return runPinned(&s.mask, func() {
+		for f := range ch {
+			f(s)
+		}
+	})
+}
+
+// ProcessAffinity returns the set of cores which the main thread of the process may run on.
+func ProcessAffinity() (CoreSet, error) {
+	var s CoreSet
+	if err := unix.SchedGetaffinity(os.Getpid(), &s.mask); err != nil {
+		return CoreSet{}, fmt.Errorf("failed to load CPU mask: %w", err)
+	}
+
+	return s, nil
+}
+
+// Apply restricts the entire process to the cores in this set.
+// Every existing thread is pinned to the set, and threads created later inherit it.
+// The returned function restores the previous affinity of the main thread to every thread.
+// Threads pinned by Run are also affected, and are restored to their previous affinity when they finish.
+func (s CoreSet) Apply() (restore func() error, err error) {
+	if s.Len() == 0 {
+		return nil, fmt.Errorf("cannot apply an empty set of cores")
+	}
+
+	old, err := ProcessAffinity()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.apply(); err != nil {
+		return nil, err
+	}
+
+	return old.apply, nil
+}
+
+// apply sets the affinity of every thread in the process.
+func (s CoreSet) apply() error {
+	tasks, err := os.ReadDir("/proc/self/task")
+	if err != nil {
+		return fmt.Errorf("failed to list threads: %w", err)
+	}
+
+	for _, task := range tasks {
+		tid, err := strconv.Atoi(task.Name())
+		if err != nil {
+			continue
+		}
+
+		err = unix.SchedSetaffinity(tid, &s.mask)
+		switch {
+		case err == unix.ESRCH:
+			// The thread exited.
+		case err != nil:
+			return fmt.Errorf("failed to load new CPU mask on thread %d: %w", tid, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,60 @@
+package cpu
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCoreSet(t *testing.T) {
+	a := MakeCoreSet(Core{0}, Core{1}, Core{70})
+	b := MakeCoreSet(Core{1}, Core{2}, Core{70})
+	if s := a.Union(b).String(); s != "{0,1,2,70}" {
+		t.Errorf("expected union {0,1,2,70} but got %s", s)
+	}
+	if s := a.Intersect(b); s.String() != "{1,70}" || s.Len() != 2 || !s.Has(Core{70}) || s.Has(Core{0}) {
+		t.Errorf("expected intersection {1,70} but got %v", s)
+	}
+	a.Remove(Core{70})
+	if expect := []Core{{0}, {1}}; !reflect.DeepEqual(a.Cores(), expect) {
+		t.Errorf("expected cores %v but got %v", expect, a.Cores())
+	}
+
+	// Run on every allowed core, which must include the current one.
+	cores, err := ListAllowedCores()
+	if err != nil {
+		t.Fatal(err)
+	}
+	set := MakeCoreSet(cores...)
+	var ran bool
+	ch := make(chan func(CoreSet), 1)
+	ch <- func(s CoreSet) { ran = s == set }
+	close(ch)
+	if err := set.Run(ch); err != nil {
+		t.Fatal(err)
+	}
+	if !ran {
+		t.Error("function did not run")
+	}
+	if err := (CoreSet{}).Run(ch); err == nil {
+		t.Error("ran on an empty set")
+	}
+
+	// Restrict the process to one core, and then restore it.
+	old, err := ProcessAffinity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	restore, err := MakeCoreSet(cores[0]).Apply()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s, err := ProcessAffinity(); err != nil || s != MakeCoreSet(cores[0]) {
+		t.Errorf("expected affinity %v but got %v (%v)", cores[0], s, err)
+	}
+	if err := restore(); err != nil {
+		t.Fatal(err)
+	}
+	if s, err := ProcessAffinity(); err != nil || s != old {
+		t.Errorf("expected affinity %v but got %v (%v)", old, s, err)
+	}
+}
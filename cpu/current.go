@@ -0,0 +1,27 @@
+package cpu
+
+import (
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// CurrentCore returns the core which the calling thread is running on.
+// The OS may move the thread to another core at any time, so the result is only a hint.
+// This is intended for picking a shard of a per-core data structure, where a stale result only costs contention.
+// On x86 CPUs with the RDTSCP instruction this does not make a syscall.
+func CurrentCore() Core {
+	return currentCore()
+}
+
+// getcpu gets the current core with the getcpu syscall.
+func getcpu() Core {
+	var cpu uint32
+	_, _, errno := unix.RawSyscall(unix.SYS_GETCPU, uintptr(unsafe.Pointer(&cpu)), 0, 0)
+	if errno != 0 {
+		// This is not reachable on any supported kernel.
+		return Core{}
+	}
+
+	return Core{index: uint16(cpu)}
+}
@@ -0,0 +1,8 @@
+//go:build !amd64 && !386
+// +build !amd64,!386
+
+package cpu
+
+func currentCore() Core {
+	return getcpu()
+}
@@ -0,0 +1,18 @@
+//go:build amd64 || 386
+// +build amd64 386
+
+package cpu
+
+import "github.com/klauspost/cpuid"
+
+// hasRDTSCP is set if the CPU supports the RDTSCP instruction.
+var hasRDTSCP = cpuid.CPU.RDTSCP()
+
+func currentCore() Core {
+	if !hasRDTSCP {
+		return getcpu()
+	}
+
+	// Linux stores the index of the core in the low 12 bits of IA32_TSC_AUX, with the NUMA node above them.
+	return Core{index: uint16(cpuid.CPU.Ia32TscAux() & 0xfff)}
+}
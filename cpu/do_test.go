@@ -0,0 +1,44 @@
+package cpu
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestDo(t *testing.T) {
+	cores, err := ListCores()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range cores {
+		var current Core
+		err := Do(c, func() error {
+			current = CurrentCore()
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("failed to run on %v: %v", c, err)
+		}
+		if current != c {
+			t.Errorf("expected to run on %v but ran on %v", c, current)
+		}
+	}
+
+	// Errors from the function are returned unchanged.
+	errTest := errors.New("test")
+	if err := DoOnAny(cores, func() error { return errTest }); err != errTest {
+		t.Errorf("expected the error from the function but got %v", err)
+	}
+	if err := DoOnAny(nil, func() error { return nil }); err == nil {
+		t.Error("expected an error when running on no cores")
+	}
+
+	// Running on an offline core fails with ErrOffline.
+	if len(cores) < 1024 {
+		offline := Core{uint16(1023)}
+		if err := Do(offline, func() error { return nil }); !errors.Is(err, ErrOffline) {
+			t.Errorf("expected ErrOffline but got %v", err)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package cpu
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// Frequency describes the clock frequency of a core, as controlled by the OS.
+// All frequencies are in Hz.
+type Frequency struct {
+	// Current is the current frequency of the core, as last requested by the OS or reported by the hardware.
+	Current int64
+
+	// Min and Max are the limits set by the OS for the governor.
+	Min, Max int64
+
+	// HardwareMin and HardwareMax are the limits supported by the hardware.
+	HardwareMin, HardwareMax int64
+
+	// Governor is the name of the scaling governor, which chooses the frequency within the limits.
+	// A governor such as "performance" keeps the frequency at the maximum, which gives stable timings.
+	Governor string
+}
+
+// Frequency reads the frequency scaling state of the core from sysfs.
+// If the OS does not support frequency scaling for the core (as is often the case in virtual machines), the second return is false.
+func (c Core) Frequency() (Frequency, bool, error) {
+	var f Frequency
+	var err error
+	f.Governor, err = c.readSys("cpufreq/scaling_governor")
+	switch {
+	case os.IsNotExist(err):
+		return Frequency{}, false, nil
+	case err != nil:
+		return Frequency{}, false, fmt.Errorf("failed to read governor of %v: %w", c, err)
+	}
+
+	for _, v := range []struct {
+		dst  *int64
+		path string
+	}{
+		{&f.Current, "cpufreq/scaling_cur_freq"},
+		{&f.Min, "cpufreq/scaling_min_freq"},
+		{&f.Max, "cpufreq/scaling_max_freq"},
+		{&f.HardwareMin, "cpufreq/cpuinfo_min_freq"},
+		{&f.HardwareMax, "cpufreq/cpuinfo_max_freq"},
+	} {
+		// The frequencies are in kHz.
+		str, err := c.readSys(v.path)
+		if err != nil {
+			return Frequency{}, false, fmt.Errorf("failed to read frequency of %v: %w", c, err)
+		}
+		khz, err := strconv.ParseInt(str, 10, 64)
+		if err != nil {
+			return Frequency{}, false, fmt.Errorf("failed to parse frequency of %v: %w", c, err)
+		}
+		*v.dst = 1000 * khz
+	}
+
+	return f, true, nil
+}
+
+// FilterGovernor lists the cores which use the specified scaling governor.
+// For example, a benchmark harness can use FilterGovernor(cores, "performance") to only run on cores with stable clocks.
+// Cores which do not support frequency scaling are excluded.
+func FilterGovernor(cores []Core, governor string) ([]Core, error) {
+	var filtered []Core
+	for _, c := range cores {
+		f, ok, err := c.Frequency()
+		if err != nil {
+			return nil, err
+		}
+		if ok && f.Governor == governor {
+			filtered = append(filtered, c)
+		}
+	}
+
+	return filtered, nil
+}
@@ -0,0 +1,45 @@
+package cpu
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestFrequency(t *testing.T) {
+	files := map[string]string{}
+	for i, governor := range []string{"performance", "powersave", "performance"} {
+		dir := "cpu" + strconv.Itoa(i) + "/cpufreq/"
+		files[dir+"scaling_governor"] = governor
+		files[dir+"scaling_cur_freq"] = "2400000"
+		files[dir+"scaling_min_freq"] = "800000"
+		files[dir+"scaling_max_freq"] = "3000000"
+		files[dir+"cpuinfo_min_freq"] = "400000"
+		files[dir+"cpuinfo_max_freq"] = "3500000"
+	}
+	fakeSysfs(t, files)
+
+	f, ok, err := Core{index: 1}.Frequency()
+	if err != nil || !ok {
+		t.Fatalf("failed to read frequency: %v", err)
+	}
+	expect := Frequency{
+		Current:     2400000000,
+		Min:         800000000,
+		Max:         3000000000,
+		HardwareMin: 400000000,
+		HardwareMax: 3500000000,
+		Governor:    "powersave",
+	}
+	if f != expect {
+		t.Errorf("expected %+v but got %+v", expect, f)
+	}
+
+	cores, err := FilterGovernor([]Core{{0}, {1}, {2}, {3}}, "performance")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := []Core{{0}, {2}}; !reflect.DeepEqual(cores, expect) {
+		t.Errorf("expected cores %v but got %v", expect, cores)
+	}
+}
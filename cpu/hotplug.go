@@ -0,0 +1,248 @@
+package cpu
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrOffline is returned when attempting to run on a core which is offline.
+var ErrOffline = errors.New("core is offline")
+
+// topology is a cached description of the cores on the machine.
+// It is discarded when the set of online cores changes, since the kernel may renumber or rebuild the topology.
+type topology struct {
+	// key identifies the sysfs tree and online mask described by the topology.
+	key string
+
+	// cores is the list of online cores.
+	cores []Core
+
+	mu       sync.Mutex
+	siblings map[Core][]Core
+	caches   map[Core][]Cache
+}
+
+// cachedTopology is the most recently loaded topology.
+var cachedTopology struct {
+	sync.Mutex
+	t *topology
+}
+
+// loadTopology loads the topology for the current set of online cores.
+// If the set has not changed, the cached topology is reused.
+func loadTopology() (*topology, error) {
+	key, cores, err := readOnline()
+	if err != nil {
+		return nil, err
+	}
+
+	cachedTopology.Lock()
+	defer cachedTopology.Unlock()
+
+	if t := cachedTopology.t; t != nil && t.key == key {
+		return t, nil
+	}
+	t := &topology{
+		key:      key,
+		cores:    cores,
+		siblings: make(map[Core][]Core),
+		caches:   make(map[Core][]Cache),
+	}
+	cachedTopology.t = t
+
+	return t, nil
+}
+
+// readOnline reads the list of online cores, along with a key identifying it.
+// If the OS does not describe which cores are online, the number of cores reported by the Go runtime is used.
+func readOnline() (string, []Core, error) {
+	data, err := os.ReadFile(filepath.Join(sysCPU, "online"))
+	switch {
+	case os.IsNotExist(err):
+		cores := make([]Core, runtime.NumCPU())
+		for i := range cores {
+			cores[i] = Core{
+				index: uint16(i),
+			}
+		}
+		return sysCPU, cores, nil
+	case err != nil:
+		return "", nil, fmt.Errorf("failed to read online cores: %w", err)
+	}
+
+	list := strings.TrimSpace(string(data))
+	cores, err := parseCPUList(list)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to parse online cores: %w", err)
+	}
+
+	return sysCPU + ":" + list, cores, nil
+}
+
+// loadSiblings gets the siblings of a core, loading them if they are not cached.
+func (t *topology) loadSiblings(c Core) ([]Core, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	siblings, ok := t.siblings[c]
+	if !ok {
+		var err error
+		siblings, err = c.readSiblings()
+		if err != nil {
+			return nil, err
+		}
+		t.siblings[c] = siblings
+	}
+
+	return append([]Core(nil), siblings...), nil
+}
+
+// loadCaches gets the caches used by a core, loading them if they are not cached.
+func (t *topology) loadCaches(c Core) ([]Cache, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	caches, ok := t.caches[c]
+	if !ok {
+		var err error
+		caches, err = c.readCaches()
+		if err != nil {
+			return nil, err
+		}
+		t.caches[c] = caches
+	}
+
+	copied := make([]Cache, len(caches))
+	for i, cache := range caches {
+		cache.Shared = append([]Core(nil), cache.Shared...)
+		copied[i] = cache
+	}
+
+	return copied, nil
+}
+
+// Online checks whether the core is currently online.
+// An offline core can not run anything until it is brought back online.
+func (c Core) Online() (bool, error) {
+	t, err := loadTopology()
+	if err != nil {
+		return false, err
+	}
+
+	for _, online := range t.cores {
+		if online == c {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// Event describes a change in the set of online cores.
+type Event struct {
+	// Online lists the cores which came online.
+	Online []Core
+
+	// Offline lists the cores which went offline.
+	// These cores can not be used until they come back online, and running on them fails with ErrOffline.
+	Offline []Core
+}
+
+// Watcher watches for cores going online or offline (CPU hotplug).
+type Watcher struct {
+	// C receives an event whenever the set of online cores changes.
+	// It is closed when the watcher stops.
+	C <-chan Event
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+	err      error
+}
+
+// Watch starts watching for cores going online or offline, checking at the specified interval.
+// Cached topology information is discarded whenever a change is detected.
+// The interval must be positive.
+func Watch(interval time.Duration) (*Watcher, error) {
+	if interval <= 0 {
+		return nil, fmt.Errorf("invalid watch interval %v", interval)
+	}
+	_, cores, err := readOnline()
+	if err != nil {
+		return nil, err
+	}
+
+	ch := make(chan Event)
+	w := &Watcher{
+		C:    ch,
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	go w.run(ch, cores, interval)
+
+	return w, nil
+}
+
+// run polls the online cores until the watcher is stopped.
+func (w *Watcher) run(ch chan<- Event, cores []Core, interval time.Duration) {
+	defer close(w.done)
+	defer close(ch)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-w.stop:
+			return
+		}
+
+		t, err := loadTopology()
+		if err != nil {
+			w.err = err
+			return
+		}
+		if reflect.DeepEqual(t.cores, cores) {
+			continue
+		}
+
+		var e Event
+		was := MakeCoreSet(cores...)
+		now := MakeCoreSet(t.cores...)
+		for _, c := range t.cores {
+			if !was.Has(c) {
+				e.Online = append(e.Online, c)
+			}
+		}
+		for _, c := range cores {
+			if !now.Has(c) {
+				e.Offline = append(e.Offline, c)
+			}
+		}
+		cores = t.cores
+
+		select {
+		case ch <- e:
+		case <-w.stop:
+			return
+		}
+	}
+}
+
+// Stop stops the watcher.
+// If the watcher stopped early because it failed to read the online cores, the error is returned.
+// It is safe to call Stop more than once, and every call returns the same error.
+func (w *Watcher) Stop() error {
+	w.stopOnce.Do(func() { close(w.stop) })
+	<-w.done
+
+	return w.err
+}
@@ -0,0 +1,77 @@
+package cpu
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestHotplug(t *testing.T) {
+	fakeSysfs(t, map[string]string{
+		"online":                             "0-3",
+		"cpu2/topology/thread_siblings_list": "2",
+	})
+	write := func(path, data string) {
+		t.Helper()
+
+		if err := os.WriteFile(filepath.Join(sysCPU, path), []byte(data+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	w, err := Watch(time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := w.Stop(); err != nil {
+			t.Error(err)
+		}
+		if err := w.Stop(); err != nil {
+			t.Errorf("second stop failed: %v", err)
+		}
+		if _, ok := <-w.C; ok {
+			t.Error("event channel is still open after stopping")
+		}
+	}()
+
+	cores, err := ListCores()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := []Core{{0}, {1}, {2}, {3}}; !reflect.DeepEqual(cores, expect) {
+		t.Errorf("expected cores %v but got %v", expect, cores)
+	}
+	if _, err := (Core{2}).Siblings(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The siblings are cached until the set of online cores changes.
+	write("cpu2/topology/thread_siblings_list", "2-3")
+	if siblings, err := (Core{2}).Siblings(); err != nil || !reflect.DeepEqual(siblings, []Core{{2}}) {
+		t.Errorf("expected cached siblings [cpu2] but got %v (%v)", siblings, err)
+	}
+
+	write("online", "0-1,3-4")
+	e := <-w.C
+	if expect := (Event{Online: []Core{{4}}, Offline: []Core{{2}}}); !reflect.DeepEqual(e, expect) {
+		t.Errorf("expected event %+v but got %+v", expect, e)
+	}
+	if online, err := (Core{2}).Online(); err != nil || online {
+		t.Errorf("expected cpu2 to be offline (%v)", err)
+	}
+	if siblings, err := (Core{2}).Siblings(); err != nil || !reflect.DeepEqual(siblings, []Core{{2}, {3}}) {
+		t.Errorf("expected siblings [cpu2 cpu3] but got %v (%v)", siblings, err)
+	}
+}
+
+func TestWatchInterval(t *testing.T) {
+	for _, interval := range []time.Duration{0, -time.Second} {
+		if w, err := Watch(interval); err == nil {
+			w.Stop()
+			t.Errorf("started a watcher with interval %v", interval)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package cpu
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// procCmdline is the command line of the kernel.
+// It is a variable so that tests can substitute a fake file.
+var procCmdline = "/proc/cmdline"
+
+// Isolation describes how a core is isolated from the rest of the system by kernel parameters.
+type Isolation struct {
+	// Scheduler is set if the core is removed from scheduler load balancing (isolcpus).
+	// Threads only run on the core if they are explicitly pinned to it.
+	Scheduler bool
+
+	// Tick is set if the scheduler tick is stopped while a single thread is running on the core (nohz_full, or isolcpus with the nohz flag).
+	Tick bool
+
+	// RCU is set if RCU callbacks are offloaded from the core (rcu_nocbs, or nohz_full).
+	RCU bool
+
+	// IRQ is set if managed interrupts are kept off of the core where possible (isolcpus with the managed_irq flag).
+	IRQ bool
+}
+
+// Quiet checks whether the core is isolated from the scheduler, the scheduler tick, and RCU callbacks.
+// A thread pinned to a quiet core is rarely interrupted by the kernel.
+func (i Isolation) Quiet() bool {
+	return i.Scheduler && i.Tick && i.RCU
+}
+
+// Isolation reads the isolation of the core from the kernel command line.
+func (c Core) Isolation() (Isolation, error) {
+	isolation, err := readIsolation()
+	if err != nil {
+		return Isolation{}, err
+	}
+
+	return isolation[c], nil
+}
+
+// IsolatedCores lists the cores which are isolated from the scheduler.
+// The kernel does not place threads on these cores unless they are pinned to them, so they are usually excluded from ListAllowedCores.
+func IsolatedCores() ([]Core, error) {
+	return filterIsolation(func(i Isolation) bool { return i.Scheduler })
+}
+
+// QuietCores lists the cores which are isolated from the scheduler, the scheduler tick, and RCU callbacks.
+// These are the best cores to pin latency-critical threads to.
+func QuietCores() ([]Core, error) {
+	return filterIsolation(Isolation.Quiet)
+}
+
+// filterIsolation lists the cores with an isolation matching the filter, in order.
+func filterIsolation(filter func(Isolation) bool) ([]Core, error) {
+	isolation, err := readIsolation()
+	if err != nil {
+		return nil, err
+	}
+
+	var cores []Core
+	for c, i := range isolation {
+		if filter(i) {
+			cores = append(cores, c)
+		}
+	}
+	sort.Slice(cores, func(i, j int) bool {
+		return cores[i].index < cores[j].index
+	})
+
+	return cores, nil
+}
+
+// readIsolation parses the isolation parameters from the kernel command line.
+// Cores which are not isolated are not included.
+func readIsolation() (map[Core]Isolation, error) {
+	data, err := os.ReadFile(procCmdline)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read kernel command line: %w", err)
+	}
+
+	isolation := make(map[Core]Isolation)
+	set := func(list string, fn func(*Isolation)) error {
+		cores, err := parseKernelCPUList(list)
+		if err != nil {
+			return err
+		}
+		for _, c := range cores {
+			i := isolation[c]
+			fn(&i)
+			isolation[c] = i
+		}
+
+		return nil
+	}
+
+	for _, param := range strings.Fields(string(data)) {
+		if param == "--" {
+			// The remaining parameters are passed to init.
+			break
+		}
+
+		name, value := param, ""
+		if i := strings.IndexByte(param, '='); i >= 0 {
+			name, value = param[:i], param[i+1:]
+		}
+
+		switch name {
+		case "isolcpus":
+			// The value is formatted as "[flag,...,]list".
+			// If there are no flags, only the scheduler isolation applies.
+			var flags []string
+			for value != "" {
+				i := strings.IndexByte(value, ',')
+				flag := value
+				if i >= 0 {
+					flag = value[:i]
+				}
+				if flag != "nohz" && flag != "domain" && flag != "managed_irq" {
+					break
+				}
+				flags = append(flags, flag)
+				if i < 0 {
+					value = ""
+				} else {
+					value = value[i+1:]
+				}
+			}
+			if flags == nil {
+				flags = []string{"domain"}
+			}
+
+			err = set(value, func(i *Isolation) {
+				for _, flag := range flags {
+					switch flag {
+					case "nohz":
+						i.Tick = true
+					case "domain":
+						i.Scheduler = true
+					case "managed_irq":
+						i.IRQ = true
+					}
+				}
+			})
+		case "nohz_full":
+			// Tickless cores also have their RCU callbacks offloaded.
+			err = set(value, func(i *Isolation) {
+				i.Tick = true
+				i.RCU = true
+			})
+		case "rcu_nocbs":
+			if value == "" {
+				// Without a list, the callbacks are offloaded from all cores.
+				value = "all"
+			}
+			err = set(value, func(i *Isolation) {
+				i.RCU = true
+			})
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid kernel parameter %q: %w", param, err)
+		}
+	}
+
+	return isolation, nil
+}
+
+// parseKernelCPUList parses a list of cores from a kernel parameter.
+// In addition to the sysfs format, this accepts "all".
+func parseKernelCPUList(list string) ([]Core, error) {
+	if list == "all" {
+		return ListCores()
+	}
+
+	return parseCPUList(list)
+}
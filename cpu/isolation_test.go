@@ -0,0 +1,55 @@
+package cpu
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestIsolation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cmdline")
+	if err := os.WriteFile(path, []byte("BOOT_IMAGE=/vmlinuz root=/dev/sda1 isolcpus=managed_irq,domain,2-3 nohz_full=3 rcu_nocbs=1,3 -- isolcpus=0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	old := procCmdline
+	procCmdline = path
+	t.Cleanup(func() { procCmdline = old })
+
+	for i, expect := range []Isolation{
+		{},
+		{RCU: true},
+		{Scheduler: true, IRQ: true},
+		{Scheduler: true, Tick: true, RCU: true, IRQ: true},
+	} {
+		isolation, err := Core{uint16(i)}.Isolation()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if isolation != expect {
+			t.Errorf("expected cpu%d to have isolation %+v but got %+v", i, expect, isolation)
+		}
+	}
+
+	isolated, err := IsolatedCores()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := []Core{{2}, {3}}; !reflect.DeepEqual(isolated, expect) {
+		t.Errorf("expected isolated cores %v but got %v", expect, isolated)
+	}
+	quiet, err := QuietCores()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := []Core{{3}}; !reflect.DeepEqual(quiet, expect) {
+		t.Errorf("expected quiet cores %v but got %v", expect, quiet)
+	}
+
+	if err := os.WriteFile(path, []byte("isolcpus=nohz,1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if isolation, err := (Core{1}).Isolation(); err != nil || isolation != (Isolation{Tick: true}) {
+		t.Errorf("expected only tick isolation but got %+v (%v)", isolation, err)
+	}
+}
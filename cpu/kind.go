@@ -0,0 +1,234 @@
+package cpu
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// sysDevices is the sysfs directory containing the devices, including the PMUs of Intel hybrid CPUs.
+// It is a variable so that tests can substitute a fake tree.
+var sysDevices = "/sys/devices"
+
+// Kind is the kind of a core on a machine with heterogeneous cores.
+type Kind uint8
+
+const (
+	// UnknownKind indicates that the OS does not describe the performance of the cores.
+	UnknownKind Kind = iota
+
+	// PerformanceKind is a core which is among the fastest on the machine, such as a P-core on an Intel hybrid CPU or a big core on ARM big.LITTLE.
+	// On a machine where all cores are the same, every core is a performance core.
+	PerformanceKind
+
+	// EfficiencyKind is a core which is slower than the fastest cores on the machine, such as an E-core on an Intel hybrid CPU or a LITTLE core on ARM big.LITTLE.
+	EfficiencyKind
+)
+
+func (k Kind) String() string {
+	switch k {
+	case UnknownKind:
+		return "unknown"
+	case PerformanceKind:
+		return "performance"
+	case EfficiencyKind:
+		return "efficiency"
+	default:
+		return "Kind(" + strconv.Itoa(int(k)) + ")"
+	}
+}
+
+// MarshalText encodes the kind as its name.
+func (k Kind) MarshalText() ([]byte, error) {
+	if k > EfficiencyKind {
+		return nil, fmt.Errorf("invalid kind %d", k)
+	}
+
+	return []byte(k.String()), nil
+}
+
+// UnmarshalText decodes a kind from its name.
+func (k *Kind) UnmarshalText(text []byte) error {
+	for kind := UnknownKind; kind <= EfficiencyKind; kind++ {
+		if string(text) == kind.String() {
+			*k = kind
+			return nil
+		}
+	}
+
+	return fmt.Errorf("invalid kind %q", text)
+}
+
+// Kind classifies the core as a performance or efficiency core, by comparing it to the other cores on the machine.
+// This is a method rather than a field, so that a Core remains a plain identifier which can be compared and used as a map key.
+func (c Core) Kind() (Kind, error) {
+	cores, err := ListCores()
+	if err != nil {
+		return UnknownKind, err
+	}
+
+	scores, err := coreScores(append(cores, c))
+	if err != nil {
+		return UnknownKind, err
+	}
+
+	return scores.kind(c), nil
+}
+
+// FastestCores lists up to n of the cores which the process is allowed to use, starting with the fastest.
+// Cores of the same speed are listed in order.
+// This can be used to place latency-critical work on performance cores.
+func FastestCores(n int) ([]Core, error) {
+	cores, err := ListAllowedCores()
+	if err != nil {
+		return nil, err
+	}
+
+	scores, err := coreScores(cores)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(cores, func(i, j int) bool {
+		return scores.score[cores[i]] > scores.score[cores[j]]
+	})
+	if n < len(cores) {
+		cores = cores[:n]
+	}
+
+	return cores, nil
+}
+
+// scores are relative measures of the speed of cores.
+type scores struct {
+	// score is the score of each core, where higher is faster.
+	// Scores are only comparable to other scores on the same machine.
+	score map[Core]int64
+
+	// max is the highest score.
+	max int64
+
+	// threshold is the lowest score of a performance core.
+	threshold int64
+
+	// known is set if the OS describes the speed of the cores.
+	known bool
+}
+
+// kind classifies a core by its score.
+func (s scores) kind(c Core) Kind {
+	switch {
+	case !s.known:
+		return UnknownKind
+	case s.score[c] >= s.threshold:
+		return PerformanceKind
+	default:
+		return EfficiencyKind
+	}
+}
+
+// coreScores scores the speed of a set of cores.
+// The source of the scores is chosen for the whole machine, in order of preference:
+//   - The capacity of each core, as used by the Linux scheduler on ARM (cpu_capacity).
+//   - The PMUs of Intel hybrid CPUs, which list the P-cores (cpu_core) and E-cores (cpu_atom).
+//   - The maximum frequency supported by each core.
+//
+// Some CPUs with identical cores allow a few favoured cores to boost slightly higher (such as with Intel Turbo Boost Max 3.0 or AMD preferred cores).
+// So that the other cores are not classified as efficiency cores, a core is only considered slower by its frequency if it is at least 1/8 slower than the fastest core.
+// The scores still rank the favoured cores first.
+func coreScores(cores []Core) (scores, error) {
+	sources := []struct {
+		score func(Core) (int64, bool, error)
+
+		// approximate is set if similar scores should be treated as equal when classifying cores.
+		approximate bool
+	}{
+		{score: capacityScore},
+		{score: hybridScore},
+		{score: frequencyScore, approximate: true},
+	}
+search:
+	for _, source := range sources {
+		s := scores{score: make(map[Core]int64, len(cores)), known: true}
+		for _, c := range cores {
+			score, ok, err := source.score(c)
+			if err != nil {
+				return scores{}, err
+			}
+			if !ok {
+				// The source does not describe every core, so try the next one.
+				continue search
+			}
+
+			s.score[c] = score
+			if score > s.max {
+				s.max = score
+			}
+		}
+
+		s.threshold = s.max
+		if source.approximate {
+			s.threshold -= s.max / 8
+		}
+
+		return s, nil
+	}
+
+	return scores{}, nil
+}
+
+// capacityScore reads the capacity of a core, normalized to 1024 for the fastest core.
+func capacityScore(c Core) (int64, bool, error) {
+	capacity, err := c.readSysInt("cpu_capacity")
+	switch {
+	case os.IsNotExist(err):
+		return 0, false, nil
+	case err != nil:
+		return 0, false, fmt.Errorf("failed to read capacity of %v: %w", c, err)
+	}
+
+	return int64(capacity), true, nil
+}
+
+// hybridScore scores a core of an Intel hybrid CPU, with a score of 2 for a P-core and 1 for an E-core.
+func hybridScore(c Core) (int64, bool, error) {
+	for _, pmu := range []struct {
+		name  string
+		score int64
+	}{
+		{"cpu_core", 2},
+		{"cpu_atom", 1},
+	} {
+		data, err := os.ReadFile(filepath.Join(sysDevices, pmu.name, "cpus"))
+		switch {
+		case os.IsNotExist(err):
+			return 0, false, nil
+		case err != nil:
+			return 0, false, fmt.Errorf("failed to read hybrid cores: %w", err)
+		}
+
+		cores, err := parseCPUList(strings.TrimSpace(string(data)))
+		if err != nil {
+			return 0, false, fmt.Errorf("failed to parse hybrid cores: %w", err)
+		}
+		for _, core := range cores {
+			if core == c {
+				return pmu.score, true, nil
+			}
+		}
+	}
+
+	return 0, false, nil
+}
+
+// frequencyScore scores a core by its maximum frequency.
+func frequencyScore(c Core) (int64, bool, error) {
+	f, ok, err := c.Frequency()
+	if err != nil || !ok {
+		return 0, false, err
+	}
+
+	return f.HardwareMax, true, nil
+}
@@ -0,0 +1,125 @@
+package cpu
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestKind(t *testing.T) {
+	scoresOf := func(cores ...Core) scores {
+		t.Helper()
+
+		s, err := coreScores(cores)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	t.Run("Capacity", func(t *testing.T) {
+		fakeSysfs(t, map[string]string{
+			"cpu0/cpu_capacity": "446",
+			"cpu1/cpu_capacity": "446",
+			"cpu2/cpu_capacity": "1024",
+		})
+
+		s := scoresOf(Core{0}, Core{1}, Core{2})
+		for i, expect := range []Kind{EfficiencyKind, EfficiencyKind, PerformanceKind} {
+			if kind := s.kind(Core{uint16(i)}); kind != expect {
+				t.Errorf("expected cpu%d to be a %v core but got %v", i, expect, kind)
+			}
+		}
+	})
+
+	// fakeFrequencies simulates cores with the specified maximum frequencies, in MHz.
+	fakeFrequencies := func(t *testing.T, mhz ...int) {
+		old := sysDevices
+		sysDevices = t.TempDir()
+		t.Cleanup(func() { sysDevices = old })
+
+		files := make(map[string]string)
+		for i, f := range mhz {
+			dir := "cpu" + strconv.Itoa(i) + "/cpufreq/"
+			files[dir+"scaling_governor"] = "performance"
+			for _, name := range []string{"scaling_cur_freq", "scaling_max_freq", "cpuinfo_max_freq"} {
+				files[dir+name] = strconv.Itoa(1000 * f)
+			}
+			for _, name := range []string{"scaling_min_freq", "cpuinfo_min_freq"} {
+				files[dir+name] = "800000"
+			}
+		}
+		fakeSysfs(t, files)
+	}
+
+	t.Run("Frequency", func(t *testing.T) {
+		fakeFrequencies(t, 3200, 3200, 2000, 2000)
+
+		s := scoresOf(Core{0}, Core{1}, Core{2}, Core{3})
+		for i, expect := range []Kind{PerformanceKind, PerformanceKind, EfficiencyKind, EfficiencyKind} {
+			if kind := s.kind(Core{uint16(i)}); kind != expect {
+				t.Errorf("expected cpu%d to be a %v core but got %v", i, expect, kind)
+			}
+		}
+	})
+
+	t.Run("FavouredCores", func(t *testing.T) {
+		// With Intel Turbo Boost Max 3.0, a couple of identical cores boost slightly higher than the others.
+		fakeFrequencies(t, 4600, 4800, 4600, 5000)
+
+		s := scoresOf(Core{0}, Core{1}, Core{2}, Core{3})
+		for i := 0; i < 4; i++ {
+			if kind := s.kind(Core{uint16(i)}); kind != PerformanceKind {
+				t.Errorf("expected cpu%d to be a performance core but got %v", i, kind)
+			}
+		}
+
+		// The favoured cores are still preferred.
+		if !(s.score[Core{3}] > s.score[Core{1}] && s.score[Core{1}] > s.score[Core{0}]) {
+			t.Errorf("favoured cores are not ranked first: %v", s.score)
+		}
+	})
+
+	t.Run("Hybrid", func(t *testing.T) {
+		fakeSysfs(t, nil)
+		old := sysDevices
+		sysDevices = t.TempDir()
+		t.Cleanup(func() { sysDevices = old })
+		for name, list := range map[string]string{"cpu_core": "0-1", "cpu_atom": "2-3"} {
+			if err := os.MkdirAll(filepath.Join(sysDevices, name), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(filepath.Join(sysDevices, name, "cpus"), []byte(list+"\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		s := scoresOf(Core{0}, Core{1}, Core{2}, Core{3})
+		for i, expect := range []Kind{PerformanceKind, PerformanceKind, EfficiencyKind, EfficiencyKind} {
+			if kind := s.kind(Core{uint16(i)}); kind != expect {
+				t.Errorf("expected cpu%d to be a %v core but got %v", i, expect, kind)
+			}
+		}
+	})
+
+	t.Run("Unknown", func(t *testing.T) {
+		fakeSysfs(t, nil)
+		old := sysDevices
+		sysDevices = t.TempDir()
+		t.Cleanup(func() { sysDevices = old })
+
+		if kind := scoresOf(Core{0}).kind(Core{0}); kind != UnknownKind {
+			t.Errorf("expected an unknown core but got %v", kind)
+		}
+	})
+
+	// The fastest cores must be usable.
+	cores, err := FastestCores(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cores) != 1 {
+		t.Errorf("expected 1 core but got %v", cores)
+	}
+}
@@ -0,0 +1,175 @@
+package cpu
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Machine describes the topology of the CPUs on a machine.
+// It can be serialized to JSON.
+type Machine struct {
+	// Sockets lists the physical packages on the machine, ordered by ID.
+	Sockets []Socket `json:"sockets"`
+}
+
+// Socket is a physical package containing cores.
+type Socket struct {
+	// ID is the ID of the package, as used by Core.Package.
+	ID int `json:"id"`
+
+	// Nodes lists the NUMA nodes with cores in the package, ordered by ID.
+	Nodes []Node `json:"nodes"`
+}
+
+// Node is a NUMA node, which is a group of cores sharing the same memory controller.
+type Node struct {
+	// ID is the ID of the node, as used by the OS.
+	ID int `json:"id"`
+
+	// Cores lists the physical cores in the node, ordered by their first thread.
+	Cores []PhysicalCore `json:"cores"`
+}
+
+// PhysicalCore is a physical core, which runs one or more hardware threads (logical CPUs).
+type PhysicalCore struct {
+	// ID is the ID of the core within its package.
+	// This is not unique across packages.
+	ID int `json:"id"`
+
+	// Kind is the kind of the core.
+	Kind Kind `json:"kind"`
+
+	// Threads lists the online logical CPUs of the physical core, in order.
+	Threads []Core `json:"threads"`
+
+	// Caches lists the caches used by the core, ordered by level.
+	Caches []Cache `json:"caches"`
+}
+
+// Topology describes the topology of the online cores on the current machine.
+// If the OS does not describe part of the topology, the cores are assumed to be in package 0 and NUMA node 0, and each core is assumed to be a separate physical core.
+func Topology() (*Machine, error) {
+	t, err := loadTopology()
+	if err != nil {
+		return nil, err
+	}
+	scores, err := coreScores(t.cores)
+	if err != nil {
+		return nil, err
+	}
+
+	// Group the threads into physical cores, identified by their lowest-numbered sibling.
+	type located struct {
+		pkg, node int
+		core      *PhysicalCore
+	}
+	var order []Core
+	physical := make(map[Core]*located)
+	for _, c := range t.cores {
+		siblings, err := t.loadSiblings(c)
+		if err != nil {
+			return nil, err
+		}
+		first := c
+		for _, s := range siblings {
+			if s.index < first.index {
+				first = s
+			}
+		}
+		if p, ok := physical[first]; ok {
+			p.core.Threads = append(p.core.Threads, c)
+			continue
+		}
+
+		pkg, err := c.readSysInt("topology/physical_package_id")
+		if err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to read package of %v: %w", c, err)
+		}
+		id, err := c.readSysInt("topology/core_id")
+		switch {
+		case os.IsNotExist(err):
+			id = int(first.index)
+		case err != nil:
+			return nil, fmt.Errorf("failed to read core ID of %v: %w", c, err)
+		}
+		node, err := c.node()
+		if err != nil {
+			return nil, err
+		}
+		caches, err := t.loadCaches(c)
+		if err != nil {
+			return nil, err
+		}
+
+		physical[first] = &located{
+			pkg:  pkg,
+			node: node,
+			core: &PhysicalCore{
+				ID:      id,
+				Kind:    scores.kind(c),
+				Threads: []Core{c},
+				Caches:  caches,
+			},
+		}
+		order = append(order, first)
+	}
+
+	// Place the physical cores into their nodes and sockets.
+	var m Machine
+	sockets := make(map[int]int)
+	nodes := make(map[[2]int]int)
+	for _, first := range order {
+		p := physical[first]
+
+		si, ok := sockets[p.pkg]
+		if !ok {
+			si = len(m.Sockets)
+			sockets[p.pkg] = si
+			m.Sockets = append(m.Sockets, Socket{ID: p.pkg})
+		}
+		socket := &m.Sockets[si]
+
+		ni, ok := nodes[[2]int{p.pkg, p.node}]
+		if !ok {
+			ni = len(socket.Nodes)
+			nodes[[2]int{p.pkg, p.node}] = ni
+			socket.Nodes = append(socket.Nodes, Node{ID: p.node})
+		}
+		node := &socket.Nodes[ni]
+
+		node.Cores = append(node.Cores, *p.core)
+	}
+
+	// The sockets and nodes were added in the order of their first cores.
+	sort.Slice(m.Sockets, func(i, j int) bool {
+		return m.Sockets[i].ID < m.Sockets[j].ID
+	})
+	for _, socket := range m.Sockets {
+		nodes := socket.Nodes
+		sort.Slice(nodes, func(i, j int) bool {
+			return nodes[i].ID < nodes[j].ID
+		})
+	}
+
+	return &m, nil
+}
+
+// node finds the NUMA node containing the core.
+// If the OS does not describe the NUMA topology, the core is assumed to be in node 0.
+func (c Core) node() (int, error) {
+	dirs, err := filepath.Glob(filepath.Join(sysCPU, c.String(), "node*"))
+	if err != nil || len(dirs) == 0 {
+		return 0, err
+	}
+
+	id, err := strconv.Atoi(strings.TrimPrefix(filepath.Base(dirs[0]), "node"))
+	if err != nil {
+		return 0, fmt.Errorf("invalid NUMA node of %v: %w", c, err)
+	}
+
+	return id, nil
+}
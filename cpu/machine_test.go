@@ -0,0 +1,89 @@
+package cpu
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestTopology(t *testing.T) {
+	// Simulate 2 packages, each with a single NUMA node and a single physical core with 2 threads.
+	fakeSysfs(t, map[string]string{
+		"online":                                  "0-3",
+		"cpu0/topology/thread_siblings_list":      "0,2",
+		"cpu1/topology/thread_siblings_list":      "1,3",
+		"cpu2/topology/thread_siblings_list":      "0,2",
+		"cpu3/topology/thread_siblings_list":      "1,3",
+		"cpu0/topology/physical_package_id":       "0",
+		"cpu1/topology/physical_package_id":       "1",
+		"cpu0/topology/core_id":                   "0",
+		"cpu1/topology/core_id":                   "0",
+		"cpu0/node0/cpulist":                      "0,2",
+		"cpu1/node1/cpulist":                      "1,3",
+		"cpu0/cpu_capacity":                       "1024",
+		"cpu1/cpu_capacity":                       "512",
+		"cpu2/cpu_capacity":                       "1024",
+		"cpu3/cpu_capacity":                       "512",
+		"cpu0/cache/index0/level":                 "1",
+		"cpu0/cache/index0/type":                  "Data",
+		"cpu0/cache/index0/size":                  "32K",
+		"cpu0/cache/index0/coherency_line_size":   "64",
+		"cpu0/cache/index0/ways_of_associativity": "8",
+		"cpu0/cache/index0/shared_cpu_list":       "0,2",
+	})
+
+	m, err := Topology()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := &Machine{
+		Sockets: []Socket{
+			{
+				ID: 0,
+				Nodes: []Node{{
+					ID: 0,
+					Cores: []PhysicalCore{{
+						ID:      0,
+						Kind:    PerformanceKind,
+						Threads: []Core{{0}, {2}},
+						Caches: []Cache{{
+							Level:    1,
+							Type:     DataCache,
+							Size:     32 << 10,
+							LineSize: 64,
+							Ways:     8,
+							Shared:   []Core{{0}, {2}},
+						}},
+					}},
+				}},
+			},
+			{
+				ID: 1,
+				Nodes: []Node{{
+					ID: 1,
+					Cores: []PhysicalCore{{
+						ID:      0,
+						Kind:    EfficiencyKind,
+						Threads: []Core{{1}, {3}},
+						Caches:  []Cache{},
+					}},
+				}},
+			},
+		},
+	}
+	if !reflect.DeepEqual(m, expect) {
+		t.Errorf("expected topology %+v but got %+v", expect, m)
+	}
+
+	data, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Machine
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(&decoded, expect) {
+		t.Errorf("expected %s to decode to %+v but got %+v", data, expect, decoded)
+	}
+}
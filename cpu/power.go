@@ -0,0 +1,416 @@
+package cpu
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sysClass is the sysfs directory containing the device classes, including the powercap and hwmon classes.
+// It is a variable so that tests can substitute a fake tree.
+var sysClass = "/sys/class"
+
+// EnergyDomain is a RAPL power domain, which counts the energy consumed by part of the CPU.
+type EnergyDomain struct {
+	// Name is the name of the domain, such as "package-0".
+	// A subdomain is named with the name of its parent as a prefix, such as "package-0/core" or "package-0/dram".
+	Name string
+
+	// Range is the maximum value of the energy counter in microjoules, after which it wraps to 0.
+	Range uint64
+
+	// dir is the powercap directory of the domain.
+	dir string
+}
+
+// EnergyDomains lists the RAPL power domains on the machine, ordered by name.
+// If the OS does not support RAPL (as is often the case in virtual machines), the list is empty.
+func EnergyDomains() ([]EnergyDomain, error) {
+	dirs, err := filepath.Glob(filepath.Join(sysClass, "powercap", "intel-rapl:*"))
+	if err != nil {
+		return nil, err
+	}
+
+	domains := make([]EnergyDomain, 0, len(dirs))
+	for _, dir := range dirs {
+		name, err := readSysFile(dir, "name")
+		if err != nil {
+			return nil, fmt.Errorf("failed to read name of RAPL domain %s: %w", filepath.Base(dir), err)
+		}
+		if id := strings.TrimPrefix(filepath.Base(dir), "intel-rapl:"); strings.Count(id, ":") == 1 {
+			// This is a subdomain, so prefix the name of the parent.
+			parent := filepath.Join(filepath.Dir(dir), "intel-rapl:"+id[:strings.IndexByte(id, ':')])
+			parentName, err := readSysFile(parent, "name")
+			if err != nil {
+				return nil, fmt.Errorf("failed to read name of RAPL domain %s: %w", filepath.Base(parent), err)
+			}
+			name = parentName + "/" + name
+		}
+
+		max, err := readSysFile(dir, "max_energy_range_uj")
+		if err != nil {
+			return nil, fmt.Errorf("failed to read range of RAPL domain %s: %w", name, err)
+		}
+		r, err := strconv.ParseUint(max, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid range of RAPL domain %s: %w", name, err)
+		}
+
+		domains = append(domains, EnergyDomain{
+			Name:  name,
+			Range: r,
+			dir:   dir,
+		})
+	}
+	sort.Slice(domains, func(i, j int) bool {
+		return domains[i].Name < domains[j].Name
+	})
+
+	return domains, nil
+}
+
+// Energy reads the energy counter of the domain, in microjoules.
+// The counter wraps to 0 after reaching the range of the domain, which may happen within minutes under load.
+// On recent kernels, the counter can only be read by root.
+func (d EnergyDomain) Energy() (uint64, error) {
+	str, err := readSysFile(d.dir, "energy_uj")
+	if err != nil {
+		return 0, fmt.Errorf("failed to read energy of RAPL domain %s: %w", d.Name, err)
+	}
+	energy, err := strconv.ParseUint(str, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid energy of RAPL domain %s: %w", d.Name, err)
+	}
+
+	return energy, nil
+}
+
+// readSysFile reads a file in a sysfs directory, with surrounding whitespace removed.
+func readSysFile(dir, name string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(data)), nil
+}
+
+// Temperature reads the temperature of the core in degrees Celsius.
+// If the CPU only reports the temperature of the package, that is used instead.
+// If the OS does not report the temperature, the second return is false.
+func (c Core) Temperature() (float64, bool, error) {
+	path, ok, err := c.temperatureSensor()
+	if err != nil || !ok {
+		return 0, false, err
+	}
+
+	temp, err := readTemperature(path)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to read temperature of %v: %w", c, err)
+	}
+
+	return temp, true, nil
+}
+
+// temperatureSensor finds the hwmon input file which reports the temperature of the core.
+func (c Core) temperatureSensor() (string, bool, error) {
+	dirs, err := filepath.Glob(filepath.Join(sysClass, "hwmon", "hwmon*"))
+	if err != nil || len(dirs) == 0 {
+		return "", false, err
+	}
+
+	// Intel CPUs report the temperature of each physical core with coretemp, with one device per package.
+	// The cores are labeled with their ID within the package.
+	// If the topology is not described, only the fallbacks are used.
+	var pkgLabel, coreLabel string
+	if pkg, err := c.readSysInt("topology/physical_package_id"); err == nil {
+		pkgLabel = "Package id " + strconv.Itoa(pkg)
+	} else if !os.IsNotExist(err) {
+		return "", false, fmt.Errorf("failed to read package of %v: %w", c, err)
+	}
+	if id, err := c.readSysInt("topology/core_id"); err == nil {
+		coreLabel = "Core " + strconv.Itoa(id)
+	} else if !os.IsNotExist(err) {
+		return "", false, fmt.Errorf("failed to read core ID of %v: %w", c, err)
+	}
+
+	var fallback string
+	for _, dir := range dirs {
+		name, err := readSysFile(dir, "name")
+		if err != nil {
+			continue
+		}
+
+		switch name {
+		case "coretemp":
+			labels, err := readHwmonLabels(dir)
+			if err != nil {
+				return "", false, err
+			}
+			if _, ok := labels[pkgLabel]; !ok || pkgLabel == "" {
+				// This device is for another package.
+				continue
+			}
+			if path, ok := labels[coreLabel]; ok && coreLabel != "" {
+				return path, true, nil
+			}
+			fallback = labels[pkgLabel]
+		case "k10temp", "zenpower", "cpu_thermal":
+			// AMD and many ARM CPUs only report a single temperature.
+			if fallback == "" {
+				fallback = filepath.Join(dir, "temp1_input")
+			}
+		}
+	}
+
+	return fallback, fallback != "", nil
+}
+
+// readHwmonLabels reads the labels of the temperature inputs of a hwmon device, mapped to the paths of the inputs.
+func readHwmonLabels(dir string) (map[string]string, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "temp*_label"))
+	if err != nil {
+		return nil, err
+	}
+
+	labels := make(map[string]string, len(paths))
+	for _, path := range paths {
+		label, err := readSysFile(filepath.Dir(path), filepath.Base(path))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read temperature label: %w", err)
+		}
+		labels[label] = strings.TrimSuffix(path, "_label") + "_input"
+	}
+
+	return labels, nil
+}
+
+// readTemperature reads a hwmon temperature input in degrees Celsius.
+func readTemperature(path string) (float64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+
+	// The temperature is in millidegrees.
+	milli, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid temperature: %w", err)
+	}
+
+	return float64(milli) / 1000, nil
+}
+
+// Sample is a summary of the energy and temperature measurements made by a Sampler.
+type Sample struct {
+	// Duration is the time since the sampler was started.
+	Duration time.Duration
+
+	// Energy is the energy consumed by each RAPL domain since the sampler was started, in joules.
+	Energy map[string]float64
+
+	// Temperature is the last temperature measured for each core, in degrees Celsius.
+	// Cores without a temperature sensor are not included.
+	Temperature map[Core]float64
+
+	// PeakTemperature is the highest temperature measured for each core, in degrees Celsius.
+	PeakTemperature map[Core]float64
+}
+
+// Power returns the average power consumed by a RAPL domain, in watts.
+func (s Sample) Power(domain string) float64 {
+	return s.Energy[domain] / s.Duration.Seconds()
+}
+
+// Sampler periodically measures the energy consumption and temperatures of the CPU.
+// The energy counters are polled often enough to account for wraparound.
+// For example, a benchmark harness can start a sampler before a run and divide the energy by the number of operations afterwards.
+type Sampler struct {
+	domains []EnergyDomain
+	sensors map[Core]string
+	start   time.Time
+	stop    chan struct{}
+	done    chan struct{}
+
+	mu      sync.Mutex
+	last    []uint64
+	energy  []uint64
+	temp    map[Core]float64
+	peak    map[Core]float64
+	elapsed time.Duration
+	err     error
+}
+
+// StartSampler starts measuring the energy consumption and temperatures of the CPU, polling at the specified interval.
+// An interval of a second is sufficient to account for wraparound of the energy counters.
+// If the OS does not report energy or temperatures, or the energy counters can not be read by the process (as they usually require root), the corresponding parts of the samples are empty.
+func StartSampler(interval time.Duration) (*Sampler, error) {
+	domains, err := EnergyDomains()
+	if err != nil {
+		return nil, err
+	}
+	cores, err := ListCores()
+	if err != nil {
+		return nil, err
+	}
+	sensors := make(map[Core]string)
+	for _, c := range cores {
+		path, ok, err := c.temperatureSensor()
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			sensors[c] = path
+		}
+	}
+
+	// The energy counters can only be read by root on recent kernels.
+	// If they can not be read, only the temperatures are measured, as if the OS did not support RAPL.
+	last := make([]uint64, 0, len(domains))
+	readable := domains[:0]
+	for _, d := range domains {
+		energy, err := d.Energy()
+		switch {
+		case errors.Is(err, os.ErrPermission):
+			continue
+		case err != nil:
+			return nil, err
+		}
+
+		readable = append(readable, d)
+		last = append(last, energy)
+	}
+	domains = readable
+
+	s := &Sampler{
+		domains: domains,
+		sensors: sensors,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+		last:    last,
+		energy:  make([]uint64, len(domains)),
+		temp:    make(map[Core]float64, len(sensors)),
+		peak:    make(map[Core]float64, len(sensors)),
+	}
+	s.start = time.Now()
+	if err := s.poll(); err != nil {
+		return nil, err
+	}
+
+	go s.run(interval)
+
+	return s, nil
+}
+
+// run polls the measurements until the sampler is stopped.
+func (s *Sampler) run(interval time.Duration) {
+	defer close(s.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if s.poll() != nil {
+				return
+			}
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// poll takes a measurement.
+// If a measurement fails, the sampler stops measuring and the error is reported by Sample.
+func (s *Sampler) poll() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.err != nil {
+		return s.err
+	}
+
+	for i, d := range s.domains {
+		energy, err := d.Energy()
+		if err != nil {
+			s.err = err
+			return err
+		}
+		if energy < s.last[i] {
+			// The counter wrapped.
+			s.energy[i] += d.Range - s.last[i] + energy
+		} else {
+			s.energy[i] += energy - s.last[i]
+		}
+		s.last[i] = energy
+	}
+
+	for c, path := range s.sensors {
+		temp, err := readTemperature(path)
+		if err != nil {
+			s.err = fmt.Errorf("failed to read temperature of %v: %w", c, err)
+			return s.err
+		}
+		s.temp[c] = temp
+		if peak, ok := s.peak[c]; !ok || temp > peak {
+			s.peak[c] = temp
+		}
+	}
+
+	s.elapsed = time.Since(s.start)
+
+	return nil
+}
+
+// Sample takes a measurement and summarizes the measurements since the sampler was started.
+func (s *Sampler) Sample() (Sample, error) {
+	select {
+	case <-s.done:
+		// The sampler is stopped, so report the final measurements.
+	default:
+		s.poll()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.err != nil {
+		return Sample{}, s.err
+	}
+
+	sample := Sample{
+		Duration:        s.elapsed,
+		Energy:          make(map[string]float64, len(s.domains)),
+		Temperature:     make(map[Core]float64, len(s.temp)),
+		PeakTemperature: make(map[Core]float64, len(s.peak)),
+	}
+	for i, d := range s.domains {
+		// The counters are in microjoules.
+		sample.Energy[d.Name] = float64(s.energy[i]) / 1e6
+	}
+	for c, temp := range s.temp {
+		sample.Temperature[c] = temp
+	}
+	for c, temp := range s.peak {
+		sample.PeakTemperature[c] = temp
+	}
+
+	return sample, nil
+}
+
+// Stop takes a final measurement and stops the sampler.
+// This must only be called once.
+func (s *Sampler) Stop() (Sample, error) {
+	close(s.stop)
+	<-s.done
+	s.poll()
+
+	return s.Sample()
+}
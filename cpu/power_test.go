@@ -0,0 +1,170 @@
+package cpu
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func fakeSysClass(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for path, data := range files {
+		path = filepath.Join(dir, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	old := sysClass
+	sysClass = dir
+	t.Cleanup(func() { sysClass = old })
+
+	return dir
+}
+
+func TestEnergyDomains(t *testing.T) {
+	fakeSysClass(t, map[string]string{
+		"powercap/intel-rapl:0/name":                  "package-0",
+		"powercap/intel-rapl:0/energy_uj":             "123456",
+		"powercap/intel-rapl:0/max_energy_range_uj":   "262143328850",
+		"powercap/intel-rapl:0:0/name":                "core",
+		"powercap/intel-rapl:0:0/energy_uj":           "1000",
+		"powercap/intel-rapl:0:0/max_energy_range_uj": "262143328850",
+	})
+
+	domains, err := EnergyDomains()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, d := range domains {
+		names = append(names, d.Name)
+	}
+	if expect := []string{"package-0", "package-0/core"}; !reflect.DeepEqual(names, expect) {
+		t.Fatalf("expected domains %q but got %q", expect, names)
+	}
+	if energy, err := domains[0].Energy(); err != nil || energy != 123456 {
+		t.Errorf("expected energy 123456 but got %d (%v)", energy, err)
+	}
+}
+
+func TestTemperature(t *testing.T) {
+	fakeSysfs(t, map[string]string{
+		"cpu0/topology/physical_package_id": "0",
+		"cpu0/topology/core_id":             "0",
+		"cpu1/topology/physical_package_id": "1",
+		"cpu1/topology/core_id":             "4",
+		"cpu2/topology/physical_package_id": "1",
+		"cpu2/topology/core_id":             "8",
+	})
+	fakeSysClass(t, map[string]string{
+		"hwmon/hwmon0/name":        "acpitz",
+		"hwmon/hwmon0/temp1_input": "27800",
+		"hwmon/hwmon1/name":        "coretemp",
+		"hwmon/hwmon1/temp1_label": "Package id 0",
+		"hwmon/hwmon1/temp1_input": "45000",
+		"hwmon/hwmon1/temp2_label": "Core 0",
+		"hwmon/hwmon1/temp2_input": "43000",
+		"hwmon/hwmon2/name":        "coretemp",
+		"hwmon/hwmon2/temp1_label": "Package id 1",
+		"hwmon/hwmon2/temp1_input": "52000",
+		"hwmon/hwmon2/temp2_label": "Core 4",
+		"hwmon/hwmon2/temp2_input": "51500",
+	})
+
+	for i, expect := range []float64{43, 51.5, 52} {
+		temp, ok, err := Core{uint16(i)}.Temperature()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok || temp != expect {
+			t.Errorf("expected cpu%d to be at %v°C but got %v (%v)", i, expect, temp, ok)
+		}
+	}
+}
+
+func TestSampler(t *testing.T) {
+	fakeSysfs(t, nil)
+	dir := fakeSysClass(t, map[string]string{
+		"powercap/intel-rapl:0/name":                "package-0",
+		"powercap/intel-rapl:0/energy_uj":           "900000",
+		"powercap/intel-rapl:0/max_energy_range_uj": "1000000",
+		"hwmon/hwmon0/name":                         "k10temp",
+		"hwmon/hwmon0/temp1_input":                  "60000",
+	})
+	write := func(path, data string) {
+		t.Helper()
+
+		if err := os.WriteFile(filepath.Join(dir, path), []byte(data+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s, err := StartSampler(time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Wrap the counter.
+	write("powercap/intel-rapl:0/energy_uj", "50000")
+	write("hwmon/hwmon0/temp1_input", "70000")
+	if _, err := s.Sample(); err != nil {
+		t.Fatal(err)
+	}
+	write("powercap/intel-rapl:0/energy_uj", "150000")
+	write("hwmon/hwmon0/temp1_input", "65000")
+
+	sample, err := s.Stop()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if energy := sample.Energy["package-0"]; energy != 0.25 {
+		t.Errorf("expected 0.25J but got %vJ", energy)
+	}
+	if temp := sample.Temperature[Core{0}]; temp != 65 {
+		t.Errorf("expected temperature 65°C but got %v°C", temp)
+	}
+	if temp := sample.PeakTemperature[Core{0}]; temp != 70 {
+		t.Errorf("expected peak temperature 70°C but got %v°C", temp)
+	}
+}
+
+func TestSamplerUnprivileged(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("root can read the energy counters regardless of their permissions")
+	}
+
+	fakeSysfs(t, nil)
+	dir := fakeSysClass(t, map[string]string{
+		"powercap/intel-rapl:0/name":                "package-0",
+		"powercap/intel-rapl:0/energy_uj":           "900000",
+		"powercap/intel-rapl:0/max_energy_range_uj": "1000000",
+		"hwmon/hwmon0/name":                         "k10temp",
+		"hwmon/hwmon0/temp1_input":                  "60000",
+	})
+
+	// On current kernels, the energy counters are only readable by root.
+	if err := os.Chmod(filepath.Join(dir, "powercap/intel-rapl:0/energy_uj"), 0); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := StartSampler(time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sample, err := s.Stop()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sample.Energy) != 0 {
+		t.Errorf("expected no energy measurements but got %v", sample.Energy)
+	}
+	if temp := sample.Temperature[Core{0}]; temp != 60 {
+		t.Errorf("expected temperature 60°C but got %v°C", temp)
+	}
+}
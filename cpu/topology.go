@@ -0,0 +1,168 @@
+package cpu
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// sysCPU is the sysfs directory describing the CPUs.
+// It is a variable so that tests can substitute a fake tree.
+var sysCPU = "/sys/devices/system/cpu"
+
+// Index returns the index of the core, as used by the OS.
+func (c Core) Index() int {
+	return int(c.index)
+}
+
+func (c Core) String() string {
+	return "cpu" + strconv.Itoa(int(c.index))
+}
+
+// MarshalJSON encodes the core as its index.
+func (c Core) MarshalJSON() ([]byte, error) {
+	return strconv.AppendUint(nil, uint64(c.index), 10), nil
+}
+
+// UnmarshalJSON decodes a core from its index.
+func (c *Core) UnmarshalJSON(data []byte) error {
+	index, err := strconv.ParseUint(string(data), 10, 16)
+	if err != nil {
+		return fmt.Errorf("invalid CPU %q", data)
+	}
+	c.index = uint16(index)
+
+	return nil
+}
+
+// readSys reads a file describing the core from sysfs, with surrounding whitespace removed.
+func (c Core) readSys(path string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(sysCPU, c.String(), path))
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(data)), nil
+}
+
+// readSysInt reads an integer describing the core from sysfs.
+func (c Core) readSysInt(path string) (int, error) {
+	str, err := c.readSys(path)
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.Atoi(str)
+}
+
+// Siblings lists the cores which are hardware threads (SMT siblings) of the same physical core as this core, including itself.
+// These share the execution resources of the physical core, so work pinned to them competes.
+// If the OS does not describe the topology, the core is assumed to be the only thread of its physical core.
+func (c Core) Siblings() ([]Core, error) {
+	t, err := loadTopology()
+	if err != nil {
+		return nil, err
+	}
+
+	return t.loadSiblings(c)
+}
+
+// readSiblings reads the siblings of the core from sysfs.
+func (c Core) readSiblings() ([]Core, error) {
+	list, err := c.readSys("topology/thread_siblings_list")
+	switch {
+	case os.IsNotExist(err):
+		return []Core{c}, nil
+	case err != nil:
+		return nil, fmt.Errorf("failed to read siblings of %v: %w", c, err)
+	}
+
+	cores, err := parseCPUList(list)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse siblings of %v: %w", c, err)
+	}
+
+	return cores, nil
+}
+
+// Package returns the ID of the physical package (socket) containing the core.
+func (c Core) Package() (int, error) {
+	id, err := c.readSysInt("topology/physical_package_id")
+	if err != nil {
+		return 0, fmt.Errorf("failed to read package of %v: %w", c, err)
+	}
+
+	return id, nil
+}
+
+// ListPhysicalCores lists one core for each physical core on the current machine.
+// The core listed is the lowest-numbered of its siblings which is listed by ListCores.
+// Pinning workers to these cores ensures that no two of them compete for the same physical core.
+func ListPhysicalCores() ([]Core, error) {
+	t, err := loadTopology()
+	if err != nil {
+		return nil, err
+	}
+	cores := t.cores
+
+	listed := make(map[Core]bool, len(cores))
+	for _, c := range cores {
+		listed[c] = true
+	}
+
+	var physical []Core
+	for _, c := range cores {
+		siblings, err := t.loadSiblings(c)
+		if err != nil {
+			return nil, err
+		}
+
+		// Skip the core if a lower-numbered sibling was listed.
+		first := c
+		for _, s := range siblings {
+			if s.index < first.index && listed[s] {
+				first = s
+			}
+		}
+		if first == c {
+			physical = append(physical, c)
+		}
+	}
+
+	return physical, nil
+}
+
+// parseCPUList parses a list of CPUs in the format used by Linux, such as "0-3,8,10-11".
+func parseCPUList(list string) ([]Core, error) {
+	var cores []Core
+	if list == "" {
+		return cores, nil
+	}
+
+	for _, part := range strings.Split(list, ",") {
+		lo, hi := part, part
+		if i := strings.IndexByte(part, '-'); i >= 0 {
+			lo, hi = part[:i], part[i+1:]
+		}
+
+		start, err := strconv.ParseUint(lo, 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CPU %q", lo)
+		}
+		end, err := strconv.ParseUint(hi, 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CPU %q", hi)
+		}
+		if end < start {
+			return nil, fmt.Errorf("invalid CPU range %q", part)
+		}
+
+		for i := start; i <= end; i++ {
+			cores = append(cores, Core{index: uint16(i)})
+		}
+	}
+
+	return cores, nil
+}
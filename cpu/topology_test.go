@@ -0,0 +1,89 @@
+package cpu
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseCPUList(t *testing.T) {
+	cases := []struct {
+		list   string
+		expect []int
+		err    bool
+	}{
+		{"", nil, false},
+		{"0", []int{0}, false},
+		{"0-3", []int{0, 1, 2, 3}, false},
+		{"0,4", []int{0, 4}, false},
+		{"0-1,8,10-11", []int{0, 1, 8, 10, 11}, false},
+		{"3-1", nil, true},
+		{"a", nil, true},
+		{"1-", nil, true},
+	}
+	for _, c := range cases {
+		cores, err := parseCPUList(c.list)
+		if (err != nil) != c.err {
+			t.Errorf("parsing %q: unexpected error state: %v", c.list, err)
+			continue
+		}
+		var got []int
+		for _, core := range cores {
+			got = append(got, core.Index())
+		}
+		if !reflect.DeepEqual(got, c.expect) {
+			t.Errorf("parsing %q: expected %v but got %v", c.list, c.expect, got)
+		}
+	}
+}
+
+// fakeSysfs replaces the sysfs tree with a temporary directory, populated with the specified files.
+func fakeSysfs(t *testing.T, files map[string]string) {
+	dir := t.TempDir()
+	for path, data := range files {
+		path = filepath.Join(dir, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	old := sysCPU
+	sysCPU = dir
+	t.Cleanup(func() { sysCPU = old })
+}
+
+func TestSiblings(t *testing.T) {
+	// Simulate 2 physical cores with 2 threads each, numbered in the same way as Intel CPUs.
+	fakeSysfs(t, map[string]string{
+		"cpu0/topology/thread_siblings_list": "0,2",
+		"cpu1/topology/thread_siblings_list": "1,3",
+		"cpu2/topology/thread_siblings_list": "0,2",
+		"cpu3/topology/thread_siblings_list": "1,3",
+		"cpu0/topology/physical_package_id":  "0",
+	})
+
+	siblings, err := Core{index: 2}.Siblings()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := []Core{{0}, {2}}; !reflect.DeepEqual(siblings, expect) {
+		t.Errorf("expected siblings %v but got %v", expect, siblings)
+	}
+
+	// Without topology information, a core is its own only sibling.
+	siblings, err = Core{index: 7}.Siblings()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := []Core{{7}}; !reflect.DeepEqual(siblings, expect) {
+		t.Errorf("expected siblings %v but got %v", expect, siblings)
+	}
+
+	if pkg, err := (Core{index: 0}).Package(); err != nil || pkg != 0 {
+		t.Errorf("expected package 0 but got %d (%v)", pkg, err)
+	}
+}
@@ -1,6 +1,6 @@
 module github.com/niaow/exp
 
-go 1.14
+go 1.18
 
 require (
 	github.com/klauspost/cpuid v1.2.5
@@ -0,0 +1,46 @@
+package maps
+
+// arenaChunkSize is the size of the chunks of memory which a keyArena allocates keys from.
+const arenaChunkSize = 32 << 10
+
+// arenaMaxKey is the length of the longest key which is allocated from a chunk.
+// Longer keys would waste too much of a chunk, so they are allocated separately.
+const arenaMaxKey = arenaChunkSize / 8
+
+// keyArena allocates the keys of a map out of large chunks of memory.
+// This replaces an allocation per key with an allocation per chunk, and the chunks contain no pointers, so the garbage collector does not need to scan them.
+// A chunk is only freed once none of the keys in it are referenced.
+// The space used by a deleted key is therefore not reclaimed until the other keys in its chunk are also released (normally by clearing the map).
+type keyArena struct {
+	// chunk is the unused remainder of the current chunk.
+	chunk []byte
+}
+
+// alloc copies a key into the arena.
+func (a *keyArena) alloc(key string) string {
+	if len(key) == 0 {
+		return ""
+	}
+
+	if len(key) > arenaMaxKey {
+		b := make([]byte, len(key))
+		copy(b, key)
+		return unsafeString(b)
+	}
+
+	if len(key) > len(a.chunk) {
+		// Abandon the rest of the current chunk, as it will be freed with the keys in it.
+		a.chunk = make([]byte, arenaChunkSize)
+	}
+
+	b := a.chunk[:len(key):len(key)]
+	copy(b, key)
+	a.chunk = a.chunk[len(key):]
+	return unsafeString(b)
+}
+
+// reset releases the current chunk.
+// Keys which were already allocated remain valid, as the chunks are never reused.
+func (a *keyArena) reset() {
+	a.chunk = nil
+}
@@ -0,0 +1,16 @@
+//go:build !maps_checked
+// +build !maps_checked
+
+package maps
+
+// mapChecker detects concurrent misuse of a map.
+// Checks are only enabled with the maps_checked build tag, and otherwise this is empty and the checks compile to nothing.
+type mapChecker struct{}
+
+func (*mapChecker) startWrite() {}
+
+func (*mapChecker) endWrite() {}
+
+func (*mapChecker) read() {}
+
+func (*mapChecker) iter() {}
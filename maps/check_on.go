@@ -0,0 +1,42 @@
+//go:build maps_checked
+// +build maps_checked
+
+package maps
+
+import "sync/atomic"
+
+// mapChecker detects concurrent misuse of a map.
+// Like the checks in the runtime's maps, this is best-effort: a race is only detected if the operations happen to overlap.
+// Modifying a map during iteration from the same goroutine is allowed, so iteration only checks for writes which are in progress.
+type mapChecker struct {
+	// writing is 1 while a write is in progress.
+	writing uint32
+}
+
+// startWrite marks the start of a write.
+func (c *mapChecker) startWrite() {
+	if !atomic.CompareAndSwapUint32(&c.writing, 0, 1) {
+		panic("maps: concurrent map writes")
+	}
+}
+
+// endWrite marks the end of a write.
+func (c *mapChecker) endWrite() {
+	if !atomic.CompareAndSwapUint32(&c.writing, 1, 0) {
+		panic("maps: concurrent map writes")
+	}
+}
+
+// read checks that no write is in progress before a read.
+func (c *mapChecker) read() {
+	if atomic.LoadUint32(&c.writing) != 0 {
+		panic("maps: concurrent map read and map write")
+	}
+}
+
+// iter checks that no write is in progress before each step of an iteration.
+func (c *mapChecker) iter() {
+	if atomic.LoadUint32(&c.writing) != 0 {
+		panic("maps: concurrent map iteration and map write")
+	}
+}
@@ -0,0 +1,47 @@
+//go:build maps_checked
+// +build maps_checked
+
+package maps
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestChecked(t *testing.T) {
+	t.Parallel()
+
+	// expectPanic runs a function, and checks that it panics with the specified message.
+	expectPanic := func(t *testing.T, msg string, fn func()) {
+		t.Helper()
+
+		defer func() {
+			t.Helper()
+
+			if err := recover(); err != msg {
+				t.Errorf("expected panic %q but got %v", msg, err)
+			}
+		}()
+		fn()
+	}
+
+	var m ScatterChain
+	for i := 0; i < 100; i++ {
+		m.Put(strconv.Itoa(i), i)
+	}
+
+	// Modifying the map during iteration is allowed.
+	m.Each(func(key string, value interface{}) {
+		m.Delete(key)
+		m.Put("x"+key, value)
+	})
+
+	// Simulate a write in progress on another goroutine.
+	m.check.startWrite()
+	expectPanic(t, "maps: concurrent map writes", func() { m.Put("a", 1) })
+	expectPanic(t, "maps: concurrent map writes", func() { m.Delete("x1") })
+	expectPanic(t, "maps: concurrent map read and map write", func() { m.Get("x1") })
+	expectPanic(t, "maps: concurrent map iteration and map write", func() {
+		m.Each(func(key string, value interface{}) {})
+	})
+}
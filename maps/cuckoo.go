@@ -0,0 +1,405 @@
+package maps
+
+import (
+	"fmt"
+	"math/bits"
+	"unsafe"
+)
+
+// cuckooBucketSize is the number of slots in a bucket of a CuckooTable.
+const cuckooBucketSize = 4
+
+// cuckooMaxKicks is the maximum number of pairs displaced by a single insert before the pair left over is stashed.
+const cuckooMaxKicks = 64
+
+// CuckooTable is a map implementation using bucketized cuckoo hashing.
+// The zero value is a ready-to-use empty map.
+// Each key has two candidate buckets of 4 slots, selected by two independent halves of its hash, and is always stored in one of them.
+// If both are full, an insert displaces a pair from one of them into that pair's other bucket, continuing until a free slot is found.
+// If that takes too long, the last displaced pair is put in a small stash instead, and the table grows once the stash is full.
+// A lookup therefore examines at most 3 buckets, regardless of the load or the keys, which bounds the worst-case latency of reads.
+type CuckooTable struct {
+	// buckets are where the actual data is stored.
+	// The last bucket is the stash, and the number of other buckets is always a power of two.
+	// The stash is searched by every lookup which misses both candidate buckets.
+	buckets []cuckooBucket
+
+	// n is the number of key-value pairs currently stored in the map.
+	n uint
+
+	// seed is the seed used to hash keys.
+	// This is randomly generated when the first key is hashed.
+	seed uint64
+
+	// pinned is set while a Range is iterating over the current buckets.
+	// While it is set, pairs are never moved within the buckets, so that the iteration does not miss or repeat them.
+	// It is cleared when the table grows, as the new buckets are not being iterated over.
+	pinned bool
+}
+
+type cuckooBucket struct {
+	// tags contain 8 bits of the hash of the key in each slot, with the lowest bit set.
+	// The tag of an empty slot is 0.
+	tags [cuckooBucketSize]uint8
+
+	// keys are the keys of the pairs in full slots.
+	keys [cuckooBucketSize]string
+
+	// values are the values of the pairs in full slots.
+	values [cuckooBucketSize]interface{}
+}
+
+// MakeCuckooTable makes a CuckooTable with capacity for the specified number of elements.
+func MakeCuckooTable(size uint) (res CuckooTable) {
+	res.seed = newSeed()
+	if size != 0 {
+		res.buckets = make([]cuckooBucket, cuckooBucketCount(size)+1)
+	}
+
+	return
+}
+
+// cuckooBucketCount computes the number of buckets (excluding the stash) required to hold the specified number of elements.
+func cuckooBucketCount(size uint) uint {
+	// Keep the table at most 7/8 full, as inserts into a fuller table usually displace many pairs.
+	buckets := (8*size + 7*cuckooBucketSize - 1) / (7 * cuckooBucketSize)
+	return uint(1) << bits.Len(buckets-1)
+}
+
+// hash computes the hash of a key.
+func (m *CuckooTable) hash(key string) uint64 {
+	if m.seed == 0 {
+		m.seed = newSeed()
+	}
+
+	return strhash(key, m.seed)
+}
+
+// locate finds the candidate buckets and the tag for a hash.
+func (m *CuckooTable) locate(hash uint64) (b1, b2 uint, tag uint8) {
+	mask := uint64(len(m.buckets) - 2)
+	b1, b2 = uint((hash>>32)&mask), uint(hash&mask)
+	if b1 == b2 {
+		// Always provide a second choice, unless there is only one bucket.
+		b2 = uint(uint64(b1^1) & mask)
+	}
+
+	return b1, b2, uint8(hash>>56) | 1
+}
+
+// stash returns the stash bucket.
+func (m *CuckooTable) stash() *cuckooBucket {
+	return &m.buckets[len(m.buckets)-1]
+}
+
+// find returns the index of a key in the bucket, or cuckooBucketSize if it is not present.
+func (b *cuckooBucket) find(tag uint8, key string) uint {
+	for i := uint(0); i < cuckooBucketSize; i++ {
+		if b.tags[i] == tag && b.keys[i] == key {
+			return i
+		}
+	}
+
+	return cuckooBucketSize
+}
+
+// free returns the index of an empty slot in the bucket, or cuckooBucketSize if it is full.
+func (b *cuckooBucket) free() uint {
+	for i := uint(0); i < cuckooBucketSize; i++ {
+		if b.tags[i] == 0 {
+			return i
+		}
+	}
+
+	return cuckooBucketSize
+}
+
+// lookup finds the bucket and slot of a key.
+func (m *CuckooTable) lookup(key string) (*cuckooBucket, uint, bool) {
+	if len(m.buckets) == 0 {
+		return nil, 0, false
+	}
+
+	b1, b2, tag := m.locate(m.hash(key))
+	for _, b := range [...]*cuckooBucket{&m.buckets[b1], &m.buckets[b2], m.stash()} {
+		if slot := b.find(tag, key); slot != cuckooBucketSize {
+			return b, slot, true
+		}
+	}
+
+	return nil, 0, false
+}
+
+func (m *CuckooTable) Clear() {
+	if m == nil {
+		return
+	}
+
+	for i := range m.buckets {
+		m.buckets[i] = cuckooBucket{}
+	}
+	m.n = 0
+}
+
+func (m *CuckooTable) Len() int {
+	if m == nil {
+		return 0
+	}
+
+	return int(m.n)
+}
+
+func (m *CuckooTable) Info() string {
+	var stashed int
+	if len(m.buckets) != 0 {
+		for _, tag := range m.stash().tags {
+			if tag != 0 {
+				stashed++
+			}
+		}
+	}
+
+	return fmt.Sprintf("len=%d cap=%d buckets=%d stashed=%d", m.n, len(m.buckets)*cuckooBucketSize, len(m.buckets), stashed)
+}
+
+// Stats returns statistics describing the internal state of the map.
+// The probe length of a pair is the number of buckets examined to find it: 1 or 2 for its candidate buckets, or 3 if it is stashed.
+func (m *CuckooTable) Stats() Stats {
+	if m == nil {
+		return Stats{}
+	}
+
+	s := Stats{
+		Len:      int(m.n),
+		Capacity: len(m.buckets) * cuckooBucketSize,
+		Bytes:    uintptr(len(m.buckets)) * unsafe.Sizeof(cuckooBucket{}),
+	}
+	var total int
+	m.Each(func(key string, value interface{}) {
+		b1, b2, tag := m.locate(m.hash(key))
+		probe := 3
+		switch {
+		case m.buckets[b1].find(tag, key) != cuckooBucketSize:
+			probe = 1
+		case m.buckets[b2].find(tag, key) != cuckooBucketSize:
+			probe = 2
+		}
+		total += probe
+		if probe > s.MaxProbe {
+			s.MaxProbe = probe
+		}
+	})
+	s.derive(total)
+
+	return s
+}
+
+func (m *CuckooTable) Each(fn func(key string, value interface{})) {
+	m.Range(func(key string, value interface{}) bool {
+		fn(key, value)
+		return true
+	})
+}
+
+func (m *CuckooTable) Range(fn func(key string, value interface{}) bool) {
+	if m == nil {
+		return
+	}
+
+	// Pairs are not displaced while iterating, so the buckets (including the stash) can simply be scanned in order.
+	// However, a Put during iteration may grow the table into a new set of buckets.
+	// If that happens, continue scanning the old buckets (which are left untouched by the growth) and look up each key to check that the pair is still present.
+	pinned := m.pinned
+	m.pinned = true
+	defer func() { m.pinned = pinned }()
+	buckets := m.buckets
+	for bi := range buckets {
+		for i := uint(0); i < cuckooBucketSize; i++ {
+			b := &buckets[bi]
+			if b.tags[i] == 0 {
+				continue
+			}
+
+			key, value := b.keys[i], b.values[i]
+			if len(m.buckets) != len(buckets) || &m.buckets[0] != &buckets[0] {
+				// The table was grown.
+				var ok bool
+				value, ok = m.Get(key)
+				if !ok {
+					continue
+				}
+			}
+
+			if !fn(key, value) {
+				return
+			}
+		}
+	}
+}
+
+func (m *CuckooTable) Get(key string) (interface{}, bool) {
+	if m == nil {
+		return nil, false
+	}
+
+	b, slot, ok := m.lookup(key)
+	if !ok {
+		return nil, false
+	}
+
+	return b.values[slot], true
+}
+
+func (m *CuckooTable) Put(key string, value interface{}) {
+	if b, slot, ok := m.lookup(key); ok {
+		// Update the pair in-place.
+		b.values[slot] = value
+		return
+	}
+
+	switch {
+	case len(m.buckets) == 0:
+		m.buckets = make([]cuckooBucket, 2)
+	case m.n+1 > uint(len(m.buckets)-1)*cuckooBucketSize*7/8:
+		// The table is too full.
+		m.grow()
+	}
+
+	for {
+		var ok bool
+		key, value, ok = m.insert(m.hash(key), key, value)
+		if ok {
+			return
+		}
+
+		// The stash is full, so grow the table and place the pair which was left over.
+		m.grow()
+	}
+}
+
+// grow doubles the number of buckets.
+// If the pairs do not fit in the new buckets, it keeps doubling until they do.
+// The new table is always in a new set of buckets, as Range depends on the old buckets remaining intact.
+func (m *CuckooTable) grow() {
+	old := m.buckets
+	size := 2 * uint(len(old)-1)
+	m.pinned = false
+	for {
+		m.buckets = make([]cuckooBucket, size+1)
+		m.n = 0
+		if m.rehash(old) {
+			return
+		}
+
+		size *= 2
+	}
+}
+
+// rehash inserts all of the pairs in a set of buckets into the table.
+// It returns false if the stash filled up, in which case the table must be grown further.
+func (m *CuckooTable) rehash(old []cuckooBucket) bool {
+	for bi := range old {
+		b := &old[bi]
+		for i := uint(0); i < cuckooBucketSize; i++ {
+			if b.tags[i] == 0 {
+				continue
+			}
+
+			if _, _, ok := m.insert(m.hash(b.keys[i]), b.keys[i], b.values[i]); !ok {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// insert inserts a pair which is known not to be present.
+// If the pair can not be placed because the stash is full, this returns false along with the pair which was left over.
+// The pair left over may be a different pair which was displaced, and it is not counted in the length of the table.
+func (m *CuckooTable) insert(hash uint64, key string, value interface{}) (string, interface{}, bool) {
+	m.n++
+	b1, b2, tag := m.locate(hash)
+	if m.buckets[b1].place(tag, key, value) || m.buckets[b2].place(tag, key, value) {
+		return "", nil, true
+	}
+
+	// Displace pairs until one of them can be placed in its other bucket.
+	b := b1
+	for i := 0; i < cuckooMaxKicks && !m.pinned; i++ {
+		// Vary the victim using the hash, so that a set of pairs does not get displaced around in a cycle.
+		bucket := &m.buckets[b]
+		slot := uint(hash>>8+uint64(i)) % cuckooBucketSize
+		bucket.tags[slot], tag = tag, bucket.tags[slot]
+		bucket.keys[slot], key = key, bucket.keys[slot]
+		bucket.values[slot], value = value, bucket.values[slot]
+
+		// Move the displaced pair to its other bucket.
+		hash = m.hash(key)
+		x1, x2, _ := m.locate(hash)
+		if b == x1 {
+			b = x2
+		} else {
+			b = x1
+		}
+		if m.buckets[b].place(tag, key, value) {
+			return "", nil, true
+		}
+	}
+
+	// Stash the pair which is left over.
+	if !m.stash().place(tag, key, value) {
+		m.n--
+		return key, value, false
+	}
+
+	return "", nil, true
+}
+
+// place puts a pair into an empty slot of the bucket, if there is one.
+func (b *cuckooBucket) place(tag uint8, key string, value interface{}) bool {
+	slot := b.free()
+	if slot == cuckooBucketSize {
+		return false
+	}
+
+	b.tags[slot], b.keys[slot], b.values[slot] = tag, key, value
+	return true
+}
+
+func (m *CuckooTable) Delete(key string) {
+	m.Pop(key)
+}
+
+func (m *CuckooTable) Pop(key string) (interface{}, bool) {
+	if m == nil {
+		return nil, false
+	}
+
+	b, slot, ok := m.lookup(key)
+	if !ok {
+		return nil, false
+	}
+	value := b.values[slot]
+	b.tags[slot], b.keys[slot], b.values[slot] = 0, "", nil
+	m.n--
+
+	if b != m.stash() && !m.pinned {
+		// Move a stashed pair into the free slot, if it belongs in this bucket.
+		stash := m.stash()
+		for i := uint(0); i < cuckooBucketSize; i++ {
+			if stash.tags[i] == 0 {
+				continue
+			}
+
+			b1, b2, tag := m.locate(m.hash(stash.keys[i]))
+			if &m.buckets[b1] == b || &m.buckets[b2] == b {
+				b.tags[slot], b.keys[slot], b.values[slot] = tag, stash.keys[i], stash.values[i]
+				stash.tags[i], stash.keys[i], stash.values[i] = 0, "", nil
+				break
+			}
+		}
+	}
+
+	return value, true
+}
@@ -0,0 +1,469 @@
+package maps
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+)
+
+// Operations recorded in the log of a DiskMap.
+const (
+	diskOpPut    = 1
+	diskOpDelete = 2
+)
+
+// diskHeaderSize is the size of the header of a record in the log of a DiskMap.
+// The header contains the length of the payload and the CRC-32 of the payload, both as little-endian uint32s.
+const diskHeaderSize = 8
+
+// DiskMap is a map which persists its pairs in a file, so that they survive restarts.
+// A DiskMap must be opened with OpenDiskMap, and closed with Close.
+// Every modification is appended to the file as a record, and an in-memory index (a ScatterChain) maps each key to the location of its latest value.
+// Opening the map replays the records to rebuild the index, so only the keys are held in memory.
+// Values are read from the file with ReadAt when they are needed, which is usually served from the page cache.
+// This is used instead of mapping the file into memory, as the file keeps growing and mmap is not portable.
+//
+// Values are encoded with encoding/gob, so concrete value types must be registered with gob.Register, and a value read back is a copy.
+// The Map methods cannot return errors, so the first I/O or encoding error is recorded and returned by Err, Sync, and Close.
+// Writes are buffered, so they may be lost on a crash unless Sync is called.
+// A record which was partially written when the process stopped is discarded when the map is next opened, but OpenDiskMap fails if any earlier record is corrupt.
+// Updates and deletions leave stale records in the file, which can be removed with Compact.
+type DiskMap struct {
+	// path is the path of the file.
+	path string
+
+	// f is the file, which is open for reading and writing.
+	f *os.File
+
+	// w buffers writes to the end of the file.
+	w *bufio.Writer
+
+	// index maps each key to the diskRecord of its latest value.
+	index ScatterChain
+
+	// size is the size of the file, including buffered writes.
+	size int64
+
+	// garbage is the number of bytes of stale records in the file.
+	garbage int64
+
+	// err is the first error encountered.
+	err error
+}
+
+// diskRecord is the location of a put record in the file.
+type diskRecord struct {
+	// start is the offset of the record in the file.
+	start int64
+
+	// size is the size of the entire record, including the header.
+	size uint32
+
+	// value is the offset of the encoded value within the record.
+	value uint32
+}
+
+// diskValue is the gob form of a value.
+// The value is wrapped in a struct, as gob cannot encode a nil interface on its own.
+type diskValue struct {
+	Value interface{}
+}
+
+// OpenDiskMap opens the DiskMap stored in the specified file, creating an empty map if the file does not exist.
+func OpenDiskMap(path string) (*DiskMap, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &DiskMap{path: path, f: f}
+	if err := m.load(); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to load %q: %w", path, err)
+	}
+	m.w = bufio.NewWriter(f)
+
+	return m, nil
+}
+
+// load replays the records in the file to rebuild the index.
+// A record at the end of the file which was not completely written is discarded by truncating the file.
+// A corrupt record anywhere else is an error, as the records after it are intact and must not be discarded.
+func (m *DiskMap) load() error {
+	info, err := m.f.Stat()
+	if err != nil {
+		return err
+	}
+	end := info.Size()
+
+	r := bufio.NewReader(m.f)
+	var header [diskHeaderSize]byte
+	var payload []byte
+	for {
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				break
+			}
+			return err
+		}
+		n := binary.LittleEndian.Uint32(header[0:])
+		if int64(n) > end-m.size-diskHeaderSize {
+			// The record extends past the end of the file, so it was not completely written.
+			// This also bounds the size of the buffer if the length is corrupt.
+			break
+		}
+		if cap(payload) < int(n) {
+			payload = make([]byte, n)
+		}
+		payload = payload[:n]
+		if _, err := io.ReadFull(r, payload); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				break
+			}
+			return err
+		}
+		if crc32.ChecksumIEEE(payload) != binary.LittleEndian.Uint32(header[4:]) {
+			if m.size+diskHeaderSize+int64(n) < end {
+				return fmt.Errorf("corrupt record at offset %d", m.size)
+			}
+
+			// The last record is corrupt, so it was probably not completely written.
+			break
+		}
+
+		op, key, value, err := parseDiskRecord(payload)
+		if err != nil {
+			return fmt.Errorf("invalid record at offset %d: %w", m.size, err)
+		}
+		rec := diskRecord{
+			start: m.size,
+			size:  diskHeaderSize + n,
+			value: diskHeaderSize + value,
+		}
+		m.size += int64(rec.size)
+		m.apply(op, key, rec)
+	}
+
+	// Discard the incomplete record, if there is one.
+	if err := m.f.Truncate(m.size); err != nil {
+		return err
+	}
+	_, err = m.f.Seek(m.size, io.SeekStart)
+	return err
+}
+
+// parseDiskRecord parses the payload of a record.
+// It returns the offset of the encoded value within the payload.
+func parseDiskRecord(payload []byte) (op byte, key string, value uint32, err error) {
+	if len(payload) == 0 {
+		return 0, "", 0, errors.New("empty record")
+	}
+	op = payload[0]
+	if op != diskOpPut && op != diskOpDelete {
+		return 0, "", 0, fmt.Errorf("unknown operation %d", op)
+	}
+
+	n, l := binary.Uvarint(payload[1:])
+	if l <= 0 || n > uint64(len(payload)-1-l) {
+		return 0, "", 0, errors.New("invalid key length")
+	}
+	start := 1 + l
+	return op, string(payload[start : start+int(n)]), uint32(start + int(n)), nil
+}
+
+// apply updates the index with a record.
+func (m *DiskMap) apply(op byte, key string, rec diskRecord) {
+	var old interface{}
+	var ok bool
+	switch op {
+	case diskOpPut:
+		old, ok = m.index.Get(key)
+		m.index.Put(key, rec)
+	case diskOpDelete:
+		old, ok = m.index.Pop(key)
+
+		// The deletion record itself is only needed until the put record is compacted away.
+		m.garbage += int64(rec.size)
+	}
+	if ok {
+		m.garbage += int64(old.(diskRecord).size)
+	}
+}
+
+// fail records an error, if there is not already one.
+func (m *DiskMap) fail(err error) {
+	if m.err == nil {
+		m.err = err
+	}
+}
+
+// Err returns the first error encountered by the map.
+func (m *DiskMap) Err() error {
+	return m.err
+}
+
+// append appends a record to the file.
+func (m *DiskMap) append(op byte, key string, value interface{}) (diskRecord, error) {
+	// Encode the payload after space for the header.
+	var buf bytes.Buffer
+	buf.Write(make([]byte, diskHeaderSize))
+	buf.WriteByte(op)
+	var n [binary.MaxVarintLen64]byte
+	buf.Write(n[:binary.PutUvarint(n[:], uint64(len(key)))])
+	buf.WriteString(key)
+	rec := diskRecord{start: m.size, value: uint32(buf.Len())}
+	if op == diskOpPut {
+		if err := gob.NewEncoder(&buf).Encode(diskValue{value}); err != nil {
+			return diskRecord{}, fmt.Errorf("failed to encode value of %q: %w", key, err)
+		}
+	}
+
+	// Fill in the header.
+	data := buf.Bytes()
+	binary.LittleEndian.PutUint32(data[0:], uint32(len(data)-diskHeaderSize))
+	binary.LittleEndian.PutUint32(data[4:], crc32.ChecksumIEEE(data[diskHeaderSize:]))
+
+	if _, err := m.w.Write(data); err != nil {
+		return diskRecord{}, err
+	}
+	rec.size = uint32(len(data))
+	m.size += int64(len(data))
+
+	return rec, nil
+}
+
+// read reads the value of a record.
+func (m *DiskMap) read(rec diskRecord) (interface{}, error) {
+	if m.w.Buffered() > 0 {
+		// The record may not have been written to the file yet.
+		if err := m.w.Flush(); err != nil {
+			return nil, err
+		}
+	}
+
+	data := make([]byte, rec.size-rec.value)
+	if _, err := m.f.ReadAt(data, rec.start+int64(rec.value)); err != nil {
+		return nil, err
+	}
+
+	var v diskValue
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&v); err != nil {
+		return nil, err
+	}
+
+	return v.Value, nil
+}
+
+func (m *DiskMap) Each(fn func(key string, value interface{})) {
+	m.Range(func(key string, value interface{}) bool {
+		fn(key, value)
+		return true
+	})
+}
+
+// Range invokes a function with every key-value pair, stopping early if the function returns false.
+// It inherits the same semantics as a map range loop.
+// Pairs which cannot be read are skipped, and the error is recorded.
+func (m *DiskMap) Range(fn func(key string, value interface{}) bool) {
+	m.index.Range(func(key string, rec interface{}) bool {
+		value, err := m.read(rec.(diskRecord))
+		if err != nil {
+			m.fail(fmt.Errorf("failed to read %q: %w", key, err))
+			return true
+		}
+
+		return fn(key, value)
+	})
+}
+
+// Get looks up the value of a key.
+// If the value cannot be read, the error is recorded and the key is treated as missing.
+func (m *DiskMap) Get(key string) (interface{}, bool) {
+	rec, ok := m.index.Get(key)
+	if !ok {
+		return nil, false
+	}
+
+	value, err := m.read(rec.(diskRecord))
+	if err != nil {
+		m.fail(fmt.Errorf("failed to read %q: %w", key, err))
+		return nil, false
+	}
+
+	return value, true
+}
+
+// Put sets the value of a key.
+// If the record cannot be written, the error is recorded and the map is not modified.
+func (m *DiskMap) Put(key string, value interface{}) {
+	rec, err := m.append(diskOpPut, key, value)
+	if err != nil {
+		m.fail(err)
+		return
+	}
+
+	m.apply(diskOpPut, key, rec)
+}
+
+// Delete removes a key.
+// If the record cannot be written, the error is recorded and the map is not modified.
+func (m *DiskMap) Delete(key string) {
+	if _, ok := m.index.Get(key); !ok {
+		return
+	}
+
+	rec, err := m.append(diskOpDelete, key, nil)
+	if err != nil {
+		m.fail(err)
+		return
+	}
+
+	m.apply(diskOpDelete, key, rec)
+}
+
+// Pop removes a key, and returns the value it had.
+// If the value cannot be read, the error is recorded and the key is not removed.
+func (m *DiskMap) Pop(key string) (interface{}, bool) {
+	value, ok := m.Get(key)
+	if !ok {
+		return nil, false
+	}
+
+	m.Delete(key)
+	return value, true
+}
+
+// Clear removes all pairs by truncating the file.
+func (m *DiskMap) Clear() {
+	m.w.Reset(m.f)
+	if err := m.f.Truncate(0); err != nil {
+		m.fail(err)
+		return
+	}
+	if _, err := m.f.Seek(0, io.SeekStart); err != nil {
+		m.fail(err)
+		return
+	}
+
+	m.index.Clear()
+	m.size, m.garbage = 0, 0
+}
+
+func (m *DiskMap) Len() int {
+	return m.index.Len()
+}
+
+func (m *DiskMap) Info() string {
+	return fmt.Sprintf("len=%d file=%dB garbage=%dB", m.index.Len(), m.size, m.garbage)
+}
+
+// Stats returns the statistics of the in-memory index.
+func (m *DiskMap) Stats() Stats {
+	return m.index.Stats()
+}
+
+// Garbage returns the number of bytes of stale records in the file.
+// This can be used to decide when to call Compact.
+func (m *DiskMap) Garbage() int64 {
+	return m.garbage
+}
+
+// Compact rewrites the file with only the current records, discarding stale records.
+// The new file is written alongside the old one, and then renamed over it.
+func (m *DiskMap) Compact() error {
+	if m.err != nil {
+		return m.err
+	}
+	if err := m.w.Flush(); err != nil {
+		m.fail(err)
+		return err
+	}
+
+	f, err := os.OpenFile(m.path+".compact", os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	index := MakeScatterChain(uint(m.index.Len()))
+	w := bufio.NewWriter(f)
+	var size int64
+	var data []byte
+	m.index.Each(func(key string, v interface{}) {
+		if err != nil {
+			return
+		}
+
+		// Copy the record as is.
+		rec := v.(diskRecord)
+		if cap(data) < int(rec.size) {
+			data = make([]byte, rec.size)
+		}
+		data = data[:rec.size]
+		if _, err = m.f.ReadAt(data, rec.start); err != nil {
+			return
+		}
+		if _, err = w.Write(data); err != nil {
+			return
+		}
+
+		rec.start = size
+		index.Put(key, rec)
+		size += int64(rec.size)
+	})
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), m.path)
+	}
+	if err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+
+	m.f.Close()
+	m.f, m.index, m.size, m.garbage = f, index, size, 0
+	m.w.Reset(f)
+	return nil
+}
+
+// Sync writes any buffered records, and commits the file to stable storage.
+func (m *DiskMap) Sync() error {
+	if m.err != nil {
+		return m.err
+	}
+
+	if err := m.w.Flush(); err != nil {
+		m.fail(err)
+		return err
+	}
+	if err := m.f.Sync(); err != nil {
+		m.fail(err)
+		return err
+	}
+
+	return nil
+}
+
+// Close writes any buffered records and closes the file.
+// It returns the first error encountered by the map, if there was one.
+func (m *DiskMap) Close() error {
+	err := m.w.Flush()
+	if cerr := m.f.Close(); err == nil {
+		err = cerr
+	}
+	if m.err != nil {
+		return m.err
+	}
+
+	return err
+}
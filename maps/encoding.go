@@ -0,0 +1,356 @@
+package maps
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+)
+
+// The maps can be checkpointed and restored with encoding/json and encoding/gob.
+// A map is encoded as a JSON object with its pairs in iteration order, or as a gob stream of a pair count followed by the pairs.
+// Decoding replaces the contents of a map, and the map is sized for all of the decoded pairs up front.
+// As with any interface{} values, concrete value types must be registered with gob.Register to be encoded as gob, and JSON values decode to the generic types used by encoding/json.
+
+// gobPair is the gob form of a key-value pair.
+type gobPair[K comparable, V any] struct {
+	Key   K
+	Value V
+}
+
+// pairs collects the key-value pairs of a map in iteration order.
+func pairs[K comparable, V any](m MapOf[K, V]) (keys []K, values []V) {
+	n := m.Len()
+	keys, values = make([]K, 0, n), make([]V, 0, n)
+	m.Each(func(key K, value V) {
+		keys = append(keys, key)
+		values = append(values, value)
+	})
+	return keys, values
+}
+
+// encodeJSON encodes the pairs of a map as a JSON object, in iteration order.
+func encodeJSON[K comparable, V any](m MapOf[K, V]) ([]byte, error) {
+	keys, values := pairs(m)
+
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, k := range keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+
+		name, err := jsonKey(k)
+		if err != nil {
+			return nil, err
+		}
+		key, err := json.Marshal(name)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(values[i])
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode value of %q: %w", name, err)
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+
+	return buf.Bytes(), nil
+}
+
+// decodeJSON decodes the pairs of a JSON object, in order.
+// If a key is repeated, it is returned multiple times.
+func decodeJSON[K comparable, V any](data []byte) (keys []K, values []V, err error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, nil, err
+	}
+	if tok != json.Delim('{') {
+		return nil, nil, fmt.Errorf("expected JSON object but found %v", tok)
+	}
+
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, nil, err
+		}
+		var key K
+		if err := parseJSONKey(tok.(string), &key); err != nil {
+			return nil, nil, err
+		}
+		var value V
+		if err := dec.Decode(&value); err != nil {
+			return nil, nil, err
+		}
+
+		keys = append(keys, key)
+		values = append(values, value)
+	}
+
+	if _, err := dec.Token(); err != nil {
+		return nil, nil, err
+	}
+
+	return keys, values, nil
+}
+
+// jsonKey formats a key as the name of a JSON object member, in the same way as encoding/json formats the keys of a Go map.
+func jsonKey(key interface{}) (string, error) {
+	v := reflect.ValueOf(key)
+	if v.Kind() == reflect.String {
+		return v.String(), nil
+	}
+	if tm, ok := key.(encoding.TextMarshaler); ok {
+		text, err := tm.MarshalText()
+		return string(text), err
+	}
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(v.Uint(), 10), nil
+	default:
+		return "", fmt.Errorf("unsupported key type %T", key)
+	}
+}
+
+// parseJSONKey parses the name of a JSON object member into the key pointed to by dst, in the same way as encoding/json parses the keys of a Go map.
+func parseJSONKey(name string, dst interface{}) error {
+	v := reflect.ValueOf(dst).Elem()
+	if v.Kind() == reflect.String {
+		v.SetString(name)
+		return nil
+	}
+	if tu, ok := dst.(encoding.TextUnmarshaler); ok {
+		return tu.UnmarshalText([]byte(name))
+	}
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(name, 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid key %q: %w", name, err)
+		}
+		v.SetInt(n)
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n, err := strconv.ParseUint(name, 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid key %q: %w", name, err)
+		}
+		v.SetUint(n)
+		return nil
+	default:
+		return fmt.Errorf("unsupported key type %s", v.Type())
+	}
+}
+
+// encodeGob encodes the pairs of a map as a gob stream, in iteration order.
+func encodeGob[K comparable, V any](m MapOf[K, V]) ([]byte, error) {
+	keys, values := pairs(m)
+
+	var buf bytes.Buffer
+	enc := gob.NewEncoder(&buf)
+	if err := enc.Encode(len(keys)); err != nil {
+		return nil, err
+	}
+	for i, k := range keys {
+		if err := enc.Encode(gobPair[K, V]{k, values[i]}); err != nil {
+			return nil, fmt.Errorf("failed to encode pair %#v: %w", k, err)
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+// decodeGob decodes the pairs of a gob stream, in order.
+func decodeGob[K comparable, V any](data []byte) (keys []K, values []V, err error) {
+	dec := gob.NewDecoder(bytes.NewReader(data))
+	var n int
+	if err := dec.Decode(&n); err != nil {
+		return nil, nil, err
+	}
+
+	keys, values = make([]K, 0, n), make([]V, 0, n)
+	for i := 0; i < n; i++ {
+		// Gob does not transmit zero values, so each pair must be decoded into a fresh variable.
+		var p gobPair[K, V]
+		if err := dec.Decode(&p); err != nil {
+			return nil, nil, err
+		}
+
+		keys = append(keys, p.Key)
+		values = append(values, p.Value)
+	}
+
+	return keys, values, nil
+}
+
+func (m *ScatterChainOf[K, V]) MarshalJSON() ([]byte, error) {
+	return encodeJSON[K, V](m)
+}
+
+// UnmarshalJSON replaces the contents of the map with the pairs of a JSON object.
+// Keys are decoded in the same way as the keys of a Go map, so they must have a string or integer type, or implement encoding.TextUnmarshaler.
+func (m *ScatterChainOf[K, V]) UnmarshalJSON(data []byte) error {
+	keys, values, err := decodeJSON[K, V](data)
+	if err != nil {
+		return err
+	}
+
+	m.load(keys, values)
+	return nil
+}
+
+func (m *ScatterChainOf[K, V]) GobEncode() ([]byte, error) {
+	return encodeGob[K, V](m)
+}
+
+func (m *ScatterChainOf[K, V]) GobDecode(data []byte) error {
+	keys, values, err := decodeGob[K, V](data)
+	if err != nil {
+		return err
+	}
+
+	m.load(keys, values)
+	return nil
+}
+
+// load replaces the contents of the map with the specified pairs.
+func (m *ScatterChainOf[K, V]) load(keys []K, values []V) {
+	m.Clear()
+	m.Reserve(uint(len(keys)))
+	for i, k := range keys {
+		m.Put(k, values[i])
+	}
+}
+
+func (m *SwissTable) MarshalJSON() ([]byte, error) {
+	return encodeJSON[string, interface{}](m)
+}
+
+func (m *SwissTable) UnmarshalJSON(data []byte) error {
+	keys, values, err := decodeJSON[string, interface{}](data)
+	if err != nil {
+		return err
+	}
+
+	m.load(keys, values)
+	return nil
+}
+
+func (m *SwissTable) GobEncode() ([]byte, error) {
+	return encodeGob[string, interface{}](m)
+}
+
+func (m *SwissTable) GobDecode(data []byte) error {
+	keys, values, err := decodeGob[string, interface{}](data)
+	if err != nil {
+		return err
+	}
+
+	m.load(keys, values)
+	return nil
+}
+
+// load replaces the contents of the map with the specified pairs.
+func (m *SwissTable) load(keys []string, values []interface{}) {
+	m.Clear()
+	m.Reserve(uint(len(keys)))
+	for i, k := range keys {
+		m.Put(k, values[i])
+	}
+}
+
+func (m *OrderedMap) MarshalJSON() ([]byte, error) {
+	return encodeJSON[string, interface{}](m)
+}
+
+// UnmarshalJSON replaces the contents of the map with the pairs of a JSON object.
+// The pairs are inserted in the order that they appear in the object.
+func (m *OrderedMap) UnmarshalJSON(data []byte) error {
+	keys, values, err := decodeJSON[string, interface{}](data)
+	if err != nil {
+		return err
+	}
+
+	m.load(keys, values)
+	return nil
+}
+
+func (m *OrderedMap) GobEncode() ([]byte, error) {
+	return encodeGob[string, interface{}](m)
+}
+
+func (m *OrderedMap) GobDecode(data []byte) error {
+	keys, values, err := decodeGob[string, interface{}](data)
+	if err != nil {
+		return err
+	}
+
+	m.load(keys, values)
+	return nil
+}
+
+// load replaces the contents of the map with the specified pairs, in order.
+func (m *OrderedMap) load(keys []string, values []interface{}) {
+	m.Clear()
+	m.index.Reserve(uint(len(keys)))
+	for i, k := range keys {
+		m.Put(k, values[i])
+	}
+}
+
+func (m *Sharded) MarshalJSON() ([]byte, error) {
+	return encodeJSON[string, interface{}](m)
+}
+
+// UnmarshalJSON replaces the contents of the map with the pairs of a JSON object.
+// The map must have been created with NewSharded.
+func (m *Sharded) UnmarshalJSON(data []byte) error {
+	keys, values, err := decodeJSON[string, interface{}](data)
+	if err != nil {
+		return err
+	}
+
+	m.load(keys, values)
+	return nil
+}
+
+func (m *Sharded) GobEncode() ([]byte, error) {
+	return encodeGob[string, interface{}](m)
+}
+
+// GobDecode replaces the contents of the map with the pairs of a gob stream.
+// The map must have been created with NewSharded.
+func (m *Sharded) GobDecode(data []byte) error {
+	keys, values, err := decodeGob[string, interface{}](data)
+	if err != nil {
+		return err
+	}
+
+	m.load(keys, values)
+	return nil
+}
+
+// load replaces the contents of the map with the specified pairs.
+// The pairs are not inserted atomically, so concurrent readers may observe a partially loaded map.
+func (m *Sharded) load(keys []string, values []interface{}) {
+	per := (uint(len(keys)) + uint(len(m.shards)) - 1) / uint(len(m.shards))
+	for i := range m.shards {
+		s := &m.shards[i]
+		s.mu.Lock()
+		s.m.Clear()
+		s.m.Reserve(per)
+		s.mu.Unlock()
+	}
+	for i, k := range keys {
+		m.Put(k, values[i])
+	}
+}
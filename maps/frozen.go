@@ -0,0 +1,200 @@
+package maps
+
+import (
+	"fmt"
+	"math/bits"
+	"sort"
+	"unsafe"
+)
+
+// frozenBucketSize is the average number of keys per bucket of a Frozen map.
+// Larger buckets use less memory for displacements, but take longer to build.
+const frozenBucketSize = 4
+
+// frozenMaxDisplacement is the number of displacements tried for a bucket before the build is restarted with a different seed.
+const frozenMaxDisplacement = 1 << 20
+
+// Frozen is an immutable map, built once with Freeze and then only read.
+// It uses a minimal perfect hash function constructed with the CHD (compress, hash, displace) algorithm.
+// Every key maps to a distinct slot, and there are exactly as many slots as keys, so a lookup hashes the key once and then compares a single key.
+// Besides the pairs themselves, it only uses about 1 byte per key.
+// This is intended for lookup tables which are built at startup and never modified, such as keyword tables or routing tables.
+type Frozen struct {
+	// keys are the keys of the pairs, indexed by slot.
+	keys []string
+
+	// values are the values of the pairs, indexed by slot.
+	values []interface{}
+
+	// displacements are the displacements of each bucket.
+	// The slot of a key is selected by rehashing its hash with the displacement of its bucket.
+	displacements []uint32
+
+	// seed is the seed used to hash keys.
+	seed uint64
+}
+
+// frozenRange maps a hash onto [0, n) without division.
+func frozenRange(hash uint64, n int) int {
+	hi, _ := bits.Mul64(hash, uint64(n))
+	return int(hi)
+}
+
+// frozenSlot selects the slot of a key with the specified hash and displacement.
+func frozenSlot(hash uint64, d uint32, n int) int {
+	return frozenRange(wymix(hash, uint64(d)^wyp0), n)
+}
+
+// Freeze builds a Frozen map containing the pairs of a map.
+// This takes roughly linear time in the number of pairs, but is much slower than inserting them into a hash table.
+func Freeze(m Map) *Frozen {
+	keys, values := pairs(m)
+	n := len(keys)
+	if n == 0 {
+		return &Frozen{}
+	}
+
+	f := &Frozen{
+		keys:          make([]string, n),
+		values:        make([]interface{}, n),
+		displacements: make([]uint32, (n+frozenBucketSize-1)/frozenBucketSize),
+	}
+	hashes := make([]uint64, n)
+	buckets := make([][]int, len(f.displacements))
+	order := make([]int, len(f.displacements))
+	used := make([]bool, n)
+	var slots []int
+	for {
+		f.seed = newSeed()
+
+		// Distribute the keys into buckets.
+		for i := range buckets {
+			buckets[i] = buckets[i][:0]
+			order[i] = i
+		}
+		for i, k := range keys {
+			hashes[i] = strhash(k, f.seed)
+			b := frozenRange(hashes[i], len(buckets))
+			buckets[b] = append(buckets[b], i)
+		}
+		for i := range used {
+			used[i] = false
+		}
+
+		// Place the largest buckets first, while there are the most free slots.
+		sort.Slice(order, func(i, j int) bool {
+			return len(buckets[order[i]]) > len(buckets[order[j]])
+		})
+		ok := true
+		for _, b := range order {
+			if len(buckets[b]) == 0 {
+				// The rest of the buckets are empty.
+				break
+			}
+
+			if slots, ok = f.displace(b, buckets[b], hashes, used, slots[:0]); !ok {
+				break
+			}
+			for j, i := range buckets[b] {
+				f.keys[slots[j]], f.values[slots[j]] = keys[i], values[i]
+			}
+		}
+		if ok {
+			return f
+		}
+	}
+}
+
+// displace finds a displacement for a bucket which places all of its keys into distinct unused slots.
+// The displacement is stored, the slots are marked as used, and the slots are returned in the order of the keys.
+func (f *Frozen) displace(b int, bucket []int, hashes []uint64, used []bool, slots []int) ([]int, bool) {
+search:
+	for d := uint32(0); d < frozenMaxDisplacement; d++ {
+		slots = slots[:0]
+		for _, i := range bucket {
+			slot := frozenSlot(hashes[i], d, len(used))
+			if used[slot] {
+				continue search
+			}
+			for _, s := range slots {
+				if s == slot {
+					continue search
+				}
+			}
+			slots = append(slots, slot)
+		}
+
+		f.displacements[b] = d
+		for _, s := range slots {
+			used[s] = true
+		}
+		return slots, true
+	}
+
+	return slots, false
+}
+
+func (f *Frozen) Each(fn func(key string, value interface{})) {
+	f.Range(func(key string, value interface{}) bool {
+		fn(key, value)
+		return true
+	})
+}
+
+// Range invokes a function with every key-value pair, stopping early if the function returns false.
+// The pairs are visited in slot order, which is the same for every iteration.
+func (f *Frozen) Range(fn func(key string, value interface{}) bool) {
+	if f == nil {
+		return
+	}
+
+	for i, k := range f.keys {
+		if !fn(k, f.values[i]) {
+			return
+		}
+	}
+}
+
+func (f *Frozen) Get(key string) (interface{}, bool) {
+	if f == nil || len(f.keys) == 0 {
+		return nil, false
+	}
+
+	hash := strhash(key, f.seed)
+	slot := frozenSlot(hash, f.displacements[frozenRange(hash, len(f.displacements))], len(f.keys))
+	if f.keys[slot] != key {
+		return nil, false
+	}
+
+	return f.values[slot], true
+}
+
+func (f *Frozen) Len() int {
+	if f == nil {
+		return 0
+	}
+
+	return len(f.keys)
+}
+
+func (f *Frozen) Info() string {
+	return fmt.Sprintf("len=%d buckets=%d", f.Len(), len(f.displacements))
+}
+
+// Stats returns statistics describing the internal state of the map.
+// Every lookup examines exactly one slot.
+func (f *Frozen) Stats() Stats {
+	if f == nil || len(f.keys) == 0 {
+		return Stats{}
+	}
+
+	s := Stats{
+		Len:      len(f.keys),
+		Capacity: len(f.keys),
+		MaxProbe: 1,
+		Bytes:    uintptr(len(f.keys))*(unsafe.Sizeof("")+unsafe.Sizeof(interface{}(nil))) + uintptr(len(f.displacements))*unsafe.Sizeof(uint32(0)),
+	}
+	s.derive(len(f.keys))
+
+	return s
+}
@@ -0,0 +1,93 @@
+package maps
+
+import "math/bits"
+
+// Portable string hash functions, used when the runtime's hash function is not available.
+// The build tags in the strhash_*.go files select the implementation of strhash:
+//   - With the gc toolchain, the runtime's string hash is used, which is hardware-accelerated on most platforms.
+//   - With other toolchains (such as tinygo or gccgo), or with the maps_wyhash build tag, wyhash is used.
+//   - With the maps_fnv build tag, FNV-1a is used.
+// FNV-1a is simpler, but much slower for long keys and does not distribute the bits as well.
+
+// Constants of wyhash.
+const (
+	wyp0 = 0xa0761d6478bd642f
+	wyp1 = 0xe7037ed1a0b428db
+	wyp2 = 0x8ebc6af09c88c6e3
+	wyp3 = 0x589965cc75374cc3
+)
+
+// wyhash hashes a string with wyhash.
+// This follows the structure of the runtime's portable hash function (which is also based on wyhash).
+func wyhash(str string, seed uint64) uint64 {
+	n := len(str)
+	seed ^= wyp0
+	var a, b uint64
+	switch {
+	case n == 0:
+	case n < 4:
+		a = uint64(str[0])<<16 | uint64(str[n>>1])<<8 | uint64(str[n-1])
+	case n <= 8:
+		a, b = wyr4(str, 0), wyr4(str, n-4)
+	case n <= 16:
+		a, b = wyr8(str, 0), wyr8(str, n-8)
+	default:
+		i := 0
+		if n > 48 {
+			seed1, seed2 := seed, seed
+			for ; n-i > 48; i += 48 {
+				seed = wymix(wyr8(str, i)^wyp1, wyr8(str, i+8)^seed)
+				seed1 = wymix(wyr8(str, i+16)^wyp2, wyr8(str, i+24)^seed1)
+				seed2 = wymix(wyr8(str, i+32)^wyp3, wyr8(str, i+40)^seed2)
+			}
+			seed ^= seed1 ^ seed2
+		}
+		for ; n-i > 16; i += 16 {
+			seed = wymix(wyr8(str, i)^wyp1, wyr8(str, i+8)^seed)
+		}
+		a, b = wyr8(str, n-16), wyr8(str, n-8)
+	}
+
+	return wymix(wyp1^uint64(n), wymix(a^wyp1, b^seed))
+}
+
+// wymix multiplies two values, and folds the 128-bit product.
+func wymix(a, b uint64) uint64 {
+	hi, lo := bits.Mul64(a, b)
+	return hi ^ lo
+}
+
+// wyr4 reads 4 little-endian bytes from a string.
+func wyr4(str string, i int) uint64 {
+	_ = str[i+3]
+	return uint64(str[i]) | uint64(str[i+1])<<8 | uint64(str[i+2])<<16 | uint64(str[i+3])<<24
+}
+
+// wyr8 reads 8 little-endian bytes from a string.
+func wyr8(str string, i int) uint64 {
+	return wyr4(str, i) | wyr4(str, i+4)<<32
+}
+
+// fnvhash hashes a string with FNV-1a.
+// The multiplications only carry changes upwards, so the low bits of FNV-1a are poorly mixed for short keys.
+// The tables use both the upper and lower bits of the hash, so the result is finalized with the fmix64 step of MurmurHash3 to spread every bit across the whole hash.
+func fnvhash(str string, seed uint64) uint64 {
+	hash := uint64(0xcbf29ce484222325) ^ seed
+	for i := 0; i < len(str); i++ {
+		hash ^= uint64(str[i])
+		hash *= 0x100000001b3
+	}
+
+	return fmix64(hash)
+}
+
+// fmix64 is the finalizer of MurmurHash3, which makes every bit of the result depend on every bit of the input.
+func fmix64(h uint64) uint64 {
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb34fe63a2ad3
+	h ^= h >> 33
+
+	return h
+}
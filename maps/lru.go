@@ -0,0 +1,301 @@
+package maps
+
+import (
+	"fmt"
+	"unsafe"
+)
+
+// NewLRU creates an LRU cache which holds entries with a total cost of at most capacity.
+// If onEvict is not nil, it is called with each pair evicted to make room for another.
+func NewLRU(capacity uint, onEvict func(key string, value interface{})) *LRU {
+	return &LRU{
+		capacity: capacity,
+		onEvict:  onEvict,
+	}
+}
+
+// NewWeightedLRU creates an LRU cache where the cost of each pair is computed by a weigh function.
+// The capacity is a budget for the total weight, such as a number of bytes.
+// Put weighs each pair, so PutCost is only needed to override the weight of a pair.
+// If onEvict is not nil, it is called with each pair evicted to make room for another.
+func NewWeightedLRU(budget uint, weigh func(key string, value interface{}) uint, onEvict func(key string, value interface{})) *LRU {
+	return &LRU{
+		capacity: budget,
+		weigh:    weigh,
+		onEvict:  onEvict,
+	}
+}
+
+// WeighBytes is a weigh function for NewWeightedLRU, which weighs a pair by the length of its key and value.
+// The value must be a []byte or a string, and other values are weighed by their key alone.
+// The overhead of the cache itself is not included.
+func WeighBytes(key string, value interface{}) uint {
+	switch v := value.(type) {
+	case []byte:
+		return uint(len(key) + len(v))
+	case string:
+		return uint(len(key) + len(v))
+	default:
+		return uint(len(key))
+	}
+}
+
+// LRU is a cache which evicts the least recently used pairs once the total cost of its pairs exceeds its capacity.
+// Pairs are stored in a ScatterChain, so the memory used by the cache is predictable from its maximum number of entries.
+// By default each pair has a cost of 1, in which case the capacity is the maximum number of pairs.
+// Both Get and Put mark a pair as recently used.
+// An LRU must be created with NewLRU.
+type LRU struct {
+	// entries maps each key to its entry.
+	entries ScatterChain
+
+	// oldest and newest are the ends of the list of entries, ordered by the last use.
+	oldest, newest *lruEntry
+
+	// capacity is the maximum total cost.
+	capacity uint
+
+	// cost is the current total cost.
+	cost uint
+
+	// weigh computes the cost of a pair inserted with Put.
+	// If it is nil, each pair has a cost of 1.
+	weigh func(key string, value interface{}) uint
+
+	// onEvict is called with evicted pairs.
+	onEvict func(key string, value interface{})
+}
+
+// lruEntry is an entry in an LRU cache.
+type lruEntry struct {
+	key   string
+	value interface{}
+	cost  uint
+
+	// prev and next are the neighbouring entries, where next is the more recently used.
+	prev, next *lruEntry
+
+	// removed is set when the entry is removed from the cache.
+	removed bool
+}
+
+// entry finds the entry of a key.
+func (c *LRU) entry(key string) *lruEntry {
+	e, ok := c.entries.Get(key)
+	if !ok {
+		return nil
+	}
+
+	return e.(*lruEntry)
+}
+
+// unlink removes an entry from the list.
+func (c *LRU) unlink(e *lruEntry) {
+	if e.prev != nil {
+		e.prev.next = e.next
+	} else {
+		c.oldest = e.next
+	}
+	if e.next != nil {
+		e.next.prev = e.prev
+	} else {
+		c.newest = e.prev
+	}
+	e.prev, e.next = nil, nil
+}
+
+// pushNewest links an entry to the most recently used end of the list.
+func (c *LRU) pushNewest(e *lruEntry) {
+	e.prev, e.next = c.newest, nil
+	if c.newest != nil {
+		c.newest.next = e
+	} else {
+		c.oldest = e
+	}
+	c.newest = e
+}
+
+// touch marks an entry as the most recently used.
+func (c *LRU) touch(e *lruEntry) {
+	if c.newest == e {
+		return
+	}
+
+	c.unlink(e)
+	c.pushNewest(e)
+}
+
+// remove removes an entry from the cache.
+func (c *LRU) remove(e *lruEntry) {
+	c.entries.Delete(e.key)
+	c.detach(e)
+}
+
+// detach removes an entry which has already been removed from the index.
+func (c *LRU) detach(e *lruEntry) {
+	c.unlink(e)
+	c.cost -= e.cost
+	e.removed = true
+}
+
+// Each invokes a function with every key-value pair, from the most to the least recently used.
+// This does not change the order of use.
+// It inherits the same semantics as a map range loop.
+func (c *LRU) Each(fn func(key string, value interface{})) {
+	c.Range(func(key string, value interface{}) bool {
+		fn(key, value)
+		return true
+	})
+}
+
+// Range invokes a function with every key-value pair from the most to the least recently used, stopping early if the function returns false.
+// It has the same semantics as Each.
+func (c *LRU) Range(fn func(key string, value interface{}) bool) {
+	// Calls to Get may reorder the list during the iteration, so take a snapshot of the entries first.
+	entries := make([]*lruEntry, 0, c.entries.Len())
+	for e := c.newest; e != nil; e = e.prev {
+		entries = append(entries, e)
+	}
+
+	for _, e := range entries {
+		if e.removed {
+			continue
+		}
+
+		if !fn(e.key, e.value) {
+			return
+		}
+	}
+}
+
+// Get checks if the key is present, marking it as the most recently used if it is.
+// If it is not present, the second return is false.
+func (c *LRU) Get(key string) (interface{}, bool) {
+	e := c.entry(key)
+	if e == nil {
+		return nil, false
+	}
+
+	c.touch(e)
+	return e.value, true
+}
+
+// Peek checks if the key is present, without changing the order of use.
+// If it is not present, the second return is false.
+func (c *LRU) Peek(key string) (interface{}, bool) {
+	e := c.entry(key)
+	if e == nil {
+		return nil, false
+	}
+
+	return e.value, true
+}
+
+// Put a key-value pair in the cache with a cost of 1, or the weight of the pair if the cache was created with NewWeightedLRU.
+// See PutCost.
+func (c *LRU) Put(key string, value interface{}) {
+	cost := uint(1)
+	if c.weigh != nil {
+		cost = c.weigh(key, value)
+	}
+
+	c.PutCost(key, value, cost)
+}
+
+// PutCost puts a key-value pair in the cache with a specified cost, and marks it as the most recently used.
+// If the key is already present in the cache, the value and cost are updated.
+// The least recently used pairs are then evicted until the total cost is within the capacity.
+// If the cost of the pair alone exceeds the capacity, the pair itself is evicted.
+func (c *LRU) PutCost(key string, value interface{}, cost uint) {
+	if e := c.entry(key); e != nil {
+		e.value = value
+		c.cost += cost - e.cost
+		e.cost = cost
+		c.touch(e)
+	} else {
+		e := &lruEntry{key: key, value: value, cost: cost}
+		c.entries.Put(key, e)
+		c.pushNewest(e)
+		c.cost += cost
+	}
+
+	c.evict()
+}
+
+// evict removes the least recently used pairs until the total cost is within the capacity.
+func (c *LRU) evict() {
+	for c.cost > c.capacity {
+		e := c.oldest
+		c.remove(e)
+		if c.onEvict != nil {
+			c.onEvict(e.key, e.value)
+		}
+	}
+}
+
+// Remove the key from the cache.
+// If it is not present, nothing happens.
+// The eviction callback is not called.
+func (c *LRU) Delete(key string) {
+	c.Pop(key)
+}
+
+// Pop removes the key from the cache, and returns the value it had.
+// If it is not present, the second return is false.
+// The eviction callback is not called.
+func (c *LRU) Pop(key string) (interface{}, bool) {
+	v, ok := c.entries.Pop(key)
+	if !ok {
+		return nil, false
+	}
+
+	e := v.(*lruEntry)
+	c.detach(e)
+	value := e.value
+	e.value = nil
+	return value, true
+}
+
+// Clear removes all key-value pairs from the cache.
+// The eviction callback is not called.
+func (c *LRU) Clear() {
+	for e := c.oldest; e != nil; e = e.next {
+		e.removed = true
+		e.value = nil
+	}
+	c.oldest, c.newest = nil, nil
+	c.entries.Clear()
+	c.cost = 0
+}
+
+func (c *LRU) Len() int {
+	return c.entries.Len()
+}
+
+// Cost returns the total cost of the pairs in the cache.
+func (c *LRU) Cost() uint {
+	return c.cost
+}
+
+// Capacity returns the maximum total cost of the pairs in the cache.
+func (c *LRU) Capacity() uint {
+	return c.capacity
+}
+
+// SetCapacity changes the maximum total cost of the pairs in the cache.
+// If the capacity is reduced, the least recently used pairs are evicted until the total cost is within the new capacity.
+func (c *LRU) SetCapacity(capacity uint) {
+	c.capacity = capacity
+	c.evict()
+}
+
+func (c *LRU) Info() string {
+	return fmt.Sprintf("len=%d cost=%d capacity=%d", c.entries.Len(), c.cost, c.capacity)
+}
+
+// Stats returns the statistics of the index, including the memory used by the list entries.
+func (c *LRU) Stats() Stats {
+	s := c.entries.Stats()
+	s.Bytes += uintptr(s.Len) * unsafe.Sizeof(lruEntry{})
+	return s
+}
@@ -2,29 +2,132 @@ package maps
 
 import (
 	"fmt"
+	"hash/maphash"
 
-	_ "unsafe"
+	"unsafe"
 )
 
-type Map interface {
+// MapOf is a map with keys of type K and values of type V.
+type MapOf[K comparable, V any] interface {
 	// Each invokes a function with every key-value pair.
 	// It inherits the same semantics as a map range loop.
-	Each(func(key string, value interface{}))
+	Each(func(key K, value V))
+
+	// Range invokes a function with every key-value pair, stopping early if the function returns false.
+	// It inherits the same semantics as a map range loop.
+	// Range has the signature of a range-over-func iterator, so m.Range may be used directly in a range loop.
+	Range(func(key K, value V) bool)
 
 	// Get checks if the key is present.
 	// If it is not present, the second return is false.
-	Get(key string) (interface{}, bool)
+	Get(key K) (V, bool)
 
 	// Put a key-value pair in the map.
 	// If the key is already present in the map, the value is updated.
-	Put(key string, value interface{})
+	Put(key K, value V)
 
 	// Remove the key from the map.
 	// If it is not present, nothing happens.
-	Delete(key string)
+	Delete(key K)
+
+	// Pop removes the key from the map, and returns the value it had.
+	// If it is not present, the second return is false.
+	Pop(key K) (V, bool)
+
+	// Clear removes all key-value pairs from the map.
+	// Allocated capacity is retained, so the map can be refilled without reallocating.
+	Clear()
+
+	// Len returns the number of key-value pairs in the map.
+	Len() int
 
 	// Info spits out miscellaneous statistics for debugging purposes.
 	Info() string
+
+	// Stats returns statistics describing the internal state of the map.
+	Stats() Stats
+}
+
+// Map is a MapOf with string keys and interface{} values.
+// This is the interface implemented by most of the maps in this package, which predate type parameters.
+type Map = MapOf[string, interface{}]
+
+// Stats are statistics describing the internal state of a map, for monitoring and tests.
+// Fields which do not apply to an implementation, or which it cannot measure, are 0.
+type Stats struct {
+	// Len is the number of key-value pairs in the map.
+	Len int
+
+	// Capacity is the number of slots for pairs which have been allocated.
+	// A map may need to grow before all of its slots are used.
+	Capacity int
+
+	// Heads is the number of collision chains in a chained hash table.
+	// Len-Heads pairs are stored outside of their primary slot.
+	Heads int
+
+	// MaxProbe is the largest number of slots, groups, or nodes examined to find a present key.
+	MaxProbe int
+
+	// MeanProbe is the average number of slots, groups, or nodes examined to find a present key.
+	MeanProbe float64
+
+	// Bytes is the approximate memory used by the structure of the map.
+	// This does not include the memory referenced by keys or values.
+	Bytes uintptr
+
+	// LoadFactor is the ratio of Len to Capacity.
+	LoadFactor float64
+}
+
+// derive fills in the fields which are computed from the other fields, given the total probe length of all pairs.
+func (s *Stats) derive(totalProbe int) {
+	if s.Len != 0 {
+		s.MeanProbe = float64(totalProbe) / float64(s.Len)
+	}
+	if s.Capacity != 0 {
+		s.LoadFactor = float64(s.Len) / float64(s.Capacity)
+	}
+}
+
+// All returns an iterator over the key-value pairs of a map.
+// It is compatible with iter.Seq2[string, interface{}], for use in range loops.
+func All(m Map) func(yield func(key string, value interface{}) bool) {
+	return m.Range
+}
+
+// Keys returns the keys of a map in iteration order.
+func Keys(m Map) []string {
+	return AppendKeys(make([]string, 0, m.Len()), m)
+}
+
+// AppendKeys appends the keys of a map to dst in iteration order, and returns the extended slice.
+// This can be used to reuse a slice across calls.
+func AppendKeys(dst []string, m Map) []string {
+	m.Each(func(key string, value interface{}) {
+		dst = append(dst, key)
+	})
+	return dst
+}
+
+// Values returns the values of a map in iteration order.
+func Values(m Map) []interface{} {
+	values := make([]interface{}, 0, m.Len())
+	m.Each(func(key string, value interface{}) {
+		values = append(values, value)
+	})
+	return values
+}
+
+// EachSnapshot invokes a function with every key-value pair present when it is called.
+// Unlike Each, the keys are copied before visiting any pairs, so pairs inserted by the function are never visited, and the function may modify the map freely without slowing down the iteration.
+// Pairs which are deleted before they are reached are not visited, and the value visited is the current value of the pair.
+func EachSnapshot(m Map, fn func(key string, value interface{})) {
+	for _, k := range Keys(m) {
+		if v, ok := m.Get(k); ok {
+			fn(k, v)
+		}
+	}
 }
 
 // Go is Go's implementation of a map.
@@ -36,6 +139,14 @@ func (m Go) Each(fn func(key string, value interface{})) {
 	}
 }
 
+func (m Go) Range(fn func(key string, value interface{}) bool) {
+	for k, v := range m {
+		if !fn(k, v) {
+			return
+		}
+	}
+}
+
 func (m Go) Get(key string) (interface{}, bool) {
 	v, ok := m[key]
 	return v, ok
@@ -49,28 +160,47 @@ func (m Go) Delete(key string) {
 	delete(m, key)
 }
 
+func (m Go) Pop(key string) (interface{}, bool) {
+	v, ok := m[key]
+	if ok {
+		delete(m, key)
+	}
+	return v, ok
+}
+
+func (m Go) Clear() {
+	for k := range m {
+		delete(m, k)
+	}
+}
+
+func (m Go) Len() int {
+	return len(m)
+}
+
 func (m Go) Info() string {
 	return fmt.Sprintf("len=%d", len(m))
 }
 
-//go:linkname runtime_stringHash runtime.stringHash
-//go:noescape
-func runtime_stringHash(str string, seed uintptr) uintptr
+// Stats only reports the length, as the internals of Go's maps are not accessible.
+func (m Go) Stats() Stats {
+	return Stats{Len: len(m)}
+}
 
-func strhash(str string) uint64 {
-	return uint64(runtime_stringHash(str, 0x3a753e5aea42b0e7))
+// unsafeString views a byte slice as a string without copying it.
+// The string must not be retained, as the bytes may later be modified.
+func unsafeString(b []byte) string {
+	return *(*string)(unsafe.Pointer(&b))
 }
 
-// Use this if not running on the standard Go toolchain: (TODO: build tags)
-/*
-func strhash(str string) uint64 {
-	// FNV1a reversed
-	hash := uint64(0xcbf29ce484222325)
-	for _, b := range []byte(str) {
-		hash ^= uint64(b)
-		hash *= 0x100000001b3
+// newSeed generates a random hash seed.
+// The seed is never 0, so that 0 can be used to represent a missing seed.
+func newSeed() uint64 {
+	for {
+		// The hash of an empty string with a random seed is itself random.
+		var h maphash.Hash
+		if seed := h.Sum64(); seed != 0 {
+			return seed
+		}
 	}
-
-	return bits.Reverse64(hash)
 }
-*/
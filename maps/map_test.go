@@ -1,9 +1,17 @@
 package maps
 
 import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
 	"reflect"
 	"sort"
 	"strconv"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"unsafe"
 
@@ -19,6 +27,14 @@ func TestMaps(t *testing.T) {
 	}{
 		{"Go", func() Map { return make(Go) }},
 		{"ScatterChain", func() Map { return &ScatterChain{} }},
+		{"Sharded", func() Map { return NewSharded(8, 0) }},
+		{"SwissTable", func() Map { return &SwissTable{} }},
+		{"OrderedMap", func() Map { return &OrderedMap{} }},
+		{"LRU", func() Map { return NewLRU(1<<20, nil) }},
+		{"SortedMap", func() Map { return &SortedMap{} }},
+		{"SmallMap", func() Map { return &SmallMap{} }},
+		{"SyncMap", func() Map { return &SyncMap{} }},
+		{"CuckooTable", func() Map { return &CuckooTable{} }},
 	}
 
 	for _, impl := range impls {
@@ -30,6 +46,12 @@ func TestMaps(t *testing.T) {
 			t.Run("Update", testUpdate(impl.create))
 			t.Run("Each", testEach(impl.create))
 			t.Run("Clear", testClear(impl.create))
+			t.Run("Len", testLen(impl.create))
+			t.Run("ClearAll", testClearAll(impl.create))
+			t.Run("KeysAndValues", testKeysAndValues(impl.create))
+			t.Run("Range", testRange(impl.create))
+			t.Run("Stats", testStats(impl.create))
+			t.Run("Pop", testPop(impl.create))
 		})
 	}
 }
@@ -189,6 +211,2073 @@ func testClear(create func() Map) func(*testing.T) {
 	}
 }
 
+func testLen(create func() Map) func(*testing.T) {
+	return func(t *testing.T) {
+		t.Parallel()
+
+		// Generate a bunch of string keys.
+		keys := make([]string, 1000)
+		for i := range keys {
+			keys[i] = strconv.Itoa(i)
+		}
+
+		// Put the keys in random order.
+		rand.New(rand.NewSource(6)).Shuffle(len(keys), func(i, j int) {
+			keys[i], keys[j] = keys[j], keys[i]
+		})
+
+		m := create()
+		if n := m.Len(); n != 0 {
+			t.Errorf("new map has length %d", n)
+		}
+
+		// Insert the keys, updating each one once.
+		for i, k := range keys {
+			m.Put(k, i)
+			m.Put(k, &keys[i])
+			if n := m.Len(); n != i+1 {
+				t.Errorf("expected length %d after insert but got %d", i+1, n)
+			}
+		}
+
+		// Delete the keys, deleting each one twice.
+		for i, k := range keys {
+			m.Delete(k)
+			m.Delete(k)
+			if n := m.Len(); n != len(keys)-i-1 {
+				t.Errorf("expected length %d after delete but got %d", len(keys)-i-1, n)
+			}
+		}
+	}
+}
+
+func TestShardedConcurrent(t *testing.T) {
+	t.Parallel()
+
+	// Generate a bunch of string keys.
+	keys := make([]string, 1000)
+	for i := range keys {
+		keys[i] = strconv.Itoa(i)
+	}
+
+	// Race a bunch of goroutines to store their ID in every key.
+	m := NewSharded(4, 0)
+	stores := make([]int, 8)
+	var wg sync.WaitGroup
+	for id := range stores {
+		id := id
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			// Use a different order in each goroutine.
+			order := append([]string(nil), keys...)
+			rand.New(rand.NewSource(uint64(id))).Shuffle(len(order), func(i, j int) {
+				order[i], order[j] = order[j], order[i]
+			})
+
+			for _, k := range order {
+				actual, loaded := m.LoadOrStore(k, id)
+				if !loaded {
+					if actual != id {
+						t.Errorf("stored %d at key %q but got %v", id, k, actual)
+					}
+					stores[id]++
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Exactly one goroutine should have stored each key.
+	var stored int
+	for _, n := range stores {
+		stored += n
+	}
+	if stored != len(keys) {
+		t.Errorf("stored %d values for %d keys", stored, len(keys))
+	}
+	if n := m.Len(); n != len(keys) {
+		t.Errorf("expected length %d but got %d", len(keys), n)
+	}
+}
+
+func TestSwissTableChurn(t *testing.T) {
+	t.Parallel()
+
+	// Insert and delete a stream of keys, keeping a small window present.
+	var m SwissTable
+	const window = 50
+	for i := 0; i < 10000; i++ {
+		m.Put(strconv.Itoa(i), i)
+		if i >= window {
+			m.Delete(strconv.Itoa(i - window))
+		}
+	}
+
+	// Check the present keys.
+	if n := m.Len(); n != window {
+		t.Errorf("expected length %d but got %d", window, n)
+	}
+	for i := 10000 - window; i < 10000; i++ {
+		if v, ok := m.Get(strconv.Itoa(i)); !ok || v != i {
+			t.Errorf("expected %d at key %d but got %v", i, i, v)
+		}
+	}
+
+	// Deleted slots should have been reclaimed instead of growing the table.
+	if cap := len(m.groups) * swissGroupSize; cap > 4*window {
+		t.Errorf("table grew to %d slots with %d keys present (%s)", cap, window, m.Info())
+	}
+}
+
+func TestCuckooTable(t *testing.T) {
+	t.Parallel()
+
+	m := MakeCuckooTable(0)
+	ref := make(map[string]int)
+	rng := rand.New(rand.NewSource(11))
+	for i := 0; i < 100000; i++ {
+		k := strconv.Itoa(int(rng.Intn(20000)))
+		if rng.Intn(4) == 0 {
+			m.Delete(k)
+			delete(ref, k)
+		} else {
+			m.Put(k, i)
+			ref[k] = i
+		}
+	}
+	if m.Len() != len(ref) {
+		t.Fatalf("expected %d pairs but got %d", len(ref), m.Len())
+	}
+	for k, v := range ref {
+		if got, ok := m.Get(k); !ok || got != v {
+			t.Errorf("expected %d at key %q but got %v", v, k, got)
+		}
+	}
+
+	// Every pair must be in one of its buckets or the stash.
+	if s := m.Stats(); s.MaxProbe > 3 {
+		t.Errorf("pair found after examining %d buckets (%s)", s.MaxProbe, m.Info())
+	}
+
+	// Inserting many pairs during iteration must not cause existing pairs to be missed or repeated.
+	seen := make(map[string]bool)
+	next := 0
+	m.Each(func(key string, value interface{}) {
+		if seen[key] {
+			t.Errorf("visited %q twice", key)
+		}
+		seen[key] = true
+		for j := 0; j < 4; j++ {
+			m.Put("new"+strconv.Itoa(next), next)
+			next++
+		}
+	})
+	for k := range ref {
+		if !seen[k] {
+			t.Errorf("did not visit %q", k)
+		}
+	}
+	if m.Len() != len(ref)+next {
+		t.Errorf("expected %d pairs but got %d", len(ref)+next, m.Len())
+	}
+	if s := m.Stats(); s.MaxProbe > 3 {
+		t.Errorf("pair found after examining %d buckets (%s)", s.MaxProbe, m.Info())
+	}
+}
+
+func TestCuckooTableStashOverflow(t *testing.T) {
+	t.Parallel()
+
+	// With a single bucket, every key has the same candidate buckets, so the stash fills up after 2 buckets worth of pairs.
+	m := CuckooTable{buckets: make([]cuckooBucket, 2), seed: 1}
+	ref := make(map[string]int)
+	for i := 0; i < 2*cuckooBucketSize; i++ {
+		k := strconv.Itoa(i)
+		if _, _, ok := m.insert(m.hash(k), k, i); !ok {
+			t.Fatalf("failed to insert %q (%s)", k, m.Info())
+		}
+		ref[k] = i
+	}
+
+	// The next insert must fail without losing a pair.
+	k := strconv.Itoa(len(ref))
+	leftKey, leftValue, ok := m.insert(m.hash(k), k, len(ref))
+	if ok {
+		t.Fatalf("inserted %q into a full table (%s)", k, m.Info())
+	}
+	ref[k] = len(ref)
+	if m.Len() != len(ref)-1 {
+		t.Errorf("expected %d pairs but got %d", len(ref)-1, m.Len())
+	}
+	if v, ok := m.Get(leftKey); ok {
+		t.Errorf("pair %q left over but still present with value %v", leftKey, v)
+	}
+	if leftValue != ref[leftKey] {
+		t.Errorf("expected %v left over at key %q but got %v", ref[leftKey], leftKey, leftValue)
+	}
+
+	// Putting the pair left over must grow the table until it fits.
+	m.Put(leftKey, leftValue)
+	if m.Len() != len(ref) {
+		t.Errorf("expected %d pairs but got %d", len(ref), m.Len())
+	}
+	for k, v := range ref {
+		if got, ok := m.Get(k); !ok || got != v {
+			t.Errorf("expected %d at key %q but got %v", v, k, got)
+		}
+	}
+
+	// While iterating, pairs are not displaced, so the stash fills up quickly.
+	// Every Put must still be kept.
+	m = MakeCuckooTable(64)
+	for i := 0; i < 48; i++ {
+		m.Put(strconv.Itoa(i), i)
+	}
+	m.Range(func(key string, value interface{}) bool {
+		for i := 48; i < 1000; i++ {
+			m.Put(strconv.Itoa(i), i)
+			if m.Len() != i+1 {
+				t.Fatalf("expected %d pairs but got %d (%s)", i+1, m.Len(), m.Info())
+			}
+		}
+		return false
+	})
+	for i := 0; i < 1000; i++ {
+		if got, ok := m.Get(strconv.Itoa(i)); !ok || got != i {
+			t.Errorf("expected %d at key %q but got %v", i, strconv.Itoa(i), got)
+		}
+	}
+}
+
+func TestFrozen(t *testing.T) {
+	t.Parallel()
+
+	if f := Freeze(Go{}); f.Len() != 0 {
+		t.Errorf("expected empty map but got length %d", f.Len())
+	} else if _, ok := f.Get(""); ok {
+		t.Error("found a key in an empty map")
+	}
+
+	for _, n := range []int{1, 2, 3, 17, 10000} {
+		src := make(Go, n)
+		for i := 0; i < n; i++ {
+			src[strconv.Itoa(i)] = i
+		}
+
+		f := Freeze(src)
+		if f.Len() != n {
+			t.Errorf("expected length %d but got %d", n, f.Len())
+		}
+		for k, v := range src {
+			if got, ok := f.Get(k); !ok || got != v {
+				t.Errorf("expected %d at key %q but got %v", v, k, got)
+			}
+		}
+		for i := n; i < 2*n; i++ {
+			if v, ok := f.Get(strconv.Itoa(i)); ok {
+				t.Errorf("found missing key %d with value %v", i, v)
+			}
+		}
+
+		visited := make(Go, n)
+		f.Each(func(key string, value interface{}) {
+			visited[key] = value
+		})
+		if !reflect.DeepEqual(visited, src) {
+			t.Errorf("visited %d pairs which did not match", len(visited))
+		}
+	}
+}
+
+func TestEachSnapshot(t *testing.T) {
+	t.Parallel()
+
+	impls := []struct {
+		name         string
+		create       func() Map
+		eachSnapshot func(m Map, fn func(key string, value interface{}))
+	}{
+		{"Go", func() Map { return make(Go) }, EachSnapshot},
+		{"SwissTable", func() Map { return &SwissTable{} }, EachSnapshot},
+		{"ScatterChain", func() Map { return &ScatterChain{} }, func(m Map, fn func(key string, value interface{})) {
+			m.(*ScatterChain).EachSnapshot(fn)
+		}},
+	}
+
+	for _, impl := range impls {
+		impl := impl
+		t.Run(impl.name, func(t *testing.T) {
+			t.Parallel()
+
+			m := impl.create()
+			for i := 0; i < 1000; i++ {
+				m.Put(strconv.Itoa(i), i)
+			}
+
+			// Insert many keys while iterating, and delete the other key of each pair (2n, 2n+1) which is visited.
+			seen := make(map[string]bool)
+			next := 1000
+			impl.eachSnapshot(m, func(key string, value interface{}) {
+				if seen[key] {
+					t.Errorf("visited %q twice", key)
+				}
+				seen[key] = true
+				i, err := strconv.Atoi(key)
+				if err != nil || i >= 1000 {
+					t.Errorf("visited inserted key %q", key)
+				}
+				if seen[strconv.Itoa(i^1)] {
+					t.Errorf("visited deleted key %q", key)
+				}
+				if value != i {
+					t.Errorf("expected %d at key %q but got %v", i, key, value)
+				}
+				m.Delete(strconv.Itoa(i ^ 1))
+				for j := 0; j < 10; j++ {
+					m.Put(strconv.Itoa(next), next)
+					next++
+				}
+			})
+			if len(seen) != 500 {
+				t.Errorf("expected to visit 500 pairs but visited %d", len(seen))
+			}
+		})
+	}
+}
+
+func TestDiskMap(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	var files uint32
+	open := func(t *testing.T, path string) *DiskMap {
+		m, err := OpenDiskMap(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { m.Close() })
+		return m
+	}
+
+	t.Run("Map", func(t *testing.T) {
+		t.Parallel()
+
+		create := func() Map {
+			path := filepath.Join(dir, fmt.Sprintf("map%d", atomic.AddUint32(&files, 1)))
+			return open(t, path)
+		}
+
+		// The other tests compare pointers, which do not survive a round trip through the file.
+		t.Run("Update", testUpdate(create))
+		t.Run("Len", testLen(create))
+		t.Run("KeysAndValues", testKeysAndValues(create))
+		t.Run("Pop", testPop(create))
+	})
+
+	t.Run("Reopen", func(t *testing.T) {
+		t.Parallel()
+
+		path := filepath.Join(dir, "reopen")
+		m := open(t, path)
+		expect := make(Go)
+		for i := 0; i < 1000; i++ {
+			k := strconv.Itoa(i % 300)
+			switch {
+			case i%7 == 0:
+				m.Delete(k)
+				delete(expect, k)
+			case i%11 == 0:
+				m.Put(k, nil)
+				expect[k] = nil
+			default:
+				m.Put(k, "v"+strconv.Itoa(i))
+				expect[k] = "v" + strconv.Itoa(i)
+			}
+		}
+		if err := m.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		// Append a partially written record, as if the process was killed.
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.Write([]byte{100, 0, 0, 0, 1, 2, 3, 4, diskOpPut}); err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+
+		check := func(m *DiskMap) {
+			t.Helper()
+
+			got := make(Go)
+			m.Each(func(key string, value interface{}) {
+				got[key] = value
+			})
+			if err := m.Err(); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, expect) {
+				t.Errorf("expected %d pairs but got %d pairs which did not match", len(expect), len(got))
+			}
+		}
+		m = open(t, path)
+		check(m)
+		if m.Garbage() == 0 {
+			t.Error("no garbage after updates")
+		}
+
+		// Compaction should remove the stale records, and the map should remain usable.
+		if err := m.Compact(); err != nil {
+			t.Fatal(err)
+		}
+		if m.Garbage() != 0 {
+			t.Errorf("%d bytes of garbage after compaction", m.Garbage())
+		}
+		m.Put("new", "value")
+		expect["new"] = "value"
+		check(m)
+		if err := m.Close(); err != nil {
+			t.Fatal(err)
+		}
+		m = open(t, path)
+		check(m)
+		if err := m.Close(); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("Corrupt", func(t *testing.T) {
+		t.Parallel()
+
+		path := filepath.Join(dir, "corrupt")
+		m := open(t, path)
+		for i := 0; i < 10; i++ {
+			m.Put(strconv.Itoa(i), i)
+		}
+		if err := m.Close(); err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, c := range []struct {
+			name    string
+			corrupt func(data []byte) []byte
+			keys    int
+			fail    bool
+		}{
+			{
+				name: "TornPayload",
+				corrupt: func(data []byte) []byte {
+					return data[:len(data)-1]
+				},
+				keys: 9,
+			},
+			{
+				name: "TornHeader",
+				corrupt: func(data []byte) []byte {
+					return append(data, 1, 2, 3)
+				},
+				keys: 10,
+			},
+			{
+				name: "CorruptLast",
+				corrupt: func(data []byte) []byte {
+					data[len(data)-1] ^= 0xff
+					return data
+				},
+				keys: 9,
+			},
+			{
+				name: "CorruptMiddle",
+				corrupt: func(data []byte) []byte {
+					data[diskHeaderSize+1] ^= 0xff
+					return data
+				},
+				fail: true,
+			},
+			{
+				name: "HugeLength",
+				corrupt: func(data []byte) []byte {
+					return append(data, 0xff, 0xff, 0xff, 0xff, 0, 0, 0, 0, diskOpPut)
+				},
+				keys: 10,
+			},
+		} {
+			c := c
+			t.Run(c.name, func(t *testing.T) {
+				path := filepath.Join(dir, "corrupt"+c.name)
+				corrupted := c.corrupt(append([]byte(nil), data...))
+				if err := os.WriteFile(path, corrupted, 0644); err != nil {
+					t.Fatal(err)
+				}
+
+				m, err := OpenDiskMap(path)
+				if c.fail {
+					if err == nil {
+						m.Close()
+						t.Fatal("opened a map with a corrupt record in the middle")
+					}
+					// The file must be left intact.
+					if after, err := os.ReadFile(path); err != nil || !bytes.Equal(after, corrupted) {
+						t.Errorf("file was modified (%v)", err)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer m.Close()
+				if m.Len() != c.keys {
+					t.Errorf("expected %d pairs but got %d", c.keys, m.Len())
+				}
+				if info, err := os.Stat(path); err != nil || info.Size() > int64(len(data)) {
+					t.Errorf("file was not truncated (%v)", err)
+				}
+			})
+		}
+	})
+}
+
+func TestOrderedMap(t *testing.T) {
+	t.Parallel()
+
+	// Generate a bunch of string keys in random order.
+	keys := make([]string, 1000)
+	for i := range keys {
+		keys[i] = strconv.Itoa(i)
+	}
+	rand.New(rand.NewSource(7)).Shuffle(len(keys), func(i, j int) {
+		keys[i], keys[j] = keys[j], keys[i]
+	})
+
+	var m OrderedMap
+	if _, _, ok := m.Oldest(); ok {
+		t.Error("empty map has an oldest pair")
+	}
+	for i, k := range keys {
+		m.Put(k, i)
+	}
+
+	// Updating a key should not move it.
+	m.Put(keys[0], -1)
+
+	// Delete every third key, and check that the rest are in insertion order.
+	var expect []string
+	for i, k := range keys {
+		if i%3 == 1 {
+			m.Delete(k)
+			continue
+		}
+		expect = append(expect, k)
+	}
+	found := make([]string, 0, len(expect))
+	m.Each(func(key string, value interface{}) {
+		found = append(found, key)
+	})
+	if !reflect.DeepEqual(expect, found) {
+		t.Errorf("expected %s but found %s", expect, found)
+	}
+
+	if key, value, ok := m.Oldest(); !ok || key != keys[0] || value != -1 {
+		t.Errorf("expected oldest %q=-1 but got %q=%v", keys[0], key, value)
+	}
+	if key, value, ok := m.Newest(); !ok || key != keys[len(keys)-1] || value != len(keys)-1 {
+		t.Errorf("expected newest %q=%d but got %q=%v", keys[len(keys)-1], len(keys)-1, key, value)
+	}
+
+	// Deleting pairs ahead of the iteration should skip them.
+	found = found[:0]
+	m.Each(func(key string, value interface{}) {
+		found = append(found, key)
+		for _, k := range expect {
+			m.Delete(k)
+		}
+	})
+	if !reflect.DeepEqual(expect[:1], found) {
+		t.Errorf("expected %s but found %s", expect[:1], found)
+	}
+	if _, _, ok := m.Newest(); ok || m.Len() != 0 {
+		t.Errorf("map is not empty: %s", m.Info())
+	}
+}
+
+func TestLRU(t *testing.T) {
+	t.Parallel()
+
+	var evicted []string
+	c := NewLRU(3, func(key string, value interface{}) {
+		if value != key {
+			t.Errorf("evicted %q with wrong value %v", key, value)
+		}
+		evicted = append(evicted, key)
+	})
+	for _, k := range []string{"a", "b", "c"} {
+		c.Put(k, k)
+	}
+
+	// Using a makes b the least recently used.
+	if v, ok := c.Get("a"); !ok || v != "a" {
+		t.Errorf("expected a but got %v", v)
+	}
+	c.Put("d", "d")
+	if !reflect.DeepEqual(evicted, []string{"b"}) {
+		t.Errorf("expected b to be evicted but evicted %s", evicted)
+	}
+
+	// Peeking at c should not save it.
+	if v, ok := c.Peek("c"); !ok || v != "c" {
+		t.Errorf("expected c but got %v", v)
+	}
+	c.Put("e", "e")
+	if !reflect.DeepEqual(evicted, []string{"b", "c"}) {
+		t.Errorf("expected c to be evicted but evicted %s", evicted)
+	}
+
+	// Each goes from most to least recently used.
+	var found []string
+	c.Each(func(key string, value interface{}) {
+		found = append(found, key)
+	})
+	if expect := []string{"e", "d", "a"}; !reflect.DeepEqual(expect, found) {
+		t.Errorf("expected %s but found %s", expect, found)
+	}
+
+	// A costly pair should evict everything else.
+	evicted = evicted[:0]
+	c.PutCost("f", "f", 3)
+	if expect := []string{"a", "d", "e"}; !reflect.DeepEqual(expect, evicted) {
+		t.Errorf("expected %s to be evicted but evicted %s", expect, evicted)
+	}
+	if c.Len() != 1 || c.Cost() != 3 {
+		t.Errorf("unexpected cache state: %s", c.Info())
+	}
+
+	// A pair which does not fit should evict itself.
+	evicted = evicted[:0]
+	c.PutCost("g", "g", 4)
+	if expect := []string{"f", "g"}; !reflect.DeepEqual(expect, evicted) {
+		t.Errorf("expected %s to be evicted but evicted %s", expect, evicted)
+	}
+	if c.Len() != 0 || c.Cost() != 0 {
+		t.Errorf("unexpected cache state: %s", c.Info())
+	}
+}
+
+func TestWeightedLRU(t *testing.T) {
+	t.Parallel()
+
+	var evicted []string
+	c := NewWeightedLRU(100, WeighBytes, func(key string, value interface{}) {
+		evicted = append(evicted, key)
+	})
+	c.Put("a", make([]byte, 39))
+	c.Put("b", "0123456789")
+	c.Put("c", make([]byte, 29))
+	if c.Cost() != 40+11+30 {
+		t.Errorf("expected a cost of %d but got %d", 40+11+30, c.Cost())
+	}
+
+	// Growing a value should evict the least recently used pairs until the cache is within budget.
+	c.Put("b", make([]byte, 39))
+	if expect := []string{"a"}; !reflect.DeepEqual(expect, evicted) {
+		t.Errorf("expected %s to be evicted but evicted %s", expect, evicted)
+	}
+	if c.Cost() != 30+40 {
+		t.Errorf("expected a cost of %d but got %d", 30+40, c.Cost())
+	}
+
+	// The weight can be overridden.
+	c.PutCost("d", nil, 30)
+	if c.Cost() != 100 || c.Len() != 3 {
+		t.Errorf("unexpected cache state: %s", c.Info())
+	}
+
+	// Shrinking the budget should evict pairs.
+	c.SetCapacity(70)
+	if expect := []string{"a", "c"}; !reflect.DeepEqual(expect, evicted) {
+		t.Errorf("expected %s to be evicted but evicted %s", expect, evicted)
+	}
+	if c.Capacity() != 70 || c.Cost() != 70 {
+		t.Errorf("unexpected cache state: %s", c.Info())
+	}
+}
+
+func testClearAll(create func() Map) func(*testing.T) {
+	return func(t *testing.T) {
+		t.Parallel()
+
+		// Generate a bunch of string keys.
+		keys := make([]string, 1000)
+		for i := range keys {
+			keys[i] = strconv.Itoa(i)
+		}
+
+		// Fill and clear the map a few times.
+		m := create()
+		for round := 0; round < 3; round++ {
+			for i, k := range keys {
+				m.Put(k, &keys[i])
+			}
+			if n := m.Len(); n != len(keys) {
+				t.Errorf("expected length %d but got %d", len(keys), n)
+			}
+
+			m.Clear()
+			if n := m.Len(); n != 0 {
+				t.Errorf("cleared map has length %d", n)
+			}
+			for _, k := range keys {
+				if _, ok := m.Get(k); ok {
+					t.Errorf("key %q still exists", k)
+				}
+			}
+			m.Each(func(key string, value interface{}) {
+				t.Errorf("found key %q in cleared map", key)
+			})
+		}
+
+		// Clearing during iteration should end the iteration.
+		for i, k := range keys {
+			m.Put(k, &keys[i])
+		}
+		var calls int
+		m.Each(func(key string, value interface{}) {
+			calls++
+			m.Clear()
+		})
+		if calls != 1 {
+			t.Errorf("iteration continued for %d calls after clear", calls)
+		}
+	}
+}
+
+func TestScatterChainClone(t *testing.T) {
+	t.Parallel()
+
+	// Generate a bunch of string keys.
+	keys := make([]string, 1000)
+	for i := range keys {
+		keys[i] = strconv.Itoa(i)
+	}
+
+	var m ScatterChain
+	for i, k := range keys {
+		v := i
+		m.Put(k, &v)
+	}
+
+	// Clone the map, deep-copying the values.
+	var copies int
+	clone := m.CloneFunc(func(value interface{}) interface{} {
+		copies++
+		v := *value.(*int)
+		return &v
+	})
+	if copies != len(keys) {
+		t.Errorf("copied %d values for %d keys", copies, len(keys))
+	}
+	shallow := m.Clone()
+
+	// Modify the original map.
+	for i, k := range keys {
+		if i%2 == 0 {
+			m.Delete(k)
+		} else {
+			v, _ := m.Get(k)
+			*v.(*int) = -1
+		}
+	}
+
+	// The deep clone should be unaffected.
+	if n := clone.Len(); n != len(keys) {
+		t.Errorf("expected clone length %d but got %d", len(keys), n)
+	}
+	for i, k := range keys {
+		v, ok := clone.Get(k)
+		if !ok {
+			t.Errorf("clone lost key %q", k)
+			continue
+		}
+		if *v.(*int) != i {
+			t.Errorf("expected %d at key %q in clone but got %d", i, k, *v.(*int))
+		}
+	}
+
+	// The shallow clone should share the values, but not the pairs.
+	if n := shallow.Len(); n != len(keys) {
+		t.Errorf("expected shallow clone length %d but got %d", len(keys), n)
+	}
+	v, _ := shallow.Get(keys[1])
+	if *v.(*int) != -1 {
+		t.Errorf("shallow clone did not share value at key %q", keys[1])
+	}
+}
+
+func testKeysAndValues(create func() Map) func(*testing.T) {
+	return func(t *testing.T) {
+		t.Parallel()
+
+		// Generate a bunch of string keys.
+		keys := make([]string, 1000)
+		for i := range keys {
+			keys[i] = strconv.Itoa(i)
+		}
+
+		// Insert keys into the map, with the key as the value.
+		m := create()
+		for _, k := range keys {
+			m.Put(k, k)
+		}
+
+		sort.Strings(keys)
+
+		found := Keys(m)
+		sort.Strings(found)
+		if !reflect.DeepEqual(keys, found) {
+			t.Errorf("inserted keys %s but found %s", keys, found)
+		}
+
+		values := make([]string, 0, len(keys))
+		for _, v := range Values(m) {
+			values = append(values, v.(string))
+		}
+		sort.Strings(values)
+		if !reflect.DeepEqual(keys, values) {
+			t.Errorf("inserted values %s but found %s", keys, values)
+		}
+
+		// Appending should keep the existing elements.
+		appended := AppendKeys([]string{"prefix"}, m)
+		if appended[0] != "prefix" {
+			t.Errorf("prefix replaced with %q", appended[0])
+		}
+		appended = appended[1:]
+		sort.Strings(appended)
+		if !reflect.DeepEqual(keys, appended) {
+			t.Errorf("inserted keys %s but appended %s", keys, appended)
+		}
+	}
+}
+
+func TestScatterChainCompute(t *testing.T) {
+	t.Parallel()
+
+	// Count the occurences of each word.
+	words := []string{"a", "b", "a", "c", "a", "b"}
+	var m ScatterChain
+	for _, w := range words {
+		m.Compute(w, func(old interface{}, ok bool) (interface{}, bool) {
+			if !ok {
+				return 1, true
+			}
+			return old.(int) + 1, true
+		})
+	}
+	for k, n := range map[string]int{"a": 3, "b": 2, "c": 1} {
+		if v, ok := m.Get(k); !ok || v != n {
+			t.Errorf("expected %d at key %q but got %v", n, k, v)
+		}
+	}
+
+	// Returning false should delete the key.
+	v, ok := m.Compute("a", func(old interface{}, ok bool) (interface{}, bool) {
+		return nil, false
+	})
+	if ok || v != nil {
+		t.Errorf("expected deleted key but got %v", v)
+	}
+	if _, ok := m.Get("a"); ok || m.Len() != 2 {
+		t.Errorf("key was not deleted: %s", m.Info())
+	}
+
+	// GetOrInsert should only call the function for missing keys.
+	var calls int
+	create := func() interface{} {
+		calls++
+		return 10
+	}
+	if v, loaded := m.GetOrInsert("b", create); !loaded || v != 2 {
+		t.Errorf("expected to load 2 but got %v (loaded=%t)", v, loaded)
+	}
+	if v, loaded := m.GetOrInsert("d", create); loaded || v != 10 {
+		t.Errorf("expected to insert 10 but got %v (loaded=%t)", v, loaded)
+	}
+	if calls != 1 {
+		t.Errorf("expected 1 call but got %d", calls)
+	}
+	if v, ok := m.Get("d"); !ok || v != 10 {
+		t.Errorf("expected 10 at key \"d\" but got %v", v)
+	}
+}
+
+func TestScatterChainBulk(t *testing.T) {
+	t.Parallel()
+
+	// Generate a bunch of string keys, with some repeated.
+	keys := make([]string, 1000)
+	values := make([]interface{}, len(keys))
+	for i := range keys {
+		keys[i] = strconv.Itoa(i % 900)
+		values[i] = i
+	}
+
+	m := BulkScatterChain(keys, values)
+	if n := m.Len(); n != 900 {
+		t.Errorf("expected length 900 but got %d", n)
+	}
+	for i := 0; i < 900; i++ {
+		expect := i
+		if i < 100 {
+			// The last value should win.
+			expect += 900
+		}
+		if v, ok := m.Get(strconv.Itoa(i)); !ok || v != expect {
+			t.Errorf("expected %d at key %d but got %v", expect, i, v)
+		}
+	}
+
+	// Merge into a map with some existing pairs.
+	var merged ScatterChain
+	merged.Put("a", 1)
+	merged.Put("0", -1)
+	merged.PutAll(&m)
+	if n := merged.Len(); n != 901 {
+		t.Errorf("expected length 901 after merge but got %d", n)
+	}
+	if v, _ := merged.Get("0"); v != 900 {
+		t.Errorf("expected merge to overwrite key \"0\" but got %v", v)
+	}
+	if v, _ := merged.Get("a"); v != 1 {
+		t.Errorf("expected merge to keep key \"a\" but got %v", v)
+	}
+}
+
+func BenchmarkBulkLoad(b *testing.B) {
+	sizes := []struct {
+		name string
+		val  int
+	}{
+		{"64", 64},
+		{"1K", 1 << 10},
+		{"64K", 1 << 16},
+	}
+
+	for _, size := range sizes {
+		// Generate a bunch of string keys in random order.
+		keys := make([]string, size.val)
+		values := make([]interface{}, len(keys))
+		for i := range keys {
+			keys[i] = strconv.Itoa(i)
+			values[i] = &keys[i]
+		}
+		rand.New(rand.NewSource(9)).Shuffle(len(keys), func(i, j int) {
+			keys[i], keys[j] = keys[j], keys[i]
+		})
+		src := make(Go, len(keys))
+		for i, k := range keys {
+			src[k] = values[i]
+		}
+
+		b.Run(size.name, func(b *testing.B) {
+			b.Run("Put", func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					m := MakeScatterChain(uint(len(keys)))
+					for j, k := range keys {
+						m.Put(k, values[j])
+					}
+				}
+			})
+			b.Run("PutAll", func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					var m ScatterChain
+					m.PutAll(src)
+				}
+			})
+			b.Run("Bulk", func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					BulkScatterChain(keys, values)
+				}
+			})
+		})
+	}
+}
+
+func testRange(create func() Map) func(*testing.T) {
+	return func(t *testing.T) {
+		t.Parallel()
+
+		// Generate a bunch of string keys.
+		keys := make([]string, 1000)
+		for i := range keys {
+			keys[i] = strconv.Itoa(i)
+		}
+
+		// Insert keys into the map.
+		m := create()
+		for i, k := range keys {
+			m.Put(k, &keys[i])
+		}
+
+		// Iterate over all of the pairs.
+		found := make([]string, 0, len(keys))
+		All(m)(func(key string, value interface{}) bool {
+			found = append(found, key)
+			if ptr, ok := value.(*string); !ok || *ptr != key {
+				t.Errorf("wrong value for key %q", key)
+			}
+			return true
+		})
+		sort.Strings(keys)
+		sort.Strings(found)
+		if !reflect.DeepEqual(keys, found) {
+			t.Errorf("inserted %s but found %s", keys, found)
+		}
+
+		// Stop part of the way through.
+		var calls int
+		m.Range(func(key string, value interface{}) bool {
+			calls++
+			return calls < 10
+		})
+		if calls != 10 {
+			t.Errorf("expected to stop after 10 calls but made %d", calls)
+		}
+	}
+}
+
+func testStats(create func() Map) func(*testing.T) {
+	return func(t *testing.T) {
+		t.Parallel()
+
+		m := create()
+		if s := m.Stats(); s.Len != 0 || s.MaxProbe != 0 {
+			t.Errorf("unexpected stats for an empty map: %+v", s)
+		}
+
+		for i := 0; i < 1000; i++ {
+			m.Put(strconv.Itoa(i), i)
+		}
+		for i := 0; i < 1000; i += 2 {
+			m.Delete(strconv.Itoa(i))
+		}
+
+		s := m.Stats()
+		if s.Len != 500 {
+			t.Errorf("expected length 500 but got %d", s.Len)
+		}
+		if s.Capacity == 0 {
+			// The implementation does not expose its internals.
+			return
+		}
+		if s.Capacity < s.Len {
+			t.Errorf("capacity %d is less than length %d", s.Capacity, s.Len)
+		}
+		if s.Heads > s.Len {
+			t.Errorf("%d heads for %d pairs", s.Heads, s.Len)
+		}
+		if s.MaxProbe < 1 || s.MeanProbe < 1 || s.MeanProbe > float64(s.MaxProbe) {
+			t.Errorf("invalid probe lengths: max=%d mean=%f", s.MaxProbe, s.MeanProbe)
+		}
+		if s.Bytes == 0 {
+			t.Error("no memory usage reported")
+		}
+		if s.LoadFactor != float64(s.Len)/float64(s.Capacity) {
+			t.Errorf("load factor %f does not match %d/%d", s.LoadFactor, s.Len, s.Capacity)
+		}
+	}
+}
+
+func testPop(create func() Map) func(*testing.T) {
+	return func(t *testing.T) {
+		t.Parallel()
+
+		m := create()
+		if _, ok := m.Pop("missing"); ok {
+			t.Error("popped a key from an empty map")
+		}
+
+		for i := 0; i < 1000; i++ {
+			m.Put(strconv.Itoa(i), i)
+		}
+		for i := 0; i < 1000; i += 2 {
+			if v, ok := m.Pop(strconv.Itoa(i)); !ok || v != i {
+				t.Errorf("expected to pop %d but got %v", i, v)
+			}
+			if _, ok := m.Pop(strconv.Itoa(i)); ok {
+				t.Errorf("popped %d twice", i)
+			}
+		}
+		if m.Len() != 500 {
+			t.Errorf("expected 500 pairs but got %d", m.Len())
+		}
+		for i := 1; i < 1000; i += 2 {
+			if v, ok := m.Get(strconv.Itoa(i)); !ok || v != i {
+				t.Errorf("expected %d but got %v", i, v)
+			}
+		}
+	}
+}
+
+func TestHash(t *testing.T) {
+	t.Parallel()
+
+	hashes := []struct {
+		name string
+		hash func(str string, seed uint64) uint64
+	}{
+		{"strhash", strhash},
+		{"wyhash", wyhash},
+		{"fnvhash", fnvhash},
+	}
+
+	// Generate keys of many lengths, including every length up to a few blocks of wyhash.
+	keys := make([]string, 0, 10200)
+	for i := 0; i < 10000; i++ {
+		keys = append(keys, strconv.Itoa(i))
+	}
+	long := make([]byte, 200)
+	for i := range long {
+		long[i] = byte(i)
+	}
+	for i := 0; i <= len(long); i++ {
+		keys = append(keys, string(long[:i]))
+	}
+
+	for _, h := range hashes {
+		h := h
+		t.Run(h.name, func(t *testing.T) {
+			t.Parallel()
+
+			const topBits, lowBits = 16, 16
+			seen := make(map[uint64]string, len(keys))
+			buckets := make(map[uint64]bool)
+			low := make(map[uint64]bool)
+			for _, k := range keys {
+				hash := h.hash(k, 1)
+				if hash != h.hash(k, 1) {
+					t.Errorf("hash of %q is not deterministic", k)
+				}
+				if prev, ok := seen[hash]; ok {
+					t.Errorf("%q and %q collide", prev, k)
+				}
+				seen[hash] = k
+				buckets[hash>>(64-topBits)] = true
+				low[hash&(1<<lowBits-1)] = true
+				if hash == h.hash(k, 2) {
+					t.Errorf("hash of %q does not depend on the seed", k)
+				}
+			}
+
+			// The upper bits are used to index most of the tables, and CuckooTable also uses the lower bits, so both should be well distributed.
+			// With 10201 keys in 65536 buckets, about 9500 buckets are expected to be used.
+			if len(buckets) < 9000 {
+				t.Errorf("only %d distinct values of the upper %d bits", len(buckets), topBits)
+			}
+			if len(low) < 9000 {
+				t.Errorf("only %d distinct values of the lower %d bits", len(low), lowBits)
+			}
+		})
+	}
+}
+
+func TestSeed(t *testing.T) {
+	t.Parallel()
+
+	// Generate a bunch of string keys.
+	keys := make([]string, 1000)
+	for i := range keys {
+		keys[i] = strconv.Itoa(i)
+	}
+
+	impls := []struct {
+		name   string
+		create func(seed uint64) Map
+	}{
+		{"ScatterChain", func(seed uint64) Map {
+			if seed == 0 {
+				return &ScatterChain{}
+			}
+			chain := MakeSeededScatterChain(0, seed)
+			return &chain
+		}},
+		{"SwissTable", func(seed uint64) Map {
+			if seed == 0 {
+				return &SwissTable{}
+			}
+			table := MakeSeededSwissTable(0, seed)
+			return &table
+		}},
+	}
+
+	for _, impl := range impls {
+		impl := impl
+		t.Run(impl.name, func(t *testing.T) {
+			t.Parallel()
+
+			order := func(seed uint64) []string {
+				m := impl.create(seed)
+				for i, k := range keys {
+					m.Put(k, &keys[i])
+				}
+				return Keys(m)
+			}
+
+			// Maps with the same seed should have the same layout.
+			if a, b := order(1), order(1); !reflect.DeepEqual(a, b) {
+				t.Error("maps with the same seed iterate in different orders")
+			}
+
+			// Maps with random seeds should not.
+			if a, b := order(0), order(0); reflect.DeepEqual(a, b) {
+				t.Error("maps with random seeds iterate in the same order")
+			}
+		})
+	}
+}
+
+func TestScatterChainBytes(t *testing.T) {
+	// This is not run in parallel, as it counts allocations.
+
+	var m ScatterChain
+	key := []byte("key")
+	m.PutBytes(key, 1)
+
+	// The stored key must not alias the buffer.
+	copy(key, "abc")
+	if _, ok := m.Get("abc"); ok {
+		t.Error("stored key aliases the buffer")
+	}
+	if v, ok := m.GetBytes([]byte("key")); !ok || v != 1 {
+		t.Errorf("expected 1 but got %v", v)
+	}
+
+	// Lookups and updates of existing keys should not allocate.
+	key = []byte("key")
+	allocs := testing.AllocsPerRun(100, func() {
+		m.PutBytes(key, nil)
+		m.GetBytes(key)
+		m.GetBytes([]byte("missing"))
+		m.DeleteBytes([]byte("missing"))
+	})
+	if allocs != 0 {
+		t.Errorf("expected no allocations but got %v", allocs)
+	}
+
+	m.DeleteBytes(key)
+	if m.Len() != 0 {
+		t.Errorf("key was not deleted: %s", m.Info())
+	}
+}
+
+func TestScatterChainArena(t *testing.T) {
+	// This is not run in parallel, as it counts allocations.
+
+	m := MakeArenaScatterChain(1000)
+	var buf []byte
+	insert := func() {
+		for i := 0; i < 1000; i++ {
+			buf = strconv.AppendInt(buf[:0], int64(i), 10)
+			m.PutBytes(buf, nil)
+		}
+	}
+
+	// New keys should be allocated out of a shared chunk.
+	allocs := testing.AllocsPerRun(1, func() {
+		m.Clear()
+		insert()
+	})
+	if allocs > 2 {
+		t.Errorf("expected at most 2 allocations but got %v", allocs)
+	}
+
+	// The keys must not alias the buffer.
+	copy(buf, "xyz")
+	for i := 0; i < 1000; i++ {
+		if _, ok := m.Get(strconv.Itoa(i)); !ok {
+			t.Errorf("missing key %d", i)
+		}
+	}
+
+	// Keys should survive growth and cloning.
+	keys := make([]string, 0, 1000)
+	for i := 0; i < 2000; i++ {
+		m.Put(strconv.Itoa(i), i)
+	}
+	clone := m.Clone()
+	m.Each(func(key string, value interface{}) {
+		keys = append(keys, key)
+		m.Delete(key)
+	})
+	if len(keys) != 2000 {
+		t.Errorf("expected 2000 keys but got %d", len(keys))
+	}
+	m.Clear()
+	insert()
+	for _, k := range keys {
+		if v, ok := clone.Get(k); !ok || strconv.Itoa(v.(int)) != k {
+			t.Errorf("wrong value for key %q in clone: %v", k, v)
+		}
+	}
+}
+
+func TestEncoding(t *testing.T) {
+	t.Parallel()
+
+	impls := []struct {
+		name   string
+		create func() Map
+	}{
+		{"ScatterChain", func() Map { return &ScatterChain{} }},
+		{"SwissTable", func() Map { return &SwissTable{} }},
+		{"OrderedMap", func() Map { return &OrderedMap{} }},
+		{"Sharded", func() Map { return NewSharded(8, 0) }},
+	}
+	codecs := []struct {
+		name   string
+		encode func(Map) ([]byte, error)
+		decode func([]byte, Map) error
+	}{
+		{
+			"JSON",
+			func(m Map) ([]byte, error) { return json.Marshal(m) },
+			func(data []byte, m Map) error { return json.Unmarshal(data, m) },
+		},
+		{
+			"Gob",
+			func(m Map) ([]byte, error) {
+				var buf bytes.Buffer
+				err := gob.NewEncoder(&buf).Encode(m)
+				return buf.Bytes(), err
+			},
+			func(data []byte, m Map) error { return gob.NewDecoder(bytes.NewReader(data)).Decode(m) },
+		},
+	}
+
+	for _, impl := range impls {
+		for _, codec := range codecs {
+			impl, codec := impl, codec
+			t.Run(impl.name+"/"+codec.name, func(t *testing.T) {
+				t.Parallel()
+
+				m := impl.create()
+				for i := 0; i < 1000; i++ {
+					m.Put(strconv.Itoa(i), strconv.Itoa(2*i))
+				}
+				data, err := codec.encode(m)
+				if err != nil {
+					t.Fatalf("failed to encode: %v", err)
+				}
+
+				// Decoding should replace the existing contents.
+				res := impl.create()
+				res.Put("old", "value")
+				if err := codec.decode(data, res); err != nil {
+					t.Fatalf("failed to decode: %v", err)
+				}
+				if res.Len() != m.Len() {
+					t.Errorf("expected %d pairs but got %d", m.Len(), res.Len())
+				}
+				m.Each(func(key string, value interface{}) {
+					if v, ok := res.Get(key); !ok || v != value {
+						t.Errorf("expected %v for key %q but got %v", value, key, v)
+					}
+				})
+				if _, ok := m.(*OrderedMap); ok && !reflect.DeepEqual(Keys(res), Keys(m)) {
+					t.Error("insertion order was not preserved")
+				}
+			})
+		}
+	}
+}
+
+func TestPersistent(t *testing.T) {
+	t.Parallel()
+
+	// Apply random operations, checking against a Go map.
+	rand := rand.New(rand.NewSource(11))
+	var m Persistent
+	ref := make(map[string]int)
+	versions := []Persistent{m}
+	refs := []map[string]int{{}}
+	for i := 0; i < 10000; i++ {
+		k := strconv.Itoa(rand.Intn(2000))
+		if rand.Intn(3) == 0 {
+			m = m.Delete(k)
+			delete(ref, k)
+		} else {
+			m = m.Set(k, i)
+			ref[k] = i
+		}
+
+		if i%1000 == 0 {
+			// Save a snapshot of the map.
+			versions = append(versions, m)
+			snap := make(map[string]int, len(ref))
+			for k, v := range ref {
+				snap[k] = v
+			}
+			refs = append(refs, snap)
+		}
+	}
+	versions = append(versions, m)
+	refs = append(refs, ref)
+
+	// Every version should be unaffected by later changes.
+	for i, v := range versions {
+		if v.Len() != len(refs[i]) {
+			t.Errorf("version %d: expected %d pairs but got %d", i, len(refs[i]), v.Len())
+		}
+		for k, want := range refs[i] {
+			if got, ok := v.Get(k); !ok || got != want {
+				t.Errorf("version %d: expected %d for key %q but got %v", i, want, k, got)
+			}
+		}
+		n := 0
+		v.Each(func(key string, value interface{}) {
+			n++
+			if want, ok := refs[i][key]; !ok || value != want {
+				t.Errorf("version %d: unexpected pair %q=%v", i, key, value)
+			}
+		})
+		if n != len(refs[i]) {
+			t.Errorf("version %d: expected to visit %d pairs but visited %d", i, len(refs[i]), n)
+		}
+	}
+
+	// Keys with identical hashes share a leaf.
+	var c Persistent
+	c = c.set(42, "a", 1).set(42, "b", 2).set(42|1<<63, "c", 3).set(42, "a", 4)
+	if c.Len() != 3 {
+		t.Errorf("expected 3 pairs but got %d", c.Len())
+	}
+	if v, ok := c.get(42, "a"); !ok || v != 4 {
+		t.Errorf("expected 4 but got %v", v)
+	}
+	d := c.delete(42, "a").delete(42, "missing")
+	if v, ok := d.get(42, "b"); !ok || v != 2 || d.Len() != 2 {
+		t.Errorf("expected 2 but got %v", v)
+	}
+	if _, ok := d.get(42, "a"); ok {
+		t.Error("deleted key still present")
+	}
+	if _, ok := c.get(42, "a"); !ok {
+		t.Error("delete modified the original map")
+	}
+	d = d.delete(42, "b").delete(42|1<<63, "c")
+	if d.Len() != 0 || d.root != nil {
+		t.Errorf("expected empty map but got %d pairs", d.Len())
+	}
+}
+
+func TestSortedMap(t *testing.T) {
+	t.Parallel()
+
+	// check verifies the structure of the tree.
+	check := func(t *testing.T, m *SortedMap) {
+		t.Helper()
+
+		depth := -1
+		var n uint
+		var walk func(node *btreeNode, d int, lo, hi string)
+		walk = func(node *btreeNode, d int, lo, hi string) {
+			n += uint(len(node.items))
+			if node != m.root && (len(node.items) < btreeMinItems || len(node.items) > btreeMaxItems) {
+				t.Errorf("node has %d items", len(node.items))
+			}
+			for i, item := range node.items {
+				if (lo != "" && item.key <= lo) || (hi != "" && item.key >= hi) || (i > 0 && item.key <= node.items[i-1].key) {
+					t.Errorf("key %q out of order", item.key)
+				}
+			}
+			if node.leaf() {
+				if depth == -1 {
+					depth = d
+				} else if d != depth {
+					t.Errorf("leaf at depth %d, expected %d", d, depth)
+				}
+				return
+			}
+			if len(node.children) != len(node.items)+1 {
+				t.Errorf("node has %d items but %d children", len(node.items), len(node.children))
+			}
+			for i, c := range node.children {
+				clo, chi := lo, hi
+				if i > 0 {
+					clo = node.items[i-1].key
+				}
+				if i < len(node.items) {
+					chi = node.items[i].key
+				}
+				walk(c, d+1, clo, chi)
+			}
+		}
+		if m.root != nil {
+			walk(m.root, 0, "", "")
+		}
+		if n != m.n {
+			t.Errorf("tree has %d items but length is %d", n, m.n)
+		}
+	}
+
+	// Apply random operations, checking against a Go map.
+	rand := rand.New(rand.NewSource(12))
+	var m SortedMap
+	ref := make(map[string]int)
+	for i := 0; i < 20000; i++ {
+		k := strconv.Itoa(rand.Intn(5000))
+		if rand.Intn(3) == 0 {
+			m.Delete(k)
+			delete(ref, k)
+		} else {
+			m.Put(k, i)
+			ref[k] = i
+		}
+	}
+	check(t, &m)
+	keys := make([]string, 0, len(ref))
+	for k := range ref {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	if got := Keys(&m); !reflect.DeepEqual(got, keys) {
+		t.Error("keys are not in sorted order")
+	}
+	if k, _, ok := m.Min(); !ok || k != keys[0] {
+		t.Errorf("expected min %q but got %q", keys[0], k)
+	}
+	if k, _, ok := m.Max(); !ok || k != keys[len(keys)-1] {
+		t.Errorf("expected max %q but got %q", keys[len(keys)-1], k)
+	}
+
+	// Query some ranges, including bounds which are and are not present.
+	for _, r := range [][2]string{{"1", "2"}, {"15", "150"}, {keys[10], keys[20]}, {"", "0"}, {"9", "~"}} {
+		lo := sort.SearchStrings(keys, r[0])
+		hi := sort.SearchStrings(keys, r[1])
+		var got []string
+		m.Between(r[0], r[1], func(key string, value interface{}) bool {
+			got = append(got, key)
+			if value != ref[key] {
+				t.Errorf("wrong value for key %q", key)
+			}
+			return true
+		})
+		if len(got) != hi-lo || (len(got) != 0 && !reflect.DeepEqual(got, keys[lo:hi])) {
+			t.Errorf("range [%q, %q): expected %d keys but got %d", r[0], r[1], hi-lo, len(got))
+		}
+	}
+	var got []string
+	m.Ascend(keys[len(keys)-3], func(key string, value interface{}) bool {
+		got = append(got, key)
+		return true
+	})
+	if !reflect.DeepEqual(got, keys[len(keys)-3:]) {
+		t.Errorf("expected %q but got %q", keys[len(keys)-3:], got)
+	}
+
+	// Restructure the tree during iteration.
+	// Keys which are deleted must not be visited, and no key may be visited twice.
+	var prev string
+	visited := 0
+	m.Each(func(key string, value interface{}) {
+		if key <= prev {
+			t.Errorf("visited %q after %q", key, prev)
+		}
+		prev = key
+		visited++
+		if _, ok := ref[key]; !ok {
+			t.Errorf("visited deleted key %q", key)
+		}
+
+		// Delete this key and the next key, and insert a key which sorts before all of the others.
+		idx := sort.SearchStrings(keys, key)
+		if idx+1 < len(keys) {
+			m.Delete(keys[idx+1])
+			delete(ref, keys[idx+1])
+		}
+		m.Delete(key)
+		m.Put("!"+key, nil)
+	})
+	check(t, &m)
+	if visited != len(ref) || m.Len() != len(ref) {
+		t.Errorf("expected to visit %d pairs but visited %d (%d remaining)", len(ref), visited, m.Len())
+	}
+}
+
+func TestReserve(t *testing.T) {
+	t.Parallel()
+
+	for n := uint(1); n < 3000; n += 7 {
+		chain := MakeScatterChain(n / 2)
+		table := MakeSwissTable(n / 2)
+		for i := uint(0); i < n/2; i++ {
+			chain.Put(strconv.Itoa(int(i)), i)
+			table.Put(strconv.Itoa(int(i)), i)
+		}
+
+		// Inserting the reserved pairs should not grow the tables.
+		chain.Reserve(n)
+		table.Reserve(n)
+		slots, groups := &chain.slots[0], &table.groups[0]
+		for i := n / 2; i < n/2+n; i++ {
+			chain.Put(strconv.Itoa(int(i)), i)
+			table.Put(strconv.Itoa(int(i)), i)
+		}
+		if &chain.slots[0] != slots {
+			t.Errorf("ScatterChain with %d pairs grew after reserving %d", n/2, n)
+		}
+		if &table.groups[0] != groups {
+			t.Errorf("SwissTable with %d pairs grew after reserving %d", n/2, n)
+		}
+		if chain.Len() != int(n/2+n) || table.Len() != int(n/2+n) {
+			t.Errorf("expected %d pairs but got %d and %d", n/2+n, chain.Len(), table.Len())
+		}
+	}
+}
+
+func TestSmallMap(t *testing.T) {
+	// This is not run in parallel, as it counts allocations.
+
+	var m SmallMap
+	keys := make([]string, smallMapMax+1)
+	for i := range keys {
+		keys[i] = strconv.Itoa(i)
+	}
+
+	// Small maps should not hash or allocate a table.
+	for _, k := range keys[:smallMapMax] {
+		m.Put(k, k)
+	}
+	if m.table != nil {
+		t.Fatalf("switched to a table with %d pairs", m.Len())
+	}
+	allocs := testing.AllocsPerRun(100, func() {
+		for _, k := range keys[:smallMapMax] {
+			m.Get(k)
+			m.Put(k, nil)
+		}
+		m.Delete(keys[0])
+		m.Put(keys[0], nil)
+	})
+	if allocs != 0 {
+		t.Errorf("expected no allocations but got %v", allocs)
+	}
+
+	// Growing the map during iteration should switch to a table, without losing or repeating pairs.
+	seen := make(map[string]bool)
+	m.Each(func(key string, value interface{}) {
+		if seen[key] {
+			t.Errorf("visited %q twice", key)
+		}
+		seen[key] = true
+		m.Put(keys[smallMapMax], nil)
+		m.Delete(keys[smallMapMax-1])
+	})
+	if m.table == nil {
+		t.Error("did not switch to a table")
+	}
+	if len(seen) != smallMapMax-1 {
+		t.Errorf("expected to visit %d pairs but visited %d", smallMapMax-1, len(seen))
+	}
+	if m.Len() != smallMapMax {
+		t.Errorf("expected %d pairs but got %d", smallMapMax, m.Len())
+	}
+}
+
+func TestSet(t *testing.T) {
+	t.Parallel()
+
+	var s Set
+	ref := make(map[string]struct{})
+	rng := rand.New(rand.NewSource(7))
+	for i := 0; i < 10000; i++ {
+		k := strconv.Itoa(int(rng.Intn(5000)))
+		switch rng.Intn(3) {
+		case 0:
+			s.Delete(k)
+			delete(ref, k)
+		default:
+			s.Add(k)
+			ref[k] = struct{}{}
+		}
+	}
+	if s.Len() != len(ref) {
+		t.Fatalf("expected %d keys but got %d", len(ref), s.Len())
+	}
+	for i := 0; i < 5000; i++ {
+		k := strconv.Itoa(i)
+		if _, ok := ref[k]; s.Has(k) != ok {
+			t.Errorf("Has(%q) = %t", k, !ok)
+		}
+	}
+	seen := make(map[string]bool)
+	s.Each(func(key string) {
+		if seen[key] {
+			t.Errorf("visited %q twice", key)
+		}
+		seen[key] = true
+	})
+	if len(seen) != len(ref) {
+		t.Errorf("expected to visit %d keys but visited %d", len(ref), len(seen))
+	}
+
+	// Combine sets of even numbers and multiples of 3.
+	even, three := MakeSet(50), MakeSet(0)
+	for i := 0; i < 100; i++ {
+		if i%2 == 0 {
+			even.Add(strconv.Itoa(i))
+		}
+		if i%3 == 0 {
+			three.Add(strconv.Itoa(i))
+		}
+	}
+	union := even.Clone()
+	union.Union(&three)
+	inter := even.Clone()
+	inter.Intersect(&three)
+	for i := 0; i < 100; i++ {
+		k := strconv.Itoa(i)
+		if union.Has(k) != (i%2 == 0 || i%3 == 0) {
+			t.Errorf("union has %q: %t", k, union.Has(k))
+		}
+		if inter.Has(k) != (i%6 == 0) {
+			t.Errorf("intersection has %q: %t", k, inter.Has(k))
+		}
+	}
+	if inter.Len() != 17 {
+		t.Errorf("expected 17 keys in the intersection but got %d", inter.Len())
+	}
+	if even.Len() != 50 {
+		t.Errorf("clone modified the original set: %d keys", even.Len())
+	}
+
+	s.Clear()
+	if s.Len() != 0 || s.Has("1") {
+		t.Error("set not empty after clear")
+	}
+}
+
+func TestUint64ScatterChain(t *testing.T) {
+	t.Parallel()
+
+	// Generate a bunch of integer keys, including the extremes.
+	rand := rand.New(rand.NewSource(10))
+	keys := make([]uint64, 1000)
+	for i := range keys {
+		keys[i] = rand.Uint64()
+	}
+	keys[0], keys[1] = 0, ^uint64(0)
+
+	var m Uint64ScatterChain
+	for i, k := range keys {
+		m.Put(k, i)
+		m.Put(k, &keys[i])
+	}
+	if n := m.Len(); n != len(keys) {
+		t.Errorf("expected length %d but got %d", len(keys), n)
+	}
+	for i, k := range keys {
+		if v, ok := m.Get(k); !ok || v != &keys[i] {
+			t.Errorf("wrong value for key %d", k)
+		}
+	}
+
+	// Read back the pairs, deleting them as we go.
+	found := make(map[uint64]bool, len(keys))
+	m.Each(func(key uint64, value interface{}) {
+		if found[key] {
+			t.Errorf("found key %d twice", key)
+		}
+		found[key] = true
+		if ptr, ok := value.(*uint64); !ok || *ptr != key {
+			t.Errorf("wrong value for key %d", key)
+		}
+		m.Delete(key)
+		if _, ok := m.Get(key); ok {
+			t.Errorf("key %d still exists", key)
+		}
+	})
+	if len(found) != len(keys) {
+		t.Errorf("inserted %d keys but found %d", len(keys), len(found))
+	}
+	if n := m.Len(); n != 0 {
+		t.Errorf("expected empty map but got length %d", n)
+	}
+}
+
+func TestScatterChainOf(t *testing.T) {
+	t.Parallel()
+
+	t.Run("IntKeys", func(t *testing.T) {
+		t.Parallel()
+
+		// Generate a bunch of signed integer keys, including the extremes.
+		rand := rand.New(rand.NewSource(11))
+		keys := make([]int64, 1000)
+		for i := range keys {
+			keys[i] = int64(rand.Uint64())
+		}
+		keys[0], keys[1], keys[2] = 0, -1<<63, 1<<63-1
+
+		var m ScatterChainOf[int64, int]
+		for i, k := range keys {
+			m.Put(k, -1)
+			m.Put(k, i)
+		}
+		if n := m.Len(); n != len(keys) {
+			t.Errorf("expected length %d but got %d", len(keys), n)
+		}
+
+		// Read back the pairs, deleting them as we go.
+		found := make(map[int64]bool, len(keys))
+		m.Each(func(key int64, value int) {
+			if found[key] {
+				t.Errorf("found key %d twice", key)
+			}
+			found[key] = true
+			if keys[value] != key {
+				t.Errorf("wrong value %d for key %d", value, key)
+			}
+			m.Delete(key)
+		})
+		if len(found) != len(keys) {
+			t.Errorf("inserted %d keys but found %d", len(keys), len(found))
+		}
+		if n := m.Len(); n != 0 {
+			t.Errorf("expected empty map but got length %d", n)
+		}
+		if v, ok := m.Get(keys[0]); ok || v != 0 {
+			t.Errorf("expected zero value for a missing key but got %d", v)
+		}
+	})
+
+	t.Run("NamedKeys", func(t *testing.T) {
+		t.Parallel()
+
+		type name string
+		type small uint8
+
+		m := BulkScatterChainOf([]name{"a", "b", "c"}, []small{1, 2, 3})
+		if v, ok := m.Get("b"); !ok || v != 2 {
+			t.Errorf("expected 2 but got %d", v)
+		}
+		if v, ok := m.GetBytes([]byte("c")); !ok || v != 3 {
+			t.Errorf("expected 3 but got %d", v)
+		}
+		m.Delete("a")
+		if v, ok := m.Get("a"); ok || v != 0 {
+			t.Errorf("expected zero value for a deleted key but got %d", v)
+		}
+
+		var bytes ScatterChainOf[small, name]
+		for i := 0; i < 256; i++ {
+			bytes.Put(small(i), name(strconv.Itoa(i)))
+		}
+		if n := bytes.Len(); n != 256 {
+			t.Errorf("expected length 256 but got %d", n)
+		}
+	})
+
+	t.Run("FullCollisions", func(t *testing.T) {
+		t.Parallel()
+
+		// The hash only depends on x, so keys with the same x collide fully and must be ordered by Less.
+		type point struct{ x, y int }
+		m := MakeScatterChainFunc[point, int](0, Hasher[point]{
+			Hash: func(key point, seed uint64) uint64 {
+				return (uint64(key.x) + seed) * 0x9e3779b97f4a7c15
+			},
+			Less: func(a, b point) bool {
+				return a.y < b.y
+			},
+		})
+		ref := map[point]int{}
+		for i := 0; i < 500; i++ {
+			k := point{i % 7, i}
+			m.Put(k, i)
+			ref[k] = i
+		}
+
+		// Delete and insert pairs during iteration, which moves pairs around the table.
+		seen := map[point]bool{}
+		m.Each(func(key point, value int) {
+			if seen[key] {
+				t.Errorf("found key %v twice", key)
+			}
+			seen[key] = true
+			if expect := key.y % 1000; value != expect {
+				t.Errorf("expected %d for key %v but got %d", expect, key, value)
+			}
+			if key.y%3 == 0 {
+				m.Delete(key)
+				delete(ref, key)
+			}
+			if key.y < 1000 {
+				m.Put(point{key.x, key.y + 1000}, key.y)
+			}
+		})
+		for key := range ref {
+			if key.y < 1000 && !seen[key] {
+				t.Errorf("missed key %v", key)
+			}
+		}
+
+		// The clone must keep the Hasher.
+		clone := m.Clone()
+		for k := range ref {
+			if _, ok := clone.Get(k); !ok {
+				t.Errorf("missing key %v in clone", k)
+			}
+		}
+
+		defer func() {
+			if recover() == nil {
+				t.Error("used a byte slice key with a custom Hasher")
+			}
+		}()
+		strs := MakeScatterChainFunc[string, int](0, Hasher[string]{Hash: strhash})
+		strs.Put("a", 1)
+		strs.GetBytes([]byte("a"))
+	})
+
+	t.Run("NoDefaultHasher", func(t *testing.T) {
+		t.Parallel()
+
+		type point struct{ x, y int }
+		expectPanic := func(what string, fn func()) {
+			t.Helper()
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s with a key type which has no default Hasher", what)
+				}
+			}()
+			fn()
+		}
+		expectPanic("made a map", func() {
+			MakeScatterChainOf[point, int](0)
+		})
+		expectPanic("used the zero value", func() {
+			var m ScatterChainOf[point, int]
+			m.Put(point{1, 2}, 3)
+		})
+	})
+
+	t.Run("Encoding", func(t *testing.T) {
+		t.Parallel()
+
+		var m ScatterChainOf[int, []string]
+		m.Put(-5, []string{"a"})
+		m.Put(7, []string{"b", "c"})
+
+		data, err := json.Marshal(&m)
+		if err != nil {
+			t.Fatalf("failed to encode JSON: %v", err)
+		}
+		var decoded ScatterChainOf[int, []string]
+		if err := json.Unmarshal(data, &decoded); err != nil {
+			t.Fatalf("failed to decode JSON %s: %v", data, err)
+		}
+		if v, ok := decoded.Get(7); !ok || !reflect.DeepEqual(v, []string{"b", "c"}) {
+			t.Errorf("expected [b c] but got %v from %s", v, data)
+		}
+
+		data, err = m.GobEncode()
+		if err != nil {
+			t.Fatalf("failed to encode gob: %v", err)
+		}
+		decoded = ScatterChainOf[int, []string]{}
+		if err := decoded.GobDecode(data); err != nil {
+			t.Fatalf("failed to decode gob: %v", err)
+		}
+		if v, ok := decoded.Get(-5); !ok || !reflect.DeepEqual(v, []string{"a"}) {
+			t.Errorf("expected [a] but got %v", v)
+		}
+
+		if err := decoded.UnmarshalJSON([]byte(`{"x":[]}`)); err == nil {
+			t.Error("decoded a key which is not an integer")
+		}
+	})
+}
+
+// BenchmarkScatterChainOf compares a ScatterChain, which boxes its values into interfaces, to a ScatterChainOf which stores the values directly.
+func BenchmarkScatterChainOf(b *testing.B) {
+	sizes := []struct {
+		name string
+		val  int
+	}{
+		{"64", 64},
+		{"1K", 1 << 10},
+		{"64K", 1 << 16},
+	}
+
+	for _, size := range sizes {
+		// Generate a bunch of string keys in random order.
+		// The values are large enough that the runtime does not have a preallocated box for them.
+		keys := make([]string, size.val)
+		for i := range keys {
+			keys[i] = strconv.Itoa(i)
+		}
+		rand.New(rand.NewSource(9)).Shuffle(len(keys), func(i, j int) {
+			keys[i], keys[j] = keys[j], keys[i]
+		})
+
+		b.Run(size.name, func(b *testing.B) {
+			b.Run("Boxed", func(b *testing.B) {
+				b.Run("Put", func(b *testing.B) {
+					b.ReportAllocs()
+					for i := 0; i < b.N; i++ {
+						m := MakeScatterChain(uint(len(keys)))
+						for j, k := range keys {
+							m.Put(k, 1000+j)
+						}
+					}
+				})
+				b.Run("Get", func(b *testing.B) {
+					m := MakeScatterChain(uint(len(keys)))
+					for j, k := range keys {
+						m.Put(k, 1000+j)
+					}
+					b.ResetTimer()
+					var sum int
+					for i := 0; i < b.N; i++ {
+						v, _ := m.Get(keys[i%len(keys)])
+						sum += v.(int)
+					}
+				})
+			})
+			b.Run("Generic", func(b *testing.B) {
+				b.Run("Put", func(b *testing.B) {
+					b.ReportAllocs()
+					for i := 0; i < b.N; i++ {
+						m := MakeScatterChainOf[string, int](uint(len(keys)))
+						for j, k := range keys {
+							m.Put(k, 1000+j)
+						}
+					}
+				})
+				b.Run("Get", func(b *testing.B) {
+					m := MakeScatterChainOf[string, int](uint(len(keys)))
+					for j, k := range keys {
+						m.Put(k, 1000+j)
+					}
+					b.ResetTimer()
+					var sum int
+					for i := 0; i < b.N; i++ {
+						v, _ := m.Get(keys[i%len(keys)])
+						sum += v
+					}
+				})
+			})
+		})
+	}
+}
+
 func BenchmarkMap(b *testing.B) {
 	impls := []struct {
 		name   string
@@ -199,6 +2288,18 @@ func BenchmarkMap(b *testing.B) {
 			chain := MakeScatterChain(cap)
 			return &chain
 		}},
+		{"Sharded", func(cap uint) Map { return NewSharded(8, cap) }},
+		{"SwissTable", func(cap uint) Map {
+			table := MakeSwissTable(cap)
+			return &table
+		}},
+		{"SortedMap", func(cap uint) Map { return &SortedMap{} }},
+		{"SmallMap", func(cap uint) Map { return &SmallMap{} }},
+		{"SyncMap", func(cap uint) Map { return &SyncMap{} }},
+		{"CuckooTable", func(cap uint) Map {
+			table := MakeCuckooTable(cap)
+			return &table
+		}},
 	}
 
 	for _, impl := range impls {
@@ -345,3 +2446,143 @@ func benchRandomReadHit(create func(uint) Map) func(b *testing.B) {
 		}
 	}
 }
+
+// lockedMap guards a map which is not safe for concurrent use with a lock.
+type lockedMap struct {
+	mu sync.RWMutex
+	Map
+}
+
+func (m *lockedMap) Get(key string) (interface{}, bool) {
+	m.mu.RLock()
+	v, ok := m.Map.Get(key)
+	m.mu.RUnlock()
+	return v, ok
+}
+
+func (m *lockedMap) Put(key string, value interface{}) {
+	m.mu.Lock()
+	m.Map.Put(key, value)
+	m.mu.Unlock()
+}
+
+func (m *lockedMap) Delete(key string) {
+	m.mu.Lock()
+	m.Map.Delete(key)
+	m.mu.Unlock()
+}
+
+// exclusiveMap wraps a Map with a mutex, for maps where Get modifies the map and so can not share a read lock.
+type exclusiveMap struct {
+	mu sync.Mutex
+	Map
+}
+
+func (m *exclusiveMap) Get(key string) (interface{}, bool) {
+	m.mu.Lock()
+	v, ok := m.Map.Get(key)
+	m.mu.Unlock()
+	return v, ok
+}
+
+func (m *exclusiveMap) Put(key string, value interface{}) {
+	m.mu.Lock()
+	m.Map.Put(key, value)
+	m.mu.Unlock()
+}
+
+func (m *exclusiveMap) Delete(key string) {
+	m.mu.Lock()
+	m.Map.Delete(key)
+	m.mu.Unlock()
+}
+
+func BenchmarkConcurrent(b *testing.B) {
+	impls := []struct {
+		name   string
+		create func(uint) Map
+	}{
+		{"Go", func(cap uint) Map { return &lockedMap{Map: make(Go, cap)} }},
+		{"ScatterChain", func(cap uint) Map {
+			chain := MakeScatterChain(cap)
+			return &lockedMap{Map: &chain}
+		}},
+		{"Sharded", func(cap uint) Map { return NewSharded(64, cap) }},
+		{"SwissTable", func(cap uint) Map {
+			table := MakeSwissTable(cap)
+			return &lockedMap{Map: &table}
+		}},
+		{"SortedMap", func(cap uint) Map { return &lockedMap{Map: &SortedMap{}} }},
+		{"SmallMap", func(cap uint) Map { return &lockedMap{Map: &SmallMap{}} }},
+		{"SyncMap", func(cap uint) Map { return &SyncMap{} }},
+		{"CuckooTable", func(cap uint) Map {
+			table := MakeCuckooTable(cap)
+			return &lockedMap{Map: &table}
+		}},
+		{"OrderedMap", func(cap uint) Map { return &lockedMap{Map: &OrderedMap{}} }},
+
+		// The capacity covers every key, so that the benchmark measures locking rather than eviction.
+		// Get moves a pair to the front of the list, so reads take the lock exclusively.
+		{"LRU", func(cap uint) Map { return &exclusiveMap{Map: NewLRU(cap, nil)} }},
+	}
+
+	scenarios := []struct {
+		name string
+
+		// reads is the percentage of operations which are reads.
+		// The remaining operations are split evenly between puts and deletes.
+		reads int
+	}{
+		{"ReadHeavy", 98},
+		{"Mixed", 50},
+		{"WriteHeavy", 10},
+	}
+
+	for _, impl := range impls {
+		impl := impl
+		b.Run(impl.name, func(b *testing.B) {
+			for _, scenario := range scenarios {
+				b.Run(scenario.name, benchConcurrent(impl.create, scenario.reads))
+			}
+		})
+	}
+}
+
+func benchConcurrent(create func(uint) Map, reads int) func(b *testing.B) {
+	return func(b *testing.B) {
+		// Generate a bunch of string keys.
+		keys := make([]string, 1<<16)
+		for i := range keys {
+			keys[i] = strconv.Itoa(i)
+		}
+
+		// Populate half of the keys, so that reads and deletes hit about half of the time.
+		m := create(uint(len(keys)))
+		for i := 0; i < len(keys); i += 2 {
+			m.Put(keys[i], &keys[i])
+		}
+
+		var seed uint64
+		var mu sync.Mutex
+		b.ResetTimer()
+		b.RunParallel(func(pb *testing.PB) {
+			// Each goroutine needs its own source of randomness.
+			mu.Lock()
+			seed++
+			rng := rand.New(rand.NewSource(seed))
+			mu.Unlock()
+
+			for pb.Next() {
+				i := rng.Intn(len(keys))
+				switch op := rng.Intn(100); {
+				case op < reads:
+					m.Get(keys[i])
+				case (op-reads)%2 == 0:
+					m.Put(keys[i], &keys[i])
+				default:
+					m.Delete(keys[i])
+				}
+			}
+		})
+	}
+}
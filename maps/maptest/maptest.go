@@ -0,0 +1,400 @@
+// Package maptest checks implementations of maps.Map against the interface contract.
+// Operations are applied to both the implementation and a reference Go map, and every result is compared.
+package maptest
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"testing"
+
+	"github.com/niaow/exp/maps"
+	"golang.org/x/exp/rand"
+)
+
+// Kind is a kind of operation on a map.
+type Kind uint8
+
+const (
+	// Put puts the value of the operation at its key.
+	Put Kind = iota
+
+	// Get gets the value at the key.
+	Get
+
+	// Delete deletes the key.
+	Delete
+
+	// Pop pops the key.
+	Pop
+
+	// Len checks the length of the map.
+	Len
+
+	// Clear clears the map.
+	Clear
+
+	// Each iterates over all of the pairs in the map.
+	Each
+
+	// Range iterates over the pairs in the map, stopping after the number of pairs in the value of the operation.
+	Range
+
+	// EachMutate iterates over all of the pairs in the map, deleting a pair which has not been visited yet and inserting a new pair at each step.
+	// At most as many pairs are inserted as were initially present.
+	// The keys of the new pairs are derived from the key of the operation.
+	EachMutate
+
+	// numKinds is the number of kinds of operations.
+	numKinds
+)
+
+func (k Kind) String() string {
+	switch k {
+	case Put:
+		return "Put"
+	case Get:
+		return "Get"
+	case Delete:
+		return "Delete"
+	case Pop:
+		return "Pop"
+	case Len:
+		return "Len"
+	case Clear:
+		return "Clear"
+	case Each:
+		return "Each"
+	case Range:
+		return "Range"
+	case EachMutate:
+		return "EachMutate"
+	default:
+		return "Kind(" + strconv.Itoa(int(k)) + ")"
+	}
+}
+
+// Op is an operation on a map.
+type Op struct {
+	Kind  Kind
+	Key   string
+	Value int
+}
+
+func (op Op) String() string {
+	return fmt.Sprintf("%v(%q, %d)", op.Kind, op.Key, op.Value)
+}
+
+// Apply applies a sequence of operations to a map and to a reference Go map, which must have the same contents.
+// It returns an error describing the first operation for which the map behaved differently from the reference, or violated the contract of maps.Map.
+// The contents of both maps are compared after the last operation.
+// Values are stored as ints, so the map may copy values.
+func Apply(m maps.Map, ref map[string]int, ops []Op) error {
+	for i, op := range ops {
+		if err := apply(m, ref, op); err != nil {
+			return fmt.Errorf("operation %d (%v): %w", i, op, err)
+		}
+	}
+
+	if err := compare(m, ref); err != nil {
+		return fmt.Errorf("after %d operations: %w", len(ops), err)
+	}
+
+	return nil
+}
+
+// apply applies a single operation.
+func apply(m maps.Map, ref map[string]int, op Op) error {
+	switch op.Kind {
+	case Put:
+		m.Put(op.Key, op.Value)
+		ref[op.Key] = op.Value
+
+	case Get:
+		v, ok := m.Get(op.Key)
+		expect, expectOK := ref[op.Key]
+		if err := checkValue(v, ok, expect, expectOK); err != nil {
+			return err
+		}
+
+	case Delete:
+		m.Delete(op.Key)
+		delete(ref, op.Key)
+
+	case Pop:
+		v, ok := m.Pop(op.Key)
+		expect, expectOK := ref[op.Key]
+		delete(ref, op.Key)
+		if err := checkValue(v, ok, expect, expectOK); err != nil {
+			return err
+		}
+
+	case Len:
+		if n := m.Len(); n != len(ref) {
+			return fmt.Errorf("expected length %d but got %d", len(ref), n)
+		}
+
+	case Clear:
+		m.Clear()
+		for k := range ref {
+			delete(ref, k)
+		}
+
+	case Each:
+		return compare(m, ref)
+
+	case Range:
+		return checkRange(m, ref, op.Value)
+
+	case EachMutate:
+		return checkEachMutate(m, ref, op.Key)
+
+	default:
+		return fmt.Errorf("unknown operation kind %v", op.Kind)
+	}
+
+	return nil
+}
+
+// checkValue compares a value returned by the map with the value from the reference.
+func checkValue(v interface{}, ok bool, expect int, expectOK bool) error {
+	switch {
+	case ok && !expectOK:
+		return fmt.Errorf("found missing key with value %v", v)
+	case !ok && expectOK:
+		return fmt.Errorf("key is missing (expected value %d)", expect)
+	case ok && v != expect:
+		return fmt.Errorf("expected value %d but got %v", expect, v)
+	}
+
+	return nil
+}
+
+// compare checks that the map contains exactly the pairs of the reference, visiting each one exactly once.
+func compare(m maps.Map, ref map[string]int) error {
+	if n := m.Len(); n != len(ref) {
+		return fmt.Errorf("expected length %d but got %d", len(ref), n)
+	}
+
+	seen := make(map[string]bool, len(ref))
+	var err error
+	m.Each(func(key string, value interface{}) {
+		if err != nil {
+			return
+		}
+		if seen[key] {
+			err = fmt.Errorf("visited %q twice", key)
+			return
+		}
+		seen[key] = true
+
+		expect, ok := ref[key]
+		if err = checkValue(value, true, expect, ok); err != nil {
+			err = fmt.Errorf("visited %q: %w", key, err)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if len(seen) != len(ref) {
+		return fmt.Errorf("expected to visit %d pairs but visited %d", len(ref), len(seen))
+	}
+
+	return nil
+}
+
+// checkRange checks that a Range stopped after n pairs visits distinct pairs from the reference.
+func checkRange(m maps.Map, ref map[string]int, n int) error {
+	if n < 1 {
+		n = 1
+	}
+
+	seen := make(map[string]bool, n)
+	var err error
+	m.Range(func(key string, value interface{}) bool {
+		if len(seen) >= n {
+			err = fmt.Errorf("continued after the function returned false")
+			return false
+		}
+		if seen[key] {
+			err = fmt.Errorf("visited %q twice", key)
+			return false
+		}
+		seen[key] = true
+
+		expect, ok := ref[key]
+		if err = checkValue(value, true, expect, ok); err != nil {
+			err = fmt.Errorf("visited %q: %w", key, err)
+			return false
+		}
+
+		return len(seen) < n
+	})
+	if err != nil {
+		return err
+	}
+	if expect := min(n, len(ref)); len(seen) != expect {
+		return fmt.Errorf("expected to visit %d pairs but visited %d", expect, len(seen))
+	}
+
+	return nil
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// checkEachMutate checks the semantics of a map range loop which modifies the map.
+// Every pair which is present for the entire iteration must be visited exactly once, and a pair which is deleted before it is reached must not be visited.
+// Pairs inserted during the iteration may or may not be visited.
+func checkEachMutate(m maps.Map, ref map[string]int, prefix string) error {
+	// Sort the initial keys, so that the victims are deterministic.
+	initial := make([]string, 0, len(ref))
+	for k := range ref {
+		initial = append(initial, k)
+	}
+	sort.Strings(initial)
+
+	seen := make(map[string]bool, len(ref))
+	deleted := make(map[string]bool)
+	inserted := make(map[string]bool)
+	next := 0
+	var err error
+	m.Each(func(key string, value interface{}) {
+		if err != nil {
+			return
+		}
+
+		switch {
+		case seen[key]:
+			err = fmt.Errorf("visited %q twice", key)
+		case deleted[key]:
+			err = fmt.Errorf("visited %q after it was deleted", key)
+		}
+		if err != nil {
+			return
+		}
+		seen[key] = true
+		expect, ok := ref[key]
+		if err = checkValue(value, true, expect, ok); err != nil {
+			err = fmt.Errorf("visited %q: %w", key, err)
+			return
+		}
+
+		// Delete the first initial key which has not been visited.
+		for next < len(initial) && (seen[initial[next]] || deleted[initial[next]]) {
+			next++
+		}
+		if next < len(initial) {
+			victim := initial[next]
+			m.Delete(victim)
+			delete(ref, victim)
+			deleted[victim] = true
+		}
+
+		// Insert a new key.
+		// The number of insertions is limited, as a map may visit every inserted pair.
+		k := prefix + "/" + strconv.Itoa(len(inserted))
+		if _, ok := ref[k]; !ok && !seen[k] && !deleted[k] && len(inserted) < len(initial) {
+			m.Put(k, len(inserted))
+			ref[k] = len(inserted)
+			inserted[k] = true
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, k := range initial {
+		if !seen[k] && !deleted[k] {
+			return fmt.Errorf("did not visit %q", k)
+		}
+	}
+
+	return nil
+}
+
+// RandomOps generates a random sequence of operations with keys drawn from a set of the specified size.
+// The sequence is determined by the seed.
+func RandomOps(seed uint64, n int, keys int) []Op {
+	rng := rand.New(rand.NewSource(seed))
+	ops := make([]Op, n)
+	for i := range ops {
+		op := Op{
+			Key:   strconv.Itoa(rng.Intn(keys)),
+			Value: i,
+		}
+		switch r := rng.Intn(1000); {
+		case r < 400:
+			op.Kind = Put
+		case r < 700:
+			op.Kind = Get
+		case r < 850:
+			op.Kind = Delete
+		case r < 950:
+			op.Kind = Pop
+		case r < 980:
+			op.Kind = Len
+		case r < 985:
+			op.Kind = Clear
+		case r < 990:
+			op.Kind = Each
+		case r < 995:
+			op.Kind = Range
+			op.Value = rng.Intn(keys) + 1
+		default:
+			op.Kind = EachMutate
+		}
+		ops[i] = op
+	}
+
+	return ops
+}
+
+// Decode decodes a sequence of operations from arbitrary bytes, for use with fuzzers.
+// Each operation uses 2 bytes: the kind, and the key.
+// Every sequence of bytes decodes to a valid sequence of operations.
+func Decode(data []byte) []Op {
+	ops := make([]Op, len(data)/2)
+	for i := range ops {
+		ops[i] = Op{
+			Kind:  Kind(data[2*i] % uint8(numKinds)),
+			Key:   strconv.Itoa(int(data[2*i+1])),
+			Value: i,
+		}
+	}
+
+	return ops
+}
+
+// Fuzz applies the operations decoded from the data to a map created by the function.
+// It panics if the map behaves differently from the reference.
+// It returns 1 if the data decoded to any operations, and 0 otherwise, following the go-fuzz convention.
+func Fuzz(create func() maps.Map, data []byte) int {
+	ops := Decode(data)
+	if err := Apply(create(), make(map[string]int), ops); err != nil {
+		panic(err)
+	}
+	if len(ops) == 0 {
+		return 0
+	}
+
+	return 1
+}
+
+// Test checks a map implementation with many random sequences of operations.
+// The function must create a new empty map.
+func Test(t *testing.T, create func() maps.Map) {
+	t.Helper()
+
+	for seed := uint64(1); seed <= 16; seed++ {
+		keys := 16 << (seed % 8)
+		ops := RandomOps(seed, 4*keys, keys)
+		if err := Apply(create(), make(map[string]int), ops); err != nil {
+			t.Errorf("seed %d: %v", seed, err)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package maptest_test
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/niaow/exp/maps"
+	"github.com/niaow/exp/maps/maptest"
+	"golang.org/x/exp/rand"
+)
+
+func TestMaps(t *testing.T) {
+	t.Parallel()
+
+	impls := []struct {
+		name   string
+		create func(t *testing.T) maps.Map
+	}{
+		{"Go", func(t *testing.T) maps.Map { return make(maps.Go) }},
+		{"ScatterChain", func(t *testing.T) maps.Map { return &maps.ScatterChain{} }},
+		{"Sharded", func(t *testing.T) maps.Map { return maps.NewSharded(8, 0) }},
+		{"SwissTable", func(t *testing.T) maps.Map { return &maps.SwissTable{} }},
+		{"OrderedMap", func(t *testing.T) maps.Map { return &maps.OrderedMap{} }},
+		{"LRU", func(t *testing.T) maps.Map { return maps.NewLRU(1<<20, nil) }},
+		{"SortedMap", func(t *testing.T) maps.Map { return &maps.SortedMap{} }},
+		{"SmallMap", func(t *testing.T) maps.Map { return &maps.SmallMap{} }},
+		{"SyncMap", func(t *testing.T) maps.Map { return &maps.SyncMap{} }},
+		{"CuckooTable", func(t *testing.T) maps.Map { return &maps.CuckooTable{} }},
+		{"DiskMap", func(t *testing.T) maps.Map {
+			m, err := maps.OpenDiskMap(filepath.Join(t.TempDir(), "map"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { m.Close() })
+			return m
+		}},
+	}
+
+	for _, impl := range impls {
+		impl := impl
+		t.Run(impl.name, func(t *testing.T) {
+			t.Parallel()
+
+			maptest.Test(t, func() maps.Map { return impl.create(t) })
+
+			// Random bytes should also work as fuzzer input.
+			rng := rand.New(rand.NewSource(3))
+			data := make([]byte, 512)
+			for i := 0; i < 8; i++ {
+				rng.Read(data)
+				maptest.Fuzz(func() maps.Map { return impl.create(t) }, data)
+			}
+		})
+	}
+}
+
+func TestApply(t *testing.T) {
+	t.Parallel()
+
+	// A broken map should be detected.
+	m := brokenMap{make(maps.Go)}
+	ops := []maptest.Op{
+		{Kind: maptest.Put, Key: "a", Value: 1},
+		{Kind: maptest.Put, Key: "a", Value: 2},
+		{Kind: maptest.Get, Key: "a"},
+	}
+	err := maptest.Apply(m, make(map[string]int), ops)
+	if err == nil {
+		t.Fatal("broken map was not detected")
+	}
+	if expect := `operation 2 (Get("a", 0)): expected value 2 but got 1`; err.Error() != expect {
+		t.Errorf("expected error %q but got %q", expect, err.Error())
+	}
+}
+
+// brokenMap ignores updates to keys which are already present.
+type brokenMap struct {
+	maps.Go
+}
+
+func (m brokenMap) Put(key string, value interface{}) {
+	if _, ok := m.Go[key]; !ok {
+		m.Go[key] = value
+	}
+}
+
+func ExampleApply() {
+	ops := []maptest.Op{
+		{Kind: maptest.Put, Key: "a", Value: 1},
+		{Kind: maptest.Pop, Key: "a"},
+		{Kind: maptest.Len},
+	}
+	fmt.Println(maptest.Apply(&maps.SwissTable{}, make(map[string]int), ops))
+	// Output: <nil>
+}
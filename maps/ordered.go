@@ -0,0 +1,198 @@
+package maps
+
+import "unsafe"
+
+// OrderedMap is a map which remembers the order in which keys were inserted.
+// The zero value is a ready-to-use empty map.
+// Pairs are stored in a ScatterChain, with each pair linked into a list in insertion order.
+// Updating the value of a key which is already present does not change its position.
+type OrderedMap struct {
+	// index maps each key to its entry.
+	index ScatterChain
+
+	// oldest and newest are the ends of the list of entries.
+	oldest, newest *orderedEntry
+}
+
+// orderedEntry is an entry in an OrderedMap.
+type orderedEntry struct {
+	key   string
+	value interface{}
+
+	// prev and next are the neighbouring entries in insertion order.
+	// When an entry is removed, next is left as is so that an iteration positioned on the entry can continue.
+	prev, next *orderedEntry
+
+	// removed is set when the entry is removed from the map.
+	removed bool
+}
+
+// entry finds the entry of a key.
+func (m *OrderedMap) entry(key string) *orderedEntry {
+	if m == nil {
+		return nil
+	}
+
+	e, ok := m.index.Get(key)
+	if !ok {
+		return nil
+	}
+
+	return e.(*orderedEntry)
+}
+
+// Each invokes a function with every key-value pair, from oldest to newest.
+// It inherits the same semantics as a map range loop.
+func (m *OrderedMap) Each(fn func(key string, value interface{})) {
+	m.Range(func(key string, value interface{}) bool {
+		fn(key, value)
+		return true
+	})
+}
+
+// Range invokes a function with every key-value pair from oldest to newest, stopping early if the function returns false.
+// It inherits the same semantics as a map range loop.
+func (m *OrderedMap) Range(fn func(key string, value interface{}) bool) {
+	if m == nil {
+		return
+	}
+
+	for e := m.oldest; e != nil; {
+		if !fn(e.key, e.value) {
+			return
+		}
+
+		// Skip over entries which have been removed since the iteration reached them.
+		e = e.next
+		for e != nil && e.removed {
+			e = e.next
+		}
+	}
+}
+
+func (m *OrderedMap) Get(key string) (interface{}, bool) {
+	e := m.entry(key)
+	if e == nil {
+		return nil, false
+	}
+
+	return e.value, true
+}
+
+// Put a key-value pair in the map.
+// If the key is not already present, it becomes the newest pair.
+func (m *OrderedMap) Put(key string, value interface{}) {
+	if e := m.entry(key); e != nil {
+		e.value = value
+		return
+	}
+
+	e := &orderedEntry{key: key, value: value}
+	m.index.Put(key, e)
+	m.pushNewest(e)
+}
+
+// pushNewest links an entry to the newest end of the list.
+func (m *OrderedMap) pushNewest(e *orderedEntry) {
+	e.prev, e.next = m.newest, nil
+	if m.newest != nil {
+		m.newest.next = e
+	} else {
+		m.oldest = e
+	}
+	m.newest = e
+}
+
+// unlink removes an entry from the list.
+// The next pointer of the entry is left as is.
+func (m *OrderedMap) unlink(e *orderedEntry) {
+	if e.prev != nil {
+		e.prev.next = e.next
+	} else {
+		m.oldest = e.next
+	}
+	if e.next != nil {
+		e.next.prev = e.prev
+	} else {
+		m.newest = e.prev
+	}
+}
+
+func (m *OrderedMap) Delete(key string) {
+	m.Pop(key)
+}
+
+func (m *OrderedMap) Pop(key string) (interface{}, bool) {
+	if m == nil {
+		return nil, false
+	}
+
+	v, ok := m.index.Pop(key)
+	if !ok {
+		return nil, false
+	}
+
+	e := v.(*orderedEntry)
+	m.unlink(e)
+	e.removed = true
+	value := e.value
+	e.value = nil
+	return value, true
+}
+
+func (m *OrderedMap) Clear() {
+	if m == nil {
+		return
+	}
+
+	// Mark the entries as removed so that an iteration in progress stops.
+	for e := m.oldest; e != nil; e = e.next {
+		e.removed = true
+		e.value = nil
+	}
+	m.oldest, m.newest = nil, nil
+	m.index.Clear()
+}
+
+func (m *OrderedMap) Len() int {
+	if m == nil {
+		return 0
+	}
+
+	return m.index.Len()
+}
+
+func (m *OrderedMap) Info() string {
+	return m.index.Info()
+}
+
+// Stats returns the statistics of the index, including the memory used by the list entries.
+func (m *OrderedMap) Stats() Stats {
+	if m == nil {
+		return Stats{}
+	}
+
+	s := m.index.Stats()
+	s.Bytes += uintptr(s.Len) * unsafe.Sizeof(orderedEntry{})
+	return s
+}
+
+// Oldest returns the pair which was inserted first.
+// If the map is empty, the last return is false.
+func (m *OrderedMap) Oldest() (key string, value interface{}, ok bool) {
+	if m == nil || m.oldest == nil {
+		return "", nil, false
+	}
+
+	return m.oldest.key, m.oldest.value, true
+}
+
+// Newest returns the pair which was inserted last.
+// If the map is empty, the last return is false.
+func (m *OrderedMap) Newest() (key string, value interface{}, ok bool) {
+	if m == nil || m.newest == nil {
+		return "", nil, false
+	}
+
+	return m.newest.key, m.newest.value, true
+}
@@ -0,0 +1,314 @@
+package maps
+
+import "math/bits"
+
+// hamtBits is the number of bits of the hash consumed by each level of a Persistent map.
+const hamtBits = 5
+
+// Persistent is an immutable map implemented as a hash array mapped trie (HAMT).
+// The zero value is an empty map.
+// Set and Delete return a new map rather than modifying the existing one.
+// The new map shares all unchanged nodes with the old map, so only the nodes on the path to the key (about log32(n) of them) are copied.
+// This makes it cheap to keep many versions of a map, such as for configuration snapshots or MVCC-style caches.
+// A Persistent map is safe for concurrent use by multiple goroutines, as it is never modified.
+// It does not implement Map, as Map requires modification in place.
+type Persistent struct {
+	// root is the root node of the trie, or nil if the map is empty.
+	root *hamtNode
+
+	// n is the number of key-value pairs in the map.
+	n int
+
+	// seed is the seed used to hash keys.
+	// This is randomly generated when the first key is inserted into an empty map, and then shared with all versions derived from it.
+	seed uint64
+}
+
+// hamtNode is a node of a Persistent map.
+// Each node has up to 32 children, selected by the next 5 bits of the hash.
+// Only present children are stored, in order, so a node is only as large as its number of children.
+type hamtNode struct {
+	// bitmap has bit i set if the child with index i is present.
+	bitmap uint32
+
+	// children are the present children.
+	children []hamtChild
+}
+
+// hamtChild is either a sub-trie or a leaf containing pairs.
+type hamtChild struct {
+	// node is the sub-trie, if this is not a leaf.
+	node *hamtNode
+
+	// hash is the hash of the keys in the leaf.
+	hash uint64
+
+	// pairs are the pairs in the leaf.
+	// There is normally one pair, but there may be more if their keys have the same hash.
+	pairs []hamtPair
+}
+
+type hamtPair struct {
+	key   string
+	value interface{}
+}
+
+// hamtIndex finds the bitmap bit of the child for a hash at the specified shift.
+func hamtIndex(hash uint64, shift uint) uint32 {
+	return uint32(1) << ((hash >> shift) & (1<<hamtBits - 1))
+}
+
+// pos finds the position of the child with the specified bitmap bit in the children slice.
+func (n *hamtNode) pos(bit uint32) int {
+	return bits.OnesCount32(n.bitmap & (bit - 1))
+}
+
+// Len returns the number of key-value pairs in the map.
+func (m Persistent) Len() int {
+	return m.n
+}
+
+// Get checks if the key is present.
+// If it is not present, the second return is false.
+func (m Persistent) Get(key string) (interface{}, bool) {
+	if m.root == nil {
+		return nil, false
+	}
+
+	return m.get(strhash(key, m.seed), key)
+}
+
+// get looks up a key with a precomputed hash.
+func (m Persistent) get(hash uint64, key string) (interface{}, bool) {
+	n := m.root
+	for shift := uint(0); n != nil; shift += hamtBits {
+		bit := hamtIndex(hash, shift)
+		if n.bitmap&bit == 0 {
+			return nil, false
+		}
+
+		child := &n.children[n.pos(bit)]
+		if child.node != nil {
+			n = child.node
+			continue
+		}
+
+		if child.hash == hash {
+			for _, p := range child.pairs {
+				if p.key == key {
+					return p.value, true
+				}
+			}
+		}
+		break
+	}
+
+	return nil, false
+}
+
+// Set returns a copy of the map with a key set to a value.
+// If the key is already present, the value is replaced.
+func (m Persistent) Set(key string, value interface{}) Persistent {
+	if m.seed == 0 {
+		m.seed = newSeed()
+	}
+
+	return m.set(strhash(key, m.seed), key, value)
+}
+
+// set sets a key with a precomputed hash.
+func (m Persistent) set(hash uint64, key string, value interface{}) Persistent {
+	root, added := hamtSet(m.root, 0, hash, key, value)
+	m.root = root
+	if added {
+		m.n++
+	}
+
+	return m
+}
+
+// hamtSet returns a copy of a node with a key set to a value.
+// The second return is true if the key was not previously present.
+func hamtSet(n *hamtNode, shift uint, hash uint64, key string, value interface{}) (*hamtNode, bool) {
+	leaf := hamtChild{hash: hash, pairs: []hamtPair{{key, value}}}
+	if n == nil {
+		return &hamtNode{bitmap: hamtIndex(hash, shift), children: []hamtChild{leaf}}, true
+	}
+
+	bit := hamtIndex(hash, shift)
+	pos := n.pos(bit)
+	if n.bitmap&bit == 0 {
+		// Insert a new leaf.
+		children := make([]hamtChild, len(n.children)+1)
+		copy(children, n.children[:pos])
+		children[pos] = leaf
+		copy(children[pos+1:], n.children[pos:])
+		return &hamtNode{bitmap: n.bitmap | bit, children: children}, true
+	}
+
+	child := n.children[pos]
+	var added bool
+	switch {
+	case child.node != nil:
+		// Recurse into the sub-trie.
+		child.node, added = hamtSet(child.node, shift+hamtBits, hash, key, value)
+
+	case child.hash == hash:
+		// Replace or add the pair in the leaf.
+		i := 0
+		for i < len(child.pairs) && child.pairs[i].key != key {
+			i++
+		}
+		added = i == len(child.pairs)
+		pairs := make([]hamtPair, len(child.pairs), len(child.pairs)+1)
+		copy(pairs, child.pairs)
+		if added {
+			pairs = append(pairs, hamtPair{key, value})
+		} else {
+			pairs[i].value = value
+		}
+		child.pairs = pairs
+
+	default:
+		// Split the leaf into a sub-trie.
+		child = hamtChild{node: hamtMerge(shift+hamtBits, child, leaf)}
+		added = true
+	}
+
+	children := make([]hamtChild, len(n.children))
+	copy(children, n.children)
+	children[pos] = child
+	return &hamtNode{bitmap: n.bitmap, children: children}, added
+}
+
+// hamtMerge creates a sub-trie containing two leaves with different hashes.
+func hamtMerge(shift uint, a, b hamtChild) *hamtNode {
+	ba, bb := hamtIndex(a.hash, shift), hamtIndex(b.hash, shift)
+	switch {
+	case ba == bb:
+		// The hashes collide at this level as well, so go deeper.
+		return &hamtNode{bitmap: ba, children: []hamtChild{{node: hamtMerge(shift+hamtBits, a, b)}}}
+	case ba < bb:
+		return &hamtNode{bitmap: ba | bb, children: []hamtChild{a, b}}
+	default:
+		return &hamtNode{bitmap: ba | bb, children: []hamtChild{b, a}}
+	}
+}
+
+// Delete returns a copy of the map without a key.
+// If the key is not present, the map is returned as is.
+func (m Persistent) Delete(key string) Persistent {
+	if m.root == nil {
+		return m
+	}
+
+	return m.delete(strhash(key, m.seed), key)
+}
+
+// delete deletes a key with a precomputed hash.
+func (m Persistent) delete(hash uint64, key string) Persistent {
+	root, removed := hamtDelete(m.root, 0, hash, key)
+	if !removed {
+		return m
+	}
+
+	m.root = root
+	m.n--
+	return m
+}
+
+// hamtDelete returns a copy of a node without a key.
+// If the node would be empty, it returns nil.
+// The second return is false if the key was not present, in which case the node is returned as is.
+func hamtDelete(n *hamtNode, shift uint, hash uint64, key string) (*hamtNode, bool) {
+	bit := hamtIndex(hash, shift)
+	if n.bitmap&bit == 0 {
+		return n, false
+	}
+
+	pos := n.pos(bit)
+	child := n.children[pos]
+	if child.node != nil {
+		sub, removed := hamtDelete(child.node, shift+hamtBits, hash, key)
+		if !removed {
+			return n, false
+		}
+
+		if len(sub.children) == 1 && sub.children[0].node == nil {
+			// Pull a lone leaf up into this node, so that the trie does not keep a chain of single-child nodes.
+			child = sub.children[0]
+		} else {
+			child.node = sub
+		}
+	} else {
+		if child.hash != hash {
+			return n, false
+		}
+
+		i := 0
+		for i < len(child.pairs) && child.pairs[i].key != key {
+			i++
+		}
+		if i == len(child.pairs) {
+			return n, false
+		}
+
+		if len(child.pairs) == 1 {
+			// Remove the leaf entirely.
+			if len(n.children) == 1 {
+				return nil, true
+			}
+
+			children := make([]hamtChild, len(n.children)-1)
+			copy(children, n.children[:pos])
+			copy(children[pos:], n.children[pos+1:])
+			return &hamtNode{bitmap: n.bitmap &^ bit, children: children}, true
+		}
+
+		pairs := make([]hamtPair, 0, len(child.pairs)-1)
+		pairs = append(pairs, child.pairs[:i]...)
+		child.pairs = append(pairs, child.pairs[i+1:]...)
+	}
+
+	children := make([]hamtChild, len(n.children))
+	copy(children, n.children)
+	children[pos] = child
+	return &hamtNode{bitmap: n.bitmap, children: children}, true
+}
+
+// Each invokes a function with every key-value pair.
+// The order is determined by the hashes of the keys, and is the same for every version of a map with the same keys.
+func (m Persistent) Each(fn func(key string, value interface{})) {
+	m.Range(func(key string, value interface{}) bool {
+		fn(key, value)
+		return true
+	})
+}
+
+// Range invokes a function with every key-value pair, stopping early if the function returns false.
+// It uses the same order as Each.
+func (m Persistent) Range(fn func(key string, value interface{}) bool) {
+	if m.root != nil {
+		m.root.each(fn)
+	}
+}
+
+// each visits the pairs in a node, returning false if the iteration was stopped.
+func (n *hamtNode) each(fn func(key string, value interface{}) bool) bool {
+	for _, child := range n.children {
+		if child.node != nil {
+			if !child.node.each(fn) {
+				return false
+			}
+			continue
+		}
+
+		for _, p := range child.pairs {
+			if !fn(p.key, p.value) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
@@ -3,6 +3,8 @@ package maps
 import (
 	"fmt"
 	"math/bits"
+	"reflect"
+	"unsafe"
 )
 
 // inverseFreeRatio is the inverse of the target ratio of empty slots.
@@ -12,24 +14,182 @@ const inverseFreeRatio = 8
 
 // MakeScatterChain makes a ScatterChain with capacity for the specified number of elements.
 func MakeScatterChain(size uint) (res ScatterChain) {
-	if size != 0 {
-		size += (size / inverseFreeRatio) + 1
+	return MakeScatterChainOf[string, interface{}](size)
+}
+
+// MakeScatterChainOf makes a ScatterChainOf with capacity for the specified number of elements.
+// This panics if the key type has no default Hasher, rather than when the first key is hashed.
+func MakeScatterChainOf[K comparable, V any](size uint) (res ScatterChainOf[K, V]) {
+	res = makeScatterChain[K, V](size, newSeed())
+	res.hasher = defaultHasher[K]()
+	return
+}
+
+// MakeScatterChainFunc makes a ScatterChainOf with capacity for the specified number of elements, which hashes and orders keys with the specified Hasher.
+// This is required for key types which have no default Hasher.
+func MakeScatterChainFunc[K comparable, V any](size uint, hasher Hasher[K]) (res ScatterChainOf[K, V]) {
+	if hasher.Hash == nil {
+		panic("nil hash function")
+	}
+	res = makeScatterChain[K, V](size, newSeed())
+	res.hasher, res.customHash = hasher, true
+	return
+}
+
+// MakeSeededScatterChain makes a ScatterChain with capacity for the specified number of elements, which hashes keys with a fixed seed.
+// Normally each map uses a random seed, so that the layout of the table cannot be predicted (or attacked) from the keys.
+// A fixed seed makes the layout and iteration order reproducible, which can be useful for tests.
+// The seed must not be 0.
+func MakeSeededScatterChain(size uint, seed uint64) (res ScatterChain) {
+	if seed == 0 {
+		panic("zero seed")
+	}
+
+	return makeScatterChain[string, interface{}](size, seed)
+}
 
-		logSize := bits.Len(size - 1)
-		res.slots = make([]scatterChainSlot, 1<<logSize)
+// makeScatterChain makes a ScatterChainOf with capacity for the specified number of elements, and a nonzero seed.
+func makeScatterChain[K comparable, V any](size uint, seed uint64) (res ScatterChainOf[K, V]) {
+	res.seed = seed
+	if size != 0 {
+		logSize := scatterChainLogSize(size)
+		res.slots = make([]scatterChainSlot[K, V], 1<<logSize)
 		res.shift = 64 - uint(logSize)
 	}
 
 	return
 }
 
-// ScatterChain is a map implementation using a chained scatter table with Brent's invariant (based off of the system used by Lua).
+// MakeArenaScatterChain makes a ScatterChain with capacity for the specified number of elements, which stores its keys in an internal arena.
+// Rather than referencing the strings passed to Put, the map copies each new key into large chunks of memory, which are released wholesale by Clear.
+// This reduces the number of allocations the garbage collector has to track for maps with millions of short-lived keys, and makes PutBytes allocation-free for new keys.
+// The memory used by a deleted key is not reclaimed until the map is cleared, so this is a poor fit for long-lived maps with many deletions.
+// Values are stored as is.
+func MakeArenaScatterChain(size uint) (res ScatterChain) {
+	res = MakeScatterChain(size)
+	res.arena = &keyArena{}
+	return
+}
+
+// scatterChainLogSize computes the log2 of the number of slots required to hold the specified number of elements.
+// This leaves enough free slots that inserting the elements does not exceed the free ratio and grow the table.
+func scatterChainLogSize(size uint) int {
+	size += (size / (inverseFreeRatio - 1)) + 1
+
+	return bits.Len(size - 1)
+}
+
+// BulkScatterChain builds a ScatterChain containing the specified key-value pairs.
+// See BulkScatterChainOf.
+func BulkScatterChain(keys []string, values []interface{}) ScatterChain {
+	return BulkScatterChainOf(keys, values)
+}
+
+// BulkScatterChainOf builds a ScatterChainOf containing the specified key-value pairs.
+// The keys and values are paired up by index, and must have the same length.
+// If a key is repeated, the last value is used.
+// The table is sized for the pairs up front, and the pairs are inserted in two passes.
+// The first pass places every pair whose primary slot is free as the head of its chain.
+// The second pass inserts the remaining pairs, which can only be placed in slots which are not the primary slot of any pair.
+// This means that no pair needs to be moved out of another chain to maintain Brent's invariant.
+// Inserting in hash order would also avoid moves, but fills the table from one end and makes freeSlot scan a long run of full slots for each collision.
+func BulkScatterChainOf[K comparable, V any](keys []K, values []V) ScatterChainOf[K, V] {
+	if len(keys) != len(values) {
+		panic("mismatched keys and values")
+	}
+
+	res := MakeScatterChainOf[K, V](uint(len(keys)))
+
+	// Place the pairs which have a free primary slot.
+	deferred := make([]int, 0, len(keys)/4)
+	for i, k := range keys {
+		idx := uint(res.hash(k) >> res.shift)
+		switch {
+		case res.slots[idx].tag == scatterChainTagEmpty:
+			res.slots[idx] = scatterChainSlot[K, V]{key: k, value: values[i], tag: scatterChainTagHead}
+			res.n++
+		case res.slots[idx].key == k:
+			res.slots[idx].value = values[i]
+		default:
+			deferred = append(deferred, i)
+		}
+	}
+
+	// Insert the colliding pairs into the chains.
+	for _, i := range deferred {
+		res.doPut(res.hash(keys[i]), keys[i], values[i])
+	}
+
+	return res
+}
+
+// Hasher hashes and orders the keys of a ScatterChainOf.
+type Hasher[K comparable] struct {
+	// Hash hashes a key with a seed.
+	// Different seeds should produce unrelated hashes.
+	Hash func(key K, seed uint64) uint64
+
+	// Less orders keys which have the same hash.
+	// It may be nil if Hash is a bijection for each seed, as then there are never full collisions.
+	Less func(a, b K) bool
+}
+
+// defaultHasher returns the Hasher used for a key type when none is specified.
+// Keys with an underlying string type are hashed in the same way as the keys of a ScatterChain.
+// Keys with an underlying integer type are hashed in the same way as the keys of a Uint64ScatterChain, which never has full collisions.
+// Other key types have no default Hasher, so this panics.
+func defaultHasher[K comparable]() Hasher[K] {
+	var zero K
+	switch reflect.TypeOf(&zero).Elem().Kind() {
+	case reflect.String:
+		return Hasher[K]{
+			Hash: func(key K, seed uint64) uint64 {
+				return strhash(*(*string)(unsafe.Pointer(&key)), seed)
+			},
+			Less: func(a, b K) bool {
+				return *(*string)(unsafe.Pointer(&a)) < *(*string)(unsafe.Pointer(&b))
+			},
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		switch unsafe.Sizeof(zero) {
+		case 1:
+			return Hasher[K]{Hash: intHasher[K, uint8]}
+		case 2:
+			return Hasher[K]{Hash: intHasher[K, uint16]}
+		case 4:
+			return Hasher[K]{Hash: intHasher[K, uint32]}
+		default:
+			return Hasher[K]{Hash: intHasher[K, uint64]}
+		}
+	default:
+		panic(fmt.Sprintf("maps: no default hash function for keys of type %T (use MakeScatterChainFunc)", zero))
+	}
+}
+
+// intHasher hashes a key with an underlying integer type, by reading its bits as the unsigned integer type of the same size.
+func intHasher[K comparable, U uint8 | uint16 | uint32 | uint64](key K, seed uint64) uint64 {
+	return inthash(uint64(*(*U)(unsafe.Pointer(&key))), seed)
+}
+
+// ScatterChain is a ScatterChainOf with string keys and interface{} values.
+// This was the only form of the map before type parameters were available.
+type ScatterChain = ScatterChainOf[string, interface{}]
+
+// ScatterChainOf is a map implementation using a chained scatter table with Brent's invariant (based off of the system used by Lua).
 // The zero value is a ready-to-use empty map.
 // This is somewhat nice in that it uses an exactly-predictable amount of memory for a given maximum capacity.
 // The constant memory overhead is somewhat lower than Go's maps, but the minimum proportional memory overhead is significantly higher.
 // It is more memory-efficient for tiny maps, and less memory-efficient for large maps.
-// This implementation requires an ordered comparator to be defined over the key type.
-type ScatterChain struct {
+// This implementation requires an ordered comparator to be defined over the key type, which is provided by the Hasher.
+// Keys are hashed with the default Hasher for the key type, unless the map was made with MakeScatterChainFunc.
+// The zero value uses the default Hasher, so it panics when the first key is hashed if the key type has none.
+// Values are stored directly in the slots, so unlike a ScatterChain, storing a value does not box it into an interface.
+type ScatterChainOf[K comparable, V any] struct {
+	// check detects concurrent misuse of the map, if the package is built with the maps_checked tag.
+	// This is the first field, as a trailing zero-size field would add padding.
+	check mapChecker
+
 	// slots are where the actual data is stored.
 	// An empty slot is represented by the zero value of scatterChainSlot.
 	// The hash of a key is used to map it to a primary slot in this array.
@@ -40,7 +200,7 @@ type ScatterChain struct {
 	// In a scatter table with Brent's invariant, the contents of the old slot are instead migrated elsewhere.
 	// This avoids an edge case where all slots form one giant linked list, but complicates iteration a bit when interleaved with insertion or deletion.
 	// In order to provide Go-style iteration semantics, this implementation sorts the collision chains in hash order, followed by key order in case of a full collision.
-	slots []scatterChainSlot
+	slots []scatterChainSlot[K, V]
 
 	// n is the number of key-value pairs currently stored in the map.
 	n uint
@@ -48,14 +208,59 @@ type ScatterChain struct {
 	// shift is the downward shift of a hash required to produce a slot index.
 	// This is 64-bits.Len64(len(slots)-1).
 	shift uint
+
+	// seed is the seed used to hash keys.
+	// This is randomly generated when the first key is hashed, unless it was fixed when the map was made.
+	seed uint64
+
+	// hasher is used to hash and order keys.
+	// This is set to the default Hasher for the key type when the first key is hashed, unless it was set when the map was made.
+	hasher Hasher[K]
+
+	// customHash is set if the map was made with a Hasher, rather than using the default Hasher for the key type.
+	customHash bool
+
+	// arena is used to allocate new keys, if the map was made with MakeArenaScatterChain.
+	// This is only used with string keys.
+	arena *keyArena
+}
+
+// hash computes the hash of a key.
+func (m *ScatterChainOf[K, V]) hash(key K) uint64 {
+	if m.seed == 0 {
+		m.seed = newSeed()
+	}
+	if m.hasher.Hash == nil {
+		m.hasher = defaultHasher[K]()
+	}
+
+	return m.hasher.Hash(key, m.seed)
+}
+
+// hashBytes computes the hash of a key which was converted from a byte slice by bytesKey.
+// Keys passed to a Hasher escape to the heap, so this calls the string hash directly instead, which requires the default Hasher.
+func (m *ScatterChainOf[K, V]) hashBytes(key string) uint64 {
+	if m.customHash {
+		panic("maps: byte slice keys require the default Hasher")
+	}
+	if m.seed == 0 {
+		m.seed = newSeed()
+	}
+
+	return strhash(key, m.seed)
 }
 
-type scatterChainSlot struct {
+// after checks if a pair comes after another in the order of the chains, which is hash order followed by key order in case of a full collision.
+func (m *ScatterChainOf[K, V]) after(hash uint64, key K, otherHash uint64, other K) bool {
+	return hash > otherHash || (hash == otherHash && key != other && m.hasher.Less(other, key))
+}
+
+type scatterChainSlot[K comparable, V any] struct {
 	// key is the key of the pair if present.
-	key string
+	key K
 
 	// value is the currently assigned value corresponding to the key.
-	value interface{}
+	value V
 
 	// tag contains all other metadata for the slot.
 	// If the slot is empty, this will be scatterChainEmpty.
@@ -122,7 +327,70 @@ func (t scatterChainTag) String() string {
 	}
 }
 
-func (m *ScatterChain) Info() string {
+// Clone creates an independent copy of the map.
+// The slots are copied directly, so this does not need to rehash any keys.
+// The values are copied as is, so values containing pointers will be shared between the maps.
+func (m *ScatterChainOf[K, V]) Clone() ScatterChainOf[K, V] {
+	return m.CloneFunc(nil)
+}
+
+// CloneFunc creates an independent copy of the map, copying each value with the specified function.
+// This can be used to deep-copy values containing pointers.
+// If the function is nil, the values are copied as is.
+func (m *ScatterChainOf[K, V]) CloneFunc(copyValue func(value V) V) ScatterChainOf[K, V] {
+	if m == nil || len(m.slots) == 0 {
+		return ScatterChainOf[K, V]{}
+	}
+
+	res := ScatterChainOf[K, V]{
+		slots:      make([]scatterChainSlot[K, V], len(m.slots)),
+		n:          m.n,
+		shift:      m.shift,
+		seed:       m.seed,
+		hasher:     m.hasher,
+		customHash: m.customHash,
+	}
+	if m.arena != nil {
+		// The keys are never modified, so they can be shared with the old arena.
+		res.arena = &keyArena{}
+	}
+	copy(res.slots, m.slots)
+	if copyValue != nil {
+		for i := range res.slots {
+			if res.slots[i].tag != scatterChainTagEmpty {
+				res.slots[i].value = copyValue(res.slots[i].value)
+			}
+		}
+	}
+
+	return res
+}
+
+func (m *ScatterChainOf[K, V]) Clear() {
+	if m == nil {
+		return
+	}
+
+	m.check.startWrite()
+	for i := range m.slots {
+		m.slots[i] = scatterChainSlot[K, V]{}
+	}
+	m.n = 0
+	if m.arena != nil {
+		m.arena.reset()
+	}
+	m.check.endWrite()
+}
+
+func (m *ScatterChainOf[K, V]) Len() int {
+	if m == nil {
+		return 0
+	}
+
+	return int(m.n)
+}
+
+func (m *ScatterChainOf[K, V]) Info() string {
 	var heads uint
 	for i := range m.slots {
 		if m.slots[i].tag.isHead() {
@@ -133,7 +401,44 @@ func (m *ScatterChain) Info() string {
 	return fmt.Sprintf("len=%d cap=%d heads=%d (%0.2f%% collision rate)", m.n, len(m.slots), heads, 100*(float64(m.n-heads)/float64(m.n)))
 }
 
-func (m *ScatterChain) dump() {
+// Stats returns statistics describing the internal state of the map.
+// The probe length of a pair is its position in its collision chain.
+func (m *ScatterChainOf[K, V]) Stats() Stats {
+	if m == nil {
+		return Stats{}
+	}
+
+	s := Stats{
+		Len:      int(m.n),
+		Capacity: len(m.slots),
+		Bytes:    uintptr(len(m.slots)) * unsafe.Sizeof(scatterChainSlot[K, V]{}),
+	}
+	var total int
+	for i := range m.slots {
+		if !m.slots[i].tag.isHead() {
+			continue
+		}
+
+		s.Heads++
+		probe := 1
+		for idx := uint(i); ; probe++ {
+			total += probe
+			next, ok := m.slots[idx].tag.next()
+			if !ok {
+				break
+			}
+			idx = next
+		}
+		if probe > s.MaxProbe {
+			s.MaxProbe = probe
+		}
+	}
+	s.derive(total)
+
+	return s
+}
+
+func (m *ScatterChainOf[K, V]) dump() {
 	fmt.Println("table:")
 	for _, slot := range m.slots {
 		if slot.tag == scatterChainTagEmpty {
@@ -141,11 +446,41 @@ func (m *ScatterChain) dump() {
 			continue
 		}
 
-		fmt.Printf("\tkey=%s value=%v tag=%s\n", slot.key, slot.value, slot.tag.String())
+		fmt.Printf("\tkey=%v value=%v tag=%s\n", slot.key, slot.value, slot.tag.String())
+	}
+}
+
+func (m *ScatterChainOf[K, V]) Each(fn func(key K, value V)) {
+	m.Range(func(key K, value V) bool {
+		fn(key, value)
+		return true
+	})
+}
+
+// EachSnapshot invokes a function with every key-value pair present when it is called.
+// It has the same semantics as the EachSnapshot function.
+// Each must rescan a chain whenever the function moves the pair it was called with, which can make it much slower when the function inserts many keys.
+// This instead copies the keys in slot order first, which does not require hashing them, and then looks up each one.
+func (m *ScatterChainOf[K, V]) EachSnapshot(fn func(key K, value V)) {
+	if m == nil {
+		return
+	}
+
+	m.check.read()
+	keys := make([]K, 0, m.n)
+	for i := range m.slots {
+		if m.slots[i].tag != scatterChainTagEmpty {
+			keys = append(keys, m.slots[i].key)
+		}
+	}
+	for _, k := range keys {
+		if v, ok := m.Get(k); ok {
+			fn(k, v)
+		}
 	}
 }
 
-func (m *ScatterChain) Each(fn func(key string, value interface{})) {
+func (m *ScatterChainOf[K, V]) Range(fn func(key K, value V) bool) {
 	if m == nil {
 		return
 	}
@@ -160,7 +495,7 @@ func (m *ScatterChain) Each(fn func(key string, value interface{})) {
 	// Pairs inserted during iteration may not be hit, but this is allowed by the Go spec.
 
 	// Find the first element.
-	var lastKey string
+	var lastKey K
 	var lastHash uint64
 	{
 		i := 0
@@ -176,8 +511,11 @@ func (m *ScatterChain) Each(fn func(key string, value interface{})) {
 				// A simpler implementation would just loop by index, but that doesn't work here because Go allows the map to be modified during iteration.
 				// For a normal scatter chain that would work anyway, Brent's variation requires data to be moved when inserting a new key.
 				lastKey = m.slots[i].key
-				lastHash = strhash(lastKey)
-				fn(m.slots[i].key, m.slots[i].value)
+				lastHash = m.hash(lastKey)
+				m.check.iter()
+				if !fn(m.slots[i].key, m.slots[i].value) {
+					return
+				}
 				break
 			}
 
@@ -197,12 +535,15 @@ func (m *ScatterChain) Each(fn func(key string, value interface{})) {
 
 	for {
 		for {
-			keyHash := strhash(m.slots[i].key)
-			if keyHash > lastHash || (keyHash == lastHash && m.slots[i].key > lastKey) {
+			keyHash := m.hash(m.slots[i].key)
+			if m.after(keyHash, m.slots[i].key, lastHash, lastKey) {
 				// This key has not been processed yet.
 				lastKey = m.slots[i].key
 				lastHash = keyHash
-				fn(m.slots[i].key, m.slots[i].value)
+				m.check.iter()
+				if !fn(m.slots[i].key, m.slots[i].value) {
+					return
+				}
 				if i >= uint(len(m.slots)) || m.slots[i].tag == scatterChainTagEmpty || m.slots[i].key != lastKey {
 					// The table was modified, so rescan the chain.
 					i = uint(lastHash >> m.shift)
@@ -232,33 +573,150 @@ func (m *ScatterChain) Each(fn func(key string, value interface{})) {
 	}
 }
 
-func (m *ScatterChain) Get(key string) (interface{}, bool) {
+func (m *ScatterChainOf[K, V]) Get(key K) (V, bool) {
 	if m == nil || len(m.slots) == 0 {
-		return nil, false
+		var zero V
+		return zero, false
 	}
 
-	hash := strhash(key)
+	idx, ok := m.find(m.hash(key), key)
+	if !ok {
+		var zero V
+		return zero, false
+	}
 
+	return m.slots[idx].value, true
+}
+
+// GetBytes is like Get, but takes the key as a byte slice.
+// The key is not converted to a string, so this does not allocate.
+// This panics unless the key type is a string type, and the map uses the default Hasher.
+func (m *ScatterChainOf[K, V]) GetBytes(key []byte) (V, bool) {
+	if m == nil || len(m.slots) == 0 {
+		var zero V
+		return zero, false
+	}
+
+	k := bytesKey[K](key)
+	idx, ok := m.find(m.hashBytes(unsafeString(key)), k)
+	if !ok {
+		var zero V
+		return zero, false
+	}
+
+	return m.slots[idx].value, true
+}
+
+// find finds the index of the slot containing a key.
+// The map must not be empty.
+func (m *ScatterChainOf[K, V]) find(hash uint64, key K) (uint, bool) {
+	m.check.read()
 	idx := uint(hash >> uint64(m.shift))
 	if !m.slots[idx].tag.isHead() {
-		return nil, false
+		return 0, false
 	}
 
 	for {
 		if m.slots[idx].key == key {
-			return m.slots[idx].value, true
+			return idx, true
 		}
 
 		next, ok := m.slots[idx].tag.next()
 		if !ok {
-			return nil, false
+			return 0, false
 		}
 
 		idx = next
 	}
 }
 
-func (m *ScatterChain) Put(key string, value interface{}) {
+// GetOrInsert returns the value of the key if it is present.
+// Otherwise, it inserts the result of fn and returns it.
+// The loaded result is true if the value was already present.
+// The key is only hashed once, and the table is only probed once if the key is present.
+// The function must not modify the map.
+func (m *ScatterChainOf[K, V]) GetOrInsert(key K, fn func() V) (value V, loaded bool) {
+	hash := m.hash(key)
+	if len(m.slots) != 0 {
+		if idx, ok := m.find(hash, key); ok {
+			return m.slots[idx].value, true
+		}
+	}
+
+	value = fn()
+	m.put(hash, key, value)
+	return value, false
+}
+
+// Compute updates the value of a key based on its current value.
+// The function is called with the current value, and ok set to whether the key is present.
+// If the function returns true, the key is set to the returned value, and otherwise it is deleted.
+// The new value and whether the key is present are returned.
+// The key is only hashed once, and the table is only probed once if the key is present and kept.
+// The function must not modify the map.
+func (m *ScatterChainOf[K, V]) Compute(key K, fn func(old V, ok bool) (V, bool)) (V, bool) {
+	hash := m.hash(key)
+	if len(m.slots) != 0 {
+		if idx, ok := m.find(hash, key); ok {
+			value, keep := fn(m.slots[idx].value, true)
+			if !keep {
+				m.delete(hash, key)
+				var zero V
+				return zero, false
+			}
+
+			m.check.startWrite()
+			m.slots[idx].value = value
+			m.check.endWrite()
+			return value, true
+		}
+	}
+
+	var zero V
+	value, keep := fn(zero, false)
+	if !keep {
+		return zero, false
+	}
+
+	m.put(hash, key, value)
+	return value, true
+}
+
+func (m *ScatterChainOf[K, V]) Put(key K, value V) {
+	m.put(m.hash(key), key, value)
+}
+
+// PutBytes is like Put, but takes the key as a byte slice.
+// The key is only copied into a new string if it is not already present, so updating an existing pair does not allocate.
+// If the map stores its keys in an arena, a new key is copied directly into the arena.
+// This panics unless the key type is a string type, and the map uses the default Hasher.
+func (m *ScatterChainOf[K, V]) PutBytes(key []byte, value V) {
+	k := bytesKey[K](key)
+	hash := m.hashBytes(unsafeString(key))
+	if len(m.slots) != 0 {
+		if idx, ok := m.find(hash, k); ok {
+			// Update the pair in-place.
+			m.check.startWrite()
+			m.slots[idx].value = value
+			m.check.endWrite()
+			return
+		}
+	}
+
+	if m.arena != nil {
+		// The key will be copied into the arena by doPut.
+		m.put(hash, k, value)
+		return
+	}
+
+	// The key type was checked by bytesKey, so the copy can be converted back to a key.
+	c := string(key)
+	m.put(hash, *(*K)(unsafe.Pointer(&c)), value)
+}
+
+// put inserts or updates a key-value pair with a precomputed hash, growing the table if necessary.
+func (m *ScatterChainOf[K, V]) put(hash uint64, key K, value V) {
+	m.check.startWrite()
 	if m.n == uint(len(m.slots)) || uint(len(m.slots))-m.n < uint(len(m.slots))/inverseFreeRatio {
 		// Ensure that at least one slot is available for insert, even if we might not use it.
 		// Additionally, apply a constant upper bound to the load factor such that freeSlot does not get extremely slow.
@@ -266,21 +724,69 @@ func (m *ScatterChain) Put(key string, value interface{}) {
 		m.grow()
 	}
 
-	m.doPut(key, value)
+	m.doPut(hash, key, value)
+	m.check.endWrite()
+}
+
+// PutAll puts every key-value pair from another map into this map.
+// The table is grown once up front to fit the pairs.
+func (m *ScatterChainOf[K, V]) PutAll(other MapOf[K, V]) {
+	m.Reserve(uint(other.Len()))
+	other.Each(func(key K, value V) {
+		m.Put(key, value)
+	})
+}
+
+// Reserve grows the table such that the specified number of additional pairs can be inserted without growing again.
+// This avoids repeatedly rehashing the table during a bulk insert into a map which is already populated.
+// The table is never shrunk.
+func (m *ScatterChainOf[K, V]) Reserve(extra uint) {
+	if extra == 0 {
+		return
+	}
+
+	logSize := scatterChainLogSize(m.n + extra)
+	if 1<<logSize <= len(m.slots) {
+		// There is already enough space.
+		return
+	}
+
+	m.check.startWrite()
+
+	// Create a larger temporary map.
+	var tmp ScatterChainOf[K, V]
+	tmp.seed, tmp.hasher = m.seed, m.hasher
+	tmp.shift = 64 - uint(logSize)
+	tmp.slots = make([]scatterChainSlot[K, V], 1<<logSize)
+
+	// Copy the pairs into the new map.
+	for i := range m.slots {
+		if m.slots[i].tag == scatterChainTagEmpty {
+			continue
+		}
+
+		tmp.doPut(m.hash(m.slots[i].key), m.slots[i].key, m.slots[i].value)
+	}
+
+	// Replace the table with the new table.
+	// The arena is not attached to the new map, so that the existing keys are not copied again.
+	m.slots, m.shift = tmp.slots, tmp.shift
+	m.check.endWrite()
 }
 
-func (m *ScatterChain) grow() {
+func (m *ScatterChainOf[K, V]) grow() {
 	if len(m.slots) == 0 {
 		// Handle a fresh map seperately.
-		m.slots = make([]scatterChainSlot, 4)
+		m.slots = make([]scatterChainSlot[K, V], 4)
 		m.shift = 62
 		return
 	}
 
 	// Create a larger temporary map.
-	var tmp ScatterChain
+	var tmp ScatterChainOf[K, V]
+	tmp.seed, tmp.hasher = m.seed, m.hasher
 	tmp.shift = m.shift - 1
-	tmp.slots = make([]scatterChainSlot, 2*len(m.slots))
+	tmp.slots = make([]scatterChainSlot[K, V], 2*len(m.slots))
 
 	// Copy the pairs into the new map.
 	for i := range m.slots {
@@ -288,19 +794,19 @@ func (m *ScatterChain) grow() {
 			continue
 		}
 
-		tmp.doPut(m.slots[i].key, m.slots[i].value)
+		tmp.doPut(m.hash(m.slots[i].key), m.slots[i].key, m.slots[i].value)
 	}
 
-	// Overwrite the old map with the new map.
-	*m = tmp
+	// Replace the table with the new table.
+	// The arena is not attached to the new map, so that the existing keys are not copied again.
+	m.slots, m.shift = tmp.slots, tmp.shift
 
 	// There is a fancier way to do this which skips reallocating indices, but it appears to be slightly slower.
 }
 
 // doPut inserts or updates a key-value pair.
 // This will panic if there is not sufficient available space.
-func (m *ScatterChain) doPut(key string, value interface{}) {
-	hash := strhash(key)
+func (m *ScatterChainOf[K, V]) doPut(hash uint64, key K, value V) {
 	idx := uint(hash >> m.shift)
 	switch {
 	case m.slots[idx].tag == scatterChainTagEmpty:
@@ -313,7 +819,7 @@ func (m *ScatterChain) doPut(key string, value interface{}) {
 		dst := m.freeSlot(idx)
 
 		// Find the parent of the pair.
-		parent := uint(strhash(m.slots[idx].key) >> m.shift)
+		parent := uint(m.hash(m.slots[idx].key) >> m.shift)
 		for {
 			next, _ := m.slots[parent].tag.next()
 			if next == idx {
@@ -338,7 +844,7 @@ func (m *ScatterChain) doPut(key string, value interface{}) {
 		return
 
 	default:
-		if keyHash := strhash(m.slots[idx].key); keyHash > hash || (keyHash == hash && m.slots[idx].key > key) {
+		if m.after(m.hash(m.slots[idx].key), m.slots[idx].key, hash, key) {
 			// In order to insert to the head of a chain, we must move the former-head's pair.
 			dst := m.freeSlot(idx)
 			m.slots[dst] = m.slots[idx]
@@ -359,7 +865,7 @@ func (m *ScatterChain) doPut(key string, value interface{}) {
 				break
 			}
 
-			if keyHash := strhash(m.slots[next].key); keyHash > hash || (keyHash == hash && m.slots[next].key > key) {
+			if m.after(m.hash(m.slots[next].key), m.slots[next].key, hash, key) {
 				// The next key is beyond the key we want to insert.
 				// Insert after idx.
 				break
@@ -385,13 +891,18 @@ func (m *ScatterChain) doPut(key string, value interface{}) {
 	}
 
 	// Populate the slot with the pair.
+	if m.arena != nil {
+		// Only maps with string keys have an arena.
+		k := (*string)(unsafe.Pointer(&key))
+		*k = m.arena.alloc(*k)
+	}
 	m.slots[idx].key, m.slots[idx].value = key, value
 	m.n++
 }
 
 // freeSlot finds the nearest free slot.
 // If there are no free slots, this will panic.
-func (m *ScatterChain) freeSlot(near uint) uint {
+func (m *ScatterChainOf[K, V]) freeSlot(near uint) uint {
 	for i, j := int(near), near+1; i >= 0 || j < uint(len(m.slots)); {
 		if i >= 0 {
 			if m.slots[i].tag == scatterChainTagEmpty {
@@ -410,33 +921,72 @@ func (m *ScatterChain) freeSlot(near uint) uint {
 	panic("no free slot")
 }
 
-func (m *ScatterChain) Delete(key string) {
+// Pop removes the key from the map, and returns the value it had.
+// If it is not present, the second return is false.
+// This only probes the table once, unlike a Get followed by a Delete.
+func (m *ScatterChainOf[K, V]) Pop(key K) (V, bool) {
+	if m == nil || len(m.slots) == 0 {
+		var zero V
+		return zero, false
+	}
+
+	return m.delete(m.hash(key), key)
+}
+
+func (m *ScatterChainOf[K, V]) Delete(key K) {
+	if m == nil || len(m.slots) == 0 {
+		return
+	}
+
+	m.delete(m.hash(key), key)
+}
+
+// DeleteBytes is like Delete, but takes the key as a byte slice.
+// The key is not converted to a string, so this does not allocate.
+// This panics unless the key type is a string type, and the map uses the default Hasher.
+func (m *ScatterChainOf[K, V]) DeleteBytes(key []byte) {
 	if m == nil || len(m.slots) == 0 {
 		return
 	}
 
-	hash := strhash(key)
+	k := bytesKey[K](key)
+	m.delete(m.hashBytes(unsafeString(key)), k)
+}
+
+// delete removes a key with a precomputed hash from a non-empty map.
+// It returns the removed value, if the key was present.
+func (m *ScatterChainOf[K, V]) delete(hash uint64, key K) (V, bool) {
+	m.check.startWrite()
+	value, ok := m.doDelete(hash, key)
+	m.check.endWrite()
+	return value, ok
+}
+
+// doDelete implements delete.
+func (m *ScatterChainOf[K, V]) doDelete(hash uint64, key K) (V, bool) {
 	idx := uint(hash >> uint64(m.shift))
 	if !m.slots[idx].tag.isHead() {
 		// This hash-bucket is empty.
-		return
+		var zero V
+		return zero, false
 	}
 
 	if m.slots[idx].key == key {
 		// The key is at the head of the chain.
+		value := m.slots[idx].value
 		m.n--
 		if next, ok := m.slots[idx].tag.next(); ok {
 			// Move the next pair to the chain head.
 			m.slots[idx] = m.slots[next]
-			m.slots[next] = scatterChainSlot{}
+			m.slots[next] = scatterChainSlot[K, V]{}
 			m.slots[idx].tag |= scatterChainTagHead
-			return
+			return value, true
 		}
 
 		// The key is also the only value in the chain.
 		// Clear the slot.
-		m.slots[idx] = scatterChainSlot{}
-		return
+		m.slots[idx] = scatterChainSlot[K, V]{}
+		return value, true
 	}
 
 	// Search for the key in the chain.
@@ -445,7 +995,8 @@ func (m *ScatterChain) Delete(key string) {
 		next, ok := m.slots[idx].tag.next()
 		if !ok {
 			// The key is not in the map.
-			return
+			var zero V
+			return zero, false
 		}
 
 		idx, prev = next, idx
@@ -458,7 +1009,22 @@ func (m *ScatterChain) Delete(key string) {
 	m.slots[prev].tag = (m.slots[prev].tag & scatterChainTagHead) | m.slots[idx].tag
 
 	// Clear the slot.
-	m.slots[idx] = scatterChainSlot{}
+	value := m.slots[idx].value
+	m.slots[idx] = scatterChainSlot[K, V]{}
 
 	m.n--
+	return value, true
+}
+
+// bytesKey views a byte slice as a string key without copying it.
+// The key must not be retained, as the bytes may later be modified.
+// This panics unless the key type is a string type.
+func bytesKey[K comparable](key []byte) K {
+	var zero K
+	if reflect.TypeOf(&zero).Elem().Kind() != reflect.String {
+		panic(fmt.Sprintf("maps: byte slice keys require string keys, not %T", zero))
+	}
+
+	k := unsafeString(key)
+	return *(*K)(unsafe.Pointer(&k))
 }
@@ -0,0 +1,435 @@
+package maps
+
+import "fmt"
+
+// MakeSet makes a Set with capacity for the specified number of keys.
+func MakeSet(size uint) (res Set) {
+	res.seed = newSeed()
+	if size != 0 {
+		logSize := scatterChainLogSize(size)
+		res.slots = make([]setSlot, 1<<logSize)
+		res.shift = 64 - uint(logSize)
+	}
+
+	return
+}
+
+// Set is a set of strings, using the same chained scatter table as ScatterChain.
+// The zero value is a ready-to-use empty set.
+// The slots only store keys, so a Set uses a bit more than half of the memory of a ScatterChain with the same keys.
+type Set struct {
+	// slots are where the keys are stored.
+	// See ScatterChain.
+	slots []setSlot
+
+	// n is the number of keys currently stored in the set.
+	n uint
+
+	// shift is the downward shift of a hash required to produce a slot index.
+	// This is 64-bits.Len64(len(slots)-1).
+	shift uint
+
+	// seed is the seed used to hash keys.
+	// This is randomly generated when the first key is hashed.
+	seed uint64
+}
+
+type setSlot struct {
+	// key is the key if present.
+	key string
+
+	// tag contains all other metadata for the slot.
+	// If the slot is empty, this will be scatterChainEmpty.
+	tag scatterChainTag
+}
+
+// hash computes the hash of a key.
+func (s *Set) hash(key string) uint64 {
+	if s.seed == 0 {
+		s.seed = newSeed()
+	}
+
+	return strhash(key, s.seed)
+}
+
+// Clear removes all keys from the set, retaining the allocated capacity.
+func (s *Set) Clear() {
+	if s == nil {
+		return
+	}
+
+	for i := range s.slots {
+		s.slots[i] = setSlot{}
+	}
+	s.n = 0
+}
+
+// Len returns the number of keys in the set.
+func (s *Set) Len() int {
+	if s == nil {
+		return 0
+	}
+
+	return int(s.n)
+}
+
+// Info spits out miscellaneous statistics for debugging purposes.
+func (s *Set) Info() string {
+	var heads uint
+	for i := range s.slots {
+		if s.slots[i].tag.isHead() {
+			heads++
+		}
+	}
+
+	return fmt.Sprintf("len=%d cap=%d heads=%d (%0.2f%% collision rate)", s.n, len(s.slots), heads, 100*(float64(s.n-heads)/float64(s.n)))
+}
+
+// Clone creates an independent copy of the set.
+func (s *Set) Clone() Set {
+	if s == nil || len(s.slots) == 0 {
+		return Set{}
+	}
+
+	res := Set{
+		slots: make([]setSlot, len(s.slots)),
+		n:     s.n,
+		shift: s.shift,
+		seed:  s.seed,
+	}
+	copy(res.slots, s.slots)
+	return res
+}
+
+// Each invokes a function with every key.
+// It inherits the same semantics as a map range loop.
+func (s *Set) Each(fn func(key string)) {
+	s.Range(func(key string) bool {
+		fn(key)
+		return true
+	})
+}
+
+// Range invokes a function with every key, stopping early if the function returns false.
+// It inherits the same semantics as a map range loop.
+func (s *Set) Range(fn func(key string) bool) {
+	if s == nil {
+		return
+	}
+
+	// This uses the same traversal as ScatterChain.Range, in hash order followed by key order.
+
+	// Find the first element.
+	var lastKey string
+	var lastHash uint64
+	{
+		i := 0
+		for {
+			if i >= len(s.slots) {
+				// The set is empty.
+				return
+			}
+
+			if s.slots[i].tag.isHead() {
+				// This is the first list head, and thus the first key.
+				lastKey = s.slots[i].key
+				lastHash = s.hash(lastKey)
+				if !fn(s.slots[i].key) {
+					return
+				}
+				break
+			}
+
+			i++
+		}
+	}
+
+	// Start at the slot corresponding to the first element's hash.
+	i := uint(lastHash >> s.shift)
+	for !s.slots[i].tag.isHead() {
+		// This slot is not a head, so move to the next slot.
+		i++
+		if i >= uint(len(s.slots)) {
+			return
+		}
+	}
+
+	for {
+		for {
+			keyHash := s.hash(s.slots[i].key)
+			if keyHash > lastHash || (keyHash == lastHash && s.slots[i].key > lastKey) {
+				// This key has not been processed yet.
+				lastKey = s.slots[i].key
+				lastHash = keyHash
+				if !fn(s.slots[i].key) {
+					return
+				}
+				if i >= uint(len(s.slots)) || s.slots[i].tag == scatterChainTagEmpty || s.slots[i].key != lastKey {
+					// The table was modified, so rescan the chain.
+					i = uint(lastHash >> s.shift)
+					break
+				}
+			}
+
+			// Move to the next key in the chain.
+			next, ok := s.slots[i].tag.next()
+			if !ok {
+				// There are no more keys in this chain.
+				// Move to the next chain.
+				i = uint(lastHash>>s.shift) + 1
+				break
+			}
+
+			i = next
+		}
+
+		for i < uint(len(s.slots)) && !s.slots[i].tag.isHead() {
+			// This slot is not a head, so move to the next slot.
+			i++
+		}
+		if i >= uint(len(s.slots)) {
+			return
+		}
+	}
+}
+
+// Has checks if the key is in the set.
+func (s *Set) Has(key string) bool {
+	if s == nil || len(s.slots) == 0 {
+		return false
+	}
+
+	idx := uint(s.hash(key) >> s.shift)
+	if !s.slots[idx].tag.isHead() {
+		return false
+	}
+
+	for {
+		if s.slots[idx].key == key {
+			return true
+		}
+
+		next, ok := s.slots[idx].tag.next()
+		if !ok {
+			return false
+		}
+
+		idx = next
+	}
+}
+
+// Add a key to the set.
+// If the key is already present, nothing happens.
+func (s *Set) Add(key string) {
+	if s.n == uint(len(s.slots)) || uint(len(s.slots))-s.n < uint(len(s.slots))/inverseFreeRatio {
+		// Ensure that at least one slot is available for insert, and bound the load factor.
+		// See ScatterChain.put.
+		s.grow()
+	}
+
+	s.doAdd(s.hash(key), key)
+}
+
+func (s *Set) grow() {
+	if len(s.slots) == 0 {
+		// Handle a fresh set seperately.
+		s.slots = make([]setSlot, 4)
+		s.shift = 62
+		return
+	}
+
+	// Create a larger temporary set.
+	var tmp Set
+	tmp.seed = s.seed
+	tmp.shift = s.shift - 1
+	tmp.slots = make([]setSlot, 2*len(s.slots))
+
+	// Copy the keys into the new set.
+	for i := range s.slots {
+		if s.slots[i].tag == scatterChainTagEmpty {
+			continue
+		}
+
+		tmp.doAdd(s.hash(s.slots[i].key), s.slots[i].key)
+	}
+
+	// Overwrite the old set with the new set.
+	*s = tmp
+}
+
+// doAdd inserts a key.
+// This will panic if there is not sufficient available space.
+func (s *Set) doAdd(hash uint64, key string) {
+	idx := uint(hash >> s.shift)
+	switch {
+	case s.slots[idx].tag == scatterChainTagEmpty:
+		// Configure the slot as a fresh head.
+		s.slots[idx].tag = scatterChainTagHead
+
+	case !s.slots[idx].tag.isHead():
+		// This slot is currently used by a different chain.
+		// Find somewhere to move the previous key.
+		dst := s.freeSlot(idx)
+
+		// Find the parent of the key.
+		parent := uint(s.hash(s.slots[idx].key) >> s.shift)
+		for {
+			next, _ := s.slots[parent].tag.next()
+			if next == idx {
+				break
+			}
+
+			parent = next
+		}
+
+		// Move the key.
+		s.slots[dst] = s.slots[idx]
+
+		// Update the parent's reference.
+		s.slots[parent].tag.setNext(dst)
+
+		// Configure the slot as a fresh head.
+		s.slots[idx].tag = scatterChainTagHead
+
+	case s.slots[idx].key == key:
+		// The key is already present.
+		return
+
+	default:
+		if keyHash := s.hash(s.slots[idx].key); keyHash > hash || (keyHash == hash && s.slots[idx].key > key) {
+			// In order to insert to the head of a chain, we must move the former-head's key.
+			dst := s.freeSlot(idx)
+			s.slots[dst] = s.slots[idx]
+			s.slots[dst].tag = s.slots[dst].tag.behead()
+
+			// Reconfigure the head slot.
+			s.slots[idx].tag.setNext(dst)
+			break
+		}
+
+		// Traverse the chain, looking for the insertion point.
+		for {
+			next, ok := s.slots[idx].tag.next()
+			if !ok {
+				// That was the end of the chain.
+				// Insert after the last key.
+				break
+			}
+
+			if keyHash := s.hash(s.slots[next].key); keyHash > hash || (keyHash == hash && s.slots[next].key > key) {
+				// The next key is beyond the key we want to insert.
+				// Insert after idx.
+				break
+			}
+
+			if s.slots[next].key == key {
+				// The key is already present.
+				return
+			}
+
+			idx = next
+		}
+
+		// Reserve a slot for the new key.
+		dst := s.freeSlot(idx)
+
+		// Insert the slot into the chain.
+		s.slots[dst].tag = s.slots[idx].tag.behead()
+		s.slots[idx].tag.setNext(dst)
+
+		idx = dst
+	}
+
+	// Populate the slot with the key.
+	s.slots[idx].key = key
+	s.n++
+}
+
+// freeSlot finds the nearest free slot.
+// If there are no free slots, this will panic.
+func (s *Set) freeSlot(near uint) uint {
+	for i, j := int(near), near+1; i >= 0 || j < uint(len(s.slots)); {
+		if i >= 0 {
+			if s.slots[i].tag == scatterChainTagEmpty {
+				return uint(i)
+			}
+			i--
+		}
+		if j < uint(len(s.slots)) {
+			if s.slots[j].tag == scatterChainTagEmpty {
+				return j
+			}
+			j++
+		}
+	}
+
+	panic("no free slot")
+}
+
+// Delete removes the key from the set.
+// If it is not present, nothing happens.
+func (s *Set) Delete(key string) {
+	if s == nil || len(s.slots) == 0 {
+		return
+	}
+
+	idx := uint(s.hash(key) >> s.shift)
+	if !s.slots[idx].tag.isHead() {
+		// This hash-bucket is empty.
+		return
+	}
+
+	if s.slots[idx].key == key {
+		// The key is at the head of the chain.
+		s.n--
+		if next, ok := s.slots[idx].tag.next(); ok {
+			// Move the next key to the chain head.
+			s.slots[idx] = s.slots[next]
+			s.slots[next] = setSlot{}
+			s.slots[idx].tag |= scatterChainTagHead
+			return
+		}
+
+		// The key is the only one in the chain.
+		// Clear the slot.
+		s.slots[idx] = setSlot{}
+		return
+	}
+
+	// Search for the key in the chain.
+	var prev uint
+	for {
+		next, ok := s.slots[idx].tag.next()
+		if !ok {
+			// The key is not in the set.
+			return
+		}
+
+		idx, prev = next, idx
+		if s.slots[idx].key == key {
+			break
+		}
+	}
+
+	// Replace the reference to this key's slot.
+	s.slots[prev].tag = (s.slots[prev].tag & scatterChainTagHead) | s.slots[idx].tag
+
+	// Clear the slot.
+	s.slots[idx] = setSlot{}
+
+	s.n--
+}
+
+// Union adds every key in another set to this set.
+func (s *Set) Union(other *Set) {
+	other.Each(s.Add)
+}
+
+// Intersect removes every key which is not in another set from this set.
+func (s *Set) Intersect(other *Set) {
+	s.Each(func(key string) {
+		if !other.Has(key) {
+			s.Delete(key)
+		}
+	})
+}
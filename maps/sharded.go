@@ -0,0 +1,228 @@
+package maps
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+	"sync"
+	"unsafe"
+)
+
+// NewSharded creates a Sharded map with the specified number of shards and capacity for the specified number of elements.
+// The number of shards is rounded up to a power of two, and the capacity is divided evenly between the shards.
+// A shard count of 0 is treated as 1.
+func NewSharded(shards uint, size uint) *Sharded {
+	if shards == 0 {
+		shards = 1
+	}
+	logShards := bits.Len(shards - 1)
+	shards = 1 << logShards
+
+	m := &Sharded{
+		shards: make([]shard, shards),
+		mask:   uint64(shards - 1),
+		seed:   newSeed(),
+	}
+	if size != 0 {
+		per := (size + shards - 1) / shards
+		for i := range m.shards {
+			m.shards[i].m = MakeScatterChain(per)
+		}
+	}
+
+	return m
+}
+
+// Sharded is a map implementation which is safe for concurrent use by multiple goroutines.
+// Keys are partitioned across a fixed set of ScatterChains, each of which is guarded by its own lock.
+// Operations on keys in different shards do not contend, so this scales better than a single locked map when accessed by many goroutines.
+// A Sharded must be created with NewSharded.
+type Sharded struct {
+	// shards are the underlying maps.
+	// The number of shards is always a power of two.
+	shards []shard
+
+	// mask is the mask applied to a hash to produce a shard index.
+	mask uint64
+
+	// seed is the seed used to hash keys when selecting a shard.
+	seed uint64
+}
+
+// shard is a single partition of a Sharded map.
+type shard struct {
+	mu sync.RWMutex
+	m  ScatterChain
+}
+
+// shard finds the shard which a key belongs to.
+func (m *Sharded) shard(key string) *shard {
+	// The ScatterChain indexes slots with the upper bits of the hash, so use the lower bits here.
+	return &m.shards[strhash(key, m.seed)&m.mask]
+}
+
+// Each invokes a function with every key-value pair.
+// The function is called without holding any locks, so it may modify the map.
+// Pairs which are deleted before they are reached are not visited, and pairs which are inserted during iteration may or may not be visited.
+// The iteration does not necessarily correspond to a consistent snapshot of the map if it is modified concurrently.
+func (m *Sharded) Each(fn func(key string, value interface{})) {
+	m.Range(func(key string, value interface{}) bool {
+		fn(key, value)
+		return true
+	})
+}
+
+// Range invokes a function with every key-value pair, stopping early if the function returns false.
+// It has the same semantics as Each.
+func (m *Sharded) Range(fn func(key string, value interface{}) bool) {
+	var keys []string
+	for i := range m.shards {
+		s := &m.shards[i]
+
+		// Collect the keys in the shard.
+		keys = keys[:0]
+		s.mu.RLock()
+		s.m.Each(func(key string, value interface{}) {
+			keys = append(keys, key)
+		})
+		s.mu.RUnlock()
+
+		// Visit the pairs which are still present.
+		for _, k := range keys {
+			s.mu.RLock()
+			v, ok := s.m.Get(k)
+			s.mu.RUnlock()
+			if ok && !fn(k, v) {
+				return
+			}
+		}
+	}
+}
+
+func (m *Sharded) Get(key string) (interface{}, bool) {
+	s := m.shard(key)
+	s.mu.RLock()
+	v, ok := s.m.Get(key)
+	s.mu.RUnlock()
+	return v, ok
+}
+
+func (m *Sharded) Put(key string, value interface{}) {
+	s := m.shard(key)
+	s.mu.Lock()
+	s.m.Put(key, value)
+	s.mu.Unlock()
+}
+
+// LoadOrStore returns the existing value for the key if present.
+// Otherwise, it stores the given value and returns it.
+// The loaded result is true if the value was loaded, and false if it was stored.
+// This is performed atomically with respect to other operations on the map.
+func (m *Sharded) LoadOrStore(key string, value interface{}) (actual interface{}, loaded bool) {
+	s := m.shard(key)
+
+	// Try the common case of an existing key with only a read lock.
+	s.mu.RLock()
+	v, ok := s.m.Get(key)
+	s.mu.RUnlock()
+	if ok {
+		return v, true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// The key may have been inserted since the read lock was released.
+	if v, ok := s.m.Get(key); ok {
+		return v, true
+	}
+	s.m.Put(key, value)
+	return value, false
+}
+
+func (m *Sharded) Delete(key string) {
+	s := m.shard(key)
+	s.mu.Lock()
+	s.m.Delete(key)
+	s.mu.Unlock()
+}
+
+// Pop removes the key from the map, and returns the value it had.
+// If it is not present, the second return is false.
+// This is performed atomically, so if multiple goroutines pop the same key, only one of them receives the value.
+func (m *Sharded) Pop(key string) (interface{}, bool) {
+	s := m.shard(key)
+	s.mu.Lock()
+	v, ok := s.m.Pop(key)
+	s.mu.Unlock()
+	return v, ok
+}
+
+// Clear removes all key-value pairs from the map.
+// Each shard is cleared in turn, so pairs inserted into other shards concurrently may remain.
+func (m *Sharded) Clear() {
+	for i := range m.shards {
+		s := &m.shards[i]
+		s.mu.Lock()
+		s.m.Clear()
+		s.mu.Unlock()
+	}
+}
+
+func (m *Sharded) Len() int {
+	var n int
+	for i := range m.shards {
+		s := &m.shards[i]
+		s.mu.RLock()
+		n += s.m.Len()
+		s.mu.RUnlock()
+	}
+
+	return n
+}
+
+func (m *Sharded) Info() string {
+	var n, slots, min, max int
+	for i := range m.shards {
+		s := &m.shards[i]
+		s.mu.RLock()
+		sn := s.m.Len()
+		slots += len(s.m.slots)
+		s.mu.RUnlock()
+
+		n += sn
+		if i == 0 || sn < min {
+			min = sn
+		}
+		if sn > max {
+			max = sn
+		}
+	}
+
+	return fmt.Sprintf("len=%d cap=%d shards=%d (shard len min=%d max=%d)", n, slots, len(m.shards), min, max)
+}
+
+// Stats returns the combined statistics of the shards.
+// Each shard is measured in turn, so the result does not necessarily correspond to a consistent snapshot of the map if it is modified concurrently.
+func (m *Sharded) Stats() Stats {
+	res := Stats{Bytes: uintptr(len(m.shards)) * unsafe.Sizeof(shard{})}
+	var total int
+	for i := range m.shards {
+		s := &m.shards[i]
+		s.mu.RLock()
+		st := s.m.Stats()
+		s.mu.RUnlock()
+
+		res.Len += st.Len
+		res.Capacity += st.Capacity
+		res.Heads += st.Heads
+		res.Bytes += st.Bytes
+		total += int(math.Round(st.MeanProbe * float64(st.Len)))
+		if st.MaxProbe > res.MaxProbe {
+			res.MaxProbe = st.MaxProbe
+		}
+	}
+	res.derive(total)
+
+	return res
+}
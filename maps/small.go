@@ -0,0 +1,193 @@
+package maps
+
+import (
+	"fmt"
+	"unsafe"
+)
+
+// smallMapMax is the maximum number of pairs stored inline by a SmallMap.
+const smallMapMax = 8
+
+// SmallMap is a map implementation which adapts to the number of pairs it holds.
+// The zero value is a ready-to-use empty map.
+// Up to 8 pairs are stored in a linear array, which is searched by comparing keys directly, without hashing.
+// For so few pairs this is faster than a hash table, and uses barely more memory than the pairs themselves.
+// When the map grows beyond 8 pairs, it transparently switches to a ScatterChain, and then remains one.
+type SmallMap struct {
+	// pairs are the pairs in insertion order, while the map is small.
+	// The slice is grown on demand, up to a capacity of smallMapMax.
+	pairs []smallPair
+
+	// table holds the pairs once the map has outgrown the array.
+	table *ScatterChain
+}
+
+type smallPair struct {
+	key   string
+	value interface{}
+}
+
+// find finds the index of a key in the array.
+func (m *SmallMap) find(key string) (int, bool) {
+	for i := range m.pairs {
+		if m.pairs[i].key == key {
+			return i, true
+		}
+	}
+
+	return 0, false
+}
+
+func (m *SmallMap) Clear() {
+	if m == nil {
+		return
+	}
+
+	if m.table != nil {
+		m.table.Clear()
+		return
+	}
+
+	for i := range m.pairs {
+		m.pairs[i] = smallPair{}
+	}
+	m.pairs = m.pairs[:0]
+}
+
+func (m *SmallMap) Len() int {
+	switch {
+	case m == nil:
+		return 0
+	case m.table != nil:
+		return m.table.Len()
+	default:
+		return len(m.pairs)
+	}
+}
+
+func (m *SmallMap) Info() string {
+	if m.table != nil {
+		return m.table.Info()
+	}
+
+	return fmt.Sprintf("len=%d cap=%d (inline)", len(m.pairs), cap(m.pairs))
+}
+
+// Stats returns statistics describing the internal state of the map.
+// While the map is small, the probe length of a pair is its position in the array.
+func (m *SmallMap) Stats() Stats {
+	switch {
+	case m == nil:
+		return Stats{}
+	case m.table != nil:
+		return m.table.Stats()
+	}
+
+	s := Stats{
+		Len:      len(m.pairs),
+		Capacity: cap(m.pairs),
+		MaxProbe: len(m.pairs),
+		Bytes:    uintptr(cap(m.pairs)) * unsafe.Sizeof(smallPair{}),
+	}
+	s.derive(len(m.pairs) * (len(m.pairs) + 1) / 2)
+
+	return s
+}
+
+func (m *SmallMap) Each(fn func(key string, value interface{})) {
+	m.Range(func(key string, value interface{}) bool {
+		fn(key, value)
+		return true
+	})
+}
+
+func (m *SmallMap) Range(fn func(key string, value interface{}) bool) {
+	switch {
+	case m == nil:
+		return
+	case m.table != nil:
+		m.table.Range(fn)
+		return
+	}
+
+	// Deleting a pair shifts the pairs after it, and a Put may switch the map to a table.
+	// Take a snapshot of the keys, and look up each one to check that it is still present.
+	var keys [smallMapMax]string
+	n := len(m.pairs)
+	for i := range m.pairs {
+		keys[i] = m.pairs[i].key
+	}
+	for _, k := range keys[:n] {
+		v, ok := m.Get(k)
+		if ok && !fn(k, v) {
+			return
+		}
+	}
+}
+
+func (m *SmallMap) Get(key string) (interface{}, bool) {
+	switch {
+	case m == nil:
+		return nil, false
+	case m.table != nil:
+		return m.table.Get(key)
+	}
+
+	i, ok := m.find(key)
+	if !ok {
+		return nil, false
+	}
+
+	return m.pairs[i].value, true
+}
+
+func (m *SmallMap) Put(key string, value interface{}) {
+	if m.table != nil {
+		m.table.Put(key, value)
+		return
+	}
+
+	if i, ok := m.find(key); ok {
+		// Update the pair in-place.
+		m.pairs[i].value = value
+		return
+	}
+
+	if len(m.pairs) < smallMapMax {
+		m.pairs = append(m.pairs, smallPair{key, value})
+		return
+	}
+
+	// Switch to a table.
+	table := MakeScatterChain(2 * smallMapMax)
+	for _, p := range m.pairs {
+		table.Put(p.key, p.value)
+	}
+	table.Put(key, value)
+	m.table = &table
+	m.pairs = nil
+}
+
+func (m *SmallMap) Delete(key string) {
+	m.Pop(key)
+}
+
+func (m *SmallMap) Pop(key string) (interface{}, bool) {
+	switch {
+	case m == nil:
+		return nil, false
+	case m.table != nil:
+		return m.table.Pop(key)
+	}
+
+	i, ok := m.find(key)
+	if !ok {
+		return nil, false
+	}
+
+	value := m.pairs[i].value
+	copy(m.pairs[i:], m.pairs[i+1:])
+	m.pairs[len(m.pairs)-1] = smallPair{}
+	m.pairs = m.pairs[:len(m.pairs)-1]
+	return value, true
+}
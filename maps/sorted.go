@@ -0,0 +1,510 @@
+package maps
+
+import (
+	"fmt"
+	"sort"
+	"unsafe"
+)
+
+// btreeMaxItems is the maximum number of items in a node of a SortedMap.
+const btreeMaxItems = 31
+
+// btreeMinItems is the minimum number of items in a node of a SortedMap, other than the root.
+const btreeMinItems = btreeMaxItems / 2
+
+// SortedMap is a map implementation using a B-tree, which keeps its keys in sorted order.
+// The zero value is a ready-to-use empty map.
+// Lookups and modifications take O(log n) time rather than the expected constant time of the hash maps, but pairs can be visited in key order and ranges of keys can be queried efficiently.
+// Each and Range visit the pairs in ascending key order.
+type SortedMap struct {
+	// root is the root node of the tree, or nil if the map is empty.
+	// All leaves are at the same depth.
+	root *btreeNode
+
+	// n is the number of key-value pairs currently stored in the map.
+	n uint
+
+	// version is incremented whenever the structure of the tree changes.
+	// An iteration uses this to detect when it needs to find its position again.
+	version uint
+}
+
+// btreeNode is a node of a SortedMap.
+type btreeNode struct {
+	// items are the pairs in the node, sorted by key.
+	items []btreeItem
+
+	// children are the child nodes, or nil if this is a leaf.
+	// The keys in children[i] are between items[i-1] and items[i].
+	children []*btreeNode
+}
+
+type btreeItem struct {
+	key   string
+	value interface{}
+}
+
+// leaf checks if this node is a leaf.
+func (n *btreeNode) leaf() bool {
+	return n.children == nil
+}
+
+// search finds the index of the first item with a key not less than the specified key.
+// The second return is true if the item has exactly the specified key.
+func (n *btreeNode) search(key string) (int, bool) {
+	i := sort.Search(len(n.items), func(i int) bool { return n.items[i].key >= key })
+	return i, i < len(n.items) && n.items[i].key == key
+}
+
+func (m *SortedMap) Clear() {
+	if m == nil {
+		return
+	}
+
+	m.root = nil
+	m.n = 0
+	m.version++
+}
+
+func (m *SortedMap) Len() int {
+	if m == nil {
+		return 0
+	}
+
+	return int(m.n)
+}
+
+func (m *SortedMap) Info() string {
+	var height, nodes int
+	for n := m.root; n != nil; height++ {
+		if n.leaf() {
+			break
+		}
+		n = n.children[0]
+	}
+	var count func(n *btreeNode)
+	count = func(n *btreeNode) {
+		nodes++
+		for _, c := range n.children {
+			count(c)
+		}
+	}
+	if m.root != nil {
+		count(m.root)
+		height++
+	}
+
+	return fmt.Sprintf("len=%d height=%d nodes=%d (%0.2f items per node)", m.n, height, nodes, float64(m.n)/float64(nodes))
+}
+
+// Stats returns statistics describing the internal state of the map.
+// The capacity is the number of items which fit in the allocated nodes, and the probe length of a pair is the depth of its node.
+func (m *SortedMap) Stats() Stats {
+	if m == nil {
+		return Stats{}
+	}
+
+	s := Stats{Len: int(m.n)}
+	var total int
+	var walk func(n *btreeNode, depth int)
+	walk = func(n *btreeNode, depth int) {
+		s.Capacity += cap(n.items)
+		s.Bytes += unsafe.Sizeof(*n) + uintptr(cap(n.items))*unsafe.Sizeof(btreeItem{}) + uintptr(cap(n.children))*unsafe.Sizeof(n)
+		total += depth * len(n.items)
+		if depth > s.MaxProbe {
+			s.MaxProbe = depth
+		}
+		for _, c := range n.children {
+			walk(c, depth+1)
+		}
+	}
+	if m.root != nil {
+		walk(m.root, 1)
+	}
+	s.derive(total)
+
+	return s
+}
+
+func (m *SortedMap) Get(key string) (interface{}, bool) {
+	if m == nil {
+		return nil, false
+	}
+
+	for n := m.root; n != nil; {
+		i, found := n.search(key)
+		if found {
+			return n.items[i].value, true
+		}
+		if n.leaf() {
+			break
+		}
+
+		n = n.children[i]
+	}
+
+	return nil, false
+}
+
+// Min returns the pair with the smallest key.
+// If the map is empty, the last return is false.
+func (m *SortedMap) Min() (key string, value interface{}, ok bool) {
+	if m == nil || m.root == nil {
+		return "", nil, false
+	}
+
+	n := m.root
+	for !n.leaf() {
+		n = n.children[0]
+	}
+
+	return n.items[0].key, n.items[0].value, true
+}
+
+// Max returns the pair with the largest key.
+// If the map is empty, the last return is false.
+func (m *SortedMap) Max() (key string, value interface{}, ok bool) {
+	if m == nil || m.root == nil {
+		return "", nil, false
+	}
+
+	n := m.root
+	for !n.leaf() {
+		n = n.children[len(n.children)-1]
+	}
+
+	item := n.items[len(n.items)-1]
+	return item.key, item.value, true
+}
+
+func (m *SortedMap) Put(key string, value interface{}) {
+	if m.root == nil {
+		m.root = &btreeNode{}
+	}
+	if len(m.root.items) == btreeMaxItems {
+		// Split the root, growing the tree by a level.
+		m.root = &btreeNode{children: []*btreeNode{m.root}}
+		m.split(m.root, 0)
+	}
+
+	// Descend to the leaf where the key belongs, splitting full nodes on the way down so that there is always space to insert.
+	n := m.root
+	for {
+		i, found := n.search(key)
+		if found {
+			// Update the pair in-place.
+			n.items[i].value = value
+			return
+		}
+		if n.leaf() {
+			n.items = append(n.items, btreeItem{})
+			copy(n.items[i+1:], n.items[i:])
+			n.items[i] = btreeItem{key, value}
+			m.n++
+			m.version++
+			return
+		}
+
+		if len(n.children[i].items) == btreeMaxItems {
+			m.split(n, i)
+
+			// The middle item of the child was moved up to index i.
+			switch {
+			case key == n.items[i].key:
+				n.items[i].value = value
+				return
+			case key > n.items[i].key:
+				i++
+			}
+		}
+
+		n = n.children[i]
+	}
+}
+
+// split splits the full child i of a node in half, moving the middle item up into the node.
+func (m *SortedMap) split(n *btreeNode, i int) {
+	c := n.children[i]
+	mid := btreeMaxItems / 2
+	item := c.items[mid]
+	right := &btreeNode{items: make([]btreeItem, len(c.items)-mid-1, btreeMaxItems)}
+	copy(right.items, c.items[mid+1:])
+	for j := mid; j < len(c.items); j++ {
+		c.items[j] = btreeItem{}
+	}
+	c.items = c.items[:mid]
+	if !c.leaf() {
+		right.children = make([]*btreeNode, len(c.children)-mid-1, btreeMaxItems+1)
+		copy(right.children, c.children[mid+1:])
+		for j := mid + 1; j < len(c.children); j++ {
+			c.children[j] = nil
+		}
+		c.children = c.children[:mid+1]
+	}
+
+	n.items = append(n.items, btreeItem{})
+	copy(n.items[i+1:], n.items[i:])
+	n.items[i] = item
+	n.children = append(n.children, nil)
+	copy(n.children[i+2:], n.children[i+1:])
+	n.children[i+1] = right
+	m.version++
+}
+
+func (m *SortedMap) Delete(key string) {
+	m.Pop(key)
+}
+
+func (m *SortedMap) Pop(key string) (interface{}, bool) {
+	if m == nil || m.root == nil {
+		return nil, false
+	}
+
+	value, ok := m.root.remove(key)
+	if !ok {
+		return nil, false
+	}
+
+	m.n--
+	m.version++
+	switch {
+	case len(m.root.items) != 0:
+	case m.root.leaf():
+		m.root = nil
+	default:
+		// Shrink the tree by a level.
+		m.root = m.root.children[0]
+	}
+
+	return value, true
+}
+
+// remove removes a key from the subtree rooted at this node, returning the value it had.
+// Children are rebalanced on the way back up, but the node itself may be left with too few items.
+func (n *btreeNode) remove(key string) (interface{}, bool) {
+	i, found := n.search(key)
+	var value interface{}
+	switch {
+	case n.leaf():
+		if !found {
+			return nil, false
+		}
+
+		value = n.items[i].value
+		n.items = removeItem(n.items, i)
+		return value, true
+
+	case found:
+		// Replace the item with its predecessor, which is the largest item in the left subtree.
+		value = n.items[i].value
+		n.items[i] = n.children[i].removeMax()
+
+	default:
+		var ok bool
+		value, ok = n.children[i].remove(key)
+		if !ok {
+			return nil, false
+		}
+	}
+
+	n.rebalance(i)
+	return value, true
+}
+
+// removeMax removes the item with the largest key from the subtree rooted at this node.
+func (n *btreeNode) removeMax() btreeItem {
+	if n.leaf() {
+		return n.removeMaxItem()
+	}
+
+	last := len(n.children) - 1
+	item := n.children[last].removeMax()
+	n.rebalance(last)
+	return item
+}
+
+// rebalance fixes up child i of a node if it has too few items.
+// An item is moved through the node from a sibling with items to spare, or otherwise the child is merged with a sibling.
+func (n *btreeNode) rebalance(i int) {
+	c := n.children[i]
+	if len(c.items) >= btreeMinItems {
+		return
+	}
+
+	if i > 0 && len(n.children[i-1].items) > btreeMinItems {
+		// Rotate an item from the left sibling.
+		left := n.children[i-1]
+		c.items = append(c.items, btreeItem{})
+		copy(c.items[1:], c.items)
+		c.items[0] = n.items[i-1]
+		n.items[i-1] = left.removeMaxItem()
+		if !c.leaf() {
+			c.children = append(c.children, nil)
+			copy(c.children[1:], c.children)
+			c.children[0] = left.children[len(left.children)-1]
+			left.children[len(left.children)-1] = nil
+			left.children = left.children[:len(left.children)-1]
+		}
+		return
+	}
+
+	if i < len(n.children)-1 && len(n.children[i+1].items) > btreeMinItems {
+		// Rotate an item from the right sibling.
+		right := n.children[i+1]
+		c.items = append(c.items, n.items[i])
+		n.items[i] = right.items[0]
+		right.items = removeItem(right.items, 0)
+		if !c.leaf() {
+			c.children = append(c.children, right.children[0])
+			copy(right.children, right.children[1:])
+			right.children[len(right.children)-1] = nil
+			right.children = right.children[:len(right.children)-1]
+		}
+		return
+	}
+
+	// Merge the child with a sibling.
+	if i > 0 {
+		i--
+	}
+	left, right := n.children[i], n.children[i+1]
+	left.items = append(left.items, n.items[i])
+	left.items = append(left.items, right.items...)
+	left.children = append(left.children, right.children...)
+	n.items = removeItem(n.items, i)
+	copy(n.children[i+1:], n.children[i+2:])
+	n.children[len(n.children)-1] = nil
+	n.children = n.children[:len(n.children)-1]
+}
+
+// removeMaxItem removes the last item of a node, without descending into its children.
+func (n *btreeNode) removeMaxItem() btreeItem {
+	item := n.items[len(n.items)-1]
+	n.items[len(n.items)-1] = btreeItem{}
+	n.items = n.items[:len(n.items)-1]
+	return item
+}
+
+// removeItem removes the item at index i.
+func removeItem(items []btreeItem, i int) []btreeItem {
+	copy(items[i:], items[i+1:])
+	items[len(items)-1] = btreeItem{}
+	return items[:len(items)-1]
+}
+
+// Each invokes a function with every key-value pair, in ascending key order.
+// It inherits the same semantics as a map range loop.
+func (m *SortedMap) Each(fn func(key string, value interface{})) {
+	m.Range(func(key string, value interface{}) bool {
+		fn(key, value)
+		return true
+	})
+}
+
+// Range invokes a function with every key-value pair in ascending key order, stopping early if the function returns false.
+// It inherits the same semantics as a map range loop.
+func (m *SortedMap) Range(fn func(key string, value interface{}) bool) {
+	m.iterate("", "", false, fn)
+}
+
+// Ascend invokes a function with every key-value pair with a key not less than lo, in ascending key order.
+// The iteration stops early if the function returns false.
+// It has the same semantics as Range.
+func (m *SortedMap) Ascend(lo string, fn func(key string, value interface{}) bool) {
+	m.iterate(lo, "", false, fn)
+}
+
+// Between invokes a function with every key-value pair with a key in the range [lo, hi), in ascending key order.
+// The iteration stops early if the function returns false.
+// It has the same semantics as Range.
+func (m *SortedMap) Between(lo, hi string, fn func(key string, value interface{}) bool) {
+	m.iterate(lo, hi, true, fn)
+}
+
+// iterate visits the pairs starting at lo, and stopping before hi if bounded is set.
+func (m *SortedMap) iterate(lo, hi string, bounded bool, fn func(key string, value interface{}) bool) {
+	if m == nil {
+		return
+	}
+
+	var it btreeIter
+	it.seek(m.root, lo, false)
+	version := m.version
+	for {
+		item, ok := it.next()
+		if !ok || (bounded && item.key >= hi) {
+			return
+		}
+
+		if !fn(item.key, item.value) {
+			return
+		}
+
+		if m.version != version {
+			// The tree was restructured, so find the position of the next key again.
+			// Pairs are visited in key order, so this does not visit any pair twice.
+			version = m.version
+			it.seek(m.root, item.key, true)
+		}
+	}
+}
+
+// btreeIter is an in-order traversal of a B-tree.
+type btreeIter struct {
+	// stack contains the path from the root to the current node.
+	stack []btreeFrame
+}
+
+type btreeFrame struct {
+	n *btreeNode
+
+	// i is the index of the next item in the node to visit.
+	// In an internal node, children[i] is visited before this.
+	i int
+}
+
+// seek positions the iterator before the first key not less than the specified key, or greater than the key if strict is set.
+func (it *btreeIter) seek(root *btreeNode, key string, strict bool) {
+	it.stack = it.stack[:0]
+	for n := root; n != nil; {
+		i, found := n.search(key)
+		if found && strict {
+			i++
+		}
+		it.stack = append(it.stack, btreeFrame{n, i})
+		if n.leaf() || (found && !strict) {
+			// If the key was found, the subtree before it only contains smaller keys.
+			break
+		}
+
+		n = n.children[i]
+	}
+}
+
+// next returns the next item.
+func (it *btreeIter) next() (btreeItem, bool) {
+	for len(it.stack) > 0 {
+		f := &it.stack[len(it.stack)-1]
+		if f.i >= len(f.n.items) {
+			// The node is finished.
+			it.stack = it.stack[:len(it.stack)-1]
+			continue
+		}
+
+		item := f.n.items[f.i]
+		f.i++
+		if !f.n.leaf() {
+			// Descend to the leftmost leaf of the following subtree.
+			for c := f.n.children[f.i]; ; c = c.children[0] {
+				it.stack = append(it.stack, btreeFrame{c, 0})
+				if c.leaf() {
+					break
+				}
+			}
+		}
+
+		return item, true
+	}
+
+	return btreeItem{}, false
+}
@@ -0,0 +1,8 @@
+//go:build maps_fnv
+// +build maps_fnv
+
+package maps
+
+func strhash(str string, seed uint64) uint64 {
+	return fnvhash(str, seed)
+}
@@ -0,0 +1,14 @@
+//go:build gc && !maps_wyhash && !maps_fnv
+// +build gc,!maps_wyhash,!maps_fnv
+
+package maps
+
+import _ "unsafe" // for go:linkname
+
+//go:linkname runtime_stringHash runtime.stringHash
+//go:noescape
+func runtime_stringHash(str string, seed uintptr) uintptr
+
+func strhash(str string, seed uint64) uint64 {
+	return uint64(runtime_stringHash(str, uintptr(seed)))
+}
@@ -0,0 +1,9 @@
+//go:build (!gc || maps_wyhash) && !maps_fnv
+// +build !gc maps_wyhash
+// +build !maps_fnv
+
+package maps
+
+func strhash(str string, seed uint64) uint64 {
+	return wyhash(str, seed)
+}
@@ -0,0 +1,10 @@
+//go:build gc
+// +build gc
+
+package maps
+
+// swissMatchSSE2 finds the bytes of ctrl which are equal to the corresponding bytes of pattern, using SSE2.
+// The result has the high bit of each matching byte set.
+// Unlike swissMatchSWAR, there are no false positives.
+// It is implemented in assembly, so calls to it can not be inlined.
+func swissMatchSSE2(ctrl, pattern uint64) uint64
@@ -0,0 +1,15 @@
+//go:build gc
+// +build gc
+
+#include "textflag.h"
+
+// func swissMatchSSE2(ctrl, pattern uint64) uint64
+TEXT ·swissMatchSSE2(SB), NOSPLIT, $0-24
+	MOVQ    ctrl+0(FP), X0
+	MOVQ    pattern+8(FP), X1
+	PCMPEQB X1, X0
+	MOVQ    X0, AX
+	MOVQ    $0x8080808080808080, CX
+	ANDQ    CX, AX
+	MOVQ    AX, ret+16(FP)
+	RET
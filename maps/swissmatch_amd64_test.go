@@ -0,0 +1,66 @@
+//go:build gc
+// +build gc
+
+package maps
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestSwissMatchSSE2(t *testing.T) {
+	t.Parallel()
+
+	rand := rand.New(rand.NewSource(5))
+	for i := 0; i < 100000; i++ {
+		// Draw the control bytes from a small set of values, so that matches are common.
+		var ctrl uint64
+		for j := 0; j < swissGroupSize; j++ {
+			ctrl |= uint64([]uint8{0x00, 0x01, 0x7F, swissCtrlEmpty, swissCtrlDeleted}[rand.Intn(5)]) << (8 * j)
+		}
+		h2 := uint8(rand.Intn(3)) * 0x3F
+		pattern := swissLSB * uint64(h2)
+
+		var expect uint64
+		for j := 0; j < swissGroupSize; j++ {
+			if uint8(ctrl>>(8*j)) == h2 {
+				expect |= 0x80 << (8 * j)
+			}
+		}
+		if got := swissMatchSSE2(ctrl, pattern); got != expect {
+			t.Fatalf("expected SSE2 match of %02x in %016x to be %016x but got %016x", h2, ctrl, expect, got)
+		}
+		if got := swissMatchSWAR(ctrl, pattern); got&expect != expect {
+			t.Fatalf("SWAR match of %02x in %016x missed matches (got %016x, expected at least %016x)", h2, ctrl, got, expect)
+		}
+	}
+}
+
+// swissMatchSink keeps the results of BenchmarkSwissMatch, so that the comparisons are not optimized out.
+var swissMatchSink uint64
+
+// BenchmarkSwissMatch compares the portable SWAR comparison of control bytes to the SSE2 comparison.
+// The functions are called directly, so that the SWAR comparison is inlined as it is in a lookup.
+func BenchmarkSwissMatch(b *testing.B) {
+	rand := rand.New(rand.NewSource(6))
+	ctrls := make([]uint64, 1024)
+	for i := range ctrls {
+		ctrls[i] = rand.Uint64() &^ swissMSB
+	}
+	pattern := swissLSB * uint64(0x2A)
+
+	b.Run("SWAR", func(b *testing.B) {
+		var sum uint64
+		for i := 0; i < b.N; i++ {
+			sum += swissMatchSWAR(ctrls[i%len(ctrls)], pattern)
+		}
+		swissMatchSink = sum
+	})
+	b.Run("SSE2", func(b *testing.B) {
+		var sum uint64
+		for i := 0; i < b.N; i++ {
+			sum += swissMatchSSE2(ctrls[i%len(ctrls)], pattern)
+		}
+		swissMatchSink = sum
+	})
+}
@@ -0,0 +1,9 @@
+//go:build amd64 && gc && maps_sse2
+// +build amd64,gc,maps_sse2
+
+package maps
+
+// match finds the slots which have a control byte equal to h2.
+func (c swissCtrl) match(h2 uint8) swissBitset {
+	return swissBitset(swissMatchSSE2(uint64(c), swissLSB*uint64(h2)))
+}
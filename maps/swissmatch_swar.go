@@ -0,0 +1,10 @@
+//go:build !amd64 || !gc || !maps_sse2
+// +build !amd64 !gc !maps_sse2
+
+package maps
+
+// match finds the slots which may have a control byte equal to h2.
+// This may include false positives when a slot directly follows a match, so the keys must still be compared.
+func (c swissCtrl) match(h2 uint8) swissBitset {
+	return swissBitset(swissMatchSWAR(uint64(c), swissLSB*uint64(h2)))
+}
@@ -0,0 +1,469 @@
+package maps
+
+import (
+	"fmt"
+	"math/bits"
+	"unsafe"
+)
+
+// swissGroupSize is the number of slots in a group of a SwissTable.
+const swissGroupSize = 8
+
+// swissMaxLoad is the maximum number of used slots (including deleted slots) per group before the table is rehashed.
+// At least one slot in the table is always left empty, so that probing for a missing key terminates.
+const swissMaxLoad = 7
+
+// Control bytes of a SwissTable slot.
+// A full slot stores the lower 7 bits of the hash of its key in its control byte (with the high bit clear).
+const (
+	// swissCtrlEmpty indicates that a slot has never been used since the last rehash.
+	swissCtrlEmpty = 0x80
+
+	// swissCtrlDeleted indicates that a slot has been used, but the pair was removed.
+	// Probing must continue past deleted slots.
+	swissCtrlDeleted = 0xFE
+)
+
+const (
+	// swissLSB has the lowest bit of every byte set.
+	swissLSB = 0x0101010101010101
+
+	// swissMSB has the highest bit of every byte set.
+	swissMSB = 0x8080808080808080
+)
+
+// MakeSwissTable makes a SwissTable with capacity for the specified number of elements.
+func MakeSwissTable(size uint) (res SwissTable) {
+	return MakeSeededSwissTable(size, newSeed())
+}
+
+// MakeSeededSwissTable makes a SwissTable with capacity for the specified number of elements, which hashes keys with a fixed seed.
+// See MakeSeededScatterChain.
+// The seed must not be 0.
+func MakeSeededSwissTable(size uint, seed uint64) (res SwissTable) {
+	if seed == 0 {
+		panic("zero seed")
+	}
+	res.seed = seed
+	if size != 0 {
+		res.groups = newSwissGroups(swissGroupCount(size))
+	}
+
+	return
+}
+
+// swissGroupCount computes the number of groups required to hold the specified number of elements.
+func swissGroupCount(size uint) uint {
+	if size == 0 {
+		return 0
+	}
+
+	groups := (size + swissMaxLoad - 1) / swissMaxLoad
+	return uint(1) << bits.Len(groups-1)
+}
+
+// SwissTable is a map implementation using an open-addressed table in the style of Abseil's "Swiss tables".
+// The zero value is a ready-to-use empty map.
+// Slots are divided into groups of 8, and each slot has a control byte containing 7 bits of the hash of its key.
+// A lookup probes the table a group at a time, comparing the control bytes of all slots in the group at once and only checking the keys of slots with matching hash bits.
+// By default, the comparison operates on the control bytes as a single 64-bit word (SIMD within a register), which works on every platform.
+// With the maps_sse2 build tag, amd64 builds with the gc toolchain compare the control bytes with SSE2 instead, which avoids false positives.
+// The SSE2 comparison is implemented in assembly, which can not be inlined, and this makes lookups about twice as slow, so it is not the default.
+// BenchmarkSwissMatch compares the two comparisons on their own.
+type SwissTable struct {
+	// groups are where the actual data is stored.
+	// The number of groups is always a power of two.
+	// The upper bits of the hash of a key select the first group to probe, and later groups are probed in a triangular sequence, which visits every group.
+	groups []swissGroup
+
+	// n is the number of key-value pairs currently stored in the map.
+	n uint
+
+	// deleted is the number of slots marked as deleted.
+	deleted uint
+
+	// seed is the seed used to hash keys.
+	// This is randomly generated when the first key is hashed, unless it was fixed when the map was made.
+	seed uint64
+}
+
+// hash computes the hash of a key.
+func (m *SwissTable) hash(key string) uint64 {
+	if m.seed == 0 {
+		m.seed = newSeed()
+	}
+
+	return strhash(key, m.seed)
+}
+
+type swissGroup struct {
+	// ctrl contains the control bytes of the slots, with the control byte of slot i in bits 8*i through 8*i+7.
+	ctrl swissCtrl
+
+	// keys are the keys of the pairs in full slots.
+	keys [swissGroupSize]string
+
+	// values are the values of the pairs in full slots.
+	values [swissGroupSize]interface{}
+}
+
+// newSwissGroups allocates a set of empty groups.
+func newSwissGroups(n uint) []swissGroup {
+	groups := make([]swissGroup, n)
+	for i := range groups {
+		groups[i].ctrl = swissLSB * swissCtrlEmpty
+	}
+
+	return groups
+}
+
+// swissCtrl is a word of control bytes for a group.
+type swissCtrl uint64
+
+// swissBitset is a set of slots in a group, with the high bit of byte i set if slot i is in the set.
+type swissBitset uint64
+
+// first returns the index of the first slot in the set.
+func (b swissBitset) first() uint {
+	return uint(bits.TrailingZeros64(uint64(b))) / 8
+}
+
+// removeFirst removes the first slot from the set.
+func (b swissBitset) removeFirst() swissBitset {
+	return b & (b - 1)
+}
+
+// swissMatchSWAR finds the bytes of ctrl which may be equal to the corresponding bytes of pattern, treating the word as a vector of bytes.
+// The result has the high bit of each matching byte set.
+// A byte directly following a match may be a false positive, because of the borrow out of the matching byte.
+func swissMatchSWAR(ctrl, pattern uint64) uint64 {
+	x := ctrl ^ pattern
+	return (x - swissLSB) &^ x & swissMSB
+}
+
+// matchEmpty finds the empty slots.
+func (c swissCtrl) matchEmpty() swissBitset {
+	// Empty is the only control byte with the high bit set and bit 1 clear.
+	return swissBitset(uint64(c) &^ (uint64(c) << 6) & swissMSB)
+}
+
+// matchEmptyOrDeleted finds the slots which are not full.
+func (c swissCtrl) matchEmptyOrDeleted() swissBitset {
+	return swissBitset(uint64(c) & swissMSB)
+}
+
+// set sets the control byte of a slot.
+func (c *swissCtrl) set(i uint, v uint8) {
+	*c = (*c &^ (0xFF << (8 * i))) | swissCtrl(v)<<(8*i)
+}
+
+// get gets the control byte of a slot.
+func (c swissCtrl) get(i uint) uint8 {
+	return uint8(c >> (8 * i))
+}
+
+// splitHash splits a hash into the group selector (h1) and the control byte (h2).
+func splitHash(hash uint64) (uint64, uint8) {
+	return hash >> 7, uint8(hash & 0x7F)
+}
+
+func (m *SwissTable) Clear() {
+	if m == nil {
+		return
+	}
+
+	for i := range m.groups {
+		m.groups[i] = swissGroup{ctrl: swissLSB * swissCtrlEmpty}
+	}
+	m.n = 0
+	m.deleted = 0
+}
+
+func (m *SwissTable) Len() int {
+	if m == nil {
+		return 0
+	}
+
+	return int(m.n)
+}
+
+func (m *SwissTable) Info() string {
+	s := m.Stats()
+	return fmt.Sprintf("len=%d cap=%d groups=%d deleted=%d max probe=%d", m.n, len(m.groups)*swissGroupSize, len(m.groups), m.deleted, s.MaxProbe)
+}
+
+// Stats returns statistics describing the internal state of the map.
+// The probe length of a pair is the number of groups examined to find it.
+func (m *SwissTable) Stats() Stats {
+	if m == nil {
+		return Stats{}
+	}
+
+	s := Stats{
+		Len:      int(m.n),
+		Capacity: len(m.groups) * swissGroupSize,
+		Bytes:    uintptr(len(m.groups)) * unsafe.Sizeof(swissGroup{}),
+	}
+	var total int
+	m.Each(func(key string, value interface{}) {
+		h1, _ := splitHash(m.hash(key))
+		mask := uint64(len(m.groups) - 1)
+		g := h1 & mask
+		probe := 1
+		for i := uint64(1); ; i++ {
+			if m.groups[g].find(key) != swissGroupSize {
+				break
+			}
+			g = (g + i) & mask
+			probe++
+		}
+		total += probe
+		if probe > s.MaxProbe {
+			s.MaxProbe = probe
+		}
+	})
+	s.derive(total)
+
+	return s
+}
+
+// find returns the index of a key in the group, or swissGroupSize if it is not present.
+func (g *swissGroup) find(key string) uint {
+	for i := uint(0); i < swissGroupSize; i++ {
+		if g.ctrl.get(i)&swissCtrlEmpty == 0 && g.keys[i] == key {
+			return i
+		}
+	}
+
+	return swissGroupSize
+}
+
+// lookup finds the group and slot of a key.
+func (m *SwissTable) lookup(key string) (*swissGroup, uint, bool) {
+	if len(m.groups) == 0 {
+		return nil, 0, false
+	}
+
+	h1, h2 := splitHash(m.hash(key))
+	mask := uint64(len(m.groups) - 1)
+	g := h1 & mask
+	for i := uint64(1); ; i++ {
+		group := &m.groups[g]
+		for match := group.ctrl.match(h2); match != 0; match = match.removeFirst() {
+			slot := match.first()
+			if group.keys[slot] == key {
+				return group, slot, true
+			}
+		}
+		if group.ctrl.matchEmpty() != 0 {
+			// The key would have been inserted into this empty slot.
+			return nil, 0, false
+		}
+
+		g = (g + i) & mask
+	}
+}
+
+func (m *SwissTable) Each(fn func(key string, value interface{})) {
+	m.Range(func(key string, value interface{}) bool {
+		fn(key, value)
+		return true
+	})
+}
+
+func (m *SwissTable) Range(fn func(key string, value interface{}) bool) {
+	if m == nil {
+		return
+	}
+
+	// Pairs never move within a table, so the table can simply be scanned in order, checking the control bytes as we go.
+	// However, a Put during iteration may rehash the table into a new set of groups.
+	// If that happens, continue scanning the old groups (which are left untouched by the rehash) and look up each key to check that the pair is still present.
+	groups := m.groups
+	for gi := range groups {
+		for i := uint(0); i < swissGroupSize; i++ {
+			g := &groups[gi]
+			if g.ctrl.get(i)&swissCtrlEmpty != 0 {
+				continue
+			}
+
+			key, value := g.keys[i], g.values[i]
+			if len(m.groups) != len(groups) || &m.groups[0] != &groups[0] {
+				// The table was rehashed.
+				var ok bool
+				value, ok = m.Get(key)
+				if !ok {
+					continue
+				}
+			}
+
+			if !fn(key, value) {
+				return
+			}
+		}
+	}
+}
+
+func (m *SwissTable) Get(key string) (interface{}, bool) {
+	if m == nil {
+		return nil, false
+	}
+
+	group, slot, ok := m.lookup(key)
+	if !ok {
+		return nil, false
+	}
+
+	return group.values[slot], true
+}
+
+func (m *SwissTable) Put(key string, value interface{}) {
+	if len(m.groups) == 0 {
+		m.groups = newSwissGroups(1)
+	}
+
+	hash := m.hash(key)
+	h1, h2 := splitHash(hash)
+	mask := uint64(len(m.groups) - 1)
+	g := h1 & mask
+
+	// Search for the key, remembering the first free slot in the probe sequence.
+	var free *swissGroup
+	var freeSlot uint
+	for i := uint64(1); ; i++ {
+		group := &m.groups[g]
+		for match := group.ctrl.match(h2); match != 0; match = match.removeFirst() {
+			slot := match.first()
+			if group.keys[slot] == key {
+				// Update the pair in-place.
+				group.values[slot] = value
+				return
+			}
+		}
+		if free == nil {
+			if avail := group.ctrl.matchEmptyOrDeleted(); avail != 0 {
+				free, freeSlot = group, avail.first()
+			}
+		}
+		if group.ctrl.matchEmpty() != 0 {
+			// The key is not present.
+			break
+		}
+
+		g = (g + i) & mask
+	}
+
+	if free.ctrl.get(freeSlot) == swissCtrlDeleted {
+		// Reuse the deleted slot.
+		m.deleted--
+	} else if m.n+m.deleted+1 > uint(len(m.groups))*swissMaxLoad {
+		// Using up another empty slot would exceed the load limit.
+		m.rehash()
+		m.doInsert(hash, key, value)
+		return
+	}
+
+	free.ctrl.set(freeSlot, h2)
+	free.keys[freeSlot], free.values[freeSlot] = key, value
+	m.n++
+}
+
+// Reserve grows the table such that the specified number of additional pairs can be inserted without rehashing.
+// This avoids repeatedly rehashing the table during a bulk insert into a map which is already populated.
+// The table is never shrunk.
+func (m *SwissTable) Reserve(extra uint) {
+	if extra == 0 {
+		return
+	}
+
+	if m.n+m.deleted+extra <= uint(len(m.groups))*swissMaxLoad {
+		// There is already enough space.
+		return
+	}
+
+	groups := swissGroupCount(m.n + extra)
+	if groups < uint(len(m.groups)) {
+		// Deleted slots are using up the space, so rebuild the table at the same size.
+		groups = uint(len(m.groups))
+	}
+
+	m.resize(groups)
+}
+
+// rehash rebuilds the table, discarding deleted slots.
+// The table is doubled in size if it is more than half full of present pairs.
+func (m *SwissTable) rehash() {
+	size := uint(len(m.groups))
+	if m.n+1 > size*swissMaxLoad/2 {
+		size *= 2
+	}
+
+	m.resize(size)
+}
+
+// resize rebuilds the table with the specified number of groups, discarding deleted slots.
+// The new table is always in a new set of groups, as Each depends on the old groups remaining intact.
+func (m *SwissTable) resize(size uint) {
+	old := m.groups
+	m.groups = newSwissGroups(size)
+	m.deleted = 0
+	m.n = 0
+	for gi := range old {
+		g := &old[gi]
+		for i := uint(0); i < swissGroupSize; i++ {
+			if g.ctrl.get(i)&swissCtrlEmpty != 0 {
+				continue
+			}
+
+			m.doInsert(m.hash(g.keys[i]), g.keys[i], g.values[i])
+		}
+	}
+}
+
+// doInsert inserts a pair which is known not to be present into the first free slot in the probe sequence.
+// This must only be used when there is space in the table and there are no deleted slots.
+func (m *SwissTable) doInsert(hash uint64, key string, value interface{}) {
+	h1, h2 := splitHash(hash)
+	mask := uint64(len(m.groups) - 1)
+	g := h1 & mask
+	for i := uint64(1); ; i++ {
+		group := &m.groups[g]
+		if avail := group.ctrl.matchEmpty(); avail != 0 {
+			slot := avail.first()
+			group.ctrl.set(slot, h2)
+			group.keys[slot], group.values[slot] = key, value
+			m.n++
+			return
+		}
+
+		g = (g + i) & mask
+	}
+}
+
+func (m *SwissTable) Delete(key string) {
+	m.Pop(key)
+}
+
+func (m *SwissTable) Pop(key string) (interface{}, bool) {
+	if m == nil {
+		return nil, false
+	}
+
+	group, slot, ok := m.lookup(key)
+	if !ok {
+		return nil, false
+	}
+	value := group.values[slot]
+
+	// If the group has an empty slot, then no probe sequence ever continued past this group, so the slot can be marked empty.
+	// Otherwise, it must be marked as deleted so that lookups continue probing.
+	if group.ctrl.matchEmpty() != 0 {
+		group.ctrl.set(slot, swissCtrlEmpty)
+	} else {
+		group.ctrl.set(slot, swissCtrlDeleted)
+		m.deleted++
+	}
+	group.keys[slot], group.values[slot] = "", nil
+	m.n--
+	return value, true
+}
@@ -0,0 +1,75 @@
+package maps
+
+import (
+	"fmt"
+	"sync"
+)
+
+// SyncMap adapts a sync.Map to the Map interface, so that it can be compared against the other implementations.
+// The zero value is a ready-to-use empty map, and it is safe for concurrent use by multiple goroutines.
+// The sync.Map does not track its length, so Len iterates over every pair.
+type SyncMap struct {
+	m sync.Map
+}
+
+func (m *SyncMap) Each(fn func(key string, value interface{})) {
+	m.Range(func(key string, value interface{}) bool {
+		fn(key, value)
+		return true
+	})
+}
+
+// Range invokes a function with every key-value pair, stopping early if the function returns false.
+// It inherits the semantics of sync.Map.Range, which does not necessarily correspond to a consistent snapshot of the map.
+func (m *SyncMap) Range(fn func(key string, value interface{}) bool) {
+	m.m.Range(func(key, value interface{}) bool {
+		return fn(key.(string), value)
+	})
+}
+
+func (m *SyncMap) Get(key string) (interface{}, bool) {
+	return m.m.Load(key)
+}
+
+func (m *SyncMap) Put(key string, value interface{}) {
+	m.m.Store(key, value)
+}
+
+func (m *SyncMap) Delete(key string) {
+	m.m.Delete(key)
+}
+
+// Pop removes the key from the map, and returns the value it had.
+// If it is not present, the second return is false.
+// This is performed atomically, so if multiple goroutines pop the same key, only one of them receives the value.
+func (m *SyncMap) Pop(key string) (interface{}, bool) {
+	return m.m.LoadAndDelete(key)
+}
+
+// Clear removes all key-value pairs from the map.
+// Pairs inserted concurrently may remain.
+func (m *SyncMap) Clear() {
+	m.m.Range(func(key, value interface{}) bool {
+		m.m.Delete(key)
+		return true
+	})
+}
+
+func (m *SyncMap) Len() int {
+	var n int
+	m.m.Range(func(key, value interface{}) bool {
+		n++
+		return true
+	})
+
+	return n
+}
+
+func (m *SyncMap) Info() string {
+	return fmt.Sprintf("len=%d", m.Len())
+}
+
+// Stats only reports the length, as the internals of the sync.Map are not accessible.
+func (m *SyncMap) Stats() Stats {
+	return Stats{Len: m.Len()}
+}
@@ -0,0 +1,513 @@
+package maps
+
+import (
+	"fmt"
+	"unsafe"
+)
+
+// MakeUint64ScatterChain makes a Uint64ScatterChain with capacity for the specified number of elements.
+func MakeUint64ScatterChain(size uint) (res Uint64ScatterChain) {
+	res.seed = newSeed()
+	if size != 0 {
+		logSize := scatterChainLogSize(size)
+		res.slots = make([]uint64ScatterChainSlot, 1<<logSize)
+		res.shift = 64 - uint(logSize)
+	}
+
+	return
+}
+
+// Uint64ScatterChain is a variant of ScatterChain with integer keys.
+// The zero value is a ready-to-use empty map.
+// Signed integer keys may be converted to uint64.
+// Storing the keys directly instead of formatting them as strings saves memory, and integers can be hashed much faster than strings.
+// The keys are hashed with a bijective mixing function, so there are never full collisions.
+type Uint64ScatterChain struct {
+	// slots are where the actual data is stored.
+	// See ScatterChain.
+	slots []uint64ScatterChainSlot
+
+	// n is the number of key-value pairs currently stored in the map.
+	n uint
+
+	// shift is the downward shift of a hash required to produce a slot index.
+	// This is 64-bits.Len64(len(slots)-1).
+	shift uint
+
+	// seed is the seed used to hash keys.
+	// This is randomly generated when the first key is hashed.
+	seed uint64
+}
+
+type uint64ScatterChainSlot struct {
+	// key is the key of the pair if present.
+	key uint64
+
+	// value is the currently assigned value corresponding to the key.
+	value interface{}
+
+	// tag contains all other metadata for the slot.
+	// If the slot is empty, this will be scatterChainEmpty.
+	tag scatterChainTag
+}
+
+// hash computes the hash of a key.
+func (m *Uint64ScatterChain) hash(key uint64) uint64 {
+	if m.seed == 0 {
+		m.seed = newSeed()
+	}
+
+	return inthash(key, m.seed)
+}
+
+// inthash hashes an integer.
+// This is the finalizer of the SplitMix64 generator, which is a bijection, applied to the key mixed with the seed.
+func inthash(x uint64, seed uint64) uint64 {
+	x ^= seed
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	return x ^ (x >> 31)
+}
+
+// Info spits out miscellaneous statistics for debugging purposes.
+func (m *Uint64ScatterChain) Info() string {
+	var heads uint
+	for i := range m.slots {
+		if m.slots[i].tag.isHead() {
+			heads++
+		}
+	}
+
+	return fmt.Sprintf("len=%d cap=%d heads=%d (%0.2f%% collision rate)", m.n, len(m.slots), heads, 100*(float64(m.n-heads)/float64(m.n)))
+}
+
+// Stats returns statistics describing the internal state of the map.
+// The probe length of a pair is its position in its collision chain.
+func (m *Uint64ScatterChain) Stats() Stats {
+	if m == nil {
+		return Stats{}
+	}
+
+	s := Stats{
+		Len:      int(m.n),
+		Capacity: len(m.slots),
+		Bytes:    uintptr(len(m.slots)) * unsafe.Sizeof(uint64ScatterChainSlot{}),
+	}
+	var total int
+	for i := range m.slots {
+		if !m.slots[i].tag.isHead() {
+			continue
+		}
+
+		s.Heads++
+		probe := 1
+		for idx := uint(i); ; probe++ {
+			total += probe
+			next, ok := m.slots[idx].tag.next()
+			if !ok {
+				break
+			}
+			idx = next
+		}
+		if probe > s.MaxProbe {
+			s.MaxProbe = probe
+		}
+	}
+	s.derive(total)
+
+	return s
+}
+
+// Clear removes all key-value pairs from the map, retaining the allocated capacity.
+func (m *Uint64ScatterChain) Clear() {
+	if m == nil {
+		return
+	}
+
+	for i := range m.slots {
+		m.slots[i] = uint64ScatterChainSlot{}
+	}
+	m.n = 0
+}
+
+// Len returns the number of key-value pairs in the map.
+func (m *Uint64ScatterChain) Len() int {
+	if m == nil {
+		return 0
+	}
+
+	return int(m.n)
+}
+
+// Each invokes a function with every key-value pair.
+// It inherits the same semantics as a map range loop.
+func (m *Uint64ScatterChain) Each(fn func(key uint64, value interface{})) {
+	m.Range(func(key uint64, value interface{}) bool {
+		fn(key, value)
+		return true
+	})
+}
+
+// Range invokes a function with every key-value pair, stopping early if the function returns false.
+// It inherits the same semantics as a map range loop.
+func (m *Uint64ScatterChain) Range(fn func(key uint64, value interface{}) bool) {
+	if m == nil {
+		return
+	}
+
+	// A naive approach for iterating over a chained scatter table would be to simply loop forwards by index.
+	// Normally this works, but the Go spec defines strict behavior requirements when modifying a map during iteration.
+	// When inserting a new key into a chained scatter table with Brent's variation, existing key-value pairs may be moved (likely causing them to be lost).
+	// When inserting or deleting pairs, the entire table may also resize.
+
+	// This function implements a traversal of the map by iterating in hash order.
+	// The hash is a bijection, so distinct keys never have the same hash.
+	// This guarantees that all elements initially in the map are hit unless they are deleted.
+	// Pairs inserted during iteration may not be hit, but this is allowed by the Go spec.
+
+	// Find the first element.
+	var lastKey uint64
+	var lastHash uint64
+	{
+		i := 0
+		for {
+			if i >= len(m.slots) {
+				// The map is empty.
+				return
+			}
+
+			if m.slots[i].tag.isHead() {
+				// This is the first list head, and thus the first value.
+				// We may pass filled slots that are not heads - we will hit them later.
+				// A simpler implementation would just loop by index, but that doesn't work here because Go allows the map to be modified during iteration.
+				// For a normal scatter chain that would work anyway, Brent's variation requires data to be moved when inserting a new key.
+				lastKey = m.slots[i].key
+				lastHash = m.hash(lastKey)
+				if !fn(m.slots[i].key, m.slots[i].value) {
+					return
+				}
+				break
+			}
+
+			i++
+		}
+	}
+
+	// Start at the slot corresponding to the first element's hash.
+	i := uint(lastHash >> m.shift)
+	for !m.slots[i].tag.isHead() {
+		// This slot is not a head, so move to the next slot.
+		i++
+		if i >= uint(len(m.slots)) {
+			return
+		}
+	}
+
+	for {
+		for {
+			keyHash := m.hash(m.slots[i].key)
+			if keyHash > lastHash {
+				// This key has not been processed yet.
+				lastKey = m.slots[i].key
+				lastHash = keyHash
+				if !fn(m.slots[i].key, m.slots[i].value) {
+					return
+				}
+				if i >= uint(len(m.slots)) || m.slots[i].tag == scatterChainTagEmpty || m.slots[i].key != lastKey {
+					// The table was modified, so rescan the chain.
+					i = uint(lastHash >> m.shift)
+					break
+				}
+			}
+
+			// Move to the next key in the chain.
+			next, ok := m.slots[i].tag.next()
+			if !ok {
+				// There are no more keys in this chain.
+				// Move to the next chain.
+				i = uint(lastHash>>m.shift) + 1
+				break
+			}
+
+			i = next
+		}
+
+		for i < uint(len(m.slots)) && !m.slots[i].tag.isHead() {
+			// This slot is not a head, so move to the next slot.
+			i++
+		}
+		if i >= uint(len(m.slots)) {
+			return
+		}
+	}
+}
+
+// Get checks if the key is present.
+// If it is not present, the second return is false.
+func (m *Uint64ScatterChain) Get(key uint64) (interface{}, bool) {
+	if m == nil || len(m.slots) == 0 {
+		return nil, false
+	}
+
+	idx, ok := m.find(m.hash(key), key)
+	if !ok {
+		return nil, false
+	}
+
+	return m.slots[idx].value, true
+}
+
+// find finds the index of the slot containing a key.
+// The map must not be empty.
+func (m *Uint64ScatterChain) find(hash uint64, key uint64) (uint, bool) {
+	idx := uint(hash >> uint64(m.shift))
+	if !m.slots[idx].tag.isHead() {
+		return 0, false
+	}
+
+	for {
+		if m.slots[idx].key == key {
+			return idx, true
+		}
+
+		next, ok := m.slots[idx].tag.next()
+		if !ok {
+			return 0, false
+		}
+
+		idx = next
+	}
+}
+
+// Put a key-value pair in the map.
+// If the key is already present in the map, the value is updated.
+func (m *Uint64ScatterChain) Put(key uint64, value interface{}) {
+	m.put(m.hash(key), key, value)
+}
+
+// put inserts or updates a key-value pair with a precomputed hash, growing the table if necessary.
+func (m *Uint64ScatterChain) put(hash uint64, key uint64, value interface{}) {
+	if m.n == uint(len(m.slots)) || uint(len(m.slots))-m.n < uint(len(m.slots))/inverseFreeRatio {
+		// Ensure that at least one slot is available for insert, even if we might not use it.
+		// Additionally, apply a constant upper bound to the load factor such that freeSlot does not get extremely slow.
+		// It might be possible to pack a free list by using the space otherwise occupied by key-value pairs (and thus allow for a higher load factor), but that seems a bit complicated.
+		m.grow()
+	}
+
+	m.doPut(hash, key, value)
+}
+
+func (m *Uint64ScatterChain) grow() {
+	if len(m.slots) == 0 {
+		// Handle a fresh map seperately.
+		m.slots = make([]uint64ScatterChainSlot, 4)
+		m.shift = 62
+		return
+	}
+
+	// Create a larger temporary map.
+	var tmp Uint64ScatterChain
+	tmp.seed = m.seed
+	tmp.shift = m.shift - 1
+	tmp.slots = make([]uint64ScatterChainSlot, 2*len(m.slots))
+
+	// Copy the pairs into the new map.
+	for i := range m.slots {
+		if m.slots[i].tag == scatterChainTagEmpty {
+			continue
+		}
+
+		tmp.doPut(m.hash(m.slots[i].key), m.slots[i].key, m.slots[i].value)
+	}
+
+	// Overwrite the old map with the new map.
+	*m = tmp
+
+	// There is a fancier way to do this which skips reallocating indices, but it appears to be slightly slower.
+}
+
+// doPut inserts or updates a key-value pair.
+// This will panic if there is not sufficient available space.
+func (m *Uint64ScatterChain) doPut(hash uint64, key uint64, value interface{}) {
+	idx := uint(hash >> m.shift)
+	switch {
+	case m.slots[idx].tag == scatterChainTagEmpty:
+		// Configure the slot as a fresh head.
+		m.slots[idx].tag = scatterChainTagHead
+
+	case !m.slots[idx].tag.isHead():
+		// This slot is currently used by a different chain.
+		// Find somewhere to move the previous pair.
+		dst := m.freeSlot(idx)
+
+		// Find the parent of the pair.
+		parent := uint(m.hash(m.slots[idx].key) >> m.shift)
+		for {
+			next, _ := m.slots[parent].tag.next()
+			if next == idx {
+				break
+			}
+
+			parent = next
+		}
+
+		// Move the pair.
+		m.slots[dst] = m.slots[idx]
+
+		// Update the parent's reference.
+		m.slots[parent].tag.setNext(dst)
+
+		// Configure the slot as a fresh head.
+		m.slots[idx].tag = scatterChainTagHead
+
+	case m.slots[idx].key == key:
+		// Update the pair in-place.
+		m.slots[idx].value = value
+		return
+
+	default:
+		if keyHash := m.hash(m.slots[idx].key); keyHash > hash {
+			// In order to insert to the head of a chain, we must move the former-head's pair.
+			dst := m.freeSlot(idx)
+			m.slots[dst] = m.slots[idx]
+			m.slots[dst].tag = m.slots[dst].tag.behead()
+
+			// Reconfigure the head slot.
+			m.slots[idx].key = key
+			m.slots[idx].tag.setNext(dst)
+			break
+		}
+
+		// Traverse the chain, looking for the insertion point.
+		for {
+			next, ok := m.slots[idx].tag.next()
+			if !ok {
+				// That was the end of the chain.
+				// Insert after the last pair.
+				break
+			}
+
+			if keyHash := m.hash(m.slots[next].key); keyHash > hash {
+				// The next key is beyond the key we want to insert.
+				// Insert after idx.
+				break
+			}
+
+			if m.slots[next].key == key {
+				// Update the pair in-place.
+				m.slots[next].value = value
+				return
+			}
+
+			idx = next
+		}
+
+		// Reserve a slot for the new pair.
+		dst := m.freeSlot(idx)
+
+		// Insert the slot into the chain.
+		m.slots[dst].tag = m.slots[idx].tag.behead()
+		m.slots[idx].tag.setNext(dst)
+
+		idx = dst
+	}
+
+	// Populate the slot with the pair.
+	m.slots[idx].key, m.slots[idx].value = key, value
+	m.n++
+}
+
+// freeSlot finds the nearest free slot.
+// If there are no free slots, this will panic.
+func (m *Uint64ScatterChain) freeSlot(near uint) uint {
+	for i, j := int(near), near+1; i >= 0 || j < uint(len(m.slots)); {
+		if i >= 0 {
+			if m.slots[i].tag == scatterChainTagEmpty {
+				return uint(i)
+			}
+			i--
+		}
+		if j < uint(len(m.slots)) {
+			if m.slots[j].tag == scatterChainTagEmpty {
+				return j
+			}
+			j++
+		}
+	}
+
+	panic("no free slot")
+}
+
+// Remove the key from the map.
+// If it is not present, nothing happens.
+// Pop removes the key from the map, and returns the value it had.
+// If it is not present, the second return is false.
+// This only probes the table once, unlike a Get followed by a Delete.
+func (m *Uint64ScatterChain) Pop(key uint64) (interface{}, bool) {
+	if m == nil || len(m.slots) == 0 {
+		return nil, false
+	}
+
+	return m.delete(m.hash(key), key)
+}
+
+func (m *Uint64ScatterChain) Delete(key uint64) {
+	if m == nil || len(m.slots) == 0 {
+		return
+	}
+
+	m.delete(m.hash(key), key)
+}
+
+// delete removes a key with a precomputed hash from a non-empty map.
+// It returns the removed value, if the key was present.
+func (m *Uint64ScatterChain) delete(hash uint64, key uint64) (interface{}, bool) {
+	idx := uint(hash >> uint64(m.shift))
+	if !m.slots[idx].tag.isHead() {
+		// This hash-bucket is empty.
+		return nil, false
+	}
+
+	if m.slots[idx].key == key {
+		// The key is at the head of the chain.
+		value := m.slots[idx].value
+		m.n--
+		if next, ok := m.slots[idx].tag.next(); ok {
+			// Move the next pair to the chain head.
+			m.slots[idx] = m.slots[next]
+			m.slots[next] = uint64ScatterChainSlot{}
+			m.slots[idx].tag |= scatterChainTagHead
+			return value, true
+		}
+
+		// The key is also the only value in the chain.
+		// Clear the slot.
+		m.slots[idx] = uint64ScatterChainSlot{}
+		return value, true
+	}
+
+	// Search for the key in the chain.
+	var prev uint
+	for {
+		next, ok := m.slots[idx].tag.next()
+		if !ok {
+			// The key is not in the map.
+			return nil, false
+		}
+
+		idx, prev = next, idx
+		if m.slots[idx].key == key {
+			break
+		}
+	}
+
+	// Replace the reference to this key's slot.
+	m.slots[prev].tag = (m.slots[prev].tag & scatterChainTagHead) | m.slots[idx].tag
+
+	// Clear the slot.
+	value := m.slots[idx].value
+	m.slots[idx] = uint64ScatterChainSlot{}
+
+	m.n--
+	return value, true
+}
@@ -0,0 +1,46 @@
+// Command proxy forwards TCP connections from one address to another.
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/niaow/exp/proxy"
+)
+
+func main() {
+	var in string
+	var out string
+	var grace time.Duration
+	var dialTimeout time.Duration
+	flag.StringVar(&in, "in", ":80", "input port (comma-separated for multiple)")
+	flag.StringVar(&out, "out", "localhost:8080", "output port (comma-separated for multiple)")
+	flag.DurationVar(&dialTimeout, "dial-timeout", proxy.DefaultDialTimeout, "time to wait when connecting to a backend")
+	flag.DurationVar(&grace, "grace", 10*time.Second, "time to wait for connections to finish when shutting down")
+	flag.Parse()
+
+	s := &proxy.Server{
+		Listeners:   strings.Split(in, ","),
+		Backends:    strings.Split(out, ","),
+		DialTimeout: dialTimeout,
+	}
+	if err := s.Start(); err != nil {
+		log.Fatal(err)
+	}
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	<-sig
+
+	ctx, cancel := context.WithTimeout(context.Background(), grace)
+	defer cancel()
+	if err := s.Shutdown(ctx); err != nil {
+		log.Printf("failed to shut down cleanly: %v", err)
+	}
+}
@@ -1,60 +1,267 @@
-package main
+// Package proxy implements a TCP forwarder, which relays connections from a set of listeners to a set of backends.
+package proxy
 
 import (
 	"context"
-	"flag"
+	"errors"
+	"fmt"
 	"io"
 	"log"
 	"net"
 	"sync"
+	"time"
 )
 
-func main() {
-	var in string
-	var out string
-	flag.StringVar(&in, "in", ":80", "input port")
-	flag.StringVar(&out, "out", "localhost:8080", "output port")
-	flag.Parse()
-	l, err := net.Listen("tcp", in)
-	if err != nil {
-		panic(err)
+// Server forwards TCP connections from its listeners to its backends.
+type Server struct {
+	// Listeners is the list of addresses to accept connections on.
+	Listeners []string
+
+	// Backends is the list of addresses to forward connections to.
+	// Connections are distributed between the backends in a round-robin fashion.
+	// If a backend can not be reached, the next one is tried.
+	Backends []string
+
+	// DialTimeout is the maximum amount of time to wait for a connection to a backend.
+	// If it is zero, DefaultDialTimeout is used.
+	DialTimeout time.Duration
+
+	// ErrorLog is used to log errors.
+	// If it is nil, the standard logger is used.
+	ErrorLog *log.Logger
+
+	mu        sync.Mutex
+	listeners []net.Listener
+	conns     map[net.Conn]struct{}
+	next      int
+	closing   bool
+	wg        sync.WaitGroup
+
+	// ctx is cancelled by Shutdown, to stop dialing backends.
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// DefaultDialTimeout is the timeout for connecting to a backend when Server.DialTimeout is not set.
+const DefaultDialTimeout = 10 * time.Second
+
+// ErrServerClosed is returned when starting a server which has been shut down.
+var ErrServerClosed = errors.New("proxy: server closed")
+
+// Start listens on all of the listener addresses, and starts forwarding connections in the background.
+// If any of the addresses can not be listened on, no connections are accepted.
+func (s *Server) Start() error {
+	if len(s.Backends) == 0 {
+		return errors.New("proxy: no backends")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closing {
+		return ErrServerClosed
+	}
+	if s.listeners != nil {
+		return errors.New("proxy: server already started")
+	}
+
+	listeners := make([]net.Listener, 0, len(s.Listeners))
+	for _, addr := range s.Listeners {
+		l, err := net.Listen("tcp", addr)
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return fmt.Errorf("proxy: failed to listen on %q: %w", addr, err)
+		}
+
+		listeners = append(listeners, l)
+	}
+	s.listeners = listeners
+	s.conns = make(map[net.Conn]struct{})
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+
+	for _, l := range listeners {
+		s.wg.Add(1)
+		go s.serve(l)
 	}
+
+	return nil
+}
+
+// Addrs returns the addresses which the server is listening on.
+// This is useful when listening on port 0.
+func (s *Server) Addrs() []net.Addr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	addrs := make([]net.Addr, len(s.listeners))
+	for i, l := range s.listeners {
+		addrs[i] = l.Addr()
+	}
+
+	return addrs
+}
+
+// Shutdown stops accepting connections, and waits for the active connections to finish.
+// Connections which are still waiting for a backend are dropped.
+// If the context is cancelled first, the remaining connections are closed and the error from the context is returned without waiting for them.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.closing = true
+	for _, l := range s.listeners {
+		l.Close()
+	}
+	if s.cancel != nil {
+		// A backend connection made now could not be tracked, so stop dialing.
+		s.cancel()
+	}
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		s.mu.Lock()
+		for conn := range s.conns {
+			conn.Close()
+		}
+		s.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// serve accepts connections from a listener until it is closed.
+func (s *Server) serve(l net.Listener) {
+	defer s.wg.Done()
+
+	var delay time.Duration
 	for {
 		conn, err := l.Accept()
 		if err != nil {
-			log.Printf("failed to accept: %v", err)
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+
+			// Back off in case the error is caused by resource exhaustion.
+			s.logf("failed to accept: %v", err)
+			if delay == 0 {
+				delay = 5 * time.Millisecond
+			} else if delay < time.Second {
+				delay *= 2
+			}
+			time.Sleep(delay)
+			continue
+		}
+		delay = 0
+
+		if !s.track(conn) {
+			conn.Close()
+			return
 		}
 		go func() {
-			dst, err := net.Dial("tcp", out)
-			if err != nil {
-				conn.Close()
-				log.Printf("failed to create backend connection: %v", err)
-			}
-			spliceConn(conn, dst)
+			defer s.untrack(conn)
+
+			s.forward(conn)
 		}()
 	}
 }
 
-func spliceConn(x, y net.Conn) {
+// forward forwards a connection to a backend.
+func (s *Server) forward(conn net.Conn) {
+	s.mu.Lock()
+	start := s.next
+	s.next = (s.next + 1) % len(s.Backends)
+	s.mu.Unlock()
+
+	d := net.Dialer{Timeout: s.DialTimeout}
+	if d.Timeout == 0 {
+		d.Timeout = DefaultDialTimeout
+	}
+	var dst net.Conn
+	for i := range s.Backends {
+		addr := s.Backends[(start+i)%len(s.Backends)]
+
+		var err error
+		dst, err = d.DialContext(s.ctx, "tcp", addr)
+		if err == nil {
+			break
+		}
+		if s.ctx.Err() != nil {
+			// The server is shutting down.
+			break
+		}
+		s.logf("failed to create backend connection to %q: %v", addr, err)
+	}
+	if dst == nil {
+		conn.Close()
+		return
+	}
+	if !s.track(dst) {
+		conn.Close()
+		dst.Close()
+		return
+	}
+	defer s.untrack(dst)
+
+	s.splice(conn, dst)
+}
+
+// splice copies data between two connections until either side is closed, and then closes both of them.
+func (s *Server) splice(x, y net.Conn) {
 	var once sync.Once
-	ctx, cancel := context.WithCancel(context.Background())
-	go func() {
-		<-ctx.Done()
+	var wg sync.WaitGroup
+	wg.Add(2)
+	cp := func(dst, src net.Conn) {
+		defer wg.Done()
+		_, err := io.Copy(dst, src)
+		if err != nil && !errors.Is(err, net.ErrClosed) {
+			once.Do(func() { s.logf("connection lost: %v", err) })
+		}
+
+		// Closing both connections stops the copy in the other direction.
 		x.Close()
 		y.Close()
-	}()
-	go func() {
-		defer cancel()
-		_, err := io.Copy(x, y)
-		if err != nil {
-			once.Do(func() { log.Printf("connection lost: %v", err) })
-		}
-	}()
-	go func() {
-		defer cancel()
-		_, err := io.Copy(y, x)
-		if err != nil {
-			once.Do(func() { log.Printf("connection lost: %v", err) })
-		}
-	}()
+	}
+	go cp(x, y)
+	cp(y, x)
+	wg.Wait()
+}
+
+// track adds a connection to the set of active connections, so that it can be closed by Shutdown.
+// If the server is shutting down, the connection is not added and this returns false.
+func (s *Server) track(conn net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closing {
+		return false
+	}
+	s.conns[conn] = struct{}{}
+	s.wg.Add(1)
+
+	return true
+}
+
+// untrack removes a connection from the set of active connections.
+func (s *Server) untrack(conn net.Conn) {
+	s.mu.Lock()
+	delete(s.conns, conn)
+	s.mu.Unlock()
+
+	s.wg.Done()
+}
+
+func (s *Server) logf(format string, args ...interface{}) {
+	if s.ErrorLog != nil {
+		s.ErrorLog.Printf(format, args...)
+	} else {
+		log.Printf(format, args...)
+	}
 }
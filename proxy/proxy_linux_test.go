@@ -0,0 +1,109 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// hangingBackend returns an address which never answers connection attempts.
+// The socket listens with a full backlog and never accepts, so the kernel drops new connection attempts instead of refusing them.
+func hangingBackend(t *testing.T) string {
+	t.Helper()
+
+	fd, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_STREAM, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { syscall.Close(fd) })
+	if err := syscall.Bind(fd, &syscall.SockaddrInet4{Addr: [4]byte{127, 0, 0, 1}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := syscall.Listen(fd, 0); err != nil {
+		t.Fatal(err)
+	}
+	sa, err := syscall.Getsockname(fd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := net.JoinHostPort("127.0.0.1", strconv.Itoa(sa.(*syscall.SockaddrInet4).Port))
+
+	// Fill the backlog.
+	for i := 0; ; i++ {
+		conn, err := net.DialTimeout("tcp", addr, 100*time.Millisecond)
+		var nerr net.Error
+		if errors.As(err, &nerr) && nerr.Timeout() {
+			return addr
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		if i == 16 {
+			t.Skip("connection attempts are not dropped when the backlog is full")
+		}
+	}
+}
+
+func TestServerHangingBackend(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Failover", func(t *testing.T) {
+		t.Parallel()
+
+		// The hanging backend is skipped once the dial times out.
+		s := &Server{
+			Listeners:   []string{"127.0.0.1:0"},
+			Backends:    []string{hangingBackend(t), echoBackend(t)},
+			DialTimeout: 100 * time.Millisecond,
+			ErrorLog:    log.New(ioutil.Discard, "", 0),
+		}
+		if err := s.Start(); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { s.Shutdown(context.Background()) })
+		for i := 0; i < 2; i++ {
+			dial(t, s)
+		}
+	})
+
+	t.Run("Shutdown", func(t *testing.T) {
+		t.Parallel()
+
+		s := &Server{
+			Listeners:   []string{"127.0.0.1:0"},
+			Backends:    []string{hangingBackend(t)},
+			DialTimeout: time.Hour,
+			ErrorLog:    log.New(ioutil.Discard, "", 0),
+		}
+		if err := s.Start(); err != nil {
+			t.Fatal(err)
+		}
+		conn, err := net.Dial("tcp", s.Addrs()[0].String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+
+		// Wait for the server to start dialing the backend.
+		time.Sleep(50 * time.Millisecond)
+
+		// Shutdown must stop the dial instead of waiting for it.
+		done := make(chan error, 1)
+		go func() { done <- s.Shutdown(context.Background()) }()
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Errorf("failed to shut down: %v", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("shutdown waited for a backend which never answers")
+		}
+	})
+}
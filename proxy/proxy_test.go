@@ -0,0 +1,185 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"testing"
+	"time"
+)
+
+// echoBackend starts a backend which echoes back everything it receives.
+func echoBackend(t *testing.T) string {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+
+	return l.Addr().String()
+}
+
+// deadBackend returns an address which refuses connections.
+func deadBackend(t *testing.T) string {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	return addr
+}
+
+// startServer starts a server with a dead backend and a live backend.
+func startServer(t *testing.T) *Server {
+	t.Helper()
+
+	s := &Server{
+		Listeners: []string{"127.0.0.1:0"},
+		Backends:  []string{deadBackend(t), echoBackend(t)},
+		ErrorLog:  log.New(ioutil.Discard, "", 0),
+	}
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Shutdown(context.Background()) })
+
+	return s
+}
+
+// dial connects to the server, and checks that data is relayed.
+func dial(t *testing.T, s *Server) net.Conn {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", s.Addrs()[0].String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	msg := []byte("hello")
+	if _, err := conn.Write(msg); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, len(msg))
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatalf("failed to read relayed data: %v", err)
+	}
+	if string(buf) != string(msg) {
+		t.Fatalf("expected %q but got %q", msg, buf)
+	}
+	conn.SetReadDeadline(time.Time{})
+
+	return conn
+}
+
+func TestServer(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Relay", func(t *testing.T) {
+		t.Parallel()
+
+		// The round robin starts at a different backend each time, and the dead backend is skipped.
+		s := startServer(t)
+		for i := 0; i < 4; i++ {
+			dial(t, s)
+		}
+	})
+
+	t.Run("Drain", func(t *testing.T) {
+		t.Parallel()
+
+		s := startServer(t)
+		conn := dial(t, s)
+
+		done := make(chan error, 1)
+		go func() { done <- s.Shutdown(context.Background()) }()
+
+		// Shutdown must wait for the active connection.
+		select {
+		case err := <-done:
+			t.Fatalf("shutdown finished with an active connection (%v)", err)
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		// The active connection still works.
+		msg := []byte("still here")
+		if _, err := conn.Write(msg); err != nil {
+			t.Fatal(err)
+		}
+		buf := make([]byte, len(msg))
+		if _, err := io.ReadFull(conn, buf); err != nil {
+			t.Fatal(err)
+		}
+
+		conn.Close()
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Errorf("failed to shut down: %v", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("shutdown did not finish after the connection was closed")
+		}
+
+		if err := s.Start(); err != ErrServerClosed {
+			t.Errorf("expected ErrServerClosed but got %v", err)
+		}
+	})
+
+	t.Run("Timeout", func(t *testing.T) {
+		t.Parallel()
+
+		s := startServer(t)
+		conn := dial(t, s)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		if err := s.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expected a deadline error but got %v", err)
+		}
+
+		// The connection must have been closed by the server.
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		if _, err := conn.Read(make([]byte, 1)); err != io.EOF {
+			t.Errorf("expected the connection to be closed but got %v", err)
+		}
+
+		// New connections are refused.
+		if conn, err := net.Dial("tcp", s.Addrs()[0].String()); err == nil {
+			conn.Close()
+			t.Error("connected after shutdown")
+		}
+	})
+
+	t.Run("NoBackends", func(t *testing.T) {
+		t.Parallel()
+
+		s := &Server{Listeners: []string{"127.0.0.1:0"}}
+		if err := s.Start(); err == nil {
+			s.Shutdown(context.Background())
+			t.Error("started without any backends")
+		}
+	})
+}
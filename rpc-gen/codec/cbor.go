@@ -0,0 +1,207 @@
+package codec
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+)
+
+// CBOR major types.
+const (
+	cborUint   = 0
+	cborNegInt = 1
+	cborBytes  = 2
+	cborString = 3
+	cborArray  = 4
+	cborMap    = 5
+	cborTag    = 6
+	cborSimple = 7
+)
+
+type cborCodec struct{}
+
+func (cborCodec) ContentType() string { return "application/cbor" }
+
+func (cborCodec) Marshal(v interface{}) ([]byte, error) {
+	var w cborWriter
+	if err := encode(&w, reflect.ValueOf(v)); err != nil {
+		return nil, err
+	}
+	return w.buf, nil
+}
+
+func (cborCodec) Unmarshal(data []byte, v interface{}) error {
+	return unmarshal(data, v, parseCBOR)
+}
+
+// cborWriter encodes values as CBOR.
+// Lengths are always definite, and integers use the shortest possible encoding.
+type cborWriter struct {
+	buf []byte
+}
+
+// head writes the initial bytes of an item.
+func (w *cborWriter) head(major byte, arg uint64) {
+	major <<= 5
+	switch {
+	case arg < 24:
+		w.buf = append(w.buf, major|byte(arg))
+	case arg <= math.MaxUint8:
+		w.buf = append(w.buf, major|24, byte(arg))
+	case arg <= math.MaxUint16:
+		w.buf = appendUint(append(w.buf, major|25), arg, 2)
+	case arg <= math.MaxUint32:
+		w.buf = appendUint(append(w.buf, major|26), arg, 4)
+	default:
+		w.buf = appendUint(append(w.buf, major|27), arg, 8)
+	}
+}
+
+func (w *cborWriter) writeNil() { w.buf = append(w.buf, cborSimple<<5|22) }
+
+func (w *cborWriter) writeBool(b bool) {
+	if b {
+		w.buf = append(w.buf, cborSimple<<5|21)
+	} else {
+		w.buf = append(w.buf, cborSimple<<5|20)
+	}
+}
+
+func (w *cborWriter) writeUint(u uint64) { w.head(cborUint, u) }
+
+func (w *cborWriter) writeInt(i int64) {
+	if i >= 0 {
+		w.head(cborUint, uint64(i))
+	} else {
+		w.head(cborNegInt, uint64(-1-i))
+	}
+}
+
+func (w *cborWriter) writeFloat32(f float32) {
+	w.buf = appendUint(append(w.buf, cborSimple<<5|26), uint64(math.Float32bits(f)), 4)
+}
+
+func (w *cborWriter) writeFloat64(f float64) {
+	w.buf = appendUint(append(w.buf, cborSimple<<5|27), math.Float64bits(f), 8)
+}
+
+func (w *cborWriter) writeString(s string) {
+	w.head(cborString, uint64(len(s)))
+	w.buf = append(w.buf, s...)
+}
+
+func (w *cborWriter) writeBytes(b []byte) {
+	w.head(cborBytes, uint64(len(b)))
+	w.buf = append(w.buf, b...)
+}
+
+func (w *cborWriter) writeArray(n int) { w.head(cborArray, uint64(n)) }
+
+func (w *cborWriter) writeMap(n int) { w.head(cborMap, uint64(n)) }
+
+// parseCBOR parses a CBOR data item.
+// Tags are ignored, and indefinite-length items are not supported.
+func parseCBOR(r *reader, depth int) (item, error) {
+	b, err := r.byte()
+	if err != nil {
+		return item{}, err
+	}
+	major, info := b>>5, b&0x1f
+
+	if major == cborSimple {
+		switch info {
+		case 20:
+			return item{kind: kindBool, b: false}, nil
+		case 21:
+			return item{kind: kindBool, b: true}, nil
+		case 22, 23:
+			// null and undefined
+			return item{kind: kindNil}, nil
+		case 25:
+			h, err := r.uint(2)
+			if err != nil {
+				return item{}, err
+			}
+			return item{kind: kindFloat, f: float16(uint16(h))}, nil
+		case 26:
+			f, err := r.uint(4)
+			if err != nil {
+				return item{}, err
+			}
+			return item{kind: kindFloat, f: float64(math.Float32frombits(uint32(f)))}, nil
+		case 27:
+			f, err := r.uint(8)
+			if err != nil {
+				return item{}, err
+			}
+			return item{kind: kindFloat, f: math.Float64frombits(f)}, nil
+		case 31:
+			return item{}, errors.New("codec: unexpected CBOR break")
+		default:
+			return item{}, fmt.Errorf("codec: unsupported CBOR simple value %d", info)
+		}
+	}
+
+	var arg uint64
+	switch {
+	case info < 24:
+		arg = uint64(info)
+	case info <= 27:
+		arg, err = r.uint(1 << (info - 24))
+		if err != nil {
+			return item{}, err
+		}
+	case info == 31:
+		return item{}, errors.New("codec: indefinite-length CBOR items are not supported")
+	default:
+		return item{}, fmt.Errorf("codec: invalid CBOR additional information %d", info)
+	}
+
+	switch major {
+	case cborUint:
+		return item{kind: kindUint, u: arg}, nil
+	case cborNegInt:
+		if arg > math.MaxInt64 {
+			return item{}, fmt.Errorf("codec: integer -1-%d overflows int64", arg)
+		}
+		return item{kind: kindInt, i: -1 - int64(arg)}, nil
+	case cborBytes:
+		return r.bytes(arg)
+	case cborString:
+		return r.string(arg)
+	case cborArray:
+		return parseSeq(r, depth, kindArray, arg, parseCBOR)
+	case cborMap:
+		return parseSeq(r, depth, kindMap, arg, parseCBOR)
+	default:
+		// tag
+		if depth >= maxDepth {
+			return item{}, errors.New("codec: exceeded maximum nesting depth")
+		}
+		return parseCBOR(r, depth+1)
+	}
+}
+
+// float16 converts an IEEE 754 half-precision float to a float64.
+func float16(h uint16) float64 {
+	exp := int(h>>10) & 0x1f
+	mant := float64(h & 0x3ff)
+	var f float64
+	switch exp {
+	case 0:
+		f = math.Ldexp(mant, -24)
+	case 0x1f:
+		if mant == 0 {
+			f = math.Inf(1)
+		} else {
+			f = math.NaN()
+		}
+	default:
+		f = math.Ldexp(mant+1024, exp-25)
+	}
+	if h&0x8000 != 0 {
+		f = -f
+	}
+	return f
+}
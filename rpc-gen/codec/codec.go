@@ -0,0 +1,676 @@
+// Package codec implements the binary argument encodings used by code generated with rpc-gen.
+// Values are encoded with the same shape as encoding/json: structs are encoded as maps keyed by their JSON field names.
+// Byte slices are encoded as byte strings rather than base64 text.
+// Types implementing encoding.TextMarshaler and encoding.TextUnmarshaler are encoded as strings, as in encoding/json.
+package codec
+
+import (
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Codec is an encoding of values.
+type Codec interface {
+	// ContentType returns the MIME type of the encoding.
+	ContentType() string
+
+	// Marshal encodes a value.
+	Marshal(v interface{}) ([]byte, error)
+
+	// Unmarshal decodes data into the value pointed to by v.
+	Unmarshal(data []byte, v interface{}) error
+}
+
+var (
+	// CBOR is the Concise Binary Object Representation, as defined in RFC 8949.
+	CBOR Codec = cborCodec{}
+
+	// MessagePack is the MessagePack encoding, as defined in https://github.com/msgpack/msgpack/blob/master/spec.md.
+	MessagePack Codec = msgpackCodec{}
+
+	// JSON is the JSON encoding implemented by encoding/json.
+	// It allows JSON to be selected wherever a codec is expected.
+	// ByContentType never returns it, as JSON is the default encoding of generated code.
+	JSON Codec = jsonCodec{}
+)
+
+type jsonCodec struct{}
+
+func (jsonCodec) ContentType() string { return "application/json" }
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) { return json.Marshal(v) }
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+
+// ByContentType looks up a codec by MIME type.
+// Any parameters of the type are ignored.
+func ByContentType(contentType string) (Codec, bool) {
+	if i := strings.IndexByte(contentType, ';'); i != -1 {
+		contentType = contentType[:i]
+	}
+	switch strings.ToLower(strings.TrimSpace(contentType)) {
+	case "application/cbor":
+		return CBOR, true
+	case "application/msgpack", "application/x-msgpack", "application/vnd.msgpack":
+		return MessagePack, true
+	default:
+		return nil, false
+	}
+}
+
+// maxDepth is the maximum nesting depth of a decoded value.
+const maxDepth = 1000
+
+var errTruncated = errors.New("codec: unexpected end of data")
+
+// UnsupportedTypeError is returned when attempting to encode a value of an unsupported type.
+type UnsupportedTypeError struct {
+	Type reflect.Type
+}
+
+func (err *UnsupportedTypeError) Error() string {
+	return "codec: unsupported type " + err.Type.String()
+}
+
+// TypeError is returned when a decoded value cannot be stored in the destination.
+type TypeError struct {
+	// Value is a description of the decoded value.
+	Value string
+
+	// Type is the destination type.
+	Type reflect.Type
+}
+
+func (err *TypeError) Error() string {
+	return "codec: cannot decode " + err.Value + " into " + err.Type.String()
+}
+
+// writer is a format-specific output of the encoder.
+type writer interface {
+	writeNil()
+	writeBool(bool)
+	writeUint(uint64)
+	writeInt(int64)
+	writeFloat32(float32)
+	writeFloat64(float64)
+	writeString(string)
+	writeBytes([]byte)
+	writeArray(n int)
+	writeMap(n int)
+}
+
+var (
+	textMarshalerType   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// encode a value with a writer.
+func encode(w writer, v reflect.Value) error {
+	if v.IsValid() && v.Type().Implements(textMarshalerType) &&
+		!((v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) && v.IsNil()) {
+		text, err := v.Interface().(encoding.TextMarshaler).MarshalText()
+		if err != nil {
+			return err
+		}
+		w.writeString(string(text))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.Invalid:
+		w.writeNil()
+	case reflect.Bool:
+		w.writeBool(v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		w.writeInt(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		w.writeUint(v.Uint())
+	case reflect.Float32:
+		w.writeFloat32(float32(v.Float()))
+	case reflect.Float64:
+		w.writeFloat64(v.Float())
+	case reflect.String:
+		w.writeString(v.String())
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			w.writeNil()
+			return nil
+		}
+		return encode(w, v.Elem())
+	case reflect.Slice:
+		if v.IsNil() {
+			w.writeNil()
+			return nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			w.writeBytes(v.Bytes())
+			return nil
+		}
+		fallthrough
+	case reflect.Array:
+		n := v.Len()
+		w.writeArray(n)
+		for i := 0; i < n; i++ {
+			if err := encode(w, v.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return &UnsupportedTypeError{v.Type()}
+		}
+		if v.IsNil() {
+			w.writeNil()
+			return nil
+		}
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+		w.writeMap(len(keys))
+		for _, k := range keys {
+			w.writeString(k.String())
+			if err := encode(w, v.MapIndex(k)); err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		fields := structFields(v.Type())
+		n := 0
+		for _, f := range fields {
+			if !f.omitEmpty || !isEmpty(v.Field(f.index)) {
+				n++
+			}
+		}
+		w.writeMap(n)
+		for _, f := range fields {
+			fv := v.Field(f.index)
+			if f.omitEmpty && isEmpty(fv) {
+				continue
+			}
+			w.writeString(f.name)
+			if err := encode(w, fv); err != nil {
+				return err
+			}
+		}
+	default:
+		return &UnsupportedTypeError{v.Type()}
+	}
+	return nil
+}
+
+// isEmpty checks whether a value is considered empty by the "omitempty" option.
+func isEmpty(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
+
+// field is an encoded field of a struct.
+type field struct {
+	name      string
+	index     int
+	omitEmpty bool
+}
+
+var fieldCache sync.Map // map[reflect.Type][]field
+
+// structFields gets the encoded fields of a struct type.
+// The fields are named by their "json" struct tags.
+// Unlike encoding/json, the fields of embedded structs are not promoted.
+func structFields(t reflect.Type) []field {
+	if fields, ok := fieldCache.Load(t); ok {
+		return fields.([]field)
+	}
+	var fields []field
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" {
+			// unexported
+			continue
+		}
+		tag := sf.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		f := field{name: sf.Name, index: i}
+		name, opts := splitTag(tag)
+		if name != "" {
+			f.name = name
+		}
+		f.omitEmpty = hasOpt(opts, "omitempty")
+		fields = append(fields, f)
+	}
+	fieldCache.Store(t, fields)
+	return fields
+}
+
+func splitTag(tag string) (string, string) {
+	if i := strings.IndexByte(tag, ','); i != -1 {
+		return tag[:i], tag[i+1:]
+	}
+	return tag, ""
+}
+
+func hasOpt(opts string, opt string) bool {
+	for opts != "" {
+		var o string
+		o, opts = splitTag(opts)
+		if o == opt {
+			return true
+		}
+	}
+	return false
+}
+
+// kind is the kind of a decoded item.
+type kind uint8
+
+const (
+	kindNil kind = iota
+	kindBool
+	kindUint
+	kindInt
+	kindFloat
+	kindString
+	kindBytes
+	kindArray
+	kindMap
+)
+
+func (k kind) String() string {
+	switch k {
+	case kindNil:
+		return "nil"
+	case kindBool:
+		return "bool"
+	case kindUint, kindInt:
+		return "integer"
+	case kindFloat:
+		return "float"
+	case kindString:
+		return "string"
+	case kindBytes:
+		return "byte string"
+	case kindArray:
+		return "array"
+	case kindMap:
+		return "map"
+	default:
+		return "unknown"
+	}
+}
+
+// item is a decoded value, independent of the format.
+type item struct {
+	kind kind
+
+	// b is the value of a bool.
+	b bool
+
+	// u is the value of a non-negative integer.
+	u uint64
+
+	// i is the value of a negative integer.
+	i int64
+
+	// f is the value of a float.
+	f float64
+
+	// s is the value of a string.
+	s string
+
+	// bytes is the value of a byte string.
+	bytes []byte
+
+	// elems are the elements of an array, or the alternating keys and values of a map.
+	elems []item
+}
+
+// assign stores a decoded item in a value.
+func assign(it item, v reflect.Value) error {
+	if it.kind == kindNil {
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+	if it.kind == kindString && v.Kind() != reflect.Ptr && v.CanAddr() && v.Addr().Type().Implements(textUnmarshalerType) {
+		return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(it.s))
+	}
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return assign(it, v.Elem())
+	case reflect.Interface:
+		if v.NumMethod() != 0 {
+			break
+		}
+		g, err := generic(it)
+		if err != nil {
+			return err
+		}
+		if g == nil {
+			v.Set(reflect.Zero(v.Type()))
+		} else {
+			v.Set(reflect.ValueOf(g))
+		}
+		return nil
+	case reflect.Bool:
+		if it.kind == kindBool {
+			v.SetBool(it.b)
+			return nil
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		switch it.kind {
+		case kindUint:
+			if it.u > math.MaxInt64 || v.OverflowInt(int64(it.u)) {
+				return &TypeError{fmt.Sprintf("integer %d", it.u), v.Type()}
+			}
+			v.SetInt(int64(it.u))
+			return nil
+		case kindInt:
+			if v.OverflowInt(it.i) {
+				return &TypeError{fmt.Sprintf("integer %d", it.i), v.Type()}
+			}
+			v.SetInt(it.i)
+			return nil
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		switch it.kind {
+		case kindUint:
+			if v.OverflowUint(it.u) {
+				return &TypeError{fmt.Sprintf("integer %d", it.u), v.Type()}
+			}
+			v.SetUint(it.u)
+			return nil
+		case kindInt:
+			return &TypeError{fmt.Sprintf("integer %d", it.i), v.Type()}
+		}
+	case reflect.Float32, reflect.Float64:
+		switch it.kind {
+		case kindFloat:
+			v.SetFloat(it.f)
+			return nil
+		case kindUint:
+			v.SetFloat(float64(it.u))
+			return nil
+		case kindInt:
+			v.SetFloat(float64(it.i))
+			return nil
+		}
+	case reflect.String:
+		if it.kind == kindString {
+			v.SetString(it.s)
+			return nil
+		}
+	case reflect.Slice:
+		switch it.kind {
+		case kindBytes:
+			if v.Type().Elem().Kind() != reflect.Uint8 {
+				break
+			}
+			b := reflect.MakeSlice(v.Type(), len(it.bytes), len(it.bytes))
+			reflect.Copy(b, reflect.ValueOf(it.bytes))
+			v.Set(b)
+			return nil
+		case kindArray:
+			s := reflect.MakeSlice(v.Type(), len(it.elems), len(it.elems))
+			for i, e := range it.elems {
+				if err := assign(e, s.Index(i)); err != nil {
+					return err
+				}
+			}
+			v.Set(s)
+			return nil
+		}
+	case reflect.Array:
+		if it.kind == kindArray {
+			for i := 0; i < v.Len(); i++ {
+				e := item{kind: kindNil}
+				if i < len(it.elems) {
+					e = it.elems[i]
+				}
+				if err := assign(e, v.Index(i)); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	case reflect.Map:
+		if it.kind != kindMap || v.Type().Key().Kind() != reflect.String {
+			break
+		}
+		m := reflect.MakeMapWithSize(v.Type(), len(it.elems)/2)
+		for i := 0; i < len(it.elems); i += 2 {
+			k := it.elems[i]
+			if k.kind != kindString {
+				return &TypeError{k.kind.String() + " map key", v.Type()}
+			}
+			e := reflect.New(v.Type().Elem()).Elem()
+			if err := assign(it.elems[i+1], e); err != nil {
+				return err
+			}
+			m.SetMapIndex(reflect.ValueOf(k.s).Convert(v.Type().Key()), e)
+		}
+		v.Set(m)
+		return nil
+	case reflect.Struct:
+		if it.kind != kindMap {
+			break
+		}
+		fields := structFields(v.Type())
+		for i := 0; i < len(it.elems); i += 2 {
+			k := it.elems[i]
+			if k.kind != kindString {
+				return &TypeError{k.kind.String() + " map key", v.Type()}
+			}
+			f, ok := lookupField(fields, k.s)
+			if !ok {
+				// unknown fields are ignored
+				continue
+			}
+			if err := assign(it.elems[i+1], v.Field(f.index)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return &TypeError{it.kind.String(), v.Type()}
+}
+
+// lookupField finds the field with the given name.
+// An exact match is preferred, but case-insensitive matches are accepted like in encoding/json.
+func lookupField(fields []field, name string) (field, bool) {
+	for _, f := range fields {
+		if f.name == name {
+			return f, true
+		}
+	}
+	for _, f := range fields {
+		if strings.EqualFold(f.name, name) {
+			return f, true
+		}
+	}
+	return field{}, false
+}
+
+// generic converts an item to a value for an empty interface.
+// Integers are converted to int64 when possible, and uint64 otherwise.
+func generic(it item) (interface{}, error) {
+	switch it.kind {
+	case kindNil:
+		return nil, nil
+	case kindBool:
+		return it.b, nil
+	case kindUint:
+		if it.u <= math.MaxInt64 {
+			return int64(it.u), nil
+		}
+		return it.u, nil
+	case kindInt:
+		return it.i, nil
+	case kindFloat:
+		return it.f, nil
+	case kindString:
+		return it.s, nil
+	case kindBytes:
+		return it.bytes, nil
+	case kindArray:
+		arr := make([]interface{}, len(it.elems))
+		for i, e := range it.elems {
+			g, err := generic(e)
+			if err != nil {
+				return nil, err
+			}
+			arr[i] = g
+		}
+		return arr, nil
+	case kindMap:
+		m := make(map[string]interface{}, len(it.elems)/2)
+		for i := 0; i < len(it.elems); i += 2 {
+			k := it.elems[i]
+			if k.kind != kindString {
+				return nil, fmt.Errorf("codec: unsupported %s map key", k.kind)
+			}
+			g, err := generic(it.elems[i+1])
+			if err != nil {
+				return nil, err
+			}
+			m[k.s] = g
+		}
+		return m, nil
+	default:
+		return nil, fmt.Errorf("codec: unknown item kind %d", it.kind)
+	}
+}
+
+// reader is a cursor over encoded data.
+type reader struct {
+	data []byte
+}
+
+func (r *reader) byte() (byte, error) {
+	if len(r.data) == 0 {
+		return 0, errTruncated
+	}
+	b := r.data[0]
+	r.data = r.data[1:]
+	return b, nil
+}
+
+func (r *reader) next(n uint64) ([]byte, error) {
+	if n > uint64(len(r.data)) {
+		return nil, errTruncated
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b, nil
+}
+
+func (r *reader) uint(size int) (uint64, error) {
+	b, err := r.next(uint64(size))
+	if err != nil {
+		return 0, err
+	}
+	var v uint64
+	for _, x := range b {
+		v = v<<8 | uint64(x)
+	}
+	return v, nil
+}
+
+// appendUint appends the low size bytes of an integer in big-endian order.
+func appendUint(buf []byte, v uint64, size int) []byte {
+	for i := size - 1; i >= 0; i-- {
+		buf = append(buf, byte(v>>(8*uint(i))))
+	}
+	return buf
+}
+
+// checkCount checks that the data is long enough to contain n items, each at least size bytes long.
+// This prevents giant allocations from short inputs.
+func (r *reader) checkCount(n uint64, size uint64) error {
+	if n > uint64(len(r.data))/size {
+		return errTruncated
+	}
+	return nil
+}
+
+func (r *reader) string(n uint64) (item, error) {
+	b, err := r.next(n)
+	if err != nil {
+		return item{}, err
+	}
+	if !utf8.Valid(b) {
+		return item{}, errors.New("codec: invalid UTF-8 in string")
+	}
+	return item{kind: kindString, s: string(b)}, nil
+}
+
+func (r *reader) bytes(n uint64) (item, error) {
+	b, err := r.next(n)
+	if err != nil {
+		return item{}, err
+	}
+	return item{kind: kindBytes, bytes: append([]byte(nil), b...)}, nil
+}
+
+// unmarshal decodes data with a format-specific item parser.
+func unmarshal(data []byte, v interface{}, parse func(*reader, int) (item, error)) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("codec: cannot unmarshal into non-pointer %T", v)
+	}
+	r := reader{data}
+	it, err := parse(&r, 0)
+	if err != nil {
+		return err
+	}
+	if len(r.data) != 0 {
+		return fmt.Errorf("codec: %d bytes of trailing data", len(r.data))
+	}
+	return assign(it, rv.Elem())
+}
+
+// parseSeq parses the elements of an array or map.
+func parseSeq(r *reader, depth int, kind kind, n uint64, parse func(*reader, int) (item, error)) (item, error) {
+	if depth >= maxDepth {
+		return item{}, errors.New("codec: exceeded maximum nesting depth")
+	}
+	if kind == kindMap {
+		if n > math.MaxUint64/2 {
+			return item{}, errTruncated
+		}
+		n *= 2
+	}
+	if err := r.checkCount(n, 1); err != nil {
+		return item{}, err
+	}
+	elems := make([]item, n)
+	for i := range elems {
+		e, err := parse(r, depth+1)
+		if err != nil {
+			return item{}, err
+		}
+		elems[i] = e
+	}
+	return item{kind: kind, elems: elems}, nil
+}
@@ -0,0 +1,219 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/hex"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type point struct {
+	X int     `json:"x"`
+	Y float64 `json:"y,omitempty"`
+}
+
+type stamped struct {
+	At  time.Time  `json:"at"`
+	Opt *time.Time `json:"opt,omitempty"`
+}
+
+type record struct {
+	Name   string            `json:"name"`
+	Tags   []string          `json:"tags"`
+	Data   []byte            `json:"data"`
+	Points []point           `json:"points"`
+	Attrs  map[string]uint16 `json:"attrs,omitempty"`
+	Next   *record           `json:"next,omitempty"`
+	Stamps []stamped         `json:"stamps"`
+	Skip   int               `json:"-"`
+	hidden int
+}
+
+func TestRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2021, time.March, 4, 5, 6, 7, 8, time.UTC)
+	in := record{
+		Name:   "ẞtring",
+		Tags:   []string{"a", "", "ccc"},
+		Data:   bytes.Repeat([]byte{0xde, 0xad}, 200),
+		Points: []point{{X: -1}, {X: math.MaxInt32 + 1, Y: 0.5}, {X: math.MinInt64, Y: math.Inf(-1)}},
+		Attrs:  map[string]uint16{"x": 1, "y": math.MaxUint16},
+		Next:   &record{Name: "next", Points: []point{}},
+		Stamps: []stamped{{At: now}, {At: now.Add(time.Hour), Opt: &now}},
+	}
+
+	for _, c := range []Codec{CBOR, MessagePack} {
+		c := c
+		t.Run(c.ContentType(), func(t *testing.T) {
+			t.Parallel()
+
+			dat, err := c.Marshal(in)
+			if err != nil {
+				t.Fatalf("failed to marshal: %v", err)
+			}
+			var out record
+			if err := c.Unmarshal(dat, &out); err != nil {
+				t.Fatalf("failed to unmarshal: %v", err)
+			}
+			if !reflect.DeepEqual(in, out) {
+				t.Errorf("expected %+v; got %+v", in, out)
+			}
+
+			var generic interface{}
+			if err := c.Unmarshal(dat, &generic); err != nil {
+				t.Fatalf("failed to unmarshal generic: %v", err)
+			}
+			if name := generic.(map[string]interface{})["name"]; name != in.Name {
+				t.Errorf("expected generic name %q; got %v", in.Name, name)
+			}
+
+			if err := c.Unmarshal(dat[:len(dat)-1], &out); err == nil {
+				t.Error("unmarshaled truncated data")
+			}
+			if err := c.Unmarshal(append(dat, 0), &out); err == nil {
+				t.Error("unmarshaled trailing data")
+			}
+		})
+	}
+}
+
+func TestVectors(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		codec   Codec
+		value   interface{}
+		encoded string
+	}{
+		{CBOR, uint64(0), "00"},
+		{CBOR, 23, "17"},
+		{CBOR, 24, "1818"},
+		{CBOR, 1000, "1903e8"},
+		{CBOR, uint64(math.MaxUint64), "1bffffffffffffffff"},
+		{CBOR, -1, "20"},
+		{CBOR, -1000, "3903e7"},
+		{CBOR, 1.1, "fb3ff199999999999a"},
+		{CBOR, float32(100000), "fa47c35000"},
+		{CBOR, false, "f4"},
+		{CBOR, nil, "f6"},
+		{CBOR, []byte{1, 2, 3, 4}, "4401020304"},
+		{CBOR, "IETF", "6449455446"},
+		{CBOR, []int{1, 2, 3}, "83010203"},
+		{CBOR, point{X: 1}, "a1617801"},
+		{CBOR, time.Date(2013, time.March, 21, 20, 4, 0, 0, time.UTC), "74323031332d30332d32315432303a30343a30305a"},
+		{MessagePack, 0, "00"},
+		{MessagePack, 128, "cc80"},
+		{MessagePack, 1000, "cd03e8"},
+		{MessagePack, -1, "ff"},
+		{MessagePack, -33, "d0df"},
+		{MessagePack, -1000, "d1fc18"},
+		{MessagePack, true, "c3"},
+		{MessagePack, nil, "c0"},
+		{MessagePack, 1.5, "cb3ff8000000000000"},
+		{MessagePack, []byte{1, 2}, "c4020102"},
+		{MessagePack, "abc", "a3616263"},
+		{MessagePack, []int{1, 2, 3}, "93010203"},
+		{MessagePack, point{X: 1}, "81a17801"},
+	}
+	for _, c := range cases {
+		dat, err := c.codec.Marshal(c.value)
+		if err != nil {
+			t.Errorf("failed to marshal %v as %s: %v", c.value, c.codec.ContentType(), err)
+			continue
+		}
+		if got := hex.EncodeToString(dat); got != c.encoded {
+			t.Errorf("expected %v to be encoded as %s in %s; got %s", c.value, c.encoded, c.codec.ContentType(), got)
+		}
+	}
+}
+
+func TestDecode(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		codec   Codec
+		encoded string
+		value   interface{}
+	}{
+		// half-precision floats
+		{CBOR, "f93c00", 1.0},
+		{CBOR, "f9c400", -4.0},
+		{CBOR, "f90001", 5.960464477539063e-8},
+		{CBOR, "f97c00", math.Inf(1)},
+		// tags are ignored
+		{CBOR, "c11a514b67b0", int64(1363896240)},
+		// integer widths
+		{MessagePack, "d3ffffffffffffffff", int64(-1)},
+		{MessagePack, "d07f", int64(127)},
+		{MessagePack, "ce00010000", int64(65536)},
+		{MessagePack, "ca3fc00000", 1.5},
+	}
+	for _, c := range cases {
+		dat, err := hex.DecodeString(c.encoded)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var v interface{}
+		if err := c.codec.Unmarshal(dat, &v); err != nil {
+			t.Errorf("failed to unmarshal %s as %s: %v", c.encoded, c.codec.ContentType(), err)
+			continue
+		}
+		if v != c.value {
+			t.Errorf("expected %s to decode to %v in %s; got %v", c.encoded, c.value, c.codec.ContentType(), v)
+		}
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		codec   Codec
+		encoded string
+		into    interface{}
+	}{
+		// overflow
+		{CBOR, "190100", new(uint8)},
+		{CBOR, "20", new(uint)},
+		{MessagePack, "cd0100", new(int8)},
+		// wrong type
+		{CBOR, "6161", new(int)},
+		{MessagePack, "c3", new(string)},
+		{MessagePack, "a161", new(point)},
+		// giant lengths
+		{CBOR, "9bffffffffffffffff", new([]int)},
+		{MessagePack, "ddffffffff", new([]int)},
+		// indefinite length
+		{CBOR, "9f01ff", new([]int)},
+		// invalid UTF-8
+		{CBOR, "61ff", new(string)},
+	}
+	for _, c := range cases {
+		dat, err := hex.DecodeString(c.encoded)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := c.codec.Unmarshal(dat, c.into); err == nil {
+			t.Errorf("unmarshaled %s into %T in %s", c.encoded, c.into, c.codec.ContentType())
+		}
+	}
+}
+
+func TestByContentType(t *testing.T) {
+	t.Parallel()
+
+	for typ, expect := range map[string]Codec{
+		"application/cbor":                  CBOR,
+		"application/msgpack":               MessagePack,
+		"Application/X-MsgPack; charset=ok": MessagePack,
+		"application/json":                  nil,
+	} {
+		c, ok := ByContentType(typ)
+		if c != expect || ok != (expect != nil) {
+			t.Errorf("expected %q to map to %v; got %v", typ, expect, c)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package codec
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+)
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) ContentType() string { return "application/msgpack" }
+
+func (msgpackCodec) Marshal(v interface{}) ([]byte, error) {
+	var w msgpackWriter
+	if err := encode(&w, reflect.ValueOf(v)); err != nil {
+		return nil, err
+	}
+	return w.buf, nil
+}
+
+func (msgpackCodec) Unmarshal(data []byte, v interface{}) error {
+	return unmarshal(data, v, parseMsgpack)
+}
+
+// msgpackWriter encodes values as MessagePack.
+// Integers and lengths use the shortest possible encoding.
+type msgpackWriter struct {
+	buf []byte
+}
+
+func (w *msgpackWriter) writeNil() { w.buf = append(w.buf, 0xc0) }
+
+func (w *msgpackWriter) writeBool(b bool) {
+	if b {
+		w.buf = append(w.buf, 0xc3)
+	} else {
+		w.buf = append(w.buf, 0xc2)
+	}
+}
+
+func (w *msgpackWriter) writeUint(u uint64) {
+	switch {
+	case u <= 0x7f:
+		w.buf = append(w.buf, byte(u))
+	case u <= math.MaxUint8:
+		w.buf = append(w.buf, 0xcc, byte(u))
+	case u <= math.MaxUint16:
+		w.buf = appendUint(append(w.buf, 0xcd), u, 2)
+	case u <= math.MaxUint32:
+		w.buf = appendUint(append(w.buf, 0xce), u, 4)
+	default:
+		w.buf = appendUint(append(w.buf, 0xcf), u, 8)
+	}
+}
+
+func (w *msgpackWriter) writeInt(i int64) {
+	switch {
+	case i >= 0:
+		w.writeUint(uint64(i))
+	case i >= -32:
+		w.buf = append(w.buf, byte(i))
+	case i >= math.MinInt8:
+		w.buf = append(w.buf, 0xd0, byte(i))
+	case i >= math.MinInt16:
+		w.buf = appendUint(append(w.buf, 0xd1), uint64(i), 2)
+	case i >= math.MinInt32:
+		w.buf = appendUint(append(w.buf, 0xd2), uint64(i), 4)
+	default:
+		w.buf = appendUint(append(w.buf, 0xd3), uint64(i), 8)
+	}
+}
+
+func (w *msgpackWriter) writeFloat32(f float32) {
+	w.buf = appendUint(append(w.buf, 0xca), uint64(math.Float32bits(f)), 4)
+}
+
+func (w *msgpackWriter) writeFloat64(f float64) {
+	w.buf = appendUint(append(w.buf, 0xcb), math.Float64bits(f), 8)
+}
+
+// head writes the header of a variable-length item.
+// The fix argument is the prefix of the fixed-size format, which holds lengths up to fixMax.
+// The sized formats are tried in order of 8, 16, and 32 bit lengths.
+func (w *msgpackWriter) head(n int, fix byte, fixMax int, sized [3]byte) {
+	switch {
+	case n <= fixMax:
+		w.buf = append(w.buf, fix|byte(n))
+	case sized[0] != 0 && n <= math.MaxUint8:
+		w.buf = append(w.buf, sized[0], byte(n))
+	case n <= math.MaxUint16:
+		w.buf = appendUint(append(w.buf, sized[1]), uint64(n), 2)
+	default:
+		w.buf = appendUint(append(w.buf, sized[2]), uint64(n), 4)
+	}
+}
+
+func (w *msgpackWriter) writeString(s string) {
+	w.head(len(s), 0xa0, 31, [3]byte{0xd9, 0xda, 0xdb})
+	w.buf = append(w.buf, s...)
+}
+
+func (w *msgpackWriter) writeBytes(b []byte) {
+	// there is no fixed-size bin format
+	w.head(len(b), 0, -1, [3]byte{0xc4, 0xc5, 0xc6})
+	w.buf = append(w.buf, b...)
+}
+
+func (w *msgpackWriter) writeArray(n int) { w.head(n, 0x90, 15, [3]byte{0, 0xdc, 0xdd}) }
+
+func (w *msgpackWriter) writeMap(n int) { w.head(n, 0x80, 15, [3]byte{0, 0xde, 0xdf}) }
+
+// parseMsgpack parses a MessagePack object.
+// Extension types are not supported.
+func parseMsgpack(r *reader, depth int) (item, error) {
+	b, err := r.byte()
+	if err != nil {
+		return item{}, err
+	}
+
+	switch {
+	case b <= 0x7f:
+		return item{kind: kindUint, u: uint64(b)}, nil
+	case b >= 0xe0:
+		return item{kind: kindInt, i: int64(int8(b))}, nil
+	case b&0xf0 == 0x80:
+		return parseSeq(r, depth, kindMap, uint64(b&0x0f), parseMsgpack)
+	case b&0xf0 == 0x90:
+		return parseSeq(r, depth, kindArray, uint64(b&0x0f), parseMsgpack)
+	case b&0xe0 == 0xa0:
+		return r.string(uint64(b & 0x1f))
+	}
+
+	// size is the number of bytes following the type for the length or value
+	var size int
+	switch b {
+	case 0xc0:
+		return item{kind: kindNil}, nil
+	case 0xc2:
+		return item{kind: kindBool, b: false}, nil
+	case 0xc3:
+		return item{kind: kindBool, b: true}, nil
+	case 0xc4, 0xcc, 0xd0, 0xd9:
+		size = 1
+	case 0xc5, 0xcd, 0xd1, 0xda, 0xdc, 0xde:
+		size = 2
+	case 0xc6, 0xca, 0xce, 0xd2, 0xdb, 0xdd, 0xdf:
+		size = 4
+	case 0xcb, 0xcf, 0xd3:
+		size = 8
+	default:
+		return item{}, fmt.Errorf("codec: unsupported MessagePack type 0x%02x", b)
+	}
+	v, err := r.uint(size)
+	if err != nil {
+		return item{}, err
+	}
+
+	switch b {
+	case 0xc4, 0xc5, 0xc6:
+		return r.bytes(v)
+	case 0xd9, 0xda, 0xdb:
+		return r.string(v)
+	case 0xdc, 0xdd:
+		return parseSeq(r, depth, kindArray, v, parseMsgpack)
+	case 0xde, 0xdf:
+		return parseSeq(r, depth, kindMap, v, parseMsgpack)
+	case 0xca:
+		return item{kind: kindFloat, f: float64(math.Float32frombits(uint32(v)))}, nil
+	case 0xcb:
+		return item{kind: kindFloat, f: math.Float64frombits(v)}, nil
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		return item{kind: kindUint, u: v}, nil
+	default:
+		// sign-extend the signed integer
+		shift := uint(64 - 8*size)
+		i := int64(v<<shift) >> shift
+		if i >= 0 {
+			return item{kind: kindUint, u: uint64(i)}, nil
+		}
+		return item{kind: kindInt, i: i}, nil
+	}
+}
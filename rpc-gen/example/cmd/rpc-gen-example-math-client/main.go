@@ -7,10 +7,11 @@ import (
 	"flag"
 	"fmt"
 	"io"
-	"net/url"
+	"log"
 	"os"
 	"strconv"
 
+	"github.com/niaow/exp/rpc-gen/codec"
 	"github.com/niaow/exp/rpc-gen/example/math"
 )
 
@@ -20,12 +21,18 @@ func main() {
 	var num uint64
 	var srv string
 	var rawdat string
-	flag.StringVar(&op, "op", "", "operation (add/divide/stats/sum/factor)")
+	flag.StringVar(&op, "op", "", "operation (add/divide/stats/sum/factor/runningsum/checksum/primes)")
 	flag.UintVar(&x, "x", 1, "first argument")
 	flag.UintVar(&y, "y", 1, "first argument")
 	flag.Uint64Var(&num, "n", 1, "a big-ish number")
 	flag.StringVar(&srv, "srv", "http://localhost:10000/", "server base URL")
 	flag.StringVar(&rawdat, "dat", "", "comma-seperated data set")
+	var table string
+	flag.StringVar(&table, "table", "ieee", "CRC-32 polynomial table")
+	var logCalls bool
+	flag.BoolVar(&logCalls, "log", false, "log operation calls")
+	var encoding string
+	flag.StringVar(&encoding, "encoding", "", "wire encoding (json/cbor/msgpack), defaulting to the encoding of each operation")
 	flag.Parse()
 	var parsedDat []float64
 	if rawdat != "" {
@@ -34,11 +41,33 @@ func main() {
 			panic(err)
 		}
 	}
-	u, err := url.Parse(srv)
+	var c codec.Codec
+	switch encoding {
+	case "":
+	case "json":
+		c = codec.JSON
+	case "cbor":
+		c = codec.CBOR
+	case "msgpack":
+		c = codec.MessagePack
+	default:
+		log.Fatalf("unknown encoding %q", encoding)
+	}
+	cli, err := math.NewMathClient(srv, math.ClientOptions{
+		UserAgent: "rpc-gen-example-math-client",
+		Codec:     c,
+	})
 	if err != nil {
 		panic(err)
 	}
-	cli := math.MathClient{Base: u}
+	if logCalls {
+		cli.Interceptors = append(cli.Interceptors, func(ctx context.Context, call *math.Call, invoke func(context.Context) error) error {
+			log.Printf("calling %s with %v", call.Op, call.Args)
+			err := invoke(ctx)
+			log.Printf("%s returned %v (err: %v)", call.Op, call.Results, err)
+			return err
+		})
+	}
 	switch op {
 	case "add":
 		sum, err := cli.Add(context.Background(), uint32(x), uint32(y))
@@ -82,6 +111,35 @@ func main() {
 		if err != nil {
 			panic(err)
 		}
+	case "runningsum":
+		lines := bufio.NewScanner(os.Stdin)
+		err := cli.RunningSum(context.Background(), func() (float64, error) {
+			if lines.Scan() {
+				return strconv.ParseFloat(lines.Text(), 64)
+			}
+			err := lines.Err()
+			if err != nil {
+				return 0, err
+			}
+			return 0, io.EOF
+		}, func(sum float64) error {
+			fmt.Printf("Running Sum: %f\n", sum)
+			return nil
+		})
+		if err != nil {
+			panic(err)
+		}
+	case "checksum":
+		sum, err := cli.Checksum(context.Background(), table, os.Stdin)
+		if err != nil {
+			panic(err)
+		}
+		fmt.Printf("%08x\n", sum)
+	case "primes":
+		err := cli.Primes(context.Background(), num, os.Stdout)
+		if err != nil {
+			panic(err)
+		}
 	default:
 		panic(fmt.Errorf("unrecognized operation %q", op))
 	}
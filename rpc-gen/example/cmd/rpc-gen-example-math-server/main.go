@@ -1,21 +1,29 @@
 package main
 
 import (
+	"bufio"
 	"context"
 	"flag"
+	"fmt"
+	"hash/crc32"
 	"io"
 	"net/http"
 
 	gomath "math"
 
 	"github.com/niaow/exp/rpc-gen/example/math"
+	"github.com/niaow/exp/rpc-gen/metrics"
 )
 
 func main() {
 	var addr string
 	flag.StringVar(&addr, "http", ":10000", "http server port")
 	flag.Parse()
-	http.ListenAndServe(addr, math.NewHTTPMathHandler(maff{}, nil))
+	var m metrics.Prometheus
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", &m)
+	mux.Handle("/", math.NewInstrumentedHTTPMathHandler(maff{}, nil, &m))
+	http.ListenAndServe(addr, mux)
 }
 
 type maff struct{}
@@ -83,3 +91,66 @@ func (m maff) Factor(ctx context.Context, num uint64, factors func(uint64) error
 	}
 	return nil
 }
+
+func (m maff) RunningSum(ctx context.Context, numbers func() (float64, error), sums func(float64) error) error {
+	sum := 0.0
+	for {
+		v, err := numbers()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		sum += v
+		if err := sums(sum); err != nil {
+			return err
+		}
+	}
+}
+
+func (m maff) Checksum(ctx context.Context, table string, data io.Reader) (uint32, error) {
+	var tab *crc32.Table
+	switch table {
+	case "ieee":
+		tab = crc32.IEEETable
+	case "castagnoli":
+		tab = crc32.MakeTable(crc32.Castagnoli)
+	case "koopman":
+		tab = crc32.MakeTable(crc32.Koopman)
+	default:
+		return 0, math.ErrUnknownTable{Table: table}
+	}
+	h := crc32.New(tab)
+	if _, err := io.Copy(h, data); err != nil {
+		return 0, err
+	}
+	return h.Sum32(), nil
+}
+
+func (m maff) Primes(ctx context.Context, limit uint64, table io.Writer) error {
+	w := bufio.NewWriter(table)
+	composite := make([]bool, limit+1)
+	for i := uint64(2); i <= limit; i++ {
+		if composite[i] {
+			continue
+		}
+		if _, err := fmt.Fprintln(w, i); err != nil {
+			return err
+		}
+		for j := i * i; j <= limit; j += i {
+			composite[j] = true
+		}
+	}
+	return w.Flush()
+}
+
+// Healthy reports that the server is alive, which it always is while it can respond.
+func (m maff) Healthy(ctx context.Context) error {
+	return nil
+}
+
+// Ready reports that the server is ready to do math, which needs no warming up.
+func (m maff) Ready(ctx context.Context) error {
+	return nil
+}
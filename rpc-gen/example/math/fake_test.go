@@ -0,0 +1,113 @@
+package math
+
+import (
+	"context"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"testing"
+)
+
+// newMathFake creates the fake implementation used by TestMathConformance.
+func newMathFake(t *testing.T) Math {
+	return fakeMath{}
+}
+
+// fakeMath is a simple implementation of Math.
+type fakeMath struct{}
+
+func (fakeMath) Add(ctx context.Context, X uint32, Y uint32) (uint32, error) {
+	return X + Y, nil
+}
+
+func (fakeMath) Divide(ctx context.Context, X uint32, Y uint32) (uint32, uint32, error) {
+	if Y == 0 {
+		return 0, 0, ErrDivideByZero{Dividend: X}
+	}
+	return X / Y, X % Y, nil
+}
+
+func (fakeMath) Statistics(ctx context.Context, Data []float64) (Stats, error) {
+	if len(Data) == 0 {
+		return Stats{}, ErrNoData{}
+	}
+	var sum float64
+	for _, v := range Data {
+		sum += v
+	}
+	return Stats{Mean: sum / float64(len(Data))}, nil
+}
+
+func (fakeMath) Sum(ctx context.Context, Numbers func() (float64, error)) (float64, error) {
+	var sum float64
+	for {
+		v, err := Numbers()
+		if err == io.EOF {
+			return sum, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		sum += v
+	}
+}
+
+func (fakeMath) Factor(ctx context.Context, Composite uint64, Factors func(uint64) error) error {
+	for i := uint64(2); i <= Composite; i++ {
+		if Composite%i == 0 {
+			if err := Factors(i); err != nil {
+				return err
+			}
+			for Composite%i == 0 {
+				Composite /= i
+			}
+		}
+	}
+	return nil
+}
+
+func (fakeMath) RunningSum(ctx context.Context, Numbers func() (float64, error), Sums func(float64) error) error {
+	var sum float64
+	for {
+		v, err := Numbers()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		sum += v
+		if err := Sums(sum); err != nil {
+			return err
+		}
+	}
+}
+
+func (fakeMath) Checksum(ctx context.Context, Table string, Data io.Reader) (uint32, error) {
+	if Table != "ieee" {
+		return 0, ErrUnknownTable{Table: Table}
+	}
+	h := crc32.NewIEEE()
+	if _, err := io.Copy(h, Data); err != nil {
+		return 0, err
+	}
+	return h.Sum32(), nil
+}
+
+func (fakeMath) Primes(ctx context.Context, Limit uint64, Table io.Writer) error {
+	for i := uint64(2); i <= Limit; i++ {
+		prime := true
+		for j := uint64(2); j*j <= i; j++ {
+			if i%j == 0 {
+				prime = false
+				break
+			}
+		}
+		if prime {
+			if _, err := fmt.Fprintln(Table, i); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -1,3 +1,4 @@
 package math
 
-//go:generate go run ../../gen.go -spec math.spec -tmpl ../../go.tmpl -o math.gen.go
+//go:generate go run ../..
+//go:generate go run ../.. -tmpl go-conformance
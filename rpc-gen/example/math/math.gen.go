@@ -1,23 +1,50 @@
+// rpc-gen input hash: 6c75679df5fddc7a9525c6231b52970430123ea9698afa63924211091c3f1e50
+
 package math
 
 import (
 	"bufio"
 	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/rand"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"mime/multipart"
+	"net"
 	"net/http"
 	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/niaow/exp/rpc-gen/codec"
+	"github.com/niaow/exp/rpc-gen/metrics"
+	"github.com/niaow/exp/ws"
 )
 
 var _ = bytes.NewReader
 var _ = sync.NewCond
 var _ = bufio.NewWriter
 var _ = io.Pipe
+var _ = ioutil.ReadAll
+var _ = net.Dial
+var _ = url.Parse
+var _ = multipart.NewWriter
+var _ = regexp.MustCompile
+var _ = strconv.Itoa
+var _ = strings.HasPrefix
+var _ = time.Second
+var _ = utf8.RuneCountInString
+var _ = rand.Reader
+var _ = codec.ByContentType
+var _ = gzip.NewReader
 
 // Math is a system to do math.
 type Math interface {
@@ -26,6 +53,7 @@ type Math interface {
 	// Y is the second number.
 	// Sum is the sum of the two numbers.
 	Add(ctx context.Context, X uint32, Y uint32) (Sum uint32, err error)
+
 	// Divides two numbers.
 	// X is the dividend.
 	// Y is the divisor.
@@ -33,28 +61,227 @@ type Math interface {
 	// Remainder is the remainder of the division.
 	// May return ErrDivideByZero.
 	Divide(ctx context.Context, X uint32, Y uint32) (Quotient uint32, Remainder uint32, err error)
+
 	// Statistics calculates summative statistics for a set of data
 	// Data is the data set to be summarized
 	// Results are the resulting summary statistics.
 	// May return ErrNoData.
 	Statistics(ctx context.Context, Data []float64) (Results Stats, err error)
+
 	// Sum adds a stream of numbers together.
 	// Numbers is the stream of numbers to sum.
 	// Result is the final sum.
 	Sum(ctx context.Context, Numbers func() (float64, error)) (Result float64, err error)
+
 	// Factor computes the prime factors of an integer.
 	// Composite is the number to factor.
 	// Factors are the prime factors found.
 	Factor(ctx context.Context, Composite uint64, Factors func(uint64) error) error
+
+	// RunningSum reports the cumulative sum after each number in a stream.
+	// Numbers is the stream of numbers to sum.
+	// Sums are the partial sums of the numbers received so far.
+	RunningSum(ctx context.Context, Numbers func() (float64, error), Sums func(float64) error) error
+
+	// Checksum computes the CRC-32 checksum of an uploaded file.
+	// Table is the polynomial to use (ieee, castagnoli, or koopman).
+	// Data is the file to checksum.
+	// Checksum is the resulting checksum.
+	// May return ErrUnknownTable.
+	Checksum(ctx context.Context, Table string, Data io.Reader) (Checksum uint32, err error)
+
+	// Primes downloads a table of prime numbers.
+	// Limit is the largest number to consider.
+	// Table is a newline-separated list of the primes up to the limit.
+	Primes(ctx context.Context, Limit uint64, Table io.Writer) error
+}
+
+// MockMath is a mock implementation of Math, intended for testing code which uses the interface.
+// Each operation records the call and then invokes the corresponding function field.
+// If the function field is nil, the operation fails with an error.
+type MockMath struct {
+	// AddFunc is invoked by Add.
+	AddFunc func(ctx context.Context, X uint32, Y uint32) (Sum uint32, err error)
+
+	// DivideFunc is invoked by Divide.
+	DivideFunc func(ctx context.Context, X uint32, Y uint32) (Quotient uint32, Remainder uint32, err error)
+
+	// StatisticsFunc is invoked by Statistics.
+	StatisticsFunc func(ctx context.Context, Data []float64) (Results Stats, err error)
+
+	// SumFunc is invoked by Sum.
+	SumFunc func(ctx context.Context, Numbers func() (float64, error)) (Result float64, err error)
+
+	// FactorFunc is invoked by Factor.
+	FactorFunc func(ctx context.Context, Composite uint64, Factors func(uint64) error) error
+
+	// RunningSumFunc is invoked by RunningSum.
+	RunningSumFunc func(ctx context.Context, Numbers func() (float64, error), Sums func(float64) error) error
+
+	// ChecksumFunc is invoked by Checksum.
+	ChecksumFunc func(ctx context.Context, Table string, Data io.Reader) (Checksum uint32, err error)
+
+	// PrimesFunc is invoked by Primes.
+	PrimesFunc func(ctx context.Context, Limit uint64, Table io.Writer) error
+
+	lock  sync.Mutex
+	calls []Call
+}
+
+var _ Math = (*MockMath)(nil)
+
+// recordCall records a call to the mock.
+func (m *MockMath) recordCall(call Call) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.calls = append(m.calls, call)
+}
+
+// MockCalls returns all calls recorded by the mock, in the order in which they were made.
+// The mock helpers are prefixed with Mock so that they cannot collide with the operations.
+func (m *MockMath) MockCalls() []Call {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return append([]Call(nil), m.calls...)
+}
+
+// MockCallsTo returns the calls recorded by the mock to the specified operation.
+func (m *MockMath) MockCallsTo(op string) []Call {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	var calls []Call
+	for _, c := range m.calls {
+		if c.Op == op {
+			calls = append(calls, c)
+		}
+	}
+	return calls
+}
+
+// MockReset clears the recorded calls.
+func (m *MockMath) MockReset() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.calls = nil
+}
+
+// Add records the call and invokes AddFunc.
+func (m *MockMath) Add(ctx context.Context, X uint32, Y uint32) (Sum uint32, err error) {
+	m.recordCall(Call{
+		Op: "Add",
+		Args: map[string]interface{}{
+			"X": X,
+			"Y": Y,
+		},
+	})
+	if m.AddFunc == nil {
+		return 0, errors.New("MockMath.AddFunc is not set")
+	}
+	return m.AddFunc(ctx, X, Y)
+}
+
+// Divide records the call and invokes DivideFunc.
+func (m *MockMath) Divide(ctx context.Context, X uint32, Y uint32) (Quotient uint32, Remainder uint32, err error) {
+	m.recordCall(Call{
+		Op: "Divide",
+		Args: map[string]interface{}{
+			"X": X,
+			"Y": Y,
+		},
+	})
+	if m.DivideFunc == nil {
+		return 0, 0, errors.New("MockMath.DivideFunc is not set")
+	}
+	return m.DivideFunc(ctx, X, Y)
+}
+
+// Statistics records the call and invokes StatisticsFunc.
+func (m *MockMath) Statistics(ctx context.Context, Data []float64) (Results Stats, err error) {
+	m.recordCall(Call{
+		Op: "Statistics",
+		Args: map[string]interface{}{
+			"Data": Data,
+		},
+	})
+	if m.StatisticsFunc == nil {
+		return Stats{}, errors.New("MockMath.StatisticsFunc is not set")
+	}
+	return m.StatisticsFunc(ctx, Data)
+}
+
+// Sum records the call and invokes SumFunc.
+func (m *MockMath) Sum(ctx context.Context, Numbers func() (float64, error)) (Result float64, err error) {
+	m.recordCall(Call{
+		Op:   "Sum",
+		Args: map[string]interface{}{},
+	})
+	if m.SumFunc == nil {
+		return 0.0, errors.New("MockMath.SumFunc is not set")
+	}
+	return m.SumFunc(ctx, Numbers)
+}
+
+// Factor records the call and invokes FactorFunc.
+func (m *MockMath) Factor(ctx context.Context, Composite uint64, Factors func(uint64) error) error {
+	m.recordCall(Call{
+		Op: "Factor",
+		Args: map[string]interface{}{
+			"Composite": Composite,
+		},
+	})
+	if m.FactorFunc == nil {
+		return errors.New("MockMath.FactorFunc is not set")
+	}
+	return m.FactorFunc(ctx, Composite, Factors)
+}
+
+// RunningSum records the call and invokes RunningSumFunc.
+func (m *MockMath) RunningSum(ctx context.Context, Numbers func() (float64, error), Sums func(float64) error) error {
+	m.recordCall(Call{
+		Op:   "RunningSum",
+		Args: map[string]interface{}{},
+	})
+	if m.RunningSumFunc == nil {
+		return errors.New("MockMath.RunningSumFunc is not set")
+	}
+	return m.RunningSumFunc(ctx, Numbers, Sums)
+}
+
+// Checksum records the call and invokes ChecksumFunc.
+func (m *MockMath) Checksum(ctx context.Context, Table string, Data io.Reader) (Checksum uint32, err error) {
+	m.recordCall(Call{
+		Op: "Checksum",
+		Args: map[string]interface{}{
+			"Table": Table,
+		},
+	})
+	if m.ChecksumFunc == nil {
+		return 0, errors.New("MockMath.ChecksumFunc is not set")
+	}
+	return m.ChecksumFunc(ctx, Table, Data)
+}
+
+// Primes records the call and invokes PrimesFunc.
+func (m *MockMath) Primes(ctx context.Context, Limit uint64, Table io.Writer) error {
+	m.recordCall(Call{
+		Op: "Primes",
+		Args: map[string]interface{}{
+			"Limit": Limit,
+		},
+	})
+	if m.PrimesFunc == nil {
+		return errors.New("MockMath.PrimesFunc is not set")
+	}
+	return m.PrimesFunc(ctx, Limit, Table)
 }
 
 // Stats is a set of summative statistics.
 type Stats struct {
 	// Mean is the average of the data in the set
-	Mean float64 `json:"Mean,omitempty"`
+	Mean float64 `json:"Mean"`
 
 	// Stdev is the standard deviation of the data in the set
-	Stdev float64 `json:"Stdev,omitempty"`
+	Stdev float64 `json:"Stdev"`
 }
 
 // ErrDivideByZero is an error resulting from a division with a zero divisor.
@@ -68,6 +295,28 @@ type ErrDivideByZero struct {
 // This corresponds to the HTTP status code 400 "Bad Request".
 type ErrNoData struct{}
 
+// ErrUnknownTable is an error indicating that the requested CRC-32 polynomial is not supported.
+// This corresponds to the HTTP status code 400 "Bad Request".
+type ErrUnknownTable struct {
+	// Table is the name of the requested table.
+	Table string `json:"Table,omitempty"`
+}
+
+// ErrorCode is a machine-readable code identifying an error, which is independent of the HTTP status.
+type ErrorCode string
+
+// Codes of the errors declared by the spec.
+const (
+	// ErrDivideByZeroCode is the code of ErrDivideByZero.
+	ErrDivideByZeroCode ErrorCode = "DIVIDE_BY_ZERO"
+
+	// ErrNoDataCode is the code of ErrNoData.
+	ErrNoDataCode ErrorCode = "NO_DATA"
+
+	// ErrUnknownTableCode is the code of ErrUnknownTable.
+	ErrUnknownTableCode ErrorCode = "UNKNOWN_TABLE"
+)
+
 func (err ErrDivideByZero) Error() string {
 	dat, merr := json.Marshal(err)
 	if merr != nil {
@@ -81,12 +330,22 @@ func (err ErrNoData) Error() string {
 	return "no data provided"
 }
 
+func (err ErrUnknownTable) Error() string {
+	dat, merr := json.Marshal(err)
+	if merr != nil {
+		return "unknown CRC-32 table"
+	}
+
+	return fmt.Sprintf("%s (%s)", "unknown CRC-32 table", string(dat[1:len(dat)-1]))
+}
+
 // rpcError is a container used to transmit errors across http.
 type rpcError struct {
-	Message string      `json:"message"`
-	Type    string      `json:"type,omitempty"`
-	Data    interface{} `json:"dat,omitempty"`
-	Code    int         `json:"-"`
+	Message   string      `json:"message"`
+	Type      string      `json:"type,omitempty"`
+	Data      interface{} `json:"dat,omitempty"`
+	ErrorCode ErrorCode   `json:"code,omitempty"`
+	Code      int         `json:"-"`
 }
 
 func (re rpcError) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -97,204 +356,796 @@ func (re rpcError) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	http.Error(w, msg, re.Code)
 }
 
+// rpcError converts the error into a transferrable container.
+func (err ErrDivideByZero) rpcError() rpcError {
+	return rpcError{
+		Message:   err.Error(),
+		Type:      "ErrDivideByZero",
+		Data:      err,
+		ErrorCode: ErrDivideByZeroCode,
+		Code:      http.StatusBadRequest,
+	}
+}
+
+// ErrorCode returns the machine-readable code of the error.
+func (err ErrDivideByZero) ErrorCode() ErrorCode {
+	return ErrDivideByZeroCode
+}
+
 // ServeHTTP sends the error over HTTP.
 func (err ErrDivideByZero) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	rpcError{
-		Message: err.Error(),
-		Type:    "ErrDivideByZero",
-		Data:    err,
-		Code:    http.StatusBadRequest,
-	}.ServeHTTP(w, r)
+	err.rpcError().ServeHTTP(w, r)
+}
+
+// rpcError converts the error into a transferrable container.
+func (err ErrNoData) rpcError() rpcError {
+	return rpcError{
+		Message:   err.Error(),
+		Type:      "ErrNoData",
+		Data:      err,
+		ErrorCode: ErrNoDataCode,
+		Code:      http.StatusBadRequest,
+	}
+}
+
+// ErrorCode returns the machine-readable code of the error.
+func (err ErrNoData) ErrorCode() ErrorCode {
+	return ErrNoDataCode
 }
 
 // ServeHTTP sends the error over HTTP.
 func (err ErrNoData) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	rpcError{
+	err.rpcError().ServeHTTP(w, r)
+}
+
+// rpcError converts the error into a transferrable container.
+func (err ErrUnknownTable) rpcError() rpcError {
+	return rpcError{
+		Message:   err.Error(),
+		Type:      "ErrUnknownTable",
+		Data:      err,
+		ErrorCode: ErrUnknownTableCode,
+		Code:      http.StatusBadRequest,
+	}
+}
+
+// ErrorCode returns the machine-readable code of the error.
+func (err ErrUnknownTable) ErrorCode() ErrorCode {
+	return ErrUnknownTableCode
+}
+
+// ServeHTTP sends the error over HTTP.
+func (err ErrUnknownTable) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	err.rpcError().ServeHTTP(w, r)
+}
+
+// ValidationError is an error indicating that a request did not satisfy the constraints of the spec.
+// This corresponds to the HTTP status code 400 "Bad Request".
+type ValidationError struct {
+	// Field is the path of the invalid argument or field.
+	Field string `json:"field"`
+
+	// Reason is a description of the constraint which was not satisfied.
+	Reason string `json:"reason"`
+}
+
+func (err ValidationError) Error() string {
+	return fmt.Sprintf("invalid %s: %s", err.Field, err.Reason)
+}
+
+// rpcError converts the error into a transferrable container.
+func (err ValidationError) rpcError() rpcError {
+	return rpcError{
 		Message: err.Error(),
-		Type:    "ErrNoData",
+		Type:    "ValidationError",
 		Data:    err,
 		Code:    http.StatusBadRequest,
-	}.ServeHTTP(w, r)
+	}
 }
 
-// httpMathHandler is a wrapper around Math that implements http.Handler.
-type httpMathHandler struct {
-	impl         Math
-	ctxTransform func(context.Context, *http.Request) (context.Context, context.CancelFunc, error)
-	mux          *http.ServeMux
+// ServeHTTP sends the error over HTTP.
+func (err ValidationError) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	err.rpcError().ServeHTTP(w, r)
 }
 
-type trackWriter struct {
-	wrote bool
-	w     io.Writer
+// within prefixes the field path of the error with the path of the enclosing value.
+func (err *ValidationError) within(path string) *ValidationError {
+	if strings.HasPrefix(err.Field, "[") {
+		err.Field = path + err.Field
+	} else {
+		err.Field = path + "." + err.Field
+	}
+	return err
 }
 
-func (tw *trackWriter) Write(p []byte) (int, error) {
-	tw.wrote = true
-	return tw.w.Write(p)
+// TimeoutError is an error indicating that an operation did not complete within its timeout.
+// This corresponds to the HTTP status code 504 "Gateway Timeout".
+type TimeoutError struct {
+	// Op is the name of the operation.
+	Op string `json:"op"`
+
+	// Timeout is the timeout of the operation.
+	Timeout string `json:"timeout"`
 }
 
-// handleAdd wraps the implementation's Add operation and bridges it to HTTP.
-func (h httpMathHandler) handleAdd(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		rpcError{
-			Message: fmt.Sprintf("unsupported method %q, please use %q", r.Method, http.MethodPost),
-			Code:    http.StatusMethodNotAllowed,
-		}.ServeHTTP(w, r)
-		return
-	}
+func (err TimeoutError) Error() string {
+	return fmt.Sprintf("%s timed out after %s", err.Op, err.Timeout)
+}
 
-	var args struct {
-		X uint32 `json:"X,omitempty"`
-		Y uint32 `json:"Y,omitempty"`
+// rpcError converts the error into a transferrable container.
+func (err TimeoutError) rpcError() rpcError {
+	return rpcError{
+		Message: err.Error(),
+		Type:    "TimeoutError",
+		Data:    err,
+		Code:    http.StatusGatewayTimeout,
 	}
+}
 
-	q := r.URL.Query()
-	switch len(q["X"]) {
-	case 0:
-	case 1:
-		if err := json.Unmarshal([]byte(q["X"][0]), &args.X); err != nil {
-			rpcError{
-				Message: err.Error(),
-				Code:    http.StatusBadRequest,
-			}.ServeHTTP(w, r)
-			return
-		}
-	default:
-		rpcError{
-			Message: "argument \"X\" duplicated",
-			Code:    http.StatusBadRequest,
-		}.ServeHTTP(w, r)
-		return
+// ServeHTTP sends the error over HTTP.
+func (err TimeoutError) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	err.rpcError().ServeHTTP(w, r)
+}
+
+// callOutcome describes the outcome of a call for metrics and tracing.
+// Errors declared in the spec are identified by their type names, and other errors are reported as "error".
+func callOutcome(err error) string {
+	if err == nil {
+		return "ok"
 	}
-	switch len(q["Y"]) {
-	case 0:
-	case 1:
-		if err := json.Unmarshal([]byte(q["Y"][0]), &args.Y); err != nil {
-			rpcError{
-				Message: err.Error(),
-				Code:    http.StatusBadRequest,
-			}.ServeHTTP(w, r)
-			return
-		}
-	default:
-		rpcError{
-			Message: "argument \"Y\" duplicated",
-			Code:    http.StatusBadRequest,
-		}.ServeHTTP(w, r)
-		return
+	var rerr interface{ rpcError() rpcError }
+	if errors.As(err, &rerr) {
+		return rerr.rpcError().Type
 	}
+	return "error"
+}
 
-	ctx := r.Context()
-	ctx, cancel := context.WithCancel(ctx)
-	defer cancel()
-	if h.ctxTransform != nil {
-		tctx, tcancel, err := h.ctxTransform(ctx, r)
-		if err != nil {
-			rpcError{
-				Message: err.Error(),
-				Code:    http.StatusBadRequest,
-			}.ServeHTTP(w, r)
-			return
-		}
-		defer tcancel()
-		ctx = tctx
-	}
+// Metadata is a set of key/value pairs which is sent alongside calls, such as a trace ID or a tenant ID.
+// The keys are canonicalized in the same way as HTTP header names.
+// Each pair is transmitted as an HTTP header named with the key prefixed by "X-RPC-Meta-".
+type Metadata map[string]string
 
-	var outputs struct {
-		Sum uint32 `json:"Sum,omitempty"`
-	}
+// metadataHeaderPrefix is the canonical prefix of the HTTP headers used to transmit metadata.
+const metadataHeaderPrefix = "X-Rpc-Meta-"
 
-	var err error
-	outputs.Sum, err = h.impl.Add(ctx, args.X, args.Y)
-	if err != nil {
-		rpcError{
-			Message: err.Error(),
-			Code:    http.StatusInternalServerError,
-		}.ServeHTTP(w, r)
-		return
+// metadataKey is the context key used to store Metadata.
+type metadataKey struct{}
+
+// WithMetadata returns a copy of the context with the metadata attached.
+// The metadata is merged with any metadata attached to the parent context, replacing entries with the same keys.
+// Clients send the metadata attached to the context of a call, and servers attach the received metadata to the context of the operation.
+func WithMetadata(ctx context.Context, md Metadata) context.Context {
+	merged := Metadata{}
+	for k, v := range MetadataFromContext(ctx) {
+		merged[k] = v
 	}
+	for k, v := range md {
+		merged[http.CanonicalHeaderKey(k)] = v
+	}
+	return context.WithValue(ctx, metadataKey{}, merged)
+}
 
-	json.NewEncoder(w).Encode(outputs)
+// MetadataFromContext returns the metadata attached to the context.
+// The returned map must not be modified.
+func MetadataFromContext(ctx context.Context) Metadata {
+	md, _ := ctx.Value(metadataKey{}).(Metadata)
+	return md
 }
 
-// handleDivide wraps the implementation's Divide operation and bridges it to HTTP.
-func (h httpMathHandler) handleDivide(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		rpcError{
-			Message: fmt.Sprintf("unsupported method %q, please use %q", r.Method, http.MethodPost),
-			Code:    http.StatusMethodNotAllowed,
-		}.ServeHTTP(w, r)
-		return
+// setMetadataHeaders adds the metadata attached to the context to a set of HTTP headers.
+func setMetadataHeaders(ctx context.Context, h http.Header) {
+	for k, v := range MetadataFromContext(ctx) {
+		h.Set(metadataHeaderPrefix+k, v)
 	}
+}
 
-	var args struct {
-		X uint32 `json:"X,omitempty"`
-		Y uint32 `json:"Y,omitempty"`
+// metadataContext attaches the metadata sent in a request to the context.
+func metadataContext(ctx context.Context, r *http.Request) context.Context {
+	var md Metadata
+	for k, v := range r.Header {
+		if !strings.HasPrefix(k, metadataHeaderPrefix) || len(k) == len(metadataHeaderPrefix) || len(v) == 0 {
+			continue
+		}
+		if md == nil {
+			md = Metadata{}
+		}
+		md[k[len(metadataHeaderPrefix):]] = v[0]
 	}
-
-	if err := json.NewDecoder(r.Body).Decode(&args); err != nil {
-		rpcError{
-			Message: err.Error(),
-			Code:    http.StatusBadRequest,
-		}.ServeHTTP(w, r)
-		return
+	if md == nil {
+		return ctx
 	}
+	return WithMetadata(ctx, md)
+}
 
-	ctx := r.Context()
-	ctx, cancel := context.WithCancel(ctx)
-	defer cancel()
-	if h.ctxTransform != nil {
-		tctx, tcancel, err := h.ctxTransform(ctx, r)
-		if err != nil {
-			rpcError{
-				Message: err.Error(),
-				Code:    http.StatusBadRequest,
-			}.ServeHTTP(w, r)
-			return
-		}
-		defer tcancel()
-		ctx = tctx
-	}
+// validationPatterns are the compiled patterns used to validate string arguments.
+var validationPatterns = map[string]*regexp.Regexp{
+	"^[a-z]+$": regexp.MustCompile("^[a-z]+$"),
+}
 
-	var outputs struct {
-		Quotient  uint32 `json:"Quotient,omitempty"`
-		Remainder uint32 `json:"Remainder,omitempty"`
+// validateMathStatistics checks that the inputs to Math.Statistics satisfy the constraints of the spec.
+func validateMathStatistics(Data []float64) *ValidationError {
+	if len(Data) > 1000000 {
+		return &ValidationError{Field: "Data", Reason: "must have at most 1000000 elements"}
 	}
 
-	var err error
-	outputs.Quotient, outputs.Remainder, err = h.impl.Divide(ctx, args.X, args.Y)
-	if err != nil {
-		switch e := err.(type) {
-		case ErrDivideByZero:
-			e.ServeHTTP(w, r)
-		default:
-			rpcError{
-				Message: err.Error(),
-				Code:    http.StatusInternalServerError,
-			}.ServeHTTP(w, r)
-		}
-		return
+	return nil
+}
+
+// validateMathChecksum checks that the inputs to Math.Checksum satisfy the constraints of the spec.
+func validateMathChecksum(Table string) *ValidationError {
+	if len(Table) != 0 && !validationPatterns["^[a-z]+$"].MatchString(string(Table)) {
+		return &ValidationError{Field: "Table", Reason: "must match pattern \"^[a-z]+$\""}
 	}
 
-	json.NewEncoder(w).Encode(outputs)
+	return nil
 }
 
-// handleStatistics wraps the implementation's Statistics operation and bridges it to HTTP.
-func (h httpMathHandler) handleStatistics(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		rpcError{
-			Message: fmt.Sprintf("unsupported method %q, please use %q", r.Method, http.MethodPost),
-			Code:    http.StatusMethodNotAllowed,
-		}.ServeHTTP(w, r)
-		return
+// validateMathPrimes checks that the inputs to Math.Primes satisfy the constraints of the spec.
+func validateMathPrimes(Limit uint64) *ValidationError {
+	if Limit > 100000000 {
+		return &ValidationError{Field: "Limit", Reason: "must be at most 100000000"}
+	}
+
+	return nil
+}
+
+// ndjsonContentType is the content type of streams of newline-delimited JSON frames.
+const ndjsonContentType = "application/x-ndjson"
+
+// streamFrame is a control or data message in a stream of frames.
+// Stream elements are sent as JSON in the Value field.
+// The stream is terminated by a frame which either sets End or carries an error.
+// Byte stream chunks of duplex operations are sent as binary frames over a WebSocket, and in the Data field over HTTP/2.
+type streamFrame struct {
+	Value json.RawMessage `json:"value,omitempty"`
+	Data  []byte          `json:"data,omitempty"`
+	Error json.RawMessage `json:"error,omitempty"`
+	End   bool            `json:"end,omitempty"`
+}
+
+// duplexConn is a connection carrying the streams of a duplex operation.
+// Frames may be sent and read concurrently.
+type duplexConn interface {
+	// ReadFrame reads the next frame.
+	// A chunk of a byte stream is read into the Data field, which is non-nil.
+	ReadFrame(frame *streamFrame) error
+
+	// SendFrame sends a control message or stream element.
+	SendFrame(frame streamFrame) error
+
+	// SendBytes sends a chunk of a byte stream.
+	SendBytes(p []byte) error
+
+	// Finish waits for the peer to acknowledge the end of the call.
+	Finish()
+
+	// Abort tears down the connection immediately.
+	Abort()
+}
+
+// wsDuplex carries a duplex operation over a WebSocket.
+type wsDuplex struct {
+	c *ws.Conn
+}
+
+func (d wsDuplex) ReadFrame(frame *streamFrame) error {
+	f, err := d.c.NextFrame()
+	if err != nil {
+		return err
+	}
+	switch f {
+	case ws.TextFrame:
+		return d.c.ReadJSON(frame)
+	case ws.BinaryFrame:
+		dat, err := ioutil.ReadAll(d.c)
+		if err != nil {
+			return err
+		}
+		if dat == nil {
+			dat = []byte{}
+		}
+		frame.Data = dat
+		return nil
+	default:
+		return errors.New("unexpected frame type")
+	}
+}
+
+func (d wsDuplex) SendFrame(frame streamFrame) error {
+	return d.c.SendJSON(frame)
+}
+
+func (d wsDuplex) SendBytes(p []byte) error {
+	return d.c.SendBinary(p)
+}
+
+func (d wsDuplex) Finish() {
+	cctx, ccancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer ccancel()
+	d.c.CloseRead(cctx, 1000, "")
+}
+
+func (d wsDuplex) Abort() {
+	d.c.ForceClose()
+}
+
+// httpDuplex carries a duplex operation over an HTTP/2 request and response, as newline-delimited JSON frames.
+// The frames are flushed as they are sent, so the request and response bodies are streamed concurrently.
+type httpDuplex struct {
+	mu    sync.Mutex
+	enc   *json.Encoder
+	flush func()
+	dec   *json.Decoder
+	abort func()
+}
+
+func (d *httpDuplex) ReadFrame(frame *streamFrame) error {
+	err := d.dec.Decode(frame)
+	if err == nil && frame.Value == nil && frame.Error == nil && !frame.End && frame.Data == nil {
+		frame.Data = []byte{}
+	}
+	return err
+}
+
+func (d *httpDuplex) SendFrame(frame streamFrame) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := d.enc.Encode(frame); err != nil {
+		return err
+	}
+	d.flush()
+	return nil
+}
+
+func (d *httpDuplex) SendBytes(p []byte) error {
+	return d.SendFrame(streamFrame{Data: p})
+}
+
+func (d *httpDuplex) Finish() {}
+
+func (d *httpDuplex) Abort() {
+	d.abort()
+}
+
+// duplexByteReader reads a byte stream sent as a series of chunks.
+// The message terminating the stream is stored in final.
+type duplexByteReader struct {
+	c     duplexConn
+	buf   []byte
+	done  bool
+	final streamFrame
+}
+
+func (r *duplexByteReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+		var frame streamFrame
+		if err := r.c.ReadFrame(&frame); err != nil {
+			return 0, err
+		}
+		switch {
+		case frame.End || frame.Error != nil:
+			r.final = frame
+			r.done = true
+		case frame.Data != nil:
+			r.buf = frame.Data
+		default:
+			return 0, errors.New("unexpected message in byte stream")
+		}
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+// duplexByteWriter writes a byte stream as a series of chunks.
+type duplexByteWriter struct {
+	c duplexConn
+}
+
+func (w duplexByteWriter) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if err := w.c.SendBytes(p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// queryAdd adds a JSON-encoded value to a set of query parameters.
+func queryAdd(q url.Values, key string, v interface{}) error {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	q.Add(key, string(raw))
+	return nil
+}
+
+// queryValue decodes the value of a query parameter.
+// If the parameter is missing, dst is left unchanged.
+func queryValue(q url.Values, key string, dst interface{}) error {
+	switch vals := q[key]; len(vals) {
+	case 0:
+		return nil
+	case 1:
+		return queryDecode(key, vals[0], dst)
+	default:
+		return fmt.Errorf("argument %q duplicated", key)
+	}
+}
+
+// queryDecode decodes a JSON-encoded query parameter value.
+// Values which are JSON strings may also be sent unquoted.
+func queryDecode(key string, raw string, dst interface{}) error {
+	err := json.Unmarshal([]byte(raw), dst)
+	if err != nil {
+		quoted, _ := json.Marshal(raw)
+		if json.Unmarshal(quoted, dst) == nil {
+			return nil
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("argument %q: %w", key, err)
+	}
+	return nil
+}
+
+// queryLen finds the length of an array sent in bracket notation, from the largest index of its elements.
+// Each element must be sent with at least one parameter, so indices are limited by the number of parameters.
+func queryLen(q url.Values, key string) (int, error) {
+	n := 0
+	for k := range q {
+		if !strings.HasPrefix(k, key+"[") {
+			continue
+		}
+		idx := k[len(key)+1:]
+		end := strings.IndexByte(idx, ']')
+		if end < 0 {
+			continue
+		}
+		i, err := strconv.Atoi(idx[:end])
+		if err != nil || i < 0 || i >= len(q) {
+			return 0, fmt.Errorf("argument %q has an invalid index", k)
+		}
+		if i >= n {
+			n = i + 1
+		}
+	}
+	return n, nil
+}
+
+// Call describes an operation invocation, as seen by client call interceptors and recorded by mocks.
+type Call struct {
+	// Op is the name of the operation.
+	Op string
+
+	// Args are the inputs to the operation, keyed by name.
+	// Streamed inputs are not included.
+	Args map[string]interface{}
+
+	// Results are the outputs of the operation, keyed by name.
+	// This is populated once the operation completes successfully, and never includes streamed outputs.
+	Results map[string]interface{}
+}
+
+type trackWriter struct {
+	wrote bool
+	w     io.Writer
+}
+
+func (tw *trackWriter) Write(p []byte) (int, error) {
+	tw.wrote = true
+	return tw.w.Write(p)
+}
+
+// decodeCodecArgs decodes the arguments of a request.
+// A binary encoding is used if it matches the Content-Type of the request, and JSON is used otherwise.
+func decodeCodecArgs(r *http.Request, args interface{}) error {
+	c, ok := codec.ByContentType(r.Header.Get("Content-Type"))
+	if !ok {
+		return json.NewDecoder(r.Body).Decode(args)
+	}
+	dat, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+	return c.Unmarshal(dat, args)
+}
+
+// encodeCodecOutputs writes the outputs of a response.
+// The first binary encoding accepted by the client is used, unless JSON is accepted before it.
+// JSON is used if the client does not accept a binary encoding.
+func encodeCodecOutputs(w http.ResponseWriter, r *http.Request, outputs interface{}) {
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		c, ok := codec.ByContentType(accept)
+		if !ok {
+			if mt := strings.TrimSpace(strings.SplitN(accept, ";", 2)[0]); strings.EqualFold(mt, "application/json") {
+				break
+			}
+			continue
+		}
+		dat, err := c.Marshal(outputs)
+		if err != nil {
+			rpcError{
+				Message: err.Error(),
+				Code:    http.StatusInternalServerError,
+			}.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", c.ContentType())
+		writeGzip(w, r, dat)
+		return
+	}
+	writeGzipJSON(w, r, outputs)
+}
+
+// gzipThreshold is the minimum size in bytes of a request or response body which is compressed with gzip.
+const gzipThreshold = 1024
+
+// acceptsGzip checks whether the client accepts gzip-encoded responses.
+func acceptsGzip(r *http.Request) bool {
+	for _, enc := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		params := strings.Split(enc, ";")
+		if !strings.EqualFold(strings.TrimSpace(params[0]), "gzip") {
+			continue
+		}
+		for _, p := range params[1:] {
+			if q := strings.TrimSpace(p); strings.HasPrefix(q, "q=0") && strings.Trim(q[len("q=0"):], ".0") == "" {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// writeGzip writes a response body.
+// The body is compressed with gzip if it reaches gzipThreshold and the client accepts it.
+func writeGzip(w http.ResponseWriter, r *http.Request, dat []byte) {
+	w.Header().Add("Vary", "Accept-Encoding")
+	if len(dat) < gzipThreshold || !acceptsGzip(r) {
+		w.Write(dat)
+		return
+	}
+	w.Header().Set("Content-Encoding", "gzip")
+	gz := gzip.NewWriter(w)
+	gz.Write(dat)
+	gz.Close()
+}
+
+// writeGzipJSON writes a JSON response body with writeGzip.
+func writeGzipJSON(w http.ResponseWriter, r *http.Request, v interface{}) {
+	dat, err := json.Marshal(v)
+	if err != nil {
+		rpcError{
+			Message: err.Error(),
+			Code:    http.StatusInternalServerError,
+		}.ServeHTTP(w, r)
+		return
+	}
+	writeGzip(w, r, append(dat, '\n'))
+}
+
+// HealthChecker reports the health of a service to the health and readiness endpoints of generated handlers.
+// It must be safe for concurrent use.
+type HealthChecker interface {
+	// Healthy checks whether the service is alive, and is served at "/_health".
+	// A service which is not healthy should be restarted.
+	Healthy(ctx context.Context) error
+
+	// Ready checks whether the service is ready to handle calls, and is served at "/_ready".
+	// A service which is not ready should not be sent calls, but may recover without being restarted.
+	Ready(ctx context.Context) error
+}
+
+// serveHealth serves a health or readiness endpoint.
+// A passing check responds with a JSON status, and a failing check responds with an error.
+// Errors declared in the spec are sent as-is, and other errors are sent with the 503 Service Unavailable status.
+func serveHealth(w http.ResponseWriter, r *http.Request, check func(context.Context) error) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		rpcError{
+			Message: fmt.Sprintf("unsupported method %q, please use %q", r.Method, http.MethodGet),
+			Code:    http.StatusMethodNotAllowed,
+		}.ServeHTTP(w, r)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	if err := check(r.Context()); err != nil {
+		var rerr interface{ rpcError() rpcError }
+		if errors.As(err, &rerr) {
+			rerr.rpcError().ServeHTTP(w, r)
+			return
+		}
+		rpcError{
+			Message: err.Error(),
+			Code:    http.StatusServiceUnavailable,
+		}.ServeHTTP(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if r.Method != http.MethodHead {
+		io.WriteString(w, "{\"status\":\"ok\"}\n")
+	}
+}
+
+// httpMathHandler is a wrapper around Math that implements http.Handler.
+type httpMathHandler struct {
+	impl         Math
+	ctxTransform func(context.Context, *http.Request) (context.Context, context.CancelFunc, error)
+	mux          *http.ServeMux
+	collector    metrics.Collector
+}
+
+// observe reports a call to the collector, if there is one.
+func (h httpMathHandler) observe(op string, start time.Time, outcome *string) {
+	if h.collector == nil {
+		return
+	}
+	h.collector.ObserveCall(metrics.Observation{
+		System:   "Math",
+		Op:       op,
+		Side:     metrics.Server,
+		Outcome:  *outcome,
+		Duration: time.Since(start),
+	})
+}
+
+// handleAdd wraps the implementation's Add operation and bridges it to HTTP.
+func (h httpMathHandler) handleAdd(w http.ResponseWriter, r *http.Request) {
+	outcome := "rejected"
+	defer h.observe("Add", time.Now(), &outcome)
+	if r.Method != http.MethodPost {
+		rpcError{
+			Message: fmt.Sprintf("unsupported method %q, please use %q", r.Method, http.MethodPost),
+			Code:    http.StatusMethodNotAllowed,
+		}.ServeHTTP(w, r)
+		return
+	}
+
+	var args struct {
+		X uint32 `json:"X,omitempty"`
+		Y uint32 `json:"Y,omitempty"`
+	}
+
+	q := r.URL.Query()
+	if err := func() error {
+		if err := queryValue(q, "X", &args.X); err != nil {
+			return err
+		}
+		if err := queryValue(q, "Y", &args.Y); err != nil {
+			return err
+		}
+
+		return nil
+	}(); err != nil {
+		rpcError{
+			Message: err.Error(),
+			Code:    http.StatusBadRequest,
+		}.ServeHTTP(w, r)
+		return
+	}
+
+	ctx := metadataContext(r.Context(), r)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	if h.ctxTransform != nil {
+		tctx, tcancel, err := h.ctxTransform(ctx, r)
+		if err != nil {
+			rpcError{
+				Message: err.Error(),
+				Code:    http.StatusBadRequest,
+			}.ServeHTTP(w, r)
+			return
+		}
+		defer tcancel()
+		ctx = tctx
+	}
+
+	var outputs struct {
+		Sum uint32 `json:"Sum"`
+	}
+
+	var err error
+	outputs.Sum, err = h.impl.Add(ctx, args.X, args.Y)
+	outcome = callOutcome(err)
+	if err != nil {
+		rpcError{
+			Message: err.Error(),
+			Code:    http.StatusInternalServerError,
+		}.ServeHTTP(w, r)
+		return
+	}
+
+	encodeCodecOutputs(w, r, outputs)
+}
+
+// handleDivide wraps the implementation's Divide operation and bridges it to HTTP.
+func (h httpMathHandler) handleDivide(w http.ResponseWriter, r *http.Request) {
+	outcome := "rejected"
+	defer h.observe("Divide", time.Now(), &outcome)
+	if r.Method != http.MethodPost {
+		rpcError{
+			Message: fmt.Sprintf("unsupported method %q, please use %q", r.Method, http.MethodPost),
+			Code:    http.StatusMethodNotAllowed,
+		}.ServeHTTP(w, r)
+		return
+	}
+
+	var args struct {
+		X uint32 `json:"X,omitempty"`
+		Y uint32 `json:"Y,omitempty"`
+	}
+
+	if err := decodeCodecArgs(r, &args); err != nil {
+		rpcError{
+			Message: err.Error(),
+			Code:    http.StatusBadRequest,
+		}.ServeHTTP(w, r)
+		return
+	}
+
+	ctx := metadataContext(r.Context(), r)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	if h.ctxTransform != nil {
+		tctx, tcancel, err := h.ctxTransform(ctx, r)
+		if err != nil {
+			rpcError{
+				Message: err.Error(),
+				Code:    http.StatusBadRequest,
+			}.ServeHTTP(w, r)
+			return
+		}
+		defer tcancel()
+		ctx = tctx
+	}
+
+	var outputs struct {
+		Quotient  uint32 `json:"Quotient"`
+		Remainder uint32 `json:"Remainder"`
+	}
+
+	var err error
+	outputs.Quotient, outputs.Remainder, err = h.impl.Divide(ctx, args.X, args.Y)
+	outcome = callOutcome(err)
+	if err != nil {
+		switch e := err.(type) {
+		case ErrDivideByZero:
+			e.ServeHTTP(w, r)
+		default:
+			rpcError{
+				Message: err.Error(),
+				Code:    http.StatusInternalServerError,
+			}.ServeHTTP(w, r)
+		}
+		return
+	}
+
+	encodeCodecOutputs(w, r, outputs)
+}
+
+// handleStatistics wraps the implementation's Statistics operation and bridges it to HTTP.
+func (h httpMathHandler) handleStatistics(w http.ResponseWriter, r *http.Request) {
+	outcome := "rejected"
+	defer h.observe("Statistics", time.Now(), &outcome)
+	if r.Method != http.MethodPost {
+		rpcError{
+			Message: fmt.Sprintf("unsupported method %q, please use %q", r.Method, http.MethodPost),
+			Code:    http.StatusMethodNotAllowed,
+		}.ServeHTTP(w, r)
+		return
 	}
 
 	var args struct {
 		Data []float64 `json:"Data,omitempty"`
 	}
 
-	if err := json.NewDecoder(r.Body).Decode(&args); err != nil {
+	if err := decodeCodecArgs(r, &args); err != nil {
 		rpcError{
 			Message: err.Error(),
 			Code:    http.StatusBadRequest,
@@ -302,7 +1153,13 @@ func (h httpMathHandler) handleStatistics(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	ctx := r.Context()
+	if verr := validateMathStatistics(args.Data); verr != nil {
+		outcome = "ValidationError"
+		verr.ServeHTTP(w, r)
+		return
+	}
+
+	ctx := metadataContext(r.Context(), r)
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 	if h.ctxTransform != nil {
@@ -324,6 +1181,7 @@ func (h httpMathHandler) handleStatistics(w http.ResponseWriter, r *http.Request
 
 	var err error
 	outputs.Results, err = h.impl.Statistics(ctx, args.Data)
+	outcome = callOutcome(err)
 	if err != nil {
 		switch e := err.(type) {
 		case ErrNoData:
@@ -337,11 +1195,13 @@ func (h httpMathHandler) handleStatistics(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	json.NewEncoder(w).Encode(outputs)
+	encodeCodecOutputs(w, r, outputs)
 }
 
 // handleSum wraps the implementation's Sum operation and bridges it to HTTP.
 func (h httpMathHandler) handleSum(w http.ResponseWriter, r *http.Request) {
+	outcome := "rejected"
+	defer h.observe("Sum", time.Now(), &outcome)
 	if r.Method != http.MethodPost {
 		rpcError{
 			Message: fmt.Sprintf("unsupported method %q, please use %q", r.Method, http.MethodPost),
@@ -350,7 +1210,7 @@ func (h httpMathHandler) handleSum(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ctx := r.Context()
+	ctx := metadataContext(r.Context(), r)
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 	if h.ctxTransform != nil {
@@ -411,33 +1271,467 @@ func (h httpMathHandler) handleSum(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var err error
-	outputs.Result, err = h.impl.Sum(ctx, inRead)
+	outputs.Result, err = h.impl.Sum(ctx, inRead)
+	outcome = callOutcome(err)
+	if err != nil {
+		rpcError{
+			Message: err.Error(),
+			Code:    http.StatusInternalServerError,
+		}.ServeHTTP(w, r)
+		return
+	}
+
+	encodeCodecOutputs(w, r, outputs)
+}
+
+// handleFactor wraps the implementation's Factor operation and bridges it to HTTP.
+func (h httpMathHandler) handleFactor(w http.ResponseWriter, r *http.Request) {
+	outcome := "rejected"
+	defer h.observe("Factor", time.Now(), &outcome)
+	if r.Method != http.MethodPost {
+		rpcError{
+			Message: fmt.Sprintf("unsupported method %q, please use %q", r.Method, http.MethodPost),
+			Code:    http.StatusMethodNotAllowed,
+		}.ServeHTTP(w, r)
+		return
+	}
+
+	var args struct {
+		Composite uint64 `json:"Composite,omitempty"`
+	}
+
+	if err := decodeCodecArgs(r, &args); err != nil {
+		rpcError{
+			Message: err.Error(),
+			Code:    http.StatusBadRequest,
+		}.ServeHTTP(w, r)
+		return
+	}
+
+	ctx := metadataContext(r.Context(), r)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	if h.ctxTransform != nil {
+		tctx, tcancel, err := h.ctxTransform(ctx, r)
+		if err != nil {
+			rpcError{
+				Message: err.Error(),
+				Code:    http.StatusBadRequest,
+			}.ServeHTTP(w, r)
+			return
+		}
+		defer tcancel()
+		ctx = tctx
+	}
+	pctx := ctx
+	ctx, cancelTimeout := context.WithTimeout(ctx, 30*time.Second)
+	defer cancelTimeout()
+
+	bufw := bufio.NewWriter(w)
+	oje := json.NewEncoder(bufw)
+	firstWrite := true
+	flusher, _ := w.(http.Flusher)
+	// send newline-delimited JSON frames if the client accepts them, flushing each frame
+	ndjson := strings.Contains(r.Header.Get("Accept"), ndjsonContentType)
+	sendFrame := func(frame streamFrame) error {
+		if err := oje.Encode(frame); err != nil {
+			return err
+		}
+		if err := bufw.Flush(); err != nil {
+			return err
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return nil
+	}
+	// send server-sent events if the client accepts them, flushing each event
+	sse := !ndjson && strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+	sendEvent := func(event string, dat []byte) error {
+		if event != "" {
+			fmt.Fprintf(bufw, "event: %s\n", event)
+		}
+		bufw.WriteString("data: ")
+		bufw.Write(bytes.TrimSuffix(dat, []byte("\n")))
+		bufw.WriteString("\n\n")
+		if err := bufw.Flush(); err != nil {
+			return err
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return nil
+	}
+	startWrite := func() error {
+		if ndjson {
+			w.Header().Set("Content-Type", ndjsonContentType)
+			return nil
+		}
+		if sse {
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Header().Set("Cache-Control", "no-cache")
+			return nil
+		}
+		return bufw.WriteByte('[')
+	}
+	outWrite := func(elem uint64) error {
+		if firstWrite {
+			firstWrite = false
+			if err := startWrite(); err != nil {
+				return err
+			}
+		} else if !sse && !ndjson {
+			bufw.WriteByte(',')
+		}
+		if sse {
+			dat, err := json.Marshal(elem)
+			if err != nil {
+				return err
+			}
+			return sendEvent("", dat)
+		}
+		if ndjson {
+			dat, err := json.Marshal(elem)
+			if err != nil {
+				return err
+			}
+			return sendFrame(streamFrame{Value: dat})
+		}
+		return oje.Encode(elem)
+	}
+	endWrite := func() error {
+		if firstWrite {
+			if err := startWrite(); err != nil {
+				return err
+			}
+		}
+		if sse {
+			return sendEvent("end", nil)
+		}
+		if ndjson {
+			return sendFrame(streamFrame{End: true})
+		}
+		bufw.WriteByte(']')
+		return bufw.Flush()
+	}
+
+	var err error
+	err = h.impl.Factor(ctx, args.Composite, outWrite)
+	if err != nil && ctx.Err() == context.DeadlineExceeded && pctx.Err() == nil {
+		err = TimeoutError{Op: "Factor", Timeout: "30s"}
+	}
+	outcome = callOutcome(err)
+	if err != nil {
+		if firstWrite {
+			switch e := err.(type) {
+			case TimeoutError:
+				e.ServeHTTP(w, r)
+			default:
+				rpcError{
+					Message: err.Error(),
+					Code:    http.StatusInternalServerError,
+				}.ServeHTTP(w, r)
+			}
+			return
+		} else {
+			if sse {
+				// the error is sent as the final event
+
+				var rerr rpcError
+				switch e := err.(type) {
+				case TimeoutError:
+					rerr = e.rpcError()
+				default:
+					rerr = rpcError{
+						Message: err.Error(),
+						Code:    http.StatusInternalServerError,
+					}
+				}
+				if dat, merr := json.Marshal(rerr); merr == nil {
+					sendEvent("error", dat)
+				}
+				return
+			}
+
+			if ndjson {
+				// the error is sent as the final frame
+
+				var rerr rpcError
+				switch e := err.(type) {
+				case TimeoutError:
+					rerr = e.rpcError()
+				default:
+					rerr = rpcError{
+						Message: err.Error(),
+						Code:    http.StatusInternalServerError,
+					}
+				}
+				if dat, merr := json.Marshal(rerr); merr == nil {
+					sendFrame(streamFrame{Error: dat})
+				}
+				return
+			}
+			// there is no way to propogate the error
+			// instead, an incomplete response is returned
+			bufw.Flush()
+			return
+		}
+	}
+
+	endWrite()
+}
+
+// handleRunningSum wraps the implementation's RunningSum operation and bridges it to a WebSocket, or to a POST request over HTTP/2.
+func (h httpMathHandler) handleRunningSum(w http.ResponseWriter, r *http.Request) {
+	outcome := "rejected"
+	defer h.observe("RunningSum", time.Now(), &outcome)
+	switch {
+	case r.Method == http.MethodGet:
+	case r.Method == http.MethodPost && r.ProtoMajor >= 2:
+	case r.Method == http.MethodPost:
+		// HTTP/1 cannot reliably stream the request and response bodies at the same time.
+		// The connection is closed rather than reading the rest of the request body, which is only sent after the response.
+		w.Header().Set("Connection", "close")
+		rpcError{
+			Message: "streaming in both directions over a POST request requires HTTP/2, please use a WebSocket",
+			Code:    http.StatusHTTPVersionNotSupported,
+		}.ServeHTTP(w, r)
+		return
+	default:
+		rpcError{
+			Message: fmt.Sprintf("unsupported method %q, please use %q", r.Method, http.MethodGet),
+			Code:    http.StatusMethodNotAllowed,
+		}.ServeHTTP(w, r)
+		return
+	}
+
+	ctx := metadataContext(r.Context(), r)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	if h.ctxTransform != nil {
+		tctx, tcancel, err := h.ctxTransform(ctx, r)
+		if err != nil {
+			rpcError{
+				Message: err.Error(),
+				Code:    http.StatusBadRequest,
+			}.ServeHTTP(w, r)
+			return
+		}
+		defer tcancel()
+		ctx = tctx
+	}
+
+	var c duplexConn
+	if r.Method == http.MethodPost {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			rpcError{
+				Message: "response writer does not support streaming",
+				Code:    http.StatusInternalServerError,
+			}.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", ndjsonContentType)
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+		c = &httpDuplex{
+			enc:   json.NewEncoder(w),
+			flush: flusher.Flush,
+			dec:   json.NewDecoder(r.Body),
+			abort: func() { r.Body.Close() },
+		}
+	} else {
+		wc, _, err := ws.Upgrade(w, r, ws.HandshakeOptions{})
+		if err != nil {
+			return
+		}
+		c = wsDuplex{wc}
+	}
+	defer c.Abort()
+
+	// tear down the connection if the request is cancelled
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			c.Abort()
+		case <-stop:
+		}
+	}()
+
+	inDone := false
+	inRead := func() (float64, error) {
+		if inDone {
+			return 0.0, io.EOF
+		}
+		var frame streamFrame
+		if err := c.ReadFrame(&frame); err != nil {
+			return 0.0, err
+		}
+		if frame.End {
+			inDone = true
+			return 0.0, io.EOF
+		}
+		var elem float64
+		if err := json.Unmarshal(frame.Value, &elem); err != nil {
+			return 0.0, err
+		}
+		return elem, nil
+	}
+
+	outWrite := func(elem float64) error {
+		dat, err := json.Marshal(elem)
+		if err != nil {
+			return err
+		}
+		return c.SendFrame(streamFrame{Value: dat})
+	}
+
+	err := h.impl.RunningSum(ctx, inRead, outWrite)
+	outcome = callOutcome(err)
+	var final streamFrame
+	if err != nil {
+		var rerr rpcError
+		rerr = rpcError{
+			Message: err.Error(),
+			Code:    http.StatusInternalServerError,
+		}
+		dat, merr := json.Marshal(rerr)
+		if merr != nil {
+			return
+		}
+		final.Error = dat
+	} else {
+		final.End = true
+	}
+	if err := c.SendFrame(final); err != nil {
+		return
+	}
+	c.Finish()
+}
+
+// handleChecksum wraps the implementation's Checksum operation and bridges it to HTTP.
+func (h httpMathHandler) handleChecksum(w http.ResponseWriter, r *http.Request) {
+	outcome := "rejected"
+	defer h.observe("Checksum", time.Now(), &outcome)
+	if r.Method != http.MethodPost {
+		rpcError{
+			Message: fmt.Sprintf("unsupported method %q, please use %q", r.Method, http.MethodPost),
+			Code:    http.StatusMethodNotAllowed,
+		}.ServeHTTP(w, r)
+		return
+	}
+
+	var args struct {
+		Table string `json:"Table,omitempty"`
+	}
+
+	// the arguments are sent in the first part, followed by the upload
+	mr, perr := r.MultipartReader()
+	if perr != nil {
+		rpcError{
+			Message: perr.Error(),
+			Code:    http.StatusBadRequest,
+		}.ServeHTTP(w, r)
+		return
+	}
+	part, perr := mr.NextPart()
+	if perr == nil && part.FormName() != "args" {
+		perr = fmt.Errorf("expected arguments part but got %q", part.FormName())
+	}
+	if perr == nil {
+		perr = json.NewDecoder(part).Decode(&args)
+	}
+	if perr != nil {
+		rpcError{
+			Message: perr.Error(),
+			Code:    http.StatusBadRequest,
+		}.ServeHTTP(w, r)
+		return
+	}
+
+	upload, perr := mr.NextPart()
+	if perr == nil && upload.FormName() != "Data" {
+		perr = fmt.Errorf("expected upload part %q but got %q", "Data", upload.FormName())
+	}
+	if perr != nil {
+		rpcError{
+			Message: perr.Error(),
+			Code:    http.StatusBadRequest,
+		}.ServeHTTP(w, r)
+		return
+	}
+
+	if verr := validateMathChecksum(args.Table); verr != nil {
+		outcome = "ValidationError"
+		verr.ServeHTTP(w, r)
+		return
+	}
+
+	ctx := metadataContext(r.Context(), r)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	if h.ctxTransform != nil {
+		tctx, tcancel, err := h.ctxTransform(ctx, r)
+		if err != nil {
+			rpcError{
+				Message: err.Error(),
+				Code:    http.StatusBadRequest,
+			}.ServeHTTP(w, r)
+			return
+		}
+		defer tcancel()
+		ctx = tctx
+	}
+
+	var outputs struct {
+		Checksum uint32 `json:"Checksum,omitempty"`
+	}
+
+	var err error
+	outputs.Checksum, err = h.impl.Checksum(ctx, args.Table, upload)
+	outcome = callOutcome(err)
 	if err != nil {
-		rpcError{
-			Message: err.Error(),
-			Code:    http.StatusInternalServerError,
-		}.ServeHTTP(w, r)
+		switch e := err.(type) {
+		case ErrUnknownTable:
+			e.ServeHTTP(w, r)
+		default:
+			rpcError{
+				Message: err.Error(),
+				Code:    http.StatusInternalServerError,
+			}.ServeHTTP(w, r)
+		}
 		return
 	}
 
-	json.NewEncoder(w).Encode(outputs)
+	encodeCodecOutputs(w, r, outputs)
 }
 
-// handleFactor wraps the implementation's Factor operation and bridges it to HTTP.
-func (h httpMathHandler) handleFactor(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
+// handlePrimes wraps the implementation's Primes operation and bridges it to HTTP.
+func (h httpMathHandler) handlePrimes(w http.ResponseWriter, r *http.Request) {
+	outcome := "rejected"
+	defer h.observe("Primes", time.Now(), &outcome)
+	if r.Method != http.MethodGet {
 		rpcError{
-			Message: fmt.Sprintf("unsupported method %q, please use %q", r.Method, http.MethodPost),
+			Message: fmt.Sprintf("unsupported method %q, please use %q", r.Method, http.MethodGet),
 			Code:    http.StatusMethodNotAllowed,
 		}.ServeHTTP(w, r)
 		return
 	}
 
 	var args struct {
-		Composite uint64 `json:"Composite,omitempty"`
+		Limit uint64 `json:"Limit,omitempty"`
 	}
 
-	if err := json.NewDecoder(r.Body).Decode(&args); err != nil {
+	q := r.URL.Query()
+	if err := func() error {
+		if err := queryValue(q, "Limit", &args.Limit); err != nil {
+			return err
+		}
+
+		return nil
+	}(); err != nil {
 		rpcError{
 			Message: err.Error(),
 			Code:    http.StatusBadRequest,
@@ -445,7 +1739,13 @@ func (h httpMathHandler) handleFactor(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	ctx := r.Context()
+	if verr := validateMathPrimes(args.Limit); verr != nil {
+		outcome = "ValidationError"
+		verr.ServeHTTP(w, r)
+		return
+	}
+
+	ctx := metadataContext(r.Context(), r)
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 	if h.ctxTransform != nil {
@@ -461,68 +1761,92 @@ func (h httpMathHandler) handleFactor(w http.ResponseWriter, r *http.Request) {
 		ctx = tctx
 	}
 
-	bufw := bufio.NewWriter(w)
-	oje := json.NewEncoder(bufw)
-	firstWrite := true
-	startWrite := func() error {
-		return bufw.WriteByte('[')
-	}
-	outWrite := func(elem uint64) error {
-		if firstWrite {
-			firstWrite = false
-			if err := startWrite(); err != nil {
-				return err
-			}
-		} else {
-			bufw.WriteByte(',')
-		}
-		return oje.Encode(elem)
-	}
-	endWrite := func() error {
-		if firstWrite {
-			if err := startWrite(); err != nil {
-				return err
-			}
-		}
-		bufw.WriteByte(']')
-		return bufw.Flush()
-	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	tw := &trackWriter{w: w}
 
 	var err error
-	err = h.impl.Factor(ctx, args.Composite, outWrite)
+	err = h.impl.Primes(ctx, args.Limit, tw)
+	outcome = callOutcome(err)
 	if err != nil {
-		if firstWrite {
+		if !tw.wrote {
 			rpcError{
 				Message: err.Error(),
 				Code:    http.StatusInternalServerError,
 			}.ServeHTTP(w, r)
 			return
-		} else {
-			// there is no way to propogate the error
+		} else { // there is no way to propogate the error
 			// instead, an incomplete response is returned
-			bufw.Flush()
+
 			return
 		}
 	}
 
-	endWrite()
 }
 
 // ServeHTTP invokes the appropriate handler
+// Request bodies compressed with gzip are decompressed.
 func (h httpMathHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if strings.EqualFold(r.Header.Get("Content-Encoding"), "gzip") {
+		gz, err := gzip.NewReader(r.Body)
+		if err != nil {
+			rpcError{
+				Message: err.Error(),
+				Code:    http.StatusBadRequest,
+			}.ServeHTTP(w, r)
+			return
+		}
+		defer gz.Close()
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{gz, r.Body}
+		r.Header.Del("Content-Encoding")
+		r.ContentLength = -1
+	}
 	h.mux.ServeHTTP(w, r)
 }
 
+// HTTPMathHandlerOptions are the options of an http.Handler that wraps a Math.
+type HTTPMathHandlerOptions struct {
+	// CtxTransform is an optional callback to transform the context with information from the HTTP request.
+	// If CtxTransform returns an error, the error will be propogated to the client.
+	// The cancel function returned by CtxTransform will be invoked after the request completes.
+	// Metadata sent by the client is attached to the context before CtxTransform is called, and can be retrieved with MetadataFromContext.
+	CtxTransform func(context.Context, *http.Request) (context.Context, context.CancelFunc, error)
+
+	// Collector is an optional collector to which every call is reported.
+	Collector metrics.Collector
+
+	// HealthChecker is an optional checker which serves the health and readiness endpoints, "/_health" and "/_ready".
+	// The endpoints do not require authentication, so that load balancers can probe them.
+	// Defaults to the implementation of the system, if it implements HealthChecker.
+	// If there is no checker, the endpoints are not served.
+	HealthChecker HealthChecker
+}
+
 // NewHTTPMathHandler creates an http.Handler that wraps a Math.
 // If not nil, ctxTransform will be called to transform the context with information from the HTTP request.
 // If the ctxTransform returns an error, the error will be propogated to the client.
 // The cancel function returned by ctxTransform will be invoked after the request completes.
+// Metadata sent by the client is attached to the context before ctxTransform is called, and can be retrieved with MetadataFromContext.
+// The health and readiness endpoints are served if the system implements HealthChecker.
 func NewHTTPMathHandler(system Math, ctxTransform func(context.Context, *http.Request) (context.Context, context.CancelFunc, error)) http.Handler {
+	return NewHTTPMathHandlerWithOptions(system, HTTPMathHandlerOptions{CtxTransform: ctxTransform})
+}
+
+// NewInstrumentedHTTPMathHandler creates an http.Handler that wraps a Math like NewHTTPMathHandler, and reports every call to the collector.
+func NewInstrumentedHTTPMathHandler(system Math, ctxTransform func(context.Context, *http.Request) (context.Context, context.CancelFunc, error), collector metrics.Collector) http.Handler {
+	return NewHTTPMathHandlerWithOptions(system, HTTPMathHandlerOptions{CtxTransform: ctxTransform, Collector: collector})
+}
+
+// NewHTTPMathHandlerWithOptions creates an http.Handler that wraps a Math with the given options.
+func NewHTTPMathHandlerWithOptions(system Math, opts HTTPMathHandlerOptions) http.Handler {
 	mux := http.NewServeMux()
 	h := &httpMathHandler{
 		impl:         system,
-		ctxTransform: ctxTransform,
+		ctxTransform: opts.CtxTransform,
 		mux:          mux,
+		collector:    opts.Collector,
 	}
 
 	mux.HandleFunc("/Add", h.handleAdd)
@@ -530,10 +1854,258 @@ func NewHTTPMathHandler(system Math, ctxTransform func(context.Context, *http.Re
 	mux.HandleFunc("/Statistics", h.handleStatistics)
 	mux.HandleFunc("/Sum", h.handleSum)
 	mux.HandleFunc("/Factor", h.handleFactor)
+	mux.HandleFunc("/RunningSum", h.handleRunningSum)
+	mux.HandleFunc("/Checksum", h.handleChecksum)
+	mux.HandleFunc("/Primes", h.handlePrimes)
+	health := opts.HealthChecker
+	if health == nil {
+		health, _ = system.(HealthChecker)
+	}
+	if health != nil {
+		mux.HandleFunc("/_health", func(w http.ResponseWriter, r *http.Request) {
+			serveHealth(w, r, health.Healthy)
+		})
+		mux.HandleFunc("/_ready", func(w http.ResponseWriter, r *http.Request) {
+			serveHealth(w, r, health.Ready)
+		})
+	}
 
 	return h
 }
 
+// ClientError is an error reported by the server in response to a call from the client.
+// If the error is one declared by the operation, it is decoded and can be retrieved with errors.As.
+type ClientError struct {
+	// StatusCode is the HTTP status code of the response.
+	// This is 0 if the error was sent after a stream started.
+	StatusCode int
+
+	// Type is the name of the error type sent by the server, if any.
+	Type string
+
+	// Code is the machine-readable code of the error sent by the server, if any.
+	Code ErrorCode
+
+	// Message is the error message sent by the server.
+	Message string
+
+	// Payload is the JSON-encoded data attached to the error, if any.
+	Payload json.RawMessage
+
+	// Err is the decoded error, if the type is declared by the operation.
+	Err error
+}
+
+func (err *ClientError) Error() string {
+	if err.Err != nil {
+		return err.Err.Error()
+	}
+	return err.Message
+}
+
+// Unwrap returns the decoded error, if any.
+func (err *ClientError) Unwrap() error {
+	return err.Err
+}
+
+// parseClientError parses an error sent by the server.
+// If the error is not in the standard format, the whole body is used as the message.
+func parseClientError(status int, dat []byte) *ClientError {
+	var rerr struct {
+		Message string          `json:"message"`
+		Type    string          `json:"type"`
+		Code    ErrorCode       `json:"code"`
+		Data    json.RawMessage `json:"dat"`
+	}
+	if err := json.Unmarshal(dat, &rerr); err != nil {
+		return &ClientError{StatusCode: status, Message: string(dat)}
+	}
+	return &ClientError{
+		StatusCode: status,
+		Type:       rerr.Type,
+		Code:       rerr.Code,
+		Message:    rerr.Message,
+		Payload:    rerr.Data,
+	}
+}
+
+// DuplexTransport is a transport for operations which stream in both directions.
+type DuplexTransport uint8
+
+const (
+	// DuplexAuto streams over an HTTP/2 request and response for https URLs, and over a WebSocket otherwise.
+	// If the server does not negotiate HTTP/2, the call falls back to a WebSocket.
+	DuplexAuto DuplexTransport = iota
+
+	// DuplexHTTP2 streams over an HTTP/2 request and response.
+	// This may be used with transports supporting HTTP/2 without TLS.
+	DuplexHTTP2
+
+	// DuplexWebSocket streams over a WebSocket.
+	DuplexWebSocket
+)
+
+// CallInterceptor wraps an operation call on the client.
+// The interceptor may inspect or modify the context, and must call invoke to run the operation.
+// Invoke may be called more than once in order to retry an operation, but streamed inputs cannot be replayed.
+type CallInterceptor func(ctx context.Context, call *Call, invoke func(context.Context) error) error
+
+// RoundTripInterceptor wraps an HTTP round trip made by the client.
+// The interceptor must call next to send the request.
+type RoundTripInterceptor func(req *http.Request, next func(*http.Request) (*http.Response, error)) (*http.Response, error)
+
+// roundTripperFunc adapts a function into an http.RoundTripper.
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// ClientOptions configures the HTTP transport of a client.
+// The zero value uses the same settings as http.DefaultTransport, with a dedicated connection pool.
+type ClientOptions struct {
+	// Timeout is the time limit of each request, including reading the response body.
+	// This also limits streamed calls, so it should be left unset if operations stream for a long time.
+	// Defaults to no limit.
+	Timeout time.Duration
+
+	// DialTimeout is the time limit for establishing a connection.
+	// Defaults to 30 seconds.
+	DialTimeout time.Duration
+
+	// KeepAlive is the interval between TCP keep-alive probes.
+	// Defaults to 30 seconds.
+	// If negative, keep-alive probes are disabled.
+	KeepAlive time.Duration
+
+	// IdleConnTimeout is the time after which an idle connection is closed.
+	// Defaults to 90 seconds.
+	IdleConnTimeout time.Duration
+
+	// MaxIdleConns is the maximum number of idle connections.
+	// Defaults to 100.
+	MaxIdleConns int
+
+	// MaxIdleConnsPerHost is the maximum number of idle connections to each host.
+	// Defaults to http.DefaultMaxIdleConnsPerHost.
+	MaxIdleConnsPerHost int
+
+	// UserAgent is sent in the User-Agent header of each request.
+	UserAgent string
+
+	// Header is a set of base headers sent with each request.
+	// Headers set by the client for a call take precedence.
+	Header http.Header
+
+	// Codec is the encoding of the arguments and results of operations which negotiate their encoding.
+	// By default, each operation uses the encoding declared by the spec.
+	Codec codec.Codec
+}
+
+// httpClient creates an HTTP client with the options.
+func (opts ClientOptions) httpClient() *http.Client {
+	dialTimeout := opts.DialTimeout
+	if dialTimeout == 0 {
+		dialTimeout = 30 * time.Second
+	}
+	keepAlive := opts.KeepAlive
+	if keepAlive == 0 {
+		keepAlive = 30 * time.Second
+	}
+	tr := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   dialTimeout,
+			KeepAlive: keepAlive,
+		}).DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   opts.MaxIdleConnsPerHost,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: time.Second,
+	}
+	if opts.MaxIdleConns != 0 {
+		tr.MaxIdleConns = opts.MaxIdleConns
+	}
+	if opts.IdleConnTimeout != 0 {
+		tr.IdleConnTimeout = opts.IdleConnTimeout
+	}
+	var rt http.RoundTripper = tr
+	if opts.UserAgent != "" || len(opts.Header) != 0 {
+		header := opts.Header.Clone()
+		if header == nil {
+			header = http.Header{}
+		}
+		if opts.UserAgent != "" {
+			header.Set("User-Agent", opts.UserAgent)
+		}
+		rt = roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			req = req.Clone(req.Context())
+			for k, v := range header {
+				if _, ok := req.Header[k]; !ok {
+					req.Header[k] = v
+				}
+			}
+			return tr.RoundTrip(req)
+		})
+	}
+	return &http.Client{
+		Transport: rt,
+		Timeout:   opts.Timeout,
+	}
+}
+
+// gzipRoundTrip is a RoundTripInterceptor which compresses request bodies of a known size with gzip if they reach 1024 bytes.
+// It also requests gzip-encoded responses, and decompresses them.
+func gzipRoundTrip(req *http.Request, next func(*http.Request) (*http.Response, error)) (*http.Response, error) {
+	if req.Body != nil && req.ContentLength >= 1024 && req.Header.Get("Content-Encoding") == "" {
+		dat, err := ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		gz.Write(dat)
+		if err := gz.Close(); err != nil {
+			return nil, err
+		}
+		zdat := buf.Bytes()
+		req = req.Clone(req.Context())
+		req.Body = ioutil.NopCloser(bytes.NewReader(zdat))
+		req.GetBody = func() (io.ReadCloser, error) {
+			return ioutil.NopCloser(bytes.NewReader(zdat)), nil
+		}
+		req.ContentLength = int64(len(zdat))
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	if req.Header.Get("Accept-Encoding") == "" && req.Header.Get("Upgrade") == "" {
+		req = req.Clone(req.Context())
+		req.Header.Set("Accept-Encoding", "gzip")
+	}
+	resp, err := next(req)
+	if err != nil {
+		return nil, err
+	}
+	if strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") {
+		gz, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			resp.Body.Close()
+			return nil, err
+		}
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{gz, resp.Body}
+		resp.Header.Del("Content-Encoding")
+		resp.Header.Del("Content-Length")
+		resp.ContentLength = -1
+		resp.Uncompressed = true
+	}
+	return resp, nil
+}
+
 // MathClient is an HTTP client for Math, implementing Math.
 type MathClient struct {
 	// HTTP is the HTTP client which will be used by the MathClient to make requests.
@@ -545,7 +2117,153 @@ type MathClient struct {
 	// Contextualize is an optional callback that may be used to add contextual information to the HTTP request.
 	// If Contextualize is not called, the parent context will be inserted into the request.
 	// If present, the Contextualize callback is responsible for configuring request cancellation.
+	// Operations which stream in both directions are not passed through Contextualize.
 	Contextualize func(context.Context, *http.Request) (*http.Request, error)
+
+	// Interceptors wrap every operation call made by the client.
+	// The first interceptor is the outermost.
+	Interceptors []CallInterceptor
+
+	// RoundTripInterceptors wrap every HTTP round trip made by the client.
+	// The first interceptor is the outermost.
+	RoundTripInterceptors []RoundTripInterceptor
+
+	// Collector is an optional collector to which every call is reported.
+	Collector metrics.Collector
+
+	// DuplexTransport selects the transport of operations which stream in both directions.
+	DuplexTransport DuplexTransport
+
+	// Codec is the encoding of the arguments and results of operations which negotiate their encoding.
+	// By default, each operation uses the encoding declared by the spec.
+	Codec codec.Codec
+}
+
+// NewMathClient creates a client for the server at the base URL, with a dedicated HTTP client configured by the options.
+func NewMathClient(base string, opts ClientOptions) (*MathClient, error) {
+	u, err := url.Parse(base)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("base URL %q is not absolute", base)
+	}
+	return &MathClient{
+		HTTP:  opts.httpClient(),
+		Base:  u,
+		Codec: opts.Codec,
+	}, nil
+}
+
+// codec returns the codec of an operation which negotiates its encoding, given the encoding declared by the spec.
+func (cli *MathClient) codec(declared codec.Codec) codec.Codec {
+	if cli.Codec != nil {
+		return cli.Codec
+	}
+	return declared
+}
+
+// dialDuplex opens a connection carrying an operation which streams in both directions.
+// If the server rejects the call, the error response is returned instead.
+func (cli *MathClient) dialDuplex(ctx context.Context, u *url.URL, hdr http.Header) (duplexConn, *http.Response, error) {
+	hcl := cli.httpClient()
+	if cli.DuplexTransport == DuplexHTTP2 || (cli.DuplexTransport == DuplexAuto && u.Scheme == "https") {
+		pr, pw := io.Pipe()
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), pr)
+		if err != nil {
+			return nil, nil, err
+		}
+		req.Header = hdr.Clone()
+		req.Header.Set("Content-Type", ndjsonContentType)
+		req.Header.Set("Accept", ndjsonContentType)
+		req.Header.Set("Accept-Encoding", "identity")
+		resp, err := hcl.Do(req)
+		if err != nil {
+			pw.Close()
+			return nil, nil, err
+		}
+		switch {
+		case resp.StatusCode == http.StatusOK && resp.ProtoMajor >= 2:
+			return &httpDuplex{
+				enc:   json.NewEncoder(pw),
+				flush: func() {},
+				dec:   json.NewDecoder(resp.Body),
+				abort: func() {
+					pw.Close()
+					resp.Body.Close()
+				},
+			}, nil, nil
+		case cli.DuplexTransport == DuplexAuto && (resp.ProtoMajor < 2 || resp.StatusCode == http.StatusMethodNotAllowed):
+			// the server does not support streaming over HTTP/2, so fall back to a WebSocket
+			pw.Close()
+			resp.Body.Close()
+		default:
+			pw.Close()
+			return nil, resp, nil
+		}
+	}
+
+	c, _, err := (&ws.Dialer{
+		HTTPClient: hcl,
+		Rand:       rand.Reader,
+	}).Dial(ctx, u, ws.HandshakeOptions{Headers: hdr})
+	if err != nil {
+		return nil, nil, err
+	}
+	return wsDuplex{c}, nil, nil
+}
+
+// observe reports a call to the collector, if there is one.
+func (cli *MathClient) observe(op string, start time.Time, err error) {
+	if cli.Collector == nil {
+		return
+	}
+	cli.Collector.ObserveCall(metrics.Observation{
+		System:   "Math",
+		Op:       op,
+		Side:     metrics.Client,
+		Outcome:  callOutcome(err),
+		Duration: time.Since(start),
+	})
+}
+
+// intercept runs an operation call through the client's call interceptors.
+func (cli *MathClient) intercept(ctx context.Context, call *Call, invoke func(context.Context) error) error {
+	for i := len(cli.Interceptors) - 1; i >= 0; i-- {
+		ic, next := cli.Interceptors[i], invoke
+		invoke = func(ctx context.Context) error {
+			return ic(ctx, call, next)
+		}
+	}
+	return invoke(ctx)
+}
+
+// httpClient returns the HTTP client to use for requests, with the round trip interceptors applied.
+// Gzip compression is applied within the interceptors.
+func (cli *MathClient) httpClient() *http.Client {
+	hcl := cli.HTTP
+	if hcl == nil {
+		hcl = http.DefaultClient
+	}
+	interceptors := cli.RoundTripInterceptors
+	interceptors = append(interceptors[:len(interceptors):len(interceptors)], gzipRoundTrip)
+	if len(interceptors) == 0 {
+		return hcl
+	}
+	base := hcl.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	next := base.RoundTrip
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		ic, inner := interceptors[i], next
+		next = func(req *http.Request) (*http.Response, error) {
+			return ic(req, inner)
+		}
+	}
+	wrapped := *hcl
+	wrapped.Transport = roundTripperFunc(next)
+	return &wrapped
 }
 
 // Adds two numbers.
@@ -553,28 +2271,61 @@ type MathClient struct {
 // Y is the second number.
 // Sum is the sum of the two numbers.
 func (cli *MathClient) Add(ctx context.Context, X uint32, Y uint32) (uint32, error) {
+	var r0 uint32
+	start := time.Now()
+	call := &Call{
+		Op: "Add",
+		Args: map[string]interface{}{
+			"X": X,
+			"Y": Y,
+		},
+	}
+	err := cli.intercept(ctx, call, func(ctx context.Context) error {
+		var err error
+		r0, err = cli.invokeAdd(ctx, X, Y)
+		if err == nil {
+			call.Results = map[string]interface{}{
+				"Sum": r0,
+			}
+		}
+		return err
+	})
+	cli.observe("Add", start, err)
+	return r0, err
+}
+
+// invokeAdd runs the Add operation without applying call interceptors.
+func (cli *MathClient) invokeAdd(ctx context.Context, X uint32, Y uint32) (uint32, error) {
 	u, err := cli.Base.Parse("Add")
 	if err != nil {
 		return 0, err
 	}
 
 	q := u.Query()
-	rawX, err := json.Marshal(X)
-	if err != nil {
-		return 0, err
-	}
-	q.Set("X", string(rawX))
-	rawY, err := json.Marshal(Y)
-	if err != nil {
+	if err := func() error {
+		if err := queryAdd(q, "X", X); err != nil {
+			return err
+		}
+		if err := queryAdd(q, "Y", Y); err != nil {
+			return err
+		}
+
+		return nil
+	}(); err != nil {
 		return 0, err
 	}
-	q.Set("Y", string(rawY))
 	u.RawQuery = q.Encode()
 
 	req, err := http.NewRequest(http.MethodPost, u.String(), nil)
 	if err != nil {
 		return 0, err
 	}
+
+	if c := cli.codec(codec.JSON); c != codec.JSON {
+		req.Header.Set("Accept", c.ContentType()+", application/json")
+	}
+	setMetadataHeaders(ctx, req.Header)
+
 	if cli.Contextualize == nil {
 		req = req.WithContext(ctx)
 	} else {
@@ -587,10 +2338,7 @@ func (cli *MathClient) Add(ctx context.Context, X uint32, Y uint32) (uint32, err
 		}
 	}
 
-	hcl := cli.HTTP
-	if hcl == nil {
-		hcl = http.DefaultClient
-	}
+	hcl := cli.httpClient()
 	resp, err := hcl.Do(req)
 	if err != nil {
 		return 0, err
@@ -600,15 +2348,10 @@ func (cli *MathClient) Add(ctx context.Context, X uint32, Y uint32) (uint32, err
 	if resp.StatusCode != http.StatusOK {
 		dat, eerr := ioutil.ReadAll(resp.Body)
 		if eerr != nil {
-			return 0, errors.New(resp.Status)
-		}
-		var rerr rpcError
-		eerr = json.Unmarshal(dat, &rerr)
-		if eerr != nil {
-			return 0, errors.New(string(dat))
+			return 0, &ClientError{StatusCode: resp.StatusCode, Message: resp.Status}
 		}
-
-		return 0, errors.New(rerr.Message)
+		cerr := parseClientError(resp.StatusCode, dat)
+		return 0, cerr
 	}
 
 	bdat, err := ioutil.ReadAll(resp.Body)
@@ -617,14 +2360,19 @@ func (cli *MathClient) Add(ctx context.Context, X uint32, Y uint32) (uint32, err
 	}
 
 	var outputs struct {
-		Sum uint32 `json:"Sum,omitempty"`
+		Sum uint32 `json:"Sum"`
+	}
+	if c, ok := codec.ByContentType(resp.Header.Get("Content-Type")); ok {
+		err = c.Unmarshal(bdat, &outputs)
+	} else {
+		err = json.Unmarshal(bdat, &outputs)
 	}
-	err = json.Unmarshal(bdat, &outputs)
 	if err != nil {
 		return 0, err
 	}
 
 	return outputs.Sum, nil
+
 }
 
 // Divides two numbers.
@@ -634,12 +2382,40 @@ func (cli *MathClient) Add(ctx context.Context, X uint32, Y uint32) (uint32, err
 // Remainder is the remainder of the division.
 // May return ErrDivideByZero.
 func (cli *MathClient) Divide(ctx context.Context, X uint32, Y uint32) (uint32, uint32, error) {
+	var r0 uint32
+	var r1 uint32
+	start := time.Now()
+	call := &Call{
+		Op: "Divide",
+		Args: map[string]interface{}{
+			"X": X,
+			"Y": Y,
+		},
+	}
+	err := cli.intercept(ctx, call, func(ctx context.Context) error {
+		var err error
+		r0, r1, err = cli.invokeDivide(ctx, X, Y)
+		if err == nil {
+			call.Results = map[string]interface{}{
+				"Quotient":  r0,
+				"Remainder": r1,
+			}
+		}
+		return err
+	})
+	cli.observe("Divide", start, err)
+	return r0, r1, err
+}
+
+// invokeDivide runs the Divide operation without applying call interceptors.
+func (cli *MathClient) invokeDivide(ctx context.Context, X uint32, Y uint32) (uint32, uint32, error) {
 	u, err := cli.Base.Parse("Divide")
 	if err != nil {
 		return 0, 0, err
 	}
 
-	dat, err := json.Marshal(struct {
+	c := cli.codec(codec.JSON)
+	dat, err := c.Marshal(struct {
 		X uint32 `json:"X,omitempty"`
 		Y uint32 `json:"Y,omitempty"`
 	}{
@@ -653,6 +2429,13 @@ func (cli *MathClient) Divide(ctx context.Context, X uint32, Y uint32) (uint32,
 	if err != nil {
 		return 0, 0, err
 	}
+	if c != codec.JSON {
+		req.Header.Set("Content-Type", c.ContentType())
+		req.Header.Set("Accept", c.ContentType()+", application/json")
+	}
+
+	setMetadataHeaders(ctx, req.Header)
+
 	if cli.Contextualize == nil {
 		req = req.WithContext(ctx)
 	} else {
@@ -665,10 +2448,7 @@ func (cli *MathClient) Divide(ctx context.Context, X uint32, Y uint32) (uint32,
 		}
 	}
 
-	hcl := cli.HTTP
-	if hcl == nil {
-		hcl = http.DefaultClient
-	}
+	hcl := cli.httpClient()
 	resp, err := hcl.Do(req)
 	if err != nil {
 		return 0, 0, err
@@ -678,30 +2458,17 @@ func (cli *MathClient) Divide(ctx context.Context, X uint32, Y uint32) (uint32,
 	if resp.StatusCode != http.StatusOK {
 		dat, eerr := ioutil.ReadAll(resp.Body)
 		if eerr != nil {
-			return 0, 0, errors.New(resp.Status)
-		}
-		var rerr rpcError
-		eerr = json.Unmarshal(dat, &rerr)
-		if eerr != nil {
-			return 0, 0, errors.New(string(dat))
+			return 0, 0, &ClientError{StatusCode: resp.StatusCode, Message: resp.Status}
 		}
-
-		rmsg := rerr.Message
-		switch rerr.Type {
+		cerr := parseClientError(resp.StatusCode, dat)
+		switch cerr.Type {
 		case "ErrDivideByZero":
-			rerr.Data = &ErrDivideByZero{}
-		default:
-			return 0, 0, errors.New(rmsg)
-		}
-		eerr = json.Unmarshal(dat, &rerr)
-		if eerr != nil {
-			return 0, 0, errors.New(rmsg)
-		}
-		decerr, ok := rerr.Data.(error)
-		if !ok {
-			return 0, 0, errors.New(rmsg)
+			var e ErrDivideByZero
+			if json.Unmarshal(cerr.Payload, &e) == nil {
+				cerr.Err = e
+			}
 		}
-		return 0, 0, decerr
+		return 0, 0, cerr
 	}
 
 	bdat, err := ioutil.ReadAll(resp.Body)
@@ -710,15 +2477,20 @@ func (cli *MathClient) Divide(ctx context.Context, X uint32, Y uint32) (uint32,
 	}
 
 	var outputs struct {
-		Quotient  uint32 `json:"Quotient,omitempty"`
-		Remainder uint32 `json:"Remainder,omitempty"`
+		Quotient  uint32 `json:"Quotient"`
+		Remainder uint32 `json:"Remainder"`
+	}
+	if c, ok := codec.ByContentType(resp.Header.Get("Content-Type")); ok {
+		err = c.Unmarshal(bdat, &outputs)
+	} else {
+		err = json.Unmarshal(bdat, &outputs)
 	}
-	err = json.Unmarshal(bdat, &outputs)
 	if err != nil {
 		return 0, 0, err
 	}
 
 	return outputs.Quotient, outputs.Remainder, nil
+
 }
 
 // Statistics calculates summative statistics for a set of data
@@ -726,12 +2498,40 @@ func (cli *MathClient) Divide(ctx context.Context, X uint32, Y uint32) (uint32,
 // Results are the resulting summary statistics.
 // May return ErrNoData.
 func (cli *MathClient) Statistics(ctx context.Context, Data []float64) (Stats, error) {
+	var r0 Stats
+	start := time.Now()
+	call := &Call{
+		Op: "Statistics",
+		Args: map[string]interface{}{
+			"Data": Data,
+		},
+	}
+	err := cli.intercept(ctx, call, func(ctx context.Context) error {
+		var err error
+		r0, err = cli.invokeStatistics(ctx, Data)
+		if err == nil {
+			call.Results = map[string]interface{}{
+				"Results": r0,
+			}
+		}
+		return err
+	})
+	cli.observe("Statistics", start, err)
+	return r0, err
+}
+
+// invokeStatistics runs the Statistics operation without applying call interceptors.
+func (cli *MathClient) invokeStatistics(ctx context.Context, Data []float64) (Stats, error) {
+	if verr := validateMathStatistics(Data); verr != nil {
+		return Stats{}, verr
+	}
 	u, err := cli.Base.Parse("Statistics")
 	if err != nil {
 		return Stats{}, err
 	}
 
-	dat, err := json.Marshal(struct {
+	c := cli.codec(codec.CBOR)
+	dat, err := c.Marshal(struct {
 		Data []float64 `json:"Data,omitempty"`
 	}{
 		Data: Data,
@@ -743,6 +2543,13 @@ func (cli *MathClient) Statistics(ctx context.Context, Data []float64) (Stats, e
 	if err != nil {
 		return Stats{}, err
 	}
+	if c != codec.JSON {
+		req.Header.Set("Content-Type", c.ContentType())
+		req.Header.Set("Accept", c.ContentType()+", application/json")
+	}
+
+	setMetadataHeaders(ctx, req.Header)
+
 	if cli.Contextualize == nil {
 		req = req.WithContext(ctx)
 	} else {
@@ -755,10 +2562,7 @@ func (cli *MathClient) Statistics(ctx context.Context, Data []float64) (Stats, e
 		}
 	}
 
-	hcl := cli.HTTP
-	if hcl == nil {
-		hcl = http.DefaultClient
-	}
+	hcl := cli.httpClient()
 	resp, err := hcl.Do(req)
 	if err != nil {
 		return Stats{}, err
@@ -768,30 +2572,22 @@ func (cli *MathClient) Statistics(ctx context.Context, Data []float64) (Stats, e
 	if resp.StatusCode != http.StatusOK {
 		dat, eerr := ioutil.ReadAll(resp.Body)
 		if eerr != nil {
-			return Stats{}, errors.New(resp.Status)
-		}
-		var rerr rpcError
-		eerr = json.Unmarshal(dat, &rerr)
-		if eerr != nil {
-			return Stats{}, errors.New(string(dat))
+			return Stats{}, &ClientError{StatusCode: resp.StatusCode, Message: resp.Status}
 		}
-
-		rmsg := rerr.Message
-		switch rerr.Type {
+		cerr := parseClientError(resp.StatusCode, dat)
+		switch cerr.Type {
 		case "ErrNoData":
-			rerr.Data = &ErrNoData{}
-		default:
-			return Stats{}, errors.New(rmsg)
-		}
-		eerr = json.Unmarshal(dat, &rerr)
-		if eerr != nil {
-			return Stats{}, errors.New(rmsg)
-		}
-		decerr, ok := rerr.Data.(error)
-		if !ok {
-			return Stats{}, errors.New(rmsg)
+			var e ErrNoData
+			if json.Unmarshal(cerr.Payload, &e) == nil {
+				cerr.Err = e
+			}
+		case "ValidationError":
+			var e ValidationError
+			if json.Unmarshal(cerr.Payload, &e) == nil {
+				cerr.Err = &e
+			}
 		}
-		return Stats{}, decerr
+		return Stats{}, cerr
 	}
 
 	bdat, err := ioutil.ReadAll(resp.Body)
@@ -802,18 +2598,45 @@ func (cli *MathClient) Statistics(ctx context.Context, Data []float64) (Stats, e
 	var outputs struct {
 		Results Stats `json:"Results,omitempty"`
 	}
-	err = json.Unmarshal(bdat, &outputs)
+	if c, ok := codec.ByContentType(resp.Header.Get("Content-Type")); ok {
+		err = c.Unmarshal(bdat, &outputs)
+	} else {
+		err = json.Unmarshal(bdat, &outputs)
+	}
 	if err != nil {
 		return Stats{}, err
 	}
 
 	return outputs.Results, nil
+
 }
 
 // Sum adds a stream of numbers together.
 // Numbers is the stream of numbers to sum.
 // Result is the final sum.
 func (cli *MathClient) Sum(ctx context.Context, in func() (float64, error)) (float64, error) {
+	var r0 float64
+	start := time.Now()
+	call := &Call{
+		Op:   "Sum",
+		Args: map[string]interface{}{},
+	}
+	err := cli.intercept(ctx, call, func(ctx context.Context) error {
+		var err error
+		r0, err = cli.invokeSum(ctx, in)
+		if err == nil {
+			call.Results = map[string]interface{}{
+				"Result": r0,
+			}
+		}
+		return err
+	})
+	cli.observe("Sum", start, err)
+	return r0, err
+}
+
+// invokeSum runs the Sum operation without applying call interceptors.
+func (cli *MathClient) invokeSum(ctx context.Context, in func() (float64, error)) (float64, error) {
 	u, err := cli.Base.Parse("Sum")
 	if err != nil {
 		return 0.0, err
@@ -871,6 +2694,11 @@ func (cli *MathClient) Sum(ctx context.Context, in func() (float64, error)) (flo
 		return 0.0, err
 	}
 
+	if c := cli.codec(codec.JSON); c != codec.JSON {
+		req.Header.Set("Accept", c.ContentType()+", application/json")
+	}
+	setMetadataHeaders(ctx, req.Header)
+
 	if cli.Contextualize == nil {
 		req = req.WithContext(ctx)
 	} else {
@@ -883,10 +2711,7 @@ func (cli *MathClient) Sum(ctx context.Context, in func() (float64, error)) (flo
 		}
 	}
 
-	hcl := cli.HTTP
-	if hcl == nil {
-		hcl = http.DefaultClient
-	}
+	hcl := cli.httpClient()
 	resp, err := hcl.Do(req)
 	if err != nil {
 		return 0.0, err
@@ -896,15 +2721,10 @@ func (cli *MathClient) Sum(ctx context.Context, in func() (float64, error)) (flo
 	if resp.StatusCode != http.StatusOK {
 		dat, eerr := ioutil.ReadAll(resp.Body)
 		if eerr != nil {
-			return 0.0, errors.New(resp.Status)
+			return 0.0, &ClientError{StatusCode: resp.StatusCode, Message: resp.Status}
 		}
-		var rerr rpcError
-		eerr = json.Unmarshal(dat, &rerr)
-		if eerr != nil {
-			return 0.0, errors.New(string(dat))
-		}
-
-		return 0.0, errors.New(rerr.Message)
+		cerr := parseClientError(resp.StatusCode, dat)
+		return 0.0, cerr
 	}
 
 	bdat, err := ioutil.ReadAll(resp.Body)
@@ -915,25 +2735,56 @@ func (cli *MathClient) Sum(ctx context.Context, in func() (float64, error)) (flo
 	var outputs struct {
 		Result float64 `json:"Result,omitempty"`
 	}
-	err = json.Unmarshal(bdat, &outputs)
+	if c, ok := codec.ByContentType(resp.Header.Get("Content-Type")); ok {
+		err = c.Unmarshal(bdat, &outputs)
+	} else {
+		err = json.Unmarshal(bdat, &outputs)
+	}
 	if err != nil {
 		return 0.0, err
 	}
 
 	return outputs.Result, nil
+
 }
 
 // Factor computes the prime factors of an integer.
 // Composite is the number to factor.
 // Factors are the prime factors found.
 func (cli *MathClient) Factor(ctx context.Context, Composite uint64, out func(uint64) error,
+) error {
+	start := time.Now()
+	call := &Call{
+		Op: "Factor",
+		Args: map[string]interface{}{
+			"Composite": Composite,
+		},
+	}
+	err := cli.intercept(ctx, call, func(ctx context.Context) error {
+		pctx := ctx
+		ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+		defer cancel()
+		var err error
+		err = cli.invokeFactor(ctx, Composite, out)
+		if err != nil && ctx.Err() == context.DeadlineExceeded && pctx.Err() == nil {
+			err = TimeoutError{Op: "Factor", Timeout: "30s"}
+		}
+		return err
+	})
+	cli.observe("Factor", start, err)
+	return err
+}
+
+// invokeFactor runs the Factor operation without applying call interceptors.
+func (cli *MathClient) invokeFactor(ctx context.Context, Composite uint64, out func(uint64) error,
 ) error {
 	u, err := cli.Base.Parse("Factor")
 	if err != nil {
 		return err
 	}
 
-	dat, err := json.Marshal(struct {
+	c := cli.codec(codec.JSON)
+	dat, err := c.Marshal(struct {
 		Composite uint64 `json:"Composite,omitempty"`
 	}{
 		Composite: Composite,
@@ -945,6 +2796,14 @@ func (cli *MathClient) Factor(ctx context.Context, Composite uint64, out func(ui
 	if err != nil {
 		return err
 	}
+	if c != codec.JSON {
+		req.Header.Set("Content-Type", c.ContentType())
+		req.Header.Set("Accept", c.ContentType()+", application/json")
+	}
+
+	req.Header.Set("Accept", "application/x-ndjson, text/event-stream, application/json")
+	setMetadataHeaders(ctx, req.Header)
+
 	if cli.Contextualize == nil {
 		req = req.WithContext(ctx)
 	} else {
@@ -957,10 +2816,7 @@ func (cli *MathClient) Factor(ctx context.Context, Composite uint64, out func(ui
 		}
 	}
 
-	hcl := cli.HTTP
-	if hcl == nil {
-		hcl = http.DefaultClient
-	}
+	hcl := cli.httpClient()
 	resp, err := hcl.Do(req)
 	if err != nil {
 		return err
@@ -970,17 +2826,106 @@ func (cli *MathClient) Factor(ctx context.Context, Composite uint64, out func(ui
 	if resp.StatusCode != http.StatusOK {
 		dat, eerr := ioutil.ReadAll(resp.Body)
 		if eerr != nil {
-			return errors.New(resp.Status)
+			return &ClientError{StatusCode: resp.StatusCode, Message: resp.Status}
 		}
-		var rerr rpcError
-		eerr = json.Unmarshal(dat, &rerr)
-		if eerr != nil {
-			return errors.New(string(dat))
+		cerr := parseClientError(resp.StatusCode, dat)
+		switch cerr.Type {
+		case "TimeoutError":
+			var e TimeoutError
+			if json.Unmarshal(cerr.Payload, &e) == nil {
+				cerr.Err = e
+			}
 		}
-
-		return errors.New(rerr.Message)
+		return cerr
 	}
 
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		br := bufio.NewReader(resp.Body)
+		var event string
+		var dat []byte
+		var hasData bool
+		for {
+			line, err := br.ReadBytes('\n')
+			if err != nil {
+				if err == io.EOF {
+					err = io.ErrUnexpectedEOF
+				}
+				return err
+			}
+			line = bytes.TrimRight(line, "\r\n")
+			switch {
+			case len(line) == 0 && hasData:
+				// dispatch the event
+				switch event {
+				case "end":
+					return nil
+				case "error":
+					cerr := parseClientError(0, dat)
+					switch cerr.Type {
+					case "TimeoutError":
+						var e TimeoutError
+						if json.Unmarshal(cerr.Payload, &e) == nil {
+							cerr.Err = e
+						}
+					}
+					return cerr
+				case "", "message":
+					var elem uint64
+					if err := json.Unmarshal(dat, &elem); err != nil {
+						return err
+					}
+					if err := out(elem); err != nil {
+						return err
+					}
+				}
+				event, dat, hasData = "", nil, false
+			case len(line) == 0:
+				event = ""
+			case bytes.HasPrefix(line, []byte("event:")):
+				event = strings.TrimSpace(string(line[len("event:"):]))
+			case bytes.HasPrefix(line, []byte("data:")):
+				if hasData {
+					dat = append(dat, '\n')
+				}
+				dat = append(dat, bytes.TrimPrefix(line[len("data:"):], []byte(" "))...)
+				hasData = true
+			}
+		}
+	}
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), ndjsonContentType) {
+		jd := json.NewDecoder(resp.Body)
+		for {
+			var frame streamFrame
+			if err := jd.Decode(&frame); err != nil {
+				if err == io.EOF {
+					err = io.ErrUnexpectedEOF
+				}
+				return err
+			}
+			switch {
+			case frame.Error != nil:
+				dat := []byte(frame.Error)
+				cerr := parseClientError(0, dat)
+				switch cerr.Type {
+				case "TimeoutError":
+					var e TimeoutError
+					if json.Unmarshal(cerr.Payload, &e) == nil {
+						cerr.Err = e
+					}
+				}
+				return cerr
+			case frame.End:
+				return nil
+			}
+			var elem uint64
+			if err := json.Unmarshal(frame.Value, &elem); err != nil {
+				return err
+			}
+			if err := out(elem); err != nil {
+				return err
+			}
+		}
+	}
 	jd := json.NewDecoder(resp.Body)
 	brack, err := jd.Token()
 	if err != nil {
@@ -1016,3 +2961,358 @@ func (cli *MathClient) Factor(ctx context.Context, Composite uint64, out func(ui
 	return nil
 
 }
+
+// RunningSum reports the cumulative sum after each number in a stream.
+// Numbers is the stream of numbers to sum.
+// Sums are the partial sums of the numbers received so far.
+func (cli *MathClient) RunningSum(ctx context.Context, in func() (float64, error), out func(float64) error,
+) error {
+	start := time.Now()
+	call := &Call{
+		Op:   "RunningSum",
+		Args: map[string]interface{}{},
+	}
+	err := cli.intercept(ctx, call, func(ctx context.Context) error {
+		var err error
+		err = cli.invokeRunningSum(ctx, in, out)
+		return err
+	})
+	cli.observe("RunningSum", start, err)
+	return err
+}
+
+// invokeRunningSum runs the RunningSum operation without applying call interceptors.
+func (cli *MathClient) invokeRunningSum(ctx context.Context, in func() (float64, error), out func(float64) error,
+) error {
+
+	u, err := cli.Base.Parse("RunningSum")
+	if err != nil {
+		return err
+	}
+
+	hdr := http.Header{}
+	setMetadataHeaders(ctx, hdr)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	c, resp, err := cli.dialDuplex(ctx, u, hdr)
+	if err != nil {
+		return err
+	}
+	if resp != nil {
+		defer resp.Body.Close()
+		dat, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return &ClientError{StatusCode: resp.StatusCode, Message: resp.Status}
+		}
+		cerr := parseClientError(resp.StatusCode, dat)
+		return cerr
+	}
+	defer c.Abort()
+
+	// tear down the connection if the context is cancelled
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			c.Abort()
+		case <-stop:
+		}
+	}()
+
+	// send the input stream
+	var inErr error
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			elem, err := in()
+			if err != nil {
+				if err == io.EOF {
+					break
+				}
+				inErr = err
+				c.Abort()
+				return
+			}
+			dat, err := json.Marshal(elem)
+			if err != nil {
+				inErr = err
+				c.Abort()
+				return
+			}
+			if err := c.SendFrame(streamFrame{Value: dat}); err != nil {
+				return
+			}
+		}
+		c.SendFrame(streamFrame{End: true})
+	}()
+
+	// receive the output stream
+	var frame streamFrame
+	for {
+		frame = streamFrame{}
+		if err := c.ReadFrame(&frame); err != nil {
+			c.Abort()
+			wg.Wait()
+			if inErr != nil {
+				return inErr
+			}
+			return err
+		}
+		if frame.Error != nil || frame.End {
+			break
+		}
+		var elem float64
+		if err := json.Unmarshal(frame.Value, &elem); err != nil {
+			return err
+		}
+		if err := out(elem); err != nil {
+			return err
+		}
+	}
+	if frame.Error == nil {
+		return nil
+	}
+	dat := []byte(frame.Error)
+	cerr := parseClientError(0, dat)
+	return cerr
+}
+
+// Checksum computes the CRC-32 checksum of an uploaded file.
+// Table is the polynomial to use (ieee, castagnoli, or koopman).
+// Data is the file to checksum.
+// Checksum is the resulting checksum.
+// May return ErrUnknownTable.
+func (cli *MathClient) Checksum(ctx context.Context, Table string, Data io.Reader) (uint32, error) {
+	var r0 uint32
+	start := time.Now()
+	call := &Call{
+		Op: "Checksum",
+		Args: map[string]interface{}{
+			"Table": Table,
+		},
+	}
+	err := cli.intercept(ctx, call, func(ctx context.Context) error {
+		var err error
+		r0, err = cli.invokeChecksum(ctx, Table, Data)
+		if err == nil {
+			call.Results = map[string]interface{}{
+				"Checksum": r0,
+			}
+		}
+		return err
+	})
+	cli.observe("Checksum", start, err)
+	return r0, err
+}
+
+// invokeChecksum runs the Checksum operation without applying call interceptors.
+func (cli *MathClient) invokeChecksum(ctx context.Context, Table string, Data io.Reader) (uint32, error) {
+	if verr := validateMathChecksum(Table); verr != nil {
+		return 0, verr
+	}
+	u, err := cli.Base.Parse("Checksum")
+	if err != nil {
+		return 0, err
+	}
+
+	// the arguments are sent in the first part, followed by the upload
+	ipr, ipw := io.Pipe()
+	mw := multipart.NewWriter(ipw)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		aw, err := mw.CreateFormField("args")
+		if err != nil {
+			ipw.CloseWithError(err)
+			return
+		}
+		err = json.NewEncoder(aw).Encode(struct {
+			Table string `json:"Table,omitempty"`
+		}{
+			Table: Table,
+		})
+		if err != nil {
+			ipw.CloseWithError(err)
+			return
+		}
+		fw, err := mw.CreateFormFile("Data", "Data")
+		if err != nil {
+			ipw.CloseWithError(err)
+			return
+		}
+		if _, err := io.Copy(fw, Data); err != nil {
+			ipw.CloseWithError(err)
+			return
+		}
+		ipw.CloseWithError(mw.Close())
+	}()
+	defer ipr.Close()
+	req, err := http.NewRequest(http.MethodPost, u.String(), ipr)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+
+	if c := cli.codec(codec.JSON); c != codec.JSON {
+		req.Header.Set("Accept", c.ContentType()+", application/json")
+	}
+	setMetadataHeaders(ctx, req.Header)
+
+	if cli.Contextualize == nil {
+		req = req.WithContext(ctx)
+	} else {
+		cctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		req, err = cli.Contextualize(cctx, req)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	hcl := cli.httpClient()
+	resp, err := hcl.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		dat, eerr := ioutil.ReadAll(resp.Body)
+		if eerr != nil {
+			return 0, &ClientError{StatusCode: resp.StatusCode, Message: resp.Status}
+		}
+		cerr := parseClientError(resp.StatusCode, dat)
+		switch cerr.Type {
+		case "ErrUnknownTable":
+			var e ErrUnknownTable
+			if json.Unmarshal(cerr.Payload, &e) == nil {
+				cerr.Err = e
+			}
+		case "ValidationError":
+			var e ValidationError
+			if json.Unmarshal(cerr.Payload, &e) == nil {
+				cerr.Err = &e
+			}
+		}
+		return 0, cerr
+	}
+
+	bdat, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return 0, err
+	}
+
+	var outputs struct {
+		Checksum uint32 `json:"Checksum,omitempty"`
+	}
+	if c, ok := codec.ByContentType(resp.Header.Get("Content-Type")); ok {
+		err = c.Unmarshal(bdat, &outputs)
+	} else {
+		err = json.Unmarshal(bdat, &outputs)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return outputs.Checksum, nil
+
+}
+
+// Primes downloads a table of prime numbers.
+// Limit is the largest number to consider.
+// Table is a newline-separated list of the primes up to the limit.
+func (cli *MathClient) Primes(ctx context.Context, Limit uint64, out io.Writer,
+) error {
+	start := time.Now()
+	call := &Call{
+		Op: "Primes",
+		Args: map[string]interface{}{
+			"Limit": Limit,
+		},
+	}
+	err := cli.intercept(ctx, call, func(ctx context.Context) error {
+		var err error
+		err = cli.invokePrimes(ctx, Limit, out)
+		return err
+	})
+	cli.observe("Primes", start, err)
+	return err
+}
+
+// invokePrimes runs the Primes operation without applying call interceptors.
+func (cli *MathClient) invokePrimes(ctx context.Context, Limit uint64, out io.Writer,
+) error {
+	if verr := validateMathPrimes(Limit); verr != nil {
+		return verr
+	}
+	u, err := cli.Base.Parse("Primes")
+	if err != nil {
+		return err
+	}
+
+	q := u.Query()
+	if err := func() error {
+		if err := queryAdd(q, "Limit", Limit); err != nil {
+			return err
+		}
+
+		return nil
+	}(); err != nil {
+		return err
+	}
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return err
+	}
+
+	setMetadataHeaders(ctx, req.Header)
+
+	if cli.Contextualize == nil {
+		req = req.WithContext(ctx)
+	} else {
+		cctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		req, err = cli.Contextualize(cctx, req)
+		if err != nil {
+			return err
+		}
+	}
+
+	hcl := cli.httpClient()
+	resp, err := hcl.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		dat, eerr := ioutil.ReadAll(resp.Body)
+		if eerr != nil {
+			return &ClientError{StatusCode: resp.StatusCode, Message: resp.Status}
+		}
+		cerr := parseClientError(resp.StatusCode, dat)
+		switch cerr.Type {
+		case "ValidationError":
+			var e ValidationError
+			if json.Unmarshal(cerr.Payload, &e) == nil {
+				cerr.Err = &e
+			}
+		}
+		return cerr
+	}
+
+	_, err = io.Copy(out, resp.Body)
+	if err != nil {
+		return err
+	}
+	return nil
+
+}
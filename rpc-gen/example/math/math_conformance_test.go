@@ -0,0 +1,479 @@
+// rpc-gen input hash: ff32a1cd66bac41241d9e6b7cbc5377f8146082dfdaf9c072b63dabbe4a9179b
+
+package math
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+var _ = io.EOF
+
+// conformanceCall is a call to a fake implementation, as recorded by a conformance wrapper.
+type conformanceCall struct {
+	// Args are the inputs which are not streamed, in order.
+	Args []interface{}
+
+	// In and InBytes are the elements and data read from the input stream.
+	In      []interface{}
+	InBytes []byte
+
+	// Results are the outputs which are not streamed, in order.
+	Results []interface{}
+
+	// Out and OutBytes are the elements and data written to the output stream.
+	Out      []interface{}
+	OutBytes []byte
+
+	// Wrote is whether anything was written to the output stream.
+	Wrote bool
+
+	// Err is the error returned by the fake implementation.
+	Err error
+}
+
+// conformanceSampler fills values with distinct samples, so that mixed up arguments are detected.
+type conformanceSampler struct {
+	n int
+}
+
+// fill sets the value pointed to by v to a sample, populating every exported field.
+func (s *conformanceSampler) fill(v interface{}) {
+	s.fillValue(reflect.ValueOf(v).Elem(), 0)
+}
+
+func (s *conformanceSampler) fillValue(v reflect.Value, depth int) {
+	if depth > 3 {
+		// recursive types are cut off with zero values
+		return
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		v.SetBool(true)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		s.n++
+		v.SetInt(int64(s.n%100 + 1))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		s.n++
+		v.SetUint(uint64(s.n%100 + 1))
+	case reflect.Float32, reflect.Float64:
+		s.n++
+		v.SetFloat(float64(s.n) + 0.5)
+	case reflect.String:
+		s.n++
+		v.SetString(fmt.Sprintf("sample%c", 'a'+s.n%26))
+	case reflect.Slice:
+		sl := reflect.MakeSlice(v.Type(), 2, 2)
+		for i := 0; i < sl.Len(); i++ {
+			s.fillValue(sl.Index(i), depth+1)
+		}
+		v.Set(sl)
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			s.fillValue(v.Index(i), depth+1)
+		}
+	case reflect.Map:
+		m := reflect.MakeMap(v.Type())
+		key := reflect.New(v.Type().Key()).Elem()
+		s.fillValue(key, depth+1)
+		val := reflect.New(v.Type().Elem()).Elem()
+		s.fillValue(val, depth+1)
+		m.SetMapIndex(key, val)
+		v.Set(m)
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).PkgPath == "" {
+				s.fillValue(v.Field(i), depth+1)
+			}
+		}
+	case reflect.Ptr:
+		p := reflect.New(v.Type().Elem())
+		s.fillValue(p.Elem(), depth+1)
+		v.Set(p)
+	}
+}
+
+// conformanceEqual checks whether two values are equivalent once encoded as JSON.
+func conformanceEqual(x, y interface{}) bool {
+	if reflect.DeepEqual(x, y) {
+		return true
+	}
+	xdat, xerr := json.Marshal(x)
+	ydat, yerr := json.Marshal(y)
+	return xerr == nil && yerr == nil && bytes.Equal(xdat, ydat)
+}
+
+// conformanceCompare checks that the values received on one side of a call match those sent by the other.
+// If partial is set, the received values may be a prefix of those sent.
+func conformanceCompare(t *testing.T, what string, sent, received []interface{}, partial bool) {
+	t.Helper()
+	if len(received) != len(sent) && !(partial && len(received) < len(sent)) {
+		t.Errorf("%s: %d values were sent, but %d were received", what, len(sent), len(received))
+		return
+	}
+	for i, v := range received {
+		if !conformanceEqual(sent[i], v) {
+			t.Errorf("%s: %#v was sent at index %d, but %#v was received", what, sent[i], i, v)
+		}
+	}
+}
+
+// conformanceCompareBytes checks that the data received on one side of a call matches that sent by the other.
+// If partial is set, the received data may be a prefix of that sent.
+func conformanceCompareBytes(t *testing.T, what string, sent, received []byte, partial bool) {
+	t.Helper()
+	if !bytes.Equal(sent, received) && !(partial && bytes.HasPrefix(sent, received)) {
+		t.Errorf("%s: %q was sent, but %q was received", what, sent, received)
+	}
+}
+
+// conformanceCheckErr checks that the error received by the client matches the error returned by the fake implementation.
+// If exact is not set, the error occurred after the output stream had started, and may not have been propagated.
+func conformanceCheckErr(t *testing.T, want, got error, exact bool) {
+	t.Helper()
+	switch {
+	case want == nil && got == nil:
+	case want == nil:
+		t.Errorf("unexpected error: %v", got)
+	case !exact:
+		t.Logf("the error %q was returned after the output stream started, and %v was received", want, got)
+	case got == nil:
+		t.Errorf("expected error %q, but the call succeeded", want)
+	default:
+		target := reflect.New(reflect.TypeOf(want))
+		if errors.As(got, target.Interface()) {
+			if !conformanceEqual(target.Elem().Interface(), want) {
+				t.Errorf("expected error %#v; got %#v", want, target.Elem().Interface())
+			}
+			return
+		}
+		var cerr *ClientError
+		if !errors.As(got, &cerr) || cerr.Message != want.Error() {
+			t.Errorf("expected error %q; got %v", want, got)
+		}
+	}
+}
+
+// conformanceMath wraps the fake implementation of Math, recording the last call.
+type conformanceMath struct {
+	impl Math
+
+	lock sync.Mutex
+	last conformanceCall
+}
+
+func (c *conformanceMath) record(call conformanceCall) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.last = call
+}
+
+// take returns the last call, and clears it.
+func (c *conformanceMath) take() conformanceCall {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	call := c.last
+	c.last = conformanceCall{}
+	return call
+}
+
+// Add records the call and invokes the fake implementation.
+func (c *conformanceMath) Add(ctx context.Context, X uint32, Y uint32) (Sum uint32, err error) {
+	var rec conformanceCall
+	rec.Args = []interface{}{X, Y}
+	Sum, err = c.impl.Add(ctx, X, Y)
+	rec.Results = []interface{}{Sum}
+	rec.Err = err
+	c.record(rec)
+	return Sum, err
+}
+
+// Divide records the call and invokes the fake implementation.
+func (c *conformanceMath) Divide(ctx context.Context, X uint32, Y uint32) (Quotient uint32, Remainder uint32, err error) {
+	var rec conformanceCall
+	rec.Args = []interface{}{X, Y}
+	Quotient, Remainder, err = c.impl.Divide(ctx, X, Y)
+	rec.Results = []interface{}{Quotient, Remainder}
+	rec.Err = err
+	c.record(rec)
+	return Quotient, Remainder, err
+}
+
+// Statistics records the call and invokes the fake implementation.
+func (c *conformanceMath) Statistics(ctx context.Context, Data []float64) (Results Stats, err error) {
+	var rec conformanceCall
+	rec.Args = []interface{}{Data}
+	Results, err = c.impl.Statistics(ctx, Data)
+	rec.Results = []interface{}{Results}
+	rec.Err = err
+	c.record(rec)
+	return Results, err
+}
+
+// Sum records the call and invokes the fake implementation.
+func (c *conformanceMath) Sum(ctx context.Context, Numbers func() (float64, error)) (Result float64, err error) {
+	var rec conformanceCall
+	rec.Args = []interface{}{}
+	recIn := Numbers
+	Numbers = func() (float64, error) {
+		v, err := recIn()
+		if err == nil {
+			rec.In = append(rec.In, v)
+		}
+		return v, err
+	}
+	Result, err = c.impl.Sum(ctx, Numbers)
+	rec.Results = []interface{}{Result}
+	rec.Err = err
+	c.record(rec)
+	return Result, err
+}
+
+// Factor records the call and invokes the fake implementation.
+func (c *conformanceMath) Factor(ctx context.Context, Composite uint64, Factors func(uint64) error) error {
+	var rec conformanceCall
+	rec.Args = []interface{}{Composite}
+	recOut := Factors
+	Factors = func(v uint64) error {
+		rec.Wrote = true
+		rec.Out = append(rec.Out, v)
+		return recOut(v)
+	}
+	err := c.impl.Factor(ctx, Composite, Factors)
+	rec.Err = err
+	c.record(rec)
+	return err
+}
+
+// RunningSum records the call and invokes the fake implementation.
+func (c *conformanceMath) RunningSum(ctx context.Context, Numbers func() (float64, error), Sums func(float64) error) error {
+	var rec conformanceCall
+	rec.Args = []interface{}{}
+	recIn := Numbers
+	Numbers = func() (float64, error) {
+		v, err := recIn()
+		if err == nil {
+			rec.In = append(rec.In, v)
+		}
+		return v, err
+	}
+	recOut := Sums
+	Sums = func(v float64) error {
+		rec.Wrote = true
+		rec.Out = append(rec.Out, v)
+		return recOut(v)
+	}
+	err := c.impl.RunningSum(ctx, Numbers, Sums)
+	rec.Err = err
+	c.record(rec)
+	return err
+}
+
+// Checksum records the call and invokes the fake implementation.
+func (c *conformanceMath) Checksum(ctx context.Context, Table string, Data io.Reader) (Checksum uint32, err error) {
+	var rec conformanceCall
+	rec.Args = []interface{}{Table}
+	var recInBuf bytes.Buffer
+	Data = io.TeeReader(Data, &recInBuf)
+	Checksum, err = c.impl.Checksum(ctx, Table, Data)
+	rec.Results = []interface{}{Checksum}
+	rec.InBytes = recInBuf.Bytes()
+	rec.Err = err
+	c.record(rec)
+	return Checksum, err
+}
+
+// Primes records the call and invokes the fake implementation.
+func (c *conformanceMath) Primes(ctx context.Context, Limit uint64, Table io.Writer) error {
+	var rec conformanceCall
+	rec.Args = []interface{}{Limit}
+	var recOutBuf bytes.Buffer
+	Table = io.MultiWriter(Table, &recOutBuf)
+	err := c.impl.Primes(ctx, Limit, Table)
+	rec.OutBytes = recOutBuf.Bytes()
+	rec.Wrote = len(rec.OutBytes) != 0
+	rec.Err = err
+	c.record(rec)
+	return err
+}
+
+// TestMathConformance runs each operation of Math through the generated client and HTTP handler, with sample arguments.
+// It checks that the arguments, results, and errors of each call are carried through unchanged.
+// The fake implementation is created by newMathFake, which must be defined in a hand-written test file of the package.
+// A MockMath may be used as the fake.
+func TestMathConformance(t *testing.T) {
+	fake := &conformanceMath{impl: newMathFake(t)}
+	srv := httptest.NewServer(NewHTTPMathHandler(fake, nil))
+	defer srv.Close()
+	cli, err := NewMathClient(srv.URL, ClientOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	var sample conformanceSampler
+
+	t.Run("Add", func(t *testing.T) {
+		var a0 uint32
+		sample.fill(&a0)
+		var a1 uint32
+		sample.fill(&a1)
+
+		r0, err := cli.Add(ctx, a0, a1)
+		call := fake.take()
+		conformanceCheckErr(t, call.Err, err, !call.Wrote)
+		conformanceCompare(t, "arguments", []interface{}{a0, a1}, call.Args, false)
+		if err == nil {
+			conformanceCompare(t, "results", call.Results, []interface{}{r0}, false)
+		}
+	})
+
+	t.Run("Divide", func(t *testing.T) {
+		var a0 uint32
+		sample.fill(&a0)
+		var a1 uint32
+		sample.fill(&a1)
+
+		r0, r1, err := cli.Divide(ctx, a0, a1)
+		call := fake.take()
+		conformanceCheckErr(t, call.Err, err, !call.Wrote)
+		conformanceCompare(t, "arguments", []interface{}{a0, a1}, call.Args, false)
+		if err == nil {
+			conformanceCompare(t, "results", call.Results, []interface{}{r0, r1}, false)
+		}
+	})
+
+	t.Run("Statistics", func(t *testing.T) {
+		var a0 []float64
+		sample.fill(&a0)
+		if verr := validateMathStatistics(a0); verr != nil {
+			t.Skipf("the sample arguments are invalid: %v", verr)
+		}
+
+		r0, err := cli.Statistics(ctx, a0)
+		call := fake.take()
+		conformanceCheckErr(t, call.Err, err, !call.Wrote)
+		conformanceCompare(t, "arguments", []interface{}{a0}, call.Args, false)
+		if err == nil {
+			conformanceCompare(t, "results", call.Results, []interface{}{r0}, false)
+		}
+	})
+
+	t.Run("Sum", func(t *testing.T) {
+		in := make([]float64, 3)
+		for i := range in {
+			sample.fill(&in[i])
+		}
+		next := 0
+		inFunc := func() (float64, error) {
+			if next == len(in) {
+				var zero float64
+				return zero, io.EOF
+			}
+			next++
+			return in[next-1], nil
+		}
+
+		r0, err := cli.Sum(ctx, inFunc)
+		call := fake.take()
+		conformanceCheckErr(t, call.Err, err, !call.Wrote)
+		conformanceCompare(t, "arguments", []interface{}{}, call.Args, false)
+		sent := make([]interface{}, len(in))
+		for i, v := range in {
+			sent[i] = v
+		}
+		conformanceCompare(t, "input stream", sent, call.In, true)
+		if err == nil {
+			conformanceCompare(t, "results", call.Results, []interface{}{r0}, false)
+		}
+	})
+
+	t.Run("Factor", func(t *testing.T) {
+		var a0 uint64
+		sample.fill(&a0)
+		var out []interface{}
+		outFunc := func(v uint64) error {
+			out = append(out, v)
+			return nil
+		}
+
+		err := cli.Factor(ctx, a0, outFunc)
+		call := fake.take()
+		conformanceCheckErr(t, call.Err, err, true)
+		conformanceCompare(t, "arguments", []interface{}{a0}, call.Args, false)
+		conformanceCompare(t, "output stream", call.Out, out, err != nil)
+	})
+
+	t.Run("RunningSum", func(t *testing.T) {
+		in := make([]float64, 3)
+		for i := range in {
+			sample.fill(&in[i])
+		}
+		next := 0
+		inFunc := func() (float64, error) {
+			if next == len(in) {
+				var zero float64
+				return zero, io.EOF
+			}
+			next++
+			return in[next-1], nil
+		}
+		var out []interface{}
+		outFunc := func(v float64) error {
+			out = append(out, v)
+			return nil
+		}
+
+		err := cli.RunningSum(ctx, inFunc, outFunc)
+		call := fake.take()
+		conformanceCheckErr(t, call.Err, err, true)
+		conformanceCompare(t, "arguments", []interface{}{}, call.Args, false)
+		sent := make([]interface{}, len(in))
+		for i, v := range in {
+			sent[i] = v
+		}
+		conformanceCompare(t, "input stream", sent, call.In, true)
+		conformanceCompare(t, "output stream", call.Out, out, err != nil)
+	})
+
+	t.Run("Checksum", func(t *testing.T) {
+		var a0 string
+		sample.fill(&a0)
+		inData := []byte("rpc-gen conformance sample")
+		if verr := validateMathChecksum(a0); verr != nil {
+			t.Skipf("the sample arguments are invalid: %v", verr)
+		}
+
+		r0, err := cli.Checksum(ctx, a0, bytes.NewReader(inData))
+		call := fake.take()
+		conformanceCheckErr(t, call.Err, err, !call.Wrote)
+		conformanceCompare(t, "arguments", []interface{}{a0}, call.Args, false)
+		conformanceCompareBytes(t, "input stream", inData, call.InBytes, true)
+		if err == nil {
+			conformanceCompare(t, "results", call.Results, []interface{}{r0}, false)
+		}
+	})
+
+	t.Run("Primes", func(t *testing.T) {
+		var a0 uint64
+		sample.fill(&a0)
+		if verr := validateMathPrimes(a0); verr != nil {
+			t.Skipf("the sample arguments are invalid: %v", verr)
+		}
+		var outBuf bytes.Buffer
+
+		err := cli.Primes(ctx, a0, &outBuf)
+		call := fake.take()
+		conformanceCheckErr(t, call.Err, err, !call.Wrote)
+		conformanceCompare(t, "arguments", []interface{}{a0}, call.Args, false)
+		conformanceCompareBytes(t, "output stream", call.OutBytes, outBuf.Bytes(), err != nil)
+	})
+
+}
@@ -0,0 +1,76 @@
+package notes
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// newNotesFake creates the fake implementation used by TestNotesConformance.
+func newNotesFake(t *testing.T) Notes {
+	return &fakeNotes{}
+}
+
+// fakeNotes is a simple in-memory implementation of Notes.
+// Unlike a real implementation, Watch delivers the notes which were already added and then ends, so that calls to it finish.
+type fakeNotes struct {
+	mu    sync.Mutex
+	notes []Note
+}
+
+func (f *fakeNotes) Create(ctx context.Context, Text string) (Note, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	note := Note{ID: uint64(len(f.notes) + 1), Text: Text}
+	f.notes = append(f.notes, note)
+	return note, nil
+}
+
+func (f *fakeNotes) List(ctx context.Context, Prefix string, Cursor string, Limit uint32) ([]Note, string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	start := 0
+	if Cursor != "" {
+		var err error
+		start, err = strconv.Atoi(Cursor)
+		if err != nil || start < 0 || start > len(f.notes) {
+			return nil, "", fmt.Errorf("invalid cursor %q", Cursor)
+		}
+	}
+	if Limit == 0 {
+		Limit = 10
+	}
+	var page []Note
+	i := start
+	for ; i < len(f.notes) && len(page) < int(Limit); i++ {
+		if strings.HasPrefix(f.notes[i].Text, Prefix) {
+			page = append(page, f.notes[i])
+		}
+	}
+	var next string
+	if i < len(f.notes) {
+		next = strconv.Itoa(i)
+	}
+	return page, next, nil
+}
+
+func (f *fakeNotes) Watch(ctx context.Context, Notes func(Note) error) error {
+	f.mu.Lock()
+	notes := append([]Note(nil), f.notes...)
+	f.mu.Unlock()
+	for _, note := range notes {
+		if err := Notes(note); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *fakeNotes) Count(ctx context.Context) (uint64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return uint64(len(f.notes)), nil
+}
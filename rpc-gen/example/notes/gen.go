@@ -0,0 +1,4 @@
+package notes
+
+//go:generate go run ../.. -trace
+//go:generate go run ../.. -tmpl go-conformance
@@ -0,0 +1,2328 @@
+// rpc-gen input hash: a0ebcf546a9facb160c77f220922dcf6e7ebf1d311afa52d532372e264945a22
+
+package notes
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/niaow/exp/rpc-gen/tracing"
+	"github.com/niaow/exp/ws"
+)
+
+var _ = bytes.NewReader
+var _ = sync.NewCond
+var _ = bufio.NewWriter
+var _ = io.Pipe
+var _ = ioutil.ReadAll
+var _ = net.Dial
+var _ = url.Parse
+var _ = multipart.NewWriter
+var _ = regexp.MustCompile
+var _ = strconv.Itoa
+var _ = strings.HasPrefix
+var _ = time.Second
+var _ = utf8.RuneCountInString
+var _ = rand.Reader
+var _ = sha256.New
+var _ = hex.EncodeToString
+
+// Notes is a system to keep notes for authenticated users.
+type Notes interface {
+	// Create adds a note.
+	// Text is the content of the note.
+	// Added is the note which was added.
+	Create(ctx context.Context, Text string) (Added Note, err error)
+
+	// List lists the notes in the order in which they were added.
+	// Prefix selects the notes with text starting with the prefix.
+	// Cursor is the position at which the page starts, as returned in NextCursor.
+	// The first page is requested with an empty cursor.
+	// Limit is the maximum number of items in the page.
+	// If zero, the server chooses the limit.
+	// Notes are the notes in the page.
+	// NextCursor is the cursor of the next page, or empty if this is the last page.
+	List(ctx context.Context, Prefix string, Cursor string, Limit uint32) (Notes []Note, NextCursor string, err error)
+
+	// Watch delivers the notes which are added after the subscription starts.
+	// Notes are the notes which are added.
+	Watch(ctx context.Context, Notes func(Note) error) error
+
+	// Count counts the notes, without authentication.
+	// Count is the number of notes.
+	Count(ctx context.Context) (Count uint64, err error)
+}
+
+// MockNotes is a mock implementation of Notes, intended for testing code which uses the interface.
+// Each operation records the call and then invokes the corresponding function field.
+// If the function field is nil, the operation fails with an error.
+type MockNotes struct {
+	// CreateFunc is invoked by Create.
+	CreateFunc func(ctx context.Context, Text string) (Added Note, err error)
+
+	// ListFunc is invoked by List.
+	ListFunc func(ctx context.Context, Prefix string, Cursor string, Limit uint32) (Notes []Note, NextCursor string, err error)
+
+	// WatchFunc is invoked by Watch.
+	WatchFunc func(ctx context.Context, Notes func(Note) error) error
+
+	// CountFunc is invoked by Count.
+	CountFunc func(ctx context.Context) (Count uint64, err error)
+
+	lock  sync.Mutex
+	calls []Call
+}
+
+var _ Notes = (*MockNotes)(nil)
+
+// recordCall records a call to the mock.
+func (m *MockNotes) recordCall(call Call) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.calls = append(m.calls, call)
+}
+
+// MockCalls returns all calls recorded by the mock, in the order in which they were made.
+// The mock helpers are prefixed with Mock so that they cannot collide with the operations.
+func (m *MockNotes) MockCalls() []Call {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return append([]Call(nil), m.calls...)
+}
+
+// MockCallsTo returns the calls recorded by the mock to the specified operation.
+func (m *MockNotes) MockCallsTo(op string) []Call {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	var calls []Call
+	for _, c := range m.calls {
+		if c.Op == op {
+			calls = append(calls, c)
+		}
+	}
+	return calls
+}
+
+// MockReset clears the recorded calls.
+func (m *MockNotes) MockReset() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.calls = nil
+}
+
+// Create records the call and invokes CreateFunc.
+func (m *MockNotes) Create(ctx context.Context, Text string) (Added Note, err error) {
+	m.recordCall(Call{
+		Op: "Create",
+		Args: map[string]interface{}{
+			"Text": Text,
+		},
+	})
+	if m.CreateFunc == nil {
+		return Note{}, errors.New("MockNotes.CreateFunc is not set")
+	}
+	return m.CreateFunc(ctx, Text)
+}
+
+// List records the call and invokes ListFunc.
+func (m *MockNotes) List(ctx context.Context, Prefix string, Cursor string, Limit uint32) (Notes []Note, NextCursor string, err error) {
+	m.recordCall(Call{
+		Op: "List",
+		Args: map[string]interface{}{
+			"Prefix": Prefix,
+			"Cursor": Cursor,
+			"Limit":  Limit,
+		},
+	})
+	if m.ListFunc == nil {
+		return []Note{}, "", errors.New("MockNotes.ListFunc is not set")
+	}
+	return m.ListFunc(ctx, Prefix, Cursor, Limit)
+}
+
+// Watch records the call and invokes WatchFunc.
+func (m *MockNotes) Watch(ctx context.Context, Notes func(Note) error) error {
+	m.recordCall(Call{
+		Op:   "Watch",
+		Args: map[string]interface{}{},
+	})
+	if m.WatchFunc == nil {
+		return errors.New("MockNotes.WatchFunc is not set")
+	}
+	return m.WatchFunc(ctx, Notes)
+}
+
+// Count records the call and invokes CountFunc.
+func (m *MockNotes) Count(ctx context.Context) (Count uint64, err error) {
+	m.recordCall(Call{
+		Op:   "Count",
+		Args: map[string]interface{}{},
+	})
+	if m.CountFunc == nil {
+		return 0, errors.New("MockNotes.CountFunc is not set")
+	}
+	return m.CountFunc(ctx)
+}
+
+// Note is a note kept by the system.
+type Note struct {
+	// ID identifies the note.
+	ID uint64 `json:"ID"`
+
+	// Text is the content of the note.
+	Text string `json:"Text,omitempty"`
+}
+
+// ErrorCode is a machine-readable code identifying an error, which is independent of the HTTP status.
+type ErrorCode string
+
+// rpcError is a container used to transmit errors across http.
+type rpcError struct {
+	Message   string      `json:"message"`
+	Type      string      `json:"type,omitempty"`
+	Data      interface{} `json:"dat,omitempty"`
+	ErrorCode ErrorCode   `json:"code,omitempty"`
+	Code      int         `json:"-"`
+}
+
+func (re rpcError) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	msg := re.Message
+	if dat, err := json.Marshal(re); err == nil {
+		msg = string(dat)
+	}
+	http.Error(w, msg, re.Code)
+}
+
+// ValidationError is an error indicating that a request did not satisfy the constraints of the spec.
+// This corresponds to the HTTP status code 400 "Bad Request".
+type ValidationError struct {
+	// Field is the path of the invalid argument or field.
+	Field string `json:"field"`
+
+	// Reason is a description of the constraint which was not satisfied.
+	Reason string `json:"reason"`
+}
+
+func (err ValidationError) Error() string {
+	return fmt.Sprintf("invalid %s: %s", err.Field, err.Reason)
+}
+
+// rpcError converts the error into a transferrable container.
+func (err ValidationError) rpcError() rpcError {
+	return rpcError{
+		Message: err.Error(),
+		Type:    "ValidationError",
+		Data:    err,
+		Code:    http.StatusBadRequest,
+	}
+}
+
+// ServeHTTP sends the error over HTTP.
+func (err ValidationError) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	err.rpcError().ServeHTTP(w, r)
+}
+
+// within prefixes the field path of the error with the path of the enclosing value.
+func (err *ValidationError) within(path string) *ValidationError {
+	if strings.HasPrefix(err.Field, "[") {
+		err.Field = path + err.Field
+	} else {
+		err.Field = path + "." + err.Field
+	}
+	return err
+}
+
+// RateLimitError is an error indicating that a client has exceeded the rate limit of an operation.
+// This corresponds to the HTTP status code 429 "Too Many Requests".
+type RateLimitError struct {
+	// Op is the name of the operation.
+	Op string `json:"op"`
+
+	// RetryAfter is the number of seconds to wait before retrying the call.
+	RetryAfter uint32 `json:"retryAfter"`
+}
+
+func (err RateLimitError) Error() string {
+	return fmt.Sprintf("rate limit of %s exceeded, retry after %ds", err.Op, err.RetryAfter)
+}
+
+// rpcError converts the error into a transferrable container.
+func (err RateLimitError) rpcError() rpcError {
+	return rpcError{
+		Message: err.Error(),
+		Type:    "RateLimitError",
+		Data:    err,
+		Code:    http.StatusTooManyRequests,
+	}
+}
+
+// ServeHTTP sends the error over HTTP.
+// The delay is also sent in the Retry-After header.
+func (err RateLimitError) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Retry-After", fmt.Sprint(err.RetryAfter))
+	err.rpcError().ServeHTTP(w, r)
+}
+
+// UnauthorizedError is an error indicating that a call to an operation which requires authentication did not present valid credentials.
+// This corresponds to the HTTP status code 401 "Unauthorized".
+type UnauthorizedError struct {
+	// Op is the name of the operation.
+	Op string `json:"op"`
+
+	// Scheme is the authentication scheme required by the operation, which is "bearer" or "apikey".
+	Scheme string `json:"scheme"`
+
+	// Reason is the reason the credentials were rejected.
+	Reason string `json:"reason"`
+}
+
+func (err UnauthorizedError) Error() string {
+	return fmt.Sprintf("unauthorized call to %s: %s", err.Op, err.Reason)
+}
+
+// rpcError converts the error into a transferrable container.
+func (err UnauthorizedError) rpcError() rpcError {
+	return rpcError{
+		Message: err.Error(),
+		Type:    "UnauthorizedError",
+		Data:    err,
+		Code:    http.StatusUnauthorized,
+	}
+}
+
+// ServeHTTP sends the error over HTTP.
+// Bearer token challenges are sent in the WWW-Authenticate header.
+func (err UnauthorizedError) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err.Scheme == "bearer" {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+	}
+	err.rpcError().ServeHTTP(w, r)
+}
+
+// callOutcome describes the outcome of a call for metrics and tracing.
+// Errors declared in the spec are identified by their type names, and other errors are reported as "error".
+func callOutcome(err error) string {
+	if err == nil {
+		return "ok"
+	}
+	var rerr interface{ rpcError() rpcError }
+	if errors.As(err, &rerr) {
+		return rerr.rpcError().Type
+	}
+	return "error"
+}
+
+// Metadata is a set of key/value pairs which is sent alongside calls, such as a trace ID or a tenant ID.
+// The keys are canonicalized in the same way as HTTP header names.
+// Each pair is transmitted as an HTTP header named with the key prefixed by "X-RPC-Meta-".
+type Metadata map[string]string
+
+// metadataHeaderPrefix is the canonical prefix of the HTTP headers used to transmit metadata.
+const metadataHeaderPrefix = "X-Rpc-Meta-"
+
+// metadataKey is the context key used to store Metadata.
+type metadataKey struct{}
+
+// WithMetadata returns a copy of the context with the metadata attached.
+// The metadata is merged with any metadata attached to the parent context, replacing entries with the same keys.
+// Clients send the metadata attached to the context of a call, and servers attach the received metadata to the context of the operation.
+func WithMetadata(ctx context.Context, md Metadata) context.Context {
+	merged := Metadata{}
+	for k, v := range MetadataFromContext(ctx) {
+		merged[k] = v
+	}
+	for k, v := range md {
+		merged[http.CanonicalHeaderKey(k)] = v
+	}
+	return context.WithValue(ctx, metadataKey{}, merged)
+}
+
+// MetadataFromContext returns the metadata attached to the context.
+// The returned map must not be modified.
+func MetadataFromContext(ctx context.Context) Metadata {
+	md, _ := ctx.Value(metadataKey{}).(Metadata)
+	return md
+}
+
+// setMetadataHeaders adds the metadata attached to the context to a set of HTTP headers.
+func setMetadataHeaders(ctx context.Context, h http.Header) {
+	for k, v := range MetadataFromContext(ctx) {
+		h.Set(metadataHeaderPrefix+k, v)
+	}
+}
+
+// metadataContext attaches the metadata sent in a request to the context.
+func metadataContext(ctx context.Context, r *http.Request) context.Context {
+	var md Metadata
+	for k, v := range r.Header {
+		if !strings.HasPrefix(k, metadataHeaderPrefix) || len(k) == len(metadataHeaderPrefix) || len(v) == 0 {
+			continue
+		}
+		if md == nil {
+			md = Metadata{}
+		}
+		md[k[len(metadataHeaderPrefix):]] = v[0]
+	}
+	if md == nil {
+		return ctx
+	}
+	return WithMetadata(ctx, md)
+}
+
+// idempotencyHeader is the HTTP header carrying the idempotency key of a call.
+const idempotencyHeader = "Idempotency-Key"
+
+// idempotencyKey is the context key used to store the idempotency key of a call.
+type idempotencyKey struct{}
+
+// WithIdempotencyKey returns a copy of the context carrying an idempotency key.
+// Clients send the key with calls to operations which do not use the GET or HEAD methods and do not stream.
+// By default, clients generate a new key for each call, which is reused when the call is retried by an interceptor.
+// A key may be set explicitly in order to deduplicate calls which are retried by the application.
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKey{}, key)
+}
+
+// withCallIdempotencyKey returns a copy of the context carrying a newly generated idempotency key, unless it already carries one.
+func withCallIdempotencyKey(ctx context.Context) context.Context {
+	if _, ok := ctx.Value(idempotencyKey{}).(string); ok {
+		return ctx
+	}
+	var key [16]byte
+	if _, err := rand.Read(key[:]); err != nil {
+		return ctx
+	}
+	return WithIdempotencyKey(ctx, fmt.Sprintf("%x", key))
+}
+
+// validationPatterns are the compiled patterns used to validate string arguments.
+var validationPatterns = map[string]*regexp.Regexp{}
+
+// validateNotesCreate checks that the inputs to Notes.Create satisfy the constraints of the spec.
+func validateNotesCreate(Text string) *ValidationError {
+	if utf8.RuneCountInString(string(Text)) > 1000 {
+		return &ValidationError{Field: "Text", Reason: "must be at most 1000 characters"}
+	}
+
+	return nil
+}
+
+// ndjsonContentType is the content type of streams of newline-delimited JSON frames.
+const ndjsonContentType = "application/x-ndjson"
+
+// streamFrame is a control or data message in a stream of frames.
+// Stream elements are sent as JSON in the Value field.
+// The stream is terminated by a frame which either sets End or carries an error.
+type streamFrame struct {
+	Value json.RawMessage `json:"value,omitempty"`
+	Error json.RawMessage `json:"error,omitempty"`
+	End   bool            `json:"end,omitempty"`
+}
+
+// queryAdd adds a JSON-encoded value to a set of query parameters.
+func queryAdd(q url.Values, key string, v interface{}) error {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	q.Add(key, string(raw))
+	return nil
+}
+
+// queryValue decodes the value of a query parameter.
+// If the parameter is missing, dst is left unchanged.
+func queryValue(q url.Values, key string, dst interface{}) error {
+	switch vals := q[key]; len(vals) {
+	case 0:
+		return nil
+	case 1:
+		return queryDecode(key, vals[0], dst)
+	default:
+		return fmt.Errorf("argument %q duplicated", key)
+	}
+}
+
+// queryDecode decodes a JSON-encoded query parameter value.
+// Values which are JSON strings may also be sent unquoted.
+func queryDecode(key string, raw string, dst interface{}) error {
+	err := json.Unmarshal([]byte(raw), dst)
+	if err != nil {
+		quoted, _ := json.Marshal(raw)
+		if json.Unmarshal(quoted, dst) == nil {
+			return nil
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("argument %q: %w", key, err)
+	}
+	return nil
+}
+
+// queryLen finds the length of an array sent in bracket notation, from the largest index of its elements.
+// Each element must be sent with at least one parameter, so indices are limited by the number of parameters.
+func queryLen(q url.Values, key string) (int, error) {
+	n := 0
+	for k := range q {
+		if !strings.HasPrefix(k, key+"[") {
+			continue
+		}
+		idx := k[len(key)+1:]
+		end := strings.IndexByte(idx, ']')
+		if end < 0 {
+			continue
+		}
+		i, err := strconv.Atoi(idx[:end])
+		if err != nil || i < 0 || i >= len(q) {
+			return 0, fmt.Errorf("argument %q has an invalid index", k)
+		}
+		if i >= n {
+			n = i + 1
+		}
+	}
+	return n, nil
+}
+
+// Call describes an operation invocation, as seen by client call interceptors and recorded by mocks.
+type Call struct {
+	// Op is the name of the operation.
+	Op string
+
+	// Args are the inputs to the operation, keyed by name.
+	// Streamed inputs are not included.
+	Args map[string]interface{}
+
+	// Results are the outputs of the operation, keyed by name.
+	// This is populated once the operation completes successfully, and never includes streamed outputs.
+	Results map[string]interface{}
+}
+
+type trackWriter struct {
+	wrote bool
+	w     io.Writer
+}
+
+func (tw *trackWriter) Write(p []byte) (int, error) {
+	tw.wrote = true
+	return tw.w.Write(p)
+}
+
+// Credentials are the credentials presented with a call to an operation which requires authentication.
+type Credentials struct {
+	// Scheme is the authentication scheme of the operation, which is "bearer" or "apikey".
+	Scheme string
+
+	// Token is the bearer token or API key.
+	Token string
+}
+
+// Authenticator validates the credentials presented with calls to operations which require authentication.
+// It must be safe for concurrent use.
+type Authenticator interface {
+	// Authenticate validates the credentials presented with a call to an operation.
+	// The returned context is passed to the operation, and may carry the identity of the caller.
+	// If an error is returned, the call is rejected.
+	// Errors declared in the spec are sent as-is, and other errors are sent as an UnauthorizedError.
+	Authenticate(ctx context.Context, system string, op string, cred Credentials) (context.Context, error)
+}
+
+// credentialsKey is the context key used to store the credentials of an authenticated call in the context of its request.
+type credentialsKey struct{}
+
+// requestCredentials extracts the credentials sent with a request.
+// Bearer tokens are sent in the Authorization header, and API keys are sent in the given header.
+func requestCredentials(r *http.Request, scheme string, header string) (Credentials, bool) {
+	v := r.Header.Get(header)
+	if scheme == "bearer" {
+		const prefix = "Bearer "
+		if len(v) < len(prefix) || !strings.EqualFold(v[:len(prefix)], prefix) {
+			return Credentials{}, false
+		}
+		v = v[len(prefix):]
+	}
+	v = strings.TrimSpace(v)
+	return Credentials{Scheme: scheme, Token: v}, v != ""
+}
+
+// StoredResponse is a response recorded so that it can be replayed.
+type StoredResponse struct {
+	// Fingerprint is a hash of the request which produced the response.
+	// The response is only replayed for a retried call which sends the same request.
+	Fingerprint string
+
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+// ErrIdempotencyKeyInUse is returned by IdempotencyStore.Reserve if a call with the same key has not finished yet.
+var ErrIdempotencyKeyInUse = errors.New("a call with the same idempotency key is in progress")
+
+// IdempotencyStore stores the responses to calls made with idempotency keys, so that retried calls are not run again.
+// The keys are prefixed with the names of the system and operation and the scope of the caller, separated by slashes.
+// It must be safe for concurrent use.
+type IdempotencyStore interface {
+	// Reserve reserves a key before a call is run, so that concurrent calls with the same key are not run twice.
+	// If a response is stored under the key, it is returned and the key is not reserved.
+	// If the key is reserved by a call which has not finished, ErrIdempotencyKeyInUse is returned.
+	Reserve(ctx context.Context, key string) (StoredResponse, bool, error)
+
+	// Store stores the response to a call under the key which it reserved.
+	Store(ctx context.Context, key string, resp StoredResponse) error
+
+	// Release releases a reserved key without storing a response, so that the call can be retried.
+	// Responses with 5xx status codes are not stored, so that calls which fail on the server can be retried.
+	Release(ctx context.Context, key string) error
+}
+
+// MemoryIdempotencyStore is an IdempotencyStore which keeps responses in memory for a limited time.
+// The zero value is ready to use.
+type MemoryIdempotencyStore struct {
+	// TTL is how long responses and reservations are kept.
+	// Defaults to 24 hours.
+	TTL time.Duration
+
+	mu        sync.Mutex
+	responses map[string]memoryStoredResponse
+
+	// expiry lists the keys in the order in which they were put, which is the order in which they expire.
+	expiry []memoryExpiry
+}
+
+// memoryExpiry is the expiry time of an entry in a MemoryIdempotencyStore.
+type memoryExpiry struct {
+	key     string
+	expires time.Time
+}
+
+// memoryStoredResponse is a response or reservation kept by a MemoryIdempotencyStore.
+type memoryStoredResponse struct {
+	resp StoredResponse
+
+	// pending is set while the key is reserved by a call which has not finished.
+	pending bool
+
+	expires time.Time
+}
+
+// Reserve returns the response stored under a key if it has not expired, and otherwise reserves the key.
+func (s *MemoryIdempotencyStore) Reserve(ctx context.Context, key string) (StoredResponse, bool, error) {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored, ok := s.responses[key]
+	switch {
+	case !ok || now.After(stored.expires):
+		s.put(key, memoryStoredResponse{pending: true}, now)
+		return StoredResponse{}, false, nil
+	case stored.pending:
+		return StoredResponse{}, false, ErrIdempotencyKeyInUse
+	default:
+		return stored.resp, true, nil
+	}
+}
+
+// Store stores a response under a key.
+func (s *MemoryIdempotencyStore) Store(ctx context.Context, key string, resp StoredResponse) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.put(key, memoryStoredResponse{resp: resp}, time.Now())
+	return nil
+}
+
+// Release discards the reservation of a key.
+func (s *MemoryIdempotencyStore) Release(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.responses, key)
+	return nil
+}
+
+// put sets the entry of a key, and discards expired entries.
+// The caller must hold the lock.
+func (s *MemoryIdempotencyStore) put(key string, entry memoryStoredResponse, now time.Time) {
+	ttl := s.TTL
+	if ttl == 0 {
+		ttl = 24 * time.Hour
+	}
+	if s.responses == nil {
+		s.responses = make(map[string]memoryStoredResponse)
+	}
+
+	// Only the oldest entries can have expired, so this stops at the first entry which has not.
+	// An entry which was replaced or released since it was put is left alone.
+	for len(s.expiry) > 0 && now.After(s.expiry[0].expires) {
+		old := s.expiry[0]
+		s.expiry = s.expiry[1:]
+		if stored, ok := s.responses[old.key]; ok && stored.expires.Equal(old.expires) {
+			delete(s.responses, old.key)
+		}
+	}
+
+	entry.expires = now.Add(ttl)
+	s.responses[key] = entry
+	s.expiry = append(s.expiry, memoryExpiry{key: key, expires: entry.expires})
+}
+
+// defaultIdempotencyMaxBodySize is the default limit on the size of the body of a request made with an idempotency key.
+const defaultIdempotencyMaxBodySize = 1 << 20
+
+// errIdempotentBodyTooLarge is returned by requestFingerprint if the body of a request exceeds the limit.
+var errIdempotentBodyTooLarge = errors.New("the body of a request made with an idempotency key is too large")
+
+// requestFingerprint hashes the query and body of a request, so that an idempotency key can not be reused for a different request.
+// The body is read, and replaced so that it can be read again.
+// At most limit bytes of the body are read, since the body is buffered in memory.
+func requestFingerprint(w http.ResponseWriter, r *http.Request, limit int64) (string, error) {
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, limit))
+	if err != nil {
+		if int64(len(body)) == limit {
+			// the reader fails once the limit has been read
+			return "", errIdempotentBodyTooLarge
+		}
+		return "", err
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	h := sha256.New()
+	for _, part := range [][]byte{[]byte(r.URL.RawQuery), []byte(r.Header.Get("Content-Type")), body} {
+		// each part is prefixed with its length, so that the parts can not be shifted into each other
+		fmt.Fprintf(h, "%d:", len(part))
+		h.Write(part)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// credentialScope identifies the caller of an operation which requires authentication by a hash of its credentials.
+// Callers of operations which do not require authentication share the empty scope.
+func credentialScope(r *http.Request) string {
+	cred, ok := r.Context().Value(credentialsKey{}).(Credentials)
+	if !ok {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(cred.Scheme + " " + cred.Token))
+	return hex.EncodeToString(sum[:])
+}
+
+// responseRecorder is an http.ResponseWriter which records the response as it is written.
+type responseRecorder struct {
+	http.ResponseWriter
+	code int
+	body bytes.Buffer
+}
+
+func (rr *responseRecorder) WriteHeader(code int) {
+	if rr.code == 0 {
+		rr.code = code
+	}
+	rr.ResponseWriter.WriteHeader(code)
+}
+
+func (rr *responseRecorder) Write(p []byte) (int, error) {
+	if rr.code == 0 {
+		rr.code = http.StatusOK
+	}
+	rr.body.Write(p)
+	return rr.ResponseWriter.Write(p)
+}
+
+// rateLimiter limits the rate of calls from each client with token buckets.
+type rateLimiter struct {
+	// rate is the rate at which the buckets are refilled, in tokens per second.
+	rate float64
+
+	// burst is the capacity of each bucket.
+	burst float64
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+	swept   time.Time
+}
+
+// tokenBucket is the state of the token bucket of a client.
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// maxIdleBuckets is the number of buckets above which full buckets are discarded.
+const maxIdleBuckets = 1024
+
+// take takes a token from the bucket of a client.
+// If the bucket is empty, take returns false and the time until a token will be available.
+func (l *rateLimiter) take(client string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.buckets == nil {
+		l.buckets = make(map[string]*tokenBucket)
+	}
+	if len(l.buckets) > maxIdleBuckets && now.Sub(l.swept).Seconds() > l.burst/l.rate {
+		// a full bucket is equivalent to a missing one
+		for k, b := range l.buckets {
+			if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+				delete(l.buckets, k)
+			}
+		}
+		l.swept = now
+	}
+	b, ok := l.buckets[client]
+	if !ok {
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[client] = b
+	}
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens += elapsed * l.rate
+		if b.tokens > l.burst {
+			b.tokens = l.burst
+		}
+		b.last = now
+	}
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	}
+	b.tokens--
+	return true, 0
+}
+
+// clientAddress identifies the client of a request by its IP address.
+func clientAddress(r *http.Request) string {
+	host := r.RemoteAddr
+	if i := strings.LastIndexByte(host, ':'); i >= 0 && !strings.HasSuffix(host, "]") {
+		host = host[:i]
+	}
+	return strings.Trim(host, "[]")
+}
+
+// HealthChecker reports the health of a service to the health and readiness endpoints of generated handlers.
+// It must be safe for concurrent use.
+type HealthChecker interface {
+	// Healthy checks whether the service is alive, and is served at "/_health".
+	// A service which is not healthy should be restarted.
+	Healthy(ctx context.Context) error
+
+	// Ready checks whether the service is ready to handle calls, and is served at "/_ready".
+	// A service which is not ready should not be sent calls, but may recover without being restarted.
+	Ready(ctx context.Context) error
+}
+
+// serveHealth serves a health or readiness endpoint.
+// A passing check responds with a JSON status, and a failing check responds with an error.
+// Errors declared in the spec are sent as-is, and other errors are sent with the 503 Service Unavailable status.
+func serveHealth(w http.ResponseWriter, r *http.Request, check func(context.Context) error) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		rpcError{
+			Message: fmt.Sprintf("unsupported method %q, please use %q", r.Method, http.MethodGet),
+			Code:    http.StatusMethodNotAllowed,
+		}.ServeHTTP(w, r)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	if err := check(r.Context()); err != nil {
+		var rerr interface{ rpcError() rpcError }
+		if errors.As(err, &rerr) {
+			rerr.rpcError().ServeHTTP(w, r)
+			return
+		}
+		rpcError{
+			Message: err.Error(),
+			Code:    http.StatusServiceUnavailable,
+		}.ServeHTTP(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if r.Method != http.MethodHead {
+		io.WriteString(w, "{\"status\":\"ok\"}\n")
+	}
+}
+
+// httpNotesHandler is a wrapper around Notes that implements http.Handler.
+type httpNotesHandler struct {
+	impl               Notes
+	ctxTransform       func(context.Context, *http.Request) (context.Context, context.CancelFunc, error)
+	mux                *http.ServeMux
+	authenticator      Authenticator
+	clientIdentity     func(*http.Request) string
+	limiters           map[string]*rateLimiter
+	idempotency        IdempotencyStore
+	idempotencyScope   func(*http.Request) string
+	idempotencyMaxBody int64
+}
+
+// replay handles the idempotency key sent with a request.
+// If a response to a call with the same key was stored, it is replayed and replayed is true.
+// A call with a key which is in use by a call which has not finished, or which was used for a different request, is rejected, and replayed is also true.
+// Otherwise, the key is reserved, the returned writer records the response, and the returned function stores it.
+func (h httpNotesHandler) replay(w http.ResponseWriter, r *http.Request, op string) (rw http.ResponseWriter, store func(), replayed bool) {
+	key := r.Header.Get(idempotencyHeader)
+	if h.idempotency == nil || key == "" {
+		return w, func() {}, false
+	}
+	fingerprint, err := requestFingerprint(w, r, h.idempotencyMaxBody)
+	if err != nil {
+		code := http.StatusBadRequest
+		if errors.Is(err, errIdempotentBodyTooLarge) {
+			code = http.StatusRequestEntityTooLarge
+		}
+		rpcError{
+			Message: err.Error(),
+			Code:    code,
+		}.ServeHTTP(w, r)
+		return w, nil, true
+	}
+	key = "Notes/" + op + "/" + h.idempotencyScope(r) + "/" + key
+	stored, ok, err := h.idempotency.Reserve(r.Context(), key)
+	switch {
+	case errors.Is(err, ErrIdempotencyKeyInUse):
+		rpcError{
+			Message: err.Error(),
+			Code:    http.StatusConflict,
+		}.ServeHTTP(w, r)
+		return w, nil, true
+	case err != nil:
+		rpcError{
+			Message: err.Error(),
+			Code:    http.StatusInternalServerError,
+		}.ServeHTTP(w, r)
+		return w, nil, true
+	case ok && stored.Fingerprint != fingerprint:
+		rpcError{
+			Message: "the idempotency key was already used for a different request",
+			Code:    http.StatusUnprocessableEntity,
+		}.ServeHTTP(w, r)
+		return w, nil, true
+	case ok:
+		for k, v := range stored.Header {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(stored.StatusCode)
+		w.Write(stored.Body)
+		return w, nil, true
+	}
+	rec := &responseRecorder{ResponseWriter: w}
+	return rec, func() {
+		if rec.code == 0 || rec.code >= 500 {
+			h.idempotency.Release(r.Context(), key)
+			return
+		}
+		h.idempotency.Store(r.Context(), key, StoredResponse{
+			Fingerprint: fingerprint,
+			StatusCode:  rec.code,
+			Header:      w.Header().Clone(),
+			Body:        rec.body.Bytes(),
+		})
+	}, false
+}
+
+// limit takes a token from the rate limiter of an operation for the client making a request.
+// If the client has exceeded the rate limit, a RateLimitError is sent to the client and returned.
+func (h httpNotesHandler) limit(w http.ResponseWriter, r *http.Request, op string) error {
+	ok, wait := h.limiters[op].take(h.clientIdentity(r), time.Now())
+	if ok {
+		return nil
+	}
+	err := RateLimitError{Op: op, RetryAfter: uint32((wait + time.Second - 1) / time.Second)}
+	err.ServeHTTP(w, r)
+	return err
+}
+
+// authenticate validates the credentials sent with a request to an operation which requires authentication.
+// If they are valid, the returned request carries the context returned by the authenticator.
+// Otherwise, the error is sent to the client and returned.
+func (h httpNotesHandler) authenticate(w http.ResponseWriter, r *http.Request, op string, scheme string, header string) (*http.Request, error) {
+	cred, ok := requestCredentials(r, scheme, header)
+	if !ok {
+		err := UnauthorizedError{Op: op, Scheme: scheme, Reason: "missing credentials"}
+		err.ServeHTTP(w, r)
+		return nil, err
+	}
+	if h.authenticator == nil {
+		err := UnauthorizedError{Op: op, Scheme: scheme, Reason: "no authenticator is configured"}
+		err.ServeHTTP(w, r)
+		return nil, err
+	}
+	ctx, err := h.authenticator.Authenticate(r.Context(), "Notes", op, cred)
+	if err != nil {
+		var uerr UnauthorizedError
+		var rerr interface{ rpcError() rpcError }
+		switch {
+		case errors.As(err, &uerr):
+			if uerr.Op == "" {
+				uerr.Op = op
+			}
+			if uerr.Scheme == "" {
+				uerr.Scheme = scheme
+			}
+			uerr.ServeHTTP(w, r)
+			return nil, uerr
+		case errors.As(err, &rerr):
+			rerr.rpcError().ServeHTTP(w, r)
+			return nil, err
+		default:
+			uerr = UnauthorizedError{Op: op, Scheme: scheme, Reason: err.Error()}
+			uerr.ServeHTTP(w, r)
+			return nil, uerr
+		}
+	}
+	return r.WithContext(context.WithValue(ctx, credentialsKey{}, cred)), nil
+}
+
+// handleCreate wraps the implementation's Create operation and bridges it to HTTP.
+func (h httpNotesHandler) handleCreate(w http.ResponseWriter, r *http.Request) {
+	outcome := "rejected"
+	if r.Method != http.MethodPost {
+		rpcError{
+			Message: fmt.Sprintf("unsupported method %q, please use %q", r.Method, http.MethodPost),
+			Code:    http.StatusMethodNotAllowed,
+		}.ServeHTTP(w, r)
+		return
+	}
+
+	r, authErr := h.authenticate(w, r, "Create", "bearer", "Authorization")
+	if authErr != nil {
+		outcome = callOutcome(authErr)
+		return
+	}
+
+	if limitErr := h.limit(w, r, "Create"); limitErr != nil {
+		outcome = callOutcome(limitErr)
+		return
+	}
+
+	w, storeResponse, replayed := h.replay(w, r, "Create")
+	if replayed {
+		outcome = "replayed"
+		return
+	}
+	defer storeResponse()
+
+	var args struct {
+		Text string `json:"Text,omitempty"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&args); err != nil {
+		rpcError{
+			Message: err.Error(),
+			Code:    http.StatusBadRequest,
+		}.ServeHTTP(w, r)
+		return
+	}
+
+	if verr := validateNotesCreate(args.Text); verr != nil {
+		outcome = "ValidationError"
+		verr.ServeHTTP(w, r)
+		return
+	}
+
+	ctx := metadataContext(r.Context(), r)
+	ctx, span := tracing.Start(tracing.Extract(ctx, r.Header), "Notes/Create", tracing.Server)
+	defer func() { span.End(outcome) }()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	if h.ctxTransform != nil {
+		tctx, tcancel, err := h.ctxTransform(ctx, r)
+		if err != nil {
+			rpcError{
+				Message: err.Error(),
+				Code:    http.StatusBadRequest,
+			}.ServeHTTP(w, r)
+			return
+		}
+		defer tcancel()
+		ctx = tctx
+	}
+
+	var outputs struct {
+		Added Note `json:"Added,omitempty"`
+	}
+
+	var err error
+	outputs.Added, err = h.impl.Create(ctx, args.Text)
+	outcome = callOutcome(err)
+	if err != nil {
+		rpcError{
+			Message: err.Error(),
+			Code:    http.StatusInternalServerError,
+		}.ServeHTTP(w, r)
+		return
+	}
+
+	json.NewEncoder(w).Encode(outputs)
+}
+
+// handleList wraps the implementation's List operation and bridges it to HTTP.
+func (h httpNotesHandler) handleList(w http.ResponseWriter, r *http.Request) {
+	outcome := "rejected"
+	if r.Method != http.MethodGet {
+		rpcError{
+			Message: fmt.Sprintf("unsupported method %q, please use %q", r.Method, http.MethodGet),
+			Code:    http.StatusMethodNotAllowed,
+		}.ServeHTTP(w, r)
+		return
+	}
+
+	r, authErr := h.authenticate(w, r, "List", "bearer", "Authorization")
+	if authErr != nil {
+		outcome = callOutcome(authErr)
+		return
+	}
+
+	var args struct {
+		Prefix string `json:"Prefix,omitempty"`
+		Cursor string `json:"Cursor,omitempty"`
+		Limit  uint32 `json:"Limit,omitempty"`
+	}
+
+	q := r.URL.Query()
+	if err := func() error {
+		if err := queryValue(q, "Prefix", &args.Prefix); err != nil {
+			return err
+		}
+		if err := queryValue(q, "Cursor", &args.Cursor); err != nil {
+			return err
+		}
+		if err := queryValue(q, "Limit", &args.Limit); err != nil {
+			return err
+		}
+
+		return nil
+	}(); err != nil {
+		rpcError{
+			Message: err.Error(),
+			Code:    http.StatusBadRequest,
+		}.ServeHTTP(w, r)
+		return
+	}
+
+	ctx := metadataContext(r.Context(), r)
+	ctx, span := tracing.Start(tracing.Extract(ctx, r.Header), "Notes/List", tracing.Server)
+	defer func() { span.End(outcome) }()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	if h.ctxTransform != nil {
+		tctx, tcancel, err := h.ctxTransform(ctx, r)
+		if err != nil {
+			rpcError{
+				Message: err.Error(),
+				Code:    http.StatusBadRequest,
+			}.ServeHTTP(w, r)
+			return
+		}
+		defer tcancel()
+		ctx = tctx
+	}
+
+	var outputs struct {
+		Notes      []Note `json:"Notes,omitempty"`
+		NextCursor string `json:"NextCursor,omitempty"`
+	}
+
+	var err error
+	outputs.Notes, outputs.NextCursor, err = h.impl.List(ctx, args.Prefix, args.Cursor, args.Limit)
+	outcome = callOutcome(err)
+	if err != nil {
+		rpcError{
+			Message: err.Error(),
+			Code:    http.StatusInternalServerError,
+		}.ServeHTTP(w, r)
+		return
+	}
+
+	json.NewEncoder(w).Encode(outputs)
+}
+
+// handleWatch wraps the implementation's Watch subscription and delivers its events over a WebSocket.
+func (h httpNotesHandler) handleWatch(w http.ResponseWriter, r *http.Request) {
+	outcome := "rejected"
+	if r.Method != http.MethodGet {
+		rpcError{
+			Message: fmt.Sprintf("unsupported method %q, please use %q", r.Method, http.MethodGet),
+			Code:    http.StatusMethodNotAllowed,
+		}.ServeHTTP(w, r)
+		return
+	}
+
+	r, authErr := h.authenticate(w, r, "Watch", "bearer", "Authorization")
+	if authErr != nil {
+		outcome = callOutcome(authErr)
+		return
+	}
+
+	ctx := metadataContext(r.Context(), r)
+	ctx, span := tracing.Start(tracing.Extract(ctx, r.Header), "Notes/Watch", tracing.Server)
+	defer func() { span.End(outcome) }()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	if h.ctxTransform != nil {
+		tctx, tcancel, err := h.ctxTransform(ctx, r)
+		if err != nil {
+			rpcError{
+				Message: err.Error(),
+				Code:    http.StatusBadRequest,
+			}.ServeHTTP(w, r)
+			return
+		}
+		defer tcancel()
+		ctx = tctx
+	}
+
+	c, _, err := ws.Upgrade(w, r, ws.HandshakeOptions{})
+	if err != nil {
+		return
+	}
+	defer c.ForceClose()
+
+	// the client only sends control frames, and cancels the subscription by closing the WebSocket
+	unsubscribed := make(chan struct{})
+	go func() {
+		defer cancel()
+		defer close(unsubscribed)
+		for {
+			if _, err := c.NextFrame(); err != nil {
+				return
+			}
+			if _, err := io.Copy(ioutil.Discard, c); err != nil {
+				return
+			}
+		}
+	}()
+
+	err = h.impl.Watch(ctx, func(ev Note) error {
+		dat, err := json.Marshal(ev)
+		if err != nil {
+			return err
+		}
+		return c.SendJSON(streamFrame{Value: dat})
+	})
+	select {
+	case <-unsubscribed:
+		outcome = "ok"
+		return
+	default:
+	}
+	outcome = callOutcome(err)
+	var final streamFrame
+	if err != nil {
+		var rerr rpcError
+		rerr = rpcError{
+			Message: err.Error(),
+			Code:    http.StatusInternalServerError,
+		}
+		dat, merr := json.Marshal(rerr)
+		if merr != nil {
+			return
+		}
+		final.Error = dat
+	} else {
+		final.End = true
+	}
+	if err := c.SendJSON(final); err != nil {
+		return
+	}
+	cctx, ccancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer ccancel()
+	c.Close(cctx, 1000, "")
+}
+
+// NotesWatchPublisher fans out events to the subscribers of the Watch subscription.
+// The zero value is ready to use, and may be shared by calls to the implementation's Watch operation.
+type NotesWatchPublisher struct {
+	// Buffer is the number of events which may be queued for each subscriber.
+	// A subscriber which falls further behind is dropped.
+	// Defaults to 16.
+	Buffer int
+
+	mu   sync.Mutex
+	subs map[chan Note]struct{}
+}
+
+// Publish sends an event to every subscriber.
+// It does not block, and instead drops the subscribers which have fallen behind.
+func (p *NotesWatchPublisher) Publish(ev Note) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for ch := range p.subs {
+		select {
+		case ch <- ev:
+		default:
+			close(ch)
+			delete(p.subs, ch)
+		}
+	}
+}
+
+// Subscribers returns the number of current subscribers.
+func (p *NotesWatchPublisher) Subscribers() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.subs)
+}
+
+// Subscribe sends the published events to a subscriber until the context is cancelled or sending fails.
+// It may be returned by the implementation's Watch operation, passing the context and event stream of the call.
+// If the subscriber falls behind, the events queued for it are sent and then an error is returned.
+func (p *NotesWatchPublisher) Subscribe(ctx context.Context, send func(Note) error) error {
+	n := p.Buffer
+	if n <= 0 {
+		n = 16
+	}
+	ch := make(chan Note, n)
+	p.mu.Lock()
+	if p.subs == nil {
+		p.subs = make(map[chan Note]struct{})
+	}
+	p.subs[ch] = struct{}{}
+	p.mu.Unlock()
+	defer func() {
+		p.mu.Lock()
+		delete(p.subs, ch)
+		p.mu.Unlock()
+	}()
+
+	for {
+		select {
+		case ev, ok := <-ch:
+			if !ok {
+				return errors.New("subscriber to Watch fell behind")
+			}
+			if err := send(ev); err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// handleCount wraps the implementation's Count operation and bridges it to HTTP.
+func (h httpNotesHandler) handleCount(w http.ResponseWriter, r *http.Request) {
+	outcome := "rejected"
+	if r.Method != http.MethodPost {
+		rpcError{
+			Message: fmt.Sprintf("unsupported method %q, please use %q", r.Method, http.MethodPost),
+			Code:    http.StatusMethodNotAllowed,
+		}.ServeHTTP(w, r)
+		return
+	}
+
+	w, storeResponse, replayed := h.replay(w, r, "Count")
+	if replayed {
+		outcome = "replayed"
+		return
+	}
+	defer storeResponse()
+
+	var args struct{}
+
+	if err := json.NewDecoder(r.Body).Decode(&args); err != nil {
+		rpcError{
+			Message: err.Error(),
+			Code:    http.StatusBadRequest,
+		}.ServeHTTP(w, r)
+		return
+	}
+
+	ctx := metadataContext(r.Context(), r)
+	ctx, span := tracing.Start(tracing.Extract(ctx, r.Header), "Notes/Count", tracing.Server)
+	defer func() { span.End(outcome) }()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	if h.ctxTransform != nil {
+		tctx, tcancel, err := h.ctxTransform(ctx, r)
+		if err != nil {
+			rpcError{
+				Message: err.Error(),
+				Code:    http.StatusBadRequest,
+			}.ServeHTTP(w, r)
+			return
+		}
+		defer tcancel()
+		ctx = tctx
+	}
+
+	var outputs struct {
+		Count uint64 `json:"Count"`
+	}
+
+	var err error
+	outputs.Count, err = h.impl.Count(ctx)
+	outcome = callOutcome(err)
+	if err != nil {
+		rpcError{
+			Message: err.Error(),
+			Code:    http.StatusInternalServerError,
+		}.ServeHTTP(w, r)
+		return
+	}
+
+	json.NewEncoder(w).Encode(outputs)
+}
+
+// ServeHTTP invokes the appropriate handler
+func (h httpNotesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+// HTTPNotesHandlerOptions are the options of an http.Handler that wraps a Notes.
+type HTTPNotesHandlerOptions struct {
+	// CtxTransform is an optional callback to transform the context with information from the HTTP request.
+	// If CtxTransform returns an error, the error will be propogated to the client.
+	// The cancel function returned by CtxTransform will be invoked after the request completes.
+	// Metadata sent by the client is attached to the context before CtxTransform is called, and can be retrieved with MetadataFromContext.
+	CtxTransform func(context.Context, *http.Request) (context.Context, context.CancelFunc, error)
+
+	// Authenticator validates the credentials of calls to operations which require authentication.
+	// If it is nil, these calls are rejected.
+	Authenticator Authenticator
+
+	// IdempotencyStore is an optional store for the responses to calls made with idempotency keys.
+	// If it is set, the stored response is replayed when a call is retried with the same key.
+	IdempotencyStore IdempotencyStore
+
+	// IdempotencyScope is an optional callback which identifies the caller making a request, so that callers can not replay each other's responses by reusing a key.
+	// The context of the request carries the context returned by the Authenticator, if the operation requires authentication.
+	// Defaults to a hash of the credentials of calls to operations which require authentication, and to a scope shared by the callers of other operations.
+	IdempotencyScope func(*http.Request) string
+
+	// IdempotencyMaxBodySize is the maximum size in bytes of the body of a request made with an idempotency key.
+	// The body is buffered in memory to fingerprint the request, and larger requests are rejected.
+	// Defaults to 1 MiB.
+	IdempotencyMaxBodySize int64
+
+	// ClientIdentity is an optional callback which identifies the client making a request, for rate limiting.
+	// The context of the request carries the context returned by the Authenticator, if the operation requires authentication.
+	// Defaults to the IP address of the client.
+	ClientIdentity func(*http.Request) string
+
+	// HealthChecker is an optional checker which serves the health and readiness endpoints, "/_health" and "/_ready".
+	// The endpoints do not require authentication, so that load balancers can probe them.
+	// Defaults to the implementation of the system, if it implements HealthChecker.
+	// If there is no checker, the endpoints are not served.
+	HealthChecker HealthChecker
+}
+
+// NewHTTPNotesHandler creates an http.Handler that wraps a Notes.
+// If not nil, ctxTransform will be called to transform the context with information from the HTTP request.
+// If the ctxTransform returns an error, the error will be propogated to the client.
+// The cancel function returned by ctxTransform will be invoked after the request completes.
+// Metadata sent by the client is attached to the context before ctxTransform is called, and can be retrieved with MetadataFromContext.
+// Calls to operations which require authentication are rejected, unless the handler is created with an Authenticator by NewHTTPNotesHandlerWithOptions.
+// The health and readiness endpoints are served if the system implements HealthChecker.
+func NewHTTPNotesHandler(system Notes, ctxTransform func(context.Context, *http.Request) (context.Context, context.CancelFunc, error)) http.Handler {
+	return NewHTTPNotesHandlerWithOptions(system, HTTPNotesHandlerOptions{CtxTransform: ctxTransform})
+}
+
+// NewHTTPNotesHandlerWithOptions creates an http.Handler that wraps a Notes with the given options.
+func NewHTTPNotesHandlerWithOptions(system Notes, opts HTTPNotesHandlerOptions) http.Handler {
+	mux := http.NewServeMux()
+	h := &httpNotesHandler{
+		impl:               system,
+		ctxTransform:       opts.CtxTransform,
+		mux:                mux,
+		authenticator:      opts.Authenticator,
+		idempotency:        opts.IdempotencyStore,
+		idempotencyScope:   opts.IdempotencyScope,
+		idempotencyMaxBody: opts.IdempotencyMaxBodySize,
+		clientIdentity:     opts.ClientIdentity,
+		limiters: map[string]*rateLimiter{
+			"Create": {rate: 10, burst: 5},
+		},
+	}
+	if h.clientIdentity == nil {
+		h.clientIdentity = clientAddress
+	}
+	if h.idempotencyScope == nil {
+		h.idempotencyScope = credentialScope
+	}
+	if h.idempotencyMaxBody <= 0 {
+		h.idempotencyMaxBody = defaultIdempotencyMaxBodySize
+	}
+
+	mux.HandleFunc("/Create", h.handleCreate)
+	mux.HandleFunc("/List", h.handleList)
+	mux.HandleFunc("/Watch", h.handleWatch)
+	mux.HandleFunc("/Count", h.handleCount)
+	health := opts.HealthChecker
+	if health == nil {
+		health, _ = system.(HealthChecker)
+	}
+	if health != nil {
+		mux.HandleFunc("/_health", func(w http.ResponseWriter, r *http.Request) {
+			serveHealth(w, r, health.Healthy)
+		})
+		mux.HandleFunc("/_ready", func(w http.ResponseWriter, r *http.Request) {
+			serveHealth(w, r, health.Ready)
+		})
+	}
+
+	return h
+}
+
+// ClientError is an error reported by the server in response to a call from the client.
+// If the error is one declared by the operation, it is decoded and can be retrieved with errors.As.
+type ClientError struct {
+	// StatusCode is the HTTP status code of the response.
+	// This is 0 if the error was sent after a stream started.
+	StatusCode int
+
+	// Type is the name of the error type sent by the server, if any.
+	Type string
+
+	// Code is the machine-readable code of the error sent by the server, if any.
+	Code ErrorCode
+
+	// Message is the error message sent by the server.
+	Message string
+
+	// Payload is the JSON-encoded data attached to the error, if any.
+	Payload json.RawMessage
+
+	// Err is the decoded error, if the type is declared by the operation.
+	Err error
+}
+
+func (err *ClientError) Error() string {
+	if err.Err != nil {
+		return err.Err.Error()
+	}
+	return err.Message
+}
+
+// Unwrap returns the decoded error, if any.
+func (err *ClientError) Unwrap() error {
+	return err.Err
+}
+
+// parseClientError parses an error sent by the server.
+// If the error is not in the standard format, the whole body is used as the message.
+func parseClientError(status int, dat []byte) *ClientError {
+	var rerr struct {
+		Message string          `json:"message"`
+		Type    string          `json:"type"`
+		Code    ErrorCode       `json:"code"`
+		Data    json.RawMessage `json:"dat"`
+	}
+	if err := json.Unmarshal(dat, &rerr); err != nil {
+		return &ClientError{StatusCode: status, Message: string(dat)}
+	}
+	return &ClientError{
+		StatusCode: status,
+		Type:       rerr.Type,
+		Code:       rerr.Code,
+		Message:    rerr.Message,
+		Payload:    rerr.Data,
+	}
+}
+
+// CallInterceptor wraps an operation call on the client.
+// The interceptor may inspect or modify the context, and must call invoke to run the operation.
+// Invoke may be called more than once in order to retry an operation, but streamed inputs cannot be replayed.
+type CallInterceptor func(ctx context.Context, call *Call, invoke func(context.Context) error) error
+
+// RoundTripInterceptor wraps an HTTP round trip made by the client.
+// The interceptor must call next to send the request.
+type RoundTripInterceptor func(req *http.Request, next func(*http.Request) (*http.Response, error)) (*http.Response, error)
+
+// roundTripperFunc adapts a function into an http.RoundTripper.
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// ClientOptions configures the HTTP transport of a client.
+// The zero value uses the same settings as http.DefaultTransport, with a dedicated connection pool.
+type ClientOptions struct {
+	// Timeout is the time limit of each request, including reading the response body.
+	// This also limits streamed calls, so it should be left unset if operations stream for a long time.
+	// Defaults to no limit.
+	Timeout time.Duration
+
+	// DialTimeout is the time limit for establishing a connection.
+	// Defaults to 30 seconds.
+	DialTimeout time.Duration
+
+	// KeepAlive is the interval between TCP keep-alive probes.
+	// Defaults to 30 seconds.
+	// If negative, keep-alive probes are disabled.
+	KeepAlive time.Duration
+
+	// IdleConnTimeout is the time after which an idle connection is closed.
+	// Defaults to 90 seconds.
+	IdleConnTimeout time.Duration
+
+	// MaxIdleConns is the maximum number of idle connections.
+	// Defaults to 100.
+	MaxIdleConns int
+
+	// MaxIdleConnsPerHost is the maximum number of idle connections to each host.
+	// Defaults to http.DefaultMaxIdleConnsPerHost.
+	MaxIdleConnsPerHost int
+
+	// UserAgent is sent in the User-Agent header of each request.
+	UserAgent string
+
+	// Header is a set of base headers sent with each request.
+	// Headers set by the client for a call take precedence.
+	Header http.Header
+}
+
+// httpClient creates an HTTP client with the options.
+func (opts ClientOptions) httpClient() *http.Client {
+	dialTimeout := opts.DialTimeout
+	if dialTimeout == 0 {
+		dialTimeout = 30 * time.Second
+	}
+	keepAlive := opts.KeepAlive
+	if keepAlive == 0 {
+		keepAlive = 30 * time.Second
+	}
+	tr := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   dialTimeout,
+			KeepAlive: keepAlive,
+		}).DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   opts.MaxIdleConnsPerHost,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: time.Second,
+	}
+	if opts.MaxIdleConns != 0 {
+		tr.MaxIdleConns = opts.MaxIdleConns
+	}
+	if opts.IdleConnTimeout != 0 {
+		tr.IdleConnTimeout = opts.IdleConnTimeout
+	}
+	var rt http.RoundTripper = tr
+	if opts.UserAgent != "" || len(opts.Header) != 0 {
+		header := opts.Header.Clone()
+		if header == nil {
+			header = http.Header{}
+		}
+		if opts.UserAgent != "" {
+			header.Set("User-Agent", opts.UserAgent)
+		}
+		rt = roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			req = req.Clone(req.Context())
+			for k, v := range header {
+				if _, ok := req.Header[k]; !ok {
+					req.Header[k] = v
+				}
+			}
+			return tr.RoundTrip(req)
+		})
+	}
+	return &http.Client{
+		Transport: rt,
+		Timeout:   opts.Timeout,
+	}
+}
+
+// NotesClient is an HTTP client for Notes, implementing Notes.
+type NotesClient struct {
+	// HTTP is the HTTP client which will be used by the NotesClient to make requests.
+	HTTP *http.Client
+
+	// Base is the base URL of the server.
+	Base *url.URL
+
+	// Contextualize is an optional callback that may be used to add contextual information to the HTTP request.
+	// If Contextualize is not called, the parent context will be inserted into the request.
+	// If present, the Contextualize callback is responsible for configuring request cancellation.
+	Contextualize func(context.Context, *http.Request) (*http.Request, error)
+
+	// Interceptors wrap every operation call made by the client.
+	// The first interceptor is the outermost.
+	Interceptors []CallInterceptor
+
+	// RoundTripInterceptors wrap every HTTP round trip made by the client.
+	// The first interceptor is the outermost.
+	RoundTripInterceptors []RoundTripInterceptor
+
+	// Token is the bearer token or API key sent with calls to operations which require authentication.
+	Token string
+
+	// TokenSource is an optional callback which returns the token for a call, overriding Token.
+	// It may be used to refresh short-lived tokens.
+	TokenSource func(context.Context) (string, error)
+}
+
+// NewNotesClient creates a client for the server at the base URL, with a dedicated HTTP client configured by the options.
+func NewNotesClient(base string, opts ClientOptions) (*NotesClient, error) {
+	u, err := url.Parse(base)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("base URL %q is not absolute", base)
+	}
+	return &NotesClient{
+		HTTP: opts.httpClient(),
+		Base: u,
+	}, nil
+}
+
+// dialWebSocket opens a WebSocket carrying a subscription.
+// If the server rejects the handshake, the error response is returned instead.
+func (cli *NotesClient) dialWebSocket(ctx context.Context, u *url.URL, hdr http.Header) (*ws.Conn, *ClientError, error) {
+	hcl := *cli.httpClient()
+	base := hcl.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	// the handshake discards the body of an error response, so it is parsed here
+	var rejected *ClientError
+	hcl.Transport = roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		resp, err := base.RoundTrip(req)
+		if err != nil || resp.StatusCode == http.StatusSwitchingProtocols {
+			return resp, err
+		}
+		defer resp.Body.Close()
+		dat, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			rejected = &ClientError{StatusCode: resp.StatusCode, Message: resp.Status}
+		} else {
+			rejected = parseClientError(resp.StatusCode, dat)
+		}
+		resp.Body = ioutil.NopCloser(bytes.NewReader(dat))
+		return resp, nil
+	})
+
+	c, _, err := (&ws.Dialer{
+		HTTPClient: &hcl,
+		Rand:       rand.Reader,
+	}).Dial(ctx, u, ws.HandshakeOptions{Headers: hdr})
+	switch {
+	case rejected != nil:
+		if c != nil {
+			c.ForceClose()
+		}
+		return nil, rejected, nil
+	case err != nil:
+		return nil, nil, err
+	}
+	return c, nil, nil
+}
+
+// setCredentials adds the token of the client to a set of HTTP headers.
+// If there is no token, no credentials are sent.
+func (cli *NotesClient) setCredentials(ctx context.Context, h http.Header, scheme string, header string) error {
+	token := cli.Token
+	if cli.TokenSource != nil {
+		var err error
+		token, err = cli.TokenSource(ctx)
+		if err != nil {
+			return err
+		}
+	}
+	if token == "" {
+		return nil
+	}
+	if scheme == "bearer" {
+		token = "Bearer " + token
+	}
+	h.Set(header, token)
+	return nil
+}
+
+// intercept runs an operation call through the client's call interceptors.
+func (cli *NotesClient) intercept(ctx context.Context, call *Call, invoke func(context.Context) error) error {
+	for i := len(cli.Interceptors) - 1; i >= 0; i-- {
+		ic, next := cli.Interceptors[i], invoke
+		invoke = func(ctx context.Context) error {
+			return ic(ctx, call, next)
+		}
+	}
+	return invoke(ctx)
+}
+
+// httpClient returns the HTTP client to use for requests, with the round trip interceptors applied.
+func (cli *NotesClient) httpClient() *http.Client {
+	hcl := cli.HTTP
+	if hcl == nil {
+		hcl = http.DefaultClient
+	}
+	interceptors := cli.RoundTripInterceptors
+	if len(interceptors) == 0 {
+		return hcl
+	}
+	base := hcl.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	next := base.RoundTrip
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		ic, inner := interceptors[i], next
+		next = func(req *http.Request) (*http.Response, error) {
+			return ic(req, inner)
+		}
+	}
+	wrapped := *hcl
+	wrapped.Transport = roundTripperFunc(next)
+	return &wrapped
+}
+
+// Create adds a note.
+// Text is the content of the note.
+// Added is the note which was added.
+func (cli *NotesClient) Create(ctx context.Context, Text string) (Note, error) {
+	var r0 Note
+	ctx, span := tracing.Start(ctx, "Notes/Create", tracing.Client)
+	ctx = withCallIdempotencyKey(ctx)
+	call := &Call{
+		Op: "Create",
+		Args: map[string]interface{}{
+			"Text": Text,
+		},
+	}
+	err := cli.intercept(ctx, call, func(ctx context.Context) error {
+		var err error
+		r0, err = cli.invokeCreate(ctx, Text)
+		if err == nil {
+			call.Results = map[string]interface{}{
+				"Added": r0,
+			}
+		}
+		return err
+	})
+	span.End(callOutcome(err))
+	return r0, err
+}
+
+// invokeCreate runs the Create operation without applying call interceptors.
+func (cli *NotesClient) invokeCreate(ctx context.Context, Text string) (Note, error) {
+	if verr := validateNotesCreate(Text); verr != nil {
+		return Note{}, verr
+	}
+	u, err := cli.Base.Parse("Create")
+	if err != nil {
+		return Note{}, err
+	}
+
+	dat, err := json.Marshal(struct {
+		Text string `json:"Text,omitempty"`
+	}{
+		Text: Text,
+	})
+	if err != nil {
+		return Note{}, err
+	}
+	req, err := http.NewRequest(http.MethodPost, u.String(), bytes.NewReader(dat))
+	if err != nil {
+		return Note{}, err
+	}
+
+	setMetadataHeaders(ctx, req.Header)
+	if key, ok := ctx.Value(idempotencyKey{}).(string); ok {
+		req.Header.Set(idempotencyHeader, key)
+	}
+	if err := cli.setCredentials(ctx, req.Header, "bearer", "Authorization"); err != nil {
+		return Note{}, err
+	}
+	tracing.Inject(ctx, req.Header)
+
+	if cli.Contextualize == nil {
+		req = req.WithContext(ctx)
+	} else {
+		cctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		req, err = cli.Contextualize(cctx, req)
+		if err != nil {
+			return Note{}, err
+		}
+	}
+
+	hcl := cli.httpClient()
+	resp, err := hcl.Do(req)
+	if err != nil {
+		return Note{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		dat, eerr := ioutil.ReadAll(resp.Body)
+		if eerr != nil {
+			return Note{}, &ClientError{StatusCode: resp.StatusCode, Message: resp.Status}
+		}
+		cerr := parseClientError(resp.StatusCode, dat)
+		switch cerr.Type {
+		case "RateLimitError":
+			var e RateLimitError
+			if json.Unmarshal(cerr.Payload, &e) == nil {
+				cerr.Err = e
+			}
+		case "UnauthorizedError":
+			var e UnauthorizedError
+			if json.Unmarshal(cerr.Payload, &e) == nil {
+				cerr.Err = e
+			}
+		case "ValidationError":
+			var e ValidationError
+			if json.Unmarshal(cerr.Payload, &e) == nil {
+				cerr.Err = &e
+			}
+		}
+		return Note{}, cerr
+	}
+
+	bdat, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return Note{}, err
+	}
+
+	var outputs struct {
+		Added Note `json:"Added,omitempty"`
+	}
+	err = json.Unmarshal(bdat, &outputs)
+	if err != nil {
+		return Note{}, err
+	}
+
+	return outputs.Added, nil
+
+}
+
+// List lists the notes in the order in which they were added.
+// Prefix selects the notes with text starting with the prefix.
+// Cursor is the position at which the page starts, as returned in NextCursor.
+// The first page is requested with an empty cursor.
+// Limit is the maximum number of items in the page.
+// If zero, the server chooses the limit.
+// Notes are the notes in the page.
+// NextCursor is the cursor of the next page, or empty if this is the last page.
+func (cli *NotesClient) List(ctx context.Context, Prefix string, Cursor string, Limit uint32) ([]Note, string, error) {
+	var r0 []Note
+	var r1 string
+	ctx, span := tracing.Start(ctx, "Notes/List", tracing.Client)
+	call := &Call{
+		Op: "List",
+		Args: map[string]interface{}{
+			"Prefix": Prefix,
+			"Cursor": Cursor,
+			"Limit":  Limit,
+		},
+	}
+	err := cli.intercept(ctx, call, func(ctx context.Context) error {
+		var err error
+		r0, r1, err = cli.invokeList(ctx, Prefix, Cursor, Limit)
+		if err == nil {
+			call.Results = map[string]interface{}{
+				"Notes":      r0,
+				"NextCursor": r1,
+			}
+		}
+		return err
+	})
+	span.End(callOutcome(err))
+	return r0, r1, err
+}
+
+// invokeList runs the List operation without applying call interceptors.
+func (cli *NotesClient) invokeList(ctx context.Context, Prefix string, Cursor string, Limit uint32) ([]Note, string, error) {
+	u, err := cli.Base.Parse("List")
+	if err != nil {
+		return []Note{}, "", err
+	}
+
+	q := u.Query()
+	if err := func() error {
+		if err := queryAdd(q, "Prefix", Prefix); err != nil {
+			return err
+		}
+		if err := queryAdd(q, "Cursor", Cursor); err != nil {
+			return err
+		}
+		if err := queryAdd(q, "Limit", Limit); err != nil {
+			return err
+		}
+
+		return nil
+	}(); err != nil {
+		return []Note{}, "", err
+	}
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return []Note{}, "", err
+	}
+
+	setMetadataHeaders(ctx, req.Header)
+	if err := cli.setCredentials(ctx, req.Header, "bearer", "Authorization"); err != nil {
+		return []Note{}, "", err
+	}
+	tracing.Inject(ctx, req.Header)
+
+	if cli.Contextualize == nil {
+		req = req.WithContext(ctx)
+	} else {
+		cctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		req, err = cli.Contextualize(cctx, req)
+		if err != nil {
+			return []Note{}, "", err
+		}
+	}
+
+	hcl := cli.httpClient()
+	resp, err := hcl.Do(req)
+	if err != nil {
+		return []Note{}, "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		dat, eerr := ioutil.ReadAll(resp.Body)
+		if eerr != nil {
+			return []Note{}, "", &ClientError{StatusCode: resp.StatusCode, Message: resp.Status}
+		}
+		cerr := parseClientError(resp.StatusCode, dat)
+		switch cerr.Type {
+		case "UnauthorizedError":
+			var e UnauthorizedError
+			if json.Unmarshal(cerr.Payload, &e) == nil {
+				cerr.Err = e
+			}
+		}
+		return []Note{}, "", cerr
+	}
+
+	bdat, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return []Note{}, "", err
+	}
+
+	var outputs struct {
+		Notes      []Note `json:"Notes,omitempty"`
+		NextCursor string `json:"NextCursor,omitempty"`
+	}
+	err = json.Unmarshal(bdat, &outputs)
+	if err != nil {
+		return []Note{}, "", err
+	}
+
+	return outputs.Notes, outputs.NextCursor, nil
+
+}
+
+// NotesListIterator iterates over the items returned by List, fetching successive pages as needed.
+type NotesListIterator struct {
+	fetch  func(cursor string) ([]Note, string, error)
+	page   []Note
+	item   Note
+	cursor string
+	done   bool
+	err    error
+}
+
+// IterateList returns an iterator over the items of every page of List, starting with the first page.
+// The limit is the maximum number of items requested in each page, or zero to let the server choose.
+func (cli *NotesClient) IterateList(ctx context.Context, Prefix string, limit uint32) *NotesListIterator {
+	return &NotesListIterator{
+		fetch: func(cursor string) ([]Note, string, error) {
+			return cli.List(ctx, Prefix, cursor, limit)
+		},
+	}
+}
+
+// Next advances the iterator to the next item, fetching the next page if necessary.
+// It returns false when there are no more items, or when fetching a page fails.
+func (it *NotesListIterator) Next() bool {
+	for len(it.page) == 0 {
+		if it.done || it.err != nil {
+			return false
+		}
+		it.page, it.cursor, it.err = it.fetch(it.cursor)
+		if it.err != nil {
+			return false
+		}
+		it.done = it.cursor == ""
+	}
+	it.item, it.page = it.page[0], it.page[1:]
+	return true
+}
+
+// Item returns the current item.
+func (it *NotesListIterator) Item() Note {
+	return it.item
+}
+
+// Err returns the error which stopped the iteration, if any.
+func (it *NotesListIterator) Err() error {
+	return it.err
+}
+
+// Watch delivers the notes which are added after the subscription starts.
+// Notes are the notes which are added.
+func (cli *NotesClient) Watch(ctx context.Context, out func(Note) error,
+) error {
+	ctx, span := tracing.Start(ctx, "Notes/Watch", tracing.Client)
+	call := &Call{
+		Op:   "Watch",
+		Args: map[string]interface{}{},
+	}
+	err := cli.intercept(ctx, call, func(ctx context.Context) error {
+		var err error
+		err = cli.invokeWatch(ctx, out)
+		return err
+	})
+	span.End(callOutcome(err))
+	return err
+}
+
+// NotesWatchSubscription is a subscription to the events of the Watch operation, which are delivered over a channel.
+type NotesWatchSubscription struct {
+	events chan Note
+	cancel context.CancelFunc
+	done   chan struct{}
+	err    error
+}
+
+// Events returns the channel on which the events are delivered.
+// The channel is closed when the subscription ends.
+func (sub *NotesWatchSubscription) Events() <-chan Note {
+	return sub.events
+}
+
+// Err waits for the subscription to end, and returns the error which ended it.
+// The error is nil if the server ended the subscription, or if it was closed with Close.
+func (sub *NotesWatchSubscription) Err() error {
+	<-sub.done
+	return sub.err
+}
+
+// Close cancels the subscription, and waits for it to end.
+func (sub *NotesWatchSubscription) Close() {
+	sub.cancel()
+	<-sub.done
+}
+
+// SubscribeWatch subscribes to the events of the Watch operation, and delivers them over a channel.
+// The subscription runs until the context is cancelled, the subscription is closed, or the server ends it.
+func (cli *NotesClient) SubscribeWatch(ctx context.Context) *NotesWatchSubscription {
+	pctx := ctx
+	ctx, cancel := context.WithCancel(ctx)
+	sub := &NotesWatchSubscription{
+		events: make(chan Note),
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	go func() {
+		defer close(sub.done)
+		defer close(sub.events)
+		defer cancel()
+		err := cli.Watch(ctx, func(ev Note) error {
+			select {
+			case sub.events <- ev:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+		if err != nil && ctx.Err() == context.Canceled && pctx.Err() == nil {
+			// the subscription was closed
+			err = nil
+		}
+		sub.err = err
+	}()
+	return sub
+}
+
+// invokeWatch runs the Watch operation without applying call interceptors.
+func (cli *NotesClient) invokeWatch(ctx context.Context, out func(Note) error,
+) error {
+
+	u, err := cli.Base.Parse("Watch")
+	if err != nil {
+		return err
+	}
+
+	hdr := http.Header{}
+	setMetadataHeaders(ctx, hdr)
+	if err := cli.setCredentials(ctx, hdr, "bearer", "Authorization"); err != nil {
+		return err
+	}
+	tracing.Inject(ctx, hdr)
+	c, cerr, err := cli.dialWebSocket(ctx, u, hdr)
+	if err != nil {
+		return err
+	}
+	if cerr != nil {
+		switch cerr.Type {
+		case "UnauthorizedError":
+			var e UnauthorizedError
+			if json.Unmarshal(cerr.Payload, &e) == nil {
+				cerr.Err = e
+			}
+		}
+		return cerr
+	}
+
+	// unsubscribe by closing the WebSocket when the context is cancelled
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	stop := make(chan struct{})
+	defer close(stop)
+	defer c.ForceClose()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		select {
+		case <-ctx.Done():
+			cctx, ccancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer ccancel()
+			c.Close(cctx, 1000, "")
+		case <-stop:
+		}
+	}()
+
+	for {
+		if _, err := c.NextFrame(); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		var frame streamFrame
+		if err := c.ReadJSON(&frame); err != nil {
+			return err
+		}
+		if frame.Error != nil || frame.End {
+			// wait for the server to close the WebSocket
+			c.NextFrame()
+			if frame.Error == nil {
+				return nil
+			}
+			dat := []byte(frame.Error)
+			cerr := parseClientError(0, dat)
+			switch cerr.Type {
+			case "UnauthorizedError":
+				var e UnauthorizedError
+				if json.Unmarshal(cerr.Payload, &e) == nil {
+					cerr.Err = e
+				}
+			}
+			return cerr
+		}
+		var ev Note
+		if err := json.Unmarshal(frame.Value, &ev); err != nil {
+			return err
+		}
+		if err := out(ev); err != nil {
+			return err
+		}
+	}
+}
+
+// Count counts the notes, without authentication.
+// Count is the number of notes.
+func (cli *NotesClient) Count(ctx context.Context) (uint64, error) {
+	var r0 uint64
+	ctx, span := tracing.Start(ctx, "Notes/Count", tracing.Client)
+	ctx = withCallIdempotencyKey(ctx)
+	call := &Call{
+		Op:   "Count",
+		Args: map[string]interface{}{},
+	}
+	err := cli.intercept(ctx, call, func(ctx context.Context) error {
+		var err error
+		r0, err = cli.invokeCount(ctx)
+		if err == nil {
+			call.Results = map[string]interface{}{
+				"Count": r0,
+			}
+		}
+		return err
+	})
+	span.End(callOutcome(err))
+	return r0, err
+}
+
+// invokeCount runs the Count operation without applying call interceptors.
+func (cli *NotesClient) invokeCount(ctx context.Context) (uint64, error) {
+	u, err := cli.Base.Parse("Count")
+	if err != nil {
+		return 0, err
+	}
+
+	dat, err := json.Marshal(struct{}{})
+	if err != nil {
+		return 0, err
+	}
+	req, err := http.NewRequest(http.MethodPost, u.String(), bytes.NewReader(dat))
+	if err != nil {
+		return 0, err
+	}
+
+	setMetadataHeaders(ctx, req.Header)
+	if key, ok := ctx.Value(idempotencyKey{}).(string); ok {
+		req.Header.Set(idempotencyHeader, key)
+	}
+	tracing.Inject(ctx, req.Header)
+
+	if cli.Contextualize == nil {
+		req = req.WithContext(ctx)
+	} else {
+		cctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		req, err = cli.Contextualize(cctx, req)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	hcl := cli.httpClient()
+	resp, err := hcl.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		dat, eerr := ioutil.ReadAll(resp.Body)
+		if eerr != nil {
+			return 0, &ClientError{StatusCode: resp.StatusCode, Message: resp.Status}
+		}
+		cerr := parseClientError(resp.StatusCode, dat)
+		return 0, cerr
+	}
+
+	bdat, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return 0, err
+	}
+
+	var outputs struct {
+		Count uint64 `json:"Count"`
+	}
+	err = json.Unmarshal(bdat, &outputs)
+	if err != nil {
+		return 0, err
+	}
+
+	return outputs.Count, nil
+
+}
@@ -0,0 +1,320 @@
+// rpc-gen input hash: 42d2a95c720aa5612c70b3b46c3b8d61d0ac8f61976708dac3763d61740641a1
+
+package notes
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+var _ = io.EOF
+
+// conformanceCall is a call to a fake implementation, as recorded by a conformance wrapper.
+type conformanceCall struct {
+	// Args are the inputs which are not streamed, in order.
+	Args []interface{}
+
+	// In and InBytes are the elements and data read from the input stream.
+	In      []interface{}
+	InBytes []byte
+
+	// Results are the outputs which are not streamed, in order.
+	Results []interface{}
+
+	// Out and OutBytes are the elements and data written to the output stream.
+	Out      []interface{}
+	OutBytes []byte
+
+	// Wrote is whether anything was written to the output stream.
+	Wrote bool
+
+	// Err is the error returned by the fake implementation.
+	Err error
+}
+
+// conformanceSampler fills values with distinct samples, so that mixed up arguments are detected.
+type conformanceSampler struct {
+	n int
+}
+
+// fill sets the value pointed to by v to a sample, populating every exported field.
+func (s *conformanceSampler) fill(v interface{}) {
+	s.fillValue(reflect.ValueOf(v).Elem(), 0)
+}
+
+func (s *conformanceSampler) fillValue(v reflect.Value, depth int) {
+	if depth > 3 {
+		// recursive types are cut off with zero values
+		return
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		v.SetBool(true)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		s.n++
+		v.SetInt(int64(s.n%100 + 1))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		s.n++
+		v.SetUint(uint64(s.n%100 + 1))
+	case reflect.Float32, reflect.Float64:
+		s.n++
+		v.SetFloat(float64(s.n) + 0.5)
+	case reflect.String:
+		s.n++
+		v.SetString(fmt.Sprintf("sample%c", 'a'+s.n%26))
+	case reflect.Slice:
+		sl := reflect.MakeSlice(v.Type(), 2, 2)
+		for i := 0; i < sl.Len(); i++ {
+			s.fillValue(sl.Index(i), depth+1)
+		}
+		v.Set(sl)
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			s.fillValue(v.Index(i), depth+1)
+		}
+	case reflect.Map:
+		m := reflect.MakeMap(v.Type())
+		key := reflect.New(v.Type().Key()).Elem()
+		s.fillValue(key, depth+1)
+		val := reflect.New(v.Type().Elem()).Elem()
+		s.fillValue(val, depth+1)
+		m.SetMapIndex(key, val)
+		v.Set(m)
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).PkgPath == "" {
+				s.fillValue(v.Field(i), depth+1)
+			}
+		}
+	case reflect.Ptr:
+		p := reflect.New(v.Type().Elem())
+		s.fillValue(p.Elem(), depth+1)
+		v.Set(p)
+	}
+}
+
+// conformanceEqual checks whether two values are equivalent once encoded as JSON.
+func conformanceEqual(x, y interface{}) bool {
+	if reflect.DeepEqual(x, y) {
+		return true
+	}
+	xdat, xerr := json.Marshal(x)
+	ydat, yerr := json.Marshal(y)
+	return xerr == nil && yerr == nil && bytes.Equal(xdat, ydat)
+}
+
+// conformanceCompare checks that the values received on one side of a call match those sent by the other.
+// If partial is set, the received values may be a prefix of those sent.
+func conformanceCompare(t *testing.T, what string, sent, received []interface{}, partial bool) {
+	t.Helper()
+	if len(received) != len(sent) && !(partial && len(received) < len(sent)) {
+		t.Errorf("%s: %d values were sent, but %d were received", what, len(sent), len(received))
+		return
+	}
+	for i, v := range received {
+		if !conformanceEqual(sent[i], v) {
+			t.Errorf("%s: %#v was sent at index %d, but %#v was received", what, sent[i], i, v)
+		}
+	}
+}
+
+// conformanceCompareBytes checks that the data received on one side of a call matches that sent by the other.
+// If partial is set, the received data may be a prefix of that sent.
+func conformanceCompareBytes(t *testing.T, what string, sent, received []byte, partial bool) {
+	t.Helper()
+	if !bytes.Equal(sent, received) && !(partial && bytes.HasPrefix(sent, received)) {
+		t.Errorf("%s: %q was sent, but %q was received", what, sent, received)
+	}
+}
+
+// conformanceCheckErr checks that the error received by the client matches the error returned by the fake implementation.
+// If exact is not set, the error occurred after the output stream had started, and may not have been propagated.
+func conformanceCheckErr(t *testing.T, want, got error, exact bool) {
+	t.Helper()
+	switch {
+	case want == nil && got == nil:
+	case want == nil:
+		t.Errorf("unexpected error: %v", got)
+	case !exact:
+		t.Logf("the error %q was returned after the output stream started, and %v was received", want, got)
+	case got == nil:
+		t.Errorf("expected error %q, but the call succeeded", want)
+	default:
+		target := reflect.New(reflect.TypeOf(want))
+		if errors.As(got, target.Interface()) {
+			if !conformanceEqual(target.Elem().Interface(), want) {
+				t.Errorf("expected error %#v; got %#v", want, target.Elem().Interface())
+			}
+			return
+		}
+		var cerr *ClientError
+		if !errors.As(got, &cerr) || cerr.Message != want.Error() {
+			t.Errorf("expected error %q; got %v", want, got)
+		}
+	}
+}
+
+// conformanceAuthenticator accepts every call, so that authenticated operations reach the fake implementation.
+type conformanceAuthenticator struct{}
+
+func (conformanceAuthenticator) Authenticate(ctx context.Context, system string, op string, cred Credentials) (context.Context, error) {
+	return ctx, nil
+}
+
+// conformanceNotes wraps the fake implementation of Notes, recording the last call.
+type conformanceNotes struct {
+	impl Notes
+
+	lock sync.Mutex
+	last conformanceCall
+}
+
+func (c *conformanceNotes) record(call conformanceCall) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.last = call
+}
+
+// take returns the last call, and clears it.
+func (c *conformanceNotes) take() conformanceCall {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	call := c.last
+	c.last = conformanceCall{}
+	return call
+}
+
+// Create records the call and invokes the fake implementation.
+func (c *conformanceNotes) Create(ctx context.Context, Text string) (Added Note, err error) {
+	var rec conformanceCall
+	rec.Args = []interface{}{Text}
+	Added, err = c.impl.Create(ctx, Text)
+	rec.Results = []interface{}{Added}
+	rec.Err = err
+	c.record(rec)
+	return Added, err
+}
+
+// List records the call and invokes the fake implementation.
+func (c *conformanceNotes) List(ctx context.Context, Prefix string, Cursor string, Limit uint32) (Notes []Note, NextCursor string, err error) {
+	var rec conformanceCall
+	rec.Args = []interface{}{Prefix, Cursor, Limit}
+	Notes, NextCursor, err = c.impl.List(ctx, Prefix, Cursor, Limit)
+	rec.Results = []interface{}{Notes, NextCursor}
+	rec.Err = err
+	c.record(rec)
+	return Notes, NextCursor, err
+}
+
+// Watch records the call and invokes the fake implementation.
+func (c *conformanceNotes) Watch(ctx context.Context, Notes func(Note) error) error {
+	var rec conformanceCall
+	rec.Args = []interface{}{}
+	recOut := Notes
+	Notes = func(v Note) error {
+		rec.Wrote = true
+		rec.Out = append(rec.Out, v)
+		return recOut(v)
+	}
+	err := c.impl.Watch(ctx, Notes)
+	rec.Err = err
+	c.record(rec)
+	return err
+}
+
+// Count records the call and invokes the fake implementation.
+func (c *conformanceNotes) Count(ctx context.Context) (Count uint64, err error) {
+	var rec conformanceCall
+	rec.Args = []interface{}{}
+	Count, err = c.impl.Count(ctx)
+	rec.Results = []interface{}{Count}
+	rec.Err = err
+	c.record(rec)
+	return Count, err
+}
+
+// TestNotesConformance runs each operation of Notes through the generated client and HTTP handler, with sample arguments.
+// It checks that the arguments, results, and errors of each call are carried through unchanged.
+// The fake implementation is created by newNotesFake, which must be defined in a hand-written test file of the package.
+// A MockNotes may be used as the fake.
+func TestNotesConformance(t *testing.T) {
+	fake := &conformanceNotes{impl: newNotesFake(t)}
+	srv := httptest.NewServer(NewHTTPNotesHandlerWithOptions(fake, HTTPNotesHandlerOptions{
+		Authenticator: conformanceAuthenticator{},
+	}))
+	defer srv.Close()
+	cli, err := NewNotesClient(srv.URL, ClientOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cli.Token = "conformance"
+	ctx := context.Background()
+	var sample conformanceSampler
+
+	t.Run("Create", func(t *testing.T) {
+		var a0 string
+		sample.fill(&a0)
+		if verr := validateNotesCreate(a0); verr != nil {
+			t.Skipf("the sample arguments are invalid: %v", verr)
+		}
+
+		r0, err := cli.Create(ctx, a0)
+		call := fake.take()
+		conformanceCheckErr(t, call.Err, err, !call.Wrote)
+		conformanceCompare(t, "arguments", []interface{}{a0}, call.Args, false)
+		if err == nil {
+			conformanceCompare(t, "results", call.Results, []interface{}{r0}, false)
+		}
+	})
+
+	t.Run("List", func(t *testing.T) {
+		var a0 string
+		sample.fill(&a0)
+		var a1 string
+		sample.fill(&a1)
+		var a2 uint32
+		sample.fill(&a2)
+
+		r0, r1, err := cli.List(ctx, a0, a1, a2)
+		call := fake.take()
+		conformanceCheckErr(t, call.Err, err, !call.Wrote)
+		conformanceCompare(t, "arguments", []interface{}{a0, a1, a2}, call.Args, false)
+		if err == nil {
+			conformanceCompare(t, "results", call.Results, []interface{}{r0, r1}, false)
+		}
+	})
+
+	t.Run("Watch", func(t *testing.T) {
+		var out []interface{}
+		outFunc := func(v Note) error {
+			out = append(out, v)
+			return nil
+		}
+
+		err := cli.Watch(ctx, outFunc)
+		call := fake.take()
+		conformanceCheckErr(t, call.Err, err, true)
+		conformanceCompare(t, "arguments", []interface{}{}, call.Args, false)
+		conformanceCompare(t, "output stream", call.Out, out, err != nil)
+	})
+
+	t.Run("Count", func(t *testing.T) {
+
+		r0, err := cli.Count(ctx)
+		call := fake.take()
+		conformanceCheckErr(t, call.Err, err, !call.Wrote)
+		conformanceCompare(t, "arguments", []interface{}{}, call.Args, false)
+		if err == nil {
+			conformanceCompare(t, "results", call.Results, []interface{}{r0}, false)
+		}
+	})
+
+}
@@ -0,0 +1,312 @@
+package notes
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testAuthenticator accepts every token.
+type testAuthenticator struct{}
+
+func (testAuthenticator) Authenticate(ctx context.Context, system string, op string, cred Credentials) (context.Context, error) {
+	return ctx, nil
+}
+
+// newTestServer serves an implementation of Notes with an in-memory idempotency store.
+func newTestServer(t *testing.T, impl Notes) *httptest.Server {
+	srv := httptest.NewServer(NewHTTPNotesHandlerWithOptions(impl, HTTPNotesHandlerOptions{
+		Authenticator:    testAuthenticator{},
+		IdempotencyStore: &MemoryIdempotencyStore{},
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// postCreate calls Create with a token and an idempotency key, returning the status code and body of the response.
+func postCreate(t *testing.T, srv *httptest.Server, token, key, text string) (int, string) {
+	req, err := http.NewRequest(http.MethodPost, srv.URL+"/Create", strings.NewReader(`{"Text":"`+text+`"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Idempotency-Key", key)
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, string(body)
+}
+
+func TestIdempotency(t *testing.T) {
+	t.Run("Replay", func(t *testing.T) {
+		fake := &fakeNotes{}
+		srv := newTestServer(t, fake)
+		code1, body1 := postCreate(t, srv, "alice", "k1", "a")
+		code2, body2 := postCreate(t, srv, "alice", "k1", "a")
+		if code1 != http.StatusOK || code2 != http.StatusOK {
+			t.Fatalf("expected two successful calls but got %d and %d", code1, code2)
+		}
+		if body1 != body2 {
+			t.Errorf("expected the response %q to be replayed but got %q", body1, body2)
+		}
+		if len(fake.notes) != 1 {
+			t.Errorf("expected 1 note but got %d", len(fake.notes))
+		}
+	})
+
+	t.Run("Scope", func(t *testing.T) {
+		// A caller with different credentials can not replay the response to another caller.
+		fake := &fakeNotes{}
+		srv := newTestServer(t, fake)
+		postCreate(t, srv, "alice", "k1", "a")
+		code, _ := postCreate(t, srv, "bob", "k1", "a")
+		if code != http.StatusOK {
+			t.Fatalf("expected a successful call but got %d", code)
+		}
+		if len(fake.notes) != 2 {
+			t.Errorf("expected 2 notes but got %d", len(fake.notes))
+		}
+	})
+
+	t.Run("Mismatch", func(t *testing.T) {
+		fake := &fakeNotes{}
+		srv := newTestServer(t, fake)
+		postCreate(t, srv, "alice", "k1", "a")
+		code, body := postCreate(t, srv, "alice", "k1", "b")
+		if code != http.StatusUnprocessableEntity {
+			t.Errorf("expected status %d but got %d (%s)", http.StatusUnprocessableEntity, code, body)
+		}
+		if len(fake.notes) != 1 {
+			t.Errorf("expected 1 note but got %d", len(fake.notes))
+		}
+	})
+
+	t.Run("InProgress", func(t *testing.T) {
+		started, release := make(chan struct{}), make(chan struct{})
+		mock := &MockNotes{
+			CreateFunc: func(ctx context.Context, Text string) (Note, error) {
+				close(started)
+				<-release
+				return Note{ID: 1, Text: Text}, nil
+			},
+		}
+		srv := newTestServer(t, mock)
+		done := make(chan int)
+		go func() {
+			code, _ := postCreate(t, srv, "alice", "k1", "a")
+			done <- code
+		}()
+		<-started
+
+		// A concurrent call with the same key is rejected rather than run again.
+		code, body := postCreate(t, srv, "alice", "k1", "a")
+		if code != http.StatusConflict {
+			t.Errorf("expected status %d but got %d (%s)", http.StatusConflict, code, body)
+		}
+
+		close(release)
+		if code := <-done; code != http.StatusOK {
+			t.Fatalf("expected a successful call but got %d", code)
+		}
+		if code, _ := postCreate(t, srv, "alice", "k1", "a"); code != http.StatusOK {
+			t.Errorf("expected the response to be replayed but got %d", code)
+		}
+		if n := len(mock.MockCallsTo("Create")); n != 1 {
+			t.Errorf("expected 1 call but got %d", n)
+		}
+	})
+
+	t.Run("ServerError", func(t *testing.T) {
+		// A call which fails on the server releases the key, so that it can be retried.
+		var calls int
+		mock := &MockNotes{
+			CreateFunc: func(ctx context.Context, Text string) (Note, error) {
+				calls++
+				if calls == 1 {
+					return Note{}, errors.New("unavailable")
+				}
+				return Note{ID: 1, Text: Text}, nil
+			},
+		}
+		srv := newTestServer(t, mock)
+		if code, _ := postCreate(t, srv, "alice", "k1", "a"); code != http.StatusInternalServerError {
+			t.Fatalf("expected status %d but got %d", http.StatusInternalServerError, code)
+		}
+		if code, body := postCreate(t, srv, "alice", "k1", "a"); code != http.StatusOK {
+			t.Errorf("expected a successful retry but got %d (%s)", code, body)
+		}
+		if calls != 2 {
+			t.Errorf("expected 2 calls but got %d", calls)
+		}
+	})
+
+	t.Run("TooLarge", func(t *testing.T) {
+		// The body is buffered to fingerprint the request, so the size of requests with a key is limited.
+		fake := &fakeNotes{}
+		srv := httptest.NewServer(NewHTTPNotesHandlerWithOptions(fake, HTTPNotesHandlerOptions{
+			Authenticator:          testAuthenticator{},
+			IdempotencyStore:       &MemoryIdempotencyStore{},
+			IdempotencyMaxBodySize: 16,
+		}))
+		defer srv.Close()
+		if code, body := postCreate(t, srv, "alice", "k1", strings.Repeat("a", 16)); code != http.StatusRequestEntityTooLarge {
+			t.Errorf("expected status %d but got %d (%s)", http.StatusRequestEntityTooLarge, code, body)
+		}
+		if code, body := postCreate(t, srv, "alice", "k2", "a"); code != http.StatusOK {
+			t.Errorf("expected a successful call but got %d (%s)", code, body)
+		}
+		if len(fake.notes) != 1 {
+			t.Errorf("expected 1 note but got %d", len(fake.notes))
+		}
+	})
+
+	t.Run("Expiry", func(t *testing.T) {
+		// Expired entries are discarded in the order in which they were put, skipping entries which were replaced since.
+		store := &MemoryIdempotencyStore{TTL: time.Hour}
+		start := time.Now()
+		store.put("a", memoryStoredResponse{}, start)
+		store.put("b", memoryStoredResponse{}, start.Add(30*time.Minute))
+		store.put("c", memoryStoredResponse{}, start.Add(61*time.Minute))
+		if _, ok := store.responses["a"]; ok {
+			t.Error("expired entry a was not discarded")
+		}
+		store.put("b", memoryStoredResponse{}, start.Add(62*time.Minute))
+		store.put("d", memoryStoredResponse{}, start.Add(100*time.Minute))
+		if _, ok := store.responses["b"]; !ok {
+			t.Error("replaced entry b was discarded when its previous entry expired")
+		}
+		if n := len(store.responses); n != 3 {
+			t.Errorf("expected 3 entries but got %d", n)
+		}
+		if n := len(store.expiry); n != 3 {
+			t.Errorf("expected 3 pending expiries but got %d", n)
+		}
+	})
+
+	t.Run("Client", func(t *testing.T) {
+		fake := &fakeNotes{}
+		srv := newTestServer(t, fake)
+		cli, err := NewNotesClient(srv.URL, ClientOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		cli.Token = "alice"
+		ctx := WithIdempotencyKey(context.Background(), "k1")
+		first, err := cli.Create(ctx, "a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		second, err := cli.Create(ctx, "a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if first != second || len(fake.notes) != 1 {
+			t.Errorf("expected %v to be replayed but got %v (with %d notes)", first, second, len(fake.notes))
+		}
+	})
+}
+
+func TestRateLimit(t *testing.T) {
+	srv := newTestServer(t, &fakeNotes{})
+	cli, err := NewNotesClient(srv.URL, ClientOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cli.Token = "alice"
+	for i := 0; i < 100; i++ {
+		_, err := cli.Create(context.Background(), "a")
+		var rerr RateLimitError
+		if errors.As(err, &rerr) {
+			if rerr.Op != "Create" {
+				t.Errorf("expected the limit of Create but got %q", rerr.Op)
+			}
+			return
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Error("the rate limit was not applied")
+}
+
+func TestAuth(t *testing.T) {
+	srv := newTestServer(t, &fakeNotes{})
+	cli, err := NewNotesClient(srv.URL, ClientOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var uerr UnauthorizedError
+	if _, err := cli.Create(context.Background(), "a"); !errors.As(err, &uerr) {
+		t.Errorf("expected an UnauthorizedError without a token but got %v", err)
+	}
+	if _, err := cli.Count(context.Background()); err != nil {
+		t.Errorf("failed to call an operation without authentication: %v", err)
+	}
+}
+
+func TestPagination(t *testing.T) {
+	fake := &fakeNotes{}
+	for i := 0; i < 25; i++ {
+		fake.Create(context.Background(), "note")
+	}
+	srv := newTestServer(t, fake)
+	cli, err := NewNotesClient(srv.URL, ClientOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cli.Token = "alice"
+	it := cli.IterateList(context.Background(), "", 10)
+	var id uint64
+	for it.Next() {
+		id++
+		if it.Item().ID != id {
+			t.Fatalf("expected note %d but got %d", id, it.Item().ID)
+		}
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if id != 25 {
+		t.Errorf("expected 25 notes but got %d", id)
+	}
+}
+
+func TestSubscription(t *testing.T) {
+	var pub NotesWatchPublisher
+	srv := newTestServer(t, &MockNotes{
+		WatchFunc: func(ctx context.Context, Notes func(Note) error) error {
+			return pub.Subscribe(ctx, Notes)
+		},
+	})
+	cli, err := NewNotesClient(srv.URL, ClientOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cli.Token = "alice"
+	sub := cli.SubscribeWatch(context.Background())
+	defer sub.Close()
+	for pub.Subscribers() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	pub.Publish(Note{ID: 1, Text: "a"})
+	select {
+	case note := <-sub.Events():
+		if note != (Note{ID: 1, Text: "a"}) {
+			t.Errorf("expected the published note but got %v", note)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("no event was delivered (%v)", sub.Err())
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/format"
+	"go/scanner"
+	"os/exec"
+	"strings"
+)
+
+// maxFormatErrors is the maximum number of syntax errors reported from generated code.
+const maxFormatErrors = 5
+
+// formatGo formats generated Go source.
+// If the source is not valid Go, the error includes the offending lines of the generated code.
+func formatGo(name string, src []byte) ([]byte, error) {
+	out, err := format.Source(src)
+	if err == nil {
+		return out, nil
+	}
+	var errs scanner.ErrorList
+	if !errors.As(err, &errs) {
+		return nil, err
+	}
+
+	lines := strings.Split(string(src), "\n")
+	var b strings.Builder
+	fmt.Fprintf(&b, "generated code is invalid:")
+	for i, e := range errs {
+		if i == maxFormatErrors {
+			fmt.Fprintf(&b, "\n(and %d more errors)", len(errs)-i)
+			break
+		}
+		fmt.Fprintf(&b, "\n%s:%d:%d: %s\n", name, e.Pos.Line, e.Pos.Column, e.Msg)
+		for l := e.Pos.Line - 2; l <= e.Pos.Line+2; l++ {
+			if l < 1 || l > len(lines) {
+				continue
+			}
+			line := strings.Replace(lines[l-1], "\t", "    ", -1)
+			fmt.Fprintf(&b, "%6d | %s\n", l, line)
+			if l == e.Pos.Line {
+				prefix := lines[l-1]
+				if e.Pos.Column-1 < len(prefix) {
+					prefix = prefix[:e.Pos.Column-1]
+				}
+				col := len(strings.Replace(prefix, "\t", "    ", -1))
+				fmt.Fprintf(&b, "       | %s^\n", strings.Repeat(" ", col))
+			}
+		}
+	}
+	return nil, errors.New(strings.TrimSuffix(b.String(), "\n"))
+}
+
+// goimports runs the goimports tool on Go source, in order to fix up the imports.
+func goimports(src []byte) ([]byte, error) {
+	path, err := exec.LookPath("goimports")
+	if err != nil {
+		return nil, fmt.Errorf("goimports not available: %w", err)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(path)
+	cmd.Stdin = bytes.NewReader(src)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("goimports failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
@@ -1,20 +1,27 @@
 package main
 
 import (
+	"bytes"
+	"embed"
+	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"math"
 	"net/http"
 	"net/url"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"reflect"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"text/scanner"
 	"text/template"
+	"time"
 
 	"github.com/niaow/exp/conf"
 )
@@ -128,9 +135,9 @@ func (st StructType) String() string {
 func (st StructType) GoType() string {
 	fields := make([]string, len(st))
 	for i, a := range st {
-		fields[i] = "\t" + strings.Replace(fmt.Sprintf("// %s\n%s %s `json:\"%s,omitempty\"`",
+		fields[i] = "\t" + strings.Replace(fmt.Sprintf("// %s\n%s %s %s",
 			strings.Replace(a.Description, "\n", "\n// ", -1),
-			a.Name, a.Type.GoType(), a.Name,
+			a.Name, a.Type.GoType(), a.JSONTag(),
 		), "\n", "\n\t", -1)
 	}
 	return fmt.Sprintf("struct {\n\t%s\n}", strings.Join(fields, "\n\n\t"))
@@ -147,12 +154,15 @@ func (st *StructType) parse(scan conf.Scanner, pos scanner.Position) error {
 	if scan.Tok() != '{' {
 		return conf.Unexpected(scan)
 	}
-	bscan := conf.ScanBracket(scan, '{', '}')
+	bscan := conf.Lookahead(conf.ScanBracket(scan, '{', '}'))
 
 	for bscan.Next() {
+		// leave the first token of the field for the field parser
+		fpos := bscan.Pos()
+		bscan.Unread()
 		sscan := conf.ScanSemicolon(bscan, openers, closers)
 		var a Arg
-		err := a.parse(sscan, pos, true, parseTypeNamed)
+		err := a.parse(sscan, fpos, parseTypeNamed)
 		if err != nil {
 			return conf.WrapPos(err, pos)
 		}
@@ -173,6 +183,9 @@ func (st *StructType) parse(scan conf.Scanner, pos scanner.Position) error {
 	if len(*st) == 0 {
 		*st = StructType{}
 	}
+	if err := checkWireNames(*st, "field"); err != nil {
+		return conf.WrapPos(err, pos)
+	}
 
 	return nil
 }
@@ -209,8 +222,34 @@ func parseStream(scan conf.Scanner, pos scanner.Position) (Type, error) {
 }
 
 // ByteStream is a special type of stream which sends raw data over http.
+// It may also be written as "blob" or "bytes" in a spec.
 var ByteStream = StreamType{ByteType}
 
+// GoMappedType is a type which is represented in Go by an existing Go type, as specified by a "gotype" directive.
+// The Go type must be encoded in JSON in the same form as the underlying type (e.g. time.Time as a string).
+type GoMappedType struct {
+	// Type is the underlying type, as seen by schemas and other languages.
+	Type Type
+
+	// Go is the Go type, qualified by its package name (e.g. "time.Time").
+	Go string
+
+	// Import is the import path of the package containing the Go type.
+	Import string
+}
+
+func (mt GoMappedType) String() string {
+	return mt.Type.String()
+}
+
+// GoType returns the Go representation of the type.
+func (mt GoMappedType) GoType() string {
+	return mt.Go
+}
+
+// goTypeRegexp matches a Go type in a "gotype" directive, capturing the package name.
+var goTypeRegexp = regexp.MustCompile(`^\*?([A-Za-z_][A-Za-z0-9_]*)\.[A-Za-z_][A-Za-z0-9_]*$`)
+
 type typeParser func(conf.Scanner, scanner.Position) (Type, error)
 
 func parseTypeInline(scan conf.Scanner, pos scanner.Position) (Type, error) {
@@ -232,6 +271,8 @@ func parseTypeInline(scan conf.Scanner, pos scanner.Position) (Type, error) {
 				return nil, conf.WrapPos(errors.New("structs not allowed inline"), pos)
 			case "stream":
 				return parseStream(scan, scan.Pos())
+			case "blob", "bytes":
+				return ByteStream, nil
 			default:
 				return NamedType(tstr), nil
 			}
@@ -268,7 +309,7 @@ func parseTypeNamed(scan conf.Scanner, pos scanner.Position) (Type, error) {
 					return nil, err
 				}
 				return st, nil
-			case "stream":
+			case "stream", "blob", "bytes":
 				return nil, conf.WrapPos(errors.New("streams may not be stored in a compound type"), scan.Pos())
 			default:
 				return NamedType(tstr), nil
@@ -295,6 +336,9 @@ type TypeDef struct {
 
 	// Description is a human-readable description of the type.
 	Description string
+
+	// Pos is the position of the definition in the spec.
+	Pos scanner.Position
 }
 
 func parseTypeDef(scan conf.Scanner, pos scanner.Position) (TypeDef, error) {
@@ -338,6 +382,7 @@ func parseTypeDef(scan conf.Scanner, pos scanner.Position) (TypeDef, error) {
 		Name:        name,
 		Type:        t,
 		Description: desc,
+		Pos:         pos,
 	}, nil
 }
 
@@ -352,6 +397,95 @@ type Arg struct {
 	// Description is the human-readable description of the argument.
 	// This is *NOT* optional.
 	Description string
+
+	// Min and Max are the inclusive bounds of a numeric argument, as Go number literals.
+	// An empty string indicates that there is no bound.
+	Min, Max string
+
+	// MaxLen is the maximum length of a string (in characters) or array argument.
+	// Zero indicates that there is no maximum.
+	MaxLen int
+
+	// Pattern is a regular expression which a string argument must match.
+	// Empty strings are not checked against the pattern, so combine it with Required to reject them.
+	Pattern string
+
+	// Required indicates that the argument must not be the zero value.
+	Required bool
+
+	// JSONName is the name of the argument on the wire, which is set by the "jsonname" directive.
+	// Defaults to Name.
+	JSONName string
+
+	// KeepEmpty indicates that the argument is sent even if it is the zero value.
+	// By default, zero values are omitted, which is indistinguishable from an absent value.
+	// This is set by the "noomitempty" directive.
+	KeepEmpty bool
+
+	// Pos is the position of the definition in the spec.
+	Pos scanner.Position
+
+	// mapped is the Go type mapping from a "gotype" directive.
+	// It is applied to Type when the argument is prepared.
+	mapped *GoMappedType
+}
+
+// WireName returns the name of the argument on the wire.
+func (a Arg) WireName() string {
+	if a.JSONName != "" {
+		return a.JSONName
+	}
+	return a.Name
+}
+
+// JSONTag returns the Go struct tag of the argument, including the backquotes.
+func (a Arg) JSONTag() string {
+	opts := ",omitempty"
+	if a.KeepEmpty {
+		opts = ""
+	}
+	return "`json:\"" + a.WireName() + opts + "\"`"
+}
+
+// checkWireNames checks that the wire names of a set of arguments are unique.
+// The kind describes the arguments for the error.
+func checkWireNames(args []Arg, kind string) error {
+	names := map[string]string{}
+	for _, a := range args {
+		if prev, ok := names[a.WireName()]; ok {
+			return conf.WrapPos(fmt.Errorf("%s %q has the same wire name %q as %s %q", kind, a.Name, a.WireName(), kind, prev), a.Pos)
+		}
+		names[a.WireName()] = a.Name
+	}
+	return nil
+}
+
+// jsonNameRegexp matches the wire names which may be set with the "jsonname" directive.
+var jsonNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_\-.]*$`)
+
+// constrained checks whether any validation constraints are applied to the argument.
+func (a Arg) constrained() bool {
+	return a.Min != "" || a.Max != "" || a.MaxLen != 0 || a.Pattern != "" || a.Required
+}
+
+// scanNumber scans a possibly-negative number literal.
+func scanNumber(scan conf.Scanner, pos scanner.Position) (string, error) {
+	var sign string
+	if scan.Tok() == '-' {
+		sign = "-"
+		if !scan.Next() {
+			if err := scan.Err(); err != nil {
+				return "", conf.WrapPos(err, pos)
+			}
+			return "", conf.WrapPos(errors.New("missing number after sign"), pos)
+		}
+	}
+	switch scan.Tok() {
+	case scanner.Int, scanner.Float:
+		return sign + scan.Text(), nil
+	default:
+		return "", conf.Unexpected(scan)
+	}
 }
 
 func (a *Arg) directive(dir string, pos scanner.Position, scan conf.Scanner, tp typeParser) error {
@@ -399,6 +533,128 @@ func (a *Arg) directive(dir string, pos scanner.Position, scan conf.Scanner, tp
 		} else {
 			a.Description += "\n" + desc
 		}
+	case "min", "max":
+		if !scan.Next() {
+			if err := scan.Err(); err != nil {
+				return conf.WrapPos(err, pos)
+			}
+			return conf.WrapPos(fmt.Errorf("missing %s argument", dir), pos)
+		}
+		num, err := scanNumber(scan, pos)
+		if err != nil {
+			return err
+		}
+		bound := &a.Min
+		if dir == "max" {
+			bound = &a.Max
+		}
+		if *bound != "" {
+			return conf.WrapPos(fmt.Errorf("duplicate %s directive", dir), pos)
+		}
+		*bound = num
+	case "maxlen":
+		if !scan.Next() {
+			if err := scan.Err(); err != nil {
+				return conf.WrapPos(err, pos)
+			}
+			return conf.WrapPos(errors.New("missing maxlen argument"), pos)
+		}
+		switch scan.Tok() {
+		case scanner.Int:
+			n, err := strconv.Atoi(scan.Text())
+			if err != nil {
+				return conf.WrapPos(err, scan.Pos())
+			}
+			if n <= 0 {
+				return conf.WrapPos(errors.New("maxlen must be positive"), scan.Pos())
+			}
+			if a.MaxLen != 0 {
+				return conf.WrapPos(errors.New("duplicate maxlen directive"), pos)
+			}
+			a.MaxLen = n
+		default:
+			return conf.Unexpected(scan)
+		}
+	case "pattern":
+		if !scan.Next() {
+			if err := scan.Err(); err != nil {
+				return conf.WrapPos(err, pos)
+			}
+			return conf.WrapPos(errors.New("missing pattern argument"), pos)
+		}
+		if scan.Tok() != scanner.String {
+			return conf.WrapPos(errors.New("patterns must be quoted"), scan.Pos())
+		}
+		pattern, err := conf.ScanString(scan)
+		if err != nil {
+			return conf.WrapPos(err, pos)
+		}
+		if _, err := regexp.Compile(pattern); err != nil {
+			return conf.WrapPos(err, scan.Pos())
+		}
+		if a.Pattern != "" {
+			return conf.WrapPos(errors.New("duplicate pattern directive"), pos)
+		}
+		a.Pattern = pattern
+	case "required":
+		if a.Required {
+			return conf.WrapPos(errors.New("duplicate required directive"), pos)
+		}
+		a.Required = true
+	case "gotype":
+		if !scan.Next() {
+			if err := scan.Err(); err != nil {
+				return conf.WrapPos(err, pos)
+			}
+			return conf.WrapPos(errors.New("missing gotype argument"), pos)
+		}
+		gotype, err := conf.ScanString(scan)
+		if err != nil {
+			return conf.WrapPos(err, pos)
+		}
+		m := goTypeRegexp.FindStringSubmatch(gotype)
+		if m == nil {
+			return conf.WrapPos(fmt.Errorf("invalid Go type %q (expected a form like \"time.Time\")", gotype), scan.Pos())
+		}
+		if a.mapped != nil {
+			return conf.WrapPos(errors.New("duplicate gotype directive"), pos)
+		}
+		a.mapped = &GoMappedType{Go: gotype, Import: m[1]}
+		if !scan.Next() {
+			if err := scan.Err(); err != nil {
+				return conf.WrapPos(err, pos)
+			}
+			return nil
+		}
+		// the import path may differ from the package name
+		path, err := conf.ScanString(scan)
+		if err != nil {
+			return conf.WrapPos(err, pos)
+		}
+		a.mapped.Import = path
+	case "jsonname":
+		if !scan.Next() {
+			if err := scan.Err(); err != nil {
+				return conf.WrapPos(err, pos)
+			}
+			return conf.WrapPos(errors.New("missing jsonname argument"), pos)
+		}
+		name, err := conf.ScanString(scan)
+		if err != nil {
+			return conf.WrapPos(err, pos)
+		}
+		if !jsonNameRegexp.MatchString(name) {
+			return conf.WrapPos(fmt.Errorf("invalid JSON name %q", name), scan.Pos())
+		}
+		if a.JSONName != "" {
+			return conf.WrapPos(errors.New("duplicate jsonname directive"), pos)
+		}
+		a.JSONName = name
+	case "noomitempty":
+		if a.KeepEmpty {
+			return conf.WrapPos(errors.New("duplicate noomitempty directive"), pos)
+		}
+		a.KeepEmpty = true
 	default:
 		return conf.WrapPos(ErrInvalidDirective{dir}, pos)
 	}
@@ -413,14 +669,13 @@ func (a *Arg) directive(dir string, pos scanner.Position, scan conf.Scanner, tp
 	return nil
 }
 
-func (a *Arg) parse(scan conf.Scanner, pos scanner.Position, nostart bool, tp typeParser) error {
-	if !nostart {
-		if !scan.Next() {
-			if err := scan.Err(); err != nil {
-				return conf.WrapPos(err, pos)
-			}
-			return conf.WrapPos(errors.New("missing definition"), pos)
+func (a *Arg) parse(scan conf.Scanner, pos scanner.Position, tp typeParser) error {
+	a.Pos = pos
+	if !scan.Next() {
+		if err := scan.Err(); err != nil {
+			return conf.WrapPos(err, pos)
 		}
+		return conf.WrapPos(errors.New("missing definition"), pos)
 	}
 	switch scan.Tok() {
 	case scanner.RawString, scanner.String:
@@ -495,8 +750,19 @@ func (a *Arg) prep() error {
 	default:
 		return fmt.Errorf("argument %q has invalid type %q", a.Name, a.Type)
 	}*/
-	if a.Description == "" {
-		return fmt.Errorf("argument %q missing description", a.Name)
+	if _, ok := a.Type.(StreamType); ok && (a.JSONName != "" || a.KeepEmpty) {
+		return fmt.Errorf("argument %q is a stream, so its JSON field cannot be configured", a.Name)
+	}
+	if a.mapped != nil {
+		switch a.Type.(type) {
+		case nil:
+			return fmt.Errorf("argument %q has a gotype but no type", a.Name)
+		case StreamType:
+			return fmt.Errorf("argument %q is a stream and cannot have a gotype", a.Name)
+		}
+		a.mapped.Type = a.Type
+		a.Type = *a.mapped
+		a.mapped = nil
 	}
 	return nil
 }
@@ -520,6 +786,13 @@ type Error struct {
 	// Code is the corresponding HTTP status code.
 	// Defaults to http.StatusInternalServerError.
 	Code int
+
+	// ErrCode is the machine-readable code of the error, which is independent of the HTTP status.
+	// This is a Go string or integer literal, or empty if the error does not have a code.
+	ErrCode string
+
+	// Pos is the position of the definition in the spec.
+	Pos scanner.Position
 }
 
 func (e *Error) directive(dir string, pos scanner.Position, scan conf.Scanner) error {
@@ -541,7 +814,7 @@ func (e *Error) directive(dir string, pos scanner.Position, scan conf.Scanner) e
 		e.Name = name
 	case "field":
 		var a Arg
-		err := a.parse(scan, pos, false, parseTypeInline)
+		err := a.parse(scan, pos, parseTypeInline)
 		if err != nil {
 			return conf.WrapPos(err, pos)
 		}
@@ -615,6 +888,34 @@ func (e *Error) directive(dir string, pos scanner.Position, scan conf.Scanner) e
 		default:
 			return conf.Unexpected(scan)
 		}
+	case "errcode":
+		if !scan.Next() {
+			if err := scan.Err(); err != nil {
+				return conf.WrapPos(err, pos)
+			}
+			return conf.WrapPos(errors.New("missing errcode argument"), pos)
+		}
+		if e.ErrCode != "" {
+			return conf.WrapPos(errors.New("duplicate errcode directive"), pos)
+		}
+		switch scan.Tok() {
+		case scanner.Int:
+			if _, err := strconv.ParseInt(scan.Text(), 0, 64); err != nil {
+				return conf.WrapPos(err, scan.Pos())
+			}
+			e.ErrCode = scan.Text()
+		case scanner.String, scanner.RawString:
+			code, err := conf.ScanString(scan)
+			if err != nil {
+				return conf.WrapPos(err, scan.Pos())
+			}
+			if code == "" {
+				return conf.WrapPos(errors.New("empty error code"), scan.Pos())
+			}
+			e.ErrCode = strconv.Quote(code)
+		default:
+			return conf.Unexpected(scan)
+		}
 	default:
 		return conf.WrapPos(ErrInvalidDirective{dir}, pos)
 	}
@@ -630,6 +931,7 @@ func (e *Error) directive(dir string, pos scanner.Position, scan conf.Scanner) e
 }
 
 func (e *Error) parse(scan conf.Scanner, pos scanner.Position) error {
+	e.Pos = pos
 	if !scan.Next() {
 		if err := scan.Err(); err != nil {
 			return conf.WrapPos(err, pos)
@@ -693,18 +995,171 @@ func (e *Error) prep() error {
 			return err
 		}
 	}
+	if err := checkWireNames(e.Fields, "field"); err != nil {
+		return err
+	}
 	if e.Text == "" {
 		return fmt.Errorf("error %q missing display text", e.Name)
 	}
-	if e.Description == "" {
-		return fmt.Errorf("error %q missing description", e.Name)
-	}
 	if e.Code == 0 {
 		e.Code = http.StatusInternalServerError
 	}
 	return nil
 }
 
+// RateLimit is the rate at which each client may call an operation.
+// Calls are limited with a token bucket, which holds up to Burst tokens and is refilled at a rate of Limit tokens every Per.
+type RateLimit struct {
+	// Limit is the number of calls permitted in each period.
+	Limit float64
+
+	// Per is the length of the period.
+	Per time.Duration
+
+	// Burst is the number of calls which may be made at once.
+	// Defaults to the limit, rounded up.
+	Burst int
+}
+
+// PerSecond returns the rate at which the token bucket is refilled, in tokens per second.
+func (rl RateLimit) PerSecond() float64 {
+	return rl.Limit / rl.Per.Seconds()
+}
+
+// parseRateLimit parses the arguments of a ratelimit directive, such as "100/s burst 20".
+// The period may be a unit ("s", "m", or "h") or a duration ("10s").
+// All of the tokens of the directive are consumed.
+func parseRateLimit(scan conf.Scanner, pos scanner.Position) (RateLimit, error) {
+	// the limit is scanned as several tokens, so they are joined back together
+	var lit, burst string
+	dst := &lit
+	for scan.Next() {
+		txt := scan.Text()
+		if scan.Tok() == scanner.String {
+			str, err := conf.ScanString(scan)
+			if err != nil {
+				return RateLimit{}, conf.WrapPos(err, pos)
+			}
+			txt = str
+		}
+		if strings.EqualFold(txt, "burst") && dst == &lit {
+			dst = &burst
+			continue
+		}
+		*dst += txt
+	}
+	if err := scan.Err(); err != nil {
+		return RateLimit{}, conf.WrapPos(err, pos)
+	}
+	if lit == "" {
+		return RateLimit{}, conf.WrapPos(errors.New("missing rate limit argument"), pos)
+	}
+	slash := strings.IndexByte(lit, '/')
+	if slash < 0 {
+		return RateLimit{}, conf.WrapPos(fmt.Errorf("rate limit %q is not in the form <limit>/<period>", lit), pos)
+	}
+	limit, err := strconv.ParseFloat(lit[:slash], 64)
+	if err != nil || !(limit > 0) || math.IsInf(limit, 0) {
+		return RateLimit{}, conf.WrapPos(fmt.Errorf("invalid rate limit %q", lit[:slash]), pos)
+	}
+	period := lit[slash+1:]
+	if period != "" && (period[0] < '0' || period[0] > '9') {
+		period = "1" + period
+	}
+	per, err := time.ParseDuration(period)
+	if err != nil {
+		return RateLimit{}, conf.WrapPos(err, pos)
+	}
+	if per <= 0 {
+		return RateLimit{}, conf.WrapPos(fmt.Errorf("rate limit period %s is not positive", per), pos)
+	}
+	rl := RateLimit{Limit: limit, Per: per, Burst: int(math.Ceil(limit))}
+	if dst == &burst {
+		n, err := strconv.Atoi(burst)
+		if err != nil || n <= 0 {
+			return RateLimit{}, conf.WrapPos(fmt.Errorf("invalid burst %q", burst), pos)
+		}
+		rl.Burst = n
+	}
+	return rl, nil
+}
+
+// Auth is the authentication required by an operation.
+type Auth struct {
+	// Scheme is the authentication scheme.
+	// The "bearer" scheme sends a token in the Authorization header, and the "apikey" scheme sends a key in Header.
+	// The "none" scheme disables the authentication of the system for an operation.
+	Scheme string
+
+	// Header is the name of the HTTP header carrying the credentials.
+	Header string
+
+	// Pos is the position of the auth directive.
+	Pos scanner.Position
+}
+
+// defaultAPIKeyHeader is the header carrying API keys if the auth directive does not name one.
+const defaultAPIKeyHeader = "X-Api-Key"
+
+// parseAuth parses the arguments of an auth directive, which are a scheme followed by an optional header name for API keys.
+// All of the tokens of the directive are consumed.
+func parseAuth(scan conf.Scanner, pos scanner.Position) (Auth, error) {
+	var args []string
+	for scan.Next() {
+		arg, err := conf.ScanString(scan)
+		if err != nil {
+			return Auth{}, conf.WrapPos(err, scan.Pos())
+		}
+		args = append(args, arg)
+	}
+	if err := scan.Err(); err != nil {
+		return Auth{}, conf.WrapPos(err, pos)
+	}
+	if len(args) == 0 {
+		return Auth{}, conf.WrapPos(errors.New("missing auth scheme"), pos)
+	}
+	auth := Auth{Scheme: strings.ToLower(args[0]), Pos: pos}
+	switch auth.Scheme {
+	case "bearer", "none":
+		if len(args) > 1 {
+			return Auth{}, conf.WrapPos(fmt.Errorf("auth %s does not take a header name", auth.Scheme), pos)
+		}
+		if auth.Scheme == "bearer" {
+			auth.Header = "Authorization"
+		}
+	case "apikey":
+		auth.Header = defaultAPIKeyHeader
+		switch len(args) {
+		case 1:
+		case 2:
+			if !validHeaderName(args[1]) {
+				return Auth{}, conf.WrapPos(fmt.Errorf("invalid header name %q (header names containing dashes must be quoted)", args[1]), pos)
+			}
+			auth.Header = http.CanonicalHeaderKey(args[1])
+		default:
+			return Auth{}, conf.WrapPos(errors.New("too many arguments to auth apikey"), pos)
+		}
+	default:
+		return Auth{}, conf.WrapPos(fmt.Errorf("unsupported auth scheme %q (expected bearer, apikey, or none)", args[0]), pos)
+	}
+	return auth, nil
+}
+
+// validHeaderName checks whether a string is a reasonable HTTP header name.
+func validHeaderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
 // Op is an HTTP handler RPC endpoint.
 type Op struct {
 	// Name is the name of the opetation.
@@ -720,9 +1175,14 @@ type Op struct {
 	Method string
 
 	// ArgEncoding is an argument encoding system to use.
-	// May be "query" or "json".
+	// May be "query", "json", "multipart", "cbor", or "msgpack".
+	// The "query" encoding sends arrays of simple values as repeated parameters, and struct fields and the elements of other arrays in bracket notation (e.g. "filter[tags]=1&filter[tags]=2&items[0][name]=3").
+	// The "cbor" and "msgpack" encodings send the inputs and outputs in a binary encoding from the codec package.
+	// The server selects the encoding from the Content-Type and Accept headers, so JSON clients are still supported.
+	// Streamed outputs are unaffected.
 	// Defaults to "json" when the method is http.MethodPost.
 	// Defaults to "query" when the method is http.MethodGet.
+	// Defaults to "multipart" when a byte stream is uploaded alongside other inputs.
 	ArgEncoding string
 
 	// Path is the URL path of the endpoint.
@@ -737,6 +1197,52 @@ type Op struct {
 
 	// Errors is the set of possible errors which may occur during the operation.
 	Errors []string
+
+	// SSE is whether the output stream may be sent as server-sent events (text/event-stream).
+	// The server only uses server-sent events if the client accepts them, and otherwise sends a JSON array.
+	// Unlike a JSON array, server-sent events can carry an error which occurs after the stream has started.
+	// This may only be used by operations which stream JSON outputs without streaming inputs.
+	SSE bool
+
+	// NDJSON is whether the output stream may be sent as newline-delimited JSON (application/x-ndjson).
+	// Each line is a frame carrying an element of the stream, and the final line either ends the stream or carries an error.
+	// The server only uses newline-delimited JSON if the client accepts it, and it is preferred over server-sent events.
+	// This may only be used by operations which stream JSON outputs without streaming inputs.
+	NDJSON bool
+
+	// Subscription is whether the operation is a subscription to a stream of events.
+	// Subscriptions are called with a GET request carrying the inputs in the query, which upgrades to a WebSocket delivering each event as a frame.
+	// The operation must have a single output, which is a stream of JSON events, and may not stream inputs.
+	Subscription bool
+
+	// Timeout is the maximum duration of a call to the operation, or 0 if there is no limit.
+	// The client and the server both apply the timeout to the context of the call.
+	// A call which exceeds the timeout fails with a TimeoutError.
+	Timeout time.Duration
+
+	// Paginated is whether the operation returns a list of items in pages.
+	// The "Cursor" and "Limit" inputs and the "NextCursor" output are added to a paginated operation, which must have a single array output.
+	// Generated clients can iterate over the items of every page.
+	Paginated bool
+
+	// RateLimit is the rate at which each client may call the operation.
+	// This is set by the "ratelimit" directive, and the operation is not rate limited if Burst is 0.
+	RateLimit RateLimit
+
+	// Auth is the authentication required by the operation.
+	// This is set by the "auth" directive, and defaults to the authentication of the system.
+	// After parsing, the scheme is either empty or one which requires credentials.
+	Auth Auth
+
+	// Negotiate is whether the server selects the encoding of the arguments and results from the Content-Type and Accept headers of each request.
+	// This is copied from the system, and applies to operations sending JSON arguments or results which are not streamed.
+	Negotiate bool
+
+	// errPos is the position of each reference in Errors.
+	errPos []scanner.Position
+
+	// Pos is the position of the definition in the spec.
+	Pos scanner.Position
 }
 
 func (op *Op) directive(dir string, pos scanner.Position, scan conf.Scanner) error {
@@ -800,7 +1306,8 @@ func (op *Op) directive(dir string, pos scanner.Position, scan conf.Scanner) err
 			return conf.WrapPos(err, pos)
 		}
 		switch enc {
-		case "query", "json":
+		case "query", "json", "multipart":
+		case "cbor", "msgpack":
 		default:
 			return conf.WrapPos(fmt.Errorf("invalid argument encoding %q", enc), scan.Pos())
 		}
@@ -846,6 +1353,8 @@ func (op *Op) directive(dir string, pos scanner.Position, scan conf.Scanner) err
 			return conf.WrapPos(errors.New("path contains URL host; expected relative URL"), scan.Pos())
 		case u.RawQuery != "":
 			return conf.WrapPos(errors.New("path contains URL query; query not allowed"), scan.Pos())
+		case u.Path == "_health" || u.Path == "_ready":
+			return conf.WrapPos(fmt.Errorf("path %q is reserved for the health and readiness endpoints", u.Path), scan.Pos())
 		}
 		if op.Path != "" {
 			return errors.New("duplicate path directive")
@@ -853,41 +1362,115 @@ func (op *Op) directive(dir string, pos scanner.Position, scan conf.Scanner) err
 		op.Path = u.String()
 	case "input", "in":
 		var a Arg
-		err := a.parse(scan, pos, false, parseTypeInline)
+		err := a.parse(scan, pos, parseTypeInline)
 		if err != nil {
 			return conf.WrapPos(err, pos)
 		}
 		op.Inputs = append(op.Inputs, a)
 	case "output", "out":
 		var a Arg
-		err := a.parse(scan, pos, false, parseTypeInline)
+		err := a.parse(scan, pos, parseTypeInline)
 		if err != nil {
 			return conf.WrapPos(err, pos)
 		}
 		op.Outputs = append(op.Outputs, a)
 	case "error", "err", "errors":
 		var hasArg bool
-		for scan.Next() {
-			errname, err := conf.ScanString(scan)
+		err := conf.ScanList(scan, func(item conf.Scanner) error {
+			errname, err := conf.ScanString(item)
 			if err != nil {
 				return err
 			}
 
 			for _, v := range op.Errors {
 				if errname == v {
-					return conf.WrapPos(fmt.Errorf("duplicate of error specification of %s", errname), scan.Pos())
+					return conf.WrapPos(fmt.Errorf("duplicate of error specification of %s", errname), item.Pos())
 				}
 			}
 			op.Errors = append(op.Errors, errname)
+			op.errPos = append(op.errPos, item.Pos())
 			hasArg = true
-		}
-		if err := scan.Err(); err != nil {
+			return nil
+		})
+		if err != nil {
 			return conf.WrapPos(err, pos)
 		}
 		if !hasArg {
 			return conf.WrapPos(errors.New("missing error argument(s)"), pos)
 		}
 		return nil
+	case "sse":
+		if op.SSE {
+			return conf.WrapPos(errors.New("duplicate sse directive"), pos)
+		}
+		op.SSE = true
+	case "ndjson":
+		if op.NDJSON {
+			return conf.WrapPos(errors.New("duplicate ndjson directive"), pos)
+		}
+		op.NDJSON = true
+	case "subscription":
+		if op.Subscription {
+			return conf.WrapPos(errors.New("duplicate subscription directive"), pos)
+		}
+		op.Subscription = true
+	case "paginated":
+		if op.Paginated {
+			return conf.WrapPos(errors.New("duplicate paginated directive"), pos)
+		}
+		op.Paginated = true
+	case "timeout":
+		// a duration such as 5s is scanned as multiple tokens, so they are joined back together
+		var lit string
+		for scan.Next() {
+			txt := scan.Text()
+			if scan.Tok() == scanner.String {
+				str, err := conf.ScanString(scan)
+				if err != nil {
+					return conf.WrapPos(err, pos)
+				}
+				txt = str
+			}
+			lit += txt
+		}
+		if err := scan.Err(); err != nil {
+			return conf.WrapPos(err, pos)
+		}
+		if lit == "" {
+			return conf.WrapPos(errors.New("missing timeout argument"), pos)
+		}
+		if op.Timeout != 0 {
+			return conf.WrapPos(errors.New("duplicate timeout directive"), pos)
+		}
+		d, err := time.ParseDuration(lit)
+		if err != nil {
+			return conf.WrapPos(err, pos)
+		}
+		if d <= 0 {
+			return conf.WrapPos(fmt.Errorf("timeout %s is not positive", d), pos)
+		}
+		op.Timeout = d
+		return nil
+	case "ratelimit":
+		if op.RateLimit.Burst != 0 {
+			return conf.WrapPos(errors.New("duplicate ratelimit directive"), pos)
+		}
+		rl, err := parseRateLimit(scan, pos)
+		if err != nil {
+			return err
+		}
+		op.RateLimit = rl
+		return nil
+	case "auth":
+		if op.Auth.Scheme != "" {
+			return conf.WrapPos(errors.New("duplicate auth directive"), pos)
+		}
+		auth, err := parseAuth(scan, pos)
+		if err != nil {
+			return err
+		}
+		op.Auth = auth
+		return nil
 	default:
 		return conf.WrapPos(ErrInvalidDirective{dir}, pos)
 	}
@@ -903,6 +1486,7 @@ func (op *Op) directive(dir string, pos scanner.Position, scan conf.Scanner) err
 }
 
 func (op *Op) parse(scan conf.Scanner, pos scanner.Position) error {
+	op.Pos = pos
 	if !scan.Next() {
 		if err := scan.Err(); err != nil {
 			return conf.WrapPos(err, pos)
@@ -946,6 +1530,12 @@ func (op *Op) parse(scan conf.Scanner, pos scanner.Position) error {
 		return conf.WrapPos(bscan.Err(), bpos)
 	}
 
+	if op.Paginated {
+		if err := op.paginate(); err != nil {
+			return conf.WrapPos(err, pos)
+		}
+	}
+
 	err := op.prep()
 	if err != nil {
 		return conf.WrapPos(err, pos)
@@ -954,12 +1544,75 @@ func (op *Op) parse(scan conf.Scanner, pos scanner.Position) error {
 	return nil
 }
 
+// paginate adds the pagination arguments to a paginated operation.
+func (op *Op) paginate() error {
+	if len(op.Outputs) != 1 {
+		return fmt.Errorf("paginated op %q must have a single output containing the items of a page", op.Name)
+	}
+	if _, ok := op.Outputs[0].Type.(ArrayType); !ok || op.Outputs[0].mapped != nil {
+		return fmt.Errorf("output %q of paginated op %q must be an array", op.Outputs[0].Name, op.Name)
+	}
+	if op.Outputs[0].Name == "NextCursor" {
+		return fmt.Errorf("output name NextCursor is reserved in paginated op %q", op.Name)
+	}
+	for _, a := range op.Inputs {
+		if a.Name == "Cursor" || a.Name == "Limit" {
+			return fmt.Errorf("input name %s is reserved in paginated op %q", a.Name, op.Name)
+		}
+		if _, ok := a.Type.(StreamType); ok {
+			return fmt.Errorf("paginated op %q cannot stream inputs", op.Name)
+		}
+	}
+	op.Inputs = append(op.Inputs,
+		Arg{
+			Name:        "Cursor",
+			Type:        StringType,
+			Description: "Cursor is the position at which the page starts, as returned in NextCursor.\nThe first page is requested with an empty cursor.",
+			Pos:         op.Pos,
+		},
+		Arg{
+			Name:        "Limit",
+			Type:        Uint32Type,
+			Description: "Limit is the maximum number of items in the page.\nIf zero, the server chooses the limit.",
+			Pos:         op.Pos,
+		},
+	)
+	op.Outputs = append(op.Outputs, Arg{
+		Name:        "NextCursor",
+		Type:        StringType,
+		Description: "NextCursor is the cursor of the next page, or empty if this is the last page.",
+		Pos:         op.Pos,
+	})
+	return nil
+}
+
 func (op *Op) prep() error {
 	if op.Name == "" {
 		return errors.New("op missing name")
 	}
-	if op.Description == "" {
-		return fmt.Errorf("op %q missing description", op.Name)
+	if op.duplex() {
+		// Full-duplex streams are run over a WebSocket, or over a POST request when the connection uses HTTP/2.
+		switch op.Method {
+		case "":
+			op.Method = http.MethodGet
+		case http.MethodGet:
+		default:
+			return fmt.Errorf("op %q streams in both directions and must use the GET method for the WebSocket handshake", op.Name)
+		}
+	}
+	if op.Subscription {
+		// Subscriptions are run over a WebSocket, so the inputs are sent in the query of the handshake.
+		switch op.Method {
+		case "", http.MethodGet:
+			op.Method = http.MethodGet
+		default:
+			return fmt.Errorf("op %q is a subscription and must use the GET method for the WebSocket handshake", op.Name)
+		}
+		switch op.ArgEncoding {
+		case "", "query":
+		default:
+			return fmt.Errorf("op %q is a subscription and must send its inputs in the query", op.Name)
+		}
 	}
 	if op.Method == "" {
 		if len(op.Inputs) == 0 && len(op.Outputs) == 0 {
@@ -968,6 +1621,28 @@ func (op *Op) prep() error {
 			op.Method = http.MethodPost
 		}
 	}
+	if op.multipart() {
+		// The byte stream is uploaded as a file, with the remaining inputs in a JSON part.
+		switch op.ArgEncoding {
+		case "", "multipart":
+			op.ArgEncoding = "multipart"
+		default:
+			return fmt.Errorf("op %q uploads a byte stream alongside other inputs, which requires multipart encoding", op.Name)
+		}
+		if op.Method == http.MethodGet || op.Method == http.MethodHead {
+			return fmt.Errorf("op %q uploads a byte stream and cannot use the %s method", op.Name, op.Method)
+		}
+	} else if op.ArgEncoding == "multipart" {
+		return fmt.Errorf("op %q does not upload a byte stream alongside other inputs, so multipart encoding cannot be used", op.Name)
+	}
+	if _, ok := binaryEncodings[op.ArgEncoding]; ok {
+		switch {
+		case op.Method == http.MethodGet || op.Method == http.MethodHead:
+			return fmt.Errorf("op %q uses the %s method, which cannot carry %s arguments", op.Name, op.Method, op.ArgEncoding)
+		case op.inStream():
+			return fmt.Errorf("op %q streams inputs, which cannot use %s encoding", op.Name, op.ArgEncoding)
+		}
+	}
 	if op.ArgEncoding == "" {
 		switch op.Method {
 		case http.MethodPost:
@@ -996,6 +1671,9 @@ func (op *Op) prep() error {
 		default:
 			return errors.New("don't cross the streams")
 		}
+		if streamcnt == 1 && len(op.Inputs) > 1 && !op.multipart() {
+			return fmt.Errorf("op %q has a streamed input alongside other inputs, which is only supported for byte streams", op.Name)
+		}
 	}
 	if op.Outputs == nil {
 		op.Outputs = []Arg{}
@@ -1014,6 +1692,43 @@ func (op *Op) prep() error {
 		default:
 			return errors.New("don't cross the streams")
 		}
+		if streamcnt == 1 && len(op.Outputs) > 1 {
+			return fmt.Errorf("op %q has a streamed output alongside other outputs", op.Name)
+		}
+	}
+	if err := checkWireNames(op.Inputs, "input"); err != nil {
+		return err
+	}
+	if err := checkWireNames(op.Outputs, "output"); err != nil {
+		return err
+	}
+	if op.SSE {
+		switch {
+		case !op.outStream() || op.Outputs[0].Type == ByteStream:
+			return fmt.Errorf("op %q does not stream JSON outputs, so server-sent events cannot be used", op.Name)
+		case op.inStream():
+			return fmt.Errorf("op %q streams inputs, so server-sent events cannot be used", op.Name)
+		}
+	}
+	if op.NDJSON {
+		switch {
+		case !op.outStream() || op.Outputs[0].Type == ByteStream:
+			return fmt.Errorf("op %q does not stream JSON outputs, so newline-delimited JSON cannot be used", op.Name)
+		case op.inStream():
+			return fmt.Errorf("op %q streams inputs, so newline-delimited JSON cannot be used", op.Name)
+		}
+	}
+	if op.Subscription {
+		switch {
+		case !op.outStream() || op.Outputs[0].Type == ByteStream:
+			return fmt.Errorf("subscription op %q must have a single output streaming JSON events", op.Name)
+		case op.inStream():
+			return fmt.Errorf("subscription op %q cannot stream inputs", op.Name)
+		case op.SSE || op.NDJSON:
+			return fmt.Errorf("subscription op %q is delivered over a WebSocket, so server-sent events and newline-delimited JSON cannot be used", op.Name)
+		case op.Paginated:
+			return fmt.Errorf("subscription op %q cannot be paginated", op.Name)
+		}
 	}
 	if op.Errors == nil {
 		op.Errors = []string{}
@@ -1021,6 +1736,88 @@ func (op *Op) prep() error {
 	return nil
 }
 
+// inStream checks whether the operation has an input stream.
+func (op Op) inStream() bool {
+	for _, v := range op.Inputs {
+		if _, ok := v.Type.(StreamType); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// outStream checks whether the operation has an output stream.
+func (op Op) outStream() bool {
+	for _, v := range op.Outputs {
+		if _, ok := v.Type.(StreamType); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// multipart checks whether the operation uploads a byte stream alongside other inputs.
+// These operations are sent as multipart/form-data.
+func (op Op) multipart() bool {
+	if len(op.Inputs) < 2 || op.outStream() {
+		return false
+	}
+	for _, v := range op.Inputs {
+		if v.Type == ByteStream {
+			return true
+		}
+	}
+	return false
+}
+
+// binaryEncoding is an argument encoding implemented by the codec package.
+type binaryEncoding struct {
+	// GoCodec is the Go expression for the codec.
+	GoCodec string
+
+	// ContentType is the MIME type of the encoding.
+	ContentType string
+}
+
+// binaryEncodings are the binary argument encodings, by name.
+var binaryEncodings = map[string]binaryEncoding{
+	"cbor":    {"codec.CBOR", "application/cbor"},
+	"msgpack": {"codec.MessagePack", "application/msgpack"},
+}
+
+// binary gets the binary encoding used by the operation.
+// If the operation does not use a binary encoding, the second return is false.
+func (op Op) binary() (binaryEncoding, bool) {
+	enc, ok := binaryEncodings[op.ArgEncoding]
+	return enc, ok
+}
+
+// codecArgs checks whether the server selects the encoding of the arguments from the Content-Type of the request.
+func (op Op) codecArgs() bool {
+	if _, ok := op.binary(); ok {
+		return true
+	}
+	return op.Negotiate && op.ArgEncoding == "json" && !op.inStream()
+}
+
+// codecOutputs checks whether the server selects the encoding of the outputs from the Accept header of the request.
+func (op Op) codecOutputs() bool {
+	_, ok := op.binary()
+	return (ok || op.Negotiate) && !op.outStream()
+}
+
+// replayable checks whether the response to the operation can be recorded and replayed for a retried call with the same idempotency key.
+// This excludes operations which stream, and operations using the GET and HEAD methods, which are idempotent already.
+func (op Op) replayable() bool {
+	return op.Method != http.MethodGet && op.Method != http.MethodHead && !op.inStream() && !op.outStream()
+}
+
+// duplex checks whether the operation streams in both directions.
+// These operations are transported over an HTTP/2 request and response, or over a WebSocket.
+func (op Op) duplex() bool {
+	return op.inStream() && op.outStream()
+}
+
 // System is a specification of a system exposed over HTTP.
 type System struct {
 	// Name is the name of the system.
@@ -1041,6 +1838,49 @@ type System struct {
 
 	// Error type definitions.
 	Errors []Error
+
+	// GzipThreshold is the minimum size in bytes of a request or response body which is compressed with gzip.
+	// Gzip support is only generated if this is set, and it applies to every system in the spec.
+	// Streamed bodies are not compressed, so that they are not delayed by the compressor.
+	GzipThreshold int
+
+	// Metrics is whether the generated code reports calls to a metrics.Collector.
+	// This is set by the "metrics" directive, and applies to every system in the spec.
+	Metrics bool
+
+	// Idempotency is whether the generated code supports idempotency keys.
+	// Clients send a key with each call to a replayable operation, and servers can store responses to replay them for retried calls.
+	// This is set by the "idempotency" directive, and applies to every system in the spec.
+	Idempotency bool
+
+	// Negotiate is whether every operation negotiates the encoding of its arguments and results, as if it used a binary encoding.
+	// Clients may then send and receive JSON, CBOR, or MessagePack, so that a service can migrate between encodings without new endpoints.
+	// This is set by the "negotiate" directive, and applies to every system in the spec.
+	Negotiate bool
+
+	// Tracing is whether the generated code creates spans and propagates trace contexts with the tracing package.
+	// This is set by the -trace flag of the generator rather than by the spec, and applies to every system.
+	Tracing bool
+
+	// Auth is the default authentication required by the operations of the system.
+	// This is set by the "auth" directive.
+	// If it is set at the top level of a spec with system blocks, it applies to every system which does not set its own.
+	Auth Auth
+
+	// Systems are the systems defined by the spec, which share the types and errors.
+	// A spec may either define a single system at the top level, or define several in system blocks.
+	// After parsing, this always contains at least one system.
+	Systems []System
+
+	// Pos is the position of the start of the spec, or of the system block.
+	Pos scanner.Position
+
+	// included is the set of specs which have been included, by absolute path.
+	// Specs which are currently being parsed are mapped to false.
+	included map[string]bool
+
+	// includeStack is the chain of specs currently being parsed.
+	includeStack []string
 }
 
 func (s *System) typeByName(name string) Type {
@@ -1106,6 +1946,55 @@ func (s *System) directive(dir string, pos scanner.Position, scan conf.Scanner)
 			return conf.WrapPos(err, pos)
 		}
 		s.Types = append(s.Types, td)
+	case "gzip":
+		if !scan.Next() {
+			if err := scan.Err(); err != nil {
+				return conf.WrapPos(err, pos)
+			}
+			return conf.WrapPos(errors.New("missing gzip threshold argument"), pos)
+		}
+		if scan.Tok() != scanner.Int {
+			return conf.Unexpected(scan)
+		}
+		n, err := strconv.Atoi(scan.Text())
+		if err != nil {
+			return conf.WrapPos(err, scan.Pos())
+		}
+		if n <= 0 {
+			return conf.WrapPos(errors.New("gzip threshold must be positive"), scan.Pos())
+		}
+		if s.GzipThreshold != 0 {
+			return conf.WrapPos(errors.New("duplicate gzip directive"), pos)
+		}
+		s.GzipThreshold = n
+	case "metrics":
+		if s.Metrics {
+			return conf.WrapPos(errors.New("duplicate metrics directive"), pos)
+		}
+		s.Metrics = true
+	case "idempotency":
+		if s.Idempotency {
+			return conf.WrapPos(errors.New("duplicate idempotency directive"), pos)
+		}
+		s.Idempotency = true
+	case "negotiate":
+		if s.Negotiate {
+			return conf.WrapPos(errors.New("duplicate negotiate directive"), pos)
+		}
+		s.Negotiate = true
+	case "auth":
+		if s.Auth.Scheme != "" {
+			return conf.WrapPos(errors.New("duplicate auth directive"), pos)
+		}
+		auth, err := parseAuth(scan, pos)
+		if err != nil {
+			return err
+		}
+		if auth.Scheme == "none" {
+			return conf.WrapPos(errors.New("auth none may only be used on operations"), pos)
+		}
+		s.Auth = auth
+		return nil
 	case "operation", "op":
 		var op Op
 		err := op.parse(scan, pos)
@@ -1120,6 +2009,30 @@ func (s *System) directive(dir string, pos scanner.Position, scan conf.Scanner)
 			return conf.WrapPos(err, pos)
 		}
 		s.Errors = append(s.Errors, e)
+	case "system":
+		sub, err := parseSubsystem(scan, pos)
+		if err != nil {
+			return err
+		}
+		s.Systems = append(s.Systems, sub)
+	case "include", "import":
+		if !scan.Next() {
+			if err := scan.Err(); err != nil {
+				return conf.WrapPos(err, pos)
+			}
+			return conf.WrapPos(errors.New("missing include path"), pos)
+		}
+		if scan.Tok() != scanner.String {
+			return conf.WrapPos(errors.New("include paths must be quoted"), scan.Pos())
+		}
+		path, err := conf.ScanString(scan)
+		if err != nil {
+			return conf.WrapPos(err, pos)
+		}
+		err = s.include(path, pos)
+		if err != nil {
+			return err
+		}
 	default:
 		return conf.WrapPos(ErrInvalidDirective{dir}, pos)
 	}
@@ -1134,48 +2047,189 @@ func (s *System) directive(dir string, pos scanner.Position, scan conf.Scanner)
 	return nil
 }
 
-func (s *System) parse(scan conf.Scanner) error {
+// parseSubsystem parses a system block.
+func parseSubsystem(scan conf.Scanner, pos scanner.Position) (System, error) {
+	if !scan.Next() {
+		if err := scan.Err(); err != nil {
+			return System{}, conf.WrapPos(err, pos)
+		}
+		return System{}, conf.WrapPos(errors.New("missing system definition"), pos)
+	}
+	sub := System{Pos: pos}
+	switch scan.Tok() {
+	case scanner.RawString, scanner.String:
+		name, err := conf.ScanString(scan)
+		if err != nil {
+			return System{}, conf.WrapPos(err, pos)
+		}
+		sub.Name = name
+		if !scan.Next() {
+			if err := scan.Err(); err != nil {
+				return System{}, conf.WrapPos(err, pos)
+			}
+			return System{}, conf.WrapPos(errors.New("missing system definition"), pos)
+		}
+		if scan.Tok() != '{' {
+			return System{}, conf.Unexpected(scan)
+		}
+	case '{':
+	default:
+		return System{}, conf.Unexpected(scan)
+	}
+	bpos := scan.Pos()
+	err := sub.parseDirectives(conf.ScanBracket(scan, '{', '}'), "a system block", func(dir string) bool {
+		switch dir {
+		case "name", "description", "desc", "operation", "op", "auth":
+			return true
+		default:
+			return false
+		}
+	})
+	if err != nil {
+		return System{}, conf.WrapPos(err, bpos)
+	}
+	return sub, nil
+}
+
+// parseDirectives parses a sequence of directives into the system.
+// Directives which are not allowed are rejected, and where describes the context for the error.
+func (s *System) parseDirectives(scan conf.Scanner, where string, allowed func(dir string) bool) error {
 	for scan.Next() {
 		dir, err := conf.ScanString(scan)
 		if err != nil {
 			return err
 		}
 		dir = strings.ToLower(dir)
+		if !allowed(dir) {
+			return conf.WrapPos(fmt.Errorf("directive %q is not allowed in %s", dir, where), scan.Pos())
+		}
 		err = s.directive(dir, scan.Pos(), conf.ScanSemicolon(scan, openers, closers))
 		if err != nil {
 			return err
 		}
 	}
-	if err := scan.Err(); err != nil {
-		return err
+	return scan.Err()
+}
+
+// include parses the type and error definitions from another spec into the system.
+// The path is relative to the directory of the spec containing the include directive.
+// A spec which has already been included is skipped.
+func (s *System) include(path string, pos scanner.Position) error {
+	if !filepath.IsAbs(path) && pos.Filename != "" {
+		path = filepath.Join(filepath.Dir(pos.Filename), path)
 	}
-	err := s.prep()
+	abs, err := filepath.Abs(path)
 	if err != nil {
-		return err
+		return conf.WrapPos(err, pos)
+	}
+	if s.included == nil {
+		s.included = map[string]bool{}
 	}
+	done, seen := s.included[abs]
+	switch {
+	case done:
+		return nil
+	case seen:
+		cycle := append(append([]string{}, s.includeStack...), abs)
+		for i, p := range cycle {
+			if p == abs {
+				cycle = cycle[i:]
+				break
+			}
+		}
+		return conf.WrapPos(fmt.Errorf("include cycle: %s", strings.Join(cycle, " -> ")), pos)
+	}
+	s.included[abs] = false
+	s.includeStack = append(s.includeStack, abs)
+	defer func() { s.includeStack = s.includeStack[:len(s.includeStack)-1] }()
+
+	f, err := os.Open(path)
+	if err != nil {
+		return conf.WrapPos(err, pos)
+	}
+	defer f.Close()
+
+	err = s.parseDirectives(scanSpec(f), "an included spec", func(dir string) bool {
+		switch dir {
+		case "type", "error", "err", "include", "import":
+			return true
+		default:
+			return false
+		}
+	})
+	if err != nil {
+		return conf.WrapPos(fmt.Errorf("in included spec %q: %w", path, err), pos)
+	}
+	s.included[abs] = true
 	return nil
 }
 
-func (s *System) prep() error {
-	if s.Name == "" {
-		return errors.New("system is missing a name")
+func (s *System) parse(scan conf.Scanner) error {
+	if s.Pos.Filename != "" {
+		if abs, err := filepath.Abs(s.Pos.Filename); err == nil {
+			s.included = map[string]bool{abs: false}
+			s.includeStack = []string{abs}
+		}
 	}
-	if s.GoPackage == "" {
-		s.GoPackage = strings.ToLower(s.Name)
+	err := s.parseDirectives(scan, "a spec", func(string) bool { return true })
+	if err != nil {
+		return err
 	}
-	if s.Description == "" {
-		return errors.New("system is missing a description")
+	err = s.prep()
+	if err != nil {
+		return err
 	}
-	if len(s.Operations) == 0 {
-		return errors.New("system has no operations")
+	return nil
+}
+
+func (s *System) prep() error {
+	if len(s.Systems) == 0 {
+		// the spec defines a single system at the top level
+		if err := s.prepOps(); err != nil {
+			return err
+		}
+		if s.GoPackage == "" {
+			s.GoPackage = strings.ToLower(s.Name)
+		}
+	} else {
+		if len(s.Operations) != 0 {
+			return conf.WrapPos(errors.New("operations must be defined within a system block when the spec contains system blocks"), s.Operations[0].Pos)
+		}
+		names := map[string]struct{}{}
+		for i := range s.Systems {
+			sub := &s.Systems[i]
+			if _, ok := names[sub.Name]; ok {
+				return conf.WrapPos(fmt.Errorf("duplicate system %q", sub.Name), sub.Pos)
+			}
+			names[sub.Name] = struct{}{}
+			if err := sub.prepOps(); err != nil {
+				return conf.WrapPos(err, sub.Pos)
+			}
+		}
+		if s.GoPackage == "" {
+			if s.Name != "" {
+				s.GoPackage = strings.ToLower(s.Name)
+			} else {
+				s.GoPackage = strings.ToLower(s.Systems[0].Name)
+			}
+		}
 	}
 	if s.Types == nil {
 		s.Types = []TypeDef{}
 	}
-	for i := range s.Operations {
-		if err := s.Operations[i].prep(); err != nil {
-			return err
+	types := map[string]TypeDef{}
+	for _, td := range s.Types {
+		if prev, ok := types[td.Name]; ok {
+			return conf.WrapPos(fmt.Errorf("duplicate definition of type %q (previously defined at %s)", td.Name, prev.Pos), td.Pos)
+		}
+		types[td.Name] = td
+	}
+	errdefs := map[string]Error{}
+	for _, e := range s.Errors {
+		if prev, ok := errdefs[e.Name]; ok {
+			return conf.WrapPos(fmt.Errorf("duplicate definition of error %q (previously defined at %s)", e.Name, prev.Pos), e.Pos)
 		}
+		errdefs[e.Name] = e
 	}
 	if s.Errors == nil {
 		s.Errors = []Error{}
@@ -1186,6 +2240,266 @@ func (s *System) prep() error {
 			}
 		}
 	}
+	if err := s.checkErrCodes(); err != nil {
+		return err
+	}
+	if len(s.Systems) == 0 {
+		s.Systems = []System{*s}
+	}
+	for i := range s.Systems {
+		s.Systems[i].GoPackage = s.GoPackage
+		s.Systems[i].Types = s.Types
+		s.Systems[i].Errors = s.Errors
+		s.Systems[i].GzipThreshold = s.GzipThreshold
+		s.Systems[i].Metrics = s.Metrics
+		s.Systems[i].Idempotency = s.Idempotency
+		s.Systems[i].Negotiate = s.Negotiate
+		for j := range s.Systems[i].Operations {
+			s.Systems[i].Operations[j].Negotiate = s.Negotiate
+		}
+		s.Systems[i].resolveAuth(s.Auth)
+	}
+	if err := s.prepValidation(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// checkErrCodes checks that the error codes are unique, and are either all strings or all integers.
+func (s *System) checkErrCodes() error {
+	codes := map[string]Error{}
+	var first Error
+	for _, e := range s.Errors {
+		if e.ErrCode == "" {
+			continue
+		}
+		if prev, ok := codes[e.ErrCode]; ok {
+			return conf.WrapPos(fmt.Errorf("error code %s of %q is already used by %q", e.ErrCode, e.Name, prev.Name), e.Pos)
+		}
+		codes[e.ErrCode] = e
+		if first.ErrCode == "" {
+			first = e
+		} else if isStringCode(e.ErrCode) != isStringCode(first.ErrCode) {
+			return conf.WrapPos(fmt.Errorf("error code of %q does not have the same type as the code of %q", e.Name, first.Name), e.Pos)
+		}
+	}
+	return nil
+}
+
+// errCodeIsInt checks whether the error codes of the spec are integers.
+// If no error declares a code, they are strings.
+func (s *System) errCodeIsInt() bool {
+	for _, e := range s.Errors {
+		if e.ErrCode != "" {
+			return !isStringCode(e.ErrCode)
+		}
+	}
+	return false
+}
+
+// isStringCode checks whether an error code literal is a string.
+func isStringCode(code string) bool {
+	return strings.HasPrefix(code, `"`)
+}
+
+// hasCodec checks whether any operation in the spec or system uses the codec package.
+func hasCodec(s System) bool {
+	if s.Negotiate {
+		return true
+	}
+	ops := s.Operations
+	if len(s.Systems) != 0 {
+		ops = s.operations()
+	}
+	for _, op := range ops {
+		if _, ok := op.binary(); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// hasDuplex checks whether any operation in the spec or system is full-duplex.
+func hasDuplex(s System) bool {
+	ops := s.Operations
+	if len(s.Systems) != 0 {
+		ops = s.operations()
+	}
+	for _, op := range ops {
+		if op.duplex() {
+			return true
+		}
+	}
+	return false
+}
+
+// hasNDJSON checks whether any operation in the spec or system may stream newline-delimited JSON.
+func hasNDJSON(s System) bool {
+	ops := s.Operations
+	if len(s.Systems) != 0 {
+		ops = s.operations()
+	}
+	for _, op := range ops {
+		if op.NDJSON {
+			return true
+		}
+	}
+	return false
+}
+
+// hasSubscription checks whether any operation in the spec or system is a subscription.
+func hasSubscription(s System) bool {
+	ops := s.Operations
+	if len(s.Systems) != 0 {
+		ops = s.operations()
+	}
+	for _, op := range ops {
+		if op.Subscription {
+			return true
+		}
+	}
+	return false
+}
+
+// hasWebSocket checks whether any operation in the spec or system may be carried over a WebSocket.
+func hasWebSocket(s System) bool {
+	return hasDuplex(s) || hasSubscription(s)
+}
+
+// resolveAuth applies the default authentication of the system to its operations.
+// The def argument is the default authentication of the spec, which applies if the system does not set its own.
+func (s *System) resolveAuth(def Auth) {
+	if s.Auth.Scheme == "" {
+		s.Auth = def
+	}
+	for i := range s.Operations {
+		op := &s.Operations[i]
+		switch op.Auth.Scheme {
+		case "":
+			op.Auth = s.Auth
+		case "none":
+			op.Auth = Auth{}
+		}
+	}
+}
+
+// hasAuth checks whether any operation in the spec or system requires authentication.
+func hasAuth(s System) bool {
+	ops := s.Operations
+	if len(s.Systems) != 0 {
+		ops = s.operations()
+	}
+	for _, op := range ops {
+		if op.Auth.Scheme != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// hasRateLimit checks whether any operation in the spec or system is rate limited.
+func hasRateLimit(s System) bool {
+	ops := s.Operations
+	if len(s.Systems) != 0 {
+		ops = s.operations()
+	}
+	for _, op := range ops {
+		if op.RateLimit.Burst != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// hasTimeout checks whether any operation in the spec has a timeout.
+func hasTimeout(s System) bool {
+	for _, sub := range s.Systems {
+		for _, op := range sub.Operations {
+			if op.Timeout != 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// goHeaderImports are the packages which are always imported by the generated Go code.
+var goHeaderImports = []string{
+	"bytes", "bufio", "context", "encoding/json", "errors", "fmt", "io", "io/ioutil",
+	"net", "net/http", "mime/multipart", "net/url", "regexp", "strconv", "strings", "sync", "time", "unicode/utf8",
+}
+
+// goTypeImports returns the sorted import paths of the Go types mapped with "gotype" directives.
+// If opsOnly is set, only the types used directly in the signatures of operations are considered.
+// Paths listed in exclude are already imported by the template, and are omitted.
+func (s *System) goTypeImports(opsOnly bool, exclude ...string) []string {
+	set := map[string]struct{}{}
+	var walk func(t Type)
+	walkArgs := func(args []Arg) {
+		for _, a := range args {
+			walk(a.Type)
+		}
+	}
+	walk = func(t Type) {
+		switch t := t.(type) {
+		case GoMappedType:
+			set[t.Import] = struct{}{}
+		case ArrayType:
+			walk(t.Elem)
+		case StructType:
+			walkArgs(t)
+		}
+	}
+	for _, op := range s.operations() {
+		walkArgs(op.Inputs)
+		walkArgs(op.Outputs)
+	}
+	if !opsOnly {
+		for _, td := range s.Types {
+			walk(td.Type)
+		}
+		for _, e := range s.Errors {
+			walkArgs(e.Fields)
+		}
+	}
+	for _, p := range exclude {
+		delete(set, p)
+	}
+	paths := make([]string, 0, len(set))
+	for p := range set {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// operations returns the operations of all systems defined by the spec.
+func (s *System) operations() []Op {
+	var ops []Op
+	for _, sub := range s.Systems {
+		ops = append(ops, sub.Operations...)
+	}
+	return ops
+}
+
+// prepOps checks the name and description of a system, and prepares its operations.
+func (s *System) prepOps() error {
+	if s.Name == "" {
+		return errors.New("system is missing a name")
+	}
+	if len(s.Operations) == 0 {
+		return errors.New("system has no operations")
+	}
+	for i := range s.Operations {
+		if err := s.Operations[i].prep(); err != nil {
+			return err
+		}
+		switch name := s.Operations[i].Name; name {
+		case "MockCalls", "MockCallsTo", "MockReset":
+			// these are the helper methods of the generated mock
+			return conf.WrapPos(fmt.Errorf("op name %s is reserved", name), s.Operations[i].Pos)
+		}
+	}
 	return nil
 }
 
@@ -1203,7 +2517,8 @@ func (err ErrInvalidDirective) Error() string {
 
 var errUnimplemented = errors.New("not yet implemented")
 
-func parseSystem(r io.Reader) (System, error) {
+// scanSpec creates a scanner for a spec.
+func scanSpec(r io.Reader) conf.Scanner {
 	gscan := &scanner.Scanner{
 		Mode: scanner.ScanFloats |
 			scanner.ScanStrings | scanner.ScanRawStrings |
@@ -1212,11 +2527,18 @@ func parseSystem(r io.Reader) (System, error) {
 	if f, ok := r.(*os.File); ok {
 		gscan.Position.Filename = f.Name()
 	}
-	scan := conf.Scan(gscan.Init(r))
-	scan = conf.AutoSemicolon(scan)
+	return conf.AutoSemicolon(conf.Scan(gscan.Init(r)))
+}
 
-	var sys System
-	if err := sys.parse(scan); err != nil {
+func parseSystem(r io.Reader) (System, error) {
+	var filename string
+	if f, ok := r.(*os.File); ok {
+		filename = f.Name()
+	}
+	sys := System{
+		Pos: scanner.Position{Filename: filename, Line: 1, Column: 1},
+	}
+	if err := sys.parse(scanSpec(r)); err != nil {
 		return System{}, err
 	}
 	return sys, nil
@@ -1286,27 +2608,286 @@ var goHTTPStatTbl = map[int]string{
 	http.StatusNetworkAuthenticationRequired: "http.StatusNetworkAuthenticationRequired",
 }
 
+// templateFS contains the built-in templates.
+//
+//go:embed templates/*.tmpl
+var templateFS embed.FS
+
+// builtinTemplates is the set of templates built into the generator, by name.
+var builtinTemplates = map[string]struct {
+	// gofmt indicates that the output is Go source which should be formatted.
+	gofmt bool
+
+	// scaffold indicates that the output is a starting point to be edited by hand.
+	// Existing files are not overwritten.
+	scaffold bool
+
+	// suffix is appended to the lowercased name of the spec to form the default output path.
+	// If empty, there is no default output path, except when generating every spec in the directory.
+	suffix string
+}{
+	"go":             {gofmt: true},
+	"go-server":      {gofmt: true},
+	"go-client":      {gofmt: true},
+	"go-impl":        {gofmt: true, scaffold: true, suffix: "_impl.go"},
+	"go-conformance": {gofmt: true, suffix: "_conformance_test.go"},
+	"openapi":        {gofmt: false},
+	"jsonschema":     {gofmt: false},
+}
+
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "vet" {
+		os.Exit(vetMain(os.Args[2:]))
+	}
+
 	var spec string
 	var tmplpath string
 	var out string
-	flag.StringVar(&spec, "spec", "", "path to spec to use")
-	flag.StringVar(&tmplpath, "tmpl", "", "path to template to use")
-	flag.StringVar(&out, "o", "", "path to output file")
+	var imports bool
+	var tracing bool
+	var watch bool
+	var check bool
+	flag.StringVar(&spec, "spec", "", "path to spec to use (defaults to each *.rpc file in the current directory which is not an included fragment, generating <name>.gen.go)")
+	flag.StringVar(&tmplpath, "tmpl", "go", "built-in template name (go, go-server, go-client, go-impl, go-conformance, openapi, or jsonschema) or path to template to use")
+	flag.StringVar(&out, "o", "", "path to output file (defaults to <name>.gen.go for Go code, or standard output otherwise)")
+	flag.BoolVar(&imports, "goimports", false, "run goimports on generated Go code")
+	flag.BoolVar(&tracing, "trace", false, "generate tracing spans and trace context propagation in Go code")
+	flag.BoolVar(&watch, "watch", false, "keep running, and regenerate whenever the spec or template files change")
+	flag.BoolVar(&check, "check", false, "check that the generated files are up to date without writing them, exiting with status 1 if any are not")
 	flag.Parse()
+	if check && (watch || builtinTemplates[tmplpath].scaffold) {
+		fatal(errors.New("-check cannot be used with -watch or a scaffold template"))
+	}
+
+	var specs func() ([]string, error)
+	switch {
+	case spec != "":
+		specs = func() ([]string, error) { return []string{spec}, nil }
+	case out != "":
+		fatal(errors.New("-o cannot be used without -spec"))
+	default:
+		// Without a spec, every *.rpc spec in the working directory is generated.
+		// This is the directory of the package when run by go generate.
+		if builtin, ok := builtinTemplates[tmplpath]; !ok || !builtin.gofmt {
+			fatal(fmt.Errorf("-spec is required to use the %q template", tmplpath))
+		}
+		specs = func() ([]string, error) {
+			specs, err := filepath.Glob("*.rpc")
+			if err != nil {
+				return nil, err
+			}
+			if len(specs) == 0 {
+				return nil, errors.New("no -spec specified, and no *.rpc specs found in the current directory")
+			}
+			return specs, nil
+		}
+	}
+	run := func() error {
+		paths, err := specs()
+		if err != nil {
+			return err
+		}
+		if spec == "" {
+			// fragments are generated as part of the specs which include them
+			paths, err = mainSpecs(paths)
+			if err != nil {
+				return err
+			}
+		}
+		stale := false
+		for _, p := range paths {
+			out := out
+			if builtin := builtinTemplates[tmplpath]; out == "" && builtin.gofmt && builtin.suffix == "" {
+				out = strings.TrimSuffix(p, ".rpc") + ".gen.go"
+			}
+			err := generate(p, tmplpath, out, imports, tracing, check)
+			switch {
+			case errors.Is(err, errStale):
+				// report every stale file
+				fmt.Fprintf(os.Stderr, "rpc-gen: %s\n", err)
+				stale = true
+			case err != nil:
+				if spec == "" {
+					err = fmt.Errorf("%s: %w", p, err)
+				}
+				return err
+			}
+		}
+		if stale {
+			return errStale
+		}
+		return nil
+	}
 
+	if !watch {
+		err := run()
+		switch {
+		case errors.Is(err, errStale):
+			// the stale files have already been reported
+			os.Exit(1)
+		case err != nil:
+			fatal(err)
+		}
+		return
+	}
+	if builtinTemplates[tmplpath].scaffold {
+		fatal(fmt.Errorf("the %q template cannot be used with -watch", tmplpath))
+	}
+	watched := func() []string {
+		paths, _ := specs()
+		if _, ok := builtinTemplates[tmplpath]; !ok {
+			paths = append(paths, tmplpath)
+		}
+		return paths
+	}
+	for {
+		if err := run(); err != nil {
+			fmt.Fprintf(os.Stderr, "rpc-gen: %s\n", positionedErr(err))
+		} else {
+			fmt.Fprintf(os.Stderr, "rpc-gen: generated at %s\n", time.Now().Format("15:04:05"))
+		}
+		waitForChange(watched, watchInterval)
+	}
+}
+
+// mainSpecs selects the specs which define a system from the specs in a directory.
+// Fragments, which have no system name or are included by another spec, are skipped.
+// A spec which cannot be scanned is kept, so that the error is reported when it is generated.
+func mainSpecs(paths []string) ([]string, error) {
+	named := make(map[string]bool, len(paths))
+	included := map[string]bool{}
+	for _, p := range paths {
+		ok, includes, err := scanOutline(p)
+		if err != nil {
+			ok = true
+		}
+		named[p] = ok
+		for _, inc := range includes {
+			included[inc] = true
+		}
+	}
+	var out []string
+	for _, p := range paths {
+		abs, err := filepath.Abs(p)
+		if err != nil {
+			return nil, err
+		}
+		if named[p] && !included[abs] {
+			out = append(out, p)
+		}
+	}
+	if len(out) == 0 {
+		return nil, errors.New("no *.rpc specs in the current directory define a system")
+	}
+	return out, nil
+}
+
+// scanOutline reads the top-level directives of a spec without parsing them.
+// It reports whether the spec names a system, and the absolute paths of the specs which it includes.
+func scanOutline(path string) (named bool, includes []string, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, nil, err
+	}
+	defer f.Close()
+
+	scan := scanSpec(f)
+	for scan.Next() {
+		dir, err := conf.ScanString(scan)
+		if err != nil {
+			return false, nil, err
+		}
+		args := conf.ScanSemicolon(scan, openers, closers)
+		switch strings.ToLower(dir) {
+		case "name", "system":
+			named = true
+		case "include", "import":
+			if args.Next() && args.Tok() == scanner.String {
+				inc, err := conf.ScanString(args)
+				if err != nil {
+					return false, nil, err
+				}
+				if !filepath.IsAbs(inc) {
+					inc = filepath.Join(filepath.Dir(path), inc)
+				}
+				inc, err = filepath.Abs(inc)
+				if err != nil {
+					return false, nil, err
+				}
+				includes = append(includes, inc)
+			}
+		}
+		for args.Next() {
+		}
+		if err := args.Err(); err != nil {
+			return false, nil, err
+		}
+	}
+	return named, includes, scan.Err()
+}
+
+// positionedErr formats an error for display in watch mode.
+// Errors with a position in the spec are formatted as "file:line:col: msg", which editors and terminals can link to.
+func positionedErr(err error) string {
+	var perr conf.PosErr
+	if errors.As(err, &perr) {
+		return fmt.Sprintf("%s: %s", perr.Pos, perr.Err)
+	}
+	return err.Error()
+}
+
+// watchInterval is the interval at which watched files are polled.
+const watchInterval = 500 * time.Millisecond
+
+// waitForChange polls a set of files until one of them is modified, created, or removed.
+// The set of files is re-evaluated on every poll, so that newly added specs are noticed.
+func waitForChange(paths func() []string, interval time.Duration) {
+	snapshot := func() map[string]time.Time {
+		stamps := make(map[string]time.Time)
+		for _, p := range paths() {
+			var stamp time.Time
+			if info, err := os.Stat(p); err == nil {
+				stamp = info.ModTime()
+			}
+			stamps[p] = stamp
+		}
+		return stamps
+	}
+	prev := snapshot()
+	for {
+		time.Sleep(interval)
+		if cur := snapshot(); !reflect.DeepEqual(cur, prev) {
+			return
+		}
+	}
+}
+
+// generate runs a template on a spec.
+// The tmplpath and out arguments are interpreted in the same way as the corresponding flags.
+// Go code records a hash of its inputs.
+// The output is always regenerated, but an existing file is only rewritten if the code differs, so that an edited file is never mistaken for an up to date one.
+// In check mode, nothing is written, and errStale is returned if the output is not up to date.
+func generate(spec, tmplpath, out string, imports, tracing, check bool) error {
 	sf, err := os.Open(spec)
 	if err != nil {
-		panic(err)
+		return err
 	}
 	defer sf.Close()
 
 	sys, err := parseSystem(sf)
 	if err != nil {
-		panic(err)
+		return err
+	}
+	if err := sys.requireDescriptions(); err != nil {
+		return err
 	}
-	tmpl := template.New("")
-	tmpl, err = tmpl.Funcs(template.FuncMap{
+	if tracing {
+		sys.Tracing = true
+		for i := range sys.Systems {
+			sys.Systems[i].Tracing = true
+		}
+	}
+	tmpl := template.New("").Funcs(template.FuncMap{
 		"lines":    func(str string) []string { return strings.Split(str, "\n") },
 		"httpcode": http.StatusText,
 		"gohttpmethod": func(str string) string {
@@ -1346,6 +2927,8 @@ func main() {
 				switch rt := t.(type) {
 				case ArrayType:
 					return rt.GoType() + "{}"
+				case GoMappedType:
+					return "*new(" + rt.Go + ")"
 				case NamedType:
 					ut := sys.typeByName(string(rt))
 				nameproc:
@@ -1368,67 +2951,188 @@ func main() {
 				}
 			}
 		},
-		"instream": func(op Op) bool {
-			for _, v := range op.Inputs {
-				if _, ok := v.Type.(StreamType); ok {
-					return true
+		"instream":   Op.inStream,
+		"outstream":  Op.outStream,
+		"duplex":     Op.duplex,
+		"replayable": Op.replayable,
+		"multipart":  Op.multipart,
+		"codec": func(op Op) string {
+			enc, _ := op.binary()
+			return enc.GoCodec
+		},
+		"codecargs":       Op.codecArgs,
+		"codecoutputs":    Op.codecOutputs,
+		"hascodec":        hasCodec,
+		"hasduplex":       hasDuplex,
+		"hasndjson":       hasNDJSON,
+		"hassubscription": hasSubscription,
+		"haswebsocket":    hasWebSocket,
+		"hasquery":        hasQuery,
+		"hastimeout":      hasTimeout,
+		"hasauth":         hasAuth,
+		"hasratelimit":    hasRateLimit,
+		"godur": func(d time.Duration) string {
+			for _, u := range []struct {
+				d    time.Duration
+				name string
+			}{
+				{time.Hour, "time.Hour"},
+				{time.Minute, "time.Minute"},
+				{time.Second, "time.Second"},
+				{time.Millisecond, "time.Millisecond"},
+				{time.Microsecond, "time.Microsecond"},
+			} {
+				if d%u.d == 0 {
+					return fmt.Sprintf("%d * %s", d/u.d, u.name)
 				}
 			}
-			return false
+			return fmt.Sprintf("time.Duration(%d)", int64(d))
+		},
+		"gotypeimports": func(s System) []string {
+			exclude := append([]string(nil), goHeaderImports...)
+			if s.GzipThreshold != 0 {
+				exclude = append(exclude, "compress/gzip")
+			}
+			if hasWebSocket(s) || s.Idempotency {
+				exclude = append(exclude, "crypto/rand")
+			}
+			if s.Idempotency {
+				exclude = append(exclude, "crypto/sha256", "encoding/hex")
+			}
+			return s.goTypeImports(false, exclude...)
+		},
+		"errcodeint":      func(s System) bool { return s.errCodeIsInt() },
+		"opgotypeimports": func(s System) []string { return s.goTypeImports(true, "context", "errors", "io") },
+		"conformanceimports": func(s System) []string {
+			return s.goTypeImports(true, "bytes", "context", "encoding/json", "errors", "fmt", "io", "net/http/httptest", "reflect", "sync", "testing")
 		},
-		"outstream": func(op Op) bool {
-			for _, v := range op.Outputs {
-				if _, ok := v.Type.(StreamType); ok {
-					return true
+		"usesio": func(s System) bool {
+			for _, op := range s.operations() {
+				for _, args := range [][]Arg{op.Inputs, op.Outputs} {
+					for _, a := range args {
+						if a.Type == ByteStream {
+							return true
+						}
+					}
 				}
 			}
 			return false
 		},
+		"isstream": func(t Type) bool {
+			_, ok := t.(StreamType)
+			return ok
+		},
 		"bytestream": func() StreamType {
 			return ByteStream
 		},
-		"req": reflect.DeepEqual,
-		"rne": func(x, y interface{}) bool { return !reflect.DeepEqual(x, y) },
-	}).ParseFiles(tmplpath)
+		"validated":     sys.opValidated,
+		"typevalidated": func(td TypeDef) bool { return sys.needsValidation(td.Type) },
+		"govalidate": func(a Arg) string {
+			return sys.goValidate(a, a.Name, strconv.Quote(a.WireName()), 0)
+		},
+		"goqueryencode": func(a Arg) string {
+			return sys.goQueryEncode(a.Type, a.Name, strconv.Quote(a.WireName()), 0, nil)
+		},
+		"goquerydecode": func(a Arg) string {
+			return sys.goQueryDecode(a.Type, "args."+a.Name, strconv.Quote(a.WireName()), 0, nil)
+		},
+		"govalidatetype": func(td TypeDef) string {
+			return sys.goValidate(Arg{Name: td.Name, Type: td.Type}, "v", `""`, 0)
+		},
+		"validationpatterns": sys.validationPatterns,
+		"req":                reflect.DeepEqual,
+		"rne":                func(x, y interface{}) bool { return !reflect.DeepEqual(x, y) },
+		"openapi":            func(s System) jsonObject { return s.openAPI() },
+		"jsonschema":         func(s System) jsonObject { return s.jsonSchema() },
+		"json": func(v interface{}) (string, error) {
+			dat, err := json.MarshalIndent(v, "", "  ")
+			return string(dat), err
+		},
+	})
+	var tmplname, suffix string
+	var format, scaffold bool
+	if builtin, ok := builtinTemplates[tmplpath]; ok {
+		tmpl, err = tmpl.ParseFS(templateFS, "templates/*.tmpl")
+		tmplname, format, scaffold, suffix = tmplpath, builtin.gofmt, builtin.scaffold, builtin.suffix
+	} else {
+		tmpl, err = tmpl.ParseFiles(tmplpath)
+		tmplname, format = filepath.Base(tmplpath), strings.HasSuffix(out, ".go")
+	}
 	if err != nil {
-		panic(err)
+		return err
+	}
+	if suffix != "" && out == "" {
+		name := sys.Name
+		if name == "" {
+			name = sys.GoPackage
+		}
+		out = strings.ToLower(name) + suffix
+	}
+	if out == "" && check {
+		return errors.New("-check requires an output file")
 	}
 
-	of, err := os.Create(out)
-	if err != nil {
-		panic(err)
+	// scaffolds are never regenerated, so they do not need a hash
+	var hash string
+	if format && !scaffold && out != "" {
+		hash, err = inputHash(spec, sys, tmplpath, imports, tracing)
+		if err != nil {
+			return err
+		}
 	}
-	defer of.Close()
 
-	cmd := exec.Command("gofmt", "/dev/stdin")
-	cmd.Stderr = os.Stderr
-	cmd.Stdout = of
-	fmw, err := cmd.StdinPipe()
+	var buf bytes.Buffer
+	err = tmpl.ExecuteTemplate(&buf, tmplname, sys)
 	if err != nil {
-		panic(err)
+		return err
 	}
-	defer fmw.Close()
-	err = cmd.Start()
-	if err != nil {
-		panic(err)
+	src := buf.Bytes()
+	if format {
+		src, err = formatGo(filepath.Base(out), src)
+		if err != nil {
+			return err
+		}
+		if imports {
+			src, err = goimports(src)
+			if err != nil {
+				return err
+			}
+		}
 	}
-	defer cmd.Wait()
-	defer fmw.Close()
 
-	err = tmpl.ExecuteTemplate(fmw, filepath.Base(tmplpath), sys)
-	if err != nil {
-		panic(err)
+	if hash != "" {
+		src = append([]byte(hashPrefix+hash+"\n\n"), src...)
 	}
-	err = fmw.Close()
-	if err != nil {
-		panic(err)
+
+	if out == "" {
+		// without an output file, the output is written to stdout
+		_, err = os.Stdout.Write(src)
+		return err
 	}
-	err = cmd.Wait()
-	if err != nil {
-		panic(err)
+	if !scaffold {
+		switch {
+		case upToDate(out, src):
+			return nil
+		case check:
+			return fmt.Errorf("%s: %w", out, errStale)
+		}
+		return ioutil.WriteFile(out, src, 0644)
 	}
-	err = of.Close()
+
+	// do not overwrite an existing implementation
+	f, err := os.OpenFile(out, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
 	if err != nil {
-		panic(err)
+		return err
 	}
+	_, err = f.Write(src)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// fatal reports an error and exits.
+func fatal(err error) {
+	fmt.Fprintf(os.Stderr, "rpc-gen: %s\n", err)
+	os.Exit(1)
 }
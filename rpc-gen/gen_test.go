@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// writeSpec writes a spec into a temporary directory, and returns the path of the spec.
+func writeSpec(t *testing.T, name, src string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// typeCheck parses and type-checks a generated Go file.
+func typeCheck(t *testing.T, path string) {
+	t.Helper()
+
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, path, nil, 0)
+	if err != nil {
+		t.Fatalf("failed to parse generated code: %v", err)
+	}
+	conf := types.Config{Importer: importer.ForCompiler(fset, "gc", nil)}
+	if _, err := conf.Check(f.Name.Name, fset, []*ast.File{f}, nil); err != nil {
+		t.Fatalf("generated code does not type-check: %v", err)
+	}
+}
+
+// specWithOps creates a minimal spec with operations of the specified names, each taking a single input.
+func specWithOps(names ...string) string {
+	var b strings.Builder
+	b.WriteString("name Test\ndesc \"Test is a test system.\"\n")
+	for _, name := range names {
+		b.WriteString("op " + name + " {\n    desc \"" + name + " does nothing.\"\n")
+		b.WriteString("    in X {\n        type uint32\n        desc \"X is ignored.\"\n    }\n}\n")
+	}
+	return b.String()
+}
+
+func TestMockNames(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Collisions", func(t *testing.T) {
+		t.Parallel()
+
+		// These used to be the names of the mock helpers.
+		spec := writeSpec(t, "test.rpc", specWithOps("Calls", "CallsTo", "Reset", "Record"))
+		out := filepath.Join(filepath.Dir(spec), "test.gen.go")
+		if err := generate(spec, "go", out, false, false, false); err != nil {
+			t.Fatalf("failed to generate: %v", err)
+		}
+		typeCheck(t, out)
+	})
+
+	t.Run("Reserved", func(t *testing.T) {
+		t.Parallel()
+
+		for _, name := range []string{"MockCalls", "MockCallsTo", "MockReset"} {
+			spec := writeSpec(t, "test.rpc", specWithOps("Get", name))
+			err := generate(spec, "go", filepath.Join(filepath.Dir(spec), "test.gen.go"), false, false, false)
+			if err == nil || !strings.Contains(err.Error(), "reserved") {
+				t.Errorf("expected op name %s to be reserved but got %v", name, err)
+			}
+		}
+	})
+}
+
+func TestMainSpecs(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	files := map[string]string{
+		// main.rpc includes the shared types
+		"main.rpc": "include \"types.rpc\"\n" + specWithOps("Get"),
+
+		// types.rpc is a fragment without a name
+		"types.rpc": "type Point struct {\n    X int32 { desc \"X is the X coordinate.\" }\n} \"Point is a point.\"\n",
+
+		// named.rpc has a name, but is only used as a fragment of other.rpc
+		"named.rpc": "name Named\n",
+		"other.rpc": "include \"named.rpc\"\n" + specWithOps("Put"),
+
+		// broken.rpc cannot be scanned, and is kept so that the error is reported
+		"broken.rpc": "name \"unterminated\n",
+	}
+	var paths []string
+	for name, src := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	specs, err := mainSpecs(paths)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []string{filepath.Join(dir, "broken.rpc"), filepath.Join(dir, "main.rpc"), filepath.Join(dir, "other.rpc")}
+	if !reflect.DeepEqual(specs, expect) {
+		t.Errorf("expected specs %q but got %q", expect, specs)
+	}
+
+	out := filepath.Join(dir, "main.gen.go")
+	if err := generate(filepath.Join(dir, "main.rpc"), "go", out, false, false, false); err != nil {
+		t.Fatalf("failed to generate: %v", err)
+	}
+	typeCheck(t, out)
+
+	if _, err := mainSpecs([]string{filepath.Join(dir, "types.rpc")}); err == nil {
+		t.Error("selected specs from a directory containing only a fragment")
+	}
+}
+
+func TestCheck(t *testing.T) {
+	t.Parallel()
+
+	spec := writeSpec(t, "test.rpc", specWithOps("Get"))
+	out := filepath.Join(filepath.Dir(spec), "test.gen.go")
+	if err := generate(spec, "go", out, false, false, false); err != nil {
+		t.Fatalf("failed to generate: %v", err)
+	}
+	generated, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := generate(spec, "go", out, false, false, true); err != nil {
+		t.Errorf("freshly generated code is not up to date: %v", err)
+	}
+
+	// A file which only differs by the input hash, such as after rebuilding the generator, is up to date.
+	rehashed := append([]byte(hashPrefix+"0\n"), stripHash(generated)...)
+	if err := os.WriteFile(out, rehashed, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := generate(spec, "go", out, false, false, true); err != nil {
+		t.Errorf("code which only differs by hash is not up to date: %v", err)
+	}
+
+	// An edit to the generated code is detected even though the recorded hash still matches the inputs.
+	edited := append(append([]byte(nil), generated...), "\n// edited\n"...)
+	if err := os.WriteFile(out, edited, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := generate(spec, "go", out, false, false, true); !errors.Is(err, errStale) {
+		t.Errorf("expected edited code to be stale but got %v", err)
+	}
+	if err := generate(spec, "go", out, false, false, false); err != nil {
+		t.Fatalf("failed to regenerate: %v", err)
+	}
+	if regenerated, err := os.ReadFile(out); err != nil || !bytes.Equal(regenerated, generated) {
+		t.Errorf("edited code was not regenerated (%v)", err)
+	}
+}
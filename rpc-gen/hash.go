@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// hashPrefix starts the line recording the input hash at the top of generated Go code.
+const hashPrefix = "// rpc-gen input hash: "
+
+// errStale is returned in check mode when a generated file is not up to date.
+var errStale = errors.New("generated code is out of date")
+
+var (
+	generatorOnce sync.Once
+	generatorID   string
+)
+
+// generatorVersion identifies the build of the generator, so that upgrading it invalidates the hashes of generated code.
+// Released versions are identified by the module version, and development builds by the contents of the executable.
+func generatorVersion() string {
+	generatorOnce.Do(func() {
+		if bi, ok := debug.ReadBuildInfo(); ok && bi.Main.Version != "" && bi.Main.Version != "(devel)" {
+			generatorID = bi.Main.Path + "@" + bi.Main.Version
+			return
+		}
+		exe, err := os.Executable()
+		if err != nil {
+			return
+		}
+		f, err := os.Open(exe)
+		if err != nil {
+			return
+		}
+		defer f.Close()
+		h := sha256.New()
+		if _, err := io.Copy(h, f); err != nil {
+			return
+		}
+		generatorID = hex.EncodeToString(h.Sum(nil))
+	})
+	return generatorID
+}
+
+// inputHash hashes the inputs of a generated file: the spec and the specs it includes, the templates, and the generator options.
+func inputHash(spec string, sys System, tmplpath string, imports, tracing bool) (string, error) {
+	h := sha256.New()
+	fmt.Fprintf(h, "generator %q\ntemplate %q\nimports %t\ntracing %t\n", generatorVersion(), tmplpath, imports, tracing)
+
+	// the included specs are hashed by content, so that the hash does not depend on where the specs are
+	files := []string{spec}
+	for path := range sys.included {
+		files = append(files, path)
+	}
+	sums := make([]string, len(files))
+	for i, path := range files {
+		dat, err := ioutil.ReadFile(path)
+		if err != nil {
+			return "", err
+		}
+		sum := sha256.Sum256(dat)
+		sums[i] = hex.EncodeToString(sum[:])
+	}
+	sort.Strings(sums[1:])
+	fmt.Fprintf(h, "specs %s\n", strings.Join(sums, " "))
+
+	if _, ok := builtinTemplates[tmplpath]; ok {
+		paths, err := fs.Glob(templateFS, "templates/*.tmpl")
+		if err != nil {
+			return "", err
+		}
+		for _, path := range paths {
+			dat, err := templateFS.ReadFile(path)
+			if err != nil {
+				return "", err
+			}
+			fmt.Fprintf(h, "%s %d\n", path, len(dat))
+			h.Write(dat)
+		}
+	} else {
+		dat, err := ioutil.ReadFile(tmplpath)
+		if err != nil {
+			return "", err
+		}
+		h.Write(dat)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// stripHash removes the input hash line from generated code.
+func stripHash(src []byte) []byte {
+	if !bytes.HasPrefix(src, []byte(hashPrefix)) {
+		return src
+	}
+	if i := bytes.IndexByte(src, '\n'); i != -1 {
+		return src[i+1:]
+	}
+	return nil
+}
+
+// upToDate checks whether a generated file has the same contents as freshly generated code, other than the input hash.
+// A file which only differs by hash is not rewritten, so that the code is not churned by rebuilding the generator.
+func upToDate(path string, src []byte) bool {
+	old, err := ioutil.ReadFile(path)
+	return err == nil && bytes.Equal(stripHash(old), stripHash(src))
+}
@@ -0,0 +1,125 @@
+package main
+
+import "net/http"
+
+// jsonSchemas converts types to schemas within the definitions of a JSON Schema document.
+var jsonSchemas = schemaGen{refPrefix: "#/$defs/"}
+
+// jsonSchemaPayload creates a schema for the JSON payload carrying a set of arguments.
+// Returns nil if the arguments are not carried as JSON.
+func jsonSchemaPayload(args []Arg) jsonObject {
+	var fields []Arg
+	for _, a := range args {
+		st, ok := a.Type.(StreamType)
+		switch {
+		case !ok:
+			fields = append(fields, a)
+		case st == ByteStream:
+			// raw data is sent alongside the JSON arguments, if there are any
+		case len(args) == 1:
+			// a streamed JSON array
+			schema := jsonSchemas.schema(st)
+			schema["description"] = a.Description
+			return schema
+		}
+	}
+	if fields == nil && len(args) != 0 {
+		return nil
+	}
+	return jsonSchemas.object(fields)
+}
+
+// jsonSchemaError creates a schema for the error container sent by an operation.
+func (s *System) jsonSchemaError(op Op) jsonObject {
+	var typed []interface{}
+	add := func(name string, code int) {
+		typed = append(typed, jsonObject{
+			"description": http.StatusText(code),
+			"properties": jsonObject{
+				"type": jsonObject{"const": name},
+				"dat":  jsonSchemas.ref(name),
+			},
+			"required": []string{"type"},
+		})
+	}
+	if s.opValidated(op) {
+		add("ValidationError", http.StatusBadRequest)
+	}
+	if op.Timeout != 0 {
+		add("TimeoutError", http.StatusGatewayTimeout)
+	}
+	if op.RateLimit.Burst != 0 {
+		add("RateLimitError", http.StatusTooManyRequests)
+	}
+	if op.Auth.Scheme != "" {
+		add("UnauthorizedError", http.StatusUnauthorized)
+	}
+	for _, name := range op.Errors {
+		for _, e := range s.Errors {
+			if e.Name == name {
+				add(e.Name, e.Code)
+			}
+		}
+	}
+	// an undeclared error has no type
+	typed = append(typed, jsonObject{"not": jsonObject{"required": []string{"type"}}})
+	schema := jsonSchemas.ref("rpcError")
+	schema["anyOf"] = typed
+	return schema
+}
+
+// jsonSchema creates a JSON Schema document with definitions for the payloads of each operation and the types and errors of the system.
+// The request, response, and error payloads of an operation are defined as "<op>Request", "<op>Response", and "<op>Error".
+// If the spec defines multiple systems, the definitions are prefixed with the system name.
+func (s *System) jsonSchema() jsonObject {
+	defs := jsonObject{
+		"rpcError":        rpcErrorSchema(s.errCodeIsInt()),
+		"ValidationError": jsonSchemas.validationErrorSchema(),
+	}
+	if hasTimeout(*s) {
+		defs["TimeoutError"] = jsonSchemas.timeoutErrorSchema()
+	}
+	if hasRateLimit(*s) {
+		defs["RateLimitError"] = jsonSchemas.rateLimitErrorSchema()
+	}
+	if hasAuth(*s) {
+		defs["UnauthorizedError"] = jsonSchemas.unauthorizedErrorSchema()
+	}
+	for _, td := range s.Types {
+		schema := jsonSchemas.schema(td.Type)
+		schema["description"] = td.Description
+		defs[td.Name] = schema
+	}
+	for _, e := range s.Errors {
+		schema := jsonSchemas.object(e.Fields)
+		schema["description"] = e.Description
+		defs[e.Name] = schema
+	}
+	for _, sub := range s.Systems {
+		var prefix string
+		if len(s.Systems) > 1 {
+			prefix = sub.Name
+		}
+		for _, op := range sub.Operations {
+			if req := jsonSchemaPayload(op.Inputs); req != nil {
+				req["description"] = "The request payload of " + op.Name + "."
+				defs[prefix+op.Name+"Request"] = req
+			}
+			if res := jsonSchemaPayload(op.Outputs); res != nil {
+				res["description"] = "The response payload of " + op.Name + "."
+				defs[prefix+op.Name+"Response"] = res
+			}
+			defs[prefix+op.Name+"Error"] = s.jsonSchemaError(op)
+		}
+	}
+
+	title := s.Name
+	if title == "" {
+		title = s.GoPackage
+	}
+	return jsonObject{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"title":   title,
+		"$defs":   defs,
+	}
+}
@@ -0,0 +1,197 @@
+// Package metrics collects measurements of the calls made through code generated with rpc-gen.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Side is the side of a call which made an observation.
+type Side string
+
+const (
+	// Server is the side of a call which runs the operation.
+	Server Side = "server"
+
+	// Client is the side of a call which requests the operation.
+	Client Side = "client"
+)
+
+// Observation is a measurement of a completed call.
+type Observation struct {
+	// System is the name of the system.
+	System string
+
+	// Op is the name of the operation.
+	Op string
+
+	// Side is the side of the call which made the observation.
+	Side Side
+
+	// Outcome is "ok" if the call succeeded, and otherwise the name of the error type.
+	// Errors which are not declared in the spec are reported as "error".
+	// Requests rejected by the server before the operation was run are reported as "rejected".
+	// Stored responses replayed by the server for calls retried with an idempotency key are reported as "replayed".
+	Outcome string
+
+	// Duration is the time taken by the call.
+	Duration time.Duration
+}
+
+// Collector receives observations of calls.
+// It must be safe for concurrent use.
+type Collector interface {
+	ObserveCall(Observation)
+}
+
+// DefaultBuckets are the default upper bounds of the latency histogram buckets, in seconds.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Prometheus is a Collector which counts calls and records their latencies in histograms.
+// The metrics are served in the Prometheus text exposition format.
+// The zero value is ready to use.
+type Prometheus struct {
+	// Namespace is prefixed to the metric names, separated by an underscore.
+	Namespace string
+
+	// Buckets are the upper bounds of the latency histogram buckets, in seconds.
+	// They must be sorted in increasing order.
+	// Defaults to DefaultBuckets.
+	Buckets []float64
+
+	mu     sync.Mutex
+	series map[seriesKey]*histogram
+}
+
+var _ Collector = (*Prometheus)(nil)
+
+// seriesKey is the set of labels identifying a series.
+type seriesKey struct {
+	system, op, side, outcome string
+}
+
+// histogram is the state of a latency histogram.
+type histogram struct {
+	// counts are the number of observations in each bucket, which are not cumulative.
+	// The last count is for the implicit +Inf bucket.
+	counts []uint64
+
+	sum float64
+}
+
+func (p *Prometheus) buckets() []float64 {
+	if p.Buckets == nil {
+		return DefaultBuckets
+	}
+	return p.Buckets
+}
+
+// ObserveCall records an observation.
+func (p *Prometheus) ObserveCall(o Observation) {
+	buckets := p.buckets()
+	secs := o.Duration.Seconds()
+	i := sort.SearchFloat64s(buckets, secs)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.series == nil {
+		p.series = make(map[seriesKey]*histogram)
+	}
+	key := seriesKey{o.System, o.Op, string(o.Side), o.Outcome}
+	h, ok := p.series[key]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(buckets)+1)}
+		p.series[key] = h
+	}
+	h.counts[i]++
+	h.sum += secs
+}
+
+// WriteTo writes the metrics in the Prometheus text exposition format.
+func (p *Prometheus) WriteTo(w io.Writer) (int64, error) {
+	prefix := ""
+	if p.Namespace != "" {
+		prefix = p.Namespace + "_"
+	}
+	buckets := p.buckets()
+
+	p.mu.Lock()
+	keys := make([]seriesKey, 0, len(p.series))
+	hists := make(map[seriesKey]histogram, len(p.series))
+	for k, h := range p.series {
+		keys = append(keys, k)
+		hists[k] = histogram{counts: append([]uint64(nil), h.counts...), sum: h.sum}
+	}
+	p.mu.Unlock()
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		switch {
+		case a.system != b.system:
+			return a.system < b.system
+		case a.op != b.op:
+			return a.op < b.op
+		case a.side != b.side:
+			return a.side < b.side
+		default:
+			return a.outcome < b.outcome
+		}
+	})
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# HELP %srpc_calls_total Number of completed RPC calls.\n", prefix)
+	fmt.Fprintf(&b, "# TYPE %srpc_calls_total counter\n", prefix)
+	for _, k := range keys {
+		fmt.Fprintf(&b, "%srpc_calls_total{%s} %d\n", prefix, k.labels(), hists[k].total())
+	}
+	fmt.Fprintf(&b, "# HELP %srpc_call_duration_seconds Latency of completed RPC calls.\n", prefix)
+	fmt.Fprintf(&b, "# TYPE %srpc_call_duration_seconds histogram\n", prefix)
+	for _, k := range keys {
+		h := hists[k]
+		labels := k.labels()
+		var cum uint64
+		for i, bound := range buckets {
+			cum += h.counts[i]
+			fmt.Fprintf(&b, "%srpc_call_duration_seconds_bucket{%s,le=%q} %d\n", prefix, labels, formatFloat(bound), cum)
+		}
+		fmt.Fprintf(&b, "%srpc_call_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", prefix, labels, h.total())
+		fmt.Fprintf(&b, "%srpc_call_duration_seconds_sum{%s} %s\n", prefix, labels, formatFloat(h.sum))
+		fmt.Fprintf(&b, "%srpc_call_duration_seconds_count{%s} %d\n", prefix, labels, h.total())
+	}
+
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+// ServeHTTP serves the metrics in the Prometheus text exposition format.
+func (p *Prometheus) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	p.WriteTo(w)
+}
+
+func (h histogram) total() uint64 {
+	var n uint64
+	for _, c := range h.counts {
+		n += c
+	}
+	return n
+}
+
+func (k seriesKey) labels() string {
+	return fmt.Sprintf("system=%s,op=%s,side=%s,outcome=%s",
+		quoteLabel(k.system), quoteLabel(k.op), quoteLabel(k.side), quoteLabel(k.outcome))
+}
+
+// quoteLabel quotes a label value, escaping it as required by the exposition format.
+func quoteLabel(v string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v) + `"`
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
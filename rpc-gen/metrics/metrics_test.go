@@ -0,0 +1,45 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPrometheus(t *testing.T) {
+	t.Parallel()
+
+	p := &Prometheus{Namespace: "test", Buckets: []float64{0.1, 1}}
+	p.ObserveCall(Observation{System: "Math", Op: "Add", Side: Server, Outcome: "ok", Duration: 50 * time.Millisecond})
+	p.ObserveCall(Observation{System: "Math", Op: "Add", Side: Server, Outcome: "ok", Duration: time.Second})
+	p.ObserveCall(Observation{System: "Math", Op: "Add", Side: Server, Outcome: "ok", Duration: 2 * time.Second})
+	p.ObserveCall(Observation{System: "Math", Op: "Divide", Side: Client, Outcome: `Err"Quoted"`, Duration: 0})
+
+	rec := httptest.NewRecorder()
+	p.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	expect := strings.Join([]string{
+		`# HELP test_rpc_calls_total Number of completed RPC calls.`,
+		`# TYPE test_rpc_calls_total counter`,
+		`test_rpc_calls_total{system="Math",op="Add",side="server",outcome="ok"} 3`,
+		`test_rpc_calls_total{system="Math",op="Divide",side="client",outcome="Err\"Quoted\""} 1`,
+		`# HELP test_rpc_call_duration_seconds Latency of completed RPC calls.`,
+		`# TYPE test_rpc_call_duration_seconds histogram`,
+		`test_rpc_call_duration_seconds_bucket{system="Math",op="Add",side="server",outcome="ok",le="0.1"} 1`,
+		`test_rpc_call_duration_seconds_bucket{system="Math",op="Add",side="server",outcome="ok",le="1"} 2`,
+		`test_rpc_call_duration_seconds_bucket{system="Math",op="Add",side="server",outcome="ok",le="+Inf"} 3`,
+		`test_rpc_call_duration_seconds_sum{system="Math",op="Add",side="server",outcome="ok"} 3.05`,
+		`test_rpc_call_duration_seconds_count{system="Math",op="Add",side="server",outcome="ok"} 3`,
+		`test_rpc_call_duration_seconds_bucket{system="Math",op="Divide",side="client",outcome="Err\"Quoted\"",le="0.1"} 1`,
+		`test_rpc_call_duration_seconds_bucket{system="Math",op="Divide",side="client",outcome="Err\"Quoted\"",le="1"} 1`,
+		`test_rpc_call_duration_seconds_bucket{system="Math",op="Divide",side="client",outcome="Err\"Quoted\"",le="+Inf"} 1`,
+		`test_rpc_call_duration_seconds_sum{system="Math",op="Divide",side="client",outcome="Err\"Quoted\""} 0`,
+		`test_rpc_call_duration_seconds_count{system="Math",op="Divide",side="client",outcome="Err\"Quoted\""} 1`,
+	}, "\n") + "\n"
+	if got := rec.Body.String(); got != expect {
+		t.Errorf("expected:\n%s\ngot:\n%s", expect, got)
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("unexpected content type %q", ct)
+	}
+}
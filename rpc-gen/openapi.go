@@ -0,0 +1,288 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// openAPISchemas converts types to schemas within the components of an OpenAPI document.
+var openAPISchemas = schemaGen{refPrefix: "#/components/schemas/"}
+
+// openAPIContent creates an OpenAPI content map for a set of arguments.
+func openAPIContent(args []Arg) jsonObject {
+	for _, a := range args {
+		if st, ok := a.Type.(StreamType); ok && len(args) == 1 {
+			mime := "application/json"
+			if st == ByteStream {
+				mime = "application/octet-stream"
+			}
+			return jsonObject{mime: jsonObject{"schema": openAPISchemas.schema(st)}}
+		}
+	}
+	return jsonObject{"application/json": jsonObject{"schema": openAPISchemas.object(args)}}
+}
+
+// openAPIBinaryContent adds the binary encodings of a payload to a content map, if the server selects its encoding.
+// Operations which negotiate their encoding accept every binary encoding, and other operations only accept their own.
+func openAPIBinaryContent(op Op, codec bool, content jsonObject) jsonObject {
+	if !codec {
+		return content
+	}
+	for name, enc := range binaryEncodings {
+		if op.Negotiate || name == op.ArgEncoding {
+			content[enc.ContentType] = content["application/json"]
+		}
+	}
+	return content
+}
+
+// openAPIOperation creates an OpenAPI operation object for an operation.
+func (s *System) openAPIOperation(op Op) jsonObject {
+	desc := op.Description
+	if op.duplex() {
+		desc += "\n\nThis operation upgrades to a WebSocket carrying the input and output streams." +
+			" Over HTTP/2, it may instead be called with a POST request, streaming newline-delimited JSON frames in the request and response bodies."
+	}
+	status, res := "200", jsonObject{"description": "The operation completed successfully."}
+	if op.Subscription {
+		desc += "\n\nThis operation is a subscription, which upgrades to a WebSocket delivering each event in the \"value\" of a JSON frame." +
+			" The subscription is ended by a frame setting \"end\" or carrying an \"error\", and the client unsubscribes by closing the WebSocket."
+		status, res = "101", jsonObject{"description": "The subscription was accepted, and the connection upgraded to a WebSocket."}
+	}
+	if len(op.Outputs) != 0 && !op.duplex() && !op.Subscription {
+		content := openAPIContent(op.Outputs)
+		content = openAPIBinaryContent(op, op.codecOutputs(), content)
+		if op.SSE {
+			// each event carries an element of the stream
+			content["text/event-stream"] = jsonObject{"schema": openAPISchemas.schema(op.Outputs[0].Type.(StreamType).Elem)}
+		}
+		if op.NDJSON {
+			// each line is a frame carrying an element of the stream, or terminating it
+			content["application/x-ndjson"] = jsonObject{"schema": jsonObject{
+				"type": "object",
+				"properties": jsonObject{
+					"value": openAPISchemas.schema(op.Outputs[0].Type.(StreamType).Elem),
+					"error": openAPISchemas.ref("rpcError"),
+					"end":   jsonObject{"type": "boolean"},
+				},
+			}}
+		}
+		res["content"] = content
+	}
+	// group the declared errors by status code
+	errs := map[int][]string{http.StatusBadRequest: {"ValidationError"}}
+	if op.Timeout != 0 {
+		errs[http.StatusGatewayTimeout] = append(errs[http.StatusGatewayTimeout], "TimeoutError")
+	}
+	if op.RateLimit.Burst != 0 {
+		errs[http.StatusTooManyRequests] = append(errs[http.StatusTooManyRequests], "RateLimitError")
+	}
+	if op.Auth.Scheme != "" {
+		errs[http.StatusUnauthorized] = append(errs[http.StatusUnauthorized], "UnauthorizedError")
+	}
+	for _, name := range op.Errors {
+		for _, e := range s.Errors {
+			if e.Name == name {
+				errs[e.Code] = append(errs[e.Code], e.Name)
+			}
+		}
+	}
+	responses := jsonObject{
+		status:    res,
+		"default": jsonObject{"$ref": "#/components/responses/Error"},
+	}
+	for code, names := range errs {
+		responses[strconv.Itoa(code)] = jsonObject{
+			"description": http.StatusText(code) + ": " + strings.Join(names, ", "),
+			"content": jsonObject{
+				"application/json": jsonObject{"schema": openAPISchemas.ref("rpcError")},
+			},
+		}
+	}
+	obj := jsonObject{
+		"operationId": op.Name,
+		"description": desc,
+		"responses":   responses,
+	}
+	if op.Auth.Scheme != "" {
+		name, _ := openAPISecurityScheme(op.Auth)
+		obj["security"] = []interface{}{jsonObject{name: []string{}}}
+	}
+
+	switch {
+	case op.duplex() || len(op.Inputs) == 0:
+	case op.ArgEncoding == "query":
+		params := make([]interface{}, len(op.Inputs))
+		for i, a := range op.Inputs {
+			param := jsonObject{
+				"name":        a.WireName(),
+				"in":          "query",
+				"description": a.Description,
+				"required":    a.Required,
+			}
+			ut, seen, leaf := s.queryLeaf(a.Type, nil)
+			at, array := ut.(ArrayType)
+			switch {
+			case array && !leaf && s.queryRepeated(at, seen):
+				param["schema"] = openAPISchemas.field(a)
+				param["style"] = "form"
+				param["explode"] = true
+			case !leaf && !array:
+				param["schema"] = openAPISchemas.field(a)
+				param["style"] = "deepObject"
+				param["explode"] = true
+			default:
+				// simple values and arrays of compound values are described as JSON
+				param["content"] = jsonObject{
+					"application/json": jsonObject{"schema": openAPISchemas.field(a)},
+				}
+			}
+			params[i] = param
+		}
+		obj["parameters"] = params
+	case op.multipart():
+		var args []Arg
+		var upload string
+		for _, a := range op.Inputs {
+			if a.Type == ByteStream {
+				upload = a.Name
+				continue
+			}
+			args = append(args, a)
+		}
+		obj["requestBody"] = jsonObject{
+			"required": true,
+			"content": jsonObject{
+				"multipart/form-data": jsonObject{
+					"schema": jsonObject{
+						"type": "object",
+						"properties": jsonObject{
+							"args": openAPISchemas.object(args),
+							upload: openAPISchemas.schema(ByteStream),
+						},
+					},
+					"encoding": jsonObject{
+						"args": jsonObject{"contentType": "application/json"},
+					},
+				},
+			},
+		}
+	default:
+		obj["requestBody"] = jsonObject{
+			"required": true,
+			"content":  openAPIBinaryContent(op, op.codecArgs(), openAPIContent(op.Inputs)),
+		}
+	}
+	if s.Idempotency && op.replayable() {
+		params, _ := obj["parameters"].([]interface{})
+		obj["parameters"] = append(params, jsonObject{
+			"name":        "Idempotency-Key",
+			"in":          "header",
+			"description": "A key identifying the call, so that the stored response is replayed if the call is retried.",
+			"schema":      jsonObject{"type": "string"},
+		})
+	}
+	return obj
+}
+
+// openAPISecurityScheme creates an OpenAPI security scheme object for an authentication scheme, along with the name of the component.
+func openAPISecurityScheme(a Auth) (string, jsonObject) {
+	if a.Scheme == "bearer" {
+		return "bearer", jsonObject{"type": "http", "scheme": "bearer"}
+	}
+	return "apikey-" + a.Header, jsonObject{"type": "apiKey", "in": "header", "name": a.Header}
+}
+
+// openAPI creates an OpenAPI 3.0 document describing the HTTP API of the system.
+func (s *System) openAPI() jsonObject {
+	paths := jsonObject{}
+	for _, sub := range s.Systems {
+		for _, op := range sub.Operations {
+			path := "/" + op.Path
+			if len(s.Systems) > 1 {
+				// each system is served by a separate handler, which is assumed to be mounted under the system name
+				path = "/" + sub.Name + path
+			}
+			item, ok := paths[path].(jsonObject)
+			if !ok {
+				item = jsonObject{}
+				paths[path] = item
+			}
+			obj := s.openAPIOperation(op)
+			if len(s.Systems) > 1 {
+				obj["operationId"] = sub.Name + "." + op.Name
+				obj["tags"] = []string{sub.Name}
+			}
+			item[strings.ToLower(op.Method)] = obj
+		}
+	}
+
+	schemas := jsonObject{
+		"rpcError":        rpcErrorSchema(s.errCodeIsInt()),
+		"ValidationError": openAPISchemas.validationErrorSchema(),
+	}
+	if hasTimeout(*s) {
+		schemas["TimeoutError"] = openAPISchemas.timeoutErrorSchema()
+	}
+	security := jsonObject{}
+	for _, op := range s.operations() {
+		if op.Auth.Scheme != "" {
+			name, scheme := openAPISecurityScheme(op.Auth)
+			security[name] = scheme
+		}
+	}
+	if hasRateLimit(*s) {
+		schemas["RateLimitError"] = openAPISchemas.rateLimitErrorSchema()
+	}
+	if len(security) != 0 {
+		schemas["UnauthorizedError"] = openAPISchemas.unauthorizedErrorSchema()
+	}
+	for _, td := range s.Types {
+		schema := openAPISchemas.schema(td.Type)
+		schema["description"] = td.Description
+		schemas[td.Name] = schema
+	}
+	for _, e := range s.Errors {
+		schema := openAPISchemas.object(e.Fields)
+		schema["description"] = e.Description
+		schemas[e.Name] = schema
+	}
+
+	title, desc := s.Name, s.Description
+	if title == "" {
+		title = s.GoPackage
+	}
+	if desc == "" {
+		descs := make([]string, len(s.Systems))
+		for i, sub := range s.Systems {
+			descs[i] = sub.Description
+		}
+		desc = strings.Join(descs, "\n\n")
+	}
+
+	components := jsonObject{
+		"schemas": schemas,
+		"responses": jsonObject{
+			"Error": jsonObject{
+				"description": "An unexpected error occurred.",
+				"content": jsonObject{
+					"application/json": jsonObject{"schema": openAPISchemas.ref("rpcError")},
+				},
+			},
+		},
+	}
+	if len(security) != 0 {
+		components["securitySchemes"] = security
+	}
+	return jsonObject{
+		"openapi": "3.0.3",
+		"info": jsonObject{
+			"title":       title,
+			"description": desc,
+			"version":     "0.0.0",
+		},
+		"paths":      paths,
+		"components": components,
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// The "query" encoding sends each input as query parameters.
+// Arrays of simple values are sent as a repeated parameter (e.g. "tag=1&tag=2").
+// Struct fields are sent with bracket notation (e.g. "filter[name]=1"), and so are the elements of arrays of structs or arrays (e.g. "items[0][name]=1").
+// All other values are JSON-encoded, although values which are JSON strings may also be sent unquoted.
+// For compatibility, an array or struct may instead be sent as a single JSON-encoded parameter.
+
+// queryLeaf checks whether a value of a type is sent as a single JSON-encoded query parameter.
+// If the type is named, the underlying type is returned to be walked instead.
+// Recursive named types are sent as JSON once they refer back to themselves.
+func (s *System) queryLeaf(t Type, seen map[NamedType]struct{}) (Type, map[NamedType]struct{}, bool) {
+	nt, ok := t.(NamedType)
+	if ok {
+		if _, ok := seen[nt]; ok {
+			return t, seen, true
+		}
+		next := make(map[NamedType]struct{}, len(seen)+1)
+		for k := range seen {
+			next[k] = struct{}{}
+		}
+		next[nt] = struct{}{}
+		seen = next
+		t = s.underlying(t)
+	}
+	switch t := t.(type) {
+	case ArrayType:
+		// byte slices are JSON-encoded as base64 strings
+		return t, seen, s.underlying(t.Elem) == ByteType
+	case StructType:
+		return t, seen, false
+	default:
+		return t, seen, true
+	}
+}
+
+// queryRepeated checks whether the elements of an array are sent as a repeated parameter.
+func (s *System) queryRepeated(at ArrayType, seen map[NamedType]struct{}) bool {
+	_, _, leaf := s.queryLeaf(at.Elem, seen)
+	return leaf
+}
+
+// queryKey appends a bracketed field name to a Go expression which evaluates to a query parameter name.
+func queryKey(key, field string) string {
+	if lit, err := strconv.Unquote(key); err == nil {
+		return strconv.Quote(lit + "[" + field + "]")
+	}
+	return key + " + " + strconv.Quote("["+field+"]")
+}
+
+// queryIndexKey creates a Go expression evaluating to the parameter name of an array element.
+func queryIndexKey(key, idx string) string {
+	if lit, err := strconv.Unquote(key); err == nil {
+		return fmt.Sprintf("fmt.Sprintf(%q, %s)", strings.Replace(lit, "%", "%%", -1)+"[%d]", idx)
+	}
+	return fmt.Sprintf("fmt.Sprintf(\"%%s[%%d]\", %s, %s)", key, idx)
+}
+
+// goQueryEncode generates Go statements adding a value to the query parameters in q.
+// The expr is the Go expression of the value, and key is a Go expression evaluating to the parameter name.
+// The generated code returns an error on failure.
+func (s *System) goQueryEncode(t Type, expr, key string, depth int, seen map[NamedType]struct{}) string {
+	ut, seen, leaf := s.queryLeaf(t, seen)
+	if leaf {
+		return fmt.Sprintf("if err := queryAdd(q, %s, %s); err != nil {\nreturn err\n}\n", key, expr)
+	}
+
+	var b strings.Builder
+	switch ut := ut.(type) {
+	case ArrayType:
+		idx, elem := "i"+strconv.Itoa(depth), "e"+strconv.Itoa(depth)
+		if s.queryRepeated(ut, seen) {
+			fmt.Fprintf(&b, "for _, %s := range %s {\n", elem, expr)
+			b.WriteString(s.goQueryEncode(ut.Elem, elem, key, depth+1, seen))
+		} else {
+			fmt.Fprintf(&b, "for %s, %s := range %s {\n", idx, elem, expr)
+			b.WriteString(s.goQueryEncode(ut.Elem, elem, queryIndexKey(key, idx), depth+1, seen))
+		}
+		b.WriteString("}\n")
+	case StructType:
+		for _, f := range ut {
+			b.WriteString(s.goQueryEncode(f.Type, expr+"."+f.Name, queryKey(key, f.WireName()), depth, seen))
+		}
+	}
+	return b.String()
+}
+
+// goQueryDecode generates Go statements decoding a value from the query parameters in q.
+// The expr is the addressable Go expression of the destination, and key is a Go expression evaluating to the parameter name.
+// The generated code returns an error on failure, and leaves the destination unchanged if the parameters are missing.
+func (s *System) goQueryDecode(t Type, expr, key string, depth int, seen map[NamedType]struct{}) string {
+	ut, seen, leaf := s.queryLeaf(t, seen)
+	if leaf {
+		return fmt.Sprintf("if err := queryValue(q, %s, &%s); err != nil {\nreturn err\n}\n", key, expr)
+	}
+
+	var b strings.Builder
+	switch ut := ut.(type) {
+	case ArrayType:
+		idx, elem, vals := "i"+strconv.Itoa(depth), "e"+strconv.Itoa(depth), "vals"+strconv.Itoa(depth)
+		if s.queryRepeated(ut, seen) {
+			fmt.Fprintf(&b, "if %s := q[%s]; len(%s) == 1 && strings.HasPrefix(%s[0], \"[\") && json.Unmarshal([]byte(%s[0]), &%s) == nil {\n", vals, key, vals, vals, vals, expr)
+			b.WriteString("// the array was sent as a single JSON value\n")
+			fmt.Fprintf(&b, "} else {\nfor _, raw := range %s {\n", vals)
+			fmt.Fprintf(&b, "var %s %s\n", elem, ut.Elem.GoType())
+			fmt.Fprintf(&b, "if err := queryDecode(%s, raw, &%s); err != nil {\nreturn err\n}\n", key, elem)
+			fmt.Fprintf(&b, "%s = append(%s, %s)\n", expr, expr, elem)
+			b.WriteString("}\n}\n")
+			return b.String()
+		}
+		n := "n" + strconv.Itoa(depth)
+		fmt.Fprintf(&b, "if len(q[%s]) != 0 {\n", key)
+		fmt.Fprintf(&b, "if err := queryValue(q, %s, &%s); err != nil {\nreturn err\n}\n", key, expr)
+		fmt.Fprintf(&b, "} else if %s, err := queryLen(q, %s); err != nil {\nreturn err\n} else if %s != 0 {\n", n, key, n)
+		fmt.Fprintf(&b, "%s = make(%s, %s)\n", expr, t.GoType(), n)
+		fmt.Fprintf(&b, "for %s := range %s {\n", idx, expr)
+		b.WriteString(s.goQueryDecode(ut.Elem, fmt.Sprintf("%s[%s]", expr, idx), queryIndexKey(key, idx), depth+1, seen))
+		b.WriteString("}\n}\n")
+	case StructType:
+		fmt.Fprintf(&b, "if len(q[%s]) != 0 {\n", key)
+		b.WriteString("// the struct was sent as a single JSON value\n")
+		fmt.Fprintf(&b, "if err := queryValue(q, %s, &%s); err != nil {\nreturn err\n}\n", key, expr)
+		b.WriteString("} else {\n")
+		for _, f := range ut {
+			b.WriteString(s.goQueryDecode(f.Type, expr+"."+f.Name, queryKey(key, f.WireName()), depth, seen))
+		}
+		b.WriteString("}\n")
+	}
+	return b.String()
+}
+
+// hasQuery checks whether any operation sends inputs with the "query" encoding.
+func hasQuery(s System) bool {
+	ops := s.Operations
+	if len(s.Systems) != 0 {
+		ops = s.operations()
+	}
+	for _, op := range ops {
+		if op.ArgEncoding == "query" && len(op.Inputs) != 0 {
+			return true
+		}
+	}
+	return false
+}
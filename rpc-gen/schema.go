@@ -0,0 +1,170 @@
+package main
+
+import "strconv"
+
+// jsonObject is a JSON object in an OpenAPI document.
+type jsonObject = map[string]interface{}
+
+// schemaGen converts types to JSON schemas, for use in OpenAPI and JSON Schema documents.
+type schemaGen struct {
+	// refPrefix is the prefix of references to the schemas of named types.
+	refPrefix string
+}
+
+// ref creates a reference to a named schema.
+func (g schemaGen) ref(name string) jsonObject {
+	return jsonObject{"$ref": g.refPrefix + name}
+}
+
+// schema converts a type to a schema object.
+func (g schemaGen) schema(t Type) jsonObject {
+	switch t {
+	case Uint8Type, ByteType, Uint16Type:
+		return jsonObject{"type": "integer", "format": "int32", "minimum": 0}
+	case Uint32Type:
+		return jsonObject{"type": "integer", "format": "int64", "minimum": 0}
+	case Uint64Type:
+		return jsonObject{"type": "integer", "minimum": 0}
+	case Int8Type, Int16Type, Int32Type:
+		return jsonObject{"type": "integer", "format": "int32"}
+	case Int64Type:
+		return jsonObject{"type": "integer", "format": "int64"}
+	case Float32Type:
+		return jsonObject{"type": "number", "format": "float"}
+	case Float64Type:
+		return jsonObject{"type": "number", "format": "double"}
+	case BoolType:
+		return jsonObject{"type": "boolean"}
+	case StringType:
+		return jsonObject{"type": "string"}
+	}
+
+	switch t := t.(type) {
+	case NamedType:
+		return g.ref(string(t))
+	case ArrayType:
+		return jsonObject{"type": "array", "items": g.schema(t.Elem)}
+	case StructType:
+		return g.object(t)
+	case GoMappedType:
+		return g.schema(t.Type)
+	case StreamType:
+		if t == ByteStream {
+			return jsonObject{"type": "string", "format": "binary"}
+		}
+		return jsonObject{"type": "array", "items": g.schema(t.Elem)}
+	default:
+		panic(errUnimplemented)
+	}
+}
+
+// object creates a schema object for an object with the given fields.
+func (g schemaGen) object(fields []Arg) jsonObject {
+	props := jsonObject{}
+	var required []string
+	for _, f := range fields {
+		props[f.WireName()] = g.field(f)
+		if f.Required {
+			required = append(required, f.WireName())
+		}
+	}
+	obj := jsonObject{"type": "object", "properties": props}
+	if required != nil {
+		obj["required"] = required
+	}
+	return obj
+}
+
+// field creates a schema object for an argument or field, including its description and constraints.
+func (g schemaGen) field(a Arg) jsonObject {
+	schema := g.schema(a.Type)
+	if _, ok := schema["$ref"]; ok {
+		// siblings of a reference are ignored, so wrap it
+		schema = jsonObject{"allOf": []interface{}{schema}}
+	}
+	schema["description"] = a.Description
+	if a.Min != "" {
+		schema["minimum"] = jsonNumber(a.Min)
+	}
+	if a.Max != "" {
+		schema["maximum"] = jsonNumber(a.Max)
+	}
+	if a.MaxLen != 0 {
+		if schema["type"] == "array" {
+			schema["maxItems"] = a.MaxLen
+		} else {
+			schema["maxLength"] = a.MaxLen
+		}
+	}
+	if a.Pattern != "" {
+		schema["pattern"] = a.Pattern
+	}
+	return schema
+}
+
+// jsonNumber converts a Go number literal to a JSON number.
+func jsonNumber(lit string) interface{} {
+	if v, err := strconv.ParseInt(lit, 0, 64); err == nil {
+		return v
+	}
+	if v, err := strconv.ParseUint(lit, 0, 64); err == nil {
+		return v
+	}
+	v, err := strconv.ParseFloat(lit, 64)
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+// rpcErrorSchema creates a schema object for the error container sent over HTTP.
+// The intCodes argument specifies whether the error codes are integers rather than strings.
+func rpcErrorSchema(intCodes bool) jsonObject {
+	codeType := "string"
+	if intCodes {
+		codeType = "integer"
+	}
+	return jsonObject{
+		"type": "object",
+		"properties": jsonObject{
+			"message": jsonObject{"type": "string", "description": "The human-readable error message."},
+			"type":    jsonObject{"type": "string", "description": "The name of the error type, if the error is declared in the spec."},
+			"dat":     jsonObject{"description": "The fields of the error, if the error is declared in the spec."},
+			"code":    jsonObject{"type": codeType, "description": "The machine-readable code of the error, if the error declares one."},
+		},
+		"required": []string{"message"},
+	}
+}
+
+// timeoutErrorSchema creates a schema object for the fields of a TimeoutError.
+func (g schemaGen) timeoutErrorSchema() jsonObject {
+	return g.object([]Arg{
+		{Name: "op", Type: StringType, Description: "The name of the operation.", Required: true},
+		{Name: "timeout", Type: StringType, Description: "The timeout of the operation.", Required: true},
+	})
+}
+
+// rateLimitErrorSchema creates a schema object for the fields of a RateLimitError.
+func (g schemaGen) rateLimitErrorSchema() jsonObject {
+	return g.object([]Arg{
+		{Name: "op", Type: StringType, Description: "The name of the operation.", Required: true},
+		{Name: "retryAfter", Type: Uint32Type, Description: "The number of seconds to wait before retrying the call.", Required: true},
+	})
+}
+
+// unauthorizedErrorSchema creates a schema object for the fields of an UnauthorizedError.
+func (g schemaGen) unauthorizedErrorSchema() jsonObject {
+	return g.object([]Arg{
+		{Name: "op", Type: StringType, Description: "The name of the operation.", Required: true},
+		{Name: "scheme", Type: StringType, Description: "The authentication scheme required by the operation.", Required: true},
+		{Name: "reason", Type: StringType, Description: "The reason the credentials were rejected.", Required: true},
+	})
+}
+
+// validationErrorSchema creates a schema object for the fields of a ValidationError.
+func (g schemaGen) validationErrorSchema() jsonObject {
+	return g.object([]Arg{
+		{Name: "field", Type: StringType, Description: "The path of the invalid argument or field.", Required: true},
+		{Name: "reason", Type: StringType, Description: "A description of the constraint which was not satisfied.", Required: true},
+	})
+}
@@ -0,0 +1,255 @@
+// Package tracing traces the calls made through code generated with rpc-gen.
+// The Tracer interface follows the model of OpenTelemetry, so an OpenTelemetry tracer can be adapted to it with a thin wrapper.
+// Trace contexts are propagated from clients to servers with W3C Trace Context "traceparent" headers.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TraceID identifies a trace.
+type TraceID [16]byte
+
+// SpanID identifies a span within a trace.
+type SpanID [8]byte
+
+// SpanContext is the propagated state of a span.
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+
+	// Flags are the W3C Trace Context trace flags.
+	Flags byte
+
+	// Remote is whether the span context was received from another process.
+	Remote bool
+}
+
+// FlagSampled is the trace flag indicating that the caller may have recorded the trace.
+const FlagSampled = 0x01
+
+// IsValid checks whether the span context has non-zero trace and span IDs.
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != TraceID{} && sc.SpanID != SpanID{}
+}
+
+// TraceParent formats the span context as a traceparent header value.
+func (sc SpanContext) TraceParent() string {
+	return "00-" + hex.EncodeToString(sc.TraceID[:]) + "-" + hex.EncodeToString(sc.SpanID[:]) + "-" + hex.EncodeToString([]byte{sc.Flags})
+}
+
+var errBadTraceParent = errors.New("tracing: malformed traceparent")
+
+// ParseTraceParent parses a traceparent header value.
+// The returned span context is marked as remote.
+func ParseTraceParent(s string) (SpanContext, error) {
+	parts := strings.Split(strings.TrimSpace(s), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) {
+		return SpanContext{}, errBadTraceParent
+	}
+	if _, err := hex.DecodeString(parts[0]); err != nil {
+		return SpanContext{}, errBadTraceParent
+	}
+	sc := SpanContext{Remote: true}
+	var flags [1]byte
+	for _, f := range []struct {
+		dst []byte
+		src string
+	}{
+		{sc.TraceID[:], parts[1]},
+		{sc.SpanID[:], parts[2]},
+		{flags[:], parts[3]},
+	} {
+		if len(f.src) != 2*len(f.dst) || strings.ToLower(f.src) != f.src {
+			return SpanContext{}, errBadTraceParent
+		}
+		if _, err := hex.Decode(f.dst, []byte(f.src)); err != nil {
+			return SpanContext{}, errBadTraceParent
+		}
+	}
+	sc.Flags = flags[0]
+	if !sc.IsValid() {
+		return SpanContext{}, errBadTraceParent
+	}
+	return sc, nil
+}
+
+type spanContextKey struct{}
+
+// ContextWithSpanContext returns a copy of the context carrying the span context.
+func ContextWithSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, spanContextKey{}, sc)
+}
+
+// SpanContextFromContext returns the span context carried by the context.
+// If there is none, the returned span context is not valid.
+func SpanContextFromContext(ctx context.Context) SpanContext {
+	sc, _ := ctx.Value(spanContextKey{}).(SpanContext)
+	return sc
+}
+
+// Inject adds the span context carried by the context to a set of HTTP headers.
+func Inject(ctx context.Context, h http.Header) {
+	if sc := SpanContextFromContext(ctx); sc.IsValid() {
+		h.Set("traceparent", sc.TraceParent())
+	}
+}
+
+// Extract returns a copy of the context carrying the span context sent in a set of HTTP headers.
+// If the headers do not carry a valid span context, the context is returned unchanged.
+func Extract(ctx context.Context, h http.Header) context.Context {
+	sc, err := ParseTraceParent(h.Get("traceparent"))
+	if err != nil {
+		return ctx
+	}
+	return ContextWithSpanContext(ctx, sc)
+}
+
+// SpanKind is the role of a span in a call.
+type SpanKind uint8
+
+const (
+	// Server spans cover the handling of a call by the server.
+	Server SpanKind = iota + 1
+
+	// Client spans cover a call made by a client.
+	Client
+)
+
+func (k SpanKind) String() string {
+	switch k {
+	case Server:
+		return "server"
+	case Client:
+		return "client"
+	default:
+		return "unknown"
+	}
+}
+
+// Span is a traced call.
+type Span interface {
+	// SpanContext returns the span context of the span.
+	SpanContext() SpanContext
+
+	// End completes the span with the outcome of the call.
+	// The outcome is "ok" if the call succeeded, and otherwise the name of the error type.
+	// Errors which are not declared in the spec are reported as "error".
+	// Requests rejected by the server before the operation was run are reported as "rejected".
+	// Stored responses replayed by the server for calls retried with an idempotency key are reported as "replayed".
+	End(outcome string)
+}
+
+// Tracer creates spans.
+// It must be safe for concurrent use.
+type Tracer interface {
+	// Start creates a span as a child of the span context carried by the context, if any.
+	// The span is named "<system>/<op>".
+	// The returned context carries the span context of the new span.
+	Start(ctx context.Context, name string, kind SpanKind) (context.Context, Span)
+}
+
+var (
+	tracerMu sync.RWMutex
+	tracer   Tracer = noopTracer{}
+)
+
+// SetTracer sets the tracer used by generated code.
+// By default, spans are not recorded, but span contexts are still propagated.
+func SetTracer(t Tracer) {
+	if t == nil {
+		t = noopTracer{}
+	}
+	tracerMu.Lock()
+	defer tracerMu.Unlock()
+	tracer = t
+}
+
+// Start creates a span with the tracer set by SetTracer.
+func Start(ctx context.Context, name string, kind SpanKind) (context.Context, Span) {
+	tracerMu.RLock()
+	t := tracer
+	tracerMu.RUnlock()
+	return t.Start(ctx, name, kind)
+}
+
+// noopTracer is a tracer which propagates the span context of the parent without recording anything.
+type noopTracer struct{}
+
+func (noopTracer) Start(ctx context.Context, name string, kind SpanKind) (context.Context, Span) {
+	return ctx, noopSpan{SpanContextFromContext(ctx)}
+}
+
+type noopSpan struct {
+	sc SpanContext
+}
+
+func (s noopSpan) SpanContext() SpanContext { return s.sc }
+
+func (noopSpan) End(string) {}
+
+// SpanData is a record of a completed span.
+type SpanData struct {
+	Name string
+	Kind SpanKind
+
+	// SpanContext is the span context of the span.
+	SpanContext SpanContext
+
+	// Parent is the span context of the parent span.
+	// It is not valid if the span is the root of a trace.
+	Parent SpanContext
+
+	Start, End time.Time
+
+	// Outcome is the outcome passed to Span.End.
+	Outcome string
+}
+
+// Exporter is a Tracer which records spans, and passes them to a function when they end.
+// It is a minimal tracer for use without an OpenTelemetry SDK.
+type Exporter func(SpanData)
+
+// Start creates a span with newly generated IDs.
+func (e Exporter) Start(ctx context.Context, name string, kind SpanKind) (context.Context, Span) {
+	parent := SpanContextFromContext(ctx)
+	sc := SpanContext{TraceID: parent.TraceID, Flags: FlagSampled}
+	if !parent.IsValid() {
+		rand.Read(sc.TraceID[:])
+	}
+	rand.Read(sc.SpanID[:])
+	s := &exportSpan{
+		export: e,
+		data: SpanData{
+			Name:        name,
+			Kind:        kind,
+			SpanContext: sc,
+			Parent:      parent,
+			Start:       time.Now(),
+		},
+	}
+	return ContextWithSpanContext(ctx, sc), s
+}
+
+type exportSpan struct {
+	export Exporter
+	once   sync.Once
+	data   SpanData
+}
+
+func (s *exportSpan) SpanContext() SpanContext { return s.data.SpanContext }
+
+func (s *exportSpan) End(outcome string) {
+	s.once.Do(func() {
+		s.data.End = time.Now()
+		s.data.Outcome = outcome
+		s.export(s.data)
+	})
+}
@@ -0,0 +1,77 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+func TestTraceParent(t *testing.T) {
+	t.Parallel()
+
+	const valid = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	sc, err := ParseTraceParent(valid)
+	if err != nil {
+		t.Fatalf("failed to parse: %v", err)
+	}
+	if !sc.Remote || sc.Flags != FlagSampled || sc.SpanID != (SpanID{0x00, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7}) {
+		t.Errorf("unexpected span context %+v", sc)
+	}
+	if got := sc.TraceParent(); got != valid {
+		t.Errorf("expected %q; got %q", valid, got)
+	}
+
+	for _, s := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e473-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e473x-00f067aa0ba902b7-01",
+	} {
+		if _, err := ParseTraceParent(s); err == nil {
+			t.Errorf("parsed invalid traceparent %q", s)
+		}
+	}
+	if _, err := ParseTraceParent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra"); err != nil {
+		t.Errorf("failed to parse future version: %v", err)
+	}
+}
+
+func TestPropagation(t *testing.T) {
+	t.Parallel()
+
+	var spans []SpanData
+	tracer := Exporter(func(d SpanData) { spans = append(spans, d) })
+
+	ctx, client := tracer.Start(context.Background(), "Math/Add", Client)
+	h := http.Header{}
+	Inject(ctx, h)
+	sctx, server := tracer.Start(Extract(context.Background(), h), "Math/Add", Server)
+	server.End("ok")
+	client.End("ErrDivideByZero")
+	client.End("ok")
+
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans; got %d", len(spans))
+	}
+	s, c := spans[0], spans[1]
+	if c.Parent.IsValid() || c.Outcome != "ErrDivideByZero" || c.Kind != Client {
+		t.Errorf("unexpected client span %+v", c)
+	}
+	if s.SpanContext.TraceID != c.SpanContext.TraceID || s.Parent.SpanID != c.SpanContext.SpanID || !s.Parent.Remote {
+		t.Errorf("server span %+v is not a child of client span %+v", s, c)
+	}
+	if SpanContextFromContext(sctx) != s.SpanContext {
+		t.Error("context does not carry the server span context")
+	}
+
+	// the default tracer only propagates
+	ctx, span := Start(Extract(context.Background(), h), "Math/Add", Server)
+	if span.SpanContext().SpanID != c.SpanContext.SpanID || SpanContextFromContext(ctx).SpanID != c.SpanContext.SpanID {
+		t.Errorf("unexpected span context %+v", span.SpanContext())
+	}
+}
@@ -0,0 +1,332 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// underlying resolves a type to its underlying unnamed type.
+// Returns nil if the type is not defined.
+func (s *System) underlying(t Type) Type {
+	for i := 0; i <= len(s.Types); i++ {
+		nt, ok := t.(NamedType)
+		if !ok {
+			return t
+		}
+		t = s.typeByName(string(nt))
+	}
+	// the named types form a cycle
+	return nil
+}
+
+// needsValidation checks whether values of a type contain constrained fields.
+func (s *System) needsValidation(t Type) bool {
+	return s.containsConstraints(t, map[NamedType]struct{}{})
+}
+
+func (s *System) containsConstraints(t Type, seen map[NamedType]struct{}) bool {
+	switch t := t.(type) {
+	case NamedType:
+		if _, ok := seen[t]; ok {
+			return false
+		}
+		seen[t] = struct{}{}
+		return s.containsConstraints(s.typeByName(string(t)), seen)
+	case ArrayType:
+		return s.containsConstraints(t.Elem, seen)
+	case StructType:
+		for _, f := range t {
+			if f.constrained() || s.containsConstraints(f.Type, seen) {
+				return true
+			}
+		}
+		return false
+	default:
+		return false
+	}
+}
+
+// argValidated checks whether an argument must be validated.
+func (s *System) argValidated(a Arg) bool {
+	return a.constrained() || s.needsValidation(a.Type)
+}
+
+// opValidated checks whether the non-stream inputs of an operation must be validated.
+func (s *System) opValidated(op Op) bool {
+	for _, a := range op.Inputs {
+		if _, ok := a.Type.(StreamType); ok {
+			continue
+		}
+		if s.argValidated(a) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkConstraints checks that the constraints on an argument can be applied to its type.
+func (s *System) checkConstraints(a Arg) error {
+	if !a.constrained() {
+		return nil
+	}
+	switch t := a.Type.(type) {
+	case StreamType:
+		return fmt.Errorf("argument %q is a stream and cannot be constrained", a.Name)
+	case GoMappedType:
+		return fmt.Errorf("argument %q has Go type %q and cannot be constrained", a.Name, t.Go)
+	}
+	ut := s.underlying(a.Type)
+	if ut == nil {
+		return fmt.Errorf("argument %q has undefined type %q", a.Name, a.Type.String())
+	}
+	var numeric, str, array bool
+	switch ut {
+	case Uint8Type, Uint16Type, Uint32Type, Uint64Type, ByteType,
+		Int8Type, Int16Type, Int32Type, Int64Type,
+		Float32Type, Float64Type:
+		numeric = true
+	case StringType:
+		str = true
+	default:
+		_, array = ut.(ArrayType)
+	}
+	if (a.Min != "" || a.Max != "") && !numeric {
+		return fmt.Errorf("min and max cannot be applied to argument %q of type %q", a.Name, a.Type.String())
+	}
+	if a.MaxLen != 0 && !(str || array) {
+		return fmt.Errorf("maxlen cannot be applied to argument %q of type %q", a.Name, a.Type.String())
+	}
+	if a.Pattern != "" && !str {
+		return fmt.Errorf("pattern cannot be applied to argument %q of type %q", a.Name, a.Type.String())
+	}
+	if a.Required && !(numeric || str || array) {
+		return fmt.Errorf("required cannot be applied to argument %q of type %q", a.Name, a.Type.String())
+	}
+	if !numeric {
+		return nil
+	}
+
+	// check that the bounds are representable
+	var min, max float64
+	for _, b := range []struct {
+		lit string
+		v   *float64
+	}{{a.Min, &min}, {a.Max, &max}} {
+		if b.lit == "" {
+			continue
+		}
+		var err error
+		switch ut {
+		case Float32Type, Float64Type:
+			*b.v, err = strconv.ParseFloat(b.lit, 64)
+		case Int8Type, Int16Type, Int32Type, Int64Type:
+			var v int64
+			v, err = strconv.ParseInt(b.lit, 0, bitSize(ut.(PrimitiveType)))
+			*b.v = float64(v)
+		default:
+			var v uint64
+			v, err = strconv.ParseUint(b.lit, 0, bitSize(ut.(PrimitiveType)))
+			*b.v = float64(v)
+		}
+		if err != nil {
+			return fmt.Errorf("invalid bound %s on argument %q of type %q: %w", b.lit, a.Name, a.Type.String(), err)
+		}
+	}
+	if a.Min != "" && a.Max != "" && min > max {
+		return fmt.Errorf("argument %q has min %s greater than max %s", a.Name, a.Min, a.Max)
+	}
+	return nil
+}
+
+// bitSize returns the size of a primitive numeric type in bits.
+func bitSize(t PrimitiveType) int {
+	switch t {
+	case Uint8Type, Int8Type, ByteType:
+		return 8
+	case Uint16Type, Int16Type:
+		return 16
+	case Uint32Type, Int32Type, Float32Type:
+		return 32
+	default:
+		return 64
+	}
+}
+
+// checkTypeConstraints checks the constraints on all fields within a type.
+func (s *System) checkTypeConstraints(t Type) error {
+	switch t := t.(type) {
+	case ArrayType:
+		return s.checkTypeConstraints(t.Elem)
+	case StructType:
+		for _, f := range t {
+			if err := s.checkConstraints(f); err != nil {
+				return err
+			}
+			if err := s.checkTypeConstraints(f.Type); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// prepValidation checks the validation constraints used within the system.
+func (s *System) prepValidation() error {
+	for _, e := range s.Errors {
+		if e.Name == "ValidationError" || e.Name == "TimeoutError" || e.Name == "UnauthorizedError" || e.Name == "RateLimitError" {
+			return fmt.Errorf("the error name %s is reserved", e.Name)
+		}
+		for _, f := range e.Fields {
+			if f.constrained() {
+				return fmt.Errorf("field %q of error %q cannot be constrained", f.Name, e.Name)
+			}
+		}
+	}
+	for _, td := range s.Types {
+		if err := s.checkTypeConstraints(td.Type); err != nil {
+			return fmt.Errorf("type %q: %w", td.Name, err)
+		}
+	}
+	for _, op := range s.operations() {
+		for _, a := range op.Inputs {
+			if err := s.checkConstraints(a); err != nil {
+				return fmt.Errorf("operation %q: %w", op.Name, err)
+			}
+			if err := s.checkTypeConstraints(a.Type); err != nil {
+				return fmt.Errorf("operation %q: %w", op.Name, err)
+			}
+		}
+		for _, a := range op.Outputs {
+			if a.constrained() {
+				return fmt.Errorf("operation %q: output %q cannot be constrained", op.Name, a.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// validationPatterns returns the sorted set of patterns used in the system.
+func (s *System) validationPatterns() []string {
+	set := map[string]struct{}{}
+	var walk func(t Type, seen map[NamedType]struct{})
+	walk = func(t Type, seen map[NamedType]struct{}) {
+		switch t := t.(type) {
+		case NamedType:
+			if _, ok := seen[t]; ok {
+				return
+			}
+			seen[t] = struct{}{}
+			walk(s.typeByName(string(t)), seen)
+		case ArrayType:
+			walk(t.Elem, seen)
+		case StructType:
+			for _, f := range t {
+				if f.Pattern != "" {
+					set[f.Pattern] = struct{}{}
+				}
+				walk(f.Type, seen)
+			}
+		}
+	}
+	for _, td := range s.Types {
+		walk(td.Type, map[NamedType]struct{}{})
+	}
+	for _, op := range s.operations() {
+		for _, a := range op.Inputs {
+			if a.Pattern != "" {
+				set[a.Pattern] = struct{}{}
+			}
+			walk(a.Type, map[NamedType]struct{}{})
+		}
+	}
+	patterns := make([]string, 0, len(set))
+	for p := range set {
+		patterns = append(patterns, p)
+	}
+	sort.Strings(patterns)
+	return patterns
+}
+
+// joinPath appends a field name to a Go expression which evaluates to a field path.
+func joinPath(path, field string) string {
+	switch {
+	case path == `""`:
+		return strconv.Quote(field)
+	case strings.HasSuffix(path, `"`):
+		lit, err := strconv.Unquote(path)
+		if err == nil {
+			return strconv.Quote(lit + "." + field)
+		}
+	}
+	return path + " + " + strconv.Quote("."+field)
+}
+
+// goValidate generates Go statements validating the value of an argument.
+// The expr is the Go expression of the value, and path is a Go expression evaluating to the field path.
+// The generated code returns a *ValidationError on failure.
+func (s *System) goValidate(a Arg, expr, path string, depth int) string {
+	var b strings.Builder
+	fail := func(cond string, reason string) {
+		fmt.Fprintf(&b, "if %s {\nreturn &ValidationError{Field: %s, Reason: %q}\n}\n", cond, path, reason)
+	}
+	ut := s.underlying(a.Type)
+	_, array := ut.(ArrayType)
+	if a.Required {
+		if ut == StringType || array {
+			fail(fmt.Sprintf("len(%s) == 0", expr), "required")
+		} else {
+			fail(fmt.Sprintf("%s == 0", expr), "required")
+		}
+	}
+	if a.Min != "" {
+		fail(fmt.Sprintf("%s < %s", expr, a.Min), "must be at least "+a.Min)
+	}
+	if a.Max != "" {
+		fail(fmt.Sprintf("%s > %s", expr, a.Max), "must be at most "+a.Max)
+	}
+	if a.MaxLen != 0 {
+		if array {
+			fail(fmt.Sprintf("len(%s) > %d", expr, a.MaxLen), fmt.Sprintf("must have at most %d elements", a.MaxLen))
+		} else {
+			fail(fmt.Sprintf("utf8.RuneCountInString(string(%s)) > %d", expr, a.MaxLen), fmt.Sprintf("must be at most %d characters", a.MaxLen))
+		}
+	}
+	if a.Pattern != "" {
+		fail(
+			fmt.Sprintf("len(%s) != 0 && !validationPatterns[%q].MatchString(string(%s))", expr, a.Pattern, expr),
+			fmt.Sprintf("must match pattern %q", a.Pattern),
+		)
+	}
+	if !s.needsValidation(a.Type) {
+		return b.String()
+	}
+
+	switch t := a.Type.(type) {
+	case NamedType:
+		fmt.Fprintf(&b, "if verr := %s.validate(); verr != nil {\nreturn verr.within(%s)\n}\n", expr, path)
+	case ArrayType:
+		idx := "i" + strconv.Itoa(depth)
+		epath := fmt.Sprintf("fmt.Sprintf(\"%%s[%%d]\", %s, %s)", path, idx)
+		if lit, err := strconv.Unquote(path); err == nil {
+			epath = fmt.Sprintf("fmt.Sprintf(%q, %s)", strings.Replace(lit, "%", "%%", -1)+"[%d]", idx)
+		}
+		fmt.Fprintf(&b, "for %s := range %s {\n", idx, expr)
+		b.WriteString(s.goValidate(
+			Arg{Name: a.Name, Type: t.Elem},
+			fmt.Sprintf("%s[%s]", expr, idx),
+			epath,
+			depth+1,
+		))
+		b.WriteString("}\n")
+	case StructType:
+		for _, f := range t {
+			if !s.argValidated(f) {
+				continue
+			}
+			b.WriteString(s.goValidate(f, expr+"."+f.Name, joinPath(path, f.WireName()), depth))
+		}
+	}
+	return b.String()
+}
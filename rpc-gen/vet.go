@@ -0,0 +1,215 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"text/scanner"
+
+	"github.com/niaow/exp/conf"
+)
+
+// diagnostic is a likely mistake found in a spec.
+type diagnostic struct {
+	// Pos is the position of the problem in the spec.
+	Pos scanner.Position
+
+	// Msg is a description of the problem.
+	Msg string
+
+	// Check is the name of the check which found the problem.
+	Check string
+}
+
+func (d diagnostic) String() string {
+	return fmt.Sprintf("%s: %s", d.Pos.String(), d.Msg)
+}
+
+// vetter accumulates diagnostics while checking a system.
+type vetter struct {
+	sys   *System
+	diags []diagnostic
+}
+
+func (v *vetter) report(pos scanner.Position, check string, format string, args ...interface{}) {
+	v.diags = append(v.diags, diagnostic{Pos: pos, Msg: fmt.Sprintf(format, args...), Check: check})
+}
+
+// checkDesc checks that a description is present and not blank.
+func (v *vetter) checkDesc(pos scanner.Position, desc string, format string, args ...interface{}) {
+	switch {
+	case desc == "":
+		v.report(pos, "missing-description", "%s is missing a description", fmt.Sprintf(format, args...))
+	case strings.TrimSpace(desc) == "":
+		v.report(pos, "blank-description", "%s has a blank description", fmt.Sprintf(format, args...))
+	}
+}
+
+// checkType checks the named type references within a type, and the descriptions of any struct fields.
+func (v *vetter) checkType(pos scanner.Position, t Type) {
+	switch t := t.(type) {
+	case NamedType:
+		if v.sys.typeByName(string(t)) == nil {
+			v.report(pos, "undefined-type", "undefined type %q", string(t))
+		}
+	case ArrayType:
+		v.checkType(pos, t.Elem)
+	case GoMappedType:
+		v.checkType(pos, t.Type)
+	case StreamType:
+		v.checkType(pos, t.Elem)
+	case StructType:
+		for _, f := range t {
+			v.checkArg(f, "field")
+		}
+	}
+}
+
+// checkArg checks an argument or struct field.
+func (v *vetter) checkArg(a Arg, kind string) {
+	v.checkDesc(a.Pos, a.Description, "%s %q", kind, a.Name)
+	v.checkType(a.Pos, a.Type)
+}
+
+// vet checks a system for likely mistakes which do not prevent code generation.
+// The diagnostics are sorted by position.
+func (s *System) vet() []diagnostic {
+	v := vetter{sys: s}
+
+	for _, td := range s.Types {
+		v.checkDesc(td.Pos, td.Description, "type %q", td.Name)
+		v.checkType(td.Pos, td.Type)
+	}
+
+	errs := map[string]Error{}
+	for _, e := range s.Errors {
+		errs[e.Name] = e
+		v.checkDesc(e.Pos, e.Description, "error %q", e.Name)
+		for _, f := range e.Fields {
+			v.checkArg(f, "field")
+		}
+	}
+
+	used := map[string]struct{}{}
+	for _, sub := range s.Systems {
+		v.checkDesc(sub.Pos, sub.Description, "system %q", sub.Name)
+		v.vetOps(sub, errs, used)
+	}
+
+	for _, e := range s.Errors {
+		if e.Pos.Filename != s.Pos.Filename {
+			// errors in included specs may be shared by other systems
+			continue
+		}
+		if _, ok := used[e.Name]; !ok {
+			v.report(e.Pos, "unused-error", "error %q is not used by any op", e.Name)
+		}
+	}
+
+	sort.SliceStable(v.diags, func(i, j int) bool {
+		pi, pj := v.diags[i].Pos, v.diags[j].Pos
+		switch {
+		case pi.Filename != pj.Filename:
+			return pi.Filename < pj.Filename
+		case pi.Line != pj.Line:
+			return pi.Line < pj.Line
+		default:
+			return pi.Column < pj.Column
+		}
+	})
+	return v.diags
+}
+
+// requireDescriptions returns an error for the first missing description in a system.
+// Code is not generated without descriptions, since they document the generated code, but vet reports every missing description.
+func (s *System) requireDescriptions() error {
+	for _, d := range s.vet() {
+		if d.Check == "missing-description" {
+			return conf.WrapPos(errors.New(d.Msg), d.Pos)
+		}
+	}
+	return nil
+}
+
+// vetOps checks the operations of a system.
+// The names of the referenced errors are added to used.
+func (v *vetter) vetOps(sub System, errs map[string]Error, used map[string]struct{}) {
+	paths := map[string]Op{}
+	for _, op := range sub.Operations {
+		v.checkDesc(op.Pos, op.Description, "op %q", op.Name)
+		for _, a := range op.Inputs {
+			v.checkArg(a, "input")
+		}
+		for _, a := range op.Outputs {
+			v.checkArg(a, "output")
+		}
+
+		for i, name := range op.Errors {
+			used[name] = struct{}{}
+			if _, ok := errs[name]; !ok {
+				pos := op.Pos
+				if i < len(op.errPos) {
+					pos = op.errPos[i]
+				}
+				v.report(pos, "undefined-error", "op %q references undefined error %q", op.Name, name)
+			}
+		}
+
+		if prev, ok := paths[op.Path]; ok {
+			v.report(op.Pos, "duplicate-path", "op %q has the same path %q as op %q (%s)", op.Name, op.Path, prev.Name, prev.Pos.String())
+		} else {
+			paths[op.Path] = op
+		}
+
+		switch op.Method {
+		case http.MethodGet, http.MethodHead:
+			if op.duplex() {
+				break
+			}
+			if op.inStream() || (op.ArgEncoding != "query" && len(op.Inputs) != 0) {
+				v.report(op.Pos, "get-body", "op %q uses the %s method but sends a request body", op.Name, op.Method)
+			}
+		}
+	}
+}
+
+// vetMain runs the "vet" subcommand, and returns the exit status.
+func vetMain(args []string) int {
+	fs := flag.NewFlagSet("vet", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: rpc-gen vet spec...")
+		fmt.Fprintln(fs.Output(), "Vet reports likely mistakes in specs.")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	status := 0
+	for _, spec := range fs.Args() {
+		sf, err := os.Open(spec)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			status = 1
+			continue
+		}
+		sys, err := parseSystem(sf)
+		sf.Close()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			status = 1
+			continue
+		}
+		for _, d := range sys.vet() {
+			fmt.Fprintln(os.Stderr, d)
+			status = 1
+		}
+	}
+	return status
+}
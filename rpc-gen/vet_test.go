@@ -0,0 +1,96 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestVet(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name string
+
+		// src is the spec to vet.
+		src string
+
+		// checks are the names of the checks expected to report problems, in order.
+		checks []string
+	}{
+		{
+			name: "Clean",
+			src:  specWithOps("Get"),
+		},
+		{
+			name:   "MissingDescription",
+			src:    "name Test\ndesc \"Test is a test system.\"\nop Get {\n    in X {\n        type uint32\n    }\n}\n",
+			checks: []string{"missing-description", "missing-description"},
+		},
+		{
+			name:   "BlankDescription",
+			src:    "name Test\ndesc \"  \"\nop Get {\n    desc \"Get does nothing.\"\n}\n",
+			checks: []string{"blank-description"},
+		},
+		{
+			name: "UndefinedType",
+			src: specWithOps("Get") +
+				"op Put {\n    desc \"Put stores a point.\"\n    in P {\n        type Point\n        desc \"P is the point.\"\n    }\n}\n",
+			checks: []string{"undefined-type"},
+		},
+		{
+			name: "UndefinedError",
+			src: specWithOps("Get") +
+				"op Put {\n    desc \"Put does nothing.\"\n    err Missing\n}\n",
+			checks: []string{"undefined-error"},
+		},
+		{
+			name: "UnusedError",
+			src: specWithOps("Get") +
+				"error Unused {\n    desc \"Unused is never returned.\"\n    text \"unused\"\n}\n",
+			checks: []string{"unused-error"},
+		},
+		{
+			name: "DuplicatePath",
+			src: specWithOps("Get") +
+				"op Put {\n    desc \"Put does nothing.\"\n    path \"Get\"\n}\n",
+			checks: []string{"duplicate-path"},
+		},
+		{
+			name: "GetBody",
+			src: "name Test\ndesc \"Test is a test system.\"\n" +
+				"op Get {\n    desc \"Get sends a body.\"\n    method GET\n    encoding json\n    in X {\n        type uint32\n        desc \"X is ignored.\"\n    }\n}\n",
+			checks: []string{"get-body"},
+		},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			t.Parallel()
+
+			sys, err := parseSystem(strings.NewReader(c.src))
+			if err != nil {
+				t.Fatalf("failed to parse spec: %v", err)
+			}
+			var checks []string
+			for _, d := range sys.vet() {
+				checks = append(checks, d.Check)
+			}
+			if !reflect.DeepEqual(checks, c.checks) {
+				t.Errorf("expected checks %q but got %q (%v)", c.checks, checks, sys.vet())
+			}
+		})
+	}
+}
+
+func TestRequireDescriptions(t *testing.T) {
+	t.Parallel()
+
+	sys, err := parseSystem(strings.NewReader("name Test\ndesc \"Test is a test system.\"\nop Get {\n    in X {\n        type uint32\n        desc \"X is ignored.\"\n    }\n}\n"))
+	if err != nil {
+		t.Fatalf("failed to parse spec: %v", err)
+	}
+	if err := sys.requireDescriptions(); err == nil || !strings.Contains(err.Error(), `op "Get" is missing a description`) {
+		t.Errorf("expected a missing description error but got %v", err)
+	}
+}
@@ -752,13 +752,16 @@ start:
 		buf = buf[:c.readLength]
 		fallthrough
 	default:
-		_, err := c.brw.Read(buf)
+		n, err := c.brw.Read(buf)
 		if err != nil {
 			return 0, err
 		}
+		buf = buf[:n]
 		if c.readFrame.mask {
+			// the mask is aligned to the start of the frame, which may have been partially read already
+			off := c.readFrame.length - c.readLength
 			for i, v := range buf {
-				buf[i] = v ^ c.readFrame.maskKey[i%4]
+				buf[i] = v ^ c.readFrame.maskKey[(off+uint64(i))%4]
 			}
 		}
 		c.readLength -= uint64(len(buf))
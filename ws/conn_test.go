@@ -0,0 +1,75 @@
+package ws
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+	"testing/iotest"
+)
+
+// maskedFrame encodes a masked frame with the given payload.
+func maskedFrame(t *testing.T, fin bool, opcode uint8, key [4]byte, payload string) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	w := bufio.NewWriter(&buf)
+	err := header{
+		fin:     fin,
+		opcode:  opcode,
+		mask:    true,
+		length:  uint64(len(payload)),
+		maskKey: key,
+	}.write(w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < len(payload); i++ {
+		w.WriteByte(payload[i] ^ key[i%4])
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestReadMaskedPartial(t *testing.T) {
+	t.Parallel()
+
+	first, second := "the quick brown fox ", "jumps over the lazy dog"
+	var stream []byte
+	stream = append(stream, maskedFrame(t, false, opText, [4]byte{0x12, 0x34, 0x56, 0x78}, first)...)
+	stream = append(stream, maskedFrame(t, true, opContinue, [4]byte{0x9a, 0xbc, 0xde, 0xf0}, second)...)
+
+	for _, size := range []int{1, 2, 3, 5, 64} {
+		// The underlying reader returns a single byte at a time, so each read ends at an arbitrary offset in the mask.
+		r := bufio.NewReaderSize(iotest.OneByteReader(bytes.NewReader(stream)), 16)
+		c := &Conn{brw: bufio.NewReadWriter(r, bufio.NewWriter(ioutil.Discard))}
+
+		f, err := c.NextFrame()
+		if err != nil {
+			t.Fatalf("failed to read frame: %v", err)
+		}
+		if f != TextFrame {
+			t.Fatalf("expected text frame but got %d", f)
+		}
+
+		var got []byte
+		buf := make([]byte, size)
+		for {
+			n, err := c.Read(buf)
+			got = append(got, buf[:n]...)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("failed to read with a buffer of %d bytes: %v", size, err)
+			}
+		}
+		if string(got) != first+second {
+			t.Errorf("expected %q but got %q with a buffer of %d bytes", first+second, got, size)
+		}
+	}
+}